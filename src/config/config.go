@@ -4,6 +4,8 @@ import (
 	"fmt"
 	"log"
 	"os"
+	"strconv"
+	"time"
 
 	"github.com/joho/godotenv"
 	mp_config "github.com/mercadopago/sdk-go/pkg/config"
@@ -38,6 +40,13 @@ var (
 	mercadoPagoPublicKey   string
 	mercadoPagoConfig      *mp_config.Config
 	webhook_signature      string
+	manifestSigningSecret  string
+	waitlistConfirmWindow  time.Duration
+	purchaseCooldown       time.Duration
+	pixPurchaseTTL         time.Duration
+	emailRateLimit         int
+	emailRateWindow        time.Duration
+	purchaseTaxPercent     int
 )
 
 func LoadConfig(path string) *Config {
@@ -61,6 +70,72 @@ func LoadConfig(path string) *Config {
 	mercadoPagoAccessToken = os.Getenv("MERCADO_PAGO_ACCESS_TOKEN")
 	mercadoPagoPublicKey = os.Getenv("MERCADO_PAGO_PUBLIC_KEY")
 	webhook_signature = os.Getenv("WEBHOOK_SIGNATURE")
+	manifestSigningSecret = os.Getenv("MANIFEST_SIGNING_SECRET")
+
+	// Minutes a promoted waitlist user has to confirm, 0 opts out and promotes directly
+	waitlistConfirmWindow = 60 * time.Minute
+	if window := os.Getenv("WAITLIST_CONFIRM_WINDOW"); window != "" {
+		minutes, err := strconv.Atoi(window)
+		if err != nil || minutes < 0 {
+			log.Printf("Invalid WAITLIST_CONFIRM_WINDOW %q, using %v", window, waitlistConfirmWindow)
+		} else {
+			waitlistConfirmWindow = time.Duration(minutes) * time.Minute
+		}
+	}
+
+	// Seconds a user must wait between purchase attempts, 0 disables the cooldown
+	purchaseCooldown = 5 * time.Second
+	if cooldown := os.Getenv("PURCHASE_COOLDOWN_SECONDS"); cooldown != "" {
+		seconds, err := strconv.Atoi(cooldown)
+		if err != nil || seconds < 0 {
+			log.Printf("Invalid PURCHASE_COOLDOWN_SECONDS %q, using %v", cooldown, purchaseCooldown)
+		} else {
+			purchaseCooldown = time.Duration(seconds) * time.Second
+		}
+	}
+
+	// Minutes a pending pix purchase is kept before it is cancelled, 0 keeps them until paid
+	pixPurchaseTTL = 24 * time.Hour
+	if ttl := os.Getenv("PIX_PURCHASE_TTL"); ttl != "" {
+		minutes, err := strconv.Atoi(ttl)
+		if err != nil || minutes < 0 {
+			log.Printf("Invalid PIX_PURCHASE_TTL %q, using %v", ttl, pixPurchaseTTL)
+		} else {
+			pixPurchaseTTL = time.Duration(minutes) * time.Minute
+		}
+	}
+
+	// Password reset and verification emails a single address can ask for per window, 0 disables the limit
+	emailRateLimit = 3
+	if limit := os.Getenv("EMAIL_RATE_LIMIT"); limit != "" {
+		requests, err := strconv.Atoi(limit)
+		if err != nil || requests < 0 {
+			log.Printf("Invalid EMAIL_RATE_LIMIT %q, using %v", limit, emailRateLimit)
+		} else {
+			emailRateLimit = requests
+		}
+	}
+
+	emailRateWindow = 15 * time.Minute
+	if window := os.Getenv("EMAIL_RATE_WINDOW"); window != "" {
+		minutes, err := strconv.Atoi(window)
+		if err != nil || minutes <= 0 {
+			log.Printf("Invalid EMAIL_RATE_WINDOW %q, using %v", window, emailRateWindow)
+		} else {
+			emailRateWindow = time.Duration(minutes) * time.Minute
+		}
+	}
+
+	// Percentage added over the discounted price of paid products, 0 charges no tax
+	purchaseTaxPercent = 0
+	if tax := os.Getenv("PURCHASE_TAX_PERCENT"); tax != "" {
+		percent, err := strconv.Atoi(tax)
+		if err != nil || percent < 0 || percent > 100 {
+			log.Printf("Invalid PURCHASE_TAX_PERCENT %q, using %v", tax, purchaseTaxPercent)
+		} else {
+			purchaseTaxPercent = percent
+		}
+	}
 
 	accessToken := mercadoPagoAccessToken
 	mercadoPagoConfig, err = mp_config.New(accessToken)
@@ -145,3 +220,31 @@ func GetMercadoPagoConfig() *mp_config.Config {
 func GetWebhookSignature() string {
 	return webhook_signature
 }
+
+func GetManifestSigningSecret() string {
+	return manifestSigningSecret
+}
+
+func GetWaitlistConfirmWindow() time.Duration {
+	return waitlistConfirmWindow
+}
+
+func GetPurchaseCooldown() time.Duration {
+	return purchaseCooldown
+}
+
+func GetPixPurchaseTTL() time.Duration {
+	return pixPurchaseTTL
+}
+
+func GetEmailRateLimit() int {
+	return emailRateLimit
+}
+
+func GetEmailRateWindow() time.Duration {
+	return emailRateWindow
+}
+
+func GetPurchaseTaxPercent() int {
+	return purchaseTaxPercent
+}
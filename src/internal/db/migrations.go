@@ -8,27 +8,67 @@ import (
 func Migrate() {
 	log.Println("running database migrations...")
 
+	// Checked before AutoMigrate adds the columns, so the backfill below only runs once
+	hadPurchasePrices := DB.Migrator().HasColumn(&models.Purchase{}, "unit_price_int")
+	hadPixPurchasePrices := DB.Migrator().HasColumn(&models.PixPurchase{}, "unit_price_int")
+
 	err := DB.AutoMigrate(
 		&models.User{},
 		&models.UserPass{},
 		&models.RefreshToken{},
 		&models.Event{},
 		&models.EventRegistration{},
+		&models.EventRegistrationDetails{},
+		&models.EventAnnouncement{},
+		&models.RegistrationCancellation{},
+		&models.EventCancellation{},
+		&models.CancellationEntry{},
+		&models.Certificate{},
 		&models.AdminStatus{},
 		&models.UserVerification{},
 		&models.Activity{},
 		&models.ActivityRegistration{},
+		&models.ActivityWaitlist{},
 		&models.Product{},
 		&models.Purchase{},
+		&models.PurchaseRefund{},
 		&models.UserProduct{},
 		&models.UserToken{},
 		&models.ProductBundle{},
 		&models.AccessTarget{},
+		&models.ProductAccessGrant{},
 		&models.PixPurchase{},
+		&models.Coupon{},
+		&models.ProcessedWebhook{},
+		&models.AuditLog{},
 	)
 	if err != nil {
 		log.Fatalf("migrations failed: %v", err)
 	}
 
+	// product_bundles used to be created as a many2many join table, its key columns are never
+	// written by the ProductBundle model and would reject every new bundle
+	for _, column := range []string{"product_id", "bundled_product_id"} {
+		if DB.Migrator().HasColumn(&models.ProductBundle{}, column) {
+			if err := DB.Migrator().DropColumn(&models.ProductBundle{}, column); err != nil {
+				log.Fatalf("migrations failed: %v", err)
+			}
+		}
+	}
+
+	// Purchases made before the unit price was stored get the current product price, the best value known
+	if !hadPurchasePrices {
+		if err := DB.Exec(`UPDATE purchases SET unit_price_int = products.price_int
+			FROM products WHERE products.id = purchases.product_id`).Error; err != nil {
+			log.Fatalf("migrations failed: %v", err)
+		}
+	}
+	if !hadPixPurchasePrices {
+		if err := DB.Exec(`UPDATE pix_purchases SET unit_price_int = products.price_int
+			FROM products WHERE products.id = pix_purchases.product_id`).Error; err != nil {
+			log.Fatalf("migrations failed: %v", err)
+		}
+	}
+
 	log.Println("database migrated successfully")
 }
@@ -2,10 +2,13 @@ package handlers
 
 import (
 	"errors"
+	"fmt"
+	"log"
 	"net/http"
 	"scti/internal/models"
 	"scti/internal/services"
 	"strings"
+	"time"
 )
 
 type ActivityHandler struct {
@@ -20,7 +23,8 @@ func NewActivityHandler(activityService *services.ActivityService) *ActivityHand
 
 // CreateEventActivity godoc
 // @Summary      Create a new activity for an event
-// @Description  Creates a new activity for the specified event
+// @Description  Creates a new activity for the specified event. A speaker double-booking is reported in the message,
+// @Description  or rejected with 409 when reject_speaker_conflicts is set
 // @Tags         activities
 // @Accept       json
 // @Produce      json
@@ -33,6 +37,7 @@ func NewActivityHandler(activityService *services.ActivityService) *ActivityHand
 // @Failure      400  {object}  ActivityStandardErrorResponse
 // @Failure      401  {object}  ActivityStandardErrorResponse
 // @Failure      403  {object}  ActivityStandardErrorResponse
+// @Failure      409  {object}  ActivityStandardErrorResponse
 // @Router       /events/{slug}/activity [post]
 func (h *ActivityHandler) CreateEventActivity(w http.ResponseWriter, r *http.Request) {
 	slug, err := extractSlugAndValidate(r)
@@ -57,21 +62,29 @@ func (h *ActivityHandler) CreateEventActivity(w http.ResponseWriter, r *http.Req
 		return
 	}
 
-	activity, err := h.ActivityService.CreateEventActivity(user, slug, reqBody)
+	activity, conflicts, err := h.ActivityService.CreateEventActivity(user, slug, reqBody)
 	if err != nil {
-		HandleErrMsg("Error creating activity", err, w).Stack("activity").BadRequest()
+		if strings.Contains(err.Error(), "speaker conflict") {
+			ConflictError(w, err, "Speaker", "activity")
+		} else {
+			HandleErrMsg("Error creating activity", err, w).Stack("activity").BadRequest()
+		}
 		return
 	}
 
-	handleSuccess(w, activity, "", http.StatusOK)
+	handleSuccess(w, activity, speakerConflictWarning(conflicts), http.StatusOK)
 }
 
 // GetAllActivitiesFromEvent godoc
 // @Summary      Get all activities for an event
-// @Description  Returns all activities for the specified event
+// @Description  Returns all activities for the specified event, optionally filtered by type, speaker and time window
 // @Tags         activities
 // @Produce      json
 // @Param        slug path string true "Event slug"
+// @Param        type query string false "Activity type" Enums(palestra, mini-curso, visita-tecnica, coffee-break)
+// @Param        speaker query string false "Part of the speaker name, ignoring case"
+// @Param        from query string false "Only activities starting at or after, RFC3339" example(2025-05-01T08:00:00Z)
+// @Param        to query string false "Only activities ending at or before, RFC3339" example(2025-05-01T18:00:00Z)
 // @Success      200  {object}  NoMessageSuccessResponse{data=[]models.Activity}
 // @Failure      400  {object}  ActivityStandardErrorResponse
 // @Router       /events/{slug}/activities [get]
@@ -82,7 +95,13 @@ func (h *ActivityHandler) GetAllActivitiesFromEvent(w http.ResponseWriter, r *ht
 		return
 	}
 
-	activities, err := h.ActivityService.GetAllActivitiesFromEvent(slug)
+	filter, err := parseActivityFilter(r)
+	if err != nil {
+		BadRequestError(w, err, "activity")
+		return
+	}
+
+	activities, err := h.ActivityService.GetAllActivitiesFromEvent(slug, filter)
 	if err != nil {
 		HandleErrMsg("error getting activities", err, w).Stack("activity").BadRequest()
 		return
@@ -91,9 +110,71 @@ func (h *ActivityHandler) GetAllActivitiesFromEvent(w http.ResponseWriter, r *ht
 	handleSuccess(w, activities, "", http.StatusOK)
 }
 
+func parseActivityFilter(r *http.Request) (models.ActivityFilter, error) {
+	query := r.URL.Query()
+	filter := models.ActivityFilter{
+		Type:    models.ActivityType(strings.TrimSpace(query.Get("type"))),
+		Speaker: strings.TrimSpace(query.Get("speaker")),
+	}
+
+	switch filter.Type {
+	case "", models.ActivityPalestra, models.ActivityMiniCurso, models.ActivityVisitaTecnica, models.ActivityCoffeeBreak:
+	default:
+		return filter, errors.New("invalid activity type " + string(filter.Type))
+	}
+
+	if raw := query.Get("from"); raw != "" {
+		from, err := time.Parse(time.RFC3339, raw)
+		if err != nil {
+			return filter, errors.New("from must be an RFC3339 date")
+		}
+		filter.From = &from
+	}
+	if raw := query.Get("to"); raw != "" {
+		to, err := time.Parse(time.RFC3339, raw)
+		if err != nil {
+			return filter, errors.New("to must be an RFC3339 date")
+		}
+		filter.To = &to
+	}
+
+	if filter.From != nil && filter.To != nil && filter.To.Before(*filter.From) {
+		return filter, errors.New("to must not be before from")
+	}
+
+	return filter, nil
+}
+
+// GetActivityTypeCounts godoc
+// @Summary      Get activity types of an event
+// @Description  Returns each activity type present in the event with how many visible activities have it
+// @Tags         activities
+// @Produce      json
+// @Param        slug path string true "Event slug"
+// @Success      200  {object}  NoMessageSuccessResponse{data=[]models.ActivityTypeCount}
+// @Failure      400  {object}  ActivityStandardErrorResponse
+// @Router       /events/{slug}/activity-types [get]
+func (h *ActivityHandler) GetActivityTypeCounts(w http.ResponseWriter, r *http.Request) {
+	slug, err := extractSlugAndValidate(r)
+	if err != nil {
+		BadRequestError(w, err, "activity")
+		return
+	}
+
+	counts, err := h.ActivityService.GetActivityTypeCounts(slug)
+	if err != nil {
+		HandleErrMsg("error getting activity types", err, w).Stack("activity").BadRequest()
+		return
+	}
+
+	handleSuccess(w, counts, "", http.StatusOK)
+}
+
 // UpdateEventActivity godoc
 // @Summary      Update an activity
-// @Description  Updates an existing activity for the specified event
+// @Description  Updates an existing activity for the specified event. A speaker double-booking is reported in the message,
+// @Description  or rejected with 409 when reject_speaker_conflicts is set. Capacity changes are recorded in the capacity history and,
+// @Description  when capacity grows, the new seats are offered to waitlisted users right away. The message tells how many were promoted
 // @Tags         activities
 // @Accept       json
 // @Produce      json
@@ -106,6 +187,7 @@ func (h *ActivityHandler) GetAllActivitiesFromEvent(w http.ResponseWriter, r *ht
 // @Failure      400  {object}  ActivityStandardErrorResponse
 // @Failure      401  {object}  ActivityStandardErrorResponse
 // @Failure      403  {object}  ActivityStandardErrorResponse
+// @Failure      409  {object}  ActivityStandardErrorResponse
 // @Router       /events/{slug}/activity [patch]
 func (h *ActivityHandler) UpdateEventActivity(w http.ResponseWriter, r *http.Request) {
 	slug, err := extractSlugAndValidate(r)
@@ -135,144 +217,131 @@ func (h *ActivityHandler) UpdateEventActivity(w http.ResponseWriter, r *http.Req
 		return
 	}
 
-	activity, err := h.ActivityService.UpdateEventActivity(user, slug, reqBody.ActivityID, reqBody)
+	activity, conflicts, promoted, err := h.ActivityService.UpdateEventActivity(user, slug, reqBody.ActivityID, reqBody)
 	if err != nil {
 		if strings.Contains(err.Error(), "not found") {
 			NotFoundError(w, err, "Activity", "activity")
 		} else if strings.Contains(err.Error(), "permission") {
 			ForbiddenError(w, err, "activity")
+		} else if strings.Contains(err.Error(), "speaker conflict") {
+			ConflictError(w, err, "Speaker", "activity")
 		} else {
 			HandleErrMsg("Error updating activity", err, w).Stack("activity").BadRequest()
 		}
 		return
 	}
 
-	handleSuccess(w, activity, "", http.StatusOK)
+	message := speakerConflictWarning(conflicts)
+	if promoted > 0 {
+		if message != "" {
+			message += "; "
+		}
+		message += fmt.Sprintf("promoted %d users from the waitlist", promoted)
+	}
+
+	handleSuccess(w, activity, message, http.StatusOK)
 }
 
-// DeleteEventActivity godoc
-// @Summary      Delete an activity
-// @Description  Deletes an existing activity from the specified event
+// speakerConflictWarning tells the admin which activities the speaker is double-booked with, empty when there are none
+func speakerConflictWarning(conflicts []models.SpeakerConflict) string {
+	if len(conflicts) == 0 {
+		return ""
+	}
+
+	names := make([]string, len(conflicts))
+	for i, conflict := range conflicts {
+		names[i] = conflict.ConflictingActivityName
+	}
+	return "warning: " + conflicts[0].Speaker + " is also speaking at the same time in " + strings.Join(names, ", ")
+}
+
+// GetSpeakerConflicts godoc
+// @Summary      Get speaker loads and conflicts
+// @Description  Groups the event activities by speaker, matched ignoring case, with their total hours and the pairs of
+// @Description  activities whose time windows overlap (admins only). Speakers with conflicts come first
 // @Tags         activities
-// @Accept       json
 // @Produce      json
 // @Security     Bearer
 // @Param        Authorization header string true "Bearer {access_token}"
 // @Param        Refresh header string true "Bearer {refresh_token}"
 // @Param        slug path string true "Event slug"
-// @Param        request body models.ActivityDeleteRequest true "Activity deletion info"
-// @Success      200  {object}  NoDataSuccessResponse
+// @Success      200  {object}  NoMessageSuccessResponse{data=[]models.SpeakerLoad}
 // @Failure      400  {object}  ActivityStandardErrorResponse
 // @Failure      401  {object}  ActivityStandardErrorResponse
 // @Failure      403  {object}  ActivityStandardErrorResponse
-// @Router       /events/{slug}/activity [delete]
-func (h *ActivityHandler) DeleteEventActivity(w http.ResponseWriter, r *http.Request) {
+// @Router       /events/{slug}/speaker-conflicts [get]
+func (h *ActivityHandler) GetSpeakerConflicts(w http.ResponseWriter, r *http.Request) {
 	slug, err := extractSlugAndValidate(r)
 	if err != nil {
 		BadRequestError(w, err, "activity")
 		return
 	}
 
-	var reqBody models.ActivityDeleteRequest
-	if err := decodeRequestBody(r, &reqBody); err != nil {
+	admin, err := getUserFromContext(h.ActivityService.ActivityRepo.GetUserByID, r)
+	if err != nil {
 		BadRequestError(w, err, "activity")
 		return
 	}
 
-	if reqBody.ActivityID == "" {
-		HandleErrMsg("activity ID is required", nil, w).Stack("activity").BadRequest()
-		return
-	}
-
-	user, err := getUserFromContext(h.ActivityService.ActivityRepo.GetUserByID, r)
+	loads, err := h.ActivityService.GetSpeakerLoads(admin, slug)
 	if err != nil {
-		if strings.Contains(err.Error(), "claims") {
-			UnauthorizedError(w, err, "activity")
-		} else {
-			BadRequestError(w, err, "activity")
-		}
-		return
-	}
-
-	if err := h.ActivityService.DeleteEventActivity(user, slug, reqBody.ActivityID); err != nil {
-		if strings.Contains(err.Error(), "not found") {
-			NotFoundError(w, err, "Activity", "activity")
-		} else if strings.Contains(err.Error(), "permission") {
+		if strings.Contains(err.Error(), "unauthorized") {
 			ForbiddenError(w, err, "activity")
-		} else if strings.Contains(err.Error(), "attendees") {
-			ConflictError(w, err, "Activity with existing attendees", "activity")
 		} else {
-			HandleErr(err, w).Msg("Error deleting activity").Stack("activity").BadRequest()
+			HandleErrMsg("error getting speaker conflicts", err, w).Stack("activity").BadRequest()
 		}
 		return
 	}
 
-	handleSuccess(w, nil, "deleted activity", http.StatusOK)
+	handleSuccess(w, loads, "", http.StatusOK)
 }
 
-// RegisterUserToActivity godoc
-// @Summary      Register to an activity
-// @Description  Registers the authenticated user to an activity within an event they are already registered for
+// GetRoomConflicts godoc
+// @Summary      Get double-booked rooms
+// @Description  Lists every pair of event activities, hidden ones included, that share a location, matched ignoring case,
+// @Description  and whose time windows overlap (admins only). Back to back activities don't overlap
 // @Tags         activities
-// @Accept       json
 // @Produce      json
 // @Security     Bearer
 // @Param        Authorization header string true "Bearer {access_token}"
 // @Param        Refresh header string true "Bearer {refresh_token}"
 // @Param        slug path string true "Event slug"
-// @Param        request body models.ActivityRegistrationRequest true "Activity registration info"
-// @Success      200  {object}  NoDataSuccessResponse
+// @Success      200  {object}  NoMessageSuccessResponse{data=[]models.RoomConflict}
 // @Failure      400  {object}  ActivityStandardErrorResponse
 // @Failure      401  {object}  ActivityStandardErrorResponse
-// @Router       /events/{slug}/activity/register [post]
-func (h *ActivityHandler) RegisterUserToActivity(w http.ResponseWriter, r *http.Request) {
+// @Failure      403  {object}  ActivityStandardErrorResponse
+// @Router       /events/{slug}/room-conflicts [get]
+func (h *ActivityHandler) GetRoomConflicts(w http.ResponseWriter, r *http.Request) {
 	slug, err := extractSlugAndValidate(r)
 	if err != nil {
 		BadRequestError(w, err, "activity")
 		return
 	}
 
-	var reqBody models.ActivityRegistrationRequest
-	if err := decodeRequestBody(r, &reqBody); err != nil {
+	admin, err := getUserFromContext(h.ActivityService.ActivityRepo.GetUserByID, r)
+	if err != nil {
 		BadRequestError(w, err, "activity")
 		return
 	}
 
-	if reqBody.ActivityID == "" {
-		HandleErrMsg("activity ID is required", nil, w).Stack("activity").BadRequest()
-		return
-	}
-
-	user, err := getUserFromContext(h.ActivityService.ActivityRepo.GetUserByID, r)
+	conflicts, err := h.ActivityService.GetRoomConflicts(admin, slug)
 	if err != nil {
-		if strings.Contains(err.Error(), "claims") {
-			UnauthorizedError(w, err, "activity")
-		} else {
-			BadRequestError(w, err, "activity")
-		}
-		return
-	}
-
-	if err := h.ActivityService.RegisterUserToActivity(user, slug, reqBody.ActivityID); err != nil {
-		if strings.Contains(err.Error(), "capacity") {
-			capacityErr := errors.New("maximum capacity reached")
-			HandleErrMsg("activity is at full capacity", capacityErr, w).Stack("activity").Conflict()
-		} else if strings.Contains(err.Error(), "already registered") {
-			ConflictError(w, err, "Registration", "activity")
-		} else if strings.Contains(err.Error(), "event not registered") {
-			ForbiddenError(w, errors.New("must register for event first"), "activity")
+		if strings.Contains(err.Error(), "unauthorized") {
+			ForbiddenError(w, err, "activity")
 		} else {
-			HandleErr(err, w).Msg("Error registering to activity").Stack("activity").BadRequest()
+			HandleErrMsg("error getting room conflicts", err, w).Stack("activity").BadRequest()
 		}
 		return
 	}
 
-	handleSuccess(w, nil, "registered to activity successfully", http.StatusOK)
+	handleSuccess(w, conflicts, "", http.StatusOK)
 }
 
-// UnregisterUserFromActivity godoc
-// @Summary      Unregister from an activity
-// @Description  Unregisters the authenticated user from an activity within an event
+// SuggestRooms godoc
+// @Summary      Suggest a room for each activity
+// @Description  Takes the available rooms with their capacities and suggests a room for every event activity, hidden ones included (admins only).
+// @Description  Activities with the highest demand, registered plus waitlisted users, are placed first in the smallest room that fits them
+// @Description  and has no overlapping activity. Activities that couldn't be placed are returned with the reason
 // @Tags         activities
 // @Accept       json
 // @Produce      json
@@ -280,46 +349,51 @@ func (h *ActivityHandler) RegisterUserToActivity(w http.ResponseWriter, r *http.
 // @Param        Authorization header string true "Bearer {access_token}"
 // @Param        Refresh header string true "Bearer {refresh_token}"
 // @Param        slug path string true "Event slug"
-// @Param        request body models.ActivityRegistrationRequest true "Activity registration info"
-// @Success      200  {object}  NoDataSuccessResponse
+// @Param        request body models.SuggestRoomsRequest true "Available rooms"
+// @Success      200  {object}  NoMessageSuccessResponse{data=models.RoomSuggestion}
 // @Failure      400  {object}  ActivityStandardErrorResponse
 // @Failure      401  {object}  ActivityStandardErrorResponse
-// @Router       /events/{slug}/activity/unregister [post]
-func (h *ActivityHandler) UnregisterUserFromActivity(w http.ResponseWriter, r *http.Request) {
+// @Failure      403  {object}  ActivityStandardErrorResponse
+// @Failure      404  {object}  ActivityStandardErrorResponse
+// @Router       /events/{slug}/suggest-rooms [post]
+func (h *ActivityHandler) SuggestRooms(w http.ResponseWriter, r *http.Request) {
 	slug, err := extractSlugAndValidate(r)
 	if err != nil {
 		BadRequestError(w, err, "activity")
 		return
 	}
 
-	var reqBody models.ActivityRegistrationRequest
-	if err := decodeRequestBody(r, &reqBody); err != nil {
+	admin, err := getUserFromContext(h.ActivityService.ActivityRepo.GetUserByID, r)
+	if err != nil {
 		BadRequestError(w, err, "activity")
 		return
 	}
 
-	if reqBody.ActivityID == "" {
-		BadRequestError(w, NewErr("activity ID is required"), "activity")
-		return
-	}
-
-	user, err := getUserFromContext(h.ActivityService.ActivityRepo.GetUserByID, r)
-	if err != nil {
+	var req models.SuggestRoomsRequest
+	if err := decodeRequestBody(r, &req); err != nil {
 		BadRequestError(w, err, "activity")
 		return
 	}
 
-	if err := h.ActivityService.UnregisterUserFromActivity(user, slug, reqBody.ActivityID); err != nil {
-		HandleErrMsg("error unregistering from activity", err, w).Stack("activity").BadRequest()
+	suggestion, err := h.ActivityService.SuggestRooms(admin, slug, req)
+	if err != nil {
+		if strings.Contains(err.Error(), "unauthorized") {
+			ForbiddenError(w, err, "activity")
+		} else if strings.Contains(err.Error(), "event not found") {
+			NotFoundError(w, err, "Event", "activity")
+		} else {
+			HandleErrMsg("error suggesting rooms", err, w).Stack("activity").BadRequest()
+		}
 		return
 	}
 
-	handleSuccess(w, nil, "unregistered from activity successfully", http.StatusOK)
+	handleSuccess(w, suggestion, "", http.StatusOK)
 }
 
-// AttendActivity godoc
-// @Summary      Mark attendance for an activity
-// @Description  Marks a user as having attended an activity (admin only)
+// CheckActivitySlot godoc
+// @Summary      Check a proposed activity slot
+// @Description  Lists the event activities, hidden ones included, that overlap a proposed time window and flags the ones in the same
+// @Description  location, so organizers can spot clashes before creating or moving an activity (admins only). Back to back activities don't overlap
 // @Tags         activities
 // @Accept       json
 // @Produce      json
@@ -327,47 +401,50 @@ func (h *ActivityHandler) UnregisterUserFromActivity(w http.ResponseWriter, r *h
 // @Param        Authorization header string true "Bearer {access_token}"
 // @Param        Refresh header string true "Bearer {refresh_token}"
 // @Param        slug path string true "Event slug"
-// @Param        request body models.ActivityRegistrationRequest true "Attendance info"
-// @Success      200  {object}  NoDataSuccessResponse
+// @Param        request body models.CheckSlotRequest true "Proposed time window and location"
+// @Success      200  {object}  NoMessageSuccessResponse{data=models.SlotCheckResult}
 // @Failure      400  {object}  ActivityStandardErrorResponse
 // @Failure      401  {object}  ActivityStandardErrorResponse
 // @Failure      403  {object}  ActivityStandardErrorResponse
-// @Router       /events/{slug}/activity/attend [post]
-func (h *ActivityHandler) AttendActivity(w http.ResponseWriter, r *http.Request) {
+// @Failure      404  {object}  ActivityStandardErrorResponse
+// @Router       /events/{slug}/activities/check-slot [post]
+func (h *ActivityHandler) CheckActivitySlot(w http.ResponseWriter, r *http.Request) {
 	slug, err := extractSlugAndValidate(r)
 	if err != nil {
 		BadRequestError(w, err, "activity")
 		return
 	}
 
-	var reqBody models.ActivityRegistrationRequest
-	if err := decodeRequestBody(r, &reqBody); err != nil {
+	admin, err := getUserFromContext(h.ActivityService.ActivityRepo.GetUserByID, r)
+	if err != nil {
 		BadRequestError(w, err, "activity")
 		return
 	}
 
-	if reqBody.ActivityID == "" || reqBody.UserID == "" {
-		BadRequestError(w, NewErr("activity ID and user ID are required"), "activity")
-		return
-	}
-
-	admin, err := getUserFromContext(h.ActivityService.ActivityRepo.GetUserByID, r)
-	if err != nil {
+	var req models.CheckSlotRequest
+	if err := decodeRequestBody(r, &req); err != nil {
 		BadRequestError(w, err, "activity")
 		return
 	}
 
-	if err := h.ActivityService.AttendActivity(admin, slug, reqBody.ActivityID, reqBody.UserID); err != nil {
-		HandleErrMsg("error marking attendance", err, w).Stack("activity").BadRequest()
+	result, err := h.ActivityService.CheckActivitySlot(admin, slug, req)
+	if err != nil {
+		if strings.Contains(err.Error(), "unauthorized") {
+			ForbiddenError(w, err, "activity")
+		} else if strings.Contains(err.Error(), "event not found") {
+			NotFoundError(w, err, "Event", "activity")
+		} else {
+			HandleErrMsg("error checking activity slot", err, w).Stack("activity").BadRequest()
+		}
 		return
 	}
 
-	handleSuccess(w, nil, "attendance marked successfully", http.StatusOK)
+	handleSuccess(w, result, "", http.StatusOK)
 }
 
-// UnattendActivity godoc
-// @Summary      Remove attendance for an activity
-// @Description  Removes a user's attendance record for an activity (master admin only)
+// DeleteEventActivity godoc
+// @Summary      Delete an activity
+// @Description  Deletes an existing activity from the specified event
 // @Tags         activities
 // @Accept       json
 // @Produce      json
@@ -375,124 +452,1088 @@ func (h *ActivityHandler) AttendActivity(w http.ResponseWriter, r *http.Request)
 // @Param        Authorization header string true "Bearer {access_token}"
 // @Param        Refresh header string true "Bearer {refresh_token}"
 // @Param        slug path string true "Event slug"
-// @Param        request body models.ActivityRegistrationRequest true "Attendance info"
+// @Param        request body models.ActivityDeleteRequest true "Activity deletion info"
 // @Success      200  {object}  NoDataSuccessResponse
 // @Failure      400  {object}  ActivityStandardErrorResponse
 // @Failure      401  {object}  ActivityStandardErrorResponse
 // @Failure      403  {object}  ActivityStandardErrorResponse
-// @Router       /events/{slug}/activity/unattend [post]
-func (h *ActivityHandler) UnattendActivity(w http.ResponseWriter, r *http.Request) {
+// @Router       /events/{slug}/activity [delete]
+func (h *ActivityHandler) DeleteEventActivity(w http.ResponseWriter, r *http.Request) {
 	slug, err := extractSlugAndValidate(r)
 	if err != nil {
 		BadRequestError(w, err, "activity")
 		return
 	}
 
-	var reqBody models.ActivityRegistrationRequest
+	var reqBody models.ActivityDeleteRequest
 	if err := decodeRequestBody(r, &reqBody); err != nil {
 		BadRequestError(w, err, "activity")
 		return
 	}
 
-	if reqBody.ActivityID == "" || reqBody.UserID == "" {
-		BadRequestError(w, NewErr("activity ID and user ID are required"), "activity")
+	if reqBody.ActivityID == "" {
+		HandleErrMsg("activity ID is required", nil, w).Stack("activity").BadRequest()
 		return
 	}
 
-	admin, err := getUserFromContext(h.ActivityService.ActivityRepo.GetUserByID, r)
+	user, err := getUserFromContext(h.ActivityService.ActivityRepo.GetUserByID, r)
 	if err != nil {
-		BadRequestError(w, err, "activity")
+		if strings.Contains(err.Error(), "claims") {
+			UnauthorizedError(w, err, "activity")
+		} else {
+			BadRequestError(w, err, "activity")
+		}
 		return
 	}
 
-	if err := h.ActivityService.UnattendActivity(admin, slug, reqBody.ActivityID, reqBody.UserID); err != nil {
-		HandleErrMsg("error removing attendance", err, w).Stack("activity").BadRequest()
+	if err := h.ActivityService.DeleteEventActivity(user, slug, reqBody.ActivityID); err != nil {
+		if strings.Contains(err.Error(), "not found") {
+			NotFoundError(w, err, "Activity", "activity")
+		} else if strings.Contains(err.Error(), "permission") {
+			ForbiddenError(w, err, "activity")
+		} else if strings.Contains(err.Error(), "attendees") {
+			ConflictError(w, err, "Activity with existing attendees", "activity")
+		} else {
+			HandleErr(err, w).Msg("Error deleting activity").Stack("activity").BadRequest()
+		}
 		return
 	}
 
-	handleSuccess(w, nil, "attendance removed successfully", http.StatusOK)
+	handleSuccess(w, nil, "deleted activity", http.StatusOK)
 }
 
-// GetActivityRegistrations godoc
-// @Summary      Retrieves a list of registrations of an activity
-// @Description  The end point returns a list of all registrations of a specified activity (all admins)
+// DeleteHiddenActivities godoc
+// @Summary      Delete hidden activities
+// @Description  Deletes, in a single transaction, every hidden activity of the event that has no registrations (master admins only).
+// @Description  Hidden activities with registrations are kept and listed as skipped with the reason
 // @Tags         activities
-// @Accept       json
 // @Produce      json
 // @Security     Bearer
 // @Param        Authorization header string true "Bearer {access_token}"
 // @Param        Refresh header string true "Bearer {refresh_token}"
 // @Param        slug path string true "Event slug"
-// @Param        id path string true "Activity ID"
-// @Success      200  {object}  NoMessageSuccessResponse{data=[]models.ActivityRegistration}
+// @Success      200  {object}  NoMessageSuccessResponse{data=models.HiddenActivitiesPurgeResult}
 // @Failure      400  {object}  ActivityStandardErrorResponse
 // @Failure      401  {object}  ActivityStandardErrorResponse
 // @Failure      403  {object}  ActivityStandardErrorResponse
-// @Router       /events/{slug}/activity/registrations/{id} [get]
-func (h *ActivityHandler) GetActivityRegistrations(w http.ResponseWriter, r *http.Request) {
+// @Failure      404  {object}  ActivityStandardErrorResponse
+// @Router       /events/{slug}/activities/hidden [delete]
+func (h *ActivityHandler) DeleteHiddenActivities(w http.ResponseWriter, r *http.Request) {
 	slug, err := extractSlugAndValidate(r)
 	if err != nil {
 		BadRequestError(w, err, "activity")
 		return
 	}
 
-	activityID := r.PathValue("id")
-
-	if activityID == "" {
-		BadRequestError(w, NewErr("activity ID is required"), "activity")
-		return
-	}
-
-	admin, err := getUserFromContext(h.ActivityService.ActivityRepo.GetUserByID, r)
+	user, err := getUserFromContext(h.ActivityService.ActivityRepo.GetUserByID, r)
 	if err != nil {
 		BadRequestError(w, err, "activity")
 		return
 	}
 
-	var registrations []models.ActivityRegistration
-	if registrations, err = h.ActivityService.GetActivityRegistrations(admin, slug, activityID); err != nil {
-		HandleErrMsg("error getting registrations", err, w).Stack("activity").BadRequest()
+	result, err := h.ActivityService.DeleteHiddenActivities(user, slug)
+	if err != nil {
+		if strings.Contains(err.Error(), "unauthorized") {
+			ForbiddenError(w, err, "activity")
+		} else if strings.Contains(err.Error(), "event not found") {
+			NotFoundError(w, err, "Event", "activity")
+		} else {
+			HandleErrMsg("error deleting hidden activities", err, w).Stack("activity").BadRequest()
+		}
 		return
 	}
 
-	handleSuccess(w, registrations, "", http.StatusOK)
+	handleSuccess(w, result, "", http.StatusOK)
 }
 
-// GetUserAccesses godoc
-// @Summary      Retrieves a list of accesses for a user
-// @Description  The end point returns a list of all accesses for a specified user
+// GetActivitiesCapacity godoc
+// @Summary      Get activities capacity snapshot
+// @Description  Returns registered, max, waitlisted and available seats for every activity of the event (admins only)
 // @Tags         activities
-// @Accept       json
 // @Produce      json
 // @Security     Bearer
 // @Param        Authorization header string true "Bearer {access_token}"
 // @Param        Refresh header string true "Bearer {refresh_token}"
-// @Success      200  {object}  NoMessageSuccessResponse{data=[]models.AccessTarget}
+// @Param        slug path string true "Event slug"
+// @Success      200  {object}  NoMessageSuccessResponse{data=[]models.ActivityCapacitySnapshot}
 // @Failure      400  {object}  ActivityStandardErrorResponse
 // @Failure      401  {object}  ActivityStandardErrorResponse
 // @Failure      403  {object}  ActivityStandardErrorResponse
-// @Router       /user-accesses [get]
-func (h *ActivityHandler) GetUserAccesses(w http.ResponseWriter, r *http.Request) {
+// @Router       /events/{slug}/activities/capacity [get]
+func (h *ActivityHandler) GetActivitiesCapacity(w http.ResponseWriter, r *http.Request) {
+	slug, err := extractSlugAndValidate(r)
+	if err != nil {
+		BadRequestError(w, err, "activity")
+		return
+	}
+
 	user, err := getUserFromContext(h.ActivityService.ActivityRepo.GetUserByID, r)
 	if err != nil {
 		BadRequestError(w, err, "activity")
 		return
 	}
 
-	var accesses []models.AccessTarget
-	if accesses, err = h.ActivityService.GetUserAccesses(user.ID); err != nil {
-		HandleErrMsg("error getting accesses", err, w).Stack("activity").BadRequest()
+	snapshots, err := h.ActivityService.GetActivitiesCapacity(user, slug)
+	if err != nil {
+		if strings.Contains(err.Error(), "unauthorized") {
+			ForbiddenError(w, err, "activity")
+		} else {
+			HandleErrMsg("error getting activities capacity", err, w).Stack("activity").BadRequest()
+		}
 		return
 	}
 
-	handleSuccess(w, accesses, "", http.StatusOK)
+	handleSuccess(w, snapshots, "", http.StatusOK)
 }
 
-// GetUserAccessesFromEvent godoc
-// @Summary      Retrieves a list of accesses for a user from an event
-// @Description  The end point returns a list of all accesses for a specified user from a specified event
+// GetCoffeeBreaksLive godoc
+// @Summary      Get the coffee breaks live board
+// @Description  Returns every coffee break of the event with its registered and attended counts and whether it's happening right now (admins only)
 // @Tags         activities
-// @Accept       json
+// @Produce      json
+// @Security     Bearer
+// @Param        Authorization header string true "Bearer {access_token}"
+// @Param        Refresh header string true "Bearer {refresh_token}"
+// @Param        slug path string true "Event slug"
+// @Success      200  {object}  NoMessageSuccessResponse{data=[]models.CoffeeBreakLive}
+// @Failure      400  {object}  ActivityStandardErrorResponse
+// @Failure      401  {object}  ActivityStandardErrorResponse
+// @Failure      403  {object}  ActivityStandardErrorResponse
+// @Router       /events/{slug}/coffee/live [get]
+func (h *ActivityHandler) GetCoffeeBreaksLive(w http.ResponseWriter, r *http.Request) {
+	slug, err := extractSlugAndValidate(r)
+	if err != nil {
+		BadRequestError(w, err, "activity")
+		return
+	}
+
+	user, err := getUserFromContext(h.ActivityService.ActivityRepo.GetUserByID, r)
+	if err != nil {
+		BadRequestError(w, err, "activity")
+		return
+	}
+
+	coffeeBreaks, err := h.ActivityService.GetCoffeeBreaksLive(user, slug)
+	if err != nil {
+		if strings.Contains(err.Error(), "unauthorized") {
+			ForbiddenError(w, err, "activity")
+		} else {
+			HandleErrMsg("error getting coffee breaks", err, w).Stack("activity").BadRequest()
+		}
+		return
+	}
+
+	handleSuccess(w, coffeeBreaks, "", http.StatusOK)
+}
+
+// GetFeeActivities godoc
+// @Summary      List fee activities
+// @Description  Lists the activities that require a fee and which products or tokens unlock them, flagging orphaned paywalls (admins only)
+// @Tags         activities
+// @Produce      json
+// @Security     Bearer
+// @Param        Authorization header string true "Bearer {access_token}"
+// @Param        Refresh header string true "Bearer {refresh_token}"
+// @Param        slug path string true "Event slug"
+// @Success      200  {object}  NoMessageSuccessResponse{data=[]models.FeeActivityAccess}
+// @Failure      400  {object}  ActivityStandardErrorResponse
+// @Failure      401  {object}  ActivityStandardErrorResponse
+// @Failure      403  {object}  ActivityStandardErrorResponse
+// @Router       /events/{slug}/activities/fee-required [get]
+func (h *ActivityHandler) GetFeeActivities(w http.ResponseWriter, r *http.Request) {
+	slug, err := extractSlugAndValidate(r)
+	if err != nil {
+		BadRequestError(w, err, "activity")
+		return
+	}
+
+	user, err := getUserFromContext(h.ActivityService.ActivityRepo.GetUserByID, r)
+	if err != nil {
+		BadRequestError(w, err, "activity")
+		return
+	}
+
+	activities, err := h.ActivityService.GetFeeActivities(user, slug)
+	if err != nil {
+		if strings.Contains(err.Error(), "unauthorized") {
+			ForbiddenError(w, err, "activity")
+		} else {
+			HandleErrMsg("error getting fee activities", err, w).Stack("activity").BadRequest()
+		}
+		return
+	}
+
+	handleSuccess(w, activities, "", http.StatusOK)
+}
+
+// GetEligibleActivities godoc
+// @Summary      List activities the user can join without paying
+// @Description  Lists the activities the authenticated user can register to right now because they are free, a bought product gives access
+// @Description  or an unused event token covers the fee, annotated with that access method. Ended, blocked, full and already registered activities are left out
+// @Tags         activities
+// @Produce      json
+// @Security     Bearer
+// @Param        Authorization header string true "Bearer {access_token}"
+// @Param        Refresh header string true "Bearer {refresh_token}"
+// @Param        slug path string true "Event slug"
+// @Success      200  {object}  NoMessageSuccessResponse{data=[]models.EligibleActivity}
+// @Failure      400  {object}  ActivityStandardErrorResponse
+// @Failure      401  {object}  ActivityStandardErrorResponse
+// @Failure      403  {object}  ActivityStandardErrorResponse
+// @Failure      404  {object}  ActivityStandardErrorResponse
+// @Router       /events/{slug}/activities/eligible [get]
+func (h *ActivityHandler) GetEligibleActivities(w http.ResponseWriter, r *http.Request) {
+	slug, err := extractSlugAndValidate(r)
+	if err != nil {
+		BadRequestError(w, err, "activity")
+		return
+	}
+
+	user, err := getUserFromContext(h.ActivityService.ActivityRepo.GetUserByID, r)
+	if err != nil {
+		BadRequestError(w, err, "activity")
+		return
+	}
+
+	activities, err := h.ActivityService.GetEligibleActivities(user, slug)
+	if err != nil {
+		if strings.Contains(err.Error(), "must be registered") {
+			ForbiddenError(w, err, "activity")
+		} else if strings.Contains(err.Error(), "event not found") {
+			NotFoundError(w, err, "Event", "activity")
+		} else {
+			HandleErrMsg("error getting eligible activities", err, w).Stack("activity").BadRequest()
+		}
+		return
+	}
+
+	handleSuccess(w, activities, "", http.StatusOK)
+}
+
+// GetActivityRevenue godoc
+// @Summary      Get the revenue of fee activities
+// @Description  Estimates what each fee activity brought in from the tokens redeemed on it, a token being worth its product price
+// @Description  divided by the tokens the product grants. Highest revenue first (admins only)
+// @Tags         activities
+// @Produce      json
+// @Security     Bearer
+// @Param        Authorization header string true "Bearer {access_token}"
+// @Param        Refresh header string true "Bearer {refresh_token}"
+// @Param        slug path string true "Event slug"
+// @Success      200  {object}  NoMessageSuccessResponse{data=[]models.ActivityRevenue}
+// @Failure      400  {object}  ActivityStandardErrorResponse
+// @Failure      401  {object}  ActivityStandardErrorResponse
+// @Failure      403  {object}  ActivityStandardErrorResponse
+// @Failure      404  {object}  ActivityStandardErrorResponse
+// @Router       /events/{slug}/activity-revenue [get]
+func (h *ActivityHandler) GetActivityRevenue(w http.ResponseWriter, r *http.Request) {
+	slug, err := extractSlugAndValidate(r)
+	if err != nil {
+		BadRequestError(w, err, "activity")
+		return
+	}
+
+	admin, err := getUserFromContext(h.ActivityService.ActivityRepo.GetUserByID, r)
+	if err != nil {
+		BadRequestError(w, err, "activity")
+		return
+	}
+
+	revenues, err := h.ActivityService.GetActivityRevenue(admin, slug)
+	if err != nil {
+		switch {
+		case strings.Contains(err.Error(), "unauthorized"):
+			ForbiddenError(w, err, "activity")
+		case strings.Contains(err.Error(), "not found"):
+			NotFoundError(w, err, "Event", "activity")
+		default:
+			HandleErrMsg("error getting activity revenue", err, w).Stack("activity").BadRequest()
+		}
+		return
+	}
+
+	handleSuccess(w, revenues, "", http.StatusOK)
+}
+
+// GetTokenRedeemableActivities godoc
+// @Summary      List activities a token can be redeemed on
+// @Description  Lists the fee activities of the event the authenticated user would register to by spending one of their unused event tokens,
+// @Description  with how many unused tokens they have. Activities covered by a bought product, ended, blocked, full or already registered ones,
+// @Description  including the ones a token was spent on, are left out. The list is empty when no token is left
+// @Tags         activities
+// @Produce      json
+// @Security     Bearer
+// @Param        Authorization header string true "Bearer {access_token}"
+// @Param        Refresh header string true "Bearer {refresh_token}"
+// @Param        slug path string true "Event slug"
+// @Success      200  {object}  NoMessageSuccessResponse{data=models.TokenRedeemableActivities}
+// @Failure      400  {object}  ActivityStandardErrorResponse
+// @Failure      401  {object}  ActivityStandardErrorResponse
+// @Failure      403  {object}  ActivityStandardErrorResponse
+// @Failure      404  {object}  ActivityStandardErrorResponse
+// @Router       /events/{slug}/token-redeemable-activities [get]
+func (h *ActivityHandler) GetTokenRedeemableActivities(w http.ResponseWriter, r *http.Request) {
+	slug, err := extractSlugAndValidate(r)
+	if err != nil {
+		BadRequestError(w, err, "activity")
+		return
+	}
+
+	user, err := getUserFromContext(h.ActivityService.ActivityRepo.GetUserByID, r)
+	if err != nil {
+		BadRequestError(w, err, "activity")
+		return
+	}
+
+	redeemable, err := h.ActivityService.GetTokenRedeemableActivities(user, slug)
+	if err != nil {
+		if strings.Contains(err.Error(), "must be registered") {
+			ForbiddenError(w, err, "activity")
+		} else if strings.Contains(err.Error(), "event not found") {
+			NotFoundError(w, err, "Event", "activity")
+		} else {
+			HandleErrMsg("error getting token redeemable activities", err, w).Stack("activity").BadRequest()
+		}
+		return
+	}
+
+	handleSuccess(w, redeemable, "", http.StatusOK)
+}
+
+// ReorderEventActivities godoc
+// @Summary      Reorder event activities
+// @Description  Sets the display order of the event activities to the order of the given IDs, in a single transaction.
+// @Description  Activity lists are sorted by start time and then by this order
+// @Tags         activities
+// @Accept       json
+// @Produce      json
+// @Security     Bearer
+// @Param        Authorization header string true "Bearer {access_token}"
+// @Param        Refresh header string true "Bearer {refresh_token}"
+// @Param        slug path string true "Event slug"
+// @Param        request body models.ActivityReorderRequest true "Activity IDs in their new order"
+// @Success      200  {object}  NoDataSuccessResponse
+// @Failure      400  {object}  ActivityStandardErrorResponse
+// @Failure      401  {object}  ActivityStandardErrorResponse
+// @Failure      403  {object}  ActivityStandardErrorResponse
+// @Router       /events/{slug}/activities/reorder [post]
+func (h *ActivityHandler) ReorderEventActivities(w http.ResponseWriter, r *http.Request) {
+	slug, err := extractSlugAndValidate(r)
+	if err != nil {
+		BadRequestError(w, err, "activity")
+		return
+	}
+
+	var reqBody models.ActivityReorderRequest
+	if err := decodeRequestBody(r, &reqBody); err != nil {
+		BadRequestError(w, err, "activity")
+		return
+	}
+
+	user, err := getUserFromContext(h.ActivityService.ActivityRepo.GetUserByID, r)
+	if err != nil {
+		BadRequestError(w, err, "activity")
+		return
+	}
+
+	if err := h.ActivityService.ReorderEventActivities(user, slug, reqBody); err != nil {
+		if strings.Contains(err.Error(), "unauthorized") {
+			ForbiddenError(w, err, "activity")
+		} else {
+			HandleErrMsg("error reordering activities", err, w).Stack("activity").BadRequest()
+		}
+		return
+	}
+
+	handleSuccess(w, nil, "activities reordered successfully", http.StatusOK)
+}
+
+// GetActivityConflicts godoc
+// @Summary      Get activity conflicts
+// @Description  Returns the authenticated user's registered activities that overlap the given activity,
+// @Description  following the same rule as registration: palestras never conflict. Lets the frontend warn before registering,
+// @Description  the list is empty when there is no conflict
+// @Tags         activities
+// @Produce      json
+// @Security     Bearer
+// @Param        Authorization header string true "Bearer {access_token}"
+// @Param        Refresh header string true "Bearer {refresh_token}"
+// @Param        slug path string true "Event slug"
+// @Param        id path string true "Activity ID"
+// @Success      200  {object}  NoMessageSuccessResponse{data=[]models.Activity}
+// @Failure      400  {object}  ActivityStandardErrorResponse
+// @Failure      401  {object}  ActivityStandardErrorResponse
+// @Failure      404  {object}  ActivityStandardErrorResponse
+// @Router       /events/{slug}/activity/{id}/conflicts [get]
+func (h *ActivityHandler) GetActivityConflicts(w http.ResponseWriter, r *http.Request) {
+	if r.PathValue("view") != "conflicts" {
+		http.NotFound(w, r)
+		return
+	}
+
+	slug, err := extractSlugAndValidate(r)
+	if err != nil {
+		BadRequestError(w, err, "activity")
+		return
+	}
+
+	activityID := r.PathValue("id")
+	if activityID == "" {
+		BadRequestError(w, NewErr("activity ID is required"), "activity")
+		return
+	}
+
+	user, err := getUserFromContext(h.ActivityService.ActivityRepo.GetUserByID, r)
+	if err != nil {
+		BadRequestError(w, err, "activity")
+		return
+	}
+
+	conflicts, err := h.ActivityService.GetConflictingActivities(user, slug, activityID)
+	if err != nil {
+		if strings.Contains(err.Error(), "not found") {
+			NotFoundError(w, err, "Activity", "activity")
+		} else {
+			HandleErrMsg("error getting activity conflicts", err, w).Stack("activity").BadRequest()
+		}
+		return
+	}
+
+	handleSuccess(w, conflicts, "", http.StatusOK)
+}
+
+// RegisterUserToActivity godoc
+// @Summary      Register to an activity
+// @Description  Registers the authenticated user to an activity within an event they are already registered for.
+// @Description  Activities listing requirement_items need acknowledged_requirements set to true
+// @Tags         activities
+// @Accept       json
+// @Produce      json
+// @Security     Bearer
+// @Param        Authorization header string true "Bearer {access_token}"
+// @Param        Refresh header string true "Bearer {refresh_token}"
+// @Param        slug path string true "Event slug"
+// @Param        request body models.ActivityRegistrationRequest true "Activity registration info"
+// @Success      200  {object}  NoDataSuccessResponse
+// @Failure      400  {object}  ActivityStandardErrorResponse
+// @Failure      401  {object}  ActivityStandardErrorResponse
+// @Router       /events/{slug}/activity/register [post]
+func (h *ActivityHandler) RegisterUserToActivity(w http.ResponseWriter, r *http.Request) {
+	slug, err := extractSlugAndValidate(r)
+	if err != nil {
+		BadRequestError(w, err, "activity")
+		return
+	}
+
+	var reqBody models.ActivityRegistrationRequest
+	if err := decodeRequestBody(r, &reqBody); err != nil {
+		BadRequestError(w, err, "activity")
+		return
+	}
+
+	if reqBody.ActivityID == "" {
+		HandleErrMsg("activity ID is required", nil, w).Stack("activity").BadRequest()
+		return
+	}
+
+	user, err := getUserFromContext(h.ActivityService.ActivityRepo.GetUserByID, r)
+	if err != nil {
+		if strings.Contains(err.Error(), "claims") {
+			UnauthorizedError(w, err, "activity")
+		} else {
+			BadRequestError(w, err, "activity")
+		}
+		return
+	}
+
+	if err := h.ActivityService.RegisterUserToActivity(user, slug, reqBody.ActivityID, reqBody.AcknowledgedRequirements); err != nil {
+		if strings.Contains(err.Error(), "capacity") {
+			capacityErr := errors.New("maximum capacity reached")
+			HandleErrMsg("activity is at full capacity", capacityErr, w).Stack("activity").Conflict()
+		} else if strings.Contains(err.Error(), "already registered") {
+			ConflictError(w, err, "Registration", "activity")
+		} else if strings.Contains(err.Error(), "event not registered") {
+			ForbiddenError(w, errors.New("must register for event first"), "activity")
+		} else {
+			HandleErr(err, w).Msg("Error registering to activity").Stack("activity").BadRequest()
+		}
+		return
+	}
+
+	handleSuccess(w, nil, "registered to activity successfully", http.StatusOK)
+}
+
+// RegisterUserToActivities godoc
+// @Summary      Register to several activities
+// @Description  Registers the authenticated user to up to 20 activities of an event they are already registered for. Every activity goes through
+// @Description  the single registration checks, including time conflicts with the activities accepted earlier in the batch, and gets its own result.
+// @Description  Failing activities are skipped and the others still go through, a token is spent for each fee activity. If saving the accepted
+// @Description  registrations fails nothing is kept. acknowledged_requirements covers every activity in the batch
+// @Tags         activities
+// @Accept       json
+// @Produce      json
+// @Security     Bearer
+// @Param        Authorization header string true "Bearer {access_token}"
+// @Param        Refresh header string true "Bearer {refresh_token}"
+// @Param        slug path string true "Event slug"
+// @Param        request body models.BatchActivityRegistrationRequest true "Activities to register to"
+// @Success      200  {object}  NoMessageSuccessResponse{data=[]models.BatchActivityRegistrationResult}
+// @Failure      400  {object}  ActivityStandardErrorResponse
+// @Failure      401  {object}  ActivityStandardErrorResponse
+// @Failure      403  {object}  ActivityStandardErrorResponse
+// @Failure      404  {object}  ActivityStandardErrorResponse
+// @Router       /events/{slug}/activities/register-batch [post]
+func (h *ActivityHandler) RegisterUserToActivities(w http.ResponseWriter, r *http.Request) {
+	slug, err := extractSlugAndValidate(r)
+	if err != nil {
+		BadRequestError(w, err, "activity")
+		return
+	}
+
+	var reqBody models.BatchActivityRegistrationRequest
+	if err := decodeRequestBody(r, &reqBody); err != nil {
+		BadRequestError(w, err, "activity")
+		return
+	}
+
+	user, err := getUserFromContext(h.ActivityService.ActivityRepo.GetUserByID, r)
+	if err != nil {
+		BadRequestError(w, err, "activity")
+		return
+	}
+
+	results, err := h.ActivityService.RegisterUserToActivities(user, slug, reqBody.ActivityIDs, reqBody.AcknowledgedRequirements)
+	if err != nil {
+		if strings.Contains(err.Error(), "registered to the event first") {
+			ForbiddenError(w, err, "activity")
+		} else if strings.Contains(err.Error(), "event not found") {
+			NotFoundError(w, err, "Event", "activity")
+		} else {
+			HandleErrMsg("error registering to activities", err, w).Stack("activity").BadRequest()
+		}
+		return
+	}
+
+	handleSuccess(w, results, "", http.StatusOK)
+}
+
+// UnregisterUserFromActivity godoc
+// @Summary      Unregister from an activity
+// @Description  Unregisters the authenticated user from an activity within an event
+// @Tags         activities
+// @Accept       json
+// @Produce      json
+// @Security     Bearer
+// @Param        Authorization header string true "Bearer {access_token}"
+// @Param        Refresh header string true "Bearer {refresh_token}"
+// @Param        slug path string true "Event slug"
+// @Param        request body models.ActivityRegistrationRequest true "Activity registration info"
+// @Success      200  {object}  NoDataSuccessResponse
+// @Failure      400  {object}  ActivityStandardErrorResponse
+// @Failure      401  {object}  ActivityStandardErrorResponse
+// @Router       /events/{slug}/activity/unregister [post]
+func (h *ActivityHandler) UnregisterUserFromActivity(w http.ResponseWriter, r *http.Request) {
+	slug, err := extractSlugAndValidate(r)
+	if err != nil {
+		BadRequestError(w, err, "activity")
+		return
+	}
+
+	var reqBody models.ActivityRegistrationRequest
+	if err := decodeRequestBody(r, &reqBody); err != nil {
+		BadRequestError(w, err, "activity")
+		return
+	}
+
+	if reqBody.ActivityID == "" {
+		BadRequestError(w, NewErr("activity ID is required"), "activity")
+		return
+	}
+
+	user, err := getUserFromContext(h.ActivityService.ActivityRepo.GetUserByID, r)
+	if err != nil {
+		BadRequestError(w, err, "activity")
+		return
+	}
+
+	if err := h.ActivityService.UnregisterUserFromActivity(user, slug, reqBody.ActivityID); err != nil {
+		HandleErrMsg("error unregistering from activity", err, w).Stack("activity").BadRequest()
+		return
+	}
+
+	handleSuccess(w, nil, "unregistered from activity successfully", http.StatusOK)
+}
+
+// AttendActivity godoc
+// @Summary      Mark attendance for an activity
+// @Description  Marks a user as having attended an activity (admin only)
+// @Tags         activities
+// @Accept       json
+// @Produce      json
+// @Security     Bearer
+// @Param        Authorization header string true "Bearer {access_token}"
+// @Param        Refresh header string true "Bearer {refresh_token}"
+// @Param        slug path string true "Event slug"
+// @Param        request body models.ActivityRegistrationRequest true "Attendance info"
+// @Success      200  {object}  NoDataSuccessResponse
+// @Failure      400  {object}  ActivityStandardErrorResponse
+// @Failure      401  {object}  ActivityStandardErrorResponse
+// @Failure      403  {object}  ActivityStandardErrorResponse
+// @Router       /events/{slug}/activity/attend [post]
+func (h *ActivityHandler) AttendActivity(w http.ResponseWriter, r *http.Request) {
+	slug, err := extractSlugAndValidate(r)
+	if err != nil {
+		BadRequestError(w, err, "activity")
+		return
+	}
+
+	var reqBody models.ActivityRegistrationRequest
+	if err := decodeRequestBody(r, &reqBody); err != nil {
+		BadRequestError(w, err, "activity")
+		return
+	}
+
+	if reqBody.ActivityID == "" || reqBody.UserID == "" {
+		BadRequestError(w, NewErr("activity ID and user ID are required"), "activity")
+		return
+	}
+
+	admin, err := getUserFromContext(h.ActivityService.ActivityRepo.GetUserByID, r)
+	if err != nil {
+		BadRequestError(w, err, "activity")
+		return
+	}
+
+	if err := h.ActivityService.AttendActivity(admin, slug, reqBody.ActivityID, reqBody.UserID); err != nil {
+		HandleErrMsg("error marking attendance", err, w).Stack("activity").BadRequest()
+		return
+	}
+
+	handleSuccess(w, nil, "attendance marked successfully", http.StatusOK)
+}
+
+// AttendActivityQR godoc
+// @Summary      Mark attendance from a scanned QR code
+// @Description  Marks the attendance of the user whose QR code was scanned at the activity door (admin only) and returns
+// @Description  their name and whether they are registered for the activity, nothing is marked when they aren't
+// @Tags         activities
+// @Accept       json
+// @Produce      json
+// @Security     Bearer
+// @Param        Authorization header string true "Bearer {access_token}"
+// @Param        Refresh header string true "Bearer {refresh_token}"
+// @Param        slug path string true "Event slug"
+// @Param        request body models.ActivityRegistrationRequest true "Activity and scanned user ID"
+// @Success      200  {object}  NoMessageSuccessResponse{data=models.AttendQRResponse}
+// @Failure      400  {object}  ActivityStandardErrorResponse
+// @Failure      401  {object}  ActivityStandardErrorResponse
+// @Failure      403  {object}  ActivityStandardErrorResponse
+// @Failure      404  {object}  ActivityStandardErrorResponse
+// @Router       /events/{slug}/activity/attend-qr [post]
+func (h *ActivityHandler) AttendActivityQR(w http.ResponseWriter, r *http.Request) {
+	slug, err := extractSlugAndValidate(r)
+	if err != nil {
+		BadRequestError(w, err, "activity")
+		return
+	}
+
+	var reqBody models.ActivityRegistrationRequest
+	if err := decodeRequestBody(r, &reqBody); err != nil {
+		BadRequestError(w, err, "activity")
+		return
+	}
+
+	if reqBody.ActivityID == "" || reqBody.UserID == "" {
+		BadRequestError(w, NewErr("activity ID and user ID are required"), "activity")
+		return
+	}
+
+	admin, err := getUserFromContext(h.ActivityService.ActivityRepo.GetUserByID, r)
+	if err != nil {
+		BadRequestError(w, err, "activity")
+		return
+	}
+
+	response, err := h.ActivityService.AttendActivityQR(admin, slug, reqBody.ActivityID, reqBody.UserID)
+	if err != nil {
+		switch {
+		case strings.Contains(err.Error(), "unauthorized"):
+			ForbiddenError(w, err, "activity")
+		case strings.HasPrefix(err.Error(), "user not found"):
+			HandleErr(err, w).Stack("activity").NotFound()
+		case strings.Contains(err.Error(), "not found"):
+			NotFoundError(w, err, "Activity", "activity")
+		default:
+			HandleErrMsg("error marking attendance", err, w).Stack("activity").BadRequest()
+		}
+		return
+	}
+
+	handleSuccess(w, response, "", http.StatusOK)
+}
+
+// AttendActivityBatch godoc
+// @Summary      Mark attendance for several users
+// @Description  Marks a list of users as having attended an activity (admin only). Returns the status of each user,
+// @Description  success, already_attended or not_registered, instead of failing the whole call on a bad ID
+// @Tags         activities
+// @Accept       json
+// @Produce      json
+// @Security     Bearer
+// @Param        Authorization header string true "Bearer {access_token}"
+// @Param        Refresh header string true "Bearer {refresh_token}"
+// @Param        slug path string true "Event slug"
+// @Param        request body models.AttendBatchRequest true "Activity and users to mark"
+// @Success      200  {object}  NoMessageSuccessResponse{data=[]models.AttendBatchResult}
+// @Failure      400  {object}  ActivityStandardErrorResponse
+// @Failure      401  {object}  ActivityStandardErrorResponse
+// @Failure      403  {object}  ActivityStandardErrorResponse
+// @Failure      404  {object}  ActivityStandardErrorResponse
+// @Router       /events/{slug}/activity/attend-batch [post]
+func (h *ActivityHandler) AttendActivityBatch(w http.ResponseWriter, r *http.Request) {
+	slug, err := extractSlugAndValidate(r)
+	if err != nil {
+		BadRequestError(w, err, "activity")
+		return
+	}
+
+	var reqBody models.AttendBatchRequest
+	if err := decodeRequestBody(r, &reqBody); err != nil {
+		BadRequestError(w, err, "activity")
+		return
+	}
+
+	if reqBody.ActivityID == "" {
+		BadRequestError(w, NewErr("activity ID is required"), "activity")
+		return
+	}
+
+	admin, err := getUserFromContext(h.ActivityService.ActivityRepo.GetUserByID, r)
+	if err != nil {
+		BadRequestError(w, err, "activity")
+		return
+	}
+
+	results, err := h.ActivityService.AttendActivityBatch(admin, slug, reqBody.ActivityID, reqBody.UserIDs)
+	if err != nil {
+		switch {
+		case strings.Contains(err.Error(), "unauthorized"):
+			ForbiddenError(w, err, "activity")
+		case strings.Contains(err.Error(), "not found"):
+			NotFoundError(w, err, "Activity", "activity")
+		default:
+			HandleErrMsg("error marking attendance", err, w).Stack("activity").BadRequest()
+		}
+		return
+	}
+
+	handleSuccess(w, results, "", http.StatusOK)
+}
+
+// SelfAttendActivity godoc
+// @Summary      Check in to an activity
+// @Description  Marks the authenticated user as present in an activity they are registered for. Only available for activities
+// @Description  whose check-in method is self_service and only between their start and end time
+// @Tags         activities
+// @Produce      json
+// @Security     Bearer
+// @Param        Authorization header string true "Bearer {access_token}"
+// @Param        Refresh header string true "Bearer {refresh_token}"
+// @Param        slug path string true "Event slug"
+// @Param        id path string true "Activity ID"
+// @Success      200  {object}  NoDataSuccessResponse
+// @Failure      400  {object}  ActivityStandardErrorResponse
+// @Failure      401  {object}  ActivityStandardErrorResponse
+// @Failure      403  {object}  ActivityStandardErrorResponse
+// @Failure      404  {object}  ActivityStandardErrorResponse
+// @Router       /events/{slug}/activity/self-attend/{id} [post]
+func (h *ActivityHandler) SelfAttendActivity(w http.ResponseWriter, r *http.Request) {
+	slug, err := extractSlugAndValidate(r)
+	if err != nil {
+		BadRequestError(w, err, "activity")
+		return
+	}
+
+	activityID := r.PathValue("id")
+	if activityID == "" {
+		BadRequestError(w, NewErr("activity ID is required"), "activity")
+		return
+	}
+
+	user, err := getUserFromContext(h.ActivityService.ActivityRepo.GetUserByID, r)
+	if err != nil {
+		BadRequestError(w, err, "activity")
+		return
+	}
+
+	if err := h.ActivityService.SelfAttendActivity(user, slug, activityID); err != nil {
+		switch {
+		case strings.Contains(err.Error(), "does not allow self check-in"):
+			ForbiddenError(w, err, "activity")
+		case strings.Contains(err.Error(), "not found"):
+			NotFoundError(w, err, "Activity", "activity")
+		default:
+			HandleErrMsg("error checking in to activity", err, w).Stack("activity").BadRequest()
+		}
+		return
+	}
+
+	handleSuccess(w, nil, "attendance marked successfully", http.StatusOK)
+}
+
+// GetActivityCertificate godoc
+// @Summary      Download an activity certificate
+// @Description  Returns the PDF certificate of an activity the authenticated user attended
+// @Tags         activities
+// @Produce      application/pdf
+// @Security     Bearer
+// @Param        Authorization header string true "Bearer {access_token}"
+// @Param        Refresh header string true "Bearer {refresh_token}"
+// @Param        slug path string true "Event slug"
+// @Param        id path string true "Activity ID"
+// @Success      200  {file}    file "Certificate PDF"
+// @Failure      400  {object}  ActivityStandardErrorResponse
+// @Failure      401  {object}  ActivityStandardErrorResponse
+// @Failure      403  {object}  ActivityStandardErrorResponse
+// @Failure      404  {object}  ActivityStandardErrorResponse
+// @Router       /events/{slug}/activity/certificate/{id} [get]
+func (h *ActivityHandler) GetActivityCertificate(w http.ResponseWriter, r *http.Request) {
+	slug, err := extractSlugAndValidate(r)
+	if err != nil {
+		BadRequestError(w, err, "activity")
+		return
+	}
+
+	activityID := r.PathValue("id")
+	if activityID == "" {
+		BadRequestError(w, NewErr("activity ID is required"), "activity")
+		return
+	}
+
+	user, err := getUserFromContext(h.ActivityService.ActivityRepo.GetUserByID, r)
+	if err != nil {
+		BadRequestError(w, err, "activity")
+		return
+	}
+
+	certificate, activity, err := h.ActivityService.GenerateCertificate(user, slug, activityID)
+	if err != nil {
+		switch {
+		case strings.Contains(err.Error(), "unauthorized"):
+			ForbiddenError(w, err, "activity")
+		case strings.Contains(err.Error(), "not found"):
+			NotFoundError(w, err, "Activity", "activity")
+		case strings.Contains(err.Error(), "template"):
+			HandleErrMsg("error rendering certificate", err, w).Stack("activity").InternalServerError()
+		default:
+			HandleErrMsg("error getting certificate", err, w).Stack("activity").BadRequest()
+		}
+		return
+	}
+
+	filename := "certificado-" + bundleFileName(activity.Name, activity.ID) + ".pdf"
+	w.Header().Set("Content-Type", "application/pdf")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+	w.WriteHeader(http.StatusOK)
+	if _, err := w.Write(certificate); err != nil {
+		log.Printf("Failed to write certificate of %s for activity %s: %v", user.ID, activityID, err)
+	}
+}
+
+// AttendCurrentActivity godoc
+// @Summary      Mark attendance for the activity in progress
+// @Description  Marks a scanned user as present in the activity currently in progress that they are registered for (admin only).
+// @Description  When more than one activity qualifies nothing is marked and the candidates are returned, use the attend endpoint with the chosen one
+// @Tags         activities
+// @Accept       json
+// @Produce      json
+// @Security     Bearer
+// @Param        Authorization header string true "Bearer {access_token}"
+// @Param        Refresh header string true "Bearer {refresh_token}"
+// @Param        slug path string true "Event slug"
+// @Param        request body models.AttendCurrentRequest true "Scanned user"
+// @Success      200  {object}  NoMessageSuccessResponse{data=models.AttendCurrentResponse}
+// @Failure      400  {object}  ActivityStandardErrorResponse
+// @Failure      401  {object}  ActivityStandardErrorResponse
+// @Failure      403  {object}  ActivityStandardErrorResponse
+// @Failure      404  {object}  ActivityStandardErrorResponse
+// @Failure      409  {object}  ActivityStandardErrorResponse
+// @Router       /events/{slug}/activity/attend-current [post]
+func (h *ActivityHandler) AttendCurrentActivity(w http.ResponseWriter, r *http.Request) {
+	slug, err := extractSlugAndValidate(r)
+	if err != nil {
+		BadRequestError(w, err, "activity")
+		return
+	}
+
+	var reqBody models.AttendCurrentRequest
+	if err := decodeRequestBody(r, &reqBody); err != nil {
+		BadRequestError(w, err, "activity")
+		return
+	}
+
+	if reqBody.UserID == "" {
+		BadRequestError(w, NewErr("user ID is required"), "activity")
+		return
+	}
+
+	admin, err := getUserFromContext(h.ActivityService.ActivityRepo.GetUserByID, r)
+	if err != nil {
+		BadRequestError(w, err, "activity")
+		return
+	}
+
+	result, err := h.ActivityService.AttendCurrentActivity(admin, slug, reqBody.UserID)
+	if err != nil {
+		switch {
+		case strings.Contains(err.Error(), "unauthorized"):
+			ForbiddenError(w, err, "activity")
+		case strings.Contains(err.Error(), "no activity in progress"):
+			NotFoundError(w, err, "Activity", "activity")
+		case strings.Contains(err.Error(), "already attended"):
+			ConflictError(w, err, "Attendance", "activity")
+		default:
+			HandleErrMsg("error marking attendance", err, w).Stack("activity").BadRequest()
+		}
+		return
+	}
+
+	if result.Attended == nil {
+		handleSuccess(w, result, "multiple activities in progress, choose one", http.StatusOK)
+		return
+	}
+
+	handleSuccess(w, result, "attendance marked successfully", http.StatusOK)
+}
+
+// UnattendActivity godoc
+// @Summary      Remove attendance for an activity
+// @Description  Removes a user's attendance record for an activity (master admin only)
+// @Tags         activities
+// @Accept       json
+// @Produce      json
+// @Security     Bearer
+// @Param        Authorization header string true "Bearer {access_token}"
+// @Param        Refresh header string true "Bearer {refresh_token}"
+// @Param        slug path string true "Event slug"
+// @Param        request body models.ActivityRegistrationRequest true "Attendance info"
+// @Success      200  {object}  NoDataSuccessResponse
+// @Failure      400  {object}  ActivityStandardErrorResponse
+// @Failure      401  {object}  ActivityStandardErrorResponse
+// @Failure      403  {object}  ActivityStandardErrorResponse
+// @Router       /events/{slug}/activity/unattend [post]
+func (h *ActivityHandler) UnattendActivity(w http.ResponseWriter, r *http.Request) {
+	slug, err := extractSlugAndValidate(r)
+	if err != nil {
+		BadRequestError(w, err, "activity")
+		return
+	}
+
+	var reqBody models.ActivityRegistrationRequest
+	if err := decodeRequestBody(r, &reqBody); err != nil {
+		BadRequestError(w, err, "activity")
+		return
+	}
+
+	if reqBody.ActivityID == "" || reqBody.UserID == "" {
+		BadRequestError(w, NewErr("activity ID and user ID are required"), "activity")
+		return
+	}
+
+	admin, err := getUserFromContext(h.ActivityService.ActivityRepo.GetUserByID, r)
+	if err != nil {
+		BadRequestError(w, err, "activity")
+		return
+	}
+
+	if err := h.ActivityService.UnattendActivity(admin, slug, reqBody.ActivityID, reqBody.UserID); err != nil {
+		HandleErrMsg("error removing attendance", err, w).Stack("activity").BadRequest()
+		return
+	}
+
+	handleSuccess(w, nil, "attendance removed successfully", http.StatusOK)
+}
+
+// GetActivityRegistrations godoc
+// @Summary      Retrieves a list of registrations of an activity
+// @Description  The end point returns a list of all registrations of a specified activity (all admins)
+// @Tags         activities
+// @Accept       json
+// @Produce      json
+// @Security     Bearer
+// @Param        Authorization header string true "Bearer {access_token}"
+// @Param        Refresh header string true "Bearer {refresh_token}"
+// @Param        slug path string true "Event slug"
+// @Param        id path string true "Activity ID"
+// @Success      200  {object}  NoMessageSuccessResponse{data=[]models.ActivityRegistration}
+// @Failure      400  {object}  ActivityStandardErrorResponse
+// @Failure      401  {object}  ActivityStandardErrorResponse
+// @Failure      403  {object}  ActivityStandardErrorResponse
+// @Router       /events/{slug}/activity/registrations/{id} [get]
+func (h *ActivityHandler) GetActivityRegistrations(w http.ResponseWriter, r *http.Request) {
+	slug, err := extractSlugAndValidate(r)
+	if err != nil {
+		BadRequestError(w, err, "activity")
+		return
+	}
+
+	activityID := r.PathValue("id")
+
+	if activityID == "" {
+		BadRequestError(w, NewErr("activity ID is required"), "activity")
+		return
+	}
+
+	admin, err := getUserFromContext(h.ActivityService.ActivityRepo.GetUserByID, r)
+	if err != nil {
+		BadRequestError(w, err, "activity")
+		return
+	}
+
+	var registrations []models.ActivityRegistration
+	if registrations, err = h.ActivityService.GetActivityRegistrations(admin, slug, activityID); err != nil {
+		HandleErrMsg("error getting registrations", err, w).Stack("activity").BadRequest()
+		return
+	}
+
+	handleSuccess(w, registrations, "", http.StatusOK)
+}
+
+// GetUserAccesses godoc
+// @Summary      Retrieves a list of accesses for a user
+// @Description  The end point returns a list of all accesses for a specified user
+// @Tags         activities
+// @Accept       json
+// @Produce      json
+// @Security     Bearer
+// @Param        Authorization header string true "Bearer {access_token}"
+// @Param        Refresh header string true "Bearer {refresh_token}"
+// @Success      200  {object}  NoMessageSuccessResponse{data=[]models.AccessTarget}
+// @Failure      400  {object}  ActivityStandardErrorResponse
+// @Failure      401  {object}  ActivityStandardErrorResponse
+// @Failure      403  {object}  ActivityStandardErrorResponse
+// @Router       /user-accesses [get]
+func (h *ActivityHandler) GetUserAccesses(w http.ResponseWriter, r *http.Request) {
+	user, err := getUserFromContext(h.ActivityService.ActivityRepo.GetUserByID, r)
+	if err != nil {
+		BadRequestError(w, err, "activity")
+		return
+	}
+
+	var accesses []models.AccessTarget
+	if accesses, err = h.ActivityService.GetUserAccesses(user.ID); err != nil {
+		HandleErrMsg("error getting accesses", err, w).Stack("activity").BadRequest()
+		return
+	}
+
+	handleSuccess(w, accesses, "", http.StatusOK)
+}
+
+// GetUserAccessesFromEvent godoc
+// @Summary      Retrieves a list of accesses for a user from an event
+// @Description  The end point returns a list of all accesses for a specified user from a specified event
+// @Tags         activities
+// @Accept       json
 // @Produce      json
 // @Security     Bearer
 // @Param        Authorization header string true "Bearer {access_token}"
@@ -502,123 +1543,465 @@ func (h *ActivityHandler) GetUserAccesses(w http.ResponseWriter, r *http.Request
 // @Failure      400  {object}  ActivityStandardErrorResponse
 // @Failure      401  {object}  ActivityStandardErrorResponse
 // @Failure      403  {object}  ActivityStandardErrorResponse
-// @Router       /events/{slug}/accesses [get]
-func (h *ActivityHandler) GetUserAccessesFromEvent(w http.ResponseWriter, r *http.Request) {
+// @Router       /events/{slug}/accesses [get]
+func (h *ActivityHandler) GetUserAccessesFromEvent(w http.ResponseWriter, r *http.Request) {
+	slug, err := extractSlugAndValidate(r)
+	if err != nil {
+		BadRequestError(w, err, "activity")
+		return
+	}
+
+	user, err := getUserFromContext(h.ActivityService.ActivityRepo.GetUserByID, r)
+	if err != nil {
+		BadRequestError(w, err, "activity")
+		return
+	}
+
+	var accesses []models.AccessTarget
+	if accesses, err = h.ActivityService.GetUserAccessesFromEvent(user.ID, slug); err != nil {
+		HandleErrMsg("error getting accesses", err, w).Stack("activity").BadRequest()
+		return
+	}
+
+	handleSuccess(w, accesses, "", http.StatusOK)
+}
+
+// GetUserActivities godoc
+// @Summary      Retrieves a list of activities for a user
+// @Description  The end point returns a list of all activities for a specified user
+// @Tags         activities
+// @Accept       json
+// @Produce      json
+// @Security     Bearer
+// @Param        Authorization header string true "Bearer {access_token}"
+// @Param        Refresh header string true "Bearer {refresh_token}"
+// @Success      200  {object}  NoMessageSuccessResponse{data=[]models.Activity}
+// @Failure      400  {object}  ActivityStandardErrorResponse
+// @Failure      401  {object}  ActivityStandardErrorResponse
+// @Failure      403  {object}  ActivityStandardErrorResponse
+// @Router       /user-activities [get]
+func (h *ActivityHandler) GetUserActivities(w http.ResponseWriter, r *http.Request) {
+	user, err := getUserFromContext(h.ActivityService.ActivityRepo.GetUserByID, r)
+	if err != nil {
+		BadRequestError(w, err, "activity")
+		return
+	}
+
+	var activities []models.Activity
+	if activities, err = h.ActivityService.GetUserActivities(user); err != nil {
+		HandleErrMsg("error getting activities", err, w).Stack("activity").BadRequest()
+		return
+	}
+
+	handleSuccess(w, activities, "", http.StatusOK)
+}
+
+// GetUserActivitiesFromEvent godoc
+// @Summary      Retrieves a list of activities for a user from an event
+// @Description  The end point returns a list of all activities for a specified user from a specified event
+// @Tags         activities
+// @Accept       json
+// @Produce      json
+// @Security     Bearer
+// @Param        Authorization header string true "Bearer {access_token}"
+// @Param        Refresh header string true "Bearer {refresh_token}"
+// @Param        slug path string true "Event slug"
+// @Success      200  {object}  NoMessageSuccessResponse{data=[]models.Activity}
+// @Failure      400  {object}  ActivityStandardErrorResponse
+// @Failure      401  {object}  ActivityStandardErrorResponse
+// @Failure      403  {object}  ActivityStandardErrorResponse
+// @Router       /events/{slug}/user-activities [get]
+func (h *ActivityHandler) GetUserActivitiesFromEvent(w http.ResponseWriter, r *http.Request) {
+	slug, err := extractSlugAndValidate(r)
+	if err != nil {
+		BadRequestError(w, err, "activity")
+		return
+	}
+
+	user, err := getUserFromContext(h.ActivityService.ActivityRepo.GetUserByID, r)
+	if err != nil {
+		BadRequestError(w, err, "activity")
+		return
+	}
+
+	var activities []models.Activity
+	if activities, err = h.ActivityService.GetUserActivitiesFromEvent(user, slug); err != nil {
+		HandleErrMsg("error getting activities", err, w).Stack("activity").BadRequest()
+		return
+	}
+
+	handleSuccess(w, activities, "", http.StatusOK)
+}
+
+// GetUserAttendedActivities godoc
+// @Summary      Retrieves a list of activities that the current user has attended
+// @Description  The end point returns a list of all activities that the authenticated user has attended
+// @Tags         activities
+// @Accept       json
+// @Produce      json
+// @Security     Bearer
+// @Param        Authorization header string true "Bearer {access_token}"
+// @Param        Refresh header string true "Bearer {refresh_token}"
+// @Success      200  {object}  NoMessageSuccessResponse{data=[]models.Activity}
+// @Failure      400  {object}  ActivityStandardErrorResponse
+// @Failure      401  {object}  ActivityStandardErrorResponse
+// @Router       /user-attended-activities [get]
+func (h *ActivityHandler) GetUserAttendedActivities(w http.ResponseWriter, r *http.Request) {
+	user, err := getUserFromContext(h.ActivityService.ActivityRepo.GetUserByID, r)
+	if err != nil {
+		BadRequestError(w, err, "activity")
+		return
+	}
+
+	var activities []models.Activity
+	if activities, err = h.ActivityService.GetUserAttendedActivities(user); err != nil {
+		HandleErrMsg("error getting attended activities", err, w).Stack("activity").BadRequest()
+		return
+	}
+
+	handleSuccess(w, activities, "", http.StatusOK)
+}
+
+// BackfillMandatoryActivity godoc
+// @Summary      Register existing registrants to a mandatory activity
+// @Description  Registers every current event registrant to a mandatory activity added after they registered, skipping the ones
+// @Description  already registered, so running it again is safe (master admins only)
+// @Tags         activities
+// @Produce      json
+// @Security     Bearer
+// @Param        Authorization header string true "Bearer {access_token}"
+// @Param        Refresh header string true "Bearer {refresh_token}"
+// @Param        slug path string true "Event slug"
+// @Param        id path string true "Activity ID"
+// @Success      200  {object}  NoMessageSuccessResponse{data=models.BackfillMandatoryResult}
+// @Failure      400  {object}  ActivityStandardErrorResponse
+// @Failure      401  {object}  ActivityStandardErrorResponse
+// @Failure      403  {object}  ActivityStandardErrorResponse
+// @Failure      404  {object}  ActivityStandardErrorResponse
+// @Router       /events/{slug}/activity/backfill-mandatory/{id} [post]
+func (h *ActivityHandler) BackfillMandatoryActivity(w http.ResponseWriter, r *http.Request) {
+	slug, err := extractSlugAndValidate(r)
+	if err != nil {
+		BadRequestError(w, err, "activity")
+		return
+	}
+
+	admin, err := getUserFromContext(h.ActivityService.ActivityRepo.GetUserByID, r)
+	if err != nil {
+		BadRequestError(w, err, "activity")
+		return
+	}
+
+	result, err := h.ActivityService.BackfillMandatoryActivity(admin, slug, r.PathValue("id"))
+	if err != nil {
+		switch {
+		case strings.Contains(err.Error(), "unauthorized"):
+			ForbiddenError(w, err, "activity")
+		case strings.Contains(err.Error(), "not found"):
+			NotFoundError(w, err, "Activity", "activity")
+		default:
+			HandleErrMsg("error registering users to mandatory activity", err, w).Stack("activity").BadRequest()
+		}
+		return
+	}
+
+	handleSuccess(w, result, "", http.StatusOK)
+}
+
+// GetActivityDemand godoc
+// @Summary      Get the demand of an activity
+// @Description  Returns registered users, capacity, waitlist length and the demand ratio, (registered + waitlisted) / capacity,
+// @Description  so organizers can decide whether to move the activity to a bigger room (admins only). The ratio is null for unlimited capacity activities
+// @Tags         activities
+// @Produce      json
+// @Security     Bearer
+// @Param        Authorization header string true "Bearer {access_token}"
+// @Param        Refresh header string true "Bearer {refresh_token}"
+// @Param        slug path string true "Event slug"
+// @Param        id path string true "Activity ID"
+// @Success      200  {object}  NoMessageSuccessResponse{data=models.ActivityDemand}
+// @Failure      400  {object}  ActivityStandardErrorResponse
+// @Failure      401  {object}  ActivityStandardErrorResponse
+// @Failure      403  {object}  ActivityStandardErrorResponse
+// @Failure      404  {object}  ActivityStandardErrorResponse
+// @Router       /events/{slug}/activity/demand/{id} [get]
+func (h *ActivityHandler) GetActivityDemand(w http.ResponseWriter, r *http.Request) {
+	slug, err := extractSlugAndValidate(r)
+	if err != nil {
+		BadRequestError(w, err, "activity")
+		return
+	}
+
+	admin, err := getUserFromContext(h.ActivityService.ActivityRepo.GetUserByID, r)
+	if err != nil {
+		BadRequestError(w, err, "activity")
+		return
+	}
+
+	demand, err := h.ActivityService.GetActivityDemand(admin, slug, r.PathValue("id"))
+	if err != nil {
+		switch {
+		case strings.Contains(err.Error(), "unauthorized"):
+			ForbiddenError(w, err, "activity")
+		case strings.Contains(err.Error(), "not found"):
+			NotFoundError(w, err, "Activity", "activity")
+		default:
+			HandleErrMsg("error getting activity demand", err, w).Stack("activity").BadRequest()
+		}
+		return
+	}
+
+	handleSuccess(w, demand, "", http.StatusOK)
+}
+
+// GetCheckinTrend godoc
+// @Summary      Get the check-in trend of an activity
+// @Description  Returns the check-ins of the activity grouped by minute or by 5 minutes, so organizers can follow the arrival flow (admins only).
+// @Description  The series is empty while nobody checked in
+// @Tags         activities
+// @Produce      json
+// @Security     Bearer
+// @Param        Authorization header string true "Bearer {access_token}"
+// @Param        Refresh header string true "Bearer {refresh_token}"
+// @Param        slug path string true "Event slug"
+// @Param        id path string true "Activity ID"
+// @Param        interval query string false "Bucket size, 1m or 5m (default)"
+// @Success      200  {object}  NoMessageSuccessResponse{data=models.CheckinTrend}
+// @Failure      400  {object}  ActivityStandardErrorResponse
+// @Failure      401  {object}  ActivityStandardErrorResponse
+// @Failure      403  {object}  ActivityStandardErrorResponse
+// @Failure      404  {object}  ActivityStandardErrorResponse
+// @Router       /events/{slug}/activity/checkin-trend/{id} [get]
+func (h *ActivityHandler) GetCheckinTrend(w http.ResponseWriter, r *http.Request) {
 	slug, err := extractSlugAndValidate(r)
 	if err != nil {
 		BadRequestError(w, err, "activity")
 		return
 	}
 
-	user, err := getUserFromContext(h.ActivityService.ActivityRepo.GetUserByID, r)
+	bucket := 5 * time.Minute
+	if raw := r.URL.Query().Get("interval"); raw != "" {
+		bucket, err = time.ParseDuration(raw)
+		if err != nil {
+			BadRequestError(w, errors.New("interval must be 1m or 5m"), "activity")
+			return
+		}
+	}
+
+	admin, err := getUserFromContext(h.ActivityService.ActivityRepo.GetUserByID, r)
 	if err != nil {
 		BadRequestError(w, err, "activity")
 		return
 	}
 
-	var accesses []models.AccessTarget
-	if accesses, err = h.ActivityService.GetUserAccessesFromEvent(user.ID, slug); err != nil {
-		HandleErrMsg("error getting accesses", err, w).Stack("activity").BadRequest()
+	trend, err := h.ActivityService.GetCheckinTrend(admin, slug, r.PathValue("id"), bucket)
+	if err != nil {
+		switch {
+		case strings.Contains(err.Error(), "unauthorized"):
+			ForbiddenError(w, err, "activity")
+		case strings.Contains(err.Error(), "not found"):
+			NotFoundError(w, err, "Activity", "activity")
+		default:
+			HandleErrMsg("error getting check-in trend", err, w).Stack("activity").BadRequest()
+		}
 		return
 	}
 
-	handleSuccess(w, accesses, "", http.StatusOK)
+	handleSuccess(w, trend, "", http.StatusOK)
 }
 
-// GetUserActivities godoc
-// @Summary      Retrieves a list of activities for a user
-// @Description  The end point returns a list of all activities for a specified user
+// GetCapacityHistory godoc
+// @Summary      Get the capacity history of an activity
+// @Description  Lists every change to the activity max capacity or unlimited flag, oldest first, with the old and new values,
+// @Description  the registrations at that moment and who made it (admins only)
 // @Tags         activities
-// @Accept       json
 // @Produce      json
 // @Security     Bearer
 // @Param        Authorization header string true "Bearer {access_token}"
 // @Param        Refresh header string true "Bearer {refresh_token}"
-// @Success      200  {object}  NoMessageSuccessResponse{data=[]models.Activity}
+// @Param        slug path string true "Event slug"
+// @Param        id path string true "Activity ID"
+// @Success      200  {object}  NoMessageSuccessResponse{data=[]models.CapacityChange}
 // @Failure      400  {object}  ActivityStandardErrorResponse
 // @Failure      401  {object}  ActivityStandardErrorResponse
 // @Failure      403  {object}  ActivityStandardErrorResponse
-// @Router       /user-activities [get]
-func (h *ActivityHandler) GetUserActivities(w http.ResponseWriter, r *http.Request) {
-	user, err := getUserFromContext(h.ActivityService.ActivityRepo.GetUserByID, r)
+// @Failure      404  {object}  ActivityStandardErrorResponse
+// @Router       /events/{slug}/activity/capacity-history/{id} [get]
+func (h *ActivityHandler) GetCapacityHistory(w http.ResponseWriter, r *http.Request) {
+	slug, err := extractSlugAndValidate(r)
 	if err != nil {
 		BadRequestError(w, err, "activity")
 		return
 	}
 
-	var activities []models.Activity
-	if activities, err = h.ActivityService.GetUserActivities(user); err != nil {
-		HandleErrMsg("error getting activities", err, w).Stack("activity").BadRequest()
+	admin, err := getUserFromContext(h.ActivityService.ActivityRepo.GetUserByID, r)
+	if err != nil {
+		BadRequestError(w, err, "activity")
 		return
 	}
 
-	handleSuccess(w, activities, "", http.StatusOK)
+	history, err := h.ActivityService.GetCapacityHistory(admin, slug, r.PathValue("id"))
+	if err != nil {
+		switch {
+		case strings.Contains(err.Error(), "unauthorized"):
+			ForbiddenError(w, err, "activity")
+		case strings.Contains(err.Error(), "not found"):
+			NotFoundError(w, err, "Activity", "activity")
+		default:
+			HandleErrMsg("error getting capacity history", err, w).Stack("activity").BadRequest()
+		}
+		return
+	}
+
+	handleSuccess(w, history, "", http.StatusOK)
 }
 
-// GetUserActivitiesFromEvent godoc
-// @Summary      Retrieves a list of activities for a user from an event
-// @Description  The end point returns a list of all activities for a specified user from a specified event
+// FinalizeActivityAttendance godoc
+// @Summary      Finalize the attendance of an activity
+// @Description  Marks every registrant of an ended activity that wasn't checked in as a no-show and locks its attendance (admins only)
 // @Tags         activities
-// @Accept       json
 // @Produce      json
 // @Security     Bearer
 // @Param        Authorization header string true "Bearer {access_token}"
 // @Param        Refresh header string true "Bearer {refresh_token}"
 // @Param        slug path string true "Event slug"
-// @Success      200  {object}  NoMessageSuccessResponse{data=[]models.Activity}
+// @Param        id path string true "Activity ID"
+// @Success      200  {object}  NoMessageSuccessResponse{data=models.FinalizeAttendanceResult}
 // @Failure      400  {object}  ActivityStandardErrorResponse
 // @Failure      401  {object}  ActivityStandardErrorResponse
 // @Failure      403  {object}  ActivityStandardErrorResponse
-// @Router       /events/{slug}/user-activities [get]
-func (h *ActivityHandler) GetUserActivitiesFromEvent(w http.ResponseWriter, r *http.Request) {
+// @Failure      404  {object}  ActivityStandardErrorResponse
+// @Failure      409  {object}  ActivityStandardErrorResponse
+// @Router       /events/{slug}/activity/finalize-attendance/{id} [post]
+func (h *ActivityHandler) FinalizeActivityAttendance(w http.ResponseWriter, r *http.Request) {
 	slug, err := extractSlugAndValidate(r)
 	if err != nil {
 		BadRequestError(w, err, "activity")
 		return
 	}
 
-	user, err := getUserFromContext(h.ActivityService.ActivityRepo.GetUserByID, r)
+	activityID := r.PathValue("id")
+
+	admin, err := getUserFromContext(h.ActivityService.ActivityRepo.GetUserByID, r)
 	if err != nil {
 		BadRequestError(w, err, "activity")
 		return
 	}
 
-	var activities []models.Activity
-	if activities, err = h.ActivityService.GetUserActivitiesFromEvent(user, slug); err != nil {
-		HandleErrMsg("error getting activities", err, w).Stack("activity").BadRequest()
+	result, err := h.ActivityService.FinalizeActivityAttendance(admin, slug, activityID)
+	if err != nil {
+		switch {
+		case strings.Contains(err.Error(), "unauthorized"):
+			ForbiddenError(w, err, "activity")
+		case strings.Contains(err.Error(), "not found"):
+			NotFoundError(w, err, "Activity", "activity")
+		case strings.Contains(err.Error(), "already finalized"):
+			ConflictError(w, err, "Attendance", "activity")
+		default:
+			HandleErrMsg("error finalizing attendance", err, w).Stack("activity").BadRequest()
+		}
 		return
 	}
 
-	handleSuccess(w, activities, "", http.StatusOK)
+	handleSuccess(w, result, "", http.StatusOK)
 }
 
-// GetUserAttendedActivities godoc
-// @Summary      Retrieves a list of activities that the current user has attended
-// @Description  The end point returns a list of all activities that the authenticated user has attended
+// SetContactSharing godoc
+// @Summary      Share contact with the activity speaker
+// @Description  Sets whether the authenticated user's email is shown to the speaker of an activity they are registered to
 // @Tags         activities
 // @Accept       json
 // @Produce      json
 // @Security     Bearer
 // @Param        Authorization header string true "Bearer {access_token}"
 // @Param        Refresh header string true "Bearer {refresh_token}"
-// @Success      200  {object}  NoMessageSuccessResponse{data=[]models.Activity}
+// @Param        slug path string true "Event slug"
+// @Param        request body models.ShareContactRequest true "Activity and consent"
+// @Success      200  {object}  NoDataSuccessResponse
 // @Failure      400  {object}  ActivityStandardErrorResponse
 // @Failure      401  {object}  ActivityStandardErrorResponse
-// @Router       /user-attended-activities [get]
-func (h *ActivityHandler) GetUserAttendedActivities(w http.ResponseWriter, r *http.Request) {
+// @Failure      404  {object}  ActivityStandardErrorResponse
+// @Router       /events/{slug}/activity/share-contact [post]
+func (h *ActivityHandler) SetContactSharing(w http.ResponseWriter, r *http.Request) {
+	slug, err := extractSlugAndValidate(r)
+	if err != nil {
+		BadRequestError(w, err, "activity")
+		return
+	}
+
+	var reqBody models.ShareContactRequest
+	if err := decodeRequestBody(r, &reqBody); err != nil {
+		BadRequestError(w, err, "activity")
+		return
+	}
+
+	if reqBody.ActivityID == "" {
+		BadRequestError(w, NewErr("activity ID is required"), "activity")
+		return
+	}
+
 	user, err := getUserFromContext(h.ActivityService.ActivityRepo.GetUserByID, r)
 	if err != nil {
 		BadRequestError(w, err, "activity")
 		return
 	}
 
-	var activities []models.Activity
-	if activities, err = h.ActivityService.GetUserAttendedActivities(user); err != nil {
-		HandleErrMsg("error getting attended activities", err, w).Stack("activity").BadRequest()
+	if err := h.ActivityService.SetContactSharing(user, slug, reqBody); err != nil {
+		if strings.Contains(err.Error(), "not found") {
+			NotFoundError(w, err, "Activity registration", "activity")
+		} else {
+			HandleErrMsg("error updating contact sharing", err, w).Stack("activity").BadRequest()
+		}
 		return
 	}
 
-	handleSuccess(w, activities, "", http.StatusOK)
+	handleSuccess(w, nil, "contact sharing updated successfully", http.StatusOK)
+}
+
+// GetSpeakerRoster godoc
+// @Summary      Get the speaker roster of an activity
+// @Description  Lists the registrants of the activity with their attendance for the speaker linked to it or the event admins.
+// @Description  Emails are only shown for users that opted in to share their contact with the speaker
+// @Tags         activities
+// @Produce      json
+// @Security     Bearer
+// @Param        Authorization header string true "Bearer {access_token}"
+// @Param        Refresh header string true "Bearer {refresh_token}"
+// @Param        slug path string true "Event slug"
+// @Param        id path string true "Activity ID"
+// @Success      200  {object}  NoMessageSuccessResponse{data=[]models.SpeakerRosterEntry}
+// @Failure      400  {object}  ActivityStandardErrorResponse
+// @Failure      401  {object}  ActivityStandardErrorResponse
+// @Failure      403  {object}  ActivityStandardErrorResponse
+// @Failure      404  {object}  ActivityStandardErrorResponse
+// @Router       /events/{slug}/activity/speaker-roster/{id} [get]
+func (h *ActivityHandler) GetSpeakerRoster(w http.ResponseWriter, r *http.Request) {
+	slug, err := extractSlugAndValidate(r)
+	if err != nil {
+		BadRequestError(w, err, "activity")
+		return
+	}
+
+	user, err := getUserFromContext(h.ActivityService.ActivityRepo.GetUserByID, r)
+	if err != nil {
+		BadRequestError(w, err, "activity")
+		return
+	}
+
+	roster, err := h.ActivityService.GetSpeakerRoster(user, slug, r.PathValue("id"))
+	if err != nil {
+		switch {
+		case strings.Contains(err.Error(), "unauthorized"):
+			ForbiddenError(w, err, "activity")
+		case strings.Contains(err.Error(), "not found"):
+			NotFoundError(w, err, "Activity", "activity")
+		default:
+			HandleErrMsg("error getting speaker roster", err, w).Stack("activity").BadRequest()
+		}
+		return
+	}
+
+	handleSuccess(w, roster, "", http.StatusOK)
 }
 
 // GetActivityAttendants godoc
@@ -660,3 +2043,178 @@ func (h *ActivityHandler) GetActivityAttendants(w http.ResponseWriter, r *http.R
 
 	handleSuccess(w, attendants, "", http.StatusOK)
 }
+
+// JoinActivityWaitlist godoc
+// @Summary      Join an activity waitlist
+// @Description  Queues the authenticated user for a full activity. When a seat frees up the first user in line is registered
+// @Tags         activities
+// @Accept       json
+// @Produce      json
+// @Security     Bearer
+// @Param        Authorization header string true "Bearer {access_token}"
+// @Param        Refresh header string true "Bearer {refresh_token}"
+// @Param        slug path string true "Event slug"
+// @Param        request body models.ActivityRegistrationRequest true "Activity registration info"
+// @Success      200  {object}  NoMessageSuccessResponse{data=models.ActivityWaitlist}
+// @Failure      400  {object}  ActivityStandardErrorResponse
+// @Failure      401  {object}  ActivityStandardErrorResponse
+// @Failure      409  {object}  ActivityStandardErrorResponse
+// @Router       /events/{slug}/activity/waitlist [post]
+func (h *ActivityHandler) JoinActivityWaitlist(w http.ResponseWriter, r *http.Request) {
+	slug, err := extractSlugAndValidate(r)
+	if err != nil {
+		BadRequestError(w, err, "activity")
+		return
+	}
+
+	var reqBody models.ActivityRegistrationRequest
+	if err := decodeRequestBody(r, &reqBody); err != nil {
+		BadRequestError(w, err, "activity")
+		return
+	}
+
+	if reqBody.ActivityID == "" {
+		BadRequestError(w, NewErr("activity ID is required"), "activity")
+		return
+	}
+
+	user, err := getUserFromContext(h.ActivityService.ActivityRepo.GetUserByID, r)
+	if err != nil {
+		BadRequestError(w, err, "activity")
+		return
+	}
+
+	entry, err := h.ActivityService.JoinWaitlist(user, slug, reqBody.ActivityID)
+	if err != nil {
+		if strings.Contains(err.Error(), "already") {
+			ConflictError(w, err, "Waitlist", "activity")
+		} else {
+			HandleErrMsg("error joining waitlist", err, w).Stack("activity").BadRequest()
+		}
+		return
+	}
+
+	handleSuccess(w, entry, "", http.StatusOK)
+}
+
+// GetUserWaitlists godoc
+// @Summary      Get the user's waitlists
+// @Description  Returns every activity waitlist the authenticated user is in, with the activity, event and position in line
+// @Tags         activities
+// @Produce      json
+// @Security     Bearer
+// @Param        Authorization header string true "Bearer {access_token}"
+// @Param        Refresh header string true "Bearer {refresh_token}"
+// @Success      200  {object}  NoMessageSuccessResponse{data=[]models.UserWaitlistEntry}
+// @Failure      400  {object}  ActivityStandardErrorResponse
+// @Failure      401  {object}  ActivityStandardErrorResponse
+// @Router       /user-waitlists [get]
+func (h *ActivityHandler) GetUserWaitlists(w http.ResponseWriter, r *http.Request) {
+	user, err := getUserFromContext(h.ActivityService.ActivityRepo.GetUserByID, r)
+	if err != nil {
+		BadRequestError(w, err, "activity")
+		return
+	}
+
+	waitlists, err := h.ActivityService.GetUserWaitlists(user)
+	if err != nil {
+		HandleErrMsg("error getting user waitlists", err, w).Stack("activity").BadRequest()
+		return
+	}
+
+	handleSuccess(w, waitlists, "", http.StatusOK)
+}
+
+// LeaveActivityWaitlist godoc
+// @Summary      Leave an activity waitlist
+// @Description  Removes the authenticated user from an activity waitlist, releasing any pending promotion
+// @Tags         activities
+// @Accept       json
+// @Produce      json
+// @Security     Bearer
+// @Param        Authorization header string true "Bearer {access_token}"
+// @Param        Refresh header string true "Bearer {refresh_token}"
+// @Param        slug path string true "Event slug"
+// @Param        request body models.ActivityRegistrationRequest true "Activity registration info"
+// @Success      200  {object}  NoDataSuccessResponse
+// @Failure      400  {object}  ActivityStandardErrorResponse
+// @Failure      401  {object}  ActivityStandardErrorResponse
+// @Router       /events/{slug}/activity/waitlist/leave [post]
+func (h *ActivityHandler) LeaveActivityWaitlist(w http.ResponseWriter, r *http.Request) {
+	slug, err := extractSlugAndValidate(r)
+	if err != nil {
+		BadRequestError(w, err, "activity")
+		return
+	}
+
+	var reqBody models.ActivityRegistrationRequest
+	if err := decodeRequestBody(r, &reqBody); err != nil {
+		BadRequestError(w, err, "activity")
+		return
+	}
+
+	if reqBody.ActivityID == "" {
+		BadRequestError(w, NewErr("activity ID is required"), "activity")
+		return
+	}
+
+	user, err := getUserFromContext(h.ActivityService.ActivityRepo.GetUserByID, r)
+	if err != nil {
+		BadRequestError(w, err, "activity")
+		return
+	}
+
+	if err := h.ActivityService.LeaveWaitlist(user, slug, reqBody.ActivityID); err != nil {
+		HandleErrMsg("error leaving waitlist", err, w).Stack("activity").BadRequest()
+		return
+	}
+
+	handleSuccess(w, nil, "left waitlist successfully", http.StatusOK)
+}
+
+// ConfirmWaitlistPromotion godoc
+// @Summary      Confirm a waitlist promotion
+// @Description  Confirms the seat offered to the authenticated user from an activity waitlist before its deadline expires.
+// @Description  The promotion email links to the frontend at {SITE_URL}/events/{slug}/activities?confirm={id}, which calls this route
+// @Tags         activities
+// @Produce      json
+// @Security     Bearer
+// @Param        Authorization header string true "Bearer {access_token}"
+// @Param        Refresh header string true "Bearer {refresh_token}"
+// @Param        slug path string true "Event slug"
+// @Param        id path string true "Activity ID"
+// @Success      200  {object}  NoDataSuccessResponse
+// @Failure      400  {object}  ActivityStandardErrorResponse
+// @Failure      401  {object}  ActivityStandardErrorResponse
+// @Failure      410  {object}  ActivityStandardErrorResponse
+// @Router       /events/{slug}/activity/confirm-waitlist/{id} [post]
+func (h *ActivityHandler) ConfirmWaitlistPromotion(w http.ResponseWriter, r *http.Request) {
+	slug, err := extractSlugAndValidate(r)
+	if err != nil {
+		BadRequestError(w, err, "activity")
+		return
+	}
+
+	activityID := r.PathValue("id")
+	if activityID == "" {
+		BadRequestError(w, NewErr("activity ID is required"), "activity")
+		return
+	}
+
+	user, err := getUserFromContext(h.ActivityService.ActivityRepo.GetUserByID, r)
+	if err != nil {
+		BadRequestError(w, err, "activity")
+		return
+	}
+
+	if err := h.ActivityService.ConfirmWaitlistPromotion(user, slug, activityID); err != nil {
+		if strings.Contains(err.Error(), "expired") {
+			HandleErrMsg("error confirming waitlist promotion", err, w).Stack("activity").Code(http.StatusGone)
+		} else {
+			HandleErrMsg("error confirming waitlist promotion", err, w).Stack("activity").BadRequest()
+		}
+		return
+	}
+
+	handleSuccess(w, nil, "waitlist promotion confirmed", http.StatusOK)
+}
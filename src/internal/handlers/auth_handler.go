@@ -6,7 +6,9 @@ import (
 	"scti/config"
 	"scti/internal/models"
 	"scti/internal/services"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/golang-jwt/jwt/v5"
 )
@@ -271,6 +273,39 @@ func (h *AuthHandler) VerifyAccount(w http.ResponseWriter, r *http.Request) {
 	handleSuccess(w, nil, "account verified", http.StatusOK)
 }
 
+// RefreshClaims godoc
+// @Summary      Refresh the token claims
+// @Description  Issues a new access token with the user's current admin statuses and flags, and a rotated refresh token, so a promotion
+// @Description  or demotion shows up without logging in again. The new tokens are returned in the X-New-Access-Token and X-New-Refresh-Token headers
+// @Tags         auth
+// @Produce      json
+// @Security     Bearer
+// @Param        Authorization header string true "Bearer {access_token}"
+// @Param        Refresh header string true "Bearer {refresh_token}"
+// @Success      200  {object}  NoDataSuccessResponse
+// @Failure      400  {object}  AuthStandardErrorResponse
+// @Failure      401  {object}  AuthStandardErrorResponse
+// @Router       /refresh-claims [post]
+func (h *AuthHandler) RefreshClaims(w http.ResponseWriter, r *http.Request) {
+	user, err := getUserFromContext(h.AuthService.AuthRepo.FindUserByID, r)
+	if err != nil {
+		BadRequestError(w, err, "auth")
+		return
+	}
+
+	refreshTokenString := strings.TrimPrefix(r.Header.Get("Refresh"), "Bearer ")
+	accessToken, refreshToken, err := h.AuthService.RefreshClaims(user, refreshTokenString, r)
+	if err != nil {
+		HandleErrMsg("error refreshing claims", err, w).Stack("auth").BadRequest()
+		return
+	}
+
+	w.Header().Set("X-New-Access-Token", accessToken)
+	w.Header().Set("X-New-Refresh-Token", refreshToken)
+
+	handleSuccess(w, nil, "claims refreshed", http.StatusOK)
+}
+
 // VerifyJWT godoc
 // @Summary      Verify JWT tokens
 // @Description  Validates both access token and refresh token signatures
@@ -369,6 +404,9 @@ func (h *AuthHandler) ForgotPassword(w http.ResponseWriter, r *http.Request) {
 	}
 
 	if err := h.AuthService.InitiatePasswordReset(req.Email); err != nil {
+		if tooManyEmailRequests(w, err) {
+			return
+		}
 		HandleErrMsg("error initiating password reset", err, w).Stack("auth").BadRequest()
 		return
 	}
@@ -426,6 +464,94 @@ func (h *AuthHandler) ChangePassword(w http.ResponseWriter, r *http.Request) {
 	handleSuccess(w, nil, "password changed successfully", http.StatusOK)
 }
 
+// ImportUsers godoc
+// @Summary      Bulk import users
+// @Description  Pre-creates unverified accounts with a random password and emails each created user an invite to set their password.
+// @Description  Existing or invalid emails are skipped and reported per row. Only available to super users.
+// @Tags         users
+// @Accept       json
+// @Produce      json
+// @Security     Bearer
+// @Param        Authorization header string true "Bearer {access_token}"
+// @Param        Refresh header string true "Bearer {refresh_token}"
+// @Param        request body models.UserImportRequest true "Users to import"
+// @Success      200  {object}  NoMessageSuccessResponse{data=[]models.UserImportResult}
+// @Failure      400  {object}  AuthStandardErrorResponse
+// @Failure      401  {object}  AuthStandardErrorResponse
+// @Failure      403  {object}  AuthStandardErrorResponse
+// @Router       /users/import [post]
+func (h *AuthHandler) ImportUsers(w http.ResponseWriter, r *http.Request) {
+	user, err := getUserFromContext(h.AuthService.AuthRepo.FindUserByID, r)
+	if err != nil {
+		BadRequestError(w, err, "auth")
+		return
+	}
+
+	var req models.UserImportRequest
+	if err := decodeRequestBody(r, &req); err != nil {
+		BadRequestError(w, err, "auth")
+		return
+	}
+
+	results, err := h.AuthService.ImportUsers(user, req.Users)
+	if err != nil {
+		if strings.Contains(err.Error(), "unauthorized") {
+			ForbiddenError(w, err, "auth")
+		} else {
+			HandleErrMsg("error importing users", err, w).Stack("auth").BadRequest()
+		}
+		return
+	}
+
+	handleSuccess(w, results, "", http.StatusOK)
+}
+
+type RotateSuperPasswordRequest struct {
+	CurrentPassword string `json:"current_password"`
+	NewPassword     string `json:"new_password"`
+}
+
+// RotateSuperPassword godoc
+// @Summary      Rotate the super user password
+// @Description  Replaces the super user password and revokes all of its sessions. The new password must have at least 12 characters
+// @Description  with upper and lower case letters, a digit and a symbol. Only available to super users.
+// @Tags         auth
+// @Accept       json
+// @Produce      json
+// @Security     Bearer
+// @Param        Authorization header string true "Bearer {access_token}"
+// @Param        Refresh header string true "Bearer {refresh_token}"
+// @Param        request body RotateSuperPasswordRequest true "Current and new password"
+// @Success      200  {object}  NoDataSuccessResponse
+// @Failure      400  {object}  AuthStandardErrorResponse
+// @Failure      401  {object}  AuthStandardErrorResponse
+// @Failure      403  {object}  AuthStandardErrorResponse
+// @Router       /admin/rotate-super-password [post]
+func (h *AuthHandler) RotateSuperPassword(w http.ResponseWriter, r *http.Request) {
+	user, err := getUserFromContext(h.AuthService.AuthRepo.FindUserByID, r)
+	if err != nil {
+		BadRequestError(w, err, "auth")
+		return
+	}
+
+	var req RotateSuperPasswordRequest
+	if err := decodeRequestBody(r, &req); err != nil {
+		BadRequestError(w, err, "auth")
+		return
+	}
+
+	if err := h.AuthService.RotateSuperPassword(user, req.CurrentPassword, req.NewPassword); err != nil {
+		if strings.Contains(err.Error(), "unauthorized") {
+			ForbiddenError(w, err, "auth")
+		} else {
+			HandleErrMsg("error rotating password", err, w).Stack("auth").BadRequest()
+		}
+		return
+	}
+
+	handleSuccess(w, nil, "password rotated, all sessions were revoked", http.StatusOK)
+}
+
 type SwitchEventCreatorStatusRequest struct {
 	Email string `json:"email" example:"user@example.com"`
 }
@@ -475,6 +601,81 @@ func (h *AuthHandler) SwitchEventCreatorStatus(w http.ResponseWriter, r *http.Re
 	handleSuccess(w, nil, "event creator status switched successfully", http.StatusOK)
 }
 
+// GetEventCreators godoc
+// @Summary      List event creators
+// @Description  Lists the users that can create events. Only available to super users.
+// @Tags         auth
+// @Produce      json
+// @Security     Bearer
+// @Param        Authorization header string true "Bearer {access_token}"
+// @Param        Refresh header string true "Bearer {refresh_token}"
+// @Success      200  {object}  NoMessageSuccessResponse{data=[]models.EventCreator}
+// @Failure      400  {object}  AuthStandardErrorResponse
+// @Failure      401  {object}  AuthStandardErrorResponse
+// @Failure      403  {object}  AuthStandardErrorResponse
+// @Router       /admin/event-creators [get]
+func (h *AuthHandler) GetEventCreators(w http.ResponseWriter, r *http.Request) {
+	user, err := getUserFromContext(h.AuthService.AuthRepo.FindUserByID, r)
+	if err != nil {
+		BadRequestError(w, err, "auth")
+		return
+	}
+
+	creators, err := h.AuthService.GetEventCreators(user)
+	if err != nil {
+		if strings.Contains(err.Error(), "unauthorized") {
+			ForbiddenError(w, err, "auth")
+		} else {
+			HandleErrMsg("error getting event creators", err, w).Stack("auth").BadRequest()
+		}
+		return
+	}
+
+	handleSuccess(w, creators, "", http.StatusOK)
+}
+
+// GrantEventCreatorStatus godoc
+// @Summary      Grant event creator status in bulk
+// @Description  Lets every user of the list create events, at most 100 emails per call, reporting the result of each email.
+// @Description  Each change is recorded in the audit log, use /switch-event-creator-status to revoke. Only available to super users.
+// @Tags         auth
+// @Accept       json
+// @Produce      json
+// @Security     Bearer
+// @Param        Authorization header string true "Bearer {access_token}"
+// @Param        Refresh header string true "Bearer {refresh_token}"
+// @Param        request body models.EventCreatorGrantRequest true "Emails to grant"
+// @Success      200  {object}  NoMessageSuccessResponse{data=[]models.EventCreatorGrantResult}
+// @Failure      400  {object}  AuthStandardErrorResponse
+// @Failure      401  {object}  AuthStandardErrorResponse
+// @Failure      403  {object}  AuthStandardErrorResponse
+// @Router       /admin/event-creators/grant [post]
+func (h *AuthHandler) GrantEventCreatorStatus(w http.ResponseWriter, r *http.Request) {
+	user, err := getUserFromContext(h.AuthService.AuthRepo.FindUserByID, r)
+	if err != nil {
+		BadRequestError(w, err, "auth")
+		return
+	}
+
+	var req models.EventCreatorGrantRequest
+	if err := decodeRequestBody(r, &req); err != nil {
+		BadRequestError(w, err, "auth")
+		return
+	}
+
+	results, err := h.AuthService.GrantEventCreatorStatus(user, req.Emails)
+	if err != nil {
+		if strings.Contains(err.Error(), "unauthorized") {
+			ForbiddenError(w, err, "auth")
+		} else {
+			HandleErrMsg("error granting event creator status", err, w).Stack("auth").BadRequest()
+		}
+		return
+	}
+
+	handleSuccess(w, results, "", http.StatusOK)
+}
+
 type ChangeUserNameRequest struct {
 	Name     string `json:"name"`
 	LastName string `json:"last_name"`
@@ -537,6 +738,7 @@ func (h *AuthHandler) ChangeUserName(w http.ResponseWriter, r *http.Request) {
 // @Success      200  {object}  NoDataSuccessResponse
 // @Failure      400  {object}  AuthStandardErrorResponse
 // @Failure      401  {object}  AuthStandardErrorResponse
+// @Failure      429  {object}  AuthStandardErrorResponse
 // @Router       /resend-verification-code [post]
 func (h *AuthHandler) ResendVerificationCode(w http.ResponseWriter, r *http.Request) {
 	user, err := getUserFromContext(h.AuthService.AuthRepo.FindUserByID, r)
@@ -546,9 +748,127 @@ func (h *AuthHandler) ResendVerificationCode(w http.ResponseWriter, r *http.Requ
 	}
 
 	if err := h.AuthService.ResendVerificationCode(&user); err != nil {
+		if tooManyEmailRequests(w, err) {
+			return
+		}
 		HandleErrMsg("error resending verification code", err, w).Stack("auth").BadRequest()
 		return
 	}
 
 	handleSuccess(w, nil, "verification code resent", http.StatusOK)
 }
+
+// tooManyEmailRequests answers 429 with a Retry-After header when err is an email rate limit error
+func tooManyEmailRequests(w http.ResponseWriter, err error) bool {
+	var limitErr *services.EmailRateLimitError
+	if !errors.As(err, &limitErr) {
+		return false
+	}
+	w.Header().Set("Retry-After", strconv.Itoa(int(limitErr.RetryAfter.Seconds())+1))
+	HandleErr(err, w).Stack("auth").TooManyRequests()
+	return true
+}
+
+// parseOlderThan reads the older_than query parameter as a Go duration, defaulting to 72h
+func parseOlderThan(r *http.Request) (time.Duration, error) {
+	raw := r.URL.Query().Get("older_than")
+	if raw == "" {
+		return 72 * time.Hour, nil
+	}
+	olderThan, err := time.ParseDuration(raw)
+	if err != nil || olderThan < 0 {
+		return 0, errors.New("older_than must be a positive duration like 72h")
+	}
+	return olderThan, nil
+}
+
+// GetUnverifiedUsers godoc
+// @Summary      List unverified users
+// @Description  Lists the users that never verified their account and registered before now minus older_than, oldest first,
+// @Description  with when their last verification code was generated. Only available to super users
+// @Tags         auth
+// @Produce      json
+// @Security     Bearer
+// @Param        Authorization header string true "Bearer {access_token}"
+// @Param        Refresh header string true "Bearer {refresh_token}"
+// @Param        older_than query string false "Minimum account age as a Go duration, defaults to 72h" example(72h)
+// @Param        page query int false "Page, starting at 1"
+// @Param        page_size query int false "Page size, up to 100"
+// @Success      200  {object}  NoMessageSuccessResponse{data=models.UnverifiedUserList}
+// @Failure      400  {object}  AuthStandardErrorResponse
+// @Failure      401  {object}  AuthStandardErrorResponse
+// @Failure      403  {object}  AuthStandardErrorResponse
+// @Router       /admin/unverified-users [get]
+func (h *AuthHandler) GetUnverifiedUsers(w http.ResponseWriter, r *http.Request) {
+	page, pageSize, err := parsePagination(r)
+	if err != nil {
+		BadRequestError(w, err, "auth")
+		return
+	}
+
+	olderThan, err := parseOlderThan(r)
+	if err != nil {
+		BadRequestError(w, err, "auth")
+		return
+	}
+
+	user, err := getUserFromContext(h.AuthService.AuthRepo.FindUserByID, r)
+	if err != nil {
+		BadRequestError(w, err, "auth")
+		return
+	}
+
+	users, err := h.AuthService.GetUnverifiedUsers(user, olderThan, page, pageSize)
+	if err != nil {
+		if strings.Contains(err.Error(), "unauthorized") {
+			ForbiddenError(w, err, "auth")
+		} else {
+			HandleErrMsg("error getting unverified users", err, w).Stack("auth").BadRequest()
+		}
+		return
+	}
+
+	handleSuccess(w, users, "", http.StatusOK)
+}
+
+// ResendVerificationToUnverified godoc
+// @Summary      Resend verification codes in bulk
+// @Description  Sends a new verification code to every unverified user that registered before now minus older_than.
+// @Description  Users that got a code in the last hour are skipped and each call handles at most 200 users, call again for the remaining ones.
+// @Description  Emails are sent in the background, one at a time. Only available to super users
+// @Tags         auth
+// @Produce      json
+// @Security     Bearer
+// @Param        Authorization header string true "Bearer {access_token}"
+// @Param        Refresh header string true "Bearer {refresh_token}"
+// @Param        older_than query string false "Minimum account age as a Go duration, defaults to 72h" example(72h)
+// @Success      200  {object}  NoMessageSuccessResponse{data=models.BulkResendVerificationResult}
+// @Failure      400  {object}  AuthStandardErrorResponse
+// @Failure      401  {object}  AuthStandardErrorResponse
+// @Failure      403  {object}  AuthStandardErrorResponse
+// @Router       /admin/unverified-users/resend-verification [post]
+func (h *AuthHandler) ResendVerificationToUnverified(w http.ResponseWriter, r *http.Request) {
+	olderThan, err := parseOlderThan(r)
+	if err != nil {
+		BadRequestError(w, err, "auth")
+		return
+	}
+
+	user, err := getUserFromContext(h.AuthService.AuthRepo.FindUserByID, r)
+	if err != nil {
+		BadRequestError(w, err, "auth")
+		return
+	}
+
+	result, err := h.AuthService.ResendVerificationToUnverified(user, olderThan)
+	if err != nil {
+		if strings.Contains(err.Error(), "unauthorized") {
+			ForbiddenError(w, err, "auth")
+		} else {
+			HandleErrMsg("error resending verification codes", err, w).Stack("auth").BadRequest()
+		}
+		return
+	}
+
+	handleSuccess(w, result, "", http.StatusOK)
+}
@@ -2,9 +2,14 @@ package handlers
 
 import (
 	"errors"
+	"fmt"
+	"log"
 	"net/http"
 	"scti/internal/models"
 	"scti/internal/services"
+	"strconv"
+	"strings"
+	"time"
 )
 
 type EventHandler struct {
@@ -17,7 +22,8 @@ func NewEventHandler(service *services.EventService) *EventHandler {
 
 // CreateEvent godoc
 // @Summary      Create a new event
-// @Description  Creates a new event. Only master users can create events
+// @Description  Creates a new event. Only master users can create events.
+// @Description  When other events are booked at the same venue during the event dates, the response message carries a warning
 // @Tags         events
 // @Accept       json
 // @Produce      json
@@ -43,13 +49,26 @@ func (h *EventHandler) CreateEvent(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	event, err := h.EventService.CreateEvent(user, reqBody)
+	event, conflicts, err := h.EventService.CreateEvent(user, reqBody)
 	if err != nil {
 		handleError(w, errors.New("error creating event: "+err.Error()), http.StatusBadRequest)
 		return
 	}
 
-	handleSuccess(w, event, "", http.StatusOK)
+	handleSuccess(w, event, venueConflictWarning(conflicts), http.StatusOK)
+}
+
+// venueConflictWarning tells the creator which events are booked at the same venue, empty when there are none
+func venueConflictWarning(conflicts []models.VenueConflict) string {
+	if len(conflicts) == 0 {
+		return ""
+	}
+
+	names := make([]string, len(conflicts))
+	for i, conflict := range conflicts {
+		names[i] = conflict.Name
+	}
+	return "warning: " + conflicts[0].Venue + " is also booked for " + strings.Join(names, ", ")
 }
 
 // GetEvent godoc
@@ -79,14 +98,56 @@ func (h *EventHandler) GetEvent(w http.ResponseWriter, r *http.Request) {
 
 // GetAllEvents godoc
 // @Summary      Get all events
-// @Description  Returns a list of all events
+// @Description  Returns a list of all events. With any of page, page_size, from_date or to_date the events running in the
+// @Description  date range come paginated in a models.EventList envelope with items, page, page_size and total_count instead
 // @Tags         events
 // @Produce      json
+// @Param        page query int false "Page number, starting at 1"
+// @Param        page_size query int false "Events per page, 20 by default and at most 100"
+// @Param        from_date query string false "Only events ending on or after this date, YYYY-MM-DD or RFC3339"
+// @Param        to_date query string false "Only events starting on or before this date, YYYY-MM-DD or RFC3339"
 // @Success      200  {object}  NoMessageSuccessResponse{data=[]models.Event}
 // @Failure      400  {object}  EventStandardErrorResponse
 // @Router       /events [get]
 func (h *EventHandler) GetAllEvents(w http.ResponseWriter, r *http.Request) {
-	events, err := h.EventService.GetAllEvents()
+	query := r.URL.Query()
+	paginated := query.Has("page") || query.Has("page_size") || query.Has("from_date") || query.Has("to_date")
+
+	if !paginated {
+		events, err := h.EventService.GetAllEvents(models.EventFilter{}, 0, 0)
+		if err != nil {
+			handleError(w, errors.New("error getting all events: "+err.Error()), http.StatusBadRequest)
+			return
+		}
+		handleSuccess(w, events.Items, "", http.StatusOK)
+		return
+	}
+
+	page, pageSize, err := parsePagination(r)
+	if err != nil {
+		handleError(w, err, http.StatusBadRequest)
+		return
+	}
+
+	var filter models.EventFilter
+	if raw := query.Get("from_date"); raw != "" {
+		from, err := parseDateParam(raw, false)
+		if err != nil {
+			handleError(w, errors.New("from_date must be YYYY-MM-DD or an RFC3339 date"), http.StatusBadRequest)
+			return
+		}
+		filter.From = &from
+	}
+	if raw := query.Get("to_date"); raw != "" {
+		to, err := parseDateParam(raw, true)
+		if err != nil {
+			handleError(w, errors.New("to_date must be YYYY-MM-DD or an RFC3339 date"), http.StatusBadRequest)
+			return
+		}
+		filter.To = &to
+	}
+
+	events, err := h.EventService.GetAllEvents(filter, page, pageSize)
 	if err != nil {
 		handleError(w, errors.New("error getting all events: "+err.Error()), http.StatusBadRequest)
 		return
@@ -124,6 +185,35 @@ func (h *EventHandler) GetEventsCreatedByUser(w http.ResponseWriter, r *http.Req
 	handleSuccess(w, events, "", http.StatusOK)
 }
 
+// GetManageableEvents godoc
+// @Summary      Get events a user can manage
+// @Description  Returns the events where the user is the creator or a master admin, or every event for super users.
+// @Description  These are the events the user can create products and activities for
+// @Tags         events
+// @Produce      json
+// @Security     Bearer
+// @Param        Authorization header string true "Bearer {access_token}"
+// @Param        Refresh header string true "Bearer {refresh_token}"
+// @Success      200  {object}  NoMessageSuccessResponse{data=[]models.Event}
+// @Failure      400  {object}  EventStandardErrorResponse
+// @Failure      401  {object}  EventStandardErrorResponse
+// @Router       /user-manageable-events [get]
+func (h *EventHandler) GetManageableEvents(w http.ResponseWriter, r *http.Request) {
+	user, err := getUserFromContext(h.EventService.GetUserByID, r)
+	if err != nil {
+		handleError(w, err, http.StatusBadRequest)
+		return
+	}
+
+	events, err := h.EventService.GetManageableEvents(user)
+	if err != nil {
+		handleError(w, errors.New("error getting manageable events: "+err.Error()), http.StatusBadRequest)
+		return
+	}
+
+	handleSuccess(w, events, "", http.StatusOK)
+}
+
 // GetAllPublicEvents godoc
 // @Summary      Get all public events
 // @Description  Returns a list of all public events (where IsPublic=true)
@@ -144,7 +234,8 @@ func (h *EventHandler) GetAllPublicEvents(w http.ResponseWriter, r *http.Request
 
 // UpdateEvent godoc
 // @Summary      Update an event by slug
-// @Description  Updates an existing event using its slug. Only master users can update events
+// @Description  Updates an existing event using its slug. Only master users can update events.
+// @Description  When other events are booked at the same venue during the event dates, the response message carries a warning
 // @Tags         events
 // @Accept       json
 // @Produce      json
@@ -177,13 +268,13 @@ func (h *EventHandler) UpdateEvent(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	updatedEvent, err := h.EventService.UpdateEvent(user, slug, &reqBody)
+	updatedEvent, conflicts, err := h.EventService.UpdateEvent(user, slug, &reqBody)
 	if err != nil {
 		handleError(w, errors.New("error updating event: "+err.Error()), http.StatusBadRequest)
 		return
 	}
 
-	handleSuccess(w, updatedEvent, "", http.StatusOK)
+	handleSuccess(w, updatedEvent, venueConflictWarning(conflicts), http.StatusOK)
 }
 
 // DeleteEvent godoc
@@ -258,13 +349,16 @@ func (h *EventHandler) RegisterToEvent(w http.ResponseWriter, r *http.Request) {
 
 // UnregisterFromEvent godoc
 // @Summary      Unregister from an event
-// @Description  Unregisters the authenticated user from an event by its slug
+// @Description  Unregisters the authenticated user from an event by its slug. The body is optional, a reason of up to 500 characters
+// @Description  is kept for the organizers' cancellation report
 // @Tags         events
+// @Accept       json
 // @Produce      json
 // @Security     Bearer
 // @Param        Authorization header string true "Bearer {access_token}"
 // @Param        Refresh header string true "Bearer {refresh_token}"
 // @Param        slug path string true "Event slug"
+// @Param        request body models.UnregisterEventRequest false "Why the user is leaving"
 // @Success      200  {object}  NoDataSuccessResponse
 // @Failure      400  {object}  EventStandardErrorResponse
 // @Failure      401  {object}  EventStandardErrorResponse
@@ -282,7 +376,13 @@ func (h *EventHandler) UnregisterFromEvent(w http.ResponseWriter, r *http.Reques
 		return
 	}
 
-	if err := h.EventService.UnregisterUserFromEvent(user, slug); err != nil {
+	var reqBody models.UnregisterEventRequest
+	if err := decodeOptionalRequestBody(r, &reqBody); err != nil {
+		handleError(w, err, http.StatusBadRequest)
+		return
+	}
+
+	if err := h.EventService.UnregisterUserFromEvent(user, slug, reqBody.Reason); err != nil {
 		handleError(w, errors.New("error unregistering from event: "+err.Error()), http.StatusBadRequest)
 		return
 	}
@@ -421,3 +521,1315 @@ func (h *EventHandler) GetUserEvents(w http.ResponseWriter, r *http.Request) {
 
 	handleSuccess(w, events, "", http.StatusOK)
 }
+
+// GetUserUpcomingEvents godoc
+// @Summary      Get user upcoming events
+// @Description  Returns the events the authenticated user is registered to that haven't ended yet, soonest first
+// @Tags         events
+// @Produce      json
+// @Security     Bearer
+// @Param        Authorization header string true "Bearer {access_token}"
+// @Param        Refresh header string true "Bearer {refresh_token}"
+// @Success      200  {object}  NoMessageSuccessResponse{data=[]models.Event}
+// @Failure      400  {object}  EventStandardErrorResponse
+// @Failure      401  {object}  EventStandardErrorResponse
+// @Router       /user-events/upcoming [get]
+func (h *EventHandler) GetUserUpcomingEvents(w http.ResponseWriter, r *http.Request) {
+	user, err := getUserFromContext(h.EventService.GetUserByID, r)
+	if err != nil {
+		handleError(w, err, http.StatusBadRequest)
+		return
+	}
+
+	events, err := h.EventService.GetUserUpcomingEvents(user)
+	if err != nil {
+		handleError(w, err, http.StatusBadRequest)
+		return
+	}
+
+	handleSuccess(w, events, "", http.StatusOK)
+}
+
+// GetUserPastEvents godoc
+// @Summary      Get user past events
+// @Description  Returns the events the authenticated user is registered to that already ended, most recent first
+// @Tags         events
+// @Produce      json
+// @Security     Bearer
+// @Param        Authorization header string true "Bearer {access_token}"
+// @Param        Refresh header string true "Bearer {refresh_token}"
+// @Success      200  {object}  NoMessageSuccessResponse{data=[]models.Event}
+// @Failure      400  {object}  EventStandardErrorResponse
+// @Failure      401  {object}  EventStandardErrorResponse
+// @Router       /user-events/past [get]
+func (h *EventHandler) GetUserPastEvents(w http.ResponseWriter, r *http.Request) {
+	user, err := getUserFromContext(h.EventService.GetUserByID, r)
+	if err != nil {
+		handleError(w, err, http.StatusBadRequest)
+		return
+	}
+
+	events, err := h.EventService.GetUserPastEvents(user)
+	if err != nil {
+		handleError(w, err, http.StatusBadRequest)
+		return
+	}
+
+	handleSuccess(w, events, "", http.StatusOK)
+}
+
+// GetUserUnregisteredAccessEvents godoc
+// @Summary      Get events the user has access to but isn't registered to
+// @Description  Returns the events the authenticated user holds products, tokens or product access for without being
+// @Description  registered to them, so they can register and use what they own
+// @Tags         events
+// @Produce      json
+// @Security     Bearer
+// @Param        Authorization header string true "Bearer {access_token}"
+// @Param        Refresh header string true "Bearer {refresh_token}"
+// @Success      200  {object}  NoMessageSuccessResponse{data=[]models.Event}
+// @Failure      400  {object}  EventStandardErrorResponse
+// @Failure      401  {object}  EventStandardErrorResponse
+// @Router       /user-unregistered-access [get]
+func (h *EventHandler) GetUserUnregisteredAccessEvents(w http.ResponseWriter, r *http.Request) {
+	user, err := getUserFromContext(h.EventService.GetUserByID, r)
+	if err != nil {
+		handleError(w, err, http.StatusBadRequest)
+		return
+	}
+
+	events, err := h.EventService.GetUserUnregisteredAccessEvents(user)
+	if err != nil {
+		handleError(w, err, http.StatusBadRequest)
+		return
+	}
+
+	handleSuccess(w, events, "", http.StatusOK)
+}
+
+// GetEventAttendees godoc
+// @Summary      Get the event attendees
+// @Description  Returns the users registered to the event (admins only). Set paid=true to keep only the ones owning a ticket product
+// @Tags         events
+// @Produce      json
+// @Security     Bearer
+// @Param        Authorization header string true "Bearer {access_token}"
+// @Param        Refresh header string true "Bearer {refresh_token}"
+// @Param        slug path string true "Event slug"
+// @Param        paid query bool false "Only attendees owning a ticket"
+// @Success      200  {object}  NoMessageSuccessResponse{data=[]models.EventAttendee}
+// @Failure      400  {object}  EventStandardErrorResponse
+// @Failure      401  {object}  EventStandardErrorResponse
+// @Failure      403  {object}  EventStandardErrorResponse
+// @Failure      404  {object}  EventStandardErrorResponse
+// @Router       /events/{slug}/attendees [get]
+func (h *EventHandler) GetEventAttendees(w http.ResponseWriter, r *http.Request) {
+	slug, err := extractSlugAndValidate(r)
+	if err != nil {
+		handleError(w, err, http.StatusBadRequest)
+		return
+	}
+
+	paidOnly := false
+	if raw := r.URL.Query().Get("paid"); raw != "" {
+		paidOnly, err = strconv.ParseBool(raw)
+		if err != nil {
+			handleError(w, errors.New("paid must be true or false"), http.StatusBadRequest)
+			return
+		}
+	}
+
+	admin, err := getUserFromContext(h.EventService.GetUserByID, r)
+	if err != nil {
+		handleError(w, err, http.StatusBadRequest)
+		return
+	}
+
+	attendees, err := h.EventService.GetEventAttendees(admin, slug, paidOnly)
+	if err != nil {
+		if strings.Contains(err.Error(), "unauthorized") {
+			handleError(w, err, http.StatusForbidden)
+		} else if strings.Contains(err.Error(), "not found") {
+			handleError(w, err, http.StatusNotFound)
+		} else {
+			handleError(w, errors.New("error getting event attendees: "+err.Error()), http.StatusBadRequest)
+		}
+		return
+	}
+
+	handleSuccess(w, attendees, "", http.StatusOK)
+}
+
+// GetUnpaidRegistrants godoc
+// @Summary      Get registrants without a ticket
+// @Description  Returns the users registered to the event that don't own any of its ticket products (admins only).
+// @Description  Use format=csv to download the list as a CSV file
+// @Tags         events
+// @Produce      json
+// @Produce      text/csv
+// @Security     Bearer
+// @Param        Authorization header string true "Bearer {access_token}"
+// @Param        Refresh header string true "Bearer {refresh_token}"
+// @Param        slug path string true "Event slug"
+// @Param        format query string false "Set to csv to export as CSV"
+// @Success      200  {object}  NoMessageSuccessResponse{data=[]models.UnpaidRegistrant}
+// @Failure      400  {object}  EventStandardErrorResponse
+// @Failure      401  {object}  EventStandardErrorResponse
+// @Failure      403  {object}  EventStandardErrorResponse
+// @Router       /events/{slug}/unpaid-registrants [get]
+func (h *EventHandler) GetUnpaidRegistrants(w http.ResponseWriter, r *http.Request) {
+	slug, err := extractSlugAndValidate(r)
+	if err != nil {
+		handleError(w, err, http.StatusBadRequest)
+		return
+	}
+
+	user, err := getUserFromContext(h.EventService.GetUserByID, r)
+	if err != nil {
+		handleError(w, err, http.StatusBadRequest)
+		return
+	}
+
+	registrants, err := h.EventService.GetUnpaidRegistrants(user, slug)
+	if err != nil {
+		if strings.Contains(err.Error(), "unauthorized") {
+			handleError(w, err, http.StatusForbidden)
+		} else {
+			handleError(w, errors.New("error getting unpaid registrants: "+err.Error()), http.StatusBadRequest)
+		}
+		return
+	}
+
+	if wantsCSV(r) {
+		rows := make([][]string, 0, len(registrants))
+		for _, registrant := range registrants {
+			rows = append(rows, []string{
+				registrant.UserID,
+				registrant.Name,
+				registrant.LastName,
+				registrant.Email,
+				registrant.RegisteredAt.Format(time.RFC3339),
+			})
+		}
+		header := []string{"user_id", "name", "last_name", "email", "registered_at"}
+		if err := writeCSV(w, slug+"-unpaid-registrants.csv", header, rows); err != nil {
+			log.Printf("Failed to write unpaid registrants CSV for %s: %v", slug, err)
+		}
+		return
+	}
+
+	handleSuccess(w, registrants, "", http.StatusOK)
+}
+
+// PreviewRegistrationEmail godoc
+// @Summary      Preview the registration email
+// @Description  Renders the event registration email with the requesting admin's data and a sample QR code without sending it,
+// @Description  so template errors show up before a real registrant gets a broken email (admins only)
+// @Tags         events
+// @Produce      html
+// @Security     Bearer
+// @Param        Authorization header string true "Bearer {access_token}"
+// @Param        Refresh header string true "Bearer {refresh_token}"
+// @Param        slug path string true "Event slug"
+// @Success      200  {string}  string "Rendered email HTML"
+// @Failure      400  {object}  EventStandardErrorResponse
+// @Failure      401  {object}  EventStandardErrorResponse
+// @Failure      403  {object}  EventStandardErrorResponse
+// @Failure      500  {object}  EventStandardErrorResponse
+// @Router       /events/{slug}/registration-email/preview [get]
+func (h *EventHandler) PreviewRegistrationEmail(w http.ResponseWriter, r *http.Request) {
+	slug, err := extractSlugAndValidate(r)
+	if err != nil {
+		handleError(w, err, http.StatusBadRequest)
+		return
+	}
+
+	user, err := getUserFromContext(h.EventService.GetUserByID, r)
+	if err != nil {
+		handleError(w, err, http.StatusBadRequest)
+		return
+	}
+
+	body, err := h.EventService.PreviewRegistrationEmail(user, slug)
+	if err != nil {
+		if strings.Contains(err.Error(), "unauthorized") {
+			handleError(w, err, http.StatusForbidden)
+		} else if strings.Contains(err.Error(), "template") {
+			handleError(w, errors.New("error rendering registration email: "+err.Error()), http.StatusInternalServerError)
+		} else {
+			handleError(w, errors.New("error previewing registration email: "+err.Error()), http.StatusBadRequest)
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(http.StatusOK)
+	if _, err := w.Write([]byte(body)); err != nil {
+		log.Printf("Failed to write registration email preview for %s: %v", slug, err)
+	}
+}
+
+// GetUserBadge godoc
+// @Summary      Get the user's event badge
+// @Description  Renders a printable SVG name badge for the authenticated user with their name, the event name and the QR code used at check-in.
+// @Description  The user must be registered to the event
+// @Tags         events
+// @Produce      image/svg+xml
+// @Security     Bearer
+// @Param        Authorization header string true "Bearer {access_token}"
+// @Param        Refresh header string true "Bearer {refresh_token}"
+// @Param        slug path string true "Event slug"
+// @Param        size query string false "small (A7), medium (A6) or large (A5), defaults to medium"
+// @Success      200  {string}  string "SVG badge"
+// @Failure      400  {object}  EventStandardErrorResponse
+// @Failure      401  {object}  EventStandardErrorResponse
+// @Failure      403  {object}  EventStandardErrorResponse
+// @Failure      404  {object}  EventStandardErrorResponse
+// @Failure      500  {object}  EventStandardErrorResponse
+// @Router       /events/{slug}/badge [get]
+func (h *EventHandler) GetUserBadge(w http.ResponseWriter, r *http.Request) {
+	slug, err := extractSlugAndValidate(r)
+	if err != nil {
+		handleError(w, err, http.StatusBadRequest)
+		return
+	}
+
+	user, err := getUserFromContext(h.EventService.GetUserByID, r)
+	if err != nil {
+		handleError(w, err, http.StatusBadRequest)
+		return
+	}
+
+	badge, err := h.EventService.GetUserBadge(user, slug, r.URL.Query().Get("size"))
+	writeBadge(w, slug, user.ID, badge, err)
+}
+
+// GetRegistrantBadge godoc
+// @Summary      Get a registrant's event badge
+// @Description  Renders the printable SVG name badge of any user registered to the event, for reprints at the desk (admins only)
+// @Tags         events
+// @Produce      image/svg+xml
+// @Security     Bearer
+// @Param        Authorization header string true "Bearer {access_token}"
+// @Param        Refresh header string true "Bearer {refresh_token}"
+// @Param        slug path string true "Event slug"
+// @Param        user_id path string true "Registrant user ID"
+// @Param        size query string false "small (A7), medium (A6) or large (A5), defaults to medium"
+// @Success      200  {string}  string "SVG badge"
+// @Failure      400  {object}  EventStandardErrorResponse
+// @Failure      401  {object}  EventStandardErrorResponse
+// @Failure      403  {object}  EventStandardErrorResponse
+// @Failure      404  {object}  EventStandardErrorResponse
+// @Failure      500  {object}  EventStandardErrorResponse
+// @Router       /events/{slug}/badge/{user_id} [get]
+func (h *EventHandler) GetRegistrantBadge(w http.ResponseWriter, r *http.Request) {
+	slug, err := extractSlugAndValidate(r)
+	if err != nil {
+		handleError(w, err, http.StatusBadRequest)
+		return
+	}
+
+	userID := r.PathValue("user_id")
+	if userID == "" {
+		handleError(w, errors.New("user id is required"), http.StatusBadRequest)
+		return
+	}
+
+	admin, err := getUserFromContext(h.EventService.GetUserByID, r)
+	if err != nil {
+		handleError(w, err, http.StatusBadRequest)
+		return
+	}
+
+	badge, err := h.EventService.GetRegistrantBadge(admin, slug, userID, r.URL.Query().Get("size"))
+	writeBadge(w, slug, userID, badge, err)
+}
+
+func writeBadge(w http.ResponseWriter, slug, userID string, badge []byte, err error) {
+	if err != nil {
+		if strings.Contains(err.Error(), "unauthorized") || strings.Contains(err.Error(), "not registered") {
+			handleError(w, err, http.StatusForbidden)
+		} else if strings.Contains(err.Error(), "not found") {
+			handleError(w, err, http.StatusNotFound)
+		} else if strings.Contains(err.Error(), "template") {
+			handleError(w, errors.New("error rendering badge: "+err.Error()), http.StatusInternalServerError)
+		} else {
+			handleError(w, errors.New("error getting badge: "+err.Error()), http.StatusBadRequest)
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", "image/svg+xml")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("inline; filename=%q", slug+"-badge.svg"))
+	w.WriteHeader(http.StatusOK)
+	if _, err := w.Write(badge); err != nil {
+		log.Printf("Failed to write badge of %s for %s: %v", userID, slug, err)
+	}
+}
+
+// ValidateEvent godoc
+// @Summary      Validate the event before publishing
+// @Description  Runs the preflight checks over the whole event configuration: activities outside the event dates, overlapping mandatory
+// @Description  activities, fee activities no product gives access to, products on sale after the event ends, double-booked rooms and a
+// @Description  missing ticket. Errors must be fixed before publishing, warnings are likely mistakes (admins only)
+// @Tags         events
+// @Produce      json
+// @Security     Bearer
+// @Param        Authorization header string true "Bearer {access_token}"
+// @Param        Refresh header string true "Bearer {refresh_token}"
+// @Param        slug path string true "Event slug"
+// @Success      200  {object}  NoMessageSuccessResponse{data=models.EventValidationReport}
+// @Failure      400  {object}  EventStandardErrorResponse
+// @Failure      401  {object}  EventStandardErrorResponse
+// @Failure      403  {object}  EventStandardErrorResponse
+// @Failure      404  {object}  EventStandardErrorResponse
+// @Router       /events/{slug}/validate [get]
+func (h *EventHandler) ValidateEvent(w http.ResponseWriter, r *http.Request) {
+	slug, err := extractSlugAndValidate(r)
+	if err != nil {
+		handleError(w, err, http.StatusBadRequest)
+		return
+	}
+
+	admin, err := getUserFromContext(h.EventService.GetUserByID, r)
+	if err != nil {
+		handleError(w, err, http.StatusBadRequest)
+		return
+	}
+
+	report, err := h.EventService.ValidateEvent(admin, slug)
+	if err != nil {
+		if strings.Contains(err.Error(), "unauthorized") {
+			handleError(w, err, http.StatusForbidden)
+		} else if strings.Contains(err.Error(), "not found") {
+			handleError(w, err, http.StatusNotFound)
+		} else {
+			handleError(w, errors.New("error validating event: "+err.Error()), http.StatusBadRequest)
+		}
+		return
+	}
+
+	handleSuccess(w, report, "", http.StatusOK)
+}
+
+// GetAttendanceManifest godoc
+// @Summary      Download the signed attendance manifest
+// @Description  Returns every attendance record of the event with the event metadata and the generation time, for trusted systems that import it.
+// @Description  The x-signature header is "ts=<unix>,v1=<hex>", where v1 is the HMAC-SHA256 with the shared manifest secret of
+// @Description  "ts:<unix>;sha256:<hex sha256 of the body>;" (admins only)
+// @Tags         events
+// @Produce      json
+// @Security     Bearer
+// @Param        Authorization header string true "Bearer {access_token}"
+// @Param        Refresh header string true "Bearer {refresh_token}"
+// @Param        slug path string true "Event slug"
+// @Success      200  {object}  models.AttendanceManifest
+// @Header       200  {string}  x-signature "ts=<unix>,v1=<hex hmac>"
+// @Failure      400  {object}  EventStandardErrorResponse
+// @Failure      401  {object}  EventStandardErrorResponse
+// @Failure      403  {object}  EventStandardErrorResponse
+// @Failure      404  {object}  EventStandardErrorResponse
+// @Failure      500  {object}  EventStandardErrorResponse
+// @Router       /events/{slug}/attendance/manifest [get]
+func (h *EventHandler) GetAttendanceManifest(w http.ResponseWriter, r *http.Request) {
+	slug, err := extractSlugAndValidate(r)
+	if err != nil {
+		handleError(w, err, http.StatusBadRequest)
+		return
+	}
+
+	admin, err := getUserFromContext(h.EventService.GetUserByID, r)
+	if err != nil {
+		handleError(w, err, http.StatusBadRequest)
+		return
+	}
+
+	manifest, signature, err := h.EventService.GetAttendanceManifest(admin, slug)
+	if err != nil {
+		if strings.Contains(err.Error(), "unauthorized") {
+			handleError(w, err, http.StatusForbidden)
+		} else if strings.Contains(err.Error(), "not found") {
+			handleError(w, err, http.StatusNotFound)
+		} else if strings.Contains(err.Error(), "not configured") {
+			handleError(w, err, http.StatusInternalServerError)
+		} else {
+			handleError(w, errors.New("error getting attendance manifest: "+err.Error()), http.StatusBadRequest)
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", slug+"-attendance.json"))
+	w.Header().Set("x-signature", signature)
+	w.WriteHeader(http.StatusOK)
+	if _, err := w.Write(manifest); err != nil {
+		log.Printf("Failed to write attendance manifest for %s: %v", slug, err)
+	}
+}
+
+// ExportAttendances godoc
+// @Summary      Export the event attendances as CSV
+// @Description  Streams every attendance of the event as a CSV with the user name, email, activity name, attendance time and access method (admins only)
+// @Tags         events
+// @Produce      text/csv
+// @Security     Bearer
+// @Param        Authorization header string true "Bearer {access_token}"
+// @Param        Refresh header string true "Bearer {refresh_token}"
+// @Param        slug path string true "Event slug"
+// @Success      200  {string}  string "Attendances CSV"
+// @Failure      400  {object}  EventStandardErrorResponse
+// @Failure      401  {object}  EventStandardErrorResponse
+// @Failure      403  {object}  EventStandardErrorResponse
+// @Failure      404  {object}  EventStandardErrorResponse
+// @Router       /events/{slug}/attendances.csv [get]
+func (h *EventHandler) ExportAttendances(w http.ResponseWriter, r *http.Request) {
+	slug, err := extractSlugAndValidate(r)
+	if err != nil {
+		handleError(w, err, http.StatusBadRequest)
+		return
+	}
+
+	admin, err := getUserFromContext(h.EventService.GetUserByID, r)
+	if err != nil {
+		handleError(w, err, http.StatusBadRequest)
+		return
+	}
+
+	header := []string{"name", "email", "activity_name", "attended_at", "access_method"}
+	stream := newCSVStream(w, slug+"-attendances.csv", header)
+
+	err = h.EventService.ExportAttendances(admin, slug, func(row models.AttendanceExportRow) error {
+		return stream.Write([]string{
+			strings.TrimSpace(row.Name + " " + row.LastName),
+			row.Email,
+			row.ActivityName,
+			row.AttendedAt.Format(time.RFC3339),
+			row.AccessMethod,
+		})
+	})
+	if err != nil {
+		if stream.Started() {
+			log.Printf("Failed to stream attendances CSV for %s: %v", slug, err)
+			return
+		}
+		if strings.Contains(err.Error(), "unauthorized") {
+			handleError(w, err, http.StatusForbidden)
+		} else if strings.Contains(err.Error(), "not found") {
+			handleError(w, err, http.StatusNotFound)
+		} else {
+			handleError(w, errors.New("error exporting attendances: "+err.Error()), http.StatusBadRequest)
+		}
+		return
+	}
+
+	if err := stream.Close(); err != nil {
+		log.Printf("Failed to write attendances CSV for %s: %v", slug, err)
+	}
+}
+
+// GetTicketAvailability godoc
+// @Summary      Get event ticket availability
+// @Description  Public view of the remaining stock and sold count of the event tickets, remaining is -1 when a ticket has unlimited stock
+// @Tags         events
+// @Produce      json
+// @Param        slug path string true "Event slug"
+// @Success      200  {object}  NoMessageSuccessResponse{data=models.TicketAvailability}
+// @Failure      400  {object}  EventStandardErrorResponse
+// @Failure      404  {object}  EventStandardErrorResponse
+// @Router       /events/{slug}/ticket-availability [get]
+func (h *EventHandler) GetTicketAvailability(w http.ResponseWriter, r *http.Request) {
+	slug, err := extractSlugAndValidate(r)
+	if err != nil {
+		handleError(w, err, http.StatusBadRequest)
+		return
+	}
+
+	availability, err := h.EventService.GetTicketAvailability(slug)
+	if err != nil {
+		if strings.Contains(err.Error(), "event not found") {
+			handleError(w, err, http.StatusNotFound)
+		} else {
+			handleError(w, errors.New("error getting ticket availability: "+err.Error()), http.StatusBadRequest)
+		}
+		return
+	}
+
+	handleSuccess(w, availability, "", http.StatusOK)
+}
+
+// GetEventOccupancy godoc
+// @Summary      Get event occupancy over time
+// @Description  Returns the peak number of registered users simultaneously in sessions and a timeline of concurrent counts (admins only)
+// @Tags         events
+// @Produce      json
+// @Security     Bearer
+// @Param        Authorization header string true "Bearer {access_token}"
+// @Param        Refresh header string true "Bearer {refresh_token}"
+// @Param        slug path string true "Event slug"
+// @Success      200  {object}  NoMessageSuccessResponse{data=models.EventOccupancy}
+// @Failure      400  {object}  EventStandardErrorResponse
+// @Failure      401  {object}  EventStandardErrorResponse
+// @Failure      403  {object}  EventStandardErrorResponse
+// @Router       /events/{slug}/occupancy [get]
+func (h *EventHandler) GetEventOccupancy(w http.ResponseWriter, r *http.Request) {
+	slug, err := extractSlugAndValidate(r)
+	if err != nil {
+		handleError(w, err, http.StatusBadRequest)
+		return
+	}
+
+	user, err := getUserFromContext(h.EventService.GetUserByID, r)
+	if err != nil {
+		handleError(w, err, http.StatusBadRequest)
+		return
+	}
+
+	occupancy, err := h.EventService.GetEventOccupancy(user, slug)
+	if err != nil {
+		if strings.Contains(err.Error(), "unauthorized") {
+			handleError(w, err, http.StatusForbidden)
+		} else {
+			handleError(w, errors.New("error getting event occupancy: "+err.Error()), http.StatusBadRequest)
+		}
+		return
+	}
+
+	handleSuccess(w, occupancy, "", http.StatusOK)
+}
+
+// GetEventFunnel godoc
+// @Summary      Get the event conversion funnel
+// @Description  Counts the event registrants, the ones owning a ticket and the ones that attended at least one activity, with the
+// @Description  percentage of the registrations at each stage. Page views aren't tracked, so the funnel starts at registration (admins only)
+// @Tags         events
+// @Produce      json
+// @Security     Bearer
+// @Param        Authorization header string true "Bearer {access_token}"
+// @Param        Refresh header string true "Bearer {refresh_token}"
+// @Param        slug path string true "Event slug"
+// @Success      200  {object}  NoMessageSuccessResponse{data=models.EventFunnel}
+// @Failure      400  {object}  EventStandardErrorResponse
+// @Failure      401  {object}  EventStandardErrorResponse
+// @Failure      403  {object}  EventStandardErrorResponse
+// @Failure      404  {object}  EventStandardErrorResponse
+// @Router       /events/{slug}/funnel [get]
+func (h *EventHandler) GetEventFunnel(w http.ResponseWriter, r *http.Request) {
+	slug, err := extractSlugAndValidate(r)
+	if err != nil {
+		handleError(w, err, http.StatusBadRequest)
+		return
+	}
+
+	user, err := getUserFromContext(h.EventService.GetUserByID, r)
+	if err != nil {
+		handleError(w, err, http.StatusBadRequest)
+		return
+	}
+
+	funnel, err := h.EventService.GetEventFunnel(user, slug)
+	if err != nil {
+		if strings.Contains(err.Error(), "unauthorized") {
+			handleError(w, err, http.StatusForbidden)
+		} else if strings.Contains(err.Error(), "not found") {
+			handleError(w, err, http.StatusNotFound)
+		} else {
+			handleError(w, errors.New("error getting event funnel: "+err.Error()), http.StatusBadRequest)
+		}
+		return
+	}
+
+	handleSuccess(w, funnel, "", http.StatusOK)
+}
+
+// GetNoShowRates godoc
+// @Summary      Get no-show rates per activity
+// @Description  Returns, for each ended activity of the event, the registered and attended counts and the no-show percentage, worst first (admins only)
+// @Tags         events
+// @Produce      json
+// @Security     Bearer
+// @Param        Authorization header string true "Bearer {access_token}"
+// @Param        Refresh header string true "Bearer {refresh_token}"
+// @Param        slug path string true "Event slug"
+// @Success      200  {object}  NoMessageSuccessResponse{data=[]models.ActivityNoShowRate}
+// @Failure      400  {object}  EventStandardErrorResponse
+// @Failure      401  {object}  EventStandardErrorResponse
+// @Failure      403  {object}  EventStandardErrorResponse
+// @Router       /events/{slug}/no-show-rates [get]
+func (h *EventHandler) GetNoShowRates(w http.ResponseWriter, r *http.Request) {
+	slug, err := extractSlugAndValidate(r)
+	if err != nil {
+		handleError(w, err, http.StatusBadRequest)
+		return
+	}
+
+	user, err := getUserFromContext(h.EventService.GetUserByID, r)
+	if err != nil {
+		handleError(w, err, http.StatusBadRequest)
+		return
+	}
+
+	rates, err := h.EventService.GetNoShowRates(user, slug)
+	if err != nil {
+		if strings.Contains(err.Error(), "unauthorized") {
+			handleError(w, err, http.StatusForbidden)
+		} else {
+			handleError(w, errors.New("error getting no-show rates: "+err.Error()), http.StatusBadRequest)
+		}
+		return
+	}
+
+	handleSuccess(w, rates, "", http.StatusOK)
+}
+
+// GetRegistrationStatus godoc
+// @Summary      Get the user's registration status
+// @Description  Tells whether the authenticated user is registered to the event, if the confirmation email was sent (or why it failed) and if the user checked in
+// @Tags         events
+// @Produce      json
+// @Security     Bearer
+// @Param        Authorization header string true "Bearer {access_token}"
+// @Param        Refresh header string true "Bearer {refresh_token}"
+// @Param        slug path string true "Event slug"
+// @Success      200  {object}  NoMessageSuccessResponse{data=models.RegistrationStatus}
+// @Failure      400  {object}  EventStandardErrorResponse
+// @Failure      401  {object}  EventStandardErrorResponse
+// @Failure      404  {object}  EventStandardErrorResponse
+// @Router       /events/{slug}/registration-status [get]
+func (h *EventHandler) GetRegistrationStatus(w http.ResponseWriter, r *http.Request) {
+	slug, err := extractSlugAndValidate(r)
+	if err != nil {
+		handleError(w, err, http.StatusBadRequest)
+		return
+	}
+
+	user, err := getUserFromContext(h.EventService.GetUserByID, r)
+	if err != nil {
+		handleError(w, err, http.StatusBadRequest)
+		return
+	}
+
+	status, err := h.EventService.GetRegistrationStatus(user, slug)
+	if err != nil {
+		if strings.Contains(err.Error(), "event not found") {
+			handleError(w, err, http.StatusNotFound)
+		} else {
+			handleError(w, errors.New("error getting registration status: "+err.Error()), http.StatusBadRequest)
+		}
+		return
+	}
+
+	handleSuccess(w, status, "", http.StatusOK)
+}
+
+// UpdateRegistrationDetails godoc
+// @Summary      Set the user's dietary and accessibility notes
+// @Description  Saves the dietary restrictions and accessibility needs of the authenticated user for an event they are registered to.
+// @Description  Only the fields sent are changed, only the user and the event admins can read them
+// @Tags         events
+// @Accept       json
+// @Produce      json
+// @Security     Bearer
+// @Param        Authorization header string true "Bearer {access_token}"
+// @Param        Refresh header string true "Bearer {refresh_token}"
+// @Param        slug path string true "Event slug"
+// @Param        request body models.RegistrationDetailsRequest true "Registration notes"
+// @Success      200  {object}  NoMessageSuccessResponse{data=models.EventRegistrationDetails}
+// @Failure      400  {object}  EventStandardErrorResponse
+// @Failure      401  {object}  EventStandardErrorResponse
+// @Failure      403  {object}  EventStandardErrorResponse
+// @Failure      404  {object}  EventStandardErrorResponse
+// @Router       /events/{slug}/registration-details [patch]
+func (h *EventHandler) UpdateRegistrationDetails(w http.ResponseWriter, r *http.Request) {
+	slug, err := extractSlugAndValidate(r)
+	if err != nil {
+		handleError(w, err, http.StatusBadRequest)
+		return
+	}
+
+	var reqBody models.RegistrationDetailsRequest
+	if err := decodeRequestBody(r, &reqBody); err != nil {
+		handleError(w, err, http.StatusBadRequest)
+		return
+	}
+
+	user, err := getUserFromContext(h.EventService.GetUserByID, r)
+	if err != nil {
+		handleError(w, err, http.StatusBadRequest)
+		return
+	}
+
+	details, err := h.EventService.UpdateRegistrationDetails(user, slug, reqBody)
+	if err != nil {
+		switch {
+		case strings.Contains(err.Error(), "event not found"):
+			handleError(w, err, http.StatusNotFound)
+		case strings.Contains(err.Error(), "not registered"):
+			handleError(w, err, http.StatusForbidden)
+		default:
+			handleError(w, errors.New("error saving registration details: "+err.Error()), http.StatusBadRequest)
+		}
+		return
+	}
+
+	handleSuccess(w, details, "", http.StatusOK)
+}
+
+// GetRegistrationDetails godoc
+// @Summary      Get the user's dietary and accessibility notes
+// @Description  Returns the notes the authenticated user gave for the event, empty when none were given
+// @Tags         events
+// @Produce      json
+// @Security     Bearer
+// @Param        Authorization header string true "Bearer {access_token}"
+// @Param        Refresh header string true "Bearer {refresh_token}"
+// @Param        slug path string true "Event slug"
+// @Success      200  {object}  NoMessageSuccessResponse{data=models.EventRegistrationDetails}
+// @Failure      400  {object}  EventStandardErrorResponse
+// @Failure      401  {object}  EventStandardErrorResponse
+// @Failure      404  {object}  EventStandardErrorResponse
+// @Router       /events/{slug}/registration-details [get]
+func (h *EventHandler) GetRegistrationDetails(w http.ResponseWriter, r *http.Request) {
+	slug, err := extractSlugAndValidate(r)
+	if err != nil {
+		handleError(w, err, http.StatusBadRequest)
+		return
+	}
+
+	user, err := getUserFromContext(h.EventService.GetUserByID, r)
+	if err != nil {
+		handleError(w, err, http.StatusBadRequest)
+		return
+	}
+
+	details, err := h.EventService.GetRegistrationDetails(user, slug)
+	if err != nil {
+		if strings.Contains(err.Error(), "event not found") {
+			handleError(w, err, http.StatusNotFound)
+		} else {
+			handleError(w, errors.New("error getting registration details: "+err.Error()), http.StatusBadRequest)
+		}
+		return
+	}
+
+	handleSuccess(w, details, "", http.StatusOK)
+}
+
+// GetRegistrationDetailsAggregate godoc
+// @Summary      Get the registrants dietary and accessibility needs
+// @Description  Groups the dietary restrictions and accessibility needs of the event registrants for catering and accommodations planning,
+// @Description  along with each registrant's notes (admins only)
+// @Tags         events
+// @Produce      json
+// @Security     Bearer
+// @Param        Authorization header string true "Bearer {access_token}"
+// @Param        Refresh header string true "Bearer {refresh_token}"
+// @Param        slug path string true "Event slug"
+// @Success      200  {object}  NoMessageSuccessResponse{data=models.RegistrationDetailsAggregate}
+// @Failure      400  {object}  EventStandardErrorResponse
+// @Failure      401  {object}  EventStandardErrorResponse
+// @Failure      403  {object}  EventStandardErrorResponse
+// @Router       /events/{slug}/registration-details/aggregate [get]
+func (h *EventHandler) GetRegistrationDetailsAggregate(w http.ResponseWriter, r *http.Request) {
+	slug, err := extractSlugAndValidate(r)
+	if err != nil {
+		handleError(w, err, http.StatusBadRequest)
+		return
+	}
+
+	user, err := getUserFromContext(h.EventService.GetUserByID, r)
+	if err != nil {
+		handleError(w, err, http.StatusBadRequest)
+		return
+	}
+
+	aggregate, err := h.EventService.GetRegistrationDetailsAggregate(user, slug)
+	if err != nil {
+		if strings.Contains(err.Error(), "unauthorized") {
+			handleError(w, err, http.StatusForbidden)
+		} else {
+			handleError(w, errors.New("error getting registration details: "+err.Error()), http.StatusBadRequest)
+		}
+		return
+	}
+
+	handleSuccess(w, aggregate, "", http.StatusOK)
+}
+
+// GetUserTimeline godoc
+// @Summary      Get the user's event timeline
+// @Description  Lists when the authenticated user registered to the event, checked in and attended each activity, oldest first
+// @Tags         events
+// @Produce      json
+// @Security     Bearer
+// @Param        Authorization header string true "Bearer {access_token}"
+// @Param        Refresh header string true "Bearer {refresh_token}"
+// @Param        slug path string true "Event slug"
+// @Success      200  {object}  NoMessageSuccessResponse{data=[]models.TimelineEntry}
+// @Failure      400  {object}  EventStandardErrorResponse
+// @Failure      401  {object}  EventStandardErrorResponse
+// @Failure      403  {object}  EventStandardErrorResponse
+// @Failure      404  {object}  EventStandardErrorResponse
+// @Router       /events/{slug}/my-timeline [get]
+func (h *EventHandler) GetUserTimeline(w http.ResponseWriter, r *http.Request) {
+	slug, err := extractSlugAndValidate(r)
+	if err != nil {
+		handleError(w, err, http.StatusBadRequest)
+		return
+	}
+
+	user, err := getUserFromContext(h.EventService.GetUserByID, r)
+	if err != nil {
+		handleError(w, err, http.StatusBadRequest)
+		return
+	}
+
+	timeline, err := h.EventService.GetUserTimeline(user, slug)
+	if err != nil {
+		if strings.Contains(err.Error(), "not registered") {
+			handleError(w, err, http.StatusForbidden)
+		} else if strings.Contains(err.Error(), "not found") {
+			handleError(w, err, http.StatusNotFound)
+		} else {
+			handleError(w, errors.New("error getting timeline: "+err.Error()), http.StatusBadRequest)
+		}
+		return
+	}
+
+	handleSuccess(w, timeline, "", http.StatusOK)
+}
+
+// GetParticipationSummary godoc
+// @Summary      Get the user's participation summary
+// @Description  Returns the authenticated user's registration, ticket, activities, attendance, tokens and products for the event in one response
+// @Tags         events
+// @Produce      json
+// @Security     Bearer
+// @Param        Authorization header string true "Bearer {access_token}"
+// @Param        Refresh header string true "Bearer {refresh_token}"
+// @Param        slug path string true "Event slug"
+// @Success      200  {object}  NoMessageSuccessResponse{data=models.EventParticipationSummary}
+// @Failure      400  {object}  EventStandardErrorResponse
+// @Failure      401  {object}  EventStandardErrorResponse
+// @Failure      404  {object}  EventStandardErrorResponse
+// @Router       /events/{slug}/my-summary [get]
+func (h *EventHandler) GetParticipationSummary(w http.ResponseWriter, r *http.Request) {
+	slug, err := extractSlugAndValidate(r)
+	if err != nil {
+		handleError(w, err, http.StatusBadRequest)
+		return
+	}
+
+	user, err := getUserFromContext(h.EventService.GetUserByID, r)
+	if err != nil {
+		handleError(w, err, http.StatusBadRequest)
+		return
+	}
+
+	summary, err := h.EventService.GetParticipationSummary(user, slug)
+	if err != nil {
+		if strings.Contains(err.Error(), "event not found") {
+			handleError(w, err, http.StatusNotFound)
+		} else {
+			handleError(w, errors.New("error getting participation summary: "+err.Error()), http.StatusBadRequest)
+		}
+		return
+	}
+
+	handleSuccess(w, summary, "", http.StatusOK)
+}
+
+// IssueCertificate godoc
+// @Summary      Issue the user's event certificate
+// @Description  Issues the authenticated user's participation certificate for the event, with the hours of the attended activities.
+// @Description  Issuing again returns the same certificate. The code and verification URL are meant to be printed on the document
+// @Tags         events
+// @Produce      json
+// @Security     Bearer
+// @Param        Authorization header string true "Bearer {access_token}"
+// @Param        Refresh header string true "Bearer {refresh_token}"
+// @Param        slug path string true "Event slug"
+// @Success      200  {object}  NoMessageSuccessResponse{data=models.Certificate}
+// @Failure      400  {object}  EventStandardErrorResponse
+// @Failure      401  {object}  EventStandardErrorResponse
+// @Failure      403  {object}  EventStandardErrorResponse
+// @Failure      404  {object}  EventStandardErrorResponse
+// @Router       /events/{slug}/certificate [post]
+func (h *EventHandler) IssueCertificate(w http.ResponseWriter, r *http.Request) {
+	slug, err := extractSlugAndValidate(r)
+	if err != nil {
+		handleError(w, err, http.StatusBadRequest)
+		return
+	}
+
+	user, err := getUserFromContext(h.EventService.GetUserByID, r)
+	if err != nil {
+		handleError(w, err, http.StatusBadRequest)
+		return
+	}
+
+	certificate, err := h.EventService.IssueCertificate(user, slug)
+	if err != nil {
+		if strings.Contains(err.Error(), "event not found") {
+			handleError(w, err, http.StatusNotFound)
+		} else if strings.Contains(err.Error(), "unauthorized") {
+			handleError(w, err, http.StatusForbidden)
+		} else {
+			handleError(w, errors.New("error issuing certificate: "+err.Error()), http.StatusBadRequest)
+		}
+		return
+	}
+
+	handleSuccess(w, certificate, "", http.StatusOK)
+}
+
+// VerifyCertificate godoc
+// @Summary      Verify a certificate
+// @Description  Public check of a certificate code, returns the holder, event, hours and issue date when the certificate is valid
+// @Tags         events
+// @Produce      json
+// @Param        code path string true "Certificate code"
+// @Success      200  {object}  NoMessageSuccessResponse{data=models.CertificateVerification}
+// @Failure      404  {object}  EventStandardErrorResponse
+// @Router       /certificates/verify/{code} [get]
+func (h *EventHandler) VerifyCertificate(w http.ResponseWriter, r *http.Request) {
+	verification, err := h.EventService.VerifyCertificate(r.PathValue("code"))
+	if err != nil {
+		handleError(w, err, http.StatusNotFound)
+		return
+	}
+
+	handleSuccess(w, verification, "", http.StatusOK)
+}
+
+// GetAdminEvents godoc
+// @Summary      List all events with stats
+// @Description  Lists every event of the platform, including hidden, blocked and deleted ones, with the creator, registration count and revenue.
+// @Description  Paginated and filterable by status. Only available to super users
+// @Tags         events
+// @Produce      json
+// @Security     Bearer
+// @Param        Authorization header string true "Bearer {access_token}"
+// @Param        Refresh header string true "Bearer {refresh_token}"
+// @Param        status query string false "active, hidden, blocked or deleted"
+// @Param        page query int false "Page, starting at 1"
+// @Param        page_size query int false "Page size, up to 100"
+// @Success      200  {object}  NoMessageSuccessResponse{data=models.AdminEventList}
+// @Failure      400  {object}  EventStandardErrorResponse
+// @Failure      401  {object}  EventStandardErrorResponse
+// @Failure      403  {object}  EventStandardErrorResponse
+// @Router       /admin/events [get]
+func (h *EventHandler) GetAdminEvents(w http.ResponseWriter, r *http.Request) {
+	page, pageSize, err := parsePagination(r)
+	if err != nil {
+		handleError(w, err, http.StatusBadRequest)
+		return
+	}
+
+	user, err := getUserFromContext(h.EventService.GetUserByID, r)
+	if err != nil {
+		handleError(w, err, http.StatusBadRequest)
+		return
+	}
+
+	events, err := h.EventService.GetAdminEvents(user, r.URL.Query().Get("status"), page, pageSize)
+	if err != nil {
+		if strings.Contains(err.Error(), "unauthorized") {
+			handleError(w, err, http.StatusForbidden)
+		} else {
+			handleError(w, errors.New("error getting events: "+err.Error()), http.StatusBadRequest)
+		}
+		return
+	}
+
+	handleSuccess(w, events, "", http.StatusOK)
+}
+
+// GetVenueConflicts godoc
+// @Summary      List events booked at a venue
+// @Description  Lists the events held at the venue, matched ignoring case, that overlap the given period so creators don't
+// @Description  double-book a physical space. Only available to super users and event creators
+// @Tags         events
+// @Produce      json
+// @Security     Bearer
+// @Param        Authorization header string true "Bearer {access_token}"
+// @Param        Refresh header string true "Bearer {refresh_token}"
+// @Param        venue path string true "Venue name"
+// @Param        from query string true "Period start, RFC3339" example(2025-05-01T00:00:00Z)
+// @Param        to query string true "Period end, RFC3339" example(2025-05-03T23:59:59Z)
+// @Success      200  {object}  NoMessageSuccessResponse{data=[]models.VenueConflict}
+// @Failure      400  {object}  EventStandardErrorResponse
+// @Failure      401  {object}  EventStandardErrorResponse
+// @Failure      403  {object}  EventStandardErrorResponse
+// @Router       /venues/{venue}/conflicts [get]
+func (h *EventHandler) GetVenueConflicts(w http.ResponseWriter, r *http.Request) {
+	from, err := time.Parse(time.RFC3339, r.URL.Query().Get("from"))
+	if err != nil {
+		handleError(w, errors.New("from must be an RFC3339 date"), http.StatusBadRequest)
+		return
+	}
+	to, err := time.Parse(time.RFC3339, r.URL.Query().Get("to"))
+	if err != nil {
+		handleError(w, errors.New("to must be an RFC3339 date"), http.StatusBadRequest)
+		return
+	}
+
+	user, err := getUserFromContext(h.EventService.GetUserByID, r)
+	if err != nil {
+		handleError(w, err, http.StatusBadRequest)
+		return
+	}
+
+	conflicts, err := h.EventService.GetVenueConflicts(user, r.PathValue("venue"), from, to)
+	if err != nil {
+		if strings.Contains(err.Error(), "unauthorized") {
+			handleError(w, err, http.StatusForbidden)
+		} else {
+			handleError(w, errors.New("error getting venue conflicts: "+err.Error()), http.StatusBadRequest)
+		}
+		return
+	}
+
+	handleSuccess(w, conflicts, "", http.StatusOK)
+}
+
+// ScanAttendee godoc
+// @Summary      Look up a scanned attendee
+// @Description  Takes the user ID decoded from a badge or registration email QR and returns the user's name, event registration,
+// @Description  owned products and tickets, check-in status and the activities they are registered to today, in a single lookup
+// @Description  for the door desk. Nothing is marked (admins only)
+// @Tags         events
+// @Accept       json
+// @Produce      json
+// @Security     Bearer
+// @Param        Authorization header string true "Bearer {access_token}"
+// @Param        Refresh header string true "Bearer {refresh_token}"
+// @Param        slug path string true "Event slug"
+// @Param        request body models.DoorScanRequest true "Scanned user"
+// @Success      200  {object}  NoMessageSuccessResponse{data=models.DoorScanResult}
+// @Failure      400  {object}  EventStandardErrorResponse
+// @Failure      401  {object}  EventStandardErrorResponse
+// @Failure      403  {object}  EventStandardErrorResponse
+// @Failure      404  {object}  EventStandardErrorResponse
+// @Router       /events/{slug}/scan [post]
+func (h *EventHandler) ScanAttendee(w http.ResponseWriter, r *http.Request) {
+	slug, err := extractSlugAndValidate(r)
+	if err != nil {
+		handleError(w, err, http.StatusBadRequest)
+		return
+	}
+
+	var reqBody models.DoorScanRequest
+	if err := decodeRequestBody(r, &reqBody); err != nil {
+		handleError(w, err, http.StatusBadRequest)
+		return
+	}
+
+	admin, err := getUserFromContext(h.EventService.GetUserByID, r)
+	if err != nil {
+		handleError(w, err, http.StatusBadRequest)
+		return
+	}
+
+	result, err := h.EventService.ScanAttendee(admin, slug, reqBody.UserID)
+	if err != nil {
+		if strings.Contains(err.Error(), "unauthorized") {
+			handleError(w, err, http.StatusForbidden)
+		} else if strings.Contains(err.Error(), "not found") {
+			handleError(w, err, http.StatusNotFound)
+		} else {
+			handleError(w, errors.New("error scanning attendee: "+err.Error()), http.StatusBadRequest)
+		}
+		return
+	}
+
+	handleSuccess(w, result, "", http.StatusOK)
+}
+
+// CreateAnnouncement godoc
+// @Summary      Post an event announcement
+// @Description  Adds an entry to the event announcements feed, pinned entries stay on top. Title is required, up to 150 characters (master admins only)
+// @Tags         events
+// @Accept       json
+// @Produce      json
+// @Security     Bearer
+// @Param        Authorization header string true "Bearer {access_token}"
+// @Param        Refresh header string true "Bearer {refresh_token}"
+// @Param        slug path string true "Event slug"
+// @Param        request body models.CreateAnnouncementRequest true "Announcement"
+// @Success      201  {object}  NoMessageSuccessResponse{data=models.EventAnnouncement}
+// @Failure      400  {object}  EventStandardErrorResponse
+// @Failure      401  {object}  EventStandardErrorResponse
+// @Failure      403  {object}  EventStandardErrorResponse
+// @Failure      404  {object}  EventStandardErrorResponse
+// @Router       /events/{slug}/announcements [post]
+func (h *EventHandler) CreateAnnouncement(w http.ResponseWriter, r *http.Request) {
+	slug, err := extractSlugAndValidate(r)
+	if err != nil {
+		handleError(w, err, http.StatusBadRequest)
+		return
+	}
+
+	var reqBody models.CreateAnnouncementRequest
+	if err := decodeRequestBody(r, &reqBody); err != nil {
+		handleError(w, err, http.StatusBadRequest)
+		return
+	}
+
+	admin, err := getUserFromContext(h.EventService.GetUserByID, r)
+	if err != nil {
+		handleError(w, err, http.StatusBadRequest)
+		return
+	}
+
+	announcement, err := h.EventService.CreateAnnouncement(admin, slug, reqBody)
+	if err != nil {
+		if strings.Contains(err.Error(), "unauthorized") {
+			handleError(w, err, http.StatusForbidden)
+		} else if strings.Contains(err.Error(), "not found") {
+			handleError(w, err, http.StatusNotFound)
+		} else {
+			handleError(w, errors.New("error creating announcement: "+err.Error()), http.StatusBadRequest)
+		}
+		return
+	}
+
+	handleSuccess(w, announcement, "", http.StatusCreated)
+}
+
+// GetAnnouncements godoc
+// @Summary      List event announcements
+// @Description  Lists the event announcements, pinned first and then the newest. Only registrants and event admins can read them
+// @Tags         events
+// @Produce      json
+// @Security     Bearer
+// @Param        Authorization header string true "Bearer {access_token}"
+// @Param        Refresh header string true "Bearer {refresh_token}"
+// @Param        slug path string true "Event slug"
+// @Param        page query int false "Page, starting at 1"
+// @Param        page_size query int false "Page size, up to 100"
+// @Success      200  {object}  NoMessageSuccessResponse{data=models.EventAnnouncementList}
+// @Failure      400  {object}  EventStandardErrorResponse
+// @Failure      401  {object}  EventStandardErrorResponse
+// @Failure      403  {object}  EventStandardErrorResponse
+// @Failure      404  {object}  EventStandardErrorResponse
+// @Router       /events/{slug}/announcements [get]
+func (h *EventHandler) GetAnnouncements(w http.ResponseWriter, r *http.Request) {
+	slug, err := extractSlugAndValidate(r)
+	if err != nil {
+		handleError(w, err, http.StatusBadRequest)
+		return
+	}
+
+	page, pageSize, err := parsePagination(r)
+	if err != nil {
+		handleError(w, err, http.StatusBadRequest)
+		return
+	}
+
+	user, err := getUserFromContext(h.EventService.GetUserByID, r)
+	if err != nil {
+		handleError(w, err, http.StatusBadRequest)
+		return
+	}
+
+	announcements, err := h.EventService.GetAnnouncements(user, slug, page, pageSize)
+	if err != nil {
+		if strings.Contains(err.Error(), "unauthorized") {
+			handleError(w, err, http.StatusForbidden)
+		} else if strings.Contains(err.Error(), "not found") {
+			handleError(w, err, http.StatusNotFound)
+		} else {
+			handleError(w, errors.New("error getting announcements: "+err.Error()), http.StatusBadRequest)
+		}
+		return
+	}
+
+	handleSuccess(w, announcements, "", http.StatusOK)
+}
+
+// DeleteAnnouncement godoc
+// @Summary      Delete an event announcement
+// @Description  Removes an entry from the event announcements feed (master admins only)
+// @Tags         events
+// @Produce      json
+// @Security     Bearer
+// @Param        Authorization header string true "Bearer {access_token}"
+// @Param        Refresh header string true "Bearer {refresh_token}"
+// @Param        slug path string true "Event slug"
+// @Param        id path string true "Announcement ID"
+// @Success      200  {object}  NoDataSuccessResponse
+// @Failure      400  {object}  EventStandardErrorResponse
+// @Failure      401  {object}  EventStandardErrorResponse
+// @Failure      403  {object}  EventStandardErrorResponse
+// @Failure      404  {object}  EventStandardErrorResponse
+// @Router       /events/{slug}/announcements/{id} [delete]
+func (h *EventHandler) DeleteAnnouncement(w http.ResponseWriter, r *http.Request) {
+	slug, err := extractSlugAndValidate(r)
+	if err != nil {
+		handleError(w, err, http.StatusBadRequest)
+		return
+	}
+
+	admin, err := getUserFromContext(h.EventService.GetUserByID, r)
+	if err != nil {
+		handleError(w, err, http.StatusBadRequest)
+		return
+	}
+
+	if err := h.EventService.DeleteAnnouncement(admin, slug, r.PathValue("id")); err != nil {
+		if strings.Contains(err.Error(), "unauthorized") {
+			handleError(w, err, http.StatusForbidden)
+		} else if strings.Contains(err.Error(), "not found") {
+			handleError(w, err, http.StatusNotFound)
+		} else {
+			handleError(w, errors.New("error deleting announcement: "+err.Error()), http.StatusBadRequest)
+		}
+		return
+	}
+
+	handleSuccess(w, nil, "announcement deleted", http.StatusOK)
+}
+
+// GetCancellationReasons godoc
+// @Summary      Get event cancellation reasons
+// @Description  Groups the reasons users gave when unregistering from the event, matched ignoring case, the most given first,
+// @Description  with the total of cancellations and how many gave no reason (admins only)
+// @Tags         events
+// @Produce      json
+// @Security     Bearer
+// @Param        Authorization header string true "Bearer {access_token}"
+// @Param        Refresh header string true "Bearer {refresh_token}"
+// @Param        slug path string true "Event slug"
+// @Success      200  {object}  NoMessageSuccessResponse{data=models.CancellationReasons}
+// @Failure      400  {object}  EventStandardErrorResponse
+// @Failure      401  {object}  EventStandardErrorResponse
+// @Failure      403  {object}  EventStandardErrorResponse
+// @Failure      404  {object}  EventStandardErrorResponse
+// @Router       /events/{slug}/cancellation-reasons [get]
+func (h *EventHandler) GetCancellationReasons(w http.ResponseWriter, r *http.Request) {
+	slug, err := extractSlugAndValidate(r)
+	if err != nil {
+		handleError(w, err, http.StatusBadRequest)
+		return
+	}
+
+	admin, err := getUserFromContext(h.EventService.GetUserByID, r)
+	if err != nil {
+		handleError(w, err, http.StatusBadRequest)
+		return
+	}
+
+	reasons, err := h.EventService.GetCancellationReasons(admin, slug)
+	if err != nil {
+		if strings.Contains(err.Error(), "unauthorized") {
+			handleError(w, err, http.StatusForbidden)
+		} else if strings.Contains(err.Error(), "not found") {
+			handleError(w, err, http.StatusNotFound)
+		} else {
+			handleError(w, errors.New("error getting cancellation reasons: "+err.Error()), http.StatusBadRequest)
+		}
+		return
+	}
+
+	handleSuccess(w, reasons, "", http.StatusOK)
+}
@@ -1,12 +1,21 @@
 package handlers
 
 import (
+	"encoding/csv"
 	"encoding/json"
 	"errors"
+	"io"
 	"net/http"
 	"scti/internal/models"
 	u "scti/internal/utilities"
+	"strconv"
 	"strings"
+	"time"
+)
+
+const (
+	defaultPageSize = 20
+	maxPageSize     = 100
 )
 
 // extractSlugAndValidate extracts slug from URL path and validates it's not empty
@@ -39,6 +48,14 @@ func decodeRequestBody(r *http.Request, target interface{}) error {
 	return nil
 }
 
+// decodeOptionalRequestBody is decodeRequestBody for endpoints that also accept no body at all
+func decodeOptionalRequestBody(r *http.Request, target interface{}) error {
+	if err := json.NewDecoder(r.Body).Decode(target); err != nil && !errors.Is(err, io.EOF) {
+		return errors.New("error parsing request body: " + err.Error())
+	}
+	return nil
+}
+
 // DEPRECATED: Use HandleErr instead
 // handleError sends a standardized error response using the fluent API
 func handleError(w http.ResponseWriter, err error, statusCode int) {
@@ -49,3 +66,105 @@ func handleError(w http.ResponseWriter, err error, statusCode int) {
 func handleSuccess(w http.ResponseWriter, data interface{}, message string, statusCode int) {
 	u.SendSuccess(w, data, message, statusCode)
 }
+
+// parsePagination reads the ?page= and ?page_size= query params, pages start at 1
+func parsePagination(r *http.Request) (int, int, error) {
+	page, pageSize := 1, defaultPageSize
+
+	if raw := r.URL.Query().Get("page"); raw != "" {
+		value, err := strconv.Atoi(raw)
+		if err != nil || value < 1 {
+			return 0, 0, errors.New("page must be a positive number")
+		}
+		page = value
+	}
+
+	if raw := r.URL.Query().Get("page_size"); raw != "" {
+		value, err := strconv.Atoi(raw)
+		if err != nil || value < 1 || value > maxPageSize {
+			return 0, 0, errors.New("page_size must be between 1 and " + strconv.Itoa(maxPageSize))
+		}
+		pageSize = value
+	}
+
+	return page, pageSize, nil
+}
+
+// parseDateParam reads a YYYY-MM-DD or RFC3339 query param, a plain date at the end of a
+// range covers the whole day
+func parseDateParam(raw string, endOfDay bool) (time.Time, error) {
+	if date, err := time.Parse(time.DateOnly, raw); err == nil {
+		if endOfDay {
+			return date.Add(24*time.Hour - time.Nanosecond), nil
+		}
+		return date, nil
+	}
+	return time.Parse(time.RFC3339, raw)
+}
+
+// wantsCSV reports whether the request asked for a CSV export through ?format=csv
+func wantsCSV(r *http.Request) bool {
+	return strings.EqualFold(r.URL.Query().Get("format"), "csv")
+}
+
+// writeCSV sends the rows as a CSV file download named filename
+func writeCSV(w http.ResponseWriter, filename string, header []string, rows [][]string) error {
+	w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+	w.Header().Set("Content-Disposition", `attachment; filename="`+filename+`"`)
+	w.WriteHeader(http.StatusOK)
+
+	writer := csv.NewWriter(w)
+	if err := writer.Write(header); err != nil {
+		return err
+	}
+	if err := writer.WriteAll(rows); err != nil {
+		return err
+	}
+	return writer.Error()
+}
+
+// csvStream writes a CSV download one record at a time. Nothing is sent before the first
+// record, so errors found until then can still be answered with a regular error response
+type csvStream struct {
+	w        http.ResponseWriter
+	writer   *csv.Writer
+	filename string
+	header   []string
+	started  bool
+}
+
+func newCSVStream(w http.ResponseWriter, filename string, header []string) *csvStream {
+	return &csvStream{w: w, writer: csv.NewWriter(w), filename: filename, header: header}
+}
+
+func (s *csvStream) start() error {
+	if s.started {
+		return nil
+	}
+	s.started = true
+	s.w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+	s.w.Header().Set("Content-Disposition", `attachment; filename="`+s.filename+`"`)
+	s.w.WriteHeader(http.StatusOK)
+	return s.writer.Write(s.header)
+}
+
+func (s *csvStream) Write(record []string) error {
+	if err := s.start(); err != nil {
+		return err
+	}
+	return s.writer.Write(record)
+}
+
+// Started reports whether the response was already committed to the CSV download
+func (s *csvStream) Started() bool {
+	return s.started
+}
+
+// Close sends the header when there were no records and flushes what's buffered
+func (s *csvStream) Close() error {
+	if err := s.start(); err != nil {
+		return err
+	}
+	s.writer.Flush()
+	return s.writer.Error()
+}
@@ -14,6 +14,7 @@ import (
 	"scti/internal/services"
 	"strconv"
 	"strings"
+	"time"
 )
 
 type ProductHandler struct {
@@ -119,7 +120,7 @@ func (h *ProductHandler) UpdateEventProduct(w http.ResponseWriter, r *http.Reque
 
 // DeleteEventProduct godoc
 // @Summary      Delete a product
-// @Description  Deletes an existing product from the specified event
+// @Description  Deletes an existing product from the specified event, products that were already purchased can't be deleted
 // @Tags         products
 // @Accept       json
 // @Produce      json
@@ -132,6 +133,7 @@ func (h *ProductHandler) UpdateEventProduct(w http.ResponseWriter, r *http.Reque
 // @Failure      400  {object}  ProductStandardErrorResponse
 // @Failure      401  {object}  ProductStandardErrorResponse
 // @Failure      403  {object}  ProductStandardErrorResponse
+// @Failure      409  {object}  ProductStandardErrorResponse
 // @Router       /events/{slug}/product [delete]
 func (h *ProductHandler) DeleteEventProduct(w http.ResponseWriter, r *http.Request) {
 	slug, err := extractSlugAndValidate(r)
@@ -158,7 +160,11 @@ func (h *ProductHandler) DeleteEventProduct(w http.ResponseWriter, r *http.Reque
 	}
 
 	if err := h.ProductService.DeleteEventProduct(user, slug, reqBody.ProductID); err != nil {
-		HandleErrMsg("error deleting product", err, w).Stack("product").BadRequest()
+		if strings.Contains(err.Error(), "has been purchased") {
+			ConflictError(w, err, "Product with existing purchases", "product")
+		} else {
+			HandleErrMsg("error deleting product", err, w).Stack("product").BadRequest()
+		}
 		return
 	}
 
@@ -208,6 +214,9 @@ func (h *ProductHandler) GetAllProductsFromEvent(w http.ResponseWriter, r *http.
 // @Success      200  {object}  NoMessageSuccessResponse{data=models.Purchase}
 // @Failure      400  {object}  ProductStandardErrorResponse
 // @Failure      401  {object}  ProductStandardErrorResponse
+// @Failure      403  {object}  ProductStandardErrorResponse
+// @Failure      409  {object}  ProductStandardErrorResponse
+// @Failure      429  {object}  ProductStandardErrorResponse
 // @Router       /events/{slug}/purchase [post]
 func (h *ProductHandler) PurchaseProducts(w http.ResponseWriter, r *http.Request) {
 	slug, err := extractSlugAndValidate(r)
@@ -230,13 +239,121 @@ func (h *ProductHandler) PurchaseProducts(w http.ResponseWriter, r *http.Request
 
 	purchase_info, err := h.ProductService.PurchaseProducts(user, slug, reqBody, w)
 	if err != nil {
-		HandleErrMsg("error processing purchase", err, w).Stack("product").BadRequest()
+		if strings.Contains(err.Error(), "already own") {
+			HandleErrMsg("error processing purchase", err, w).Stack("product").Conflict()
+		} else if strings.Contains(err.Error(), "invite-only") {
+			ForbiddenError(w, err, "product")
+		} else {
+			HandleErrMsg("error processing purchase", err, w).Stack("product").BadRequest()
+		}
 		return
 	}
 
 	handleSuccess(w, purchase_info, "", http.StatusOK)
 }
 
+// PurchaseCart godoc
+// @Summary      Purchase a cart of products
+// @Description  Buys several products of the event at once with a single Mercado Pago order for the combined total. Every item is
+// @Description  checked like a single purchase and any failing item rejects the whole cart. The payment and gift fields apply to every item
+// @Tags         products
+// @Accept       json
+// @Produce      json
+// @Security     Bearer
+// @Param        Authorization header string true "Bearer {access_token}"
+// @Param        Refresh header string true "Bearer {refresh_token}"
+// @Param        slug path string true "Event slug"
+// @Param        request body models.PurchaseCartRequest true "Cart items and payment info"
+// @Success      200  {object}  NoMessageSuccessResponse{data=models.PurchaseCartResponse}
+// @Failure      400  {object}  ProductStandardErrorResponse
+// @Failure      401  {object}  ProductStandardErrorResponse
+// @Failure      403  {object}  ProductStandardErrorResponse
+// @Failure      409  {object}  ProductStandardErrorResponse
+// @Failure      429  {object}  ProductStandardErrorResponse
+// @Router       /events/{slug}/purchase-cart [post]
+func (h *ProductHandler) PurchaseCart(w http.ResponseWriter, r *http.Request) {
+	slug, err := extractSlugAndValidate(r)
+	if err != nil {
+		BadRequestError(w, err, "product")
+		return
+	}
+
+	var reqBody models.PurchaseCartRequest
+	if err := decodeRequestBody(r, &reqBody); err != nil {
+		BadRequestError(w, err, "product")
+		return
+	}
+
+	user, err := getUserFromContext(h.ProductService.ProductRepo.GetUserByID, r)
+	if err != nil {
+		BadRequestError(w, err, "product")
+		return
+	}
+
+	cart, err := h.ProductService.PurchaseCart(user, slug, reqBody)
+	if err != nil {
+		if strings.Contains(err.Error(), "already own") {
+			HandleErrMsg("error processing cart", err, w).Stack("product").Conflict()
+		} else if strings.Contains(err.Error(), "invite-only") {
+			ForbiddenError(w, err, "product")
+		} else {
+			HandleErrMsg("error processing cart", err, w).Stack("product").BadRequest()
+		}
+		return
+	}
+
+	handleSuccess(w, cart, "", http.StatusOK)
+}
+
+// ValidatePurchase godoc
+// @Summary      Validate a purchase
+// @Description  Runs every check of a purchase (registration, blocking, expiry, stock, max ownable quantity, invites and tickets)
+// @Description  without charging anything. Rejections come back as valid=false with the reason, valid purchases come with their price
+// @Tags         products
+// @Accept       json
+// @Produce      json
+// @Security     Bearer
+// @Param        Authorization header string true "Bearer {access_token}"
+// @Param        Refresh header string true "Bearer {refresh_token}"
+// @Param        slug path string true "Event slug"
+// @Param        request body models.PurchaseRequest true "Purchase info, payment fields are ignored"
+// @Success      200  {object}  NoMessageSuccessResponse{data=models.PurchaseValidation}
+// @Failure      400  {object}  ProductStandardErrorResponse
+// @Failure      401  {object}  ProductStandardErrorResponse
+// @Failure      404  {object}  ProductStandardErrorResponse
+// @Router       /events/{slug}/validate-purchase [post]
+func (h *ProductHandler) ValidatePurchase(w http.ResponseWriter, r *http.Request) {
+	slug, err := extractSlugAndValidate(r)
+	if err != nil {
+		BadRequestError(w, err, "product")
+		return
+	}
+
+	var reqBody models.PurchaseRequest
+	if err := decodeRequestBody(r, &reqBody); err != nil {
+		BadRequestError(w, err, "product")
+		return
+	}
+
+	user, err := getUserFromContext(h.ProductService.ProductRepo.GetUserByID, r)
+	if err != nil {
+		BadRequestError(w, err, "product")
+		return
+	}
+
+	validation, err := h.ProductService.ValidatePurchase(user, slug, reqBody)
+	if err != nil {
+		if strings.Contains(err.Error(), "event not found") {
+			NotFoundError(w, err, "Event", "product")
+		} else {
+			HandleErrMsg("error validating purchase", err, w).Stack("product").BadRequest()
+		}
+		return
+	}
+
+	handleSuccess(w, validation, "", http.StatusOK)
+}
+
 // ForcedPix godoc
 // @Summary      Start a PIX purchase
 // @Description  Creates a pending PIX purchase so the user can pay for the product
@@ -251,6 +368,9 @@ func (h *ProductHandler) PurchaseProducts(w http.ResponseWriter, r *http.Request
 // @Success      200  {object}  NoMessageSuccessResponse{data=models.Purchase}
 // @Failure      400  {object}  ProductStandardErrorResponse
 // @Failure      401  {object}  ProductStandardErrorResponse
+// @Failure      403  {object}  ProductStandardErrorResponse
+// @Failure      409  {object}  ProductStandardErrorResponse
+// @Failure      429  {object}  ProductStandardErrorResponse
 // @Router       /events/{slug}/forced-pix [post]
 func (h *ProductHandler) ForcedPix(w http.ResponseWriter, r *http.Request) {
 	slug, err := extractSlugAndValidate(r)
@@ -273,7 +393,13 @@ func (h *ProductHandler) ForcedPix(w http.ResponseWriter, r *http.Request) {
 
 	purchase_info, err := h.ProductService.ForcedPix(user, slug, reqBody)
 	if err != nil {
-		HandleErrMsg("error starting pix purchase", err, w).Stack("product").BadRequest()
+		if strings.Contains(err.Error(), "already own") {
+			HandleErrMsg("error starting pix purchase", err, w).Stack("product").Conflict()
+		} else if strings.Contains(err.Error(), "invite-only") {
+			ForbiddenError(w, err, "product")
+		} else {
+			HandleErrMsg("error starting pix purchase", err, w).Stack("product").BadRequest()
+		}
 		return
 	}
 
@@ -284,17 +410,20 @@ type Approved struct {
 	Status string `json:"status"`
 }
 
-// GetUserPurchases godoc
-// @Summary      Get user purchases
-// @Description  Returns a list of all purchases for the authenticated user
+// MPWebhook godoc
+// @Summary      Mercado Pago payment webhook
+// @Description  Receives Mercado Pago payment notifications. The x-signature header is checked before anything else, approved pix payments
+// @Description  are finalized and the response is only written once the notification was handled. Payments already finalized are acknowledged
+// @Description  with 200 so Mercado Pago stops retrying, server errors are reported so it retries later
 // @Tags         products
+// @Accept       json
 // @Produce      json
-// @Security     Bearer
-// @Param        Authorization header string true "Bearer {access_token}"
-// @Param        Refresh header string true "Bearer {refresh_token}"
-// @Success      200  {object}  NoMessageSuccessResponse{data=[]models.Purchase}
+// @Param        request body models.MP_WebhookRequest true "Mercado Pago notification"
+// @Success      200  {object}  NoDataSuccessResponse
 // @Failure      400  {object}  ProductStandardErrorResponse
 // @Failure      401  {object}  ProductStandardErrorResponse
+// @Failure      404  {object}  ProductStandardErrorResponse
+// @Failure      500  {object}  ProductStandardErrorResponse
 // @Router       /webhook/mp [post]
 func (h *ProductHandler) MPWebhook(w http.ResponseWriter, r *http.Request) {
 	var reqBody models.MP_WebhookRequest
@@ -303,15 +432,61 @@ func (h *ProductHandler) MPWebhook(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if !validWebhookSignature(r) {
+		UnauthorizedError(w, errors.New("hmac verification failed"), "product")
+		return
+	}
+
+	// Mercado Pago retries webhooks, payments already finalized are acknowledged and left alone
+	processed, err := h.ProductService.ProductRepo.IsPaymentProcessed(reqBody.Data.Id)
+	if err != nil {
+		log.Printf("Could not check whether payment %s was processed: %v", reqBody.Data.Id, err)
+	} else if processed {
+		log.Printf("Ignoring repeated webhook for payment %s", reqBody.Data.Id)
+		handleSuccess(w, nil, "", http.StatusOK)
+		return
+	}
+
+	PurchaseID, err := strconv.Atoi(reqBody.Data.Id)
+	if err != nil {
+		BadRequestError(w, errors.New("invalid payment id"), "product")
+		return
+	}
+
+	status, err := fetchPaymentStatus(reqBody.Data.Id)
+	if err != nil {
+		log.Printf("Could not get the status of payment %s: %v", reqBody.Data.Id, err)
+		ServerError(w, err, "product")
+		return
+	}
+
+	if status == "approved" {
+		purchase, err := h.ProductService.ProductRepo.GetPixPurchase(PurchaseID)
+		if err != nil {
+			log.Printf("ATTENTION COULD NOT FINISH PURCHASE %s: %v", reqBody.Data.Id, err)
+			NotFoundError(w, err, "Pix purchase", "product")
+			return
+		}
+
+		err = h.ProductService.FinalizePixPayment(*purchase)
+		if err != nil && !strings.Contains(err.Error(), "already finalized") {
+			log.Printf("ATTENTION COULD NOT FINISH PURCHASE %s: %v", reqBody.Data.Id, err)
+			ServerError(w, err, "product")
+			return
+		}
+	}
+
+	handleSuccess(w, nil, "", http.StatusOK)
+}
+
+// validWebhookSignature checks the x-signature header Mercado Pago signs its notifications with
+func validWebhookSignature(r *http.Request) bool {
 	xSignature := r.Header.Get("x-signature")
 	xRequestId := r.Header.Get("x-request-id")
-
-	queryParams := r.URL.Query()
-	dataID := queryParams.Get("data.id")
-	parts := strings.Split(xSignature, ",")
+	dataID := r.URL.Query().Get("data.id")
 
 	var ts, hash string
-	for _, part := range parts {
+	for _, part := range strings.Split(xSignature, ",") {
 		keyValue := strings.SplitN(part, "=", 2)
 		if len(keyValue) == 2 {
 			key := strings.TrimSpace(keyValue[0])
@@ -324,72 +499,181 @@ func (h *ProductHandler) MPWebhook(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
-	secret := config.GetWebhookSignature()
 	manifest := fmt.Sprintf("id:%v;request-id:%v;ts:%v;", dataID, xRequestId, ts)
+	mac := hmac.New(sha256.New, []byte(config.GetWebhookSignature()))
+	mac.Write([]byte(manifest))
 
-	hmac := hmac.New(sha256.New, []byte(secret))
-	hmac.Write([]byte(manifest))
-
-	sha := hex.EncodeToString(hmac.Sum(nil))
-	if sha == hash {
-		handleSuccess(w, nil, "", http.StatusOK)
-	} else {
-		BadRequestError(w, errors.New("hmac verification failed"), "product")
-		return
-	}
+	return hmac.Equal([]byte(hex.EncodeToString(mac.Sum(nil))), []byte(hash))
+}
 
-	url := fmt.Sprintf("https://api.mercadopago.com/v1/payments/%v", reqBody.Data.Id)
+// fetchPaymentStatus asks Mercado Pago for the current status of a payment
+func fetchPaymentStatus(paymentID string) (string, error) {
+	url := fmt.Sprintf("https://api.mercadopago.com/v1/payments/%v", paymentID)
 
 	req, err := http.NewRequest("GET", url, nil)
 	if err != nil {
-		fmt.Println("Error creating request:", err)
-		return
+		return "", err
 	}
+	req.Header.Add("Authorization", fmt.Sprintf("Bearer %v", config.GetMercadoPagoAccessToken()))
 
-	AuthHeader := fmt.Sprintf("Bearer %v", config.GetMercadoPagoAccessToken())
-	req.Header.Add("Authorization", AuthHeader)
-
-	client := &http.Client{}
+	client := &http.Client{Timeout: 10 * time.Second}
 	resp, err := client.Do(req)
 	if err != nil {
-		fmt.Println("Error sending request:", err)
-		return
+		return "", err
 	}
 	defer resp.Body.Close()
 
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("mercado pago answered with status %d", resp.StatusCode)
+	}
+
 	var bodyContent Approved
-	decoder := json.NewDecoder(resp.Body)
-	err = decoder.Decode(&bodyContent)
+	if err := json.NewDecoder(resp.Body).Decode(&bodyContent); err != nil {
+		return "", err
+	}
+	return bodyContent.Status, nil
+}
+
+// GetPixPurchaseStatus godoc
+// @Summary      Get the status of a pix purchase
+// @Description  Asks Mercado Pago for the current status of a pix payment. When it was approved but the webhook didn't arrive yet
+// @Description  the purchase is finalized right away, only once even if the webhook arrives at the same time. Available to the buyer and the event admins
+// @Tags         products
+// @Produce      json
+// @Security     Bearer
+// @Param        Authorization header string true "Bearer {access_token}"
+// @Param        Refresh header string true "Bearer {refresh_token}"
+// @Param        slug path string true "Event slug"
+// @Param        id path int true "Mercado Pago payment ID"
+// @Success      200  {object}  NoMessageSuccessResponse{data=models.PixPurchaseStatus}
+// @Failure      400  {object}  ProductStandardErrorResponse
+// @Failure      401  {object}  ProductStandardErrorResponse
+// @Failure      403  {object}  ProductStandardErrorResponse
+// @Failure      404  {object}  ProductStandardErrorResponse
+// @Router       /events/{slug}/pix-purchase/{id}/status [get]
+func (h *ProductHandler) GetPixPurchaseStatus(w http.ResponseWriter, r *http.Request) {
+	slug, err := extractSlugAndValidate(r)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+		BadRequestError(w, err, "product")
 		return
 	}
 
-	// URGENT: CREATE FILE LOG
-	PurchaseID, err := strconv.Atoi(reqBody.Data.Id)
+	paymentID, err := strconv.Atoi(r.PathValue("id"))
 	if err != nil {
-		log.Println("ATTENTION COULD NOT FINISH PURCHASE")
+		BadRequestError(w, errors.New("invalid payment id"), "product")
 		return
 	}
 
-	if bodyContent.Status == "approved" {
-		purchase, err := h.ProductService.ProductRepo.GetPixPurchase(PurchaseID)
-		if err != nil {
-			log.Println("ATTENTION COULD NOT FINISH PURCHASE")
-			return
+	user, err := getUserFromContext(h.ProductService.ProductRepo.GetUserByID, r)
+	if err != nil {
+		BadRequestError(w, err, "product")
+		return
+	}
+
+	status, err := h.ProductService.GetPixPurchaseStatus(user, slug, paymentID)
+	if err != nil {
+		switch {
+		case strings.Contains(err.Error(), "unauthorized"):
+			ForbiddenError(w, err, "product")
+		case strings.Contains(err.Error(), "not found"):
+			NotFoundError(w, err, "Pix purchase", "product")
+		default:
+			HandleErrMsg("error getting pix purchase status", err, w).Stack("product").BadRequest()
 		}
+		return
+	}
 
-		err = h.ProductService.ProductRepo.FinalizePixPurchase(*purchase)
-		if err != nil {
-			log.Println("WTF: " + err.Error())
-			return
+	handleSuccess(w, status, "", http.StatusOK)
+}
+
+// CancelPixPurchase godoc
+// @Summary      Cancel a pending pix purchase
+// @Description  Cancels the pix payment at Mercado Pago and drops the pending purchase, only the buyer can do it.
+// @Description  Payments that were already paid can't be cancelled
+// @Tags         products
+// @Produce      json
+// @Security     Bearer
+// @Param        Authorization header string true "Bearer {access_token}"
+// @Param        Refresh header string true "Bearer {refresh_token}"
+// @Param        id path int true "Mercado Pago payment ID"
+// @Success      200  {object}  NoMessageSuccessResponse
+// @Failure      400  {object}  ProductStandardErrorResponse
+// @Failure      401  {object}  ProductStandardErrorResponse
+// @Failure      403  {object}  ProductStandardErrorResponse
+// @Failure      404  {object}  ProductStandardErrorResponse
+// @Failure      409  {object}  ProductStandardErrorResponse
+// @Router       /pix-purchases/{id} [delete]
+func (h *ProductHandler) CancelPixPurchase(w http.ResponseWriter, r *http.Request) {
+	paymentID, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		BadRequestError(w, errors.New("invalid payment id"), "product")
+		return
+	}
+
+	user, err := getUserFromContext(h.ProductService.ProductRepo.GetUserByID, r)
+	if err != nil {
+		BadRequestError(w, err, "product")
+		return
+	}
+
+	if err := h.ProductService.CancelPixPurchase(user, paymentID); err != nil {
+		switch {
+		case strings.Contains(err.Error(), "unauthorized"):
+			ForbiddenError(w, err, "product")
+		case strings.Contains(err.Error(), "not found"):
+			NotFoundError(w, err, "Pix purchase", "product")
+		case strings.Contains(err.Error(), "can't be cancelled"):
+			HandleErrMsg("error cancelling pix purchase", err, w).Stack("product").Conflict()
+		default:
+			HandleErrMsg("error cancelling pix purchase", err, w).Stack("product").BadRequest()
 		}
+		return
+	}
 
-		err = h.ProductService.ProductRepo.DeletePixPurchase(PurchaseID)
-		if err != nil {
-			log.Println("Error deleting pix purchase")
+	handleSuccess(w, nil, "", http.StatusOK)
+}
+
+// ReconcilePayments godoc
+// @Summary      Reconcile Mercado Pago payments
+// @Description  Fetches the Mercado Pago payments created in the range, up to 31 days, and cross-checks them against the local purchases
+// @Description  and pending pix purchases (super users only). Orphaned are approved payments without a purchase, phantom are paid purchases
+// @Description  whose payment or order Mercado Pago doesn't have approved
+// @Tags         products
+// @Accept       json
+// @Produce      json
+// @Security     Bearer
+// @Param        Authorization header string true "Bearer {access_token}"
+// @Param        Refresh header string true "Bearer {refresh_token}"
+// @Param        request body models.PaymentReconcileRequest true "Date range"
+// @Success      200  {object}  NoMessageSuccessResponse{data=models.PaymentReconciliation}
+// @Failure      400  {object}  ProductStandardErrorResponse
+// @Failure      401  {object}  ProductStandardErrorResponse
+// @Failure      403  {object}  ProductStandardErrorResponse
+// @Router       /admin/reconcile-payments [post]
+func (h *ProductHandler) ReconcilePayments(w http.ResponseWriter, r *http.Request) {
+	admin, err := getUserFromContext(h.ProductService.ProductRepo.GetUserByID, r)
+	if err != nil {
+		BadRequestError(w, err, "product")
+		return
+	}
+
+	var req models.PaymentReconcileRequest
+	if err := decodeRequestBody(r, &req); err != nil {
+		BadRequestError(w, err, "product")
+		return
+	}
+
+	reconciliation, err := h.ProductService.ReconcilePayments(admin, req)
+	if err != nil {
+		if strings.Contains(err.Error(), "unauthorized") {
+			ForbiddenError(w, err, "product")
+		} else {
+			HandleErrMsg("error reconciling payments", err, w).Stack("product").BadRequest()
 		}
+		return
 	}
+
+	handleSuccess(w, reconciliation, "", http.StatusOK)
 }
 
 // GetUserProducts godoc
@@ -526,37 +810,1375 @@ func (h *ProductHandler) GetUserPurchases(w http.ResponseWriter, r *http.Request
 	handleSuccess(w, purchases, "", http.StatusOK)
 }
 
-// CanGift godoc
-// @Summary      Checks if you can gift to that user
-// @Description  checks all things about a user that you want to gift to
+// GetUserSpend godoc
+// @Summary      Get user spend
+// @Description  Sums what the authenticated user paid for products, overall and per event, net of refunds. Gifts count for the user who paid for them,
+// @Description  not for the recipient. Values are in cents at the prices the purchases were made for
 // @Tags         products
 // @Produce      json
 // @Security     Bearer
 // @Param        Authorization header string true "Bearer {access_token}"
 // @Param        Refresh header string true "Bearer {refresh_token}"
-// @Param        request body models.CanGiftRequest true "recipient info"
-// @Success      200  {object}  NoMessageSuccessResponse
+// @Success      200  {object}  NoMessageSuccessResponse{data=models.UserSpend}
 // @Failure      400  {object}  ProductStandardErrorResponse
 // @Failure      401  {object}  ProductStandardErrorResponse
-// @Router       /can-gift [get]
-func (h *ProductHandler) CanGift(w http.ResponseWriter, r *http.Request) {
+// @Router       /me/spend [get]
+func (h *ProductHandler) GetUserSpend(w http.ResponseWriter, r *http.Request) {
 	user, err := getUserFromContext(h.ProductService.ProductRepo.GetUserByID, r)
 	if err != nil {
 		BadRequestError(w, err, "product")
 		return
 	}
 
-	var reqBody models.CanGiftRequest
-	if err := decodeRequestBody(r, &reqBody); err != nil {
+	spend, err := h.ProductService.GetUserSpend(user)
+	if err != nil {
+		HandleErrMsg("error getting spend", err, w).Stack("product").BadRequest()
+		return
+	}
+
+	handleSuccess(w, spend, "", http.StatusOK)
+}
+
+// GetEventTokens godoc
+// @Summary      List the tokens issued for an event
+// @Description  Pages through every token issued for the event, oldest first, with its owner, source product and the activity it was
+// @Description  redeemed on, for reconciling token sales and redemptions (master admins only)
+// @Tags         products
+// @Produce      json
+// @Security     Bearer
+// @Param        Authorization header string true "Bearer {access_token}"
+// @Param        Refresh header string true "Bearer {refresh_token}"
+// @Param        slug path string true "Event slug"
+// @Param        used query bool false "Only used (true) or unused (false) tokens, all of them when omitted"
+// @Param        page query int false "Page, starting at 1"
+// @Param        page_size query int false "Page size, up to 100"
+// @Success      200  {object}  NoMessageSuccessResponse{data=models.EventTokenList}
+// @Failure      400  {object}  ProductStandardErrorResponse
+// @Failure      401  {object}  ProductStandardErrorResponse
+// @Failure      403  {object}  ProductStandardErrorResponse
+// @Failure      404  {object}  ProductStandardErrorResponse
+// @Router       /events/{slug}/tokens [get]
+func (h *ProductHandler) GetEventTokens(w http.ResponseWriter, r *http.Request) {
+	slug, err := extractSlugAndValidate(r)
+	if err != nil {
 		BadRequestError(w, err, "product")
 		return
 	}
 
-	res, err := h.ProductService.CanGift(user, reqBody)
+	page, pageSize, err := parsePagination(r)
 	if err != nil {
-		HandleErrMsg("error getting user info", err, w).Stack("product").BadRequest()
+		BadRequestError(w, err, "product")
 		return
 	}
 
-	handleSuccess(w, res, "", http.StatusOK)
+	var used *bool
+	if raw := r.URL.Query().Get("used"); raw != "" {
+		value, err := strconv.ParseBool(raw)
+		if err != nil {
+			BadRequestError(w, errors.New("used must be true or false"), "product")
+			return
+		}
+		used = &value
+	}
+
+	admin, err := getUserFromContext(h.ProductService.ProductRepo.GetUserByID, r)
+	if err != nil {
+		BadRequestError(w, err, "product")
+		return
+	}
+
+	tokens, err := h.ProductService.GetEventTokens(admin, slug, used, page, pageSize)
+	if err != nil {
+		switch {
+		case strings.Contains(err.Error(), "unauthorized"):
+			ForbiddenError(w, err, "product")
+		case strings.Contains(err.Error(), "not found"):
+			NotFoundError(w, err, "Event", "product")
+		default:
+			HandleErrMsg("error getting event tokens", err, w).Stack("product").BadRequest()
+		}
+		return
+	}
+
+	handleSuccess(w, tokens, "", http.StatusOK)
+}
+
+// GetUserPendingAccess godoc
+// @Summary      Get the gifted accesses pending registration
+// @Description  Lists the events and activities the authenticated user's gifted products give access to that they didn't register to yet,
+// @Description  each with the request that registers them. Activity accesses point to the event registration until the user registers to the event
+// @Tags         products
+// @Produce      json
+// @Security     Bearer
+// @Param        Authorization header string true "Bearer {access_token}"
+// @Param        Refresh header string true "Bearer {refresh_token}"
+// @Success      200  {object}  NoMessageSuccessResponse{data=[]models.PendingAccess}
+// @Failure      400  {object}  ProductStandardErrorResponse
+// @Failure      401  {object}  ProductStandardErrorResponse
+// @Router       /me/pending-access [get]
+func (h *ProductHandler) GetUserPendingAccess(w http.ResponseWriter, r *http.Request) {
+	user, err := getUserFromContext(h.ProductService.ProductRepo.GetUserByID, r)
+	if err != nil {
+		BadRequestError(w, err, "product")
+		return
+	}
+
+	pending, err := h.ProductService.GetUserPendingAccess(user)
+	if err != nil {
+		HandleErrMsg("error getting pending access", err, w).Stack("product").BadRequest()
+		return
+	}
+
+	handleSuccess(w, pending, "", http.StatusOK)
+}
+
+// CanGift godoc
+// @Summary      Checks if you can gift to that user
+// @Description  Pre-validates a gift: the recipient must exist, can't be the gifter, must be registered to the event of the product
+// @Description  and must be able to own the product. A rejected gift comes back with can_gift false and the reason.
+// @Description  Purchases and pix purchases run the same checks before charging
+// @Tags         products
+// @Accept       json
+// @Produce      json
+// @Security     Bearer
+// @Param        Authorization header string true "Bearer {access_token}"
+// @Param        Refresh header string true "Bearer {refresh_token}"
+// @Param        request body models.CanGiftRequest true "recipient info"
+// @Success      200  {object}  NoMessageSuccessResponse{data=models.CanGiftResponse}
+// @Failure      400  {object}  ProductStandardErrorResponse
+// @Failure      401  {object}  ProductStandardErrorResponse
+// @Failure      404  {object}  ProductStandardErrorResponse
+// @Router       /can-gift [post]
+func (h *ProductHandler) CanGift(w http.ResponseWriter, r *http.Request) {
+	user, err := getUserFromContext(h.ProductService.ProductRepo.GetUserByID, r)
+	if err != nil {
+		BadRequestError(w, err, "product")
+		return
+	}
+
+	var reqBody models.CanGiftRequest
+	if err := decodeRequestBody(r, &reqBody); err != nil {
+		BadRequestError(w, err, "product")
+		return
+	}
+
+	res, err := h.ProductService.CanGift(user, reqBody)
+	if err != nil {
+		if strings.Contains(err.Error(), "not found") {
+			NotFoundError(w, err, "Product", "product")
+		} else {
+			HandleErrMsg("error checking gift", err, w).Stack("product").BadRequest()
+		}
+		return
+	}
+
+	handleSuccess(w, res, "", http.StatusOK)
+}
+
+// TransferProduct godoc
+// @Summary      Transfer an owned product
+// @Description  Hands one of the authenticated user's products over to another user registered to its event, as a gift, along with
+// @Description  its unused tokens and bundled products. Products whose tokens were used or that granted an attended activity can't be transferred
+// @Tags         products
+// @Accept       json
+// @Produce      json
+// @Security     Bearer
+// @Param        Authorization header string true "Bearer {access_token}"
+// @Param        Refresh header string true "Bearer {refresh_token}"
+// @Param        request body models.TransferProductRequest true "Owned product and recipient"
+// @Success      200  {object}  NoMessageSuccessResponse{data=models.UserProduct}
+// @Failure      400  {object}  ProductStandardErrorResponse
+// @Failure      401  {object}  ProductStandardErrorResponse
+// @Failure      403  {object}  ProductStandardErrorResponse
+// @Failure      404  {object}  ProductStandardErrorResponse
+// @Failure      409  {object}  ProductStandardErrorResponse
+// @Router       /transfer-product [post]
+func (h *ProductHandler) TransferProduct(w http.ResponseWriter, r *http.Request) {
+	user, err := getUserFromContext(h.ProductService.ProductRepo.GetUserByID, r)
+	if err != nil {
+		BadRequestError(w, err, "product")
+		return
+	}
+
+	var reqBody models.TransferProductRequest
+	if err := decodeRequestBody(r, &reqBody); err != nil {
+		BadRequestError(w, err, "product")
+		return
+	}
+
+	if reqBody.UserProductID == "" || reqBody.ToEmail == "" {
+		BadRequestError(w, errors.New("user product ID and recipient email are required"), "product")
+		return
+	}
+
+	userProduct, err := h.ProductService.TransferUserProduct(user, reqBody.UserProductID, reqBody.ToEmail)
+	if err != nil {
+		switch {
+		case strings.Contains(err.Error(), "unauthorized"), strings.Contains(err.Error(), "forbidden"):
+			ForbiddenError(w, err, "product")
+		case strings.Contains(err.Error(), "not found"):
+			HandleErr(err, w).Stack("product").NotFound()
+		case strings.Contains(err.Error(), "can't be transferred"), strings.Contains(err.Error(), "already owns"):
+			HandleErrMsg("error transferring product", err, w).Stack("product").Conflict()
+		default:
+			HandleErrMsg("error transferring product", err, w).Stack("product").BadRequest()
+		}
+		return
+	}
+
+	handleSuccess(w, userProduct, "", http.StatusOK)
+}
+
+// GetOrphanedAccessTargets godoc
+// @Summary      List orphaned access targets
+// @Description  Lists the access targets of the event products that point to an activity or event that no longer exists (admins only)
+// @Tags         products
+// @Produce      json
+// @Security     Bearer
+// @Param        Authorization header string true "Bearer {access_token}"
+// @Param        Refresh header string true "Bearer {refresh_token}"
+// @Param        slug path string true "Event slug"
+// @Success      200  {object}  NoMessageSuccessResponse{data=[]models.OrphanedAccessTarget}
+// @Failure      400  {object}  ProductStandardErrorResponse
+// @Failure      401  {object}  ProductStandardErrorResponse
+// @Failure      403  {object}  ProductStandardErrorResponse
+// @Router       /events/{slug}/products/access-targets/orphans [get]
+func (h *ProductHandler) GetOrphanedAccessTargets(w http.ResponseWriter, r *http.Request) {
+	slug, err := extractSlugAndValidate(r)
+	if err != nil {
+		BadRequestError(w, err, "product")
+		return
+	}
+
+	admin, err := getUserFromContext(h.ProductService.ProductRepo.GetUserByID, r)
+	if err != nil {
+		BadRequestError(w, err, "product")
+		return
+	}
+
+	orphans, err := h.ProductService.GetOrphanedAccessTargets(admin, slug)
+	if err != nil {
+		if strings.Contains(err.Error(), "unauthorized") {
+			ForbiddenError(w, err, "product")
+		} else {
+			HandleErrMsg("error getting orphaned access targets", err, w).Stack("product").BadRequest()
+		}
+		return
+	}
+
+	handleSuccess(w, orphans, "", http.StatusOK)
+}
+
+// GetExpiringProducts godoc
+// @Summary      List products expiring soon
+// @Description  Lists the event products that are still purchasable but expire within the given window (admins only)
+// @Tags         products
+// @Produce      json
+// @Security     Bearer
+// @Param        Authorization header string true "Bearer {access_token}"
+// @Param        Refresh header string true "Bearer {refresh_token}"
+// @Param        slug path string true "Event slug"
+// @Param        within query string false "Window as a Go duration, defaults to 48h" example(48h)
+// @Success      200  {object}  NoMessageSuccessResponse{data=[]models.Product}
+// @Failure      400  {object}  ProductStandardErrorResponse
+// @Failure      401  {object}  ProductStandardErrorResponse
+// @Failure      403  {object}  ProductStandardErrorResponse
+// @Failure      404  {object}  ProductStandardErrorResponse
+// @Router       /events/{slug}/products/expiring [get]
+func (h *ProductHandler) GetExpiringProducts(w http.ResponseWriter, r *http.Request) {
+	slug, err := extractSlugAndValidate(r)
+	if err != nil {
+		BadRequestError(w, err, "product")
+		return
+	}
+
+	within := 48 * time.Hour
+	if raw := r.URL.Query().Get("within"); raw != "" {
+		within, err = time.ParseDuration(raw)
+		if err != nil {
+			BadRequestError(w, errors.New("within must be a duration like 48h"), "product")
+			return
+		}
+	}
+
+	admin, err := getUserFromContext(h.ProductService.ProductRepo.GetUserByID, r)
+	if err != nil {
+		BadRequestError(w, err, "product")
+		return
+	}
+
+	products, err := h.ProductService.GetExpiringProducts(admin, slug, within)
+	if err != nil {
+		if strings.Contains(err.Error(), "unauthorized") {
+			ForbiddenError(w, err, "product")
+		} else if strings.Contains(err.Error(), "event not found") {
+			NotFoundError(w, err, "Event", "product")
+		} else {
+			HandleErrMsg("error getting expiring products", err, w).Stack("product").BadRequest()
+		}
+		return
+	}
+
+	handleSuccess(w, products, "", http.StatusOK)
+}
+
+// GetGiftingStats godoc
+// @Summary      Get event gifting stats
+// @Description  Sums up the gifted products of the event: gift purchases and units, how many recipients registered to the event
+// @Description  and how many attended an activity or used a gifted token, and the top gifters. Refunded gifts are left out (admins only)
+// @Tags         products
+// @Produce      json
+// @Security     Bearer
+// @Param        Authorization header string true "Bearer {access_token}"
+// @Param        Refresh header string true "Bearer {refresh_token}"
+// @Param        slug path string true "Event slug"
+// @Success      200  {object}  NoMessageSuccessResponse{data=models.GiftingStats}
+// @Failure      400  {object}  ProductStandardErrorResponse
+// @Failure      401  {object}  ProductStandardErrorResponse
+// @Failure      403  {object}  ProductStandardErrorResponse
+// @Failure      404  {object}  ProductStandardErrorResponse
+// @Router       /events/{slug}/gifting-stats [get]
+func (h *ProductHandler) GetGiftingStats(w http.ResponseWriter, r *http.Request) {
+	slug, err := extractSlugAndValidate(r)
+	if err != nil {
+		BadRequestError(w, err, "product")
+		return
+	}
+
+	admin, err := getUserFromContext(h.ProductService.ProductRepo.GetUserByID, r)
+	if err != nil {
+		BadRequestError(w, err, "product")
+		return
+	}
+
+	stats, err := h.ProductService.GetGiftingStats(admin, slug)
+	if err != nil {
+		if strings.Contains(err.Error(), "unauthorized") {
+			ForbiddenError(w, err, "product")
+		} else if strings.Contains(err.Error(), "event not found") {
+			NotFoundError(w, err, "Event", "product")
+		} else {
+			HandleErrMsg("error getting gifting stats", err, w).Stack("product").BadRequest()
+		}
+		return
+	}
+
+	handleSuccess(w, stats, "", http.StatusOK)
+}
+
+// ExportEventPurchases godoc
+// @Summary      Export the event purchases as CSV
+// @Description  Streams every purchase of the event as a reconciliation CSV with buyer, product, quantity, prices, payment method,
+// @Description  Mercado Pago reference, gift flag, refund status and timestamps (master admins only). Prices are in reais
+// @Tags         products
+// @Produce      text/csv
+// @Security     Bearer
+// @Param        Authorization header string true "Bearer {access_token}"
+// @Param        Refresh header string true "Bearer {refresh_token}"
+// @Param        slug path string true "Event slug"
+// @Success      200  {string}  string "Purchases CSV"
+// @Failure      400  {object}  ProductStandardErrorResponse
+// @Failure      401  {object}  ProductStandardErrorResponse
+// @Failure      403  {object}  ProductStandardErrorResponse
+// @Router       /events/{slug}/purchases/export [get]
+func (h *ProductHandler) ExportEventPurchases(w http.ResponseWriter, r *http.Request) {
+	slug, err := extractSlugAndValidate(r)
+	if err != nil {
+		BadRequestError(w, err, "product")
+		return
+	}
+
+	admin, err := getUserFromContext(h.ProductService.ProductRepo.GetUserByID, r)
+	if err != nil {
+		BadRequestError(w, err, "product")
+		return
+	}
+
+	stream := newCSVStream(w, slug+"-purchases.csv", purchaseExportHeader)
+
+	err = h.ProductService.ExportEventPurchases(admin, slug, func(row models.PurchaseExportRow) error {
+		return stream.Write(purchaseExportRecord(row))
+	})
+	if err != nil {
+		if stream.Started() {
+			log.Printf("Failed to stream purchases CSV for %s: %v", slug, err)
+			return
+		}
+		if strings.Contains(err.Error(), "unauthorized") {
+			ForbiddenError(w, err, "product")
+		} else {
+			HandleErrMsg("error exporting purchases", err, w).Stack("product").BadRequest()
+		}
+		return
+	}
+
+	if err := stream.Close(); err != nil {
+		log.Printf("Failed to write purchases CSV for %s: %v", slug, err)
+	}
+}
+
+var purchaseExportHeader = []string{
+	"purchase_id", "buyer_email", "product_id", "product_name", "quantity", "unit_price", "total",
+	"payment_method", "mp_reference", "is_gift", "gifted_to_email", "refund_status", "refunded_quantity",
+	"purchased_at", "refunded_at",
+}
+
+func purchaseExportRecord(row models.PurchaseExportRow) []string {
+	refundStatus := "none"
+	if row.RefundedAt != nil {
+		refundStatus = "refunded"
+	} else if row.RefundedQuantity > 0 {
+		refundStatus = "partial"
+	}
+
+	paymentID, giftedTo, refundedAt := "", "", ""
+	if row.PaymentID != nil {
+		paymentID = *row.PaymentID
+	}
+	if row.GiftedToEmail != nil {
+		giftedTo = *row.GiftedToEmail
+	}
+	if row.RefundedAt != nil {
+		refundedAt = row.RefundedAt.Format(time.RFC3339)
+	}
+
+	return []string{
+		row.PurchaseID,
+		row.BuyerEmail,
+		row.ProductID,
+		row.ProductName,
+		strconv.Itoa(row.Quantity),
+		fmt.Sprintf("%.2f", float64(row.UnitPriceInt)/100),
+		fmt.Sprintf("%.2f", float64(row.UnitPriceInt*row.Quantity)/100),
+		row.PaymentMethod,
+		paymentID,
+		strconv.FormatBool(row.IsGift),
+		giftedTo,
+		refundStatus,
+		strconv.Itoa(row.RefundedQuantity),
+		row.PurchasedAt.Format(time.RFC3339),
+		refundedAt,
+	}
+}
+
+// RefundPurchase godoc
+// @Summary      Refund a purchase
+// @Description  Refunds some or all units of a purchase of the event (master admins only). The Mercado Pago refund is proportional
+// @Description  to the refunded units and only the tokens and registrations those units granted are taken back. Quantity 0 refunds what's left.
+// @Description  Purchases with a used token or whose owner attended an activity they granted can't be refunded
+// @Tags         products
+// @Accept       json
+// @Produce      json
+// @Security     Bearer
+// @Param        Authorization header string true "Bearer {access_token}"
+// @Param        Refresh header string true "Bearer {refresh_token}"
+// @Param        slug path string true "Event slug"
+// @Param        request body models.RefundPurchaseRequest true "Purchase and units to refund"
+// @Success      200  {object}  NoMessageSuccessResponse{data=models.PurchaseRefund}
+// @Failure      400  {object}  ProductStandardErrorResponse
+// @Failure      401  {object}  ProductStandardErrorResponse
+// @Failure      403  {object}  ProductStandardErrorResponse
+// @Failure      404  {object}  ProductStandardErrorResponse
+// @Failure      409  {object}  ProductStandardErrorResponse
+// @Router       /events/{slug}/refund [post]
+func (h *ProductHandler) RefundPurchase(w http.ResponseWriter, r *http.Request) {
+	slug, err := extractSlugAndValidate(r)
+	if err != nil {
+		BadRequestError(w, err, "product")
+		return
+	}
+
+	var reqBody models.RefundPurchaseRequest
+	if err := decodeRequestBody(r, &reqBody); err != nil {
+		BadRequestError(w, err, "product")
+		return
+	}
+
+	admin, err := getUserFromContext(h.ProductService.ProductRepo.GetUserByID, r)
+	if err != nil {
+		BadRequestError(w, err, "product")
+		return
+	}
+
+	refund, err := h.ProductService.RefundPurchase(admin, slug, reqBody.PurchaseID, reqBody.Quantity)
+	if err != nil {
+		switch {
+		case strings.Contains(err.Error(), "unauthorized"):
+			ForbiddenError(w, err, "product")
+		case strings.Contains(err.Error(), "not found"):
+			NotFoundError(w, err, "Purchase", "product")
+		case strings.Contains(err.Error(), "already refunded"):
+			ConflictError(w, err, "Purchase", "product")
+		case strings.Contains(err.Error(), "can't be refunded"):
+			HandleErrMsg("error refunding purchase", err, w).Stack("product").Conflict()
+		default:
+			HandleErrMsg("error refunding purchase", err, w).Stack("product").BadRequest()
+		}
+		return
+	}
+
+	handleSuccess(w, refund, "", http.StatusOK)
+}
+
+// ExtendProductsExpiry godoc
+// @Summary      Extend the expiry of all event products
+// @Description  Moves the expiry of every product of the event to expires_at, or by delta over each current expiry (master admins only).
+// @Description  Expiries are capped at the event end date
+// @Tags         products
+// @Accept       json
+// @Produce      json
+// @Security     Bearer
+// @Param        Authorization header string true "Bearer {access_token}"
+// @Param        Refresh header string true "Bearer {refresh_token}"
+// @Param        slug path string true "Event slug"
+// @Param        request body models.ExtendProductExpiryRequest true "New expiry or delta"
+// @Success      200  {object}  NoMessageSuccessResponse{data=models.ExtendProductExpiryResult}
+// @Failure      400  {object}  ProductStandardErrorResponse
+// @Failure      401  {object}  ProductStandardErrorResponse
+// @Failure      403  {object}  ProductStandardErrorResponse
+// @Failure      404  {object}  ProductStandardErrorResponse
+// @Router       /events/{slug}/products/extend-expiry [post]
+func (h *ProductHandler) ExtendProductsExpiry(w http.ResponseWriter, r *http.Request) {
+	slug, err := extractSlugAndValidate(r)
+	if err != nil {
+		BadRequestError(w, err, "product")
+		return
+	}
+
+	var reqBody models.ExtendProductExpiryRequest
+	if err := decodeRequestBody(r, &reqBody); err != nil {
+		BadRequestError(w, err, "product")
+		return
+	}
+
+	admin, err := getUserFromContext(h.ProductService.ProductRepo.GetUserByID, r)
+	if err != nil {
+		BadRequestError(w, err, "product")
+		return
+	}
+
+	result, err := h.ProductService.ExtendProductsExpiry(admin, slug, reqBody)
+	if err != nil {
+		if strings.Contains(err.Error(), "unauthorized") {
+			ForbiddenError(w, err, "product")
+		} else if strings.Contains(err.Error(), "event not found") {
+			NotFoundError(w, err, "Event", "product")
+		} else {
+			HandleErrMsg("error extending product expiries", err, w).Stack("product").BadRequest()
+		}
+		return
+	}
+
+	handleSuccess(w, result, "", http.StatusOK)
+}
+
+// BlockAllProducts godoc
+// @Summary      Block every product of the event
+// @Description  Emergency switch that stops the sales of every product of the event at once, the reason is audit logged (master admins only)
+// @Tags         products
+// @Accept       json
+// @Produce      json
+// @Security     Bearer
+// @Param        Authorization header string true "Bearer {access_token}"
+// @Param        Refresh header string true "Bearer {refresh_token}"
+// @Param        slug path string true "Event slug"
+// @Param        request body models.BulkBlockProductsRequest true "Reason"
+// @Success      200  {object}  NoMessageSuccessResponse{data=models.BulkBlockProductsResult}
+// @Failure      400  {object}  ProductStandardErrorResponse
+// @Failure      401  {object}  ProductStandardErrorResponse
+// @Failure      403  {object}  ProductStandardErrorResponse
+// @Failure      404  {object}  ProductStandardErrorResponse
+// @Router       /events/{slug}/products/block-all [post]
+func (h *ProductHandler) BlockAllProducts(w http.ResponseWriter, r *http.Request) {
+	h.setAllProductsBlocked(w, r, true)
+}
+
+// UnblockAllProducts godoc
+// @Summary      Unblock every product of the event
+// @Description  Resumes the sales of every product of the event at once, the reason is audit logged (master admins only)
+// @Tags         products
+// @Accept       json
+// @Produce      json
+// @Security     Bearer
+// @Param        Authorization header string true "Bearer {access_token}"
+// @Param        Refresh header string true "Bearer {refresh_token}"
+// @Param        slug path string true "Event slug"
+// @Param        request body models.BulkBlockProductsRequest true "Reason"
+// @Success      200  {object}  NoMessageSuccessResponse{data=models.BulkBlockProductsResult}
+// @Failure      400  {object}  ProductStandardErrorResponse
+// @Failure      401  {object}  ProductStandardErrorResponse
+// @Failure      403  {object}  ProductStandardErrorResponse
+// @Failure      404  {object}  ProductStandardErrorResponse
+// @Router       /events/{slug}/products/unblock-all [post]
+func (h *ProductHandler) UnblockAllProducts(w http.ResponseWriter, r *http.Request) {
+	h.setAllProductsBlocked(w, r, false)
+}
+
+func (h *ProductHandler) setAllProductsBlocked(w http.ResponseWriter, r *http.Request, blocked bool) {
+	slug, err := extractSlugAndValidate(r)
+	if err != nil {
+		BadRequestError(w, err, "product")
+		return
+	}
+
+	var reqBody models.BulkBlockProductsRequest
+	if err := decodeRequestBody(r, &reqBody); err != nil {
+		BadRequestError(w, err, "product")
+		return
+	}
+
+	admin, err := getUserFromContext(h.ProductService.ProductRepo.GetUserByID, r)
+	if err != nil {
+		BadRequestError(w, err, "product")
+		return
+	}
+
+	result, err := h.ProductService.SetEventProductsBlocked(admin, slug, blocked, reqBody.Reason)
+	if err != nil {
+		if strings.Contains(err.Error(), "unauthorized") {
+			ForbiddenError(w, err, "product")
+		} else if strings.Contains(err.Error(), "event not found") {
+			NotFoundError(w, err, "Event", "product")
+		} else {
+			HandleErrMsg("error updating products", err, w).Stack("product").BadRequest()
+		}
+		return
+	}
+
+	handleSuccess(w, result, "", http.StatusOK)
+}
+
+// CleanupOrphanedAccessTargets godoc
+// @Summary      Remove orphaned access targets
+// @Description  Deletes the access targets of the event products that point to an activity or event that no longer exists (master admins only)
+// @Tags         products
+// @Produce      json
+// @Security     Bearer
+// @Param        Authorization header string true "Bearer {access_token}"
+// @Param        Refresh header string true "Bearer {refresh_token}"
+// @Param        slug path string true "Event slug"
+// @Success      200  {object}  NoMessageSuccessResponse{data=int}
+// @Failure      400  {object}  ProductStandardErrorResponse
+// @Failure      401  {object}  ProductStandardErrorResponse
+// @Failure      403  {object}  ProductStandardErrorResponse
+// @Router       /events/{slug}/products/access-targets/orphans [delete]
+func (h *ProductHandler) CleanupOrphanedAccessTargets(w http.ResponseWriter, r *http.Request) {
+	slug, err := extractSlugAndValidate(r)
+	if err != nil {
+		BadRequestError(w, err, "product")
+		return
+	}
+
+	admin, err := getUserFromContext(h.ProductService.ProductRepo.GetUserByID, r)
+	if err != nil {
+		BadRequestError(w, err, "product")
+		return
+	}
+
+	removed, err := h.ProductService.CleanupOrphanedAccessTargets(admin, slug)
+	if err != nil {
+		if strings.Contains(err.Error(), "unauthorized") {
+			ForbiddenError(w, err, "product")
+		} else {
+			HandleErrMsg("error removing orphaned access targets", err, w).Stack("product").BadRequest()
+		}
+		return
+	}
+
+	handleSuccess(w, removed, "orphaned access targets removed", http.StatusOK)
+}
+
+// MarkDeliveredBatch godoc
+// @Summary      Mark many physical items as delivered
+// @Description  Marks a batch of physical item purchases as delivered in a single transaction (admins only).
+// @Description  Purchases can be given by ID or by the users that own the given physical product.
+// @Description  Returns a result for each purchase or user in the request
+// @Tags         products
+// @Accept       json
+// @Produce      json
+// @Security     Bearer
+// @Param        Authorization header string true "Bearer {access_token}"
+// @Param        Refresh header string true "Bearer {refresh_token}"
+// @Param        slug path string true "Event slug"
+// @Param        request body models.DeliveryBatchRequest true "Purchases or users to deliver to"
+// @Success      200  {object}  NoMessageSuccessResponse{data=[]models.DeliveryResult}
+// @Failure      400  {object}  ProductStandardErrorResponse
+// @Failure      401  {object}  ProductStandardErrorResponse
+// @Failure      403  {object}  ProductStandardErrorResponse
+// @Router       /events/{slug}/deliveries/batch [post]
+func (h *ProductHandler) MarkDeliveredBatch(w http.ResponseWriter, r *http.Request) {
+	slug, err := extractSlugAndValidate(r)
+	if err != nil {
+		BadRequestError(w, err, "product")
+		return
+	}
+
+	var reqBody models.DeliveryBatchRequest
+	if err := decodeRequestBody(r, &reqBody); err != nil {
+		BadRequestError(w, err, "product")
+		return
+	}
+
+	if len(reqBody.PurchaseIDs) == 0 && len(reqBody.UserIDs) == 0 {
+		BadRequestError(w, errors.New("purchase IDs or user IDs are required"), "product")
+		return
+	}
+
+	admin, err := getUserFromContext(h.ProductService.ProductRepo.GetUserByID, r)
+	if err != nil {
+		BadRequestError(w, err, "product")
+		return
+	}
+
+	results, err := h.ProductService.MarkDeliveredBatch(admin, slug, reqBody)
+	if err != nil {
+		if strings.Contains(err.Error(), "unauthorized") {
+			ForbiddenError(w, err, "product")
+		} else {
+			HandleErrMsg("error marking deliveries", err, w).Stack("product").BadRequest()
+		}
+		return
+	}
+
+	handleSuccess(w, results, "", http.StatusOK)
+}
+
+// MarkDelivered godoc
+// @Summary      Mark a physical item as delivered
+// @Description  Marks a physical item purchase as delivered and stamps the delivery time (admins only). Purchases already
+// @Description  delivered are left as they are and come back with success false and a message saying so
+// @Tags         products
+// @Produce      json
+// @Security     Bearer
+// @Param        Authorization header string true "Bearer {access_token}"
+// @Param        Refresh header string true "Bearer {refresh_token}"
+// @Param        slug path string true "Event slug"
+// @Param        id path string true "Purchase ID"
+// @Success      200  {object}  NoMessageSuccessResponse{data=models.DeliveryResult}
+// @Failure      400  {object}  ProductStandardErrorResponse
+// @Failure      401  {object}  ProductStandardErrorResponse
+// @Failure      403  {object}  ProductStandardErrorResponse
+// @Failure      404  {object}  ProductStandardErrorResponse
+// @Router       /events/{slug}/deliveries/{id} [post]
+func (h *ProductHandler) MarkDelivered(w http.ResponseWriter, r *http.Request) {
+	slug, err := extractSlugAndValidate(r)
+	if err != nil {
+		BadRequestError(w, err, "product")
+		return
+	}
+
+	admin, err := getUserFromContext(h.ProductService.ProductRepo.GetUserByID, r)
+	if err != nil {
+		BadRequestError(w, err, "product")
+		return
+	}
+
+	result, err := h.ProductService.MarkDelivered(admin, slug, r.PathValue("id"))
+	if err != nil {
+		switch {
+		case strings.Contains(err.Error(), "unauthorized"):
+			ForbiddenError(w, err, "product")
+		case strings.Contains(err.Error(), "not found"), strings.Contains(err.Error(), "does not belong"):
+			NotFoundError(w, err, "Purchase", "product")
+		default:
+			HandleErrMsg("error marking delivery", err, w).Stack("product").BadRequest()
+		}
+		return
+	}
+
+	handleSuccess(w, result, result.Message, http.StatusOK)
+}
+
+// GetPendingDeliveries godoc
+// @Summary      List pending deliveries
+// @Description  Lists the physical item purchases of the event not delivered yet, oldest first, with the owner that should
+// @Description  pick them up (the recipient for gifts). Refunded purchases are left out (admins only)
+// @Tags         products
+// @Produce      json
+// @Security     Bearer
+// @Param        Authorization header string true "Bearer {access_token}"
+// @Param        Refresh header string true "Bearer {refresh_token}"
+// @Param        slug path string true "Event slug"
+// @Success      200  {object}  NoMessageSuccessResponse{data=[]models.PendingDelivery}
+// @Failure      400  {object}  ProductStandardErrorResponse
+// @Failure      401  {object}  ProductStandardErrorResponse
+// @Failure      403  {object}  ProductStandardErrorResponse
+// @Failure      404  {object}  ProductStandardErrorResponse
+// @Router       /events/{slug}/pending-deliveries [get]
+func (h *ProductHandler) GetPendingDeliveries(w http.ResponseWriter, r *http.Request) {
+	slug, err := extractSlugAndValidate(r)
+	if err != nil {
+		BadRequestError(w, err, "product")
+		return
+	}
+
+	admin, err := getUserFromContext(h.ProductService.ProductRepo.GetUserByID, r)
+	if err != nil {
+		BadRequestError(w, err, "product")
+		return
+	}
+
+	pending, err := h.ProductService.GetPendingDeliveries(admin, slug)
+	if err != nil {
+		switch {
+		case strings.Contains(err.Error(), "unauthorized"):
+			ForbiddenError(w, err, "product")
+		case strings.Contains(err.Error(), "event not found"):
+			NotFoundError(w, err, "Event", "product")
+		default:
+			HandleErrMsg("error getting pending deliveries", err, w).Stack("product").BadRequest()
+		}
+		return
+	}
+
+	handleSuccess(w, pending, "", http.StatusOK)
+}
+
+// ResendGiftNotification godoc
+// @Summary      Resend a gift notification
+// @Description  Sends the gift notification email of one of the authenticated user's gift purchases to the recipient again
+// @Tags         products
+// @Produce      json
+// @Security     Bearer
+// @Param        Authorization header string true "Bearer {access_token}"
+// @Param        Refresh header string true "Bearer {refresh_token}"
+// @Param        id path string true "Purchase ID"
+// @Success      200  {object}  NoDataSuccessResponse
+// @Failure      400  {object}  ProductStandardErrorResponse
+// @Failure      401  {object}  ProductStandardErrorResponse
+// @Failure      403  {object}  ProductStandardErrorResponse
+// @Failure      404  {object}  ProductStandardErrorResponse
+// @Router       /user-gifts/{id}/resend-notification [post]
+func (h *ProductHandler) ResendGiftNotification(w http.ResponseWriter, r *http.Request) {
+	purchaseID := r.PathValue("id")
+	if purchaseID == "" {
+		BadRequestError(w, errors.New("purchase ID is required"), "product")
+		return
+	}
+
+	user, err := getUserFromContext(h.ProductService.ProductRepo.GetUserByID, r)
+	if err != nil {
+		BadRequestError(w, err, "product")
+		return
+	}
+
+	if err := h.ProductService.ResendGiftNotification(user, purchaseID); err != nil {
+		if strings.Contains(err.Error(), "unauthorized") {
+			ForbiddenError(w, err, "product")
+		} else if strings.Contains(err.Error(), "not found") {
+			NotFoundError(w, err, "Purchase", "product")
+		} else {
+			HandleErrMsg("error resending gift notification", err, w).Stack("product").BadRequest()
+		}
+		return
+	}
+
+	handleSuccess(w, nil, "gift notification sent", http.StatusOK)
+}
+
+// CancelAndRefundEvent godoc
+// @Summary      Cancel an event and refund its buyers
+// @Description  Blocks the event and, in the background, refunds every purchase of its products through Mercado Pago, removing the
+// @Description  user products, tokens and activity registrations they granted and emailing the buyers. Calling it again resumes
+// @Description  the previous run and only retries what failed. Only available to super users
+// @Tags         events
+// @Produce      json
+// @Security     Bearer
+// @Param        Authorization header string true "Bearer {access_token}"
+// @Param        Refresh header string true "Bearer {refresh_token}"
+// @Param        slug path string true "Event slug"
+// @Success      202  {object}  NoMessageSuccessResponse{data=models.EventCancellation}
+// @Failure      400  {object}  ProductStandardErrorResponse
+// @Failure      401  {object}  ProductStandardErrorResponse
+// @Failure      403  {object}  ProductStandardErrorResponse
+// @Failure      409  {object}  ProductStandardErrorResponse
+// @Router       /events/{slug}/cancel-and-refund [post]
+func (h *ProductHandler) CancelAndRefundEvent(w http.ResponseWriter, r *http.Request) {
+	slug, err := extractSlugAndValidate(r)
+	if err != nil {
+		BadRequestError(w, err, "product")
+		return
+	}
+
+	admin, err := getUserFromContext(h.ProductService.ProductRepo.GetUserByID, r)
+	if err != nil {
+		BadRequestError(w, err, "product")
+		return
+	}
+
+	cancellation, err := h.ProductService.CancelAndRefundEvent(admin, slug)
+	if err != nil {
+		switch {
+		case strings.Contains(err.Error(), "unauthorized"):
+			ForbiddenError(w, err, "product")
+		case strings.Contains(err.Error(), "already running"):
+			ConflictError(w, err, "Cancellation", "product")
+		default:
+			HandleErrMsg("error cancelling event", err, w).Stack("product").BadRequest()
+		}
+		return
+	}
+
+	handleSuccess(w, cancellation, "event cancellation started", http.StatusAccepted)
+}
+
+// GetEventCancellation godoc
+// @Summary      Get an event cancellation report
+// @Description  Returns the progress of the event cancellation and the outcome of each purchase, for manual follow-up of failures. Only available to super users
+// @Tags         events
+// @Produce      json
+// @Security     Bearer
+// @Param        Authorization header string true "Bearer {access_token}"
+// @Param        Refresh header string true "Bearer {refresh_token}"
+// @Param        slug path string true "Event slug"
+// @Success      200  {object}  NoMessageSuccessResponse{data=models.EventCancellation}
+// @Failure      400  {object}  ProductStandardErrorResponse
+// @Failure      401  {object}  ProductStandardErrorResponse
+// @Failure      403  {object}  ProductStandardErrorResponse
+// @Failure      404  {object}  ProductStandardErrorResponse
+// @Router       /events/{slug}/cancellation [get]
+func (h *ProductHandler) GetEventCancellation(w http.ResponseWriter, r *http.Request) {
+	slug, err := extractSlugAndValidate(r)
+	if err != nil {
+		BadRequestError(w, err, "product")
+		return
+	}
+
+	admin, err := getUserFromContext(h.ProductService.ProductRepo.GetUserByID, r)
+	if err != nil {
+		BadRequestError(w, err, "product")
+		return
+	}
+
+	cancellation, err := h.ProductService.GetEventCancellation(admin, slug)
+	if err != nil {
+		switch {
+		case strings.Contains(err.Error(), "unauthorized"):
+			ForbiddenError(w, err, "product")
+		case strings.Contains(err.Error(), "not found"):
+			NotFoundError(w, err, "Cancellation", "product")
+		default:
+			HandleErrMsg("error getting cancellation report", err, w).Stack("product").BadRequest()
+		}
+		return
+	}
+
+	handleSuccess(w, cancellation, "", http.StatusOK)
+}
+
+func (h *ProductHandler) handleProductAccessError(w http.ResponseWriter, err error, msg string) {
+	switch {
+	case strings.Contains(err.Error(), "unauthorized"):
+		ForbiddenError(w, err, "product")
+	case strings.Contains(err.Error(), "not found"):
+		NotFoundError(w, err, "Product access", "product")
+	default:
+		HandleErrMsg(msg, err, w).Stack("product").BadRequest()
+	}
+}
+
+// GrantProductAccess godoc
+// @Summary      Invite users to a private product
+// @Description  Allowlists users by email to buy an invite-only (non public) product (master admins only). Returns a result per email
+// @Tags         products
+// @Accept       json
+// @Produce      json
+// @Security     Bearer
+// @Param        Authorization header string true "Bearer {access_token}"
+// @Param        Refresh header string true "Bearer {refresh_token}"
+// @Param        slug path string true "Event slug"
+// @Param        id path string true "Product ID"
+// @Param        request body models.ProductAccessGrantRequest true "Emails to invite"
+// @Success      200  {object}  NoMessageSuccessResponse{data=[]models.ProductAccessGrantResult}
+// @Failure      400  {object}  ProductStandardErrorResponse
+// @Failure      401  {object}  ProductStandardErrorResponse
+// @Failure      403  {object}  ProductStandardErrorResponse
+// @Failure      404  {object}  ProductStandardErrorResponse
+// @Router       /events/{slug}/products/{id}/grants [post]
+func (h *ProductHandler) GrantProductAccess(w http.ResponseWriter, r *http.Request) {
+	slug, err := extractSlugAndValidate(r)
+	if err != nil {
+		BadRequestError(w, err, "product")
+		return
+	}
+
+	var reqBody models.ProductAccessGrantRequest
+	if err := decodeRequestBody(r, &reqBody); err != nil {
+		BadRequestError(w, err, "product")
+		return
+	}
+
+	if len(reqBody.Emails) == 0 {
+		BadRequestError(w, errors.New("at least one email is required"), "product")
+		return
+	}
+
+	admin, err := getUserFromContext(h.ProductService.ProductRepo.GetUserByID, r)
+	if err != nil {
+		BadRequestError(w, err, "product")
+		return
+	}
+
+	results, err := h.ProductService.GrantProductAccess(admin, slug, r.PathValue("id"), reqBody)
+	if err != nil {
+		h.handleProductAccessError(w, err, "error granting product access")
+		return
+	}
+
+	handleSuccess(w, results, "", http.StatusOK)
+}
+
+// GetProductAccessGrants godoc
+// @Summary      List the users invited to a private product
+// @Description  Returns the allowlist of an invite-only product (master admins only)
+// @Tags         products
+// @Produce      json
+// @Security     Bearer
+// @Param        Authorization header string true "Bearer {access_token}"
+// @Param        Refresh header string true "Bearer {refresh_token}"
+// @Param        slug path string true "Event slug"
+// @Param        id path string true "Product ID"
+// @Success      200  {object}  NoMessageSuccessResponse{data=[]models.ProductAccessGrant}
+// @Failure      400  {object}  ProductStandardErrorResponse
+// @Failure      401  {object}  ProductStandardErrorResponse
+// @Failure      403  {object}  ProductStandardErrorResponse
+// @Failure      404  {object}  ProductStandardErrorResponse
+// @Router       /events/{slug}/products/{id}/grants [get]
+func (h *ProductHandler) GetProductAccessGrants(w http.ResponseWriter, r *http.Request) {
+	slug, err := extractSlugAndValidate(r)
+	if err != nil {
+		BadRequestError(w, err, "product")
+		return
+	}
+
+	admin, err := getUserFromContext(h.ProductService.ProductRepo.GetUserByID, r)
+	if err != nil {
+		BadRequestError(w, err, "product")
+		return
+	}
+
+	grants, err := h.ProductService.GetProductAccessGrants(admin, slug, r.PathValue("id"))
+	if err != nil {
+		h.handleProductAccessError(w, err, "error getting product access grants")
+		return
+	}
+
+	handleSuccess(w, grants, "", http.StatusOK)
+}
+
+// RevokeProductAccess godoc
+// @Summary      Remove a user from a private product allowlist
+// @Description  Revokes a user's invite to buy an invite-only product, already bought products are kept (master admins only)
+// @Tags         products
+// @Produce      json
+// @Security     Bearer
+// @Param        Authorization header string true "Bearer {access_token}"
+// @Param        Refresh header string true "Bearer {refresh_token}"
+// @Param        slug path string true "Event slug"
+// @Param        id path string true "Product ID"
+// @Param        user_id path string true "User ID"
+// @Success      200  {object}  NoDataSuccessResponse
+// @Failure      400  {object}  ProductStandardErrorResponse
+// @Failure      401  {object}  ProductStandardErrorResponse
+// @Failure      403  {object}  ProductStandardErrorResponse
+// @Failure      404  {object}  ProductStandardErrorResponse
+// @Router       /events/{slug}/products/{id}/grants/{user_id} [delete]
+func (h *ProductHandler) RevokeProductAccess(w http.ResponseWriter, r *http.Request) {
+	slug, err := extractSlugAndValidate(r)
+	if err != nil {
+		BadRequestError(w, err, "product")
+		return
+	}
+
+	admin, err := getUserFromContext(h.ProductService.ProductRepo.GetUserByID, r)
+	if err != nil {
+		BadRequestError(w, err, "product")
+		return
+	}
+
+	if err := h.ProductService.RevokeProductAccess(admin, slug, r.PathValue("id"), r.PathValue("user_id")); err != nil {
+		h.handleProductAccessError(w, err, "error revoking product access")
+		return
+	}
+
+	handleSuccess(w, nil, "product access revoked", http.StatusOK)
+}
+
+// CreateCoupon godoc
+// @Summary      Create a discount coupon
+// @Description  Creates a coupon for the products of the event, or for a single product when product_id is set (master admins only).
+// @Description  Exactly one of discount_percent and discount_int must be set, both apply to each unit. Codes are matched ignoring case
+// @Tags         products
+// @Accept       json
+// @Produce      json
+// @Security     Bearer
+// @Param        Authorization header string true "Bearer {access_token}"
+// @Param        Refresh header string true "Bearer {refresh_token}"
+// @Param        slug path string true "Event slug"
+// @Param        request body models.CouponRequest true "Coupon"
+// @Success      200  {object}  NoMessageSuccessResponse{data=models.Coupon}
+// @Failure      400  {object}  ProductStandardErrorResponse
+// @Failure      401  {object}  ProductStandardErrorResponse
+// @Failure      403  {object}  ProductStandardErrorResponse
+// @Failure      404  {object}  ProductStandardErrorResponse
+// @Failure      409  {object}  ProductStandardErrorResponse
+// @Router       /events/{slug}/coupons [post]
+func (h *ProductHandler) CreateCoupon(w http.ResponseWriter, r *http.Request) {
+	slug, err := extractSlugAndValidate(r)
+	if err != nil {
+		BadRequestError(w, err, "product")
+		return
+	}
+
+	var reqBody models.CouponRequest
+	if err := decodeRequestBody(r, &reqBody); err != nil {
+		BadRequestError(w, err, "product")
+		return
+	}
+
+	admin, err := getUserFromContext(h.ProductService.ProductRepo.GetUserByID, r)
+	if err != nil {
+		BadRequestError(w, err, "product")
+		return
+	}
+
+	coupon, err := h.ProductService.CreateCoupon(admin, slug, reqBody)
+	if err != nil {
+		h.handleCouponError(w, err, "error creating coupon")
+		return
+	}
+
+	handleSuccess(w, coupon, "", http.StatusOK)
+}
+
+// GetEventCoupons godoc
+// @Summary      List the coupons of an event
+// @Description  Returns every coupon of the event with how many times it was used (master admins only)
+// @Tags         products
+// @Produce      json
+// @Security     Bearer
+// @Param        Authorization header string true "Bearer {access_token}"
+// @Param        Refresh header string true "Bearer {refresh_token}"
+// @Param        slug path string true "Event slug"
+// @Success      200  {object}  NoMessageSuccessResponse{data=[]models.Coupon}
+// @Failure      400  {object}  ProductStandardErrorResponse
+// @Failure      401  {object}  ProductStandardErrorResponse
+// @Failure      403  {object}  ProductStandardErrorResponse
+// @Failure      404  {object}  ProductStandardErrorResponse
+// @Router       /events/{slug}/coupons [get]
+func (h *ProductHandler) GetEventCoupons(w http.ResponseWriter, r *http.Request) {
+	slug, err := extractSlugAndValidate(r)
+	if err != nil {
+		BadRequestError(w, err, "product")
+		return
+	}
+
+	admin, err := getUserFromContext(h.ProductService.ProductRepo.GetUserByID, r)
+	if err != nil {
+		BadRequestError(w, err, "product")
+		return
+	}
+
+	coupons, err := h.ProductService.GetEventCoupons(admin, slug)
+	if err != nil {
+		h.handleCouponError(w, err, "error getting coupons")
+		return
+	}
+
+	handleSuccess(w, coupons, "", http.StatusOK)
+}
+
+// DeleteCoupon godoc
+// @Summary      Delete a coupon
+// @Description  Deletes a coupon so it can't be used anymore, purchases already made keep their price (master admins only)
+// @Tags         products
+// @Produce      json
+// @Security     Bearer
+// @Param        Authorization header string true "Bearer {access_token}"
+// @Param        Refresh header string true "Bearer {refresh_token}"
+// @Param        slug path string true "Event slug"
+// @Param        id path string true "Coupon ID"
+// @Success      200  {object}  NoDataSuccessResponse
+// @Failure      400  {object}  ProductStandardErrorResponse
+// @Failure      401  {object}  ProductStandardErrorResponse
+// @Failure      403  {object}  ProductStandardErrorResponse
+// @Failure      404  {object}  ProductStandardErrorResponse
+// @Router       /events/{slug}/coupons/{id} [delete]
+func (h *ProductHandler) DeleteCoupon(w http.ResponseWriter, r *http.Request) {
+	slug, err := extractSlugAndValidate(r)
+	if err != nil {
+		BadRequestError(w, err, "product")
+		return
+	}
+
+	admin, err := getUserFromContext(h.ProductService.ProductRepo.GetUserByID, r)
+	if err != nil {
+		BadRequestError(w, err, "product")
+		return
+	}
+
+	if err := h.ProductService.DeleteCoupon(admin, slug, r.PathValue("id")); err != nil {
+		h.handleCouponError(w, err, "error deleting coupon")
+		return
+	}
+
+	handleSuccess(w, nil, "coupon deleted", http.StatusOK)
+}
+
+func (h *ProductHandler) handleCouponError(w http.ResponseWriter, err error, msg string) {
+	switch {
+	case strings.Contains(err.Error(), "unauthorized"):
+		ForbiddenError(w, err, "product")
+	case strings.Contains(err.Error(), "not found"):
+		NotFoundError(w, err, "Coupon", "product")
+	case strings.Contains(err.Error(), "already exists"):
+		HandleErrMsg(msg, err, w).Stack("product").Conflict()
+	default:
+		HandleErrMsg(msg, err, w).Stack("product").BadRequest()
+	}
+}
+
+// GetProductAutoRegistrations godoc
+// @Summary      Preview the activities a product registers its buyers to
+// @Description  Returns the activities a buyer of the product is automatically registered to, the ones it targets directly
+// @Description  and the mandatory or free activities of the events it gives access to (admins only)
+// @Tags         products
+// @Produce      json
+// @Security     Bearer
+// @Param        Authorization header string true "Bearer {access_token}"
+// @Param        Refresh header string true "Bearer {refresh_token}"
+// @Param        slug path string true "Event slug"
+// @Param        id path string true "Product ID"
+// @Success      200  {object}  NoMessageSuccessResponse{data=[]models.ProductAutoRegistration}
+// @Failure      400  {object}  ProductStandardErrorResponse
+// @Failure      401  {object}  ProductStandardErrorResponse
+// @Failure      403  {object}  ProductStandardErrorResponse
+// @Failure      404  {object}  ProductStandardErrorResponse
+// @Router       /events/{slug}/products/{id}/auto-registrations [get]
+func (h *ProductHandler) GetProductAutoRegistrations(w http.ResponseWriter, r *http.Request) {
+	slug, err := extractSlugAndValidate(r)
+	if err != nil {
+		BadRequestError(w, err, "product")
+		return
+	}
+
+	admin, err := getUserFromContext(h.ProductService.ProductRepo.GetUserByID, r)
+	if err != nil {
+		BadRequestError(w, err, "product")
+		return
+	}
+
+	autoRegistrations, err := h.ProductService.GetProductAutoRegistrations(admin, slug, r.PathValue("id"))
+	if err != nil {
+		switch {
+		case strings.Contains(err.Error(), "unauthorized"):
+			ForbiddenError(w, err, "product")
+		case strings.Contains(err.Error(), "not found"):
+			NotFoundError(w, err, "Product", "product")
+		default:
+			HandleErrMsg("error getting product registrations", err, w).Stack("product").BadRequest()
+		}
+		return
+	}
+
+	handleSuccess(w, autoRegistrations, "", http.StatusOK)
+}
+
+// GetProductDeleteImpact godoc
+// @Summary      Preview the impact of deleting a product
+// @Description  Returns the purchases, owners, issued tokens and access targets of a product and whether it can be deleted,
+// @Description  with the reasons that block the deletion (admins only)
+// @Tags         products
+// @Produce      json
+// @Security     Bearer
+// @Param        Authorization header string true "Bearer {access_token}"
+// @Param        Refresh header string true "Bearer {refresh_token}"
+// @Param        slug path string true "Event slug"
+// @Param        id path string true "Product ID"
+// @Success      200  {object}  NoMessageSuccessResponse{data=models.ProductDeleteImpact}
+// @Failure      400  {object}  ProductStandardErrorResponse
+// @Failure      401  {object}  ProductStandardErrorResponse
+// @Failure      403  {object}  ProductStandardErrorResponse
+// @Failure      404  {object}  ProductStandardErrorResponse
+// @Router       /events/{slug}/products/{id}/delete-impact [get]
+func (h *ProductHandler) GetProductDeleteImpact(w http.ResponseWriter, r *http.Request) {
+	slug, err := extractSlugAndValidate(r)
+	if err != nil {
+		BadRequestError(w, err, "product")
+		return
+	}
+
+	admin, err := getUserFromContext(h.ProductService.ProductRepo.GetUserByID, r)
+	if err != nil {
+		BadRequestError(w, err, "product")
+		return
+	}
+
+	impact, err := h.ProductService.GetProductDeleteImpact(admin, slug, r.PathValue("id"))
+	if err != nil {
+		switch {
+		case strings.Contains(err.Error(), "unauthorized"):
+			ForbiddenError(w, err, "product")
+		case strings.Contains(err.Error(), "not found"):
+			NotFoundError(w, err, "Product", "product")
+		default:
+			HandleErrMsg("error getting product delete impact", err, w).Stack("product").BadRequest()
+		}
+		return
+	}
+
+	handleSuccess(w, impact, "", http.StatusOK)
+}
+
+// GetProductPrice godoc
+// @Summary      Get the effective price of a product
+// @Description  Returns the price the authenticated user would pay for a product, with the applied discounts and taxes. Without modifiers the total is the base price.
+// @Description  UENF students get the product's UENF discount, then the coupon applies and PURCHASE_TAX_PERCENT is added over the discounted price
+// @Tags         products
+// @Produce      json
+// @Security     Bearer
+// @Param        Authorization header string true "Bearer {access_token}"
+// @Param        Refresh header string true "Bearer {refresh_token}"
+// @Param        slug path string true "Event slug"
+// @Param        id path string true "Product ID"
+// @Param        quantity query int false "Quantity, defaults to 1"
+// @Param        coupon query string false "Coupon code"
+// @Success      200  {object}  NoMessageSuccessResponse{data=models.PriceBreakdown}
+// @Failure      400  {object}  ProductStandardErrorResponse
+// @Failure      401  {object}  ProductStandardErrorResponse
+// @Failure      404  {object}  ProductStandardErrorResponse
+// @Router       /events/{slug}/products/{id}/price [get]
+func (h *ProductHandler) GetProductPrice(w http.ResponseWriter, r *http.Request) {
+	slug, err := extractSlugAndValidate(r)
+	if err != nil {
+		BadRequestError(w, err, "product")
+		return
+	}
+
+	quantity := 1
+	if raw := r.URL.Query().Get("quantity"); raw != "" {
+		quantity, err = strconv.Atoi(raw)
+		if err != nil {
+			BadRequestError(w, errors.New("quantity must be a number"), "product")
+			return
+		}
+	}
+
+	user, err := getUserFromContext(h.ProductService.ProductRepo.GetUserByID, r)
+	if err != nil {
+		BadRequestError(w, err, "product")
+		return
+	}
+
+	price, err := h.ProductService.GetProductPrice(user, slug, r.PathValue("id"), quantity, r.URL.Query().Get("coupon"))
+	if err != nil {
+		if strings.Contains(err.Error(), "not found") {
+			NotFoundError(w, err, "Product", "product")
+		} else {
+			HandleErrMsg("error computing product price", err, w).Stack("product").BadRequest()
+		}
+		return
+	}
+
+	handleSuccess(w, price, "", http.StatusOK)
 }
@@ -0,0 +1,199 @@
+package handlers
+
+import (
+	"archive/zip"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"scti/internal/models"
+	"scti/internal/services"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// ReportHandler serves the downloads that gather data owned by more than one service
+type ReportHandler struct {
+	EventService   *services.EventService
+	ProductService *services.ProductService
+}
+
+func NewReportHandler(eventService *services.EventService, productService *services.ProductService) *ReportHandler {
+	return &ReportHandler{EventService: eventService, ProductService: productService}
+}
+
+// GetReportBundle godoc
+// @Summary      Download the event report bundle
+// @Description  Streams a ZIP with the attendees CSV, one attendance CSV per activity, the purchases CSV and a JSON stats summary
+// @Description  with the funnel and no-show rates, everything organizers archive at the end of an edition (master admins only)
+// @Tags         events
+// @Produce      application/zip
+// @Security     Bearer
+// @Param        Authorization header string true "Bearer {access_token}"
+// @Param        Refresh header string true "Bearer {refresh_token}"
+// @Param        slug path string true "Event slug"
+// @Success      200  {file}    file "Report bundle ZIP"
+// @Failure      400  {object}  EventStandardErrorResponse
+// @Failure      401  {object}  EventStandardErrorResponse
+// @Failure      403  {object}  EventStandardErrorResponse
+// @Failure      404  {object}  EventStandardErrorResponse
+// @Router       /events/{slug}/report-bundle [get]
+func (h *ReportHandler) GetReportBundle(w http.ResponseWriter, r *http.Request) {
+	slug, err := extractSlugAndValidate(r)
+	if err != nil {
+		handleError(w, err, http.StatusBadRequest)
+		return
+	}
+
+	admin, err := getUserFromContext(h.EventService.GetUserByID, r)
+	if err != nil {
+		handleError(w, err, http.StatusBadRequest)
+		return
+	}
+
+	// Everything but the purchases is gathered before the download starts, so errors still get a regular response
+	data, err := h.EventService.GetReportBundleData(admin, slug)
+	if err != nil {
+		if strings.Contains(err.Error(), "unauthorized") {
+			handleError(w, err, http.StatusForbidden)
+		} else if strings.Contains(err.Error(), "not found") {
+			handleError(w, err, http.StatusNotFound)
+		} else {
+			handleError(w, errors.New("error getting report bundle: "+err.Error()), http.StatusBadRequest)
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", slug+"-report.zip"))
+	w.WriteHeader(http.StatusOK)
+
+	bundle := zip.NewWriter(w)
+	if err := h.writeReportBundle(bundle, admin, slug, data); err != nil {
+		log.Printf("Failed to stream report bundle for %s: %v", slug, err)
+		return
+	}
+	if err := bundle.Close(); err != nil {
+		log.Printf("Failed to finish report bundle for %s: %v", slug, err)
+	}
+}
+
+func (h *ReportHandler) writeReportBundle(bundle *zip.Writer, admin models.User, slug string, data *models.EventReportData) error {
+	attendees := make([][]string, 0, len(data.Attendees))
+	for _, attendee := range data.Attendees {
+		checkedInAt := ""
+		if attendee.CheckedInAt != nil {
+			checkedInAt = attendee.CheckedInAt.Format(time.RFC3339)
+		}
+		attendees = append(attendees, []string{
+			attendee.UserID,
+			attendee.Name,
+			attendee.LastName,
+			attendee.Email,
+			attendee.RegisteredAt.Format(time.RFC3339),
+			checkedInAt,
+		})
+	}
+	attendeesHeader := []string{"user_id", "name", "last_name", "email", "registered_at", "checked_in_at"}
+	if err := writeBundleCSV(bundle, "attendees.csv", attendeesHeader, attendees); err != nil {
+		return err
+	}
+
+	// Records come ordered by attendance time, each activity file keeps that order
+	var activityIDs []string
+	names := make(map[string]string)
+	byActivity := make(map[string][][]string)
+	for _, record := range data.Attendance {
+		if _, ok := byActivity[record.ActivityID]; !ok {
+			activityIDs = append(activityIDs, record.ActivityID)
+			names[record.ActivityID] = record.ActivityName
+		}
+		byActivity[record.ActivityID] = append(byActivity[record.ActivityID], []string{
+			record.UserID,
+			record.Name,
+			record.LastName,
+			record.Email,
+			record.AttendedAt.Format(time.RFC3339),
+		})
+	}
+	attendanceHeader := []string{"user_id", "name", "last_name", "email", "attended_at"}
+	for _, activityID := range activityIDs {
+		filename := "attendance/" + bundleFileName(names[activityID], activityID) + ".csv"
+		if err := writeBundleCSV(bundle, filename, attendanceHeader, byActivity[activityID]); err != nil {
+			return err
+		}
+	}
+
+	entry, err := bundle.Create("purchases.csv")
+	if err != nil {
+		return err
+	}
+	purchases := csv.NewWriter(entry)
+	if err := purchases.Write(purchaseExportHeader); err != nil {
+		return err
+	}
+	err = h.ProductService.ExportEventPurchases(admin, slug, func(row models.PurchaseExportRow) error {
+		return purchases.Write(purchaseExportRecord(row))
+	})
+	if err != nil {
+		return err
+	}
+	purchases.Flush()
+	if err := purchases.Error(); err != nil {
+		return err
+	}
+
+	entry, err = bundle.Create("summary.json")
+	if err != nil {
+		return err
+	}
+	encoder := json.NewEncoder(entry)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(data.Summary)
+}
+
+func writeBundleCSV(bundle *zip.Writer, filename string, header []string, rows [][]string) error {
+	entry, err := bundle.Create(filename)
+	if err != nil {
+		return err
+	}
+
+	writer := csv.NewWriter(entry)
+	if err := writer.Write(header); err != nil {
+		return err
+	}
+	if err := writer.WriteAll(rows); err != nil {
+		return err
+	}
+	return writer.Error()
+}
+
+// bundleFileName turns an activity name into a safe file name, the ID prefix keeps repeated names apart
+func bundleFileName(name, id string) string {
+	var b strings.Builder
+	dash := false
+	for _, r := range strings.ToLower(name) {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			b.WriteRune(r)
+			dash = false
+		} else if !dash && b.Len() > 0 {
+			b.WriteRune('-')
+			dash = true
+		}
+	}
+
+	base := []rune(strings.TrimSuffix(b.String(), "-"))
+	if len(base) > 40 {
+		base = []rune(strings.TrimSuffix(string(base[:40]), "-"))
+	}
+	if len(id) > 8 {
+		id = id[:8]
+	}
+	if len(base) == 0 {
+		return id
+	}
+	return string(base) + "-" + id
+}
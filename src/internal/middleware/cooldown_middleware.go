@@ -0,0 +1,56 @@
+package middleware
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	u "scti/internal/utilities"
+)
+
+// PurchaseCooldownMiddleware rejects purchase attempts a user fires faster than the cooldown,
+// so a client retrying in a loop can't open many payment orders. Attempts are tracked in memory
+// and shared by every route wrapped with the same middleware
+func PurchaseCooldownMiddleware(cooldown time.Duration) func(http.Handler) http.Handler {
+	var mutex sync.Mutex
+	lastAttempt := make(map[string]time.Time)
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if cooldown <= 0 {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			user := u.GetUserFromContext(r.Context())
+			if user == nil {
+				u.SendError(w, []string{"user context not found"}, "cooldown-middleware", http.StatusUnauthorized)
+				return
+			}
+
+			now := time.Now()
+			mutex.Lock()
+			if last, ok := lastAttempt[user.ID]; ok && now.Sub(last) < cooldown {
+				mutex.Unlock()
+				wait := int(math.Ceil((cooldown - now.Sub(last)).Seconds()))
+				w.Header().Set("Retry-After", strconv.Itoa(wait))
+				u.SendError(w, []string{fmt.Sprintf("too many purchase attempts, try again in %d seconds", wait)}, "cooldown-middleware", http.StatusTooManyRequests)
+				return
+			}
+
+			// Forget attempts that can no longer block anyone
+			for userID, attempt := range lastAttempt {
+				if now.Sub(attempt) >= cooldown {
+					delete(lastAttempt, userID)
+				}
+			}
+			lastAttempt[user.ID] = now
+			mutex.Unlock()
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
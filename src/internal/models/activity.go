@@ -15,6 +15,16 @@ const (
 	ActivityHard   ActivityLevel = "hard"
 )
 
+// CheckInMethod is how attendance is taken in an activity. Staff can mark attendance with any of them,
+// self service additionally lets registered users check themselves in while the session runs
+type CheckInMethod string
+
+const (
+	CheckInAdminQR     CheckInMethod = "admin_qr"     // Staff scan the attendee QR code at the door
+	CheckInManual      CheckInMethod = "manual"       // Staff mark attendance from the registration list
+	CheckInSelfService CheckInMethod = "self_service" // Registered users mark their own attendance
+)
+
 type ActivityWithSlotsDTO struct {
 	Activity       Activity           `json:"activity"`
 	AvailableSlots AvailableSlotsInfo `json:"available_slots"`
@@ -34,12 +44,18 @@ type Activity struct {
 
 	EventID string `gorm:"type:varchar(36);index" json:"event_id" example:"550e8400-e29b-41d4-a716-446655440001"`
 
-	Name         string        `gorm:"type:varchar(100);not null" json:"name" example:"Workshop de Go"`
-	Description  string        `json:"description" example:"Workshop introdutório sobre a linguagem Go"`
-	Speaker      string        `json:"speaker" example:"John Doe"`
-	Location     string        `json:"location" example:"Sala 101"`
-	Requirements string        `gorm:"type:varchar(1024)" json:"requirements"`
-	Level        ActivityLevel `gorm:"not null" json:"level"`
+	Name        string        `gorm:"type:varchar(100);not null" json:"name" example:"Workshop de Go"`
+	Description string        `json:"description" example:"Workshop introdutório sobre a linguagem Go"`
+	Speaker     string        `json:"speaker" example:"John Doe"`
+	Location    string        `json:"location" example:"Sala 101"`
+	Level       ActivityLevel `gorm:"not null" json:"level"`
+
+	SpeakerUserID *string `gorm:"type:varchar(36);index" json:"speaker_user_id"` // Account of the speaker, lets them see the session roster
+
+	// Requirements is the free text shown to attendees, the items are what they must acknowledge
+	// before registering (bring a laptop, know Python...)
+	Requirements     string   `gorm:"type:varchar(1024)" json:"requirements" example:"VSCode e Python 3.12"`
+	RequirementItems []string `gorm:"serializer:json" json:"requirement_items" example:"Notebook,Python 3.12"`
 
 	// Changed from int to boolean flags for capacity management
 	HasUnlimitedCapacity bool `gorm:"default:false" json:"has_unlimited_capacity" example:"true"` // Whether activity has unlimited capacity
@@ -50,6 +66,12 @@ type Activity struct {
 	StartTime time.Time `gorm:"not null" json:"start_time" example:"2024-10-15T14:00:00Z"`
 	EndTime   time.Time `gorm:"not null" json:"end_time" example:"2024-10-15T16:00:00Z"`
 
+	DisplayOrder int `gorm:"default:0" json:"display_order" example:"0"` // Orders activities sharing the same start time, such as parallel tracks
+
+	AttendanceFinalizedAt *time.Time `json:"attendance_finalized_at"` // Set once no-shows were marked, attendance can't change afterwards
+
+	CheckInMethod CheckInMethod `gorm:"type:varchar(20);default:admin_qr" json:"check_in_method" example:"admin_qr"`
+
 	// Access control
 	IsMandatory bool `gorm:"default:false" json:"is_mandatory" example:"true"` // If users need to be registered automatically
 	HasFee      bool `gorm:"default:false" json:"has_fee" example:"true"`      // If an event ticket or token is required
@@ -76,13 +98,19 @@ type ActivityRegistration struct {
 	UserID     string `gorm:"type:varchar(36);primaryKey" json:"user_id"`
 
 	RegisteredAt time.Time  `gorm:"autoCreateTime" json:"registered_at"`
-	AttendedAt   *time.Time `json:"attended_at"` // Time of attendance, null if not attended yet
+	AttendedAt   *time.Time `json:"attended_at"`                  // Time of attendance, null if not attended yet
+	NoShow       bool       `gorm:"default:false" json:"no_show"` // Set when attendance was finalized without the user showing up
 
 	// Access method tracking
 	AccessMethod string  `gorm:"type:varchar(20)" json:"access_method"` // "event", "product", "token", or "direct"
 	ProductID    *string `gorm:"type:varchar(36)" json:"product_id"`    // Which product was used (if applicable)
 	TokenID      *string `gorm:"type:varchar(36)" json:"token_id"`      // Which token was used (if applicable)
 
+	// Set while a waitlist promotion waits for the user's confirmation, null otherwise
+	ConfirmBy *time.Time `json:"confirm_by"`
+
+	ShareContact bool `gorm:"default:false" json:"share_contact"` // The user agreed to show their email to the speaker
+
 	CreatedAt time.Time      `gorm:"autoCreateTime" json:"created_at"`
 	UpdatedAt time.Time      `gorm:"autoUpdateTime" json:"updated_at"`
 	DeletedAt gorm.DeletedAt `gorm:"index" json:"deleted_at,omitempty"`
@@ -92,12 +120,37 @@ func (ActivityRegistration) TableName() string {
 	return "activity_registrations"
 }
 
+type WaitlistStatus string
+
+const (
+	WaitlistWaiting WaitlistStatus = "waiting" // Queued for a seat
+	WaitlistOffered WaitlistStatus = "offered" // Promoted, waiting for confirmation
+	WaitlistExpired WaitlistStatus = "expired" // Promotion was not confirmed in time
+)
+
+// ActivityWaitlist queues users for a full activity, served in CreatedAt order
+type ActivityWaitlist struct {
+	ID         string         `gorm:"type:varchar(36);primaryKey" json:"id"`
+	ActivityID string         `gorm:"type:varchar(36);index" json:"activity_id"`
+	UserID     string         `gorm:"type:varchar(36);index" json:"user_id"`
+	Status     WaitlistStatus `gorm:"type:varchar(20);default:waiting" json:"status"`
+
+	CreatedAt time.Time      `gorm:"autoCreateTime" json:"created_at"`
+	UpdatedAt time.Time      `gorm:"autoUpdateTime" json:"updated_at"`
+	DeletedAt gorm.DeletedAt `gorm:"index" json:"deleted_at,omitempty"`
+}
+
+func (ActivityWaitlist) TableName() string {
+	return "activity_waitlists"
+}
+
 type ActivityType string
 
 const (
 	ActivityPalestra      ActivityType = "palestra"
 	ActivityMiniCurso     ActivityType = "mini-curso"
 	ActivityVisitaTecnica ActivityType = "visita-tecnica"
+	ActivityCoffeeBreak   ActivityType = "coffee-break"
 )
 
 type AccessMethod string
@@ -109,8 +162,103 @@ const (
 	AccessMethodToken   AccessMethod = "token"
 )
 
+// ActivityFilter narrows the event schedule, zero fields don't filter
+type ActivityFilter struct {
+	Type    ActivityType
+	Speaker string     // Matched ignoring case, as part of the speaker name
+	From    *time.Time // Activities starting at or after
+	To      *time.Time // Activities ending at or before
+}
+
+func (f ActivityFilter) IsEmpty() bool {
+	return f.Type == "" && f.Speaker == "" && f.From == nil && f.To == nil
+}
+
 // ----------------- Request and Response Models ----------------- //
 
+// SpeakerConflict is a pair of activities given by the same speaker in overlapping time windows
+type SpeakerConflict struct {
+	Speaker                 string    `json:"speaker"`
+	ActivityID              string    `json:"activity_id"`
+	ActivityName            string    `json:"activity_name"`
+	ConflictingActivityID   string    `json:"conflicting_activity_id"`
+	ConflictingActivityName string    `json:"conflicting_activity_name"`
+	OverlapStart            time.Time `json:"overlap_start"`
+	OverlapEnd              time.Time `json:"overlap_end"`
+}
+
+// SpeakerLoad groups the activities of a speaker, names are matched ignoring case and extra spaces
+type SpeakerLoad struct {
+	Speaker    string            `json:"speaker"`
+	Activities int               `json:"activities"`
+	TotalHours float64           `json:"total_hours"`
+	Conflicts  []SpeakerConflict `json:"conflicts"`
+}
+
+// RoomConflict is a pair of activities booked in the same location at overlapping times
+type RoomConflict struct {
+	Location                string    `json:"location"`
+	ActivityID              string    `json:"activity_id"`
+	ActivityName            string    `json:"activity_name"`
+	ConflictingActivityID   string    `json:"conflicting_activity_id"`
+	ConflictingActivityName string    `json:"conflicting_activity_name"`
+	OverlapStart            time.Time `json:"overlap_start"`
+	OverlapEnd              time.Time `json:"overlap_end"`
+}
+
+type RoomInput struct {
+	Name     string `json:"name" example:"Sala 101"`
+	Capacity int    `json:"capacity" example:"40"`
+}
+
+type SuggestRoomsRequest struct {
+	Rooms []RoomInput `json:"rooms"`
+}
+
+// RoomAssignment is where the suggestion puts an activity, demand counts registered and waitlisted users
+type RoomAssignment struct {
+	ActivityID      string    `json:"activity_id"`
+	Name            string    `json:"name"`
+	StartTime       time.Time `json:"start_time"`
+	EndTime         time.Time `json:"end_time"`
+	Demand          int       `json:"demand"`
+	CurrentLocation string    `json:"current_location"`
+	Room            string    `json:"room,omitempty"`
+	RoomCapacity    int       `json:"room_capacity,omitempty"`
+	Reason          string    `json:"reason,omitempty"` // Why the activity was left without a room
+}
+
+type RoomSuggestion struct {
+	Assignments []RoomAssignment `json:"assignments"`
+	Unassigned  []RoomAssignment `json:"unassigned"`
+}
+
+type CheckSlotRequest struct {
+	StartTime         time.Time `json:"start_time" example:"2024-10-15T14:00:00Z"`
+	EndTime           time.Time `json:"end_time" example:"2024-10-15T16:00:00Z"`
+	Location          string    `json:"location" example:"Sala 101"`
+	ExcludeActivityID string    `json:"exclude_activity_id,omitempty"` // Leaves out the activity being rescheduled
+}
+
+// SlotConflict is an event activity running during a proposed time window
+type SlotConflict struct {
+	ActivityID   string       `json:"activity_id"`
+	Name         string       `json:"name"`
+	Type         ActivityType `json:"type"`
+	Speaker      string       `json:"speaker"`
+	Location     string       `json:"location"`
+	StartTime    time.Time    `json:"start_time"`
+	EndTime      time.Time    `json:"end_time"`
+	OverlapStart time.Time    `json:"overlap_start"`
+	OverlapEnd   time.Time    `json:"overlap_end"`
+	SameLocation bool         `json:"same_location"`
+}
+
+type SlotCheckResult struct {
+	Overlapping     []SlotConflict `json:"overlapping"`
+	LocationClashes []SlotConflict `json:"location_clashes"` // Subset of overlapping in the same location
+}
+
 type CreateActivityRequest struct {
 	Name                 string        `json:"name" example:"Workshop de Go"`
 	Description          string        `json:"description" example:"Workshop introdutório sobre a linguagem Go"`
@@ -127,6 +275,11 @@ type CreateActivityRequest struct {
 	IsBlocked            bool          `json:"is_blocked" example:"false"`
 	Level                ActivityLevel `json:"level" example:"easy"`
 	Requirements         string        `json:"requirements" example:"VSCode e Python 3.12"`
+	RequirementItems     []string      `json:"requirement_items" example:"Notebook,Python 3.12"`
+	CheckInMethod        CheckInMethod `json:"check_in_method,omitempty" example:"admin_qr"` // Defaults to admin_qr on creation and keeps the current one on updates
+	SpeakerUserID        *string       `json:"speaker_user_id,omitempty"`                    // Account of the speaker, optional
+
+	RejectSpeakerConflicts bool `json:"reject_speaker_conflicts" example:"false"` // Fail instead of warning when the speaker is double-booked
 }
 
 type ActivityUpdateRequest struct {
@@ -146,13 +299,219 @@ type ActivityUpdateRequest struct {
 	IsBlocked            bool          `json:"is_blocked" example:"false"`
 	Level                ActivityLevel `json:"level" example:"easy"`
 	Requirements         string        `json:"requirements" example:"VSCode e Python 3.12"`
+	RequirementItems     []string      `json:"requirement_items" example:"Notebook,Python 3.12"`
+	CheckInMethod        CheckInMethod `json:"check_in_method,omitempty" example:"admin_qr"` // Defaults to admin_qr on creation and keeps the current one on updates
+	SpeakerUserID        *string       `json:"speaker_user_id,omitempty"`                    // Omit to keep the current speaker account, send an empty string to unlink it
+
+	RejectSpeakerConflicts bool `json:"reject_speaker_conflicts" example:"false"` // Fail instead of warning when the speaker is double-booked
 }
 
 type ActivityRegistrationRequest struct {
-	ActivityID string `json:"activity_id" example:"550e8400-e29b-41d4-a716-446655440000"`
-	UserID     string `json:"user_id,omitempty" example:"550e8400-e29b-41d4-a716-446655440000"` // Optional, used for admin actions on other users
+	ActivityID               string `json:"activity_id" example:"550e8400-e29b-41d4-a716-446655440000"`
+	UserID                   string `json:"user_id,omitempty" example:"550e8400-e29b-41d4-a716-446655440000"` // Optional, used for admin actions on other users
+	AcknowledgedRequirements bool   `json:"acknowledged_requirements,omitempty" example:"true"`               // Required when the activity lists requirement items
+}
+
+type BatchActivityRegistrationRequest struct {
+	ActivityIDs              []string `json:"activity_ids"`
+	AcknowledgedRequirements bool     `json:"acknowledged_requirements,omitempty" example:"true"` // Acknowledges the requirements of every activity in the batch
+}
+
+// BatchActivityRegistrationResult is the outcome of one activity of a batch registration
+type BatchActivityRegistrationResult struct {
+	ActivityID   string       `json:"activity_id"`
+	Registered   bool         `json:"registered"`
+	AccessMethod AccessMethod `json:"access_method,omitempty"` // How the user got in, token when one of their tokens was spent
+	Error        string       `json:"error,omitempty"`         // Why the activity was skipped
+}
+
+type AttendBatchRequest struct {
+	ActivityID string   `json:"activity_id" example:"550e8400-e29b-41d4-a716-446655440000"`
+	UserIDs    []string `json:"user_ids"`
+}
+
+type AttendBatchStatus string
+
+const (
+	AttendBatchSuccess         AttendBatchStatus = "success"
+	AttendBatchAlreadyAttended AttendBatchStatus = "already_attended"
+	AttendBatchNotRegistered   AttendBatchStatus = "not_registered"
+)
+
+// AttendBatchResult is the outcome of one user of a batch attendance
+type AttendBatchResult struct {
+	UserID string            `json:"user_id"`
+	Status AttendBatchStatus `json:"status"`
+}
+
+// AttendQRResponse identifies the scanned user, the attendance is only marked when they are registered
+type AttendQRResponse struct {
+	UserID          string `json:"user_id"`
+	Name            string `json:"name"`
+	LastName        string `json:"last_name"`
+	Registered      bool   `json:"registered"`       // Whether the user is registered for the activity
+	AlreadyAttended bool   `json:"already_attended"` // The attendance was marked by an earlier scan
+}
+
+type AttendCurrentRequest struct {
+	UserID string `json:"user_id" example:"550e8400-e29b-41d4-a716-446655440000"` // Scanned from the user's QR code
+}
+
+// AttendCurrentResponse holds the activity marked as attended, or the candidates
+// when more than one activity the user is registered for is in progress
+type AttendCurrentResponse struct {
+	Attended   *Activity  `json:"attended,omitempty"`
+	Candidates []Activity `json:"candidates,omitempty"`
+}
+
+type CheckinBucket struct {
+	Start time.Time `json:"start"`
+	Count int       `json:"count"`
+}
+
+// CheckinTrend is the arrival flow of an activity, buckets between the first and last check-in are
+// all present, empty ones with a zero count
+type CheckinTrend struct {
+	ActivityID string          `json:"activity_id"`
+	Interval   string          `json:"interval" example:"5m"`
+	Total      int             `json:"total"`
+	Buckets    []CheckinBucket `json:"buckets"`
+}
+
+type BackfillMandatoryResult struct {
+	ActivityID  string `json:"activity_id"`
+	Registrants int64  `json:"registrants"` // Users registered to the event
+	Registered  int64  `json:"registered"`  // Registrants newly registered to the activity
+	Skipped     int64  `json:"skipped"`     // Registrants that already had a registration
+}
+
+type FinalizeAttendanceResult struct {
+	ActivityID  string    `json:"activity_id"`
+	NoShows     int64     `json:"no_shows"` // Registrations marked as no-shows
+	FinalizedAt time.Time `json:"finalized_at"`
 }
 
 type ActivityDeleteRequest struct {
 	ActivityID string `json:"activity_id" example:"550e8400-e29b-41d4-a716-446655440000"`
 }
+
+type ShareContactRequest struct {
+	ActivityID   string `json:"activity_id" example:"550e8400-e29b-41d4-a716-446655440000"`
+	ShareContact bool   `json:"share_contact" example:"true"`
+}
+
+// SpeakerRosterEntry is a registrant as the speaker sees them, the email is only there when the user opted in
+type SpeakerRosterEntry struct {
+	Name     string  `json:"name"`
+	LastName string  `json:"last_name"`
+	Email    *string `json:"email"`
+	Attended bool    `json:"attended"`
+}
+
+// UserWaitlistEntry is a waitlist entry of the user with its activity and event context
+type UserWaitlistEntry struct {
+	ID                string         `json:"id"`
+	ActivityID        string         `json:"activity_id"`
+	ActivityName      string         `json:"activity_name"`
+	ActivityStartTime time.Time      `json:"activity_start_time"`
+	EventID           string         `json:"event_id"`
+	EventSlug         string         `json:"event_slug"`
+	EventName         string         `json:"event_name"`
+	Status            WaitlistStatus `json:"status"`
+	Position          int            `json:"position"`             // 1 is next in line, 0 while a seat is offered
+	ConfirmBy         *time.Time     `json:"confirm_by,omitempty"` // Deadline to confirm an offered seat
+	JoinedAt          time.Time      `json:"joined_at"`
+}
+
+type ActivityTypeCount struct {
+	Type  ActivityType `json:"type" example:"palestra"`
+	Count int          `json:"count" example:"12"`
+}
+
+// ActivityCapacitySnapshot is the capacity health of one activity for the admin control room
+type ActivityCapacitySnapshot struct {
+	ActivityID           string    `json:"activity_id"`
+	Name                 string    `json:"name"`
+	StartTime            time.Time `json:"start_time"`
+	HasUnlimitedCapacity bool      `json:"has_unlimited_capacity"`
+	Registered           int       `json:"registered"`
+	Max                  int       `json:"max"`        // 0 when capacity is unlimited
+	Waitlisted           int       `json:"waitlisted"` // Users still waiting for a seat
+	Available            int       `json:"available"`  // -1 when capacity is unlimited
+}
+
+// ActivityDemand tells organizers whether an activity outgrew its room, the demand ratio is
+// (registered + waitlisted) / capacity and stays null for unlimited capacity activities
+type ActivityDemand struct {
+	ActivityID           string   `json:"activity_id"`
+	Name                 string   `json:"name"`
+	HasUnlimitedCapacity bool     `json:"has_unlimited_capacity"`
+	Capacity             int      `json:"capacity"` // 0 when capacity is unlimited
+	Registered           int64    `json:"registered"`
+	Waitlisted           int64    `json:"waitlisted"` // Users still waiting for a seat
+	DemandRatio          *float64 `json:"demand_ratio"`
+}
+
+// EligibleActivity is an activity the user can register to without paying, with the access that would be used
+type EligibleActivity struct {
+	Activity     Activity     `json:"activity"`
+	AccessMethod AccessMethod `json:"access_method" example:"token"` // event (free), product or token
+}
+
+// TokenRedeemableActivities lists the fee activities the user would spend one of their event tokens on
+type TokenRedeemableActivities struct {
+	UnusedTokens int        `json:"unused_tokens"`
+	Activities   []Activity `json:"activities"`
+}
+
+// ActivityRevenue estimates what a fee activity brought in from the tokens redeemed on it,
+// each token is worth its product price divided by the tokens the product grants
+type ActivityRevenue struct {
+	ActivityID     string    `json:"activity_id"`
+	Name           string    `json:"name"`
+	StartTime      time.Time `json:"start_time"`
+	TokensRedeemed int64     `json:"tokens_redeemed"`
+	RevenueInt     int       `json:"revenue_int"` // In cents
+}
+
+// CoffeeBreakLive is a row of the catering board, attended counts the users served at the door
+type CoffeeBreakLive struct {
+	ActivityID           string    `json:"activity_id"`
+	Name                 string    `json:"name"`
+	Location             string    `json:"location"`
+	StartTime            time.Time `json:"start_time"`
+	EndTime              time.Time `json:"end_time"`
+	HasUnlimitedCapacity bool      `json:"has_unlimited_capacity"`
+	Max                  int       `json:"max"` // 0 when capacity is unlimited
+	Registered           int       `json:"registered"`
+	Attended             int       `json:"attended"`
+	IsActive             bool      `json:"is_active"` // Whether the coffee break is happening right now
+}
+
+// FeeActivityAccess tells organizers how a fee activity can be unlocked
+type FeeActivityAccess struct {
+	ActivityID       string    `json:"activity_id"`
+	Name             string    `json:"name"`
+	StartTime        time.Time `json:"start_time"`
+	IsHidden         bool      `json:"is_hidden"`
+	ProductIDs       []string  `json:"product_ids"`       // Purchasable products whose access targets grant the activity
+	TokenPurchasable bool      `json:"token_purchasable"` // The event sells activity tokens that can pay for it
+	IsOrphaned       bool      `json:"is_orphaned"`       // Nothing on sale unlocks the activity
+}
+
+// SkippedActivity is an activity a bulk operation left untouched and why
+type SkippedActivity struct {
+	ActivityID string `json:"activity_id"`
+	Name       string `json:"name"`
+	Reason     string `json:"reason"`
+}
+
+type HiddenActivitiesPurgeResult struct {
+	Deleted    int               `json:"deleted"`
+	DeletedIDs []string          `json:"deleted_ids"`
+	Skipped    []SkippedActivity `json:"skipped"` // Hidden activities kept because users registered to them
+}
+
+type ActivityReorderRequest struct {
+	ActivityIDs []string `json:"activity_ids"` // Activities in their new display order
+}
@@ -0,0 +1,58 @@
+package models
+
+import "time"
+
+type AuditAction string
+
+const (
+	AuditProductsBlocked   AuditAction = "products_blocked"   // Every product of the event was blocked at once
+	AuditProductsUnblocked AuditAction = "products_unblocked" // Every product of the event was unblocked at once
+
+	AuditActivityCapacityChanged AuditAction = "activity_capacity_changed" // Max capacity or unlimited flag of an activity changed
+
+	AuditEventCreatorGranted AuditAction = "event_creator_granted" // A user got permission to create events
+	AuditEventCreatorRevoked AuditAction = "event_creator_revoked" // A user lost permission to create events
+)
+
+// AuditLog records sensitive admin actions with who did them and why
+type AuditLog struct {
+	ID       string      `gorm:"type:varchar(36);primaryKey" json:"id"`
+	EventID  *string     `gorm:"type:varchar(36);index" json:"event_id"`
+	ActorID  string      `gorm:"type:varchar(36);index" json:"actor_id"`
+	Action   AuditAction `gorm:"type:varchar(50);index" json:"action"`
+	TargetID *string     `gorm:"type:varchar(36);index" json:"target_id"` // Entity the action was applied to, if a single one
+	Reason   string      `gorm:"type:varchar(500)" json:"reason"`
+	Details  string      `gorm:"type:text" json:"details"` // JSON with action specific values
+
+	CreatedAt time.Time `gorm:"autoCreateTime" json:"created_at"`
+}
+
+func (AuditLog) TableName() string {
+	return "audit_logs"
+}
+
+// CapacityChangeDetails is the Details payload of AuditActivityCapacityChanged entries
+type CapacityChangeDetails struct {
+	OldMaxCapacity int  `json:"old_max_capacity"`
+	NewMaxCapacity int  `json:"new_max_capacity"`
+	OldUnlimited   bool `json:"old_unlimited"`
+	NewUnlimited   bool `json:"new_unlimited"`
+	Registered     int  `json:"registered"` // Registrations when the change was made
+}
+
+// CapacityChange is a capacity audit entry with its actor
+type CapacityChange struct {
+	CapacityChangeDetails
+	ID         string    `json:"id"`
+	ActorID    string    `json:"actor_id"`
+	ActorName  string    `json:"actor_name"`
+	ActorEmail string    `json:"actor_email"`
+	ChangedAt  time.Time `json:"changed_at"`
+}
+
+// AuditEntry is an audit log row with its actor's name and email
+type AuditEntry struct {
+	AuditLog
+	ActorName  string `json:"actor_name"`
+	ActorEmail string `json:"actor_email"`
+}
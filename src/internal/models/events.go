@@ -12,6 +12,7 @@ type Event struct {
 	Name        string    `gorm:"type:varchar(100);not null"`
 	Description string    `json:"description"`
 	Location    string    `json:"location"`
+	Venue       string    `gorm:"type:varchar(150);index" json:"venue"` // Physical space shared across events, matched ignoring case
 	StartDate   time.Time `gorm:"not null" json:"start_date"`
 	EndDate     time.Time `gorm:"not null" json:"end_date"`
 
@@ -41,8 +42,12 @@ type EventRegistration struct {
 	EventID string `gorm:"type:varchar(36);primaryKey" json:"event_id"`
 	UserID  string `gorm:"type:varchar(36);primaryKey" json:"user_id"`
 
-	RegisteredAt time.Time `gorm:"autoCreateTime" json:"registered_at"`
-	// CheckedInAt  *time.Time `json:"checked_in_at"` // Time of check-in if applicable, null if not checked in yet
+	RegisteredAt time.Time  `gorm:"autoCreateTime" json:"registered_at"`
+	CheckedInAt  *time.Time `json:"checked_in_at"` // First attendance marked in the event, null if not checked in yet
+
+	// Outcome of the confirmation email, both null while it's still being sent
+	EmailSentAt *time.Time `json:"email_sent_at"`
+	EmailError  *string    `json:"email_error,omitempty"`
 
 	// Product used for registration, I.E a ticket
 	ProductID *string `gorm:"type:varchar(36)" json:"product_id"` // Which product granted access
@@ -69,6 +74,7 @@ type CreateEventRequest struct {
 	StartDate   time.Time `json:"start_date" example:"2025-05-01T14:00:00Z"`
 	EndDate     time.Time `json:"end_date" example:"2025-05-01T17:00:00Z"`
 	Location    string    `json:"location" example:"Room 101"`
+	Venue       string    `json:"venue" example:"Centro de Convenções UENF"`
 
 	MaxTokensPerUser int `json:"max_tokens_per_user" example:"1"`
 
@@ -81,6 +87,7 @@ type UpdateEventRequest struct {
 	Name        string    `json:"name" example:"Updated Workshop"`
 	Description string    `json:"description" example:"Updated workshop description"`
 	Location    string    `json:"location" example:"Room 202"`
+	Venue       string    `json:"venue" example:"Centro de Convenções UENF"`
 	StartDate   time.Time `json:"start_date" example:"2030-11-11T00:00:00Z"`
 	EndDate     time.Time `json:"end_date" example:"2030-11-11T23:59:59Z"`
 
@@ -89,3 +96,480 @@ type UpdateEventRequest struct {
 	IsHidden  bool `json:"is_hidden" example:"true"`
 	IsBlocked bool `json:"is_blocked" example:"false"`
 }
+
+// VenueConflict is another event held at the same venue during an overlapping period
+type VenueConflict struct {
+	EventID   string    `json:"event_id"`
+	Slug      string    `json:"slug"`
+	Name      string    `json:"name"`
+	Venue     string    `json:"venue"`
+	StartDate time.Time `json:"start_date"`
+	EndDate   time.Time `json:"end_date"`
+}
+
+// EventAttendee is the public profile of a registered user, account flags and credentials left out
+type EventAttendee struct {
+	ID           string `json:"id"`
+	Name         string `json:"name"`
+	LastName     string `json:"last_name"`
+	Email        string `json:"email"`
+	IsUenf       bool   `json:"is_uenf"`
+	UenfSemester int    `json:"uenf_semester"`
+}
+
+type UnpaidRegistrant struct {
+	UserID       string    `json:"user_id"`
+	Name         string    `json:"name"`
+	LastName     string    `json:"last_name"`
+	Email        string    `json:"email"`
+	RegisteredAt time.Time `json:"registered_at"`
+}
+
+// AttendanceManifest is the attendance export for downstream systems, sent with an
+// x-signature header so they can check it was not changed on the way
+type AttendanceManifest struct {
+	Event       AttendanceManifestEvent `json:"event"`
+	GeneratedAt time.Time               `json:"generated_at"`
+	Records     []AttendanceRecord      `json:"records"`
+}
+
+type AttendanceManifestEvent struct {
+	ID        string    `json:"id"`
+	Slug      string    `json:"slug"`
+	Name      string    `json:"name"`
+	StartDate time.Time `json:"start_date"`
+	EndDate   time.Time `json:"end_date"`
+}
+
+type AttendanceRecord struct {
+	ActivityID   string    `json:"activity_id"`
+	ActivityName string    `json:"activity_name"`
+	UserID       string    `json:"user_id"`
+	Name         string    `json:"name"`
+	LastName     string    `json:"last_name"`
+	Email        string    `json:"email"`
+	AttendedAt   time.Time `json:"attended_at"`
+}
+
+type EventAttendeeRow struct {
+	UserID       string     `json:"user_id"`
+	Name         string     `json:"name"`
+	LastName     string     `json:"last_name"`
+	Email        string     `json:"email"`
+	RegisteredAt time.Time  `json:"registered_at"`
+	CheckedInAt  *time.Time `json:"checked_in_at"`
+}
+
+type AttendanceExportRow struct {
+	Name         string    `json:"name"`
+	LastName     string    `json:"last_name"`
+	Email        string    `json:"email"`
+	ActivityName string    `json:"activity_name"`
+	AttendedAt   time.Time `json:"attended_at"`
+	AccessMethod string    `json:"access_method"`
+}
+
+// EventReportSummary is the stats file of the end of event report bundle
+type EventReportSummary struct {
+	Event       AttendanceManifestEvent `json:"event"`
+	GeneratedAt time.Time               `json:"generated_at"`
+	Registrants int                     `json:"registrants"`
+	CheckIns    int                     `json:"check_ins"` // Activity attendances marked
+	Funnel      EventFunnel             `json:"funnel"`
+	NoShowRates []ActivityNoShowRate    `json:"no_show_rates"`
+}
+
+type EventReportData struct {
+	Attendees  []EventAttendeeRow
+	Attendance []AttendanceRecord
+	Summary    EventReportSummary
+}
+
+// RegistrationInterval is the time window a registered user is expected in a session
+type RegistrationInterval struct {
+	UserID    string
+	StartTime time.Time
+	EndTime   time.Time
+}
+
+type OccupancyPoint struct {
+	Time  time.Time `json:"time"`
+	Count int       `json:"count"` // Distinct users in sessions from this time until the next point
+}
+
+type EventOccupancy struct {
+	Peak     int              `json:"peak"`
+	PeakAt   *time.Time       `json:"peak_at"`
+	Timeline []OccupancyPoint `json:"timeline"`
+}
+
+// ActivityNoShowRate compares registrations and attendance of an ended activity
+type ActivityNoShowRate struct {
+	ActivityID string    `json:"activity_id"`
+	Name       string    `json:"name"`
+	StartTime  time.Time `json:"start_time"`
+	EndTime    time.Time `json:"end_time"`
+	Registered int       `json:"registered"`
+	Attended   int       `json:"attended"`
+	NoShows    int       `json:"no_shows"`
+	NoShowRate float64   `json:"no_show_rate"` // Percentage of registered users that didn't attend
+	Finalized  bool      `json:"finalized"`    // Whether the no-shows were marked by finalizing the attendance
+}
+
+type ActivityParticipation struct {
+	ActivityID string     `json:"activity_id"`
+	Name       string     `json:"name"`
+	Type       string     `json:"type"`
+	StartTime  time.Time  `json:"start_time"`
+	EndTime    time.Time  `json:"end_time"`
+	AttendedAt *time.Time `json:"attended_at"`
+	ConfirmBy  *time.Time `json:"confirm_by"` // Set while a waitlist promotion waits for confirmation
+}
+
+type OwnedEventProduct struct {
+	ProductID    string `json:"product_id"`
+	Name         string `json:"name"`
+	IsTicketType bool   `json:"is_ticket_type"`
+	Quantity     int    `json:"quantity"`
+}
+
+// EventParticipationSummary gathers everything a user has in an event for the profile page
+type EventParticipationSummary struct {
+	EventID         string                  `json:"event_id"`
+	EventSlug       string                  `json:"event_slug"`
+	EventName       string                  `json:"event_name"`
+	IsRegistered    bool                    `json:"is_registered"`
+	RegisteredAt    *time.Time              `json:"registered_at"`
+	HasTicket       bool                    `json:"has_ticket"`
+	Activities      []ActivityParticipation `json:"activities"`
+	AttendedCount   int                     `json:"attended_count"`
+	TokensAvailable int                     `json:"tokens_available"`
+	TokensUsed      int                     `json:"tokens_used"`
+	Products        []OwnedEventProduct     `json:"products"`
+}
+
+// EventFunnel counts the registrants at each stage the backend can tell apart, rates are
+// percentages of the registrations. Page views aren't tracked, so the funnel starts at registration
+type EventFunnel struct {
+	Registered   int64   `json:"registered"`
+	Paid         int64   `json:"paid"`     // Registrants owning a ticket
+	Attended     int64   `json:"attended"` // Registrants that attended at least one activity
+	PaidRate     float64 `json:"paid_rate"`
+	AttendedRate float64 `json:"attended_rate"`
+}
+
+type TimelineEntryKind string
+
+const (
+	TimelineRegistered       TimelineEntryKind = "registered"
+	TimelineCheckedIn        TimelineEntryKind = "checked_in"
+	TimelineActivityAttended TimelineEntryKind = "activity_attended"
+)
+
+// TimelineEntry is a step of the user's journey through an event
+type TimelineEntry struct {
+	Kind         TimelineEntryKind `json:"kind"`
+	At           time.Time         `json:"at"`
+	ActivityID   string            `json:"activity_id,omitempty"`
+	ActivityName string            `json:"activity_name,omitempty"`
+}
+
+type CancellationStatus string
+
+const (
+	CancellationRunning   CancellationStatus = "running"
+	CancellationCompleted CancellationStatus = "completed"
+	CancellationFailed    CancellationStatus = "completed_with_failures"
+)
+
+// EventCancellation is the report of cancelling an event and refunding its buyers.
+// Running it again resumes the same report, already refunded purchases are skipped
+type EventCancellation struct {
+	ID          string             `gorm:"type:varchar(36);primaryKey" json:"id"`
+	EventID     string             `gorm:"type:varchar(36);uniqueIndex" json:"event_id"`
+	RequestedBy string             `gorm:"type:varchar(36)" json:"requested_by"`
+	Status      CancellationStatus `gorm:"type:varchar(30)" json:"status"`
+	Refunded    int                `json:"refunded"`      // Refunded or free purchases, access reversed
+	Manual      int                `json:"manual_refund"` // Purchases without a payment ID to refund automatically
+	Failed      int                `json:"failed"`
+	StartedAt   time.Time          `json:"started_at"`
+	FinishedAt  *time.Time         `json:"finished_at"`
+
+	Entries []CancellationEntry `gorm:"foreignKey:CancellationID" json:"entries,omitempty"`
+
+	CreatedAt time.Time      `gorm:"autoCreateTime" json:"created_at"`
+	UpdatedAt time.Time      `gorm:"autoUpdateTime" json:"updated_at"`
+	DeletedAt gorm.DeletedAt `gorm:"index" json:"deleted_at,omitempty"`
+}
+
+type CancellationEntryStatus string
+
+const (
+	CancellationEntryRefunded       CancellationEntryStatus = "refunded"
+	CancellationEntryFree           CancellationEntryStatus = "free"          // Nothing was charged, only access was reversed
+	CancellationEntryManualRequired CancellationEntryStatus = "manual_refund" // No payment ID recorded, refund it by hand
+	CancellationEntryFailed         CancellationEntryStatus = "failed"
+)
+
+// CancellationEntry is the outcome of one purchase in an event cancellation
+type CancellationEntry struct {
+	CancellationID string                  `gorm:"type:varchar(36);primaryKey" json:"cancellation_id"`
+	PurchaseID     string                  `gorm:"type:varchar(36);primaryKey" json:"purchase_id"`
+	UserID         string                  `gorm:"type:varchar(36)" json:"user_id"`
+	Status         CancellationEntryStatus `gorm:"type:varchar(20)" json:"status"`
+	Error          string                  `json:"error,omitempty"`
+
+	CreatedAt time.Time `gorm:"autoCreateTime" json:"created_at"`
+	UpdatedAt time.Time `gorm:"autoUpdateTime" json:"updated_at"`
+}
+
+// RegistrationCancellation records a user leaving an event, with the reason they gave if any
+type RegistrationCancellation struct {
+	ID      string `gorm:"type:varchar(36);primaryKey" json:"id"`
+	EventID string `gorm:"type:varchar(36);index" json:"event_id"`
+	UserID  string `gorm:"type:varchar(36);index" json:"user_id"`
+	Reason  string `gorm:"type:varchar(500)" json:"reason"`
+
+	CreatedAt time.Time `gorm:"autoCreateTime" json:"created_at"`
+}
+
+func (RegistrationCancellation) TableName() string {
+	return "registration_cancellations"
+}
+
+type UnregisterEventRequest struct {
+	Reason string `json:"reason,omitempty" example:"Conflito de horário com o trabalho"`
+}
+
+type CancellationReasonCount struct {
+	Reason string `json:"reason"`
+	Count  int64  `json:"count"`
+}
+
+// CancellationReasons groups the reasons given when leaving an event, matched ignoring case
+type CancellationReasons struct {
+	Total         int64                     `json:"total"`
+	WithoutReason int64                     `json:"without_reason"`
+	Reasons       []CancellationReasonCount `json:"reasons"`
+}
+
+// Certificate is the record of an issued participation certificate, the code is
+// printed on the document and the hash seals its content against tampering
+type Certificate struct {
+	ID         string    `gorm:"type:varchar(36);primaryKey" json:"id"`
+	Code       string    `gorm:"type:varchar(16);uniqueIndex;not null" json:"code"`
+	Hash       string    `gorm:"type:varchar(64);not null" json:"-"`
+	UserID     string    `gorm:"type:varchar(36);uniqueIndex:idx_certificate_user_event;not null" json:"user_id"`
+	EventID    string    `gorm:"type:varchar(36);uniqueIndex:idx_certificate_user_event;not null" json:"event_id"`
+	HolderName string    `gorm:"not null" json:"holder_name"`
+	EventName  string    `gorm:"not null" json:"event_name"`
+	Hours      float64   `json:"hours"`
+	IssuedAt   time.Time `gorm:"not null" json:"issued_at"`
+
+	VerificationURL string `gorm:"-" json:"verification_url"`
+
+	CreatedAt time.Time `gorm:"autoCreateTime" json:"created_at"`
+}
+
+// CertificateVerification is the public view of a valid certificate
+type CertificateVerification struct {
+	Code       string    `json:"code"`
+	HolderName string    `json:"holder_name"`
+	EventName  string    `json:"event_name"`
+	EventSlug  string    `json:"event_slug"`
+	Hours      float64   `json:"hours"`
+	IssuedAt   time.Time `json:"issued_at"`
+}
+
+// RegistrationStatus tells a user whether the registration and its confirmation email went through
+type RegistrationStatus struct {
+	Registered   bool       `json:"registered"`
+	RegisteredAt *time.Time `json:"registered_at"`
+	EmailSent    bool       `json:"email_sent"`
+	EmailSentAt  *time.Time `json:"email_sent_at"`
+	EmailError   string     `json:"email_error,omitempty"`
+	CheckedIn    bool       `json:"checked_in"`
+	CheckedInAt  *time.Time `json:"checked_in_at"`
+}
+
+type DoorScanRequest struct {
+	UserID string `json:"user_id" example:"550e8400-e29b-41d4-a716-446655440000"` // Decoded from the badge or registration email QR
+}
+
+// DoorScanResult has everything the door desk needs about a scanned user
+type DoorScanResult struct {
+	UserID          string                  `json:"user_id"`
+	Name            string                  `json:"name"`
+	LastName        string                  `json:"last_name"`
+	Email           string                  `json:"email"`
+	Registered      bool                    `json:"registered"`
+	RegisteredAt    *time.Time              `json:"registered_at"`
+	HasTicket       bool                    `json:"has_ticket"`
+	Products        []OwnedEventProduct     `json:"products"`
+	CheckedIn       bool                    `json:"checked_in"`
+	CheckedInAt     *time.Time              `json:"checked_in_at"`
+	TodayActivities []ActivityParticipation `json:"today_activities"` // Registered activities starting today
+}
+
+// EventRegistrationDetails holds the dietary and accessibility needs a registrant shares for catering
+// and accommodations, only the user and the event admins can read them
+type EventRegistrationDetails struct {
+	EventID string `gorm:"type:varchar(36);primaryKey" json:"event_id"`
+	UserID  string `gorm:"type:varchar(36);primaryKey" json:"user_id"`
+
+	DietaryRestrictions string `gorm:"type:varchar(500)" json:"dietary_restrictions" example:"Vegetariano"`
+	AccessibilityNeeds  string `gorm:"type:varchar(500)" json:"accessibility_needs" example:"Cadeirante"`
+
+	CreatedAt time.Time `gorm:"autoCreateTime" json:"created_at"`
+	UpdatedAt time.Time `gorm:"autoUpdateTime" json:"updated_at"`
+}
+
+func (EventRegistrationDetails) TableName() string {
+	return "event_registration_details"
+}
+
+// EventAnnouncement is a news entry of the event feed, only registrants and admins can read it
+type EventAnnouncement struct {
+	ID        string `gorm:"type:varchar(36);primaryKey" json:"id"`
+	EventID   string `gorm:"type:varchar(36);index" json:"event_id"`
+	Title     string `gorm:"type:varchar(150);not null" json:"title"`
+	Body      string `gorm:"type:text" json:"body"`
+	Pinned    bool   `gorm:"default:false" json:"pinned"`
+	CreatedBy string `gorm:"type:varchar(36)" json:"created_by"`
+
+	CreatedAt time.Time      `gorm:"autoCreateTime" json:"created_at"`
+	UpdatedAt time.Time      `gorm:"autoUpdateTime" json:"updated_at"`
+	DeletedAt gorm.DeletedAt `gorm:"index" json:"deleted_at,omitempty"`
+}
+
+func (EventAnnouncement) TableName() string {
+	return "event_announcements"
+}
+
+type CreateAnnouncementRequest struct {
+	Title  string `json:"title" example:"Mudança de sala"`
+	Body   string `json:"body" example:"O workshop de Go foi movido para a sala 202"`
+	Pinned bool   `json:"pinned" example:"false"`
+}
+
+// EventFilter narrows the event listing to the events running in a date range, nil bounds are open
+type EventFilter struct {
+	From *time.Time
+	To   *time.Time
+}
+
+type EventList struct {
+	Items      []Event `json:"items"`
+	Page       int     `json:"page"`
+	PageSize   int     `json:"page_size"`
+	TotalCount int64   `json:"total_count"`
+}
+
+type EventAnnouncementList struct {
+	Announcements []EventAnnouncement `json:"announcements"`
+	Page          int                 `json:"page"`
+	PageSize      int                 `json:"page_size"`
+	Total         int64               `json:"total"`
+}
+
+// RegistrationDetailsRequest updates only the fields sent, an empty string clears a field
+type RegistrationDetailsRequest struct {
+	DietaryRestrictions *string `json:"dietary_restrictions,omitempty" example:"Vegetariano"`
+	AccessibilityNeeds  *string `json:"accessibility_needs,omitempty" example:"Cadeirante"`
+}
+
+type RegistrationNoteCount struct {
+	Note  string `json:"note"`
+	Count int    `json:"count"`
+}
+
+type RegistrantNotes struct {
+	UserID              string `json:"user_id"`
+	Name                string `json:"name"`
+	LastName            string `json:"last_name"`
+	Email               string `json:"email"`
+	DietaryRestrictions string `json:"dietary_restrictions"`
+	AccessibilityNeeds  string `json:"accessibility_needs"`
+}
+
+// RegistrationDetailsAggregate summarizes the registrants needs for planning, notes are grouped ignoring case
+type RegistrationDetailsAggregate struct {
+	Registrants   int64                   `json:"registrants"`
+	Responses     int                     `json:"responses"`
+	Dietary       []RegistrationNoteCount `json:"dietary"`
+	Accessibility []RegistrationNoteCount `json:"accessibility"`
+	Notes         []RegistrantNotes       `json:"notes"`
+}
+
+type AdminEventStatus string
+
+const (
+	AdminEventActive  AdminEventStatus = "active"
+	AdminEventHidden  AdminEventStatus = "hidden"
+	AdminEventBlocked AdminEventStatus = "blocked"
+	AdminEventDeleted AdminEventStatus = "deleted"
+)
+
+// AdminEventSummary is a row of the platform wide event listing for super users
+type AdminEventSummary struct {
+	ID                string     `json:"id"`
+	Slug              string     `json:"slug"`
+	Name              string     `json:"name"`
+	StartDate         time.Time  `json:"start_date"`
+	EndDate           time.Time  `json:"end_date"`
+	IsHidden          bool       `json:"is_hidden"`
+	IsBlocked         bool       `json:"is_blocked"`
+	DeletedAt         *time.Time `json:"deleted_at,omitempty"`
+	CreatedBy         string     `json:"created_by"`
+	CreatorName       string     `json:"creator_name"`
+	CreatorEmail      string     `json:"creator_email"`
+	RegistrationCount int        `json:"registration_count"`
+	RevenueInt        int        `json:"revenue_int"` // Paid and not refunded purchases, in cents
+}
+
+type AdminEventList struct {
+	Events   []AdminEventSummary `json:"events"`
+	Page     int                 `json:"page"`
+	PageSize int                 `json:"page_size"`
+	Total    int64               `json:"total"`
+}
+
+type TicketStock struct {
+	ProductID string `json:"product_id"`
+	Name      string `json:"name"`
+	Unlimited bool   `json:"unlimited"`
+	Remaining int    `json:"remaining"` // -1 when unlimited
+	Sold      int    `json:"sold"`
+}
+
+// TicketAvailability is the public view of how close the event tickets are to selling out
+type TicketAvailability struct {
+	HasTickets bool          `json:"has_tickets"`
+	Unlimited  bool          `json:"unlimited"` // Any ticket with unlimited stock
+	Remaining  int           `json:"remaining"` // Sum of the limited tickets, -1 when unlimited
+	Sold       int           `json:"sold"`
+	Tickets    []TicketStock `json:"tickets"`
+}
+
+type ValidationSeverity string
+
+const (
+	ValidationError   ValidationSeverity = "error"   // Breaks the event for attendees, fix before publishing
+	ValidationWarning ValidationSeverity = "warning" // Likely a mistake, but the event still works
+)
+
+// ValidationIssue is a single finding of the event preflight check
+type ValidationIssue struct {
+	Severity   ValidationSeverity `json:"severity"`
+	Code       string             `json:"code" example:"activity_outside_event"`
+	Message    string             `json:"message"`
+	ActivityID string             `json:"activity_id,omitempty"`
+	ProductID  string             `json:"product_id,omitempty"`
+}
+
+type EventValidationReport struct {
+	Valid    bool              `json:"valid"` // No errors, warnings don't block publishing
+	Errors   int               `json:"errors"`
+	Warnings int               `json:"warnings"`
+	Issues   []ValidationIssue `json:"issues"`
+}
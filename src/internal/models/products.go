@@ -15,6 +15,8 @@ type Product struct {
 	Description string `json:"description"`
 	PriceInt    int    `gorm:"not null" json:"price_int"`
 
+	UenfDiscountPercent int `gorm:"default:0" json:"uenf_discount_percent"` // Percentage off each unit for UENF students
+
 	MaxOwnableQuantity int `json:"max_ownable_quantity"`
 
 	// Product type flags - a product can be multiple types
@@ -33,7 +35,7 @@ type Product struct {
 	TokenQuantity int `gorm:"default:0" json:"token_quantity"` // Number of activity tokens included
 
 	// Bundling
-	BundledProducts []Product `gorm:"many2many:product_bundles;constraint:OnDelete:CASCADE" json:"bundled_products"`
+	BundledProducts []ProductBundle `gorm:"foreignKey:ParentProductID;constraint:OnDelete:CASCADE" json:"bundled_products,omitempty"`
 
 	// Stock management (for physical items)
 	HasUnlimitedQuantity bool `gorm:"default:false" json:"has_unlimited_quantity"` // If true, ignore Quantity
@@ -61,6 +63,8 @@ type ProductRequest struct {
 	Description string `json:"description"`
 	PriceInt    int    `json:"price_int"`
 
+	UenfDiscountPercent int `json:"uenf_discount_percent" example:"50"` // From 0 to 100
+
 	MaxOwnableQuantity int `json:"max_ownable_quantity"`
 
 	// Product type flags
@@ -79,7 +83,7 @@ type ProductRequest struct {
 	TokenQuantity int `json:"token_quantity"`
 
 	// Bundling
-	// BundledProducts []string `json:"bundled_products"`
+	BundledProducts []BundledProductRequest `json:"bundled_products"`
 
 	// Stock management
 	HasUnlimitedQuantity bool `json:"has_unlimited_quantity"`
@@ -91,6 +95,11 @@ type ProductRequest struct {
 	AccessTargets []AccessTargetRequest `json:"access_targets"`
 }
 
+type BundledProductRequest struct {
+	ProductID string `json:"product_id"`
+	Quantity  int    `json:"quantity" example:"1"` // Units given per unit of the bundle, defaults to 1
+}
+
 type ProductUpdateRequest struct {
 	ProductID string         `json:"product_id"`
 	Product   ProductRequest `json:"product"`
@@ -106,8 +115,9 @@ type Purchase struct {
 	UserID    string `gorm:"type:varchar(36);index" json:"user_id"` // User who made the purchase
 	ProductID string `gorm:"type:varchar(36);index" json:"product_id"`
 
-	PurchasedAt time.Time `gorm:"autoCreateTime" json:"purchased_at"`
-	Quantity    int       `gorm:"default:1" json:"quantity"` // How many of this product
+	PurchasedAt  time.Time `gorm:"autoCreateTime" json:"purchased_at"`
+	Quantity     int       `gorm:"default:1" json:"quantity"`       // How many of this product
+	UnitPriceInt int       `gorm:"default:0" json:"unit_price_int"` // What each unit cost when bought, the product price may change later
 
 	// For gifting functionality
 	IsGift        bool    `gorm:"default:false" json:"is_gift"` // Whether this purchase was a gift
@@ -117,6 +127,12 @@ type Purchase struct {
 	IsDelivered bool       `gorm:"default:false" json:"is_delivered"` // If physical item has been delivered
 	DeliveredAt *time.Time `json:"delivered_at"`
 
+	// For refunds
+	PaymentID        *string    `gorm:"type:varchar(64)" json:"payment_id"`     // Mercado Pago ID the purchase was paid with, null for free products
+	PaymentMethod    string     `gorm:"type:varchar(32)" json:"payment_method"` // Mercado Pago method ID (pix, master, visa...) or free
+	RefundedAt       *time.Time `json:"refunded_at"`                            // Set once the whole purchase was refunded
+	RefundedQuantity int        `gorm:"default:0" json:"refunded_quantity"`     // Units given back so far by partial refunds
+
 	CreatedAt time.Time      `gorm:"autoCreateTime" json:"created_at"`
 	UpdatedAt time.Time      `gorm:"autoUpdateTime" json:"updated_at"`
 	DeletedAt gorm.DeletedAt `gorm:"index" json:"deleted_at,omitempty"`
@@ -131,8 +147,29 @@ type PixPurchase struct {
 	ProductID     string  `gorm:"type:varchar(36);index" json:"product_id"`
 	PurchaseID    int     `gorm:"unique" json:"purchase_id"`
 	Quantity      int     `json:"quantity"`
+	UnitPriceInt  int     `gorm:"default:0" json:"unit_price_int"`   // Price of each unit when the pix payment was created
+	CouponID      *string `gorm:"type:varchar(36)" json:"coupon_id"` // Coupon the price was computed with, redeemed once paid
 	IsGift        bool    `json:"is_gift"`
 	GiftedToEmail *string `json:"gifted_to_email"`
+
+	CreatedAt time.Time `gorm:"autoCreateTime;default:CURRENT_TIMESTAMP" json:"created_at"`
+}
+
+// ProcessedWebhook records a Mercado Pago payment that was already finalized, so retried
+// webhooks for it are acknowledged without delivering the products again
+type ProcessedWebhook struct {
+	PaymentID   string    `gorm:"type:varchar(64);primaryKey" json:"payment_id"`
+	ProcessedAt time.Time `gorm:"autoCreateTime" json:"processed_at"`
+}
+
+func (ProcessedWebhook) TableName() string {
+	return "processed_webhooks"
+}
+
+type PixPurchaseStatus struct {
+	PaymentID int    `json:"payment_id"`
+	Status    string `json:"status"`    // Mercado Pago payment status: pending, approved, rejected...
+	Finalized bool   `json:"finalized"` // Whether the purchase was already recorded and the products delivered
 }
 
 type MP_WH_Data struct {
@@ -162,6 +199,50 @@ type PurchaseRequest struct {
 	// For gifting functionality
 	IsGift        bool    `json:"is_gift"`         // Whether this purchase was a gift
 	GiftedToEmail *string `json:"gifted_to_email"` // User email of gift recipient
+
+	Coupon string `json:"coupon,omitempty"` // Optional discount coupon code
+}
+
+type CartItem struct {
+	ProductID string `json:"product_id"`
+	Quantity  int    `json:"quantity"`
+}
+
+// PurchaseCartRequest buys several products of an event at once, the payment and gift
+// fields apply to every item
+type PurchaseCartRequest struct {
+	Items []CartItem `json:"items"`
+
+	PaymentMethodID           string `json:"payment_method_id"`
+	PaymentMethodType         string `json:"payment_method_type"`
+	PaymentMethodToken        string `json:"payment_method_token"`
+	PaymentMethodInstallments int    `json:"payment_method_installments"`
+
+	IsGift        bool    `json:"is_gift"`
+	GiftedToEmail *string `json:"gifted_to_email"`
+
+	Coupon string `json:"coupon,omitempty"`
+}
+
+// ItemRequest is the single product purchase of the i-th cart item
+func (req PurchaseCartRequest) ItemRequest(i int) PurchaseRequest {
+	return PurchaseRequest{
+		ProductID:                 req.Items[i].ProductID,
+		Quantity:                  req.Items[i].Quantity,
+		PaymentMethodID:           req.PaymentMethodID,
+		PaymentMethodType:         req.PaymentMethodType,
+		PaymentMethodToken:        req.PaymentMethodToken,
+		PaymentMethodInstallments: req.PaymentMethodInstallments,
+		IsGift:                    req.IsGift,
+		GiftedToEmail:             req.GiftedToEmail,
+		Coupon:                    req.Coupon,
+	}
+}
+
+type PurchaseCartResponse struct {
+	Purchases        []PurchaseResponse `json:"purchases"` // One per cart item, in the cart order
+	TotalInt         int                `json:"total_int"`
+	PurchaseResource *order.Response    `json:"purchase_resource"` // The single order paying for every item
 }
 
 type PurchaseResponse struct {
@@ -187,6 +268,27 @@ func (ProductBundle) TableName() string {
 	return "product_bundles"
 }
 
+// GiftingStats sums up the gifted products of an event and what the recipients did with them.
+// Refunded gift purchases are left out
+type GiftingStats struct {
+	GiftedPurchases      int64       `json:"gifted_purchases"`
+	GiftedUnits          int64       `json:"gifted_units"`
+	Recipients           int64       `json:"recipients"`
+	RegisteredRecipients int64       `json:"registered_recipients"` // Recipients registered to the event
+	ActiveRecipients     int64       `json:"active_recipients"`     // Recipients that attended an activity or used a gifted token
+	RedemptionRate       float64     `json:"redemption_rate"`       // Active recipients over recipients, from 0 to 1
+	TopGifters           []TopGifter `json:"top_gifters"`
+}
+
+type TopGifter struct {
+	UserID     string `json:"user_id"`
+	Name       string `json:"name"`
+	Email      string `json:"email"`
+	Purchases  int64  `json:"purchases"`
+	Units      int64  `json:"units"`
+	Recipients int64  `json:"recipients"`
+}
+
 // UserProduct represents products owned by users
 type UserProduct struct {
 	ID         string `gorm:"type:varchar(36);primaryKey" json:"id"`
@@ -255,8 +357,317 @@ func (UserToken) TableName() string {
 	return "user_tokens"
 }
 
+// RegisterAction is the request that activates an access, ready to be sent as is
+type RegisterAction struct {
+	Method string            `json:"method" example:"POST"`
+	Path   string            `json:"path" example:"/events/scti/register"`
+	Body   map[string]string `json:"body,omitempty"`
+}
+
+// PendingAccess is an event or activity a gifted product gives access to that the user didn't register to.
+// Activity accesses point to the event registration while the user isn't registered to the event
+type PendingAccess struct {
+	UserProductID  string         `json:"user_product_id"`
+	ProductID      string         `json:"product_id"`
+	ProductName    string         `json:"product_name"`
+	GiftedFromID   *string        `json:"gifted_from_id"`
+	GiftedFromName string         `json:"gifted_from_name,omitempty"`
+	EventID        string         `json:"event_id"`
+	EventSlug      string         `json:"event_slug"`
+	EventName      string         `json:"event_name"`
+	ActivityID     string         `json:"activity_id,omitempty"` // Empty for event accesses
+	ActivityName   string         `json:"activity_name,omitempty"`
+	Register       RegisterAction `json:"register"`
+}
+
+// EventToken is an issued token with its owner, source product and the activity it was redeemed on
+type EventToken struct {
+	ID          string     `json:"id"`
+	UserID      string     `json:"user_id"`
+	UserName    string     `json:"user_name"`
+	UserEmail   string     `json:"user_email"`
+	ProductID   string     `json:"product_id"`
+	ProductName string     `json:"product_name"`
+	IsUsed      bool       `json:"is_used"`
+	UsedAt      *time.Time `json:"used_at"`
+	UsedForID   *string    `json:"used_for_id"`
+	UsedForName string     `json:"used_for_name,omitempty"`
+	CreatedAt   time.Time  `json:"created_at"`
+}
+
+type EventTokenList struct {
+	Tokens   []EventToken `json:"tokens"`
+	Page     int          `json:"page"`
+	PageSize int          `json:"page_size"`
+	Total    int64        `json:"total"`
+}
+
 type CanGiftRequest struct {
 	Email     string `json:"email"`
 	ProductID string `json:"product_id"`
 	Quantity  int    `json:"quantity"`
 }
+
+type TransferProductRequest struct {
+	UserProductID string `json:"user_product_id"`
+	ToEmail       string `json:"to_email" example:"john@carmack.com"`
+}
+
+type CanGiftResponse struct {
+	CanGift bool   `json:"can_gift"`
+	Reason  string `json:"reason,omitempty"` // Why the gift would be rejected
+}
+
+// PriceAdjustment is a single modifier applied over the base price, discounts are negative
+type PriceAdjustment struct {
+	Kind        string `json:"kind" example:"discount"` // discount or tax
+	Description string `json:"description"`
+	AmountInt   int    `json:"amount_int"`
+}
+
+// PriceBreakdown is the effective price a user pays for a product, all values in cents
+type PriceBreakdown struct {
+	ProductID    string            `json:"product_id"`
+	Quantity     int               `json:"quantity"`
+	UnitPriceInt int               `json:"unit_price_int"` // Base price of a unit
+	SubtotalInt  int               `json:"subtotal_int"`
+	Adjustments  []PriceAdjustment `json:"adjustments"`
+	TotalInt     int               `json:"total_int"`
+	Coupon       string            `json:"coupon,omitempty"` // Code of the applied coupon
+	CouponID     string            `json:"-"`
+}
+
+// PaidUnitPriceInt is what each unit costs once adjusted, adjustments are computed per unit so the total divides evenly
+func (p PriceBreakdown) PaidUnitPriceInt() int {
+	return p.TotalInt / p.Quantity
+}
+
+// Coupon discounts the products of an event, or a single product when ProductID is set. Exactly
+// one of DiscountPercent and DiscountInt is set, both apply to each unit
+type Coupon struct {
+	ID              string     `gorm:"type:varchar(36);primaryKey" json:"id"`
+	EventID         string     `gorm:"type:varchar(36);uniqueIndex:idx_coupons_event_code" json:"event_id"`
+	Code            string     `gorm:"type:varchar(32);uniqueIndex:idx_coupons_event_code" json:"code"` // Stored in upper case, matched ignoring case
+	ProductID       *string    `gorm:"type:varchar(36)" json:"product_id"`
+	DiscountPercent int        `gorm:"default:0" json:"discount_percent"`
+	DiscountInt     int        `gorm:"default:0" json:"discount_int"`
+	MaxUses         int        `gorm:"default:0" json:"max_uses"` // Orders that may use it, 0 for unlimited
+	Uses            int        `gorm:"default:0" json:"uses"`
+	ExpiresAt       *time.Time `json:"expires_at"`
+	CreatedBy       string     `gorm:"type:varchar(36)" json:"created_by"`
+
+	CreatedAt time.Time `gorm:"autoCreateTime" json:"created_at"`
+}
+
+func (Coupon) TableName() string {
+	return "coupons"
+}
+
+type CouponRequest struct {
+	Code            string     `json:"code" example:"SCTI10"`
+	ProductID       *string    `json:"product_id,omitempty"` // Restricts the coupon to a product, omit for every product of the event
+	DiscountPercent int        `json:"discount_percent" example:"10"`
+	DiscountInt     int        `json:"discount_int" example:"0"` // Cents off each unit
+	MaxUses         int        `json:"max_uses" example:"100"`
+	ExpiresAt       *time.Time `json:"expires_at,omitempty"`
+}
+
+// PurchaseValidation is the outcome of a purchase dry run
+type PurchaseValidation struct {
+	Valid  bool            `json:"valid"`
+	Reason string          `json:"reason,omitempty"` // Why the purchase would be rejected
+	Price  *PriceBreakdown `json:"price,omitempty"`  // What the purchase would cost, only when valid
+}
+
+// ProductAccessGrant allowlists a user to buy an invite-only (non public) product
+type ProductAccessGrant struct {
+	ProductID string `gorm:"type:varchar(36);primaryKey" json:"product_id"`
+	UserID    string `gorm:"type:varchar(36);primaryKey" json:"user_id"`
+	GrantedBy string `gorm:"type:varchar(36)" json:"granted_by"`
+
+	CreatedAt time.Time `gorm:"autoCreateTime" json:"created_at"`
+}
+
+type ProductAccessGrantRequest struct {
+	Emails []string `json:"emails" example:"speaker@example.com"`
+}
+
+type ProductAccessGrantResult struct {
+	Email   string `json:"email"`
+	UserID  string `json:"user_id,omitempty"`
+	Success bool   `json:"success"`
+	Message string `json:"message,omitempty"`
+}
+
+// PurchaseRefund records each refund issued over a purchase, partial ones included
+type PurchaseRefund struct {
+	ID         string `gorm:"type:varchar(36);primaryKey" json:"id"`
+	PurchaseID string `gorm:"type:varchar(36);index" json:"purchase_id"`
+	RefundedBy string `gorm:"type:varchar(36)" json:"refunded_by"`
+	Quantity   int    `json:"quantity"`
+	AmountInt  int    `json:"amount_int"` // Amount given back, in cents
+	IsPartial  bool   `json:"is_partial"` // Whether units of the purchase were kept
+
+	CreatedAt time.Time `gorm:"autoCreateTime" json:"created_at"`
+}
+
+// EventSpend is what a user paid for the products of one event, values are in cents. Gifts count for the gifter
+type EventSpend struct {
+	EventID     string `json:"event_id"`
+	EventSlug   string `json:"event_slug"`
+	EventName   string `json:"event_name"`
+	Purchases   int64  `json:"purchases"`
+	PaidInt     int64  `json:"paid_int"`
+	RefundedInt int64  `json:"refunded_int"`
+	SpentInt    int64  `json:"spent_int"` // Paid minus refunded
+}
+
+type UserSpend struct {
+	PaidInt     int64        `json:"paid_int"`
+	RefundedInt int64        `json:"refunded_int"`
+	SpentInt    int64        `json:"spent_int"`
+	Events      []EventSpend `json:"events"`
+}
+
+// PurchaseExportRow is a line of the purchases reconciliation file, money values are in cents
+type PurchaseExportRow struct {
+	PurchaseID       string     `json:"purchase_id"`
+	BuyerEmail       string     `json:"buyer_email"`
+	ProductID        string     `json:"product_id"`
+	ProductName      string     `json:"product_name"`
+	Quantity         int        `json:"quantity"`
+	UnitPriceInt     int        `json:"unit_price_int"`
+	PaymentMethod    string     `json:"payment_method"`
+	PaymentID        *string    `json:"payment_id"`
+	IsGift           bool       `json:"is_gift"`
+	GiftedToEmail    *string    `json:"gifted_to_email"`
+	RefundedQuantity int        `json:"refunded_quantity"`
+	RefundedAt       *time.Time `json:"refunded_at"`
+	PurchasedAt      time.Time  `json:"purchased_at"`
+}
+
+type PaymentReconcileRequest struct {
+	From time.Time `json:"from" example:"2025-09-01T00:00:00-03:00"`
+	To   time.Time `json:"to" example:"2025-09-30T23:59:59-03:00"`
+}
+
+// OrphanedPayment is a payment approved at Mercado Pago that no local purchase accounts for
+type OrphanedPayment struct {
+	PaymentID         string    `json:"payment_id"`
+	AmountInt         int       `json:"amount_int"` // In cents
+	PaymentMethod     string    `json:"payment_method"`
+	PayerEmail        string    `json:"payer_email"`
+	ExternalReference string    `json:"external_reference"`
+	CreatedAt         time.Time `json:"created_at"`
+	Reason            string    `json:"reason"`
+}
+
+// PhantomPurchase is a paid local purchase without a matching approved payment at Mercado Pago
+type PhantomPurchase struct {
+	PurchaseID    string    `json:"purchase_id"`
+	UserID        string    `json:"user_id"`
+	ProductID     string    `json:"product_id"`
+	PaymentID     string    `json:"payment_id"`
+	PaymentMethod string    `json:"payment_method"`
+	PurchasedAt   time.Time `json:"purchased_at"`
+	Reason        string    `json:"reason"`
+}
+
+type PaymentReconciliation struct {
+	From             time.Time         `json:"from"`
+	To               time.Time         `json:"to"`
+	PaymentsChecked  int               `json:"payments_checked"`
+	PurchasesChecked int               `json:"purchases_checked"`
+	Truncated        bool              `json:"truncated"` // Mercado Pago had more payments than a single run fetches, narrow the range
+	Orphaned         []OrphanedPayment `json:"orphaned"`
+	Phantom          []PhantomPurchase `json:"phantom"`
+}
+
+type AutoRegistrationReason string
+
+const (
+	AutoRegistrationTarget    AutoRegistrationReason = "access_target" // The product targets the activity directly
+	AutoRegistrationMandatory AutoRegistrationReason = "mandatory"     // Mandatory activity of an event the product gives access to
+	AutoRegistrationFree      AutoRegistrationReason = "free"          // Activity without fee of an event the product gives access to
+)
+
+// ProductAutoRegistration is an activity a buyer of the product gets registered to on purchase
+type ProductAutoRegistration struct {
+	Activity Activity               `json:"activity"`
+	Reason   AutoRegistrationReason `json:"reason"`
+}
+
+type BulkBlockProductsRequest struct {
+	Reason string `json:"reason" example:"Preço errado no lote 2"` // Required, kept in the audit log
+}
+
+type BulkBlockProductsResult struct {
+	Blocked  bool  `json:"blocked"`
+	Affected int64 `json:"affected"` // Products whose blocked state changed
+}
+
+type RefundPurchaseRequest struct {
+	PurchaseID string `json:"purchase_id"`
+	Quantity   int    `json:"quantity"` // Units to refund, all the remaining ones when 0
+}
+
+// ExtendProductExpiryRequest moves the expiry of every product of an event,
+// either to a fixed time or by a delta over each product's current expiry
+type ExtendProductExpiryRequest struct {
+	ExpiresAt *time.Time `json:"expires_at,omitempty" example:"2030-11-10T23:59:59Z"`
+	Delta     string     `json:"delta,omitempty" example:"72h"` // Go duration
+}
+
+type ExtendProductExpiryResult struct {
+	Updated int `json:"updated"` // Products whose expiry changed
+	Capped  int `json:"capped"`  // Products held at the event end date
+}
+
+// DeliveryBatchRequest marks many physical item purchases as delivered at once,
+// either by purchase IDs or by the users that own a given physical product
+type DeliveryBatchRequest struct {
+	PurchaseIDs []string `json:"purchase_ids"`
+	ProductID   string   `json:"product_id"`
+	UserIDs     []string `json:"user_ids"`
+}
+
+// OrphanedAccessTarget is an access target whose activity or event no longer exists
+type OrphanedAccessTarget struct {
+	ID          string `json:"id"`
+	ProductID   string `json:"product_id"`
+	ProductName string `json:"product_name"`
+	TargetID    string `json:"target_id"`
+	IsEvent     bool   `json:"is_event"`
+}
+
+// PendingDelivery is a physical item purchase still waiting to be picked up by its owner
+type PendingDelivery struct {
+	PurchaseID    string    `json:"purchase_id"`
+	ProductID     string    `json:"product_id"`
+	ProductName   string    `json:"product_name"`
+	Quantity      int       `json:"quantity"` // Units left after partial refunds
+	OwnerID       string    `json:"owner_id"` // Gift recipient for gifted items, buyer otherwise
+	OwnerName     string    `json:"owner_name"`
+	OwnerLastName string    `json:"owner_last_name"`
+	OwnerEmail    string    `json:"owner_email"`
+	IsGift        bool      `json:"is_gift"`
+	PurchasedAt   time.Time `json:"purchased_at"`
+}
+
+type DeliveryResult struct {
+	PurchaseID string `json:"purchase_id,omitempty"`
+	UserID     string `json:"user_id,omitempty"`
+	Success    bool   `json:"success"`
+	Message    string `json:"message"`
+}
+
+// ProductDeleteImpact explains what deleting a product would affect and whether it is allowed
+type ProductDeleteImpact struct {
+	ProductID     string         `json:"product_id"`
+	Purchases     int64          `json:"purchases"`
+	AffectedUsers int64          `json:"affected_users"` // Users that own the product
+	TokensIssued  int64          `json:"tokens_issued"`
+	AccessTargets []AccessTarget `json:"access_targets"`
+	CanDelete     bool           `json:"can_delete"`
+	Reasons       []string       `json:"reasons"` // Why the product can't be deleted, empty when it can
+}
@@ -84,6 +84,64 @@ type UserRegister struct {
 	UenfSemester int    `json:"uenf_semester"`
 }
 
+type UserImportRow struct {
+	Email    string `json:"email" example:"john@carmack.com"`
+	Name     string `json:"name" example:"John"`
+	LastName string `json:"last_name" example:"Carmack"`
+}
+
+type UserImportRequest struct {
+	Users []UserImportRow `json:"users"`
+}
+
+type UserImportResult struct {
+	Email   string `json:"email"`
+	UserID  string `json:"user_id,omitempty"`
+	Created bool   `json:"created"`
+	Message string `json:"message,omitempty"` // Why the row was skipped
+}
+
+type UnverifiedUser struct {
+	ID             string     `json:"id"`
+	Name           string     `json:"name"`
+	LastName       string     `json:"last_name"`
+	Email          string     `json:"email"`
+	CreatedAt      time.Time  `json:"created_at"`
+	LastCodeSentAt *time.Time `json:"last_code_sent_at,omitempty"` // Nil when no verification code was ever stored
+}
+
+type UnverifiedUserList struct {
+	Users    []UnverifiedUser `json:"users"`
+	Page     int              `json:"page"`
+	PageSize int              `json:"page_size"`
+	Total    int64            `json:"total"`
+}
+
+type BulkResendVerificationResult struct {
+	Queued    int   `json:"queued"`    // Emails scheduled by this call
+	Remaining int64 `json:"remaining"` // Eligible users left for a later call because of the batch cap
+	Cooldown  int64 `json:"cooldown"`  // Users skipped because they got a code recently
+}
+
+type EventCreator struct {
+	ID        string    `json:"id"`
+	Name      string    `json:"name"`
+	LastName  string    `json:"last_name"`
+	Email     string    `json:"email"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type EventCreatorGrantRequest struct {
+	Emails []string `json:"emails" example:"organizer@example.com"`
+}
+
+type EventCreatorGrantResult struct {
+	Email   string `json:"email"`
+	UserID  string `json:"user_id,omitempty"`
+	Success bool   `json:"success"`
+	Message string `json:"message,omitempty"`
+}
+
 type UserLogin struct {
 	gorm.Model
 	Email    string `gorm:"unique;not null"`
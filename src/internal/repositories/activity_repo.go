@@ -2,10 +2,12 @@ package repos
 
 import (
 	"errors"
+	"fmt"
 	"scti/internal/models"
 	"time"
 
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 type ActivityRepo struct {
@@ -30,16 +32,308 @@ func (r *ActivityRepo) GetActivityByID(id string) (*models.Activity, error) {
 
 func (r *ActivityRepo) GetAllActivitiesFromEvent(eventID string) ([]models.Activity, error) {
 	var activities []models.Activity
-	if err := r.DB.Where("event_id = ? AND is_hidden = ?", eventID, false).Find(&activities).Error; err != nil {
+	if err := r.DB.Where("event_id = ? AND is_hidden = ?", eventID, false).
+		Order("start_time ASC, display_order ASC").
+		Find(&activities).Error; err != nil {
 		return nil, err
 	}
 	return activities, nil
 }
 
+// GetActivitiesFiltered returns the visible activities of the event that match the filter, in schedule order
+func (r *ActivityRepo) GetActivitiesFiltered(eventID string, filter models.ActivityFilter) ([]models.Activity, error) {
+	query := r.DB.Where("event_id = ? AND is_hidden = ?", eventID, false)
+	if filter.Type != "" {
+		query = query.Where("type = ?", filter.Type)
+	}
+	if filter.Speaker != "" {
+		query = query.Where("speaker ILIKE ?", "%"+filter.Speaker+"%")
+	}
+	if filter.From != nil {
+		query = query.Where("start_time >= ?", *filter.From)
+	}
+	if filter.To != nil {
+		query = query.Where("end_time <= ?", *filter.To)
+	}
+
+	var activities []models.Activity
+	if err := query.Order("start_time ASC, display_order ASC").Find(&activities).Error; err != nil {
+		return nil, err
+	}
+	return activities, nil
+}
+
+// GetEventActivities returns every activity of the event, hidden ones included
+func (r *ActivityRepo) GetEventActivities(eventID string) ([]models.Activity, error) {
+	var activities []models.Activity
+	if err := r.DB.Where("event_id = ?", eventID).
+		Order("start_time ASC, display_order ASC").
+		Find(&activities).Error; err != nil {
+		return nil, err
+	}
+	return activities, nil
+}
+
+// GetEventActivitiesWithSpeaker returns every activity of the event that has a speaker, hidden ones included
+func (r *ActivityRepo) GetEventActivitiesWithSpeaker(eventID string) ([]models.Activity, error) {
+	var activities []models.Activity
+	if err := r.DB.Where("event_id = ? AND TRIM(speaker) <> ''", eventID).
+		Order("start_time ASC").
+		Find(&activities).Error; err != nil {
+		return nil, err
+	}
+	return activities, nil
+}
+
+// GetEventActivitiesWithLocation returns every activity of the event that has a location, hidden ones included
+func (r *ActivityRepo) GetEventActivitiesWithLocation(eventID string) ([]models.Activity, error) {
+	var activities []models.Activity
+	if err := r.DB.Where("event_id = ? AND TRIM(location) <> ''", eventID).
+		Order("start_time ASC").
+		Find(&activities).Error; err != nil {
+		return nil, err
+	}
+	return activities, nil
+}
+
+// GetEventActivitiesOverlapping returns the event activities, hidden ones included, running during
+// the window. Back to back activities don't overlap
+func (r *ActivityRepo) GetEventActivitiesOverlapping(eventID string, start, end time.Time) ([]models.Activity, error) {
+	var activities []models.Activity
+	if err := r.DB.Where("event_id = ? AND start_time < ? AND end_time > ?", eventID, end, start).
+		Order("start_time ASC").
+		Find(&activities).Error; err != nil {
+		return nil, err
+	}
+	return activities, nil
+}
+
+func (r *ActivityRepo) GetActivityTypeCounts(eventID string) ([]models.ActivityTypeCount, error) {
+	var counts []models.ActivityTypeCount
+	err := r.DB.Model(&models.Activity{}).
+		Select("type, COUNT(*) AS count").
+		Where("event_id = ? AND is_hidden = ?", eventID, false).
+		Group("type").
+		Order("type ASC").
+		Scan(&counts).Error
+	if err != nil {
+		return nil, err
+	}
+	return counts, nil
+}
+
+// GetActivitiesCapacitySnapshot returns registration and waitlist counts for every activity
+// of the event, hidden ones included, using grouped counts instead of a query per activity
+func (r *ActivityRepo) GetActivitiesCapacitySnapshot(eventID string) ([]models.ActivityCapacitySnapshot, error) {
+	registered := r.DB.Model(&models.ActivityRegistration{}).
+		Select("activity_id, COUNT(*) AS total").
+		Group("activity_id")
+	waitlisted := r.DB.Model(&models.ActivityWaitlist{}).
+		Select("activity_id, COUNT(*) AS total").
+		Where("status = ?", models.WaitlistWaiting).
+		Group("activity_id")
+
+	var snapshots []models.ActivityCapacitySnapshot
+	err := r.DB.Table("activities").
+		Select(`activities.id AS activity_id, activities.name, activities.start_time, activities.has_unlimited_capacity,
+			activities.max_capacity AS max, COALESCE(registered.total, 0) AS registered, COALESCE(waitlisted.total, 0) AS waitlisted`).
+		Joins("LEFT JOIN (?) AS registered ON registered.activity_id = activities.id", registered).
+		Joins("LEFT JOIN (?) AS waitlisted ON waitlisted.activity_id = activities.id", waitlisted).
+		Where("activities.event_id = ? AND activities.deleted_at IS NULL", eventID).
+		Order("activities.start_time ASC, activities.display_order ASC").
+		Scan(&snapshots).Error
+	if err != nil {
+		return nil, err
+	}
+
+	return snapshots, nil
+}
+
+// GetActivityDemandCounts returns how many users are registered to the activity and how many are still waiting for a seat
+func (r *ActivityRepo) GetActivityDemandCounts(activityID string) (int64, int64, error) {
+	var registered int64
+	if err := r.DB.Model(&models.ActivityRegistration{}).
+		Where("activity_id = ?", activityID).
+		Count(&registered).Error; err != nil {
+		return 0, 0, err
+	}
+
+	var waitlisted int64
+	if err := r.DB.Model(&models.ActivityWaitlist{}).
+		Where("activity_id = ? AND status = ?", activityID, models.WaitlistWaiting).
+		Count(&waitlisted).Error; err != nil {
+		return 0, 0, err
+	}
+
+	return registered, waitlisted, nil
+}
+
+// GetCheckinBuckets counts the activity check-ins grouped in buckets of the given size, ordered by time
+func (r *ActivityRepo) GetCheckinBuckets(activityID string, bucket time.Duration) ([]models.CheckinBucket, error) {
+	seconds := int64(bucket.Seconds())
+
+	var buckets []models.CheckinBucket
+	err := r.DB.Model(&models.ActivityRegistration{}).
+		Select("to_timestamp(floor(extract(epoch FROM attended_at) / ?) * ?) AS start, COUNT(*) AS count", seconds, seconds).
+		Where("activity_id = ? AND attended_at IS NOT NULL", activityID).
+		Group("1").
+		Order("1").
+		Scan(&buckets).Error
+	if err != nil {
+		return nil, err
+	}
+
+	return buckets, nil
+}
+
+func (r *ActivityRepo) GetCoffeeBreaksLive(eventID string) ([]models.CoffeeBreakLive, error) {
+	counts := r.DB.Model(&models.ActivityRegistration{}).
+		Select("activity_id, COUNT(*) AS registered, COUNT(attended_at) AS attended").
+		Group("activity_id")
+
+	var coffeeBreaks []models.CoffeeBreakLive
+	err := r.DB.Table("activities").
+		Select(`activities.id AS activity_id, activities.name, activities.location, activities.start_time, activities.end_time,
+			activities.has_unlimited_capacity, activities.max_capacity AS max,
+			COALESCE(counts.registered, 0) AS registered, COALESCE(counts.attended, 0) AS attended`).
+		Joins("LEFT JOIN (?) AS counts ON counts.activity_id = activities.id", counts).
+		Where("activities.event_id = ? AND activities.type = ? AND activities.deleted_at IS NULL", eventID, models.ActivityCoffeeBreak).
+		Order("activities.start_time ASC, activities.display_order ASC").
+		Scan(&coffeeBreaks).Error
+	if err != nil {
+		return nil, err
+	}
+
+	return coffeeBreaks, nil
+}
+
+func (r *ActivityRepo) GetFeeActivitiesFromEvent(eventID string) ([]models.Activity, error) {
+	var activities []models.Activity
+	if err := r.DB.Where("event_id = ? AND has_fee = ?", eventID, true).
+		Order("start_time ASC, display_order ASC").
+		Find(&activities).Error; err != nil {
+		return nil, err
+	}
+	return activities, nil
+}
+
+// GetPurchasableAccessTargets returns the access targets pointing to the activities
+// whose products can still be bought
+func (r *ActivityRepo) GetPurchasableAccessTargets(activityIDs []string) ([]models.AccessTarget, error) {
+	var targets []models.AccessTarget
+	err := r.DB.Joins("JOIN products ON products.id = access_targets.product_id AND products.deleted_at IS NULL").
+		Where("access_targets.target_id IN ? AND access_targets.is_event = ?", activityIDs, false).
+		Where("products.is_blocked = ? AND products.expires_at > ?", false, time.Now()).
+		Find(&targets).Error
+	if err != nil {
+		return nil, err
+	}
+	return targets, nil
+}
+
+func (r *ActivityRepo) HasPurchasableActivityTokens(eventID string) (bool, error) {
+	var count int64
+	err := r.DB.Model(&models.Product{}).
+		Where("event_id = ? AND is_activity_token = ? AND token_quantity > 0", eventID, true).
+		Where("is_blocked = ? AND expires_at > ?", false, time.Now()).
+		Count(&count).Error
+	if err != nil {
+		return false, err
+	}
+	return count > 0, nil
+}
+
+// ReorderActivities sets the display order of the event activities to their position in activityIDs
+func (r *ActivityRepo) ReorderActivities(eventID string, activityIDs []string) error {
+	return r.DB.Transaction(func(tx *gorm.DB) error {
+		for i, activityID := range activityIDs {
+			result := tx.Model(&models.Activity{}).
+				Where("id = ? AND event_id = ?", activityID, eventID).
+				Update("display_order", i)
+			if result.Error != nil {
+				return result.Error
+			}
+			if result.RowsAffected == 0 {
+				return errors.New("activity " + activityID + " does not belong to this event")
+			}
+		}
+		return nil
+	})
+}
+
+// DeleteHiddenActivities deletes the hidden activities of the event that nobody registered to
+// in a single transaction, the ones with registrations are reported back as skipped
+func (r *ActivityRepo) DeleteHiddenActivities(eventID string) (models.HiddenActivitiesPurgeResult, error) {
+	result := models.HiddenActivitiesPurgeResult{
+		DeletedIDs: []string{},
+		Skipped:    []models.SkippedActivity{},
+	}
+
+	err := r.DB.Transaction(func(tx *gorm.DB) error {
+		var activities []models.Activity
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("event_id = ? AND is_hidden = ?", eventID, true).
+			Order("start_time ASC").
+			Find(&activities).Error; err != nil {
+			return err
+		}
+
+		for _, activity := range activities {
+			var registrations int64
+			if err := tx.Model(&models.ActivityRegistration{}).
+				Where("activity_id = ?", activity.ID).
+				Count(&registrations).Error; err != nil {
+				return err
+			}
+
+			if registrations > 0 {
+				result.Skipped = append(result.Skipped, models.SkippedActivity{
+					ActivityID: activity.ID,
+					Name:       activity.Name,
+					Reason:     fmt.Sprintf("activity has %d registrations", registrations),
+				})
+				continue
+			}
+
+			if err := tx.Where("id = ?", activity.ID).Delete(&models.Activity{}).Error; err != nil {
+				return err
+			}
+			result.DeletedIDs = append(result.DeletedIDs, activity.ID)
+		}
+
+		result.Deleted = len(result.DeletedIDs)
+		return nil
+	})
+
+	return result, err
+}
+
 func (r *ActivityRepo) UpdateActivity(activity *models.Activity) error {
 	return r.DB.Save(activity).Error
 }
 
+// UpdateActivityWithAudit saves the activity and its audit entry together
+func (r *ActivityRepo) UpdateActivityWithAudit(activity *models.Activity, audit *models.AuditLog) error {
+	return r.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Save(activity).Error; err != nil {
+			return err
+		}
+		return tx.Create(audit).Error
+	})
+}
+
+// GetActivityAuditEntries returns the audit entries of an action applied to the activity, oldest first
+func (r *ActivityRepo) GetActivityAuditEntries(activityID string, action models.AuditAction) ([]models.AuditEntry, error) {
+	var entries []models.AuditEntry
+	err := r.DB.Table("audit_logs").
+		Select("audit_logs.*, TRIM(CONCAT(users.name, ' ', users.last_name)) AS actor_name, users.email AS actor_email").
+		Joins("LEFT JOIN users ON users.id = audit_logs.actor_id").
+		Where("audit_logs.target_id = ? AND audit_logs.action = ?", activityID, action).
+		Order("audit_logs.created_at ASC").
+		Scan(&entries).Error
+	return entries, err
+}
+
 func (r *ActivityRepo) DeleteActivity(id string) error {
 	return r.DB.Where("id = ?", id).Delete(&models.Activity{}).Error
 }
@@ -78,6 +372,35 @@ func (r *ActivityRepo) IsUserRegisteredToActivity(activityID, userID string) (bo
 	return true, registration, nil
 }
 
+func (r *ActivityRepo) SetContactSharing(activityID, userID string, share bool) error {
+	result := r.DB.Model(&models.ActivityRegistration{}).
+		Where("activity_id = ? AND user_id = ?", activityID, userID).
+		Update("share_contact", share)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
+
+func (r *ActivityRepo) GetSpeakerRoster(activityID string) ([]models.SpeakerRosterEntry, error) {
+	var roster []models.SpeakerRosterEntry
+	err := r.DB.Table("activity_registrations").
+		Select(`users.name, users.last_name, CASE WHEN activity_registrations.share_contact THEN users.email END AS email,
+			activity_registrations.attended_at IS NOT NULL AS attended`).
+		Joins("JOIN users ON users.id = activity_registrations.user_id AND users.deleted_at IS NULL").
+		Where("activity_registrations.activity_id = ? AND activity_registrations.deleted_at IS NULL", activityID).
+		Order("users.name ASC, users.last_name ASC").
+		Scan(&roster).Error
+	if err != nil {
+		return nil, err
+	}
+
+	return roster, nil
+}
+
 func (r *ActivityRepo) SetUserAttendance(activityID, userID string, attended bool) error {
 	var registration models.ActivityRegistration
 	err := r.DB.Where("activity_id = ? AND user_id = ?", activityID, userID).
@@ -87,14 +410,132 @@ func (r *ActivityRepo) SetUserAttendance(activityID, userID string, attended boo
 		return err
 	}
 
-	if attended {
-		now := time.Now()
-		registration.AttendedAt = &now
-	} else {
+	if !attended {
 		registration.AttendedAt = nil
+		return r.DB.Save(&registration).Error
+	}
+
+	now := time.Now()
+	registration.AttendedAt = &now
+
+	// The first attendance in the event also checks the user in to it
+	return r.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Save(&registration).Error; err != nil {
+			return err
+		}
+		return tx.Model(&models.EventRegistration{}).
+			Where("user_id = ? AND checked_in_at IS NULL AND event_id = (?)",
+				userID, tx.Model(&models.Activity{}).Select("event_id").Where("id = ?", activityID)).
+			Update("checked_in_at", now).Error
+	})
+}
+
+// BackfillActivityRegistrations registers the event registrants that aren't registered to the activity yet,
+// walking them in batches. Registrations created meanwhile by the users themselves are left as they are
+func (r *ActivityRepo) BackfillActivityRegistrations(activityID, eventID string, batchSize int) (int64, error) {
+	var registered int64
+	lastUserID := ""
+	for {
+		var userIDs []string
+		err := r.DB.Model(&models.EventRegistration{}).
+			Where("event_id = ? AND user_id > ?", eventID, lastUserID).
+			Where("user_id NOT IN (?)", r.DB.Model(&models.ActivityRegistration{}).Select("user_id").Where("activity_id = ?", activityID)).
+			Order("user_id ASC").
+			Limit(batchSize).
+			Pluck("user_id", &userIDs).Error
+		if err != nil {
+			return registered, err
+		}
+		if len(userIDs) == 0 {
+			return registered, nil
+		}
+
+		registrations := make([]models.ActivityRegistration, len(userIDs))
+		for i, userID := range userIDs {
+			registrations[i] = models.ActivityRegistration{
+				ActivityID:   activityID,
+				UserID:       userID,
+				AccessMethod: string(models.AccessMethodEvent),
+			}
+		}
+
+		result := r.DB.Clauses(clause.OnConflict{DoNothing: true}).Create(&registrations)
+		if result.Error != nil {
+			return registered, result.Error
+		}
+		registered += result.RowsAffected
+		lastUserID = userIDs[len(userIDs)-1]
+	}
+}
+
+func (r *ActivityRepo) CountEventRegistrations(eventID string) (int64, error) {
+	var count int64
+	if err := r.DB.Model(&models.EventRegistration{}).Where("event_id = ?", eventID).Count(&count).Error; err != nil {
+		return 0, err
+	}
+	return count, nil
+}
+
+// SetUsersAttendance marks the registered users among userIDs as attended in one transaction, checking them in
+// to the event on their first attendance. Returns the status of each user, users missing from it aren't registered
+func (r *ActivityRepo) SetUsersAttendance(activityID string, userIDs []string, attendedAt time.Time) (map[string]models.AttendBatchStatus, error) {
+	statuses := make(map[string]models.AttendBatchStatus, len(userIDs))
+	err := r.DB.Transaction(func(tx *gorm.DB) error {
+		var registrations []models.ActivityRegistration
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("activity_id = ? AND user_id IN ?", activityID, userIDs).
+			Find(&registrations).Error; err != nil {
+			return err
+		}
+
+		var toMark []string
+		for _, registration := range registrations {
+			if registration.AttendedAt != nil {
+				statuses[registration.UserID] = models.AttendBatchAlreadyAttended
+				continue
+			}
+			statuses[registration.UserID] = models.AttendBatchSuccess
+			toMark = append(toMark, registration.UserID)
+		}
+		if len(toMark) == 0 {
+			return nil
+		}
+
+		if err := tx.Model(&models.ActivityRegistration{}).
+			Where("activity_id = ? AND user_id IN ?", activityID, toMark).
+			Update("attended_at", attendedAt).Error; err != nil {
+			return err
+		}
+
+		return tx.Model(&models.EventRegistration{}).
+			Where("user_id IN ? AND checked_in_at IS NULL AND event_id = (?)",
+				toMark, tx.Model(&models.Activity{}).Select("event_id").Where("id = ?", activityID)).
+			Update("checked_in_at", attendedAt).Error
+	})
+	if err != nil {
+		return nil, err
 	}
+	return statuses, nil
+}
 
-	return r.DB.Save(&registration).Error
+// FinalizeActivityAttendance marks every confirmed registration without attendance as a no-show
+// and locks the activity attendance, returning how many no-shows were marked
+func (r *ActivityRepo) FinalizeActivityAttendance(activityID string, finalizedAt time.Time) (int64, error) {
+	var noShows int64
+	err := r.DB.Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(&models.ActivityRegistration{}).
+			Where("activity_id = ? AND attended_at IS NULL AND confirm_by IS NULL", activityID).
+			Update("no_show", true)
+		if result.Error != nil {
+			return result.Error
+		}
+		noShows = result.RowsAffected
+
+		return tx.Model(&models.Activity{}).
+			Where("id = ?", activityID).
+			Update("attendance_finalized_at", finalizedAt).Error
+	})
+	return noShows, err
 }
 
 func (r *ActivityRepo) GetActivityCapacity(activityID string) (int, int, error) {
@@ -309,6 +750,21 @@ func (r *ActivityRepo) GetUserActivities(userID string) ([]models.Activity, erro
 	return activities, nil
 }
 
+// GetUserInProgressActivities returns the event activities the user is registered for
+// that are happening at the given time
+func (r *ActivityRepo) GetUserInProgressActivities(userID, eventID string, now time.Time) ([]models.Activity, error) {
+	var activities []models.Activity
+	err := r.DB.Joins("JOIN activity_registrations ON activity_registrations.activity_id = activities.id AND activity_registrations.deleted_at IS NULL").
+		Where("activity_registrations.user_id = ? AND activities.event_id = ?", userID, eventID).
+		Where("activities.start_time <= ? AND activities.end_time >= ?", now, now).
+		Order("activities.start_time ASC, activities.display_order ASC").
+		Find(&activities).Error
+	if err != nil {
+		return nil, err
+	}
+	return activities, nil
+}
+
 func (r *ActivityRepo) GetUserAttendedActivities(userID string) ([]models.Activity, error) {
 	var activitiesRegistrations []models.ActivityRegistration
 	if err := r.DB.Where("user_id = ? AND attended_at IS NOT NULL", userID).Find(&activitiesRegistrations).Error; err != nil {
@@ -349,3 +805,316 @@ func (r *ActivityRepo) GetAllAttendancesFromEvent(eventID string) ([]models.Acti
 
 	return attendances, nil
 }
+
+// GetActivityTokenRevenue sums the tokens redeemed on each fee activity of the event and their share
+// of the token product price. Fee activities without redemptions are listed with zero
+func (r *ActivityRepo) GetActivityTokenRevenue(eventID string) ([]models.ActivityRevenue, error) {
+	redemptions := r.DB.Table("user_tokens").
+		Select(`user_tokens.used_for_id AS activity_id, COUNT(*) AS tokens,
+			SUM(COALESCE(products.price_int::numeric / NULLIF(products.token_quantity, 0), 0)) AS revenue`).
+		Joins("JOIN products ON products.id = user_tokens.product_id").
+		Where("user_tokens.is_used = ? AND user_tokens.used_for_id IS NOT NULL AND user_tokens.deleted_at IS NULL", true).
+		Group("user_tokens.used_for_id")
+
+	var revenues []models.ActivityRevenue
+	err := r.DB.Model(&models.Activity{}).
+		Select(`activities.id AS activity_id, activities.name, activities.start_time,
+			COALESCE(redemptions.tokens, 0) AS tokens_redeemed, COALESCE(ROUND(redemptions.revenue), 0) AS revenue_int`).
+		Joins("LEFT JOIN (?) AS redemptions ON redemptions.activity_id = activities.id", redemptions).
+		Where("activities.event_id = ? AND (activities.has_fee = ? OR activities.needs_token = ?)", eventID, true, true).
+		Order("revenue_int DESC, activities.start_time ASC").
+		Scan(&revenues).Error
+	return revenues, err
+}
+
+func (r *ActivityRepo) CreateWaitlistEntry(entry *models.ActivityWaitlist) error {
+	return r.DB.Create(entry).Error
+}
+
+func (r *ActivityRepo) GetWaitlistEntry(activityID, userID string) (*models.ActivityWaitlist, error) {
+	var entry models.ActivityWaitlist
+	if err := r.DB.Where("activity_id = ? AND user_id = ? AND status <> ?", activityID, userID, models.WaitlistExpired).
+		First(&entry).Error; err != nil {
+		return nil, err
+	}
+	return &entry, nil
+}
+
+func (r *ActivityRepo) GetWaitingEntries(activityID string) ([]models.ActivityWaitlist, error) {
+	var entries []models.ActivityWaitlist
+	if err := r.DB.Where("activity_id = ? AND status = ?", activityID, models.WaitlistWaiting).
+		Order("created_at ASC").
+		Find(&entries).Error; err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
+
+func (r *ActivityRepo) GetUserWaitlistEntries(userID string) ([]models.ActivityWaitlist, error) {
+	var entries []models.ActivityWaitlist
+	if err := r.DB.Where("user_id = ? AND status <> ?", userID, models.WaitlistExpired).
+		Order("created_at ASC").
+		Find(&entries).Error; err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
+
+// GetUserWaitlistPositions returns, per activity, how many users are waiting ahead of the user
+func (r *ActivityRepo) GetUserWaitlistPositions(userID string, activityIDs []string) (map[string]int, error) {
+	var rows []struct {
+		ActivityID string
+		Ahead      int
+	}
+	err := r.DB.Table("activity_waitlists AS mine").
+		Select("mine.activity_id, COUNT(other.id) AS ahead").
+		Joins("LEFT JOIN activity_waitlists AS other ON other.activity_id = mine.activity_id AND other.status = ? AND other.created_at < mine.created_at AND other.deleted_at IS NULL", models.WaitlistWaiting).
+		Where("mine.user_id = ? AND mine.status = ? AND mine.activity_id IN ? AND mine.deleted_at IS NULL", userID, models.WaitlistWaiting, activityIDs).
+		Group("mine.activity_id").
+		Scan(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+
+	ahead := make(map[string]int)
+	for _, row := range rows {
+		ahead[row.ActivityID] = row.Ahead
+	}
+	return ahead, nil
+}
+
+func (r *ActivityRepo) GetActivitiesByIDs(ids []string) ([]models.Activity, error) {
+	var activities []models.Activity
+	if err := r.DB.Where("id IN ?", ids).Find(&activities).Error; err != nil {
+		return nil, err
+	}
+	return activities, nil
+}
+
+func (r *ActivityRepo) GetEventsByIDs(ids []string) ([]models.Event, error) {
+	var events []models.Event
+	if err := r.DB.Where("id IN ?", ids).Find(&events).Error; err != nil {
+		return nil, err
+	}
+	return events, nil
+}
+
+func (r *ActivityRepo) GetUserRegistrationsForActivities(userID string, activityIDs []string) ([]models.ActivityRegistration, error) {
+	var registrations []models.ActivityRegistration
+	if err := r.DB.Where("user_id = ? AND activity_id IN ?", userID, activityIDs).Find(&registrations).Error; err != nil {
+		return nil, err
+	}
+	return registrations, nil
+}
+
+func (r *ActivityRepo) SetWaitlistStatus(activityID, userID string, status models.WaitlistStatus) error {
+	return setWaitlistStatus(r.DB, activityID, userID, status)
+}
+
+func (r *ActivityRepo) DeleteWaitlistEntry(activityID, userID string) error {
+	return deleteWaitlistEntry(r.DB, activityID, userID)
+}
+
+// RegisterUserToActivityWithCapacity inserts the registration while holding a lock on the
+// activity row, so concurrent registrations can't overfill it. While users are waiting for
+// the activity, only the first one in line may take a freed seat directly
+func (r *ActivityRepo) RegisterUserToActivityWithCapacity(registration *models.ActivityRegistration) error {
+	return r.DB.Transaction(func(tx *gorm.DB) error {
+		return createActivityRegistration(tx, registration)
+	})
+}
+
+// RegisterUserToActivitiesBatch creates every registration and marks the tokens they spend as used,
+// all of them or none. The capacity and waitlist checks are the same as for a single registration
+func (r *ActivityRepo) RegisterUserToActivitiesBatch(registrations []models.ActivityRegistration, tokens []models.UserToken) error {
+	return r.DB.Transaction(func(tx *gorm.DB) error {
+		for i := range registrations {
+			if err := createActivityRegistration(tx, &registrations[i]); err != nil {
+				return fmt.Errorf("activity %s: %w", registrations[i].ActivityID, err)
+			}
+		}
+
+		for i := range tokens {
+			result := tx.Model(&models.UserToken{}).
+				Where("id = ? AND is_used = ?", tokens[i].ID, false).
+				Updates(map[string]interface{}{
+					"is_used":     true,
+					"used_at":     tokens[i].UsedAt,
+					"used_for_id": tokens[i].UsedForID,
+				})
+			if result.Error != nil {
+				return result.Error
+			}
+			if result.RowsAffected == 0 {
+				return errors.New("token " + tokens[i].ID + " was already used")
+			}
+		}
+
+		return nil
+	})
+}
+
+// createActivityRegistration registers within the activity capacity, unless the free seats are
+// reserved to users on the waitlist
+func createActivityRegistration(tx *gorm.DB, registration *models.ActivityRegistration) error {
+	activity, err := registerWithinCapacity(tx, registration)
+	if err != nil {
+		return err
+	}
+
+	if !activity.HasUnlimitedCapacity {
+		var first models.ActivityWaitlist
+		err := tx.Where("activity_id = ? AND status = ?", registration.ActivityID, models.WaitlistWaiting).
+			Order("created_at ASC").
+			First(&first).Error
+		if err == nil && first.UserID != registration.UserID {
+			return errors.New("activity has reached maximum capacity, free seats go to the waitlist")
+		}
+		if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+			return err
+		}
+	}
+
+	if err := tx.Create(registration).Error; err != nil {
+		return err
+	}
+
+	return deleteWaitlistEntry(tx, registration.ActivityID, registration.UserID)
+}
+
+// PromoteWaitlistEntry registers a waiting user under the same activity lock used for
+// direct registrations. With a ConfirmBy deadline the entry is kept as offered until the
+// user confirms, otherwise it is removed
+func (r *ActivityRepo) PromoteWaitlistEntry(registration *models.ActivityRegistration) error {
+	return r.DB.Transaction(func(tx *gorm.DB) error {
+		if _, err := registerWithinCapacity(tx, registration); err != nil {
+			return err
+		}
+
+		if err := tx.Create(registration).Error; err != nil {
+			return err
+		}
+
+		if registration.ConfirmBy != nil {
+			return setWaitlistStatus(tx, registration.ActivityID, registration.UserID, models.WaitlistOffered)
+		}
+		return deleteWaitlistEntry(tx, registration.ActivityID, registration.UserID)
+	})
+}
+
+// ConfirmWaitlistPromotion makes a tentative registration final. The deadline is checked again
+// in the update so a confirmation can't win over the sweeper once the seat was released
+func (r *ActivityRepo) ConfirmWaitlistPromotion(activityID, userID string) error {
+	return r.DB.Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(&models.ActivityRegistration{}).
+			Where("activity_id = ? AND user_id = ? AND confirm_by IS NOT NULL AND confirm_by >= ?", activityID, userID, time.Now()).
+			Update("confirm_by", nil)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return errors.New("waitlist promotion has expired")
+		}
+
+		return deleteWaitlistEntry(tx, activityID, userID)
+	})
+}
+
+// ReleaseWaitlistPromotion drops a tentative registration and gives back any token spent
+// on it. The waitlist entry is kept as expired or removed when the user left on their own.
+// Only registrations still pending are dropped, expiring also requires the deadline to have
+// passed, so a promotion confirmed in the meantime keeps its seat
+func (r *ActivityRepo) ReleaseWaitlistPromotion(activityID, userID string, expired bool) error {
+	return r.DB.Transaction(func(tx *gorm.DB) error {
+		query := tx.Where("activity_id = ? AND user_id = ? AND confirm_by IS NOT NULL", activityID, userID)
+		if expired {
+			query = query.Where("confirm_by < ?", time.Now())
+		}
+
+		result := query.Unscoped().Delete(&models.ActivityRegistration{})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return errors.New("waitlist promotion is no longer pending")
+		}
+
+		if err := releaseActivityToken(tx, userID, activityID); err != nil {
+			return err
+		}
+
+		if expired {
+			return setWaitlistStatus(tx, activityID, userID, models.WaitlistExpired)
+		}
+		return deleteWaitlistEntry(tx, activityID, userID)
+	})
+}
+
+func (r *ActivityRepo) ReleaseActivityToken(userID, activityID string) error {
+	return releaseActivityToken(r.DB, userID, activityID)
+}
+
+func (r *ActivityRepo) GetExpiredTentativeRegistrations(now time.Time) ([]models.ActivityRegistration, error) {
+	var registrations []models.ActivityRegistration
+	if err := r.DB.Where("confirm_by IS NOT NULL AND confirm_by < ?", now).
+		Find(&registrations).Error; err != nil {
+		return nil, err
+	}
+	return registrations, nil
+}
+
+// registerWithinCapacity locks the activity row and checks a registration still fits
+func registerWithinCapacity(tx *gorm.DB, registration *models.ActivityRegistration) (*models.Activity, error) {
+	var activity models.Activity
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+		First(&activity, "id = ?", registration.ActivityID).Error; err != nil {
+		return nil, err
+	}
+
+	var count int64
+	if err := tx.Model(&models.ActivityRegistration{}).
+		Where("activity_id = ? AND user_id = ?", registration.ActivityID, registration.UserID).
+		Count(&count).Error; err != nil {
+		return nil, err
+	}
+	if count > 0 {
+		return nil, errors.New("user already registered to this activity")
+	}
+
+	if activity.HasUnlimitedCapacity {
+		return &activity, nil
+	}
+
+	if err := tx.Model(&models.ActivityRegistration{}).
+		Where("activity_id = ?", registration.ActivityID).
+		Count(&count).Error; err != nil {
+		return nil, err
+	}
+	if int(count) >= activity.MaxCapacity {
+		return nil, errors.New("activity has reached maximum capacity")
+	}
+
+	return &activity, nil
+}
+
+func setWaitlistStatus(tx *gorm.DB, activityID, userID string, status models.WaitlistStatus) error {
+	return tx.Model(&models.ActivityWaitlist{}).
+		Where("activity_id = ? AND user_id = ? AND status <> ?", activityID, userID, models.WaitlistExpired).
+		Update("status", status).Error
+}
+
+func deleteWaitlistEntry(tx *gorm.DB, activityID, userID string) error {
+	return tx.Where("activity_id = ? AND user_id = ? AND status <> ?", activityID, userID, models.WaitlistExpired).
+		Unscoped().
+		Delete(&models.ActivityWaitlist{}).Error
+}
+
+func releaseActivityToken(tx *gorm.DB, userID, activityID string) error {
+	return tx.Model(&models.UserToken{}).
+		Where("user_id = ? AND is_used = ? AND used_for_id = ?", userID, true, activityID).
+		Updates(map[string]interface{}{
+			"is_used":     false,
+			"used_at":     nil,
+			"used_for_id": nil,
+		}).Error
+}
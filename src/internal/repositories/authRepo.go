@@ -28,6 +28,31 @@ func (r *AuthRepo) CreateUser(user *models.User) error {
 	return nil
 }
 
+// CreateUsers creates all the users or none of them
+func (r *AuthRepo) CreateUsers(users []*models.User) error {
+	return r.DB.Transaction(func(tx *gorm.DB) error {
+		for _, user := range users {
+			if err := tx.Create(user).Error; err != nil {
+				return errors.New("error creating user " + user.Email + ": " + err.Error())
+			}
+		}
+		return nil
+	})
+}
+
+func (r *AuthRepo) GetExistingEmails(emails []string) (map[string]bool, error) {
+	var found []string
+	if err := r.DB.Model(&models.User{}).Where("email IN ?", emails).Pluck("email", &found).Error; err != nil {
+		return nil, err
+	}
+
+	existing := make(map[string]bool, len(found))
+	for _, email := range found {
+		existing[email] = true
+	}
+	return existing, nil
+}
+
 func (r *AuthRepo) CreateUserVerification(userID string, verificationNumber int) error {
 	v := &models.UserVerification{
 		ID:                 userID,
@@ -69,12 +94,78 @@ func (r *AuthRepo) UpdateUserVerification(userID string, verificationNumber int)
 	return nil
 }
 
+func (r *AuthRepo) unverifiedUsersQuery(createdBefore time.Time) *gorm.DB {
+	return r.DB.Table("users").
+		Joins("LEFT JOIN user_verifications ON user_verifications.id = users.id AND user_verifications.deleted_at IS NULL").
+		Where("users.deleted_at IS NULL AND users.is_verified = ? AND users.created_at < ?", false, createdBefore)
+}
+
+func (r *AuthRepo) GetUnverifiedUsers(createdBefore time.Time, offset, limit int) ([]models.UnverifiedUser, int64, error) {
+	var total int64
+	if err := r.unverifiedUsersQuery(createdBefore).Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	var users []models.UnverifiedUser
+	err := r.unverifiedUsersQuery(createdBefore).
+		Select("users.id, users.name, users.last_name, users.email, users.created_at, user_verifications.updated_at AS last_code_sent_at").
+		Order("users.created_at ASC").
+		Offset(offset).
+		Limit(limit).
+		Scan(&users).Error
+	if err != nil {
+		return nil, 0, err
+	}
+
+	return users, total, nil
+}
+
+// CountUnverifiedUsersInCooldown counts the unverified users that got a code after sentAfter
+func (r *AuthRepo) CountUnverifiedUsersInCooldown(createdBefore, sentAfter time.Time) (int64, error) {
+	var count int64
+	err := r.unverifiedUsersQuery(createdBefore).
+		Where("user_verifications.updated_at >= ?", sentAfter).
+		Count(&count).Error
+	return count, err
+}
+
+// GetUnverifiedUsersToNotify returns the unverified users that did not get a code since sentBefore,
+// oldest accounts first, along with how many of them are eligible in total
+func (r *AuthRepo) GetUnverifiedUsersToNotify(createdBefore, sentBefore time.Time, limit int) ([]models.User, int64, error) {
+	eligible := func() *gorm.DB {
+		return r.unverifiedUsersQuery(createdBefore).
+			Where("(user_verifications.updated_at IS NULL OR user_verifications.updated_at < ?)", sentBefore)
+	}
+
+	var total int64
+	if err := eligible().Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	var users []models.User
+	err := eligible().
+		Select("users.*").
+		Order("users.created_at ASC").
+		Limit(limit).
+		Scan(&users).Error
+	if err != nil {
+		return nil, 0, err
+	}
+
+	return users, total, nil
+}
+
+// CreateSuperUser creates the master user from the config on first boot only.
+// Once it exists its password is never touched again, so a rotated password survives restarts
 func (r *AuthRepo) CreateSuperUser() {
 	var existingUser models.User
 	err := r.DB.Where("email = ?", config.GetSystemEmail()).First(&existingUser).Error
-	if !errors.Is(err, gorm.ErrRecordNotFound) {
+	if err == nil {
 		return
 	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		log.Fatal("could not check for master user: " + err.Error())
+	}
 
 	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(config.GetMasterUserPass()), bcrypt.DefaultCost)
 	if err != nil {
@@ -144,6 +235,33 @@ func (r *AuthRepo) UpdateUser(user *models.User) error {
 	return r.DB.Save(user).Error
 }
 
+func (r *AuthRepo) GetEventCreators() ([]models.EventCreator, error) {
+	var creators []models.EventCreator
+	err := r.DB.Model(&models.User{}).
+		Select("id, name, last_name, email, created_at").
+		Where("is_event_creator = ?", true).
+		Order("name ASC, last_name ASC").
+		Scan(&creators).Error
+	return creators, err
+}
+
+func (r *AuthRepo) GetUsersByEmails(emails []string) ([]models.User, error) {
+	var users []models.User
+	err := r.DB.Where("email IN ?", emails).Find(&users).Error
+	return users, err
+}
+
+// SetEventCreatorStatus changes the event creator flag of the users and records an audit entry
+// for each of them in a single transaction
+func (r *AuthRepo) SetEventCreatorStatus(userIDs []string, isEventCreator bool, audits []models.AuditLog) error {
+	return r.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&models.User{}).Where("id IN ?", userIDs).Update("is_event_creator", isEventCreator).Error; err != nil {
+			return err
+		}
+		return tx.Create(&audits).Error
+	})
+}
+
 func (r *AuthRepo) CreateRefreshToken(userID, refreshToken string) error {
 	token := models.RefreshToken{
 		UserID:   userID,
@@ -201,6 +319,16 @@ func (r *AuthRepo) GetAllAdminStatusFromUser(userID string) ([]models.AdminStatu
 	return adminStatuses, nil
 }
 
+// RotatePassword replaces the password and revokes every session of the user
+func (r *AuthRepo) RotatePassword(userID string, hashedPassword string) error {
+	return r.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&models.UserPass{}).Where("id = ?", userID).Update("password", hashedPassword).Error; err != nil {
+			return err
+		}
+		return tx.Where("user_id = ?", userID).Delete(&models.RefreshToken{}).Error
+	})
+}
+
 func (r *AuthRepo) UpdateUserPassword(userID string, hashedPassword string) error {
 	result := r.DB.Model(&models.UserPass{}).
 		Where("id = ?", userID).
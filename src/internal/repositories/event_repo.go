@@ -4,8 +4,10 @@ import (
 	"errors"
 	"scti/internal/models"
 	"slices"
+	"time"
 
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 type EventRepo struct {
@@ -28,12 +30,41 @@ func (r *EventRepo) GetEventBySlug(slug string) (*models.Event, error) {
 	return &event, nil
 }
 
-func (r *EventRepo) GetAllEvents() ([]models.Event, error) {
-	var events []models.Event
-	if err := r.DB.Where("is_hidden = ?", false).Find(&events).Error; err != nil {
+// GetEventByID also finds hidden and deleted events, it's meant for records that outlive the event
+func (r *EventRepo) GetEventByID(id string) (*models.Event, error) {
+	var event models.Event
+	if err := r.DB.Unscoped().Where("id = ?", id).First(&event).Error; err != nil {
 		return nil, err
 	}
-	return events, nil
+	return &event, nil
+}
+
+// GetAllEvents returns the visible events running in the filter range along with how many there are,
+// a limit of 0 returns every matching event
+func (r *EventRepo) GetAllEvents(filter models.EventFilter, offset, limit int) ([]models.Event, int64, error) {
+	query := r.DB.Model(&models.Event{}).Where("is_hidden = ?", false)
+	if filter.From != nil {
+		query = query.Where("end_date >= ?", *filter.From)
+	}
+	if filter.To != nil {
+		query = query.Where("start_date <= ?", *filter.To)
+	}
+
+	var total int64
+	if err := query.Session(&gorm.Session{}).Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	query = query.Order("start_date ASC, id ASC")
+	if limit > 0 {
+		query = query.Offset(offset).Limit(limit)
+	}
+
+	var events []models.Event
+	if err := query.Find(&events).Error; err != nil {
+		return nil, 0, err
+	}
+	return events, total, nil
 }
 
 func (r *EventRepo) GetAllPublicEvents() ([]models.Event, error) {
@@ -62,6 +93,31 @@ func (r *EventRepo) DeleteEventRegistration(userID string, eventID string) error
 		Delete(&models.EventRegistration{}).Error
 }
 
+// CancelEventRegistration deletes the registration and records the cancellation together
+func (r *EventRepo) CancelEventRegistration(cancellation *models.RegistrationCancellation) error {
+	return r.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("user_id = ? AND event_id = ?", cancellation.UserID, cancellation.EventID).
+			Unscoped().
+			Delete(&models.EventRegistration{}).Error; err != nil {
+			return err
+		}
+		return tx.Create(cancellation).Error
+	})
+}
+
+// GetCancellationReasonCounts groups the event cancellations by reason ignoring case and surrounding
+// spaces, the most given first. Cancellations without a reason come back under an empty reason
+func (r *EventRepo) GetCancellationReasonCounts(eventID string) ([]models.CancellationReasonCount, error) {
+	var counts []models.CancellationReasonCount
+	err := r.DB.Model(&models.RegistrationCancellation{}).
+		Select("MIN(TRIM(reason)) AS reason, COUNT(*) AS count").
+		Where("event_id = ?", eventID).
+		Group("LOWER(TRIM(reason))").
+		Order("count DESC, reason ASC").
+		Scan(&counts).Error
+	return counts, err
+}
+
 func (r *EventRepo) IsUserRegisteredToEvent(userID string, slug string) (bool, error) {
 	var event models.Event
 	if err := r.DB.Where("slug = ?", slug).First(&event).Error; err != nil {
@@ -226,6 +282,21 @@ func (r *EventRepo) GetEventsCreatedByUser(userID string) ([]models.Event, error
 	return events, nil
 }
 
+// GetManageableEvents returns the events the user created or is a master admin of
+func (r *EventRepo) GetManageableEvents(userID string) ([]models.Event, error) {
+	masterOf := r.DB.Model(&models.AdminStatus{}).
+		Select("event_id").
+		Where("user_id = ? AND admin_type = ?", userID, models.AdminTypeMaster)
+
+	var events []models.Event
+	err := r.DB.Where("created_by = ? OR id IN (?)", userID, masterOf).Find(&events).Error
+	if err != nil {
+		return nil, err
+	}
+
+	return events, nil
+}
+
 func (r *EventRepo) GetUserEvents(userID string) ([]models.Event, error) {
 	var registrations []models.EventRegistration
 	err := r.DB.Where("user_id = ?", userID).Find(&registrations).Error
@@ -247,6 +318,49 @@ func (r *EventRepo) GetUserEvents(userID string) ([]models.Event, error) {
 	return events, nil
 }
 
+// GetUserEventsByEndDate returns the events the user is registered to that haven't ended yet,
+// or with past set the ones that already ended (most recent first)
+func (r *EventRepo) GetUserEventsByEndDate(userID string, now time.Time, past bool) ([]models.Event, error) {
+	query := r.DB.Model(&models.Event{}).
+		Joins("JOIN event_registrations ON event_registrations.event_id = events.id").
+		Where("event_registrations.user_id = ?", userID)
+
+	if past {
+		query = query.Where("events.end_date < ?", now).Order("events.end_date DESC")
+	} else {
+		query = query.Where("events.end_date >= ?", now).Order("events.start_date ASC")
+	}
+
+	var events []models.Event
+	if err := query.Find(&events).Error; err != nil {
+		return nil, err
+	}
+
+	return events, nil
+}
+
+// GetProductsSoldCounts returns the units of each product still sold, refunded units left out
+func (r *EventRepo) GetProductsSoldCounts(productIDs []string) (map[string]int, error) {
+	var rows []struct {
+		ProductID string
+		Sold      int
+	}
+	err := r.DB.Model(&models.Purchase{}).
+		Select("product_id, COALESCE(SUM(quantity - refunded_quantity), 0) AS sold").
+		Where("product_id IN ?", productIDs).
+		Group("product_id").
+		Scan(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+
+	sold := make(map[string]int, len(rows))
+	for _, row := range rows {
+		sold[row.ProductID] = row.Sold
+	}
+	return sold, nil
+}
+
 func (r *EventRepo) GetEventBoughtProductsIDs(eventID string) ([]string, error) {
 	var products []models.Product
 	if err := r.DB.Where("event_id = ?", eventID).Find(&products).Error; err != nil && err != gorm.ErrRecordNotFound {
@@ -292,6 +406,23 @@ func (r *EventRepo) GetAllActivitiesFromEvent(eventID string) ([]models.Activity
 	return activities, nil
 }
 
+// GetEventActivitiesByStart returns every activity of the event, hidden ones included, by start time
+func (r *EventRepo) GetEventActivitiesByStart(eventID string) ([]models.Activity, error) {
+	var activities []models.Activity
+	if err := r.DB.Where("event_id = ?", eventID).Order("start_time ASC").Find(&activities).Error; err != nil {
+		return nil, err
+	}
+	return activities, nil
+}
+
+func (r *EventRepo) GetEventProductsWithTargets(eventID string) ([]models.Product, error) {
+	var products []models.Product
+	if err := r.DB.Preload("AccessTargets").Where("event_id = ?", eventID).Find(&products).Error; err != nil {
+		return nil, err
+	}
+	return products, nil
+}
+
 func (r *EventRepo) RegisterUserToActivity(registration *models.ActivityRegistration) error {
 	var count int64
 	err := r.DB.Model(&models.ActivityRegistration{}).
@@ -324,6 +455,62 @@ func (r *EventRepo) GetAllAttendancesFromEvent(eventID string) ([]models.Activit
 	return attendances, nil
 }
 
+func (r *EventRepo) GetAttendanceRecords(eventID string) ([]models.AttendanceRecord, error) {
+	var records []models.AttendanceRecord
+	err := r.DB.Table("activity_registrations").
+		Select("activities.id AS activity_id, activities.name AS activity_name, users.id AS user_id, users.name, users.last_name, users.email, activity_registrations.attended_at").
+		Joins("JOIN activities ON activities.id = activity_registrations.activity_id AND activities.deleted_at IS NULL").
+		Joins("JOIN users ON users.id = activity_registrations.user_id AND users.deleted_at IS NULL").
+		Where("activities.event_id = ? AND activity_registrations.attended_at IS NOT NULL AND activity_registrations.deleted_at IS NULL", eventID).
+		Order("activity_registrations.attended_at ASC, activities.id, users.id").
+		Scan(&records).Error
+	if err != nil {
+		return nil, err
+	}
+	return records, nil
+}
+
+// StreamEventAttendances hands the attendances of the event to fn one row at a time, in attendance order
+func (r *EventRepo) StreamEventAttendances(eventID string, fn func(models.AttendanceExportRow) error) error {
+	rows, err := r.DB.Model(&models.ActivityRegistration{}).
+		Select(`users.name, users.last_name, users.email, activities.name AS activity_name,
+			activity_registrations.attended_at, activity_registrations.access_method`).
+		Joins("JOIN activities ON activities.id = activity_registrations.activity_id").
+		Joins("JOIN users ON users.id = activity_registrations.user_id").
+		Where("activities.event_id = ? AND activity_registrations.attended_at IS NOT NULL", eventID).
+		Order("activity_registrations.attended_at ASC").
+		Rows()
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var row models.AttendanceExportRow
+		if err := r.DB.ScanRows(rows, &row); err != nil {
+			return err
+		}
+		if err := fn(row); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+func (r *EventRepo) GetEventAttendeeRows(eventID string) ([]models.EventAttendeeRow, error) {
+	var rows []models.EventAttendeeRow
+	err := r.DB.Table("event_registrations").
+		Select("users.id AS user_id, users.name, users.last_name, users.email, event_registrations.registered_at, event_registrations.checked_in_at").
+		Joins("JOIN users ON users.id = event_registrations.user_id AND users.deleted_at IS NULL").
+		Where("event_registrations.event_id = ? AND event_registrations.deleted_at IS NULL", eventID).
+		Order("event_registrations.registered_at ASC").
+		Scan(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+	return rows, nil
+}
+
 func (r *EventRepo) GetUserAttendedActivities(userID string) ([]models.Activity, error) {
 	var activitiesRegistrations []models.ActivityRegistration
 	if err := r.DB.Where("user_id = ? AND attended_at IS NOT NULL", userID).Find(&activitiesRegistrations).Error; err != nil {
@@ -388,3 +575,376 @@ func (r *EventRepo) GetProductsFromUserProducts(userProducts []models.UserProduc
 
 	return products, nil
 }
+
+// GetEventTicketProducts returns the products of the event that grant access to it
+func (r *EventRepo) GetEventTicketProducts(eventID string) ([]models.Product, error) {
+	var products []models.Product
+	if err := r.DB.Where("event_id = ? AND is_event_access = ?", eventID, true).Find(&products).Error; err != nil {
+		return nil, err
+	}
+	return products, nil
+}
+
+// GetUnpaidRegistrants returns the users registered to the event that own none of the given ticket products
+func (r *EventRepo) GetUnpaidRegistrants(eventID string, ticketProductIDs []string) ([]models.UnpaidRegistrant, error) {
+	query := r.DB.Table("event_registrations").
+		Select("users.id AS user_id, users.name, users.last_name, users.email, event_registrations.registered_at").
+		Joins("JOIN users ON users.id = event_registrations.user_id AND users.deleted_at IS NULL").
+		Where("event_registrations.event_id = ? AND event_registrations.deleted_at IS NULL", eventID)
+
+	if len(ticketProductIDs) > 0 {
+		owners := r.DB.Model(&models.UserProduct{}).
+			Select("user_id").
+			Where("product_id IN ? AND quantity > 0", ticketProductIDs)
+		query = query.Where("event_registrations.user_id NOT IN (?)", owners)
+	}
+
+	var registrants []models.UnpaidRegistrant
+	if err := query.Order("event_registrations.registered_at ASC").Scan(&registrants).Error; err != nil {
+		return nil, err
+	}
+	return registrants, nil
+}
+
+// GetEventTicketHolders returns the users registered to the event that own one of the ticket products
+func (r *EventRepo) GetEventTicketHolders(eventID string, ticketProductIDs []string) ([]models.User, error) {
+	owners := r.DB.Model(&models.UserProduct{}).
+		Select("user_id").
+		Where("product_id IN ? AND quantity > 0", ticketProductIDs)
+
+	var users []models.User
+	err := r.DB.
+		Joins("JOIN event_registrations ON event_registrations.user_id = users.id AND event_registrations.deleted_at IS NULL").
+		Where("event_registrations.event_id = ? AND users.id IN (?)", eventID, owners).
+		Order("users.name ASC, users.last_name ASC").
+		Find(&users).Error
+	if err != nil {
+		return nil, err
+	}
+	return users, nil
+}
+
+func (r *EventRepo) GetRegistrationIntervals(eventID string) ([]models.RegistrationInterval, error) {
+	var intervals []models.RegistrationInterval
+	err := r.DB.Table("activity_registrations").
+		Select("activity_registrations.user_id, activities.start_time, activities.end_time").
+		Joins("JOIN activities ON activities.id = activity_registrations.activity_id AND activities.deleted_at IS NULL").
+		Where("activities.event_id = ? AND activity_registrations.deleted_at IS NULL", eventID).
+		Scan(&intervals).Error
+	if err != nil {
+		return nil, err
+	}
+	return intervals, nil
+}
+
+// GetEventFunnel counts the event registrants, the ones owning a ticket and the ones that attended an activity
+func (r *EventRepo) GetEventFunnel(eventID string) (*models.EventFunnel, error) {
+	var funnel models.EventFunnel
+	err := r.DB.Table("event_registrations").
+		Select(`COUNT(*) AS registered,
+			COUNT(*) FILTER (WHERE EXISTS (
+				SELECT 1 FROM user_products JOIN products ON products.id = user_products.product_id
+				WHERE user_products.user_id = event_registrations.user_id AND user_products.quantity > 0 AND user_products.deleted_at IS NULL
+					AND products.event_id = event_registrations.event_id AND products.is_event_access = TRUE
+			)) AS paid,
+			COUNT(*) FILTER (WHERE EXISTS (
+				SELECT 1 FROM activity_registrations JOIN activities ON activities.id = activity_registrations.activity_id
+				WHERE activity_registrations.user_id = event_registrations.user_id AND activity_registrations.attended_at IS NOT NULL
+					AND activity_registrations.deleted_at IS NULL AND activities.event_id = event_registrations.event_id
+			)) AS attended`).
+		Where("event_registrations.event_id = ? AND event_registrations.deleted_at IS NULL", eventID).
+		Scan(&funnel).Error
+	if err != nil {
+		return nil, err
+	}
+	return &funnel, nil
+}
+
+func (r *EventRepo) GetEventRegistration(eventID, userID string) (*models.EventRegistration, error) {
+	var registration models.EventRegistration
+	if err := r.DB.Where("event_id = ? AND user_id = ?", eventID, userID).First(&registration).Error; err != nil {
+		return nil, err
+	}
+	return &registration, nil
+}
+
+func (r *EventRepo) GetRegistrationDetails(eventID, userID string) (*models.EventRegistrationDetails, error) {
+	var details models.EventRegistrationDetails
+	if err := r.DB.Where("event_id = ? AND user_id = ?", eventID, userID).First(&details).Error; err != nil {
+		return nil, err
+	}
+	return &details, nil
+}
+
+func (r *EventRepo) SaveRegistrationDetails(details *models.EventRegistrationDetails) error {
+	return r.DB.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "event_id"}, {Name: "user_id"}},
+		DoUpdates: clause.AssignmentColumns([]string{"dietary_restrictions", "accessibility_needs", "updated_at"}),
+	}).Create(details).Error
+}
+
+// GetRegistrantsNotes returns the non empty registration details of the users still registered to the event
+func (r *EventRepo) GetRegistrantsNotes(eventID string) ([]models.RegistrantNotes, error) {
+	var notes []models.RegistrantNotes
+	err := r.DB.Table("event_registration_details").
+		Select(`users.id AS user_id, users.name, users.last_name, users.email,
+			event_registration_details.dietary_restrictions, event_registration_details.accessibility_needs`).
+		Joins("JOIN event_registrations ON event_registrations.event_id = event_registration_details.event_id AND event_registrations.user_id = event_registration_details.user_id AND event_registrations.deleted_at IS NULL").
+		Joins("JOIN users ON users.id = event_registration_details.user_id").
+		Where("event_registration_details.event_id = ?", eventID).
+		Where("event_registration_details.dietary_restrictions <> '' OR event_registration_details.accessibility_needs <> ''").
+		Order("users.name ASC, users.last_name ASC").
+		Scan(&notes).Error
+	if err != nil {
+		return nil, err
+	}
+	return notes, nil
+}
+
+func (r *EventRepo) CountEventRegistrations(eventID string) (int64, error) {
+	var count int64
+	if err := r.DB.Model(&models.EventRegistration{}).Where("event_id = ?", eventID).Count(&count).Error; err != nil {
+		return 0, err
+	}
+	return count, nil
+}
+
+// GetActivitiesAttendanceCounts counts the confirmed registrations, attendances and marked no-shows
+// of the event activities that ended before the given time
+func (r *EventRepo) GetActivitiesAttendanceCounts(eventID string, endedBefore time.Time) ([]models.ActivityNoShowRate, error) {
+	counts := r.DB.Model(&models.ActivityRegistration{}).
+		Select("activity_id, COUNT(*) AS registered, COUNT(attended_at) AS attended, COUNT(*) FILTER (WHERE no_show) AS no_shows").
+		Where("confirm_by IS NULL").
+		Group("activity_id")
+
+	var rates []models.ActivityNoShowRate
+	err := r.DB.Table("activities").
+		Select(`activities.id AS activity_id, activities.name, activities.start_time, activities.end_time,
+			activities.attendance_finalized_at IS NOT NULL AS finalized, counts.registered, counts.attended, counts.no_shows`).
+		Joins("JOIN (?) AS counts ON counts.activity_id = activities.id", counts).
+		Where("activities.event_id = ? AND activities.end_time < ? AND activities.deleted_at IS NULL", eventID, endedBefore).
+		Scan(&rates).Error
+	if err != nil {
+		return nil, err
+	}
+
+	return rates, nil
+}
+
+// SetRegistrationEmailOutcome records whether the confirmation email of the registration was sent
+func (r *EventRepo) SetRegistrationEmailOutcome(eventID, userID string, sendErr error) error {
+	updates := map[string]interface{}{"email_sent_at": nil, "email_error": nil}
+	if sendErr != nil {
+		updates["email_error"] = sendErr.Error()
+	} else {
+		updates["email_sent_at"] = time.Now()
+	}
+	return r.DB.Model(&models.EventRegistration{}).
+		Where("event_id = ? AND user_id = ?", eventID, userID).
+		Updates(updates).Error
+}
+
+func (r *EventRepo) GetUserActivityParticipations(userID, eventID string) ([]models.ActivityParticipation, error) {
+	var participations []models.ActivityParticipation
+	err := r.DB.Table("activity_registrations").
+		Select(`activities.id AS activity_id, activities.name, activities.type, activities.start_time, activities.end_time,
+			activity_registrations.attended_at, activity_registrations.confirm_by`).
+		Joins("JOIN activities ON activities.id = activity_registrations.activity_id AND activities.deleted_at IS NULL").
+		Where("activity_registrations.user_id = ? AND activities.event_id = ? AND activity_registrations.deleted_at IS NULL", userID, eventID).
+		Order("activities.start_time ASC, activities.display_order ASC").
+		Scan(&participations).Error
+	if err != nil {
+		return nil, err
+	}
+	return participations, nil
+}
+
+func (r *EventRepo) GetUserTokensFromEvent(userID, eventID string) ([]models.UserToken, error) {
+	var tokens []models.UserToken
+	if err := r.DB.Where("user_id = ? AND event_id = ?", userID, eventID).Find(&tokens).Error; err != nil {
+		return nil, err
+	}
+	return tokens, nil
+}
+
+func (r *EventRepo) GetUserOwnedEventProducts(userID, eventID string) ([]models.OwnedEventProduct, error) {
+	var products []models.OwnedEventProduct
+	err := r.DB.Table("user_products").
+		Select("products.id AS product_id, products.name, products.is_ticket_type, SUM(user_products.quantity) AS quantity").
+		Joins("JOIN products ON products.id = user_products.product_id AND products.deleted_at IS NULL").
+		Where("user_products.user_id = ? AND products.event_id = ? AND user_products.deleted_at IS NULL", userID, eventID).
+		Group("products.id, products.name, products.is_ticket_type").
+		Having("SUM(user_products.quantity) > 0").
+		Order("products.name ASC").
+		Scan(&products).Error
+	if err != nil {
+		return nil, err
+	}
+	return products, nil
+}
+
+func (r *EventRepo) GetUserEventCertificate(userID, eventID string) (*models.Certificate, error) {
+	var certificate models.Certificate
+	if err := r.DB.Where("user_id = ? AND event_id = ?", userID, eventID).First(&certificate).Error; err != nil {
+		return nil, err
+	}
+	return &certificate, nil
+}
+
+func (r *EventRepo) GetCertificateByCode(code string) (*models.Certificate, error) {
+	var certificate models.Certificate
+	if err := r.DB.Where("code = ?", code).First(&certificate).Error; err != nil {
+		return nil, err
+	}
+	return &certificate, nil
+}
+
+func (r *EventRepo) CreateCertificate(certificate *models.Certificate) error {
+	return r.DB.Create(certificate).Error
+}
+
+// GetAdminEventSummaries lists every event, including hidden and deleted ones, with their
+// registration count and revenue. An empty status lists all of them
+func (r *EventRepo) GetAdminEventSummaries(status models.AdminEventStatus, offset, limit int) ([]models.AdminEventSummary, int64, error) {
+	registrations := r.DB.Model(&models.EventRegistration{}).
+		Select("event_id, COUNT(*) AS total").
+		Group("event_id")
+	revenue := r.DB.Table("purchases").
+		Select("products.event_id, SUM(purchases.quantity * purchases.unit_price_int) AS total").
+		Joins("JOIN products ON products.id = purchases.product_id").
+		Where("purchases.deleted_at IS NULL AND purchases.refunded_at IS NULL").
+		Group("products.event_id")
+
+	query := r.DB.Unscoped().Table("events")
+	switch status {
+	case models.AdminEventActive:
+		query = query.Where("events.deleted_at IS NULL AND events.is_hidden = ? AND events.is_blocked = ?", false, false)
+	case models.AdminEventHidden:
+		query = query.Where("events.deleted_at IS NULL AND events.is_hidden = ?", true)
+	case models.AdminEventBlocked:
+		query = query.Where("events.deleted_at IS NULL AND events.is_blocked = ?", true)
+	case models.AdminEventDeleted:
+		query = query.Where("events.deleted_at IS NOT NULL")
+	}
+
+	var total int64
+	if err := query.Session(&gorm.Session{}).Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	var summaries []models.AdminEventSummary
+	err := query.
+		Select(`events.id, events.slug, events.name, events.start_date, events.end_date, events.is_hidden, events.is_blocked,
+			events.deleted_at, events.created_by, TRIM(CONCAT(users.name, ' ', users.last_name)) AS creator_name, users.email AS creator_email,
+			COALESCE(registrations.total, 0) AS registration_count, COALESCE(revenue.total, 0) AS revenue_int`).
+		Joins("LEFT JOIN users ON users.id = events.created_by").
+		Joins("LEFT JOIN (?) AS registrations ON registrations.event_id = events.id", registrations).
+		Joins("LEFT JOIN (?) AS revenue ON revenue.event_id = events.id", revenue).
+		Order("events.start_date DESC").
+		Offset(offset).
+		Limit(limit).
+		Scan(&summaries).Error
+	if err != nil {
+		return nil, 0, err
+	}
+
+	return summaries, total, nil
+}
+
+// GetUserAccessEventIDs returns the events the user holds access to, be it through an owned product
+// of the event, a token of the event or a product whose access targets the event
+func (r *EventRepo) GetUserAccessEventIDs(userID string) ([]string, error) {
+	var productEvents, tokenEvents, targetEvents []string
+
+	err := r.DB.Table("user_products").
+		Joins("JOIN products ON products.id = user_products.product_id").
+		Where("user_products.user_id = ? AND user_products.quantity > 0 AND user_products.deleted_at IS NULL", userID).
+		Distinct().Pluck("products.event_id", &productEvents).Error
+	if err != nil {
+		return nil, err
+	}
+
+	err = r.DB.Model(&models.UserToken{}).
+		Where("user_id = ?", userID).
+		Distinct().Pluck("event_id", &tokenEvents).Error
+	if err != nil {
+		return nil, err
+	}
+
+	err = r.DB.Table("access_targets").
+		Joins("JOIN user_products ON user_products.product_id = access_targets.product_id").
+		Where("user_products.user_id = ? AND user_products.quantity > 0 AND user_products.deleted_at IS NULL", userID).
+		Where("access_targets.is_event = ? AND access_targets.deleted_at IS NULL", true).
+		Distinct().Pluck("access_targets.target_id", &targetEvents).Error
+	if err != nil {
+		return nil, err
+	}
+
+	seen := make(map[string]bool)
+	var eventIDs []string
+	for _, ids := range [][]string{productEvents, tokenEvents, targetEvents} {
+		for _, id := range ids {
+			if !seen[id] {
+				seen[id] = true
+				eventIDs = append(eventIDs, id)
+			}
+		}
+	}
+
+	return eventIDs, nil
+}
+
+func (r *EventRepo) GetEventsByIDs(ids []string) ([]models.Event, error) {
+	var events []models.Event
+	if err := r.DB.Where("id IN ?", ids).Order("start_date ASC").Find(&events).Error; err != nil {
+		return nil, err
+	}
+	return events, nil
+}
+
+// GetVenueEventsOverlapping returns the events at the venue, ignoring case, that overlap the period.
+// Events ending exactly when the period starts don't overlap
+func (r *EventRepo) GetVenueEventsOverlapping(venue string, from, to time.Time, excludeEventID string) ([]models.VenueConflict, error) {
+	var conflicts []models.VenueConflict
+	err := r.DB.Model(&models.Event{}).
+		Select("id AS event_id, slug, name, venue, start_date, end_date").
+		Where("LOWER(TRIM(venue)) = LOWER(TRIM(?)) AND start_date < ? AND end_date > ? AND id <> ?", venue, to, from, excludeEventID).
+		Order("start_date ASC").
+		Scan(&conflicts).Error
+	return conflicts, err
+}
+
+func (r *EventRepo) CreateAnnouncement(announcement *models.EventAnnouncement) error {
+	return r.DB.Create(announcement).Error
+}
+
+// GetAnnouncements returns a page of the event announcements, pinned ones first and then the newest
+func (r *EventRepo) GetAnnouncements(eventID string, offset, limit int) ([]models.EventAnnouncement, int64, error) {
+	var total int64
+	if err := r.DB.Model(&models.EventAnnouncement{}).Where("event_id = ?", eventID).Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	var announcements []models.EventAnnouncement
+	err := r.DB.Where("event_id = ?", eventID).
+		Order("pinned DESC, created_at DESC").
+		Offset(offset).
+		Limit(limit).
+		Find(&announcements).Error
+	if err != nil {
+		return nil, 0, err
+	}
+
+	return announcements, total, nil
+}
+
+func (r *EventRepo) DeleteAnnouncement(eventID, announcementID string) error {
+	result := r.DB.Where("id = ? AND event_id = ?", announcementID, eventID).Delete(&models.EventAnnouncement{})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return errors.New("announcement not found")
+	}
+	return nil
+}
@@ -16,6 +16,7 @@ import (
 	"github.com/mercadopago/sdk-go/pkg/order"
 	"github.com/mercadopago/sdk-go/pkg/refund"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 type ProductRepo struct {
@@ -30,6 +31,13 @@ func (r *ProductRepo) CreateProduct(product *models.Product) error {
 	return r.DB.Create(product).Error
 }
 
+// IsProductBundle reports whether the product bundles other products
+func (r *ProductRepo) IsProductBundle(productID string) (bool, error) {
+	var count int64
+	err := r.DB.Model(&models.ProductBundle{}).Where("parent_product_id = ?", productID).Count(&count).Error
+	return count > 0, err
+}
+
 func (r *ProductRepo) GetProductByID(id string) (*models.Product, error) {
 	var product models.Product
 	if err := r.DB.Preload("AccessTargets").Where("id = ?", id).First(&product).Error; err != nil {
@@ -66,10 +74,38 @@ func (r *ProductRepo) DeleteProduct(id string) error {
 	return r.DB.Where("id = ?", id).Delete(&models.Product{}).Error
 }
 
+// GetProductDeleteImpact counts the purchases, owners and tokens that reference the product
+func (r *ProductRepo) GetProductDeleteImpact(productID string) (*models.ProductDeleteImpact, error) {
+	impact := models.ProductDeleteImpact{ProductID: productID}
+
+	if err := r.DB.Model(&models.Purchase{}).Where("product_id = ?", productID).Count(&impact.Purchases).Error; err != nil {
+		return nil, err
+	}
+
+	if err := r.DB.Model(&models.UserProduct{}).Where("product_id = ?", productID).
+		Distinct("user_id").Count(&impact.AffectedUsers).Error; err != nil {
+		return nil, err
+	}
+
+	if err := r.DB.Model(&models.UserToken{}).Where("product_id = ?", productID).Count(&impact.TokensIssued).Error; err != nil {
+		return nil, err
+	}
+
+	return &impact, nil
+}
+
 func (r *ProductRepo) CreatePurchase(purchase *models.Purchase) error {
 	return r.DB.Create(purchase).Error
 }
 
+func (r *ProductRepo) GetPurchaseByID(purchaseID string) (*models.Purchase, error) {
+	var purchase models.Purchase
+	if err := r.DB.Where("id = ?", purchaseID).First(&purchase).Error; err != nil {
+		return nil, err
+	}
+	return &purchase, nil
+}
+
 func (r *ProductRepo) GetUserPurchases(userID string) ([]models.Purchase, error) {
 	var purchases []models.Purchase
 	if err := r.DB.Where("user_id = ?", userID).Find(&purchases).Error; err != nil {
@@ -152,6 +188,76 @@ func (r *ProductRepo) IsUserRegisteredToEvent(userID string, eventID string) (bo
 	return count > 0, nil
 }
 
+func (r *ProductRepo) GetUserGiftedProducts(userID string) ([]models.UserProduct, error) {
+	var userProducts []models.UserProduct
+	if err := r.DB.Where("user_id = ? AND received_as_gift = ? AND quantity > 0", userID, true).
+		Order("created_at ASC").
+		Find(&userProducts).Error; err != nil {
+		return nil, err
+	}
+	return userProducts, nil
+}
+
+func (r *ProductRepo) GetUserRegisteredEventIDs(userID string) ([]string, error) {
+	var eventIDs []string
+	err := r.DB.Model(&models.EventRegistration{}).Where("user_id = ?", userID).Pluck("event_id", &eventIDs).Error
+	return eventIDs, err
+}
+
+func (r *ProductRepo) GetUserRegisteredActivityIDs(userID string) ([]string, error) {
+	var activityIDs []string
+	err := r.DB.Model(&models.ActivityRegistration{}).Where("user_id = ?", userID).Pluck("activity_id", &activityIDs).Error
+	return activityIDs, err
+}
+
+func (r *ProductRepo) GetEventsByIDs(ids []string) ([]models.Event, error) {
+	var events []models.Event
+	if err := r.DB.Where("id IN ?", ids).Find(&events).Error; err != nil {
+		return nil, err
+	}
+	return events, nil
+}
+
+func (r *ProductRepo) GetActivitiesByIDs(ids []string) ([]models.Activity, error) {
+	var activities []models.Activity
+	if err := r.DB.Where("id IN ?", ids).Find(&activities).Error; err != nil {
+		return nil, err
+	}
+	return activities, nil
+}
+
+// GetEventTokens pages through the tokens issued for the event, oldest first. A nil used lists all of them
+func (r *ProductRepo) GetEventTokens(eventID string, used *bool, offset, limit int) ([]models.EventToken, int64, error) {
+	query := r.DB.Table("user_tokens").
+		Where("user_tokens.event_id = ? AND user_tokens.deleted_at IS NULL", eventID)
+	if used != nil {
+		query = query.Where("user_tokens.is_used = ?", *used)
+	}
+
+	var total int64
+	if err := query.Session(&gorm.Session{}).Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	var tokens []models.EventToken
+	err := query.
+		Select(`user_tokens.id, user_tokens.user_id, TRIM(CONCAT(users.name, ' ', users.last_name)) AS user_name, users.email AS user_email,
+			user_tokens.product_id, products.name AS product_name, user_tokens.is_used, user_tokens.used_at, user_tokens.used_for_id,
+			COALESCE(activities.name, '') AS used_for_name, user_tokens.created_at`).
+		Joins("LEFT JOIN users ON users.id = user_tokens.user_id").
+		Joins("LEFT JOIN products ON products.id = user_tokens.product_id").
+		Joins("LEFT JOIN activities ON activities.id = user_tokens.used_for_id").
+		Order("user_tokens.created_at ASC, user_tokens.id").
+		Offset(offset).
+		Limit(limit).
+		Scan(&tokens).Error
+	if err != nil {
+		return nil, 0, err
+	}
+
+	return tokens, total, nil
+}
+
 func (r *ProductRepo) CreateUserProduct(userProduct *models.UserProduct) error {
 	return r.DB.Create(userProduct).Error
 }
@@ -160,6 +266,66 @@ func (r *ProductRepo) CreateUserToken(userToken *models.UserToken) error {
 	return r.DB.Create(userToken).Error
 }
 
+func (r *ProductRepo) GetUserProductByID(userProductID string) (*models.UserProduct, error) {
+	var userProduct models.UserProduct
+	if err := r.DB.Where("id = ?", userProductID).First(&userProduct).Error; err != nil {
+		return nil, err
+	}
+	return &userProduct, nil
+}
+
+// TransferUserProducts moves the owned products to another user as a gift from the sender, along with their
+// unused tokens. The sender loses the activity registrations the products granted, unless another copy of
+// the product still grants them, and the recipient is registered in their place
+func (r *ProductRepo) TransferUserProducts(userProducts []models.UserProduct, fromID, toID string) error {
+	return r.DB.Transaction(func(tx *gorm.DB) error {
+		for _, userProduct := range userProducts {
+			// Moved only while the sender still owns it, so concurrent transfers can't both go through
+			result := tx.Model(&models.UserProduct{}).
+				Where("id = ? AND user_id = ?", userProduct.ID, fromID).
+				Updates(map[string]interface{}{
+					"user_id":          toID,
+					"received_as_gift": true,
+					"gifted_from_id":   fromID,
+				})
+			if result.Error != nil {
+				return result.Error
+			}
+			if result.RowsAffected == 0 {
+				return errors.New("product was already transferred")
+			}
+
+			if err := tx.Model(&models.UserToken{}).
+				Where("user_product_id = ? AND is_used = ?", userProduct.ID, false).
+				Update("user_id", toID).Error; err != nil {
+				return err
+			}
+
+			var copies int64
+			if err := tx.Model(&models.UserProduct{}).
+				Where("user_id = ? AND product_id = ?", fromID, userProduct.ProductID).
+				Count(&copies).Error; err != nil {
+				return err
+			}
+			if copies == 0 {
+				if err := tx.Where("user_id = ? AND product_id = ? AND access_method = ? AND attended_at IS NULL", fromID, userProduct.ProductID, models.AccessMethodProduct).
+					Delete(&models.ActivityRegistration{}).Error; err != nil {
+					return err
+				}
+			}
+
+			var product models.Product
+			if err := tx.Preload("AccessTargets").Where("id = ?", userProduct.ProductID).First(&product).Error; err != nil {
+				return err
+			}
+			if err := r.registerProductOwner(tx, &product, toID); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
 func (r *ProductRepo) GetUserProductByUserIDAndProductID(userID string, productID string) ([]models.UserProduct, error) {
 	var userProducts []models.UserProduct
 	if err := r.DB.Where("user_id = ? AND product_id = ?", userID, productID).Find(&userProducts).Error; err != nil {
@@ -223,7 +389,7 @@ func (r *ProductRepo) GetUserTokens(userID string) ([]models.UserToken, error) {
 	return userTokens, nil
 }
 
-func (r *ProductRepo) PurchaseProduct(user models.User, event *models.Event, product *models.Product, req models.PurchaseRequest, w http.ResponseWriter) (*models.PurchaseResponse, error) {
+func (r *ProductRepo) PurchaseProduct(user models.User, event *models.Event, product *models.Product, req models.PurchaseRequest, price *models.PriceBreakdown, w http.ResponseWriter) (*models.PurchaseResponse, error) {
 	tx := r.DB.Begin()
 	if tx.Error != nil {
 		return nil, errors.New("failed to begin transaction: " + tx.Error.Error())
@@ -234,20 +400,134 @@ func (r *ProductRepo) PurchaseProduct(user models.User, event *models.Event, pro
 		}
 	}()
 
-	// Query for existing user product
+	totalInt := price.TotalInt
+	paymentMethod := req.PaymentMethodID
+	if totalInt == 0 {
+		paymentMethod = "free"
+	}
+
+	response, err := r.grantPurchase(tx, user, event, product, req, paymentMethod, price.PaidUnitPriceInt())
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	if price.CouponID != "" {
+		if err := redeemCoupon(tx, price.CouponID); err != nil {
+			tx.Rollback()
+			return nil, err
+		}
+	}
+
+	// Free products skip Mercado Pago entirely, there is nothing to charge
+	if totalInt == 0 {
+		if err := tx.Commit().Error; err != nil {
+			return nil, errors.New("failed to commit transaction: " + err.Error())
+		}
+		return response, nil
+	}
+
+	resource, err := createMercadoPagoOrder(user, event, req, totalInt)
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	if err := r.commitPaidPurchases(tx, user, resource, []*models.Purchase{&response.Purchase}); err != nil {
+		return nil, err
+	}
+
+	response.PurchaseResource = resource
+	return response, nil
+}
+
+// PurchaseCart buys every item of the cart in one transaction, paid with a single Mercado Pago order for
+// the total. Each item gets its own purchase sharing the order ID as payment ID, prices holds the price of
+// the item at the same index. A coupon counts a single use for the whole cart
+func (r *ProductRepo) PurchaseCart(user models.User, event *models.Event, products []*models.Product, req models.PurchaseCartRequest, prices []*models.PriceBreakdown) (*models.PurchaseCartResponse, error) {
+	tx := r.DB.Begin()
+	if tx.Error != nil {
+		return nil, errors.New("failed to begin transaction: " + tx.Error.Error())
+	}
+	defer func() {
+		if r := recover(); r != nil {
+			tx.Rollback()
+		}
+	}()
+
+	totalInt, couponID := 0, ""
+	for _, price := range prices {
+		totalInt += price.TotalInt
+		if price.CouponID != "" {
+			couponID = price.CouponID
+		}
+	}
+
+	paymentMethod := req.PaymentMethodID
+	if totalInt == 0 {
+		paymentMethod = "free"
+	}
+
+	cart := &models.PurchaseCartResponse{TotalInt: totalInt}
+	for i, product := range products {
+		response, err := r.grantPurchase(tx, user, event, product, req.ItemRequest(i), paymentMethod, prices[i].PaidUnitPriceInt())
+		if err != nil {
+			tx.Rollback()
+			return nil, err
+		}
+		cart.Purchases = append(cart.Purchases, *response)
+	}
+
+	if couponID != "" {
+		if err := redeemCoupon(tx, couponID); err != nil {
+			tx.Rollback()
+			return nil, err
+		}
+	}
+
+	if totalInt == 0 {
+		if err := tx.Commit().Error; err != nil {
+			return nil, errors.New("failed to commit transaction: " + err.Error())
+		}
+		return cart, nil
+	}
+
+	purchases := make([]*models.Purchase, len(cart.Purchases))
+	for i := range cart.Purchases {
+		purchases[i] = &cart.Purchases[i].Purchase
+	}
+
+	resource, err := createMercadoPagoOrder(user, event, req.ItemRequest(0), totalInt)
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	if err := r.commitPaidPurchases(tx, user, resource, purchases); err != nil {
+		return nil, err
+	}
+
+	cart.PurchaseResource = resource
+	return cart, nil
+}
+
+// grantPurchase records the purchase of a product inside tx and gives its owner what it grants: the user
+// product, its tokens, the activity registrations and the bundled products. The stock is taken right away
+func (r *ProductRepo) grantPurchase(tx *gorm.DB, user models.User, event *models.Event, product *models.Product, req models.PurchaseRequest, paymentMethod string, unitPriceInt int) (*models.PurchaseResponse, error) {
 	purchaseID := uuid.New().String()
 	purchase := &models.Purchase{
 		ID:            purchaseID,
 		UserID:        user.ID,
 		ProductID:     product.ID,
 		Quantity:      req.Quantity,
+		UnitPriceInt:  unitPriceInt,
 		IsGift:        req.IsGift,
 		GiftedToEmail: req.GiftedToEmail,
+		PaymentMethod: paymentMethod,
 	}
 
 	err := tx.Create(purchase).Error
 	if err != nil {
-		tx.Rollback()
 		return nil, errors.New("failed to create purchase: " + err.Error())
 	}
 
@@ -255,7 +535,6 @@ func (r *ProductRepo) PurchaseProduct(user models.User, event *models.Event, pro
 		product.Quantity -= req.Quantity
 		err = tx.Save(product).Error
 		if err != nil {
-			tx.Rollback()
 			return nil, errors.New("failed to update product quantity: " + err.Error())
 		}
 	}
@@ -269,12 +548,10 @@ func (r *ProductRepo) PurchaseProduct(user models.User, event *models.Event, pro
 
 	if req.IsGift {
 		if req.GiftedToEmail == nil {
-			tx.Rollback()
 			return nil, errors.New("can't gift to nil email")
 		}
 		giftedUser, err := r.GetUserByEmail(*req.GiftedToEmail)
 		if err != nil {
-			tx.Rollback()
 			return nil, errors.New("failed to retrieve user for gifting")
 		}
 		userProduct.ReceivedAsGift = true
@@ -288,7 +565,6 @@ func (r *ProductRepo) PurchaseProduct(user models.User, event *models.Event, pro
 
 	err = tx.Create(userProduct).Error
 	if err != nil {
-		tx.Rollback()
 		return nil, errors.New("failed to create user product: " + err.Error())
 	}
 
@@ -308,41 +584,32 @@ func (r *ProductRepo) PurchaseProduct(user models.User, event *models.Event, pro
 
 			err = tx.Create(token).Error
 			if err != nil {
-				tx.Rollback()
 				return nil, errors.New("failed to create user token: " + err.Error())
 			}
 			userTokens[i] = *token
 		}
 	}
 
-	for _, access := range product.AccessTargets {
-		registration := &models.ActivityRegistration{
-			ActivityID:   access.TargetID,
-			ProductID:    &product.ID,
-			AccessMethod: string(models.AccessMethodProduct),
-			UserID:       userProduct.UserID,
-		}
-		var count int64
-		err = tx.Model(&models.ActivityRegistration{}).
-			Where("activity_id = ? AND user_id = ?", registration.ActivityID, registration.UserID).
-			Count(&count).Error
-
-		if err != nil && err != gorm.ErrRecordNotFound {
-			tx.Rollback()
-			return nil, errors.New("failed to get activity registration: " + err.Error())
-		}
-
-		if count > 0 {
-			continue
-		}
+	err = r.registerProductOwner(tx, product, userProduct.UserID)
+	if err != nil {
+		return nil, err
+	}
 
-		err = tx.Create(registration).Error
-		if err != nil {
-			tx.Rollback()
-			return nil, errors.New("failed to create activity registration: " + err.Error())
-		}
+	bundledTokens, err := r.grantBundledProducts(tx, userProduct, event.ID)
+	if err != nil {
+		return nil, err
 	}
+	userTokens = append(userTokens, bundledTokens...)
+
+	return &models.PurchaseResponse{
+		Purchase:    *purchase,
+		UserProduct: *userProduct,
+		UserTokens:  userTokens,
+	}, nil
+}
 
+// createMercadoPagoOrder charges the total with the payment method of the request
+func createMercadoPagoOrder(user models.User, event *models.Event, req models.PurchaseRequest, totalInt int) (*order.Response, error) {
 	// ----------------------------------------------------- //
 	// ----------------COMEÇO DO PAGAMENTO ----------------- //
 	// ----------------------------------------------------- //
@@ -352,12 +619,12 @@ func (r *ProductRepo) PurchaseProduct(user models.User, event *models.Event, pro
 	client := order.NewClient(mercadoPagoConfig)
 	request := order.Request{
 		Type:              "online",
-		TotalAmount:       fmt.Sprintf("%.2f", (float64(product.PriceInt)*float64(req.Quantity))/100),
+		TotalAmount:       fmt.Sprintf("%.2f", float64(totalInt)/100),
 		ExternalReference: fmt.Sprintf("%s_%s", event.Slug, user.ID),
 		Transactions: &order.TransactionRequest{
 			Payments: []order.PaymentRequest{
 				{
-					Amount: fmt.Sprintf("%.2f", (float64(product.PriceInt)*float64(req.Quantity))/100),
+					Amount: fmt.Sprintf("%.2f", float64(totalInt)/100),
 					PaymentMethod: &order.PaymentMethodRequest{
 						ID:           req.PaymentMethodID,
 						Token:        req.PaymentMethodToken,
@@ -380,7 +647,6 @@ func (r *ProductRepo) PurchaseProduct(user models.User, event *models.Event, pro
 
 	resource, err := client.Create(context.Background(), request)
 	if err != nil {
-		tx.Rollback()
 		log.Printf("Mercado Pago API error: %v", err)
 		return nil, errors.New("failed to create mercado pago order: " + err.Error())
 	}
@@ -389,8 +655,26 @@ func (r *ProductRepo) PurchaseProduct(user models.User, event *models.Event, pro
 	// ---------------- FIM DO PAGAMENTO ---------------- //
 	// -------------------------------------------------- //
 
+	return resource, nil
+}
+
+// commitPaidPurchases stores the order ID in the purchases and commits tx. The customer was already
+// charged at this point, so a failed commit refunds the whole order
+func (r *ProductRepo) commitPaidPurchases(tx *gorm.DB, user models.User, resource *order.Response, purchases []*models.Purchase) error {
 	// CRITICAL SECTION: Commit with refund fallback
-	if err := tx.Commit().Error; err != nil {
+	purchaseIDs := make([]string, len(purchases))
+	for i, purchase := range purchases {
+		purchase.PaymentID = &resource.ID
+		purchaseIDs[i] = purchase.ID
+	}
+	err := tx.Model(&models.Purchase{}).Where("id IN ?", purchaseIDs).Update("payment_id", resource.ID).Error
+	if err == nil {
+		err = tx.Commit().Error
+	} else {
+		tx.Rollback()
+	}
+
+	if err != nil {
 		// Payment succeeded but database commit failed - MUST refund
 		log.Printf("CRITICAL: Database commit failed after successful payment %s. Attempting refund...", resource.ID)
 
@@ -401,18 +685,13 @@ func (r *ProductRepo) PurchaseProduct(user models.User, event *models.Event, pro
 				resource.ID, err, refundErr)
 
 			// Store for manual processing
-			r.storeFailedTransaction(resource, user, purchase, err.Error(), refundErr.Error())
+			r.storeFailedTransaction(resource, user, purchases, err.Error(), refundErr.Error())
 		}
 
-		return nil, errors.New("failed to commit transaction: " + err.Error())
+		return errors.New("failed to commit transaction: " + err.Error())
 	}
 
-	return &models.PurchaseResponse{
-		Purchase:         *purchase,
-		UserProduct:      *userProduct,
-		UserTokens:       userTokens,
-		PurchaseResource: resource,
-	}, nil
+	return nil
 }
 
 // Helper to attempt refund
@@ -446,13 +725,18 @@ func (r *ProductRepo) attemptRefund(resource *order.Response) error {
 }
 
 // Store failed transactions for manual processing, still need to implement on DB
-func (r *ProductRepo) storeFailedTransaction(resource *order.Response, user models.User, purchase *models.Purchase, dbError, refundError string) {
+func (r *ProductRepo) storeFailedTransaction(resource *order.Response, user models.User, purchases []*models.Purchase, dbError, refundError string) {
+	purchaseData := make([]models.Purchase, len(purchases))
+	for i, purchase := range purchases {
+		purchaseData[i] = *purchase
+	}
+
 	// Create a record in a separate table/system for manual intervention
 	failedTx := map[string]interface{}{
 		"payment_id":    resource.ID,
 		"user_id":       user.ID,
 		"amount":        resource.TotalAmount,
-		"purchase_data": purchase,
+		"purchase_data": purchaseData,
 		"db_error":      dbError,
 		"refund_error":  refundError,
 		"created_at":    time.Now(),
@@ -465,12 +749,19 @@ func (r *ProductRepo) storeFailedTransaction(resource *order.Response, user mode
 	// Send alerts to administrators
 }
 
-func (r *ProductRepo) CreatePixPurchase(user models.User, product *models.Product, purchaseID int, req models.PurchaseRequest) error {
+// ErrPixPurchaseFinalized is returned when the pending pix purchase was already turned into a purchase
+var ErrPixPurchaseFinalized = errors.New("pix purchase already finalized")
+
+func (r *ProductRepo) CreatePixPurchase(user models.User, product *models.Product, purchaseID int, req models.PurchaseRequest, price *models.PriceBreakdown) error {
 	var pp models.PixPurchase
 	pp.UserID = user.ID
 	pp.ProductID = product.ID
 	pp.PurchaseID = purchaseID
 	pp.Quantity = req.Quantity
+	pp.UnitPriceInt = price.PaidUnitPriceInt()
+	if price.CouponID != "" {
+		pp.CouponID = &price.CouponID
+	}
 	pp.IsGift = req.IsGift
 	pp.GiftedToEmail = req.GiftedToEmail
 	return r.DB.Create(&pp).Error
@@ -488,6 +779,65 @@ func (r *ProductRepo) DeletePixPurchase(purchaseID int) error {
 	return r.DB.Where("purchase_id = ?", purchaseID).Delete(&models.PixPurchase{}).Error
 }
 
+// GetStalePixPurchases lists the pending pix purchases created before the given time
+func (r *ProductRepo) GetStalePixPurchases(before time.Time) ([]models.PixPurchase, error) {
+	var purchases []models.PixPurchase
+	if err := r.DB.Where("created_at < ?", before).Find(&purchases).Error; err != nil {
+		return nil, err
+	}
+	return purchases, nil
+}
+
+func (r *ProductRepo) GetPurchaseByPaymentID(paymentID string) (*models.Purchase, error) {
+	var purchase models.Purchase
+	if err := r.DB.Where("payment_id = ?", paymentID).First(&purchase).Error; err != nil {
+		return nil, err
+	}
+	return &purchase, nil
+}
+
+func (r *ProductRepo) GetPurchasedPaymentIDs(paymentIDs []string) (map[string]bool, error) {
+	var found []string
+	if err := r.DB.Unscoped().Model(&models.Purchase{}).Where("payment_id IN ?", paymentIDs).Pluck("payment_id", &found).Error; err != nil {
+		return nil, err
+	}
+
+	purchased := make(map[string]bool, len(found))
+	for _, id := range found {
+		purchased[id] = true
+	}
+	return purchased, nil
+}
+
+func (r *ProductRepo) GetPendingPixPurchaseIDs(paymentIDs []int) (map[int]bool, error) {
+	var found []int
+	if err := r.DB.Model(&models.PixPurchase{}).Where("purchase_id IN ?", paymentIDs).Pluck("purchase_id", &found).Error; err != nil {
+		return nil, err
+	}
+
+	pending := make(map[int]bool, len(found))
+	for _, id := range found {
+		pending[id] = true
+	}
+	return pending, nil
+}
+
+// GetPaidPurchasesBetween returns the purchases paid through Mercado Pago in the given window, refunded ones included
+func (r *ProductRepo) GetPaidPurchasesBetween(from, to time.Time) ([]models.Purchase, error) {
+	var purchases []models.Purchase
+	err := r.DB.Where("payment_id IS NOT NULL AND payment_id <> '' AND purchased_at BETWEEN ? AND ?", from, to).
+		Order("purchased_at ASC").
+		Find(&purchases).Error
+	return purchases, err
+}
+
+// IsPaymentProcessed reports whether the Mercado Pago payment was already finalized
+func (r *ProductRepo) IsPaymentProcessed(paymentID string) (bool, error) {
+	var count int64
+	err := r.DB.Model(&models.ProcessedWebhook{}).Where("payment_id = ?", paymentID).Count(&count).Error
+	return count > 0, err
+}
+
 func (r *ProductRepo) FinalizePixPurchase(pixPurchase models.PixPurchase) error {
 	user, err := r.GetUserByID(pixPurchase.UserID)
 	if err != nil {
@@ -512,6 +862,30 @@ func (r *ProductRepo) FinalizePixPurchase(pixPurchase models.PixPurchase) error
 		}
 	}()
 
+	// The webhook and a status poll may finalize the same payment at once, locking the pending
+	// row and deleting it with the purchase makes only the first one go through
+	var pending models.PixPurchase
+	err = tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("purchase_id = ?", pixPurchase.PurchaseID).First(&pending).Error
+	if err != nil {
+		tx.Rollback()
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrPixPurchaseFinalized
+		}
+		return errors.New("failed to lock pix purchase: " + err.Error())
+	}
+
+	// Recorded in the same transaction as the purchase, a payment is marked processed only if it was delivered
+	pixPaymentID := strconv.Itoa(pixPurchase.PurchaseID)
+	result := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&models.ProcessedWebhook{PaymentID: pixPaymentID})
+	if result.Error != nil {
+		tx.Rollback()
+		return errors.New("failed to record processed payment: " + result.Error.Error())
+	}
+	if result.RowsAffected == 0 {
+		tx.Rollback()
+		return ErrPixPurchaseFinalized
+	}
+
 	// Query for existing user product
 	purchaseID := uuid.New().String()
 	purchase := &models.Purchase{
@@ -519,8 +893,11 @@ func (r *ProductRepo) FinalizePixPurchase(pixPurchase models.PixPurchase) error
 		UserID:        user.ID,
 		ProductID:     product.ID,
 		Quantity:      pixPurchase.Quantity,
+		UnitPriceInt:  pending.UnitPriceInt,
 		IsGift:        pixPurchase.IsGift,
 		GiftedToEmail: pixPurchase.GiftedToEmail,
+		PaymentID:     &pixPaymentID,
+		PaymentMethod: "pix",
 	}
 
 	err = tx.Create(purchase).Error
@@ -599,86 +976,33 @@ func (r *ProductRepo) FinalizePixPurchase(pixPurchase models.PixPurchase) error
 		}
 	}
 
-	// TODO: Access target logic needs to be rethinked for EventAccess entirely
-	for _, access := range product.AccessTargets {
-		if !access.IsEvent {
-			registration := &models.ActivityRegistration{
-				ActivityID:   access.TargetID,
-				ProductID:    &product.ID,
-				AccessMethod: string(models.AccessMethodProduct),
-				UserID:       userProduct.UserID,
-			}
-			var count int64
-			err = tx.Model(&models.ActivityRegistration{}).
-				Where("activity_id = ? AND user_id = ?", registration.ActivityID, registration.UserID).
-				Count(&count).Error
-
-			if err != nil && err != gorm.ErrRecordNotFound {
-				tx.Rollback()
-				log.Println("Error 10")
-				return errors.New("failed to get activity registration: " + err.Error())
-			}
+	err = r.registerProductOwner(tx, product, userProduct.UserID)
+	if err != nil {
+		tx.Rollback()
+		log.Println("Error 14")
+		return err
+	}
 
-			if count > 0 {
-				continue
-			}
+	if _, err := r.grantBundledProducts(tx, userProduct, product.EventID); err != nil {
+		tx.Rollback()
+		return err
+	}
 
-			err = tx.Create(registration).Error
-			if err != nil {
-				tx.Rollback()
-				log.Println("Error 11")
-				return errors.New("failed to create activity registration: " + err.Error())
-			}
-		} else {
-			if access.EventID == nil {
-				tx.Rollback()
-				log.Println("error 12")
-				return errors.New("event access should not have nil event id: " + err.Error())
-			}
-			activities, err := r.GetAllActivitiesFromEvent(*access.EventID)
-			if err != nil {
-				tx.Rollback()
-				log.Println("error 13")
-				return errors.New("error getting activities: " + err.Error())
-			}
-			for _, activity := range activities {
-				shouldRegister := activity.IsMandatory || (!activity.HasFee)
-
-				if shouldRegister {
-					registration := models.ActivityRegistration{
-						ActivityID:   activity.ID,
-						UserID:       user.ID,
-						RegisteredAt: time.Now(),
-						AccessMethod: string(models.AccessMethodProduct),
-					}
-
-					var count int64
-					err = tx.Model(&models.ActivityRegistration{}).
-						Where("activity_id = ? AND user_id = ?", registration.ActivityID, registration.UserID).
-						Count(&count).Error
-					if err != nil && err != gorm.ErrRecordNotFound {
-						tx.Rollback()
-						log.Println("Error 14")
-						return errors.New("failed to get activity registration: " + err.Error())
-					}
-
-					// Skip if already registered
-					if count > 0 {
-						continue
-					}
-
-					// Create the registration
-					err = tx.Create(&registration).Error
-					if err != nil {
-						tx.Rollback()
-						log.Println("Error 15")
-						return errors.New("failed to create activity registration: " + err.Error())
-					}
-				}
-			}
+	// The payment already went through, the use counts even if the coupon ran out in the meantime
+	if pending.CouponID != nil {
+		if err := tx.Model(&models.Coupon{}).Where("id = ?", *pending.CouponID).
+			Update("uses", gorm.Expr("uses + 1")).Error; err != nil {
+			tx.Rollback()
+			return errors.New("failed to redeem coupon: " + err.Error())
 		}
 	}
 
+	err = tx.Where("purchase_id = ?", pixPurchase.PurchaseID).Delete(&models.PixPurchase{}).Error
+	if err != nil {
+		tx.Rollback()
+		return errors.New("failed to delete pix purchase: " + err.Error())
+	}
+
 	if err := tx.Commit().Error; err != nil {
 		tx.Rollback()
 		log.Println("Error 16")
@@ -688,10 +1012,818 @@ func (r *ProductRepo) FinalizePixPurchase(pixPurchase models.PixPurchase) error
 	return nil
 }
 
-func (r *ProductRepo) GetAllActivitiesFromEvent(eventID string) ([]models.Activity, error) {
-	var activities []models.Activity
-	if err := r.DB.Where("event_id = ? AND is_hidden = ?", eventID, false).Find(&activities).Error; err != nil {
-		return nil, err
+// grantBundledProducts gives the owner of a purchased product the products it bundles, each with its bundled
+// quantity per purchased unit, along with their stock, tokens and activity registrations. Runs inside the
+// purchase transaction and returns the tokens created
+func (r *ProductRepo) grantBundledProducts(tx *gorm.DB, parent *models.UserProduct, eventID string) ([]models.UserToken, error) {
+	var bundles []models.ProductBundle
+	if err := tx.Where("parent_product_id = ?", parent.ProductID).Find(&bundles).Error; err != nil {
+		return nil, errors.New("failed to get bundled products: " + err.Error())
 	}
-	return activities, nil
+
+	var userTokens []models.UserToken
+	for _, bundle := range bundles {
+		var child models.Product
+		if err := tx.Preload("AccessTargets").Where("id = ?", bundle.ChildProductID).First(&child).Error; err != nil {
+			return nil, errors.New("failed to get bundled product: " + err.Error())
+		}
+
+		units := bundle.Quantity * parent.Quantity
+		if !child.HasUnlimitedQuantity {
+			result := tx.Model(&models.Product{}).
+				Where("id = ? AND quantity >= ?", child.ID, units).
+				Update("quantity", gorm.Expr("quantity - ?", units))
+			if result.Error != nil {
+				return nil, errors.New("failed to update bundled product quantity: " + result.Error.Error())
+			}
+			if result.RowsAffected == 0 {
+				return nil, errors.New("bundled product " + child.Name + " is out of stock")
+			}
+		}
+
+		userProduct := &models.UserProduct{
+			ID:             uuid.New().String(),
+			UserID:         parent.UserID,
+			ProductID:      child.ID,
+			PurchaseID:     parent.PurchaseID,
+			Quantity:       units,
+			ReceivedAsGift: parent.ReceivedAsGift,
+			GiftedFromID:   parent.GiftedFromID,
+		}
+		if err := tx.Create(userProduct).Error; err != nil {
+			return nil, errors.New("failed to create bundled user product: " + err.Error())
+		}
+
+		if child.IsActivityToken {
+			for i := 0; i < child.TokenQuantity*units; i++ {
+				token := models.UserToken{
+					ID:            uuid.New().String(),
+					EventID:       eventID,
+					UserID:        userProduct.UserID,
+					UserProductID: userProduct.ID,
+					ProductID:     child.ID,
+				}
+				if err := tx.Create(&token).Error; err != nil {
+					return nil, errors.New("failed to create user token: " + err.Error())
+				}
+				userTokens = append(userTokens, token)
+			}
+		}
+
+		if err := r.registerProductOwner(tx, &child, userProduct.UserID); err != nil {
+			return nil, err
+		}
+	}
+
+	return userTokens, nil
+}
+
+// registerProductOwner registers the owner of a purchased product to the activities listed by
+// GetProductAutoRegistrations, skipping the ones they are already registered to. Card and PIX
+// purchases both go through it inside their transaction
+func (r *ProductRepo) registerProductOwner(tx *gorm.DB, product *models.Product, userID string) error {
+	autoRegistrations, err := r.GetProductAutoRegistrations(product)
+	if err != nil {
+		return errors.New("error getting activities: " + err.Error())
+	}
+
+	for _, auto := range autoRegistrations {
+		var count int64
+		err := tx.Model(&models.ActivityRegistration{}).
+			Where("activity_id = ? AND user_id = ?", auto.Activity.ID, userID).
+			Count(&count).Error
+		if err != nil {
+			return errors.New("failed to get activity registration: " + err.Error())
+		}
+
+		// Skip if already registered
+		if count > 0 {
+			continue
+		}
+
+		registration := &models.ActivityRegistration{
+			ActivityID:   auto.Activity.ID,
+			UserID:       userID,
+			ProductID:    &product.ID,
+			RegisteredAt: time.Now(),
+			AccessMethod: string(models.AccessMethodProduct),
+		}
+		if err := tx.Create(registration).Error; err != nil {
+			return errors.New("failed to create activity registration: " + err.Error())
+		}
+	}
+
+	return nil
+}
+
+// GetProductAutoRegistrations lists the activities a buyer of the product is registered to: the ones it
+// targets directly, plus the mandatory and free activities of the events it gives access to.
+// Purchases register owners from this list, so previews never diverge from purchases
+func (r *ProductRepo) GetProductAutoRegistrations(product *models.Product) ([]models.ProductAutoRegistration, error) {
+	var autoRegistrations []models.ProductAutoRegistration
+	seen := make(map[string]bool)
+	add := func(activity models.Activity, reason models.AutoRegistrationReason) {
+		if seen[activity.ID] {
+			return
+		}
+		seen[activity.ID] = true
+		autoRegistrations = append(autoRegistrations, models.ProductAutoRegistration{Activity: activity, Reason: reason})
+	}
+
+	for _, access := range product.AccessTargets {
+		if !access.IsEvent {
+			activity, err := r.GetActivityByID(access.TargetID)
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				continue // Deleted activities leave orphaned targets behind, there is nothing to register to
+			}
+			if err != nil {
+				return nil, errors.New("failed to get targeted activity: " + err.Error())
+			}
+			add(*activity, models.AutoRegistrationTarget)
+			continue
+		}
+
+		if access.EventID == nil {
+			return nil, errors.New("event access should not have nil event id")
+		}
+		activities, err := r.GetAllActivitiesFromEvent(*access.EventID)
+		if err != nil {
+			return nil, err
+		}
+		for _, activity := range activities {
+			switch {
+			case activity.IsMandatory:
+				add(activity, models.AutoRegistrationMandatory)
+			case !activity.HasFee:
+				add(activity, models.AutoRegistrationFree)
+			}
+		}
+	}
+
+	return autoRegistrations, nil
+}
+
+func (r *ProductRepo) GetAllActivitiesFromEvent(eventID string) ([]models.Activity, error) {
+	var activities []models.Activity
+	if err := r.DB.Where("event_id = ? AND is_hidden = ?", eventID, false).Find(&activities).Error; err != nil {
+		return nil, err
+	}
+	return activities, nil
+}
+
+func (r *ProductRepo) GetUserProductsFromUsers(productID string, userIDs []string) ([]models.UserProduct, error) {
+	var userProducts []models.UserProduct
+	if err := r.DB.Where("product_id = ? AND user_id IN ?", productID, userIDs).Find(&userProducts).Error; err != nil {
+		return nil, err
+	}
+	return userProducts, nil
+}
+
+// DeliverPurchases validates and marks the purchases in results as delivered in a
+// single transaction, locking each purchase so concurrent batches can't both deliver it.
+// Results that already carry a message are left untouched
+func (r *ProductRepo) DeliverPurchases(eventID string, results []models.DeliveryResult) error {
+	now := time.Now()
+	return r.DB.Transaction(func(tx *gorm.DB) error {
+		delivered := make(map[string]bool)
+		for i := range results {
+			result := &results[i]
+			if result.Message != "" {
+				continue
+			}
+
+			var purchase models.Purchase
+			if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+				Where("id = ?", result.PurchaseID).
+				First(&purchase).Error; err != nil {
+				result.Message = "purchase not found"
+				continue
+			}
+			if result.UserID == "" {
+				result.UserID = purchase.UserID
+			}
+
+			var product models.Product
+			if err := tx.Where("id = ?", purchase.ProductID).First(&product).Error; err != nil {
+				result.Message = "product not found"
+				continue
+			}
+
+			if product.EventID != eventID {
+				result.Message = "purchase does not belong to this event"
+				continue
+			}
+			if !product.IsPhysicalItem {
+				result.Message = "product is not a physical item"
+				continue
+			}
+			if delivered[purchase.ID] {
+				result.Message = "purchase is duplicated in this batch"
+				continue
+			}
+
+			update := tx.Model(&models.Purchase{}).
+				Where("id = ? AND is_delivered = ?", purchase.ID, false).
+				Updates(map[string]interface{}{
+					"is_delivered": true,
+					"delivered_at": now,
+				})
+			if update.Error != nil {
+				return update.Error
+			}
+			if update.RowsAffected == 0 {
+				result.Message = "purchase was already delivered"
+				continue
+			}
+
+			delivered[purchase.ID] = true
+			result.Success = true
+			result.Message = "delivered"
+		}
+		return nil
+	})
+}
+
+// GetPendingDeliveries lists the purchases of physical items of the event not delivered yet, oldest first.
+// Refunded purchases are left out
+func (r *ProductRepo) GetPendingDeliveries(eventID string) ([]models.PendingDelivery, error) {
+	var pending []models.PendingDelivery
+	err := r.DB.Table("purchases").
+		Select(`purchases.id AS purchase_id, purchases.product_id, products.name AS product_name,
+			purchases.quantity - purchases.refunded_quantity AS quantity, owners.id AS owner_id, owners.name AS owner_name,
+			owners.last_name AS owner_last_name, owners.email AS owner_email, purchases.is_gift, purchases.purchased_at`).
+		Joins("JOIN products ON products.id = purchases.product_id").
+		Joins("JOIN user_products ON user_products.purchase_id = purchases.id AND user_products.product_id = purchases.product_id AND user_products.deleted_at IS NULL").
+		Joins("JOIN users AS owners ON owners.id = user_products.user_id").
+		Where("products.event_id = ? AND products.is_physical_item = ?", eventID, true).
+		Where("purchases.is_delivered = ? AND purchases.refunded_at IS NULL AND purchases.deleted_at IS NULL", false).
+		Order("purchases.purchased_at ASC").
+		Scan(&pending).Error
+	return pending, err
+}
+
+// orphanedAccessTargets selects the access targets of the event products that point
+// to a deleted or missing activity or event
+func (r *ProductRepo) orphanedAccessTargets(eventID string) *gorm.DB {
+	return r.DB.Table("access_targets").
+		Joins("JOIN products ON products.id = access_targets.product_id AND products.deleted_at IS NULL").
+		Where("products.event_id = ? AND access_targets.deleted_at IS NULL", eventID).
+		Where(`(access_targets.is_event = ? AND NOT EXISTS (SELECT 1 FROM activities WHERE activities.id = access_targets.target_id AND activities.deleted_at IS NULL))
+			OR (access_targets.is_event = ? AND NOT EXISTS (SELECT 1 FROM events WHERE events.id = access_targets.target_id AND events.deleted_at IS NULL))`, false, true)
+}
+
+func (r *ProductRepo) GetOrphanedAccessTargets(eventID string) ([]models.OrphanedAccessTarget, error) {
+	var orphans []models.OrphanedAccessTarget
+	err := r.orphanedAccessTargets(eventID).
+		Select("access_targets.id, access_targets.product_id, products.name AS product_name, access_targets.target_id, access_targets.is_event").
+		Order("products.name ASC").
+		Scan(&orphans).Error
+	if err != nil {
+		return nil, err
+	}
+	return orphans, nil
+}
+
+// DeleteOrphanedAccessTargets removes the orphaned access targets and returns how many were removed
+func (r *ProductRepo) DeleteOrphanedAccessTargets(eventID string) (int64, error) {
+	orphans := r.orphanedAccessTargets(eventID).Select("access_targets.id")
+	result := r.DB.Where("id IN (?)", orphans).Delete(&models.AccessTarget{})
+	if result.Error != nil {
+		return 0, result.Error
+	}
+	return result.RowsAffected, nil
+}
+
+func (r *ProductRepo) BlockEvent(eventID string) error {
+	return r.DB.Model(&models.Event{}).Where("id = ?", eventID).Update("is_blocked", true).Error
+}
+
+const staleCancellationAfter = 30 * time.Minute
+
+// StartEventCancellation creates or resumes the cancellation report of the event,
+// refusing to start while another run is still going
+func (r *ProductRepo) StartEventCancellation(eventID, requestedBy string) (*models.EventCancellation, error) {
+	var cancellation models.EventCancellation
+	err := r.DB.Transaction(func(tx *gorm.DB) error {
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("event_id = ?", eventID).First(&cancellation).Error
+		if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+			return err
+		}
+
+		// A run that never finished (e.g. the server restarted) can be resumed after a while
+		if err == nil && cancellation.Status == models.CancellationRunning && time.Since(cancellation.StartedAt) < staleCancellationAfter {
+			return errors.New("event cancellation is already running")
+		}
+
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			cancellation = models.EventCancellation{ID: uuid.New().String(), EventID: eventID}
+		}
+		cancellation.RequestedBy = requestedBy
+		cancellation.Status = models.CancellationRunning
+		cancellation.StartedAt = time.Now()
+		cancellation.FinishedAt = nil
+		return tx.Save(&cancellation).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &cancellation, nil
+}
+
+func (r *ProductRepo) GetEventCancellation(eventID string) (*models.EventCancellation, error) {
+	var cancellation models.EventCancellation
+	if err := r.DB.Preload("Entries").Where("event_id = ?", eventID).First(&cancellation).Error; err != nil {
+		return nil, err
+	}
+	return &cancellation, nil
+}
+
+func (r *ProductRepo) UpdateEventCancellation(cancellation *models.EventCancellation) error {
+	return r.DB.Omit("Entries").Save(cancellation).Error
+}
+
+func (r *ProductRepo) SaveCancellationEntry(entry *models.CancellationEntry) error {
+	return r.DB.Clauses(clause.OnConflict{UpdateAll: true}).Create(entry).Error
+}
+
+// GetEventPurchases returns every purchase of the event products, deleted products included
+func (r *ProductRepo) GetEventPurchases(eventID string) ([]models.Purchase, error) {
+	var purchases []models.Purchase
+	err := r.DB.Joins("JOIN products ON products.id = purchases.product_id").
+		Where("products.event_id = ?", eventID).
+		Order("purchases.purchased_at ASC").
+		Find(&purchases).Error
+	if err != nil {
+		return nil, err
+	}
+	return purchases, nil
+}
+
+// StreamEventPurchaseExport hands the event purchases to fn one row at a time, deleted products included,
+// so the export never holds the whole list in memory
+func (r *ProductRepo) StreamEventPurchaseExport(eventID string, fn func(models.PurchaseExportRow) error) error {
+	rows, err := r.DB.Model(&models.Purchase{}).
+		Select(`purchases.id AS purchase_id, users.email AS buyer_email, products.id AS product_id, products.name AS product_name,
+			purchases.quantity, purchases.unit_price_int, purchases.payment_method, purchases.payment_id,
+			purchases.is_gift, purchases.gifted_to_email, purchases.refunded_quantity, purchases.refunded_at, purchases.purchased_at`).
+		Joins("JOIN products ON products.id = purchases.product_id").
+		Joins("JOIN users ON users.id = purchases.user_id").
+		Where("products.event_id = ?", eventID).
+		Order("purchases.purchased_at ASC").
+		Rows()
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var row models.PurchaseExportRow
+		if err := r.DB.ScanRows(rows, &row); err != nil {
+			return err
+		}
+		if err := fn(row); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+// RefundPayment fully refunds a Mercado Pago payment
+func (r *ProductRepo) RefundPayment(paymentID string) error {
+	id, err := strconv.Atoi(paymentID)
+	if err != nil {
+		return errors.New("invalid payment ID format: " + err.Error())
+	}
+
+	refundClient := refund.NewClient(config.GetMercadoPagoConfig())
+	if _, err := refundClient.Create(context.Background(), id); err != nil {
+		return err
+	}
+	return nil
+}
+
+// IsPaymentShared reports whether other purchases were paid with the same payment, as the items of a cart are
+func (r *ProductRepo) IsPaymentShared(paymentID, purchaseID string) (bool, error) {
+	var count int64
+	err := r.DB.Model(&models.Purchase{}).Where("payment_id = ? AND id <> ?", paymentID, purchaseID).Count(&count).Error
+	return count > 0, err
+}
+
+// RefundPaymentAmount refunds part of a Mercado Pago payment, amount in cents
+func (r *ProductRepo) RefundPaymentAmount(paymentID string, amountInt int) error {
+	id, err := strconv.Atoi(paymentID)
+	if err != nil {
+		return errors.New("invalid payment ID format: " + err.Error())
+	}
+
+	refundClient := refund.NewClient(config.GetMercadoPagoConfig())
+	if _, err := refundClient.CreatePartialRefund(context.Background(), id, float64(amountInt)/100); err != nil {
+		return err
+	}
+	return nil
+}
+
+// GetUserProductsByPurchaseID lists what the purchase granted: the purchased product and the ones it bundles
+func (r *ProductRepo) GetUserProductsByPurchaseID(purchaseID string) ([]models.UserProduct, error) {
+	var userProducts []models.UserProduct
+	if err := r.DB.Where("purchase_id = ?", purchaseID).Find(&userProducts).Error; err != nil {
+		return nil, err
+	}
+	return userProducts, nil
+}
+
+// GetUserProductConsumption counts the tokens of the owned product already spent and the activities its
+// owner attended through the product or those tokens
+func (r *ProductRepo) GetUserProductConsumption(userProduct *models.UserProduct) (int64, int64, error) {
+	var usedTokens int64
+	if err := r.DB.Model(&models.UserToken{}).
+		Where("user_product_id = ? AND is_used = ?", userProduct.ID, true).
+		Count(&usedTokens).Error; err != nil {
+		return 0, 0, err
+	}
+
+	tokenIDs := r.DB.Model(&models.UserToken{}).Select("id").Where("user_product_id = ?", userProduct.ID)
+	var attended int64
+	if err := r.DB.Model(&models.ActivityRegistration{}).
+		Where("user_id = ? AND attended_at IS NOT NULL AND ((product_id = ? AND access_method = ?) OR token_id IN (?))",
+			userProduct.UserID, userProduct.ProductID, models.AccessMethodProduct, tokenIDs).
+		Count(&attended).Error; err != nil {
+		return 0, 0, err
+	}
+
+	return usedTokens, attended, nil
+}
+
+// RefundPurchaseUnits takes back the given units of a purchase from its owner: the user product
+// quantity goes down, as many tokens as the units granted are removed (unused ones first, used ones
+// take their activity registration along) and the stock is restored. The product access registrations
+// only go away with the last unit. Products bundled in the purchase go back in the same proportion.
+// The units must have been reserved with ReserveRefundUnits, the owned rows are locked and read again
+// so concurrent refunds of the same purchase don't work over stale quantities
+func (r *ProductRepo) RefundPurchaseUnits(purchase *models.Purchase, product *models.Product, userProduct *models.UserProduct, record *models.PurchaseRefund) error {
+	return r.DB.Transaction(func(tx *gorm.DB) error {
+		quantity := record.Quantity
+
+		var owned models.UserProduct
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&owned, "id = ?", userProduct.ID).Error; err != nil {
+			return err
+		}
+		if owned.Quantity < quantity {
+			return fmt.Errorf("only %d units are still owned", owned.Quantity)
+		}
+		userProduct = &owned
+
+		// Bundled quantities are a multiple of the purchased units, taken back before the purchased product changes
+		var bundled []models.UserProduct
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("purchase_id = ? AND id <> ?", purchase.ID, userProduct.ID).
+			Find(&bundled).Error; err != nil {
+			return err
+		}
+		for i := range bundled {
+			var child models.Product
+			if err := tx.Unscoped().Where("id = ?", bundled[i].ProductID).First(&child).Error; err != nil {
+				return err
+			}
+			perUnit := bundled[i].Quantity / userProduct.Quantity
+			if err := takeBackUserProductUnits(tx, &child, &bundled[i], perUnit*quantity); err != nil {
+				return err
+			}
+		}
+
+		if err := takeBackUserProductUnits(tx, product, userProduct, quantity); err != nil {
+			return err
+		}
+
+		// The refunded quantity was already raised by the reservation, the last units mark the purchase refunded
+		if err := tx.Model(&models.Purchase{}).
+			Where("id = ? AND refunded_quantity >= quantity", purchase.ID).
+			Update("refunded_at", time.Now()).Error; err != nil {
+			return err
+		}
+
+		return tx.Create(record).Error
+	})
+}
+
+// ReserveRefundUnits counts units of a purchase as refunded before their payment is refunded. The
+// conditional update keeps concurrent refunds from giving back more units than were bought
+func (r *ProductRepo) ReserveRefundUnits(purchaseID string, quantity int) error {
+	result := r.DB.Model(&models.Purchase{}).
+		Where("id = ? AND refunded_at IS NULL AND refunded_quantity + ? <= quantity", purchaseID, quantity).
+		Update("refunded_quantity", gorm.Expr("refunded_quantity + ?", quantity))
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return errors.New("purchase units were already refunded by another request")
+	}
+	return nil
+}
+
+// ReleaseRefundUnits gives back units reserved by ReserveRefundUnits when their payment could not be refunded
+func (r *ProductRepo) ReleaseRefundUnits(purchaseID string, quantity int) error {
+	return r.DB.Model(&models.Purchase{}).
+		Where("id = ?", purchaseID).
+		Update("refunded_quantity", gorm.Expr("refunded_quantity - ?", quantity)).Error
+}
+
+func takeBackUserProductUnits(tx *gorm.DB, product *models.Product, userProduct *models.UserProduct, quantity int) error {
+	if userProduct.Quantity > quantity {
+		if err := tx.Model(userProduct).Update("quantity", userProduct.Quantity-quantity).Error; err != nil {
+			return err
+		}
+	} else {
+		if err := tx.Delete(userProduct).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("user_id = ? AND product_id = ? AND access_method = ?", userProduct.UserID, product.ID, models.AccessMethodProduct).
+			Delete(&models.ActivityRegistration{}).Error; err != nil {
+			return err
+		}
+	}
+
+	if tokensToFree := product.TokenQuantity * quantity; tokensToFree > 0 {
+		var tokens []models.UserToken
+		if err := tx.Where("user_product_id = ?", userProduct.ID).
+			Order("is_used ASC, created_at DESC").
+			Limit(tokensToFree).
+			Find(&tokens).Error; err != nil {
+			return err
+		}
+
+		var tokenIDs []string
+		for _, token := range tokens {
+			tokenIDs = append(tokenIDs, token.ID)
+		}
+		if len(tokenIDs) > 0 {
+			if err := tx.Where("token_id IN ?", tokenIDs).Delete(&models.ActivityRegistration{}).Error; err != nil {
+				return err
+			}
+			if err := tx.Where("id IN ?", tokenIDs).Delete(&models.UserToken{}).Error; err != nil {
+				return err
+			}
+		}
+	}
+
+	if !product.HasUnlimitedQuantity {
+		if err := tx.Model(product).Update("quantity", gorm.Expr("quantity + ?", quantity)).Error; err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (r *ProductRepo) MarkPurchaseRefunded(purchaseID string) error {
+	return r.DB.Model(&models.Purchase{}).
+		Where("id = ? AND refunded_at IS NULL", purchaseID).
+		Update("refunded_at", time.Now()).Error
+}
+
+// ReverseEventPurchase removes what the purchase granted: its user products, their tokens
+// and the owners' registrations to the event activities. Safe to run more than once
+func (r *ProductRepo) ReverseEventPurchase(purchaseID, eventID string) error {
+	return r.DB.Transaction(func(tx *gorm.DB) error {
+		var userProducts []models.UserProduct
+		if err := tx.Where("purchase_id = ?", purchaseID).Find(&userProducts).Error; err != nil {
+			return err
+		}
+
+		if len(userProducts) == 0 {
+			return nil
+		}
+
+		var userProductIDs, ownerIDs []string
+		for _, userProduct := range userProducts {
+			userProductIDs = append(userProductIDs, userProduct.ID)
+			ownerIDs = append(ownerIDs, userProduct.UserID)
+		}
+
+		if err := tx.Where("user_product_id IN ?", userProductIDs).Delete(&models.UserToken{}).Error; err != nil {
+			return err
+		}
+
+		if err := tx.Where("id IN ?", userProductIDs).Delete(&models.UserProduct{}).Error; err != nil {
+			return err
+		}
+
+		eventActivities := tx.Model(&models.Activity{}).Select("id").Where("event_id = ?", eventID)
+		return tx.Where("user_id IN ? AND activity_id IN (?)", ownerIDs, eventActivities).
+			Delete(&models.ActivityRegistration{}).Error
+	})
+}
+
+func (r *ProductRepo) HasProductAccessGrant(productID, userID string) (bool, error) {
+	var count int64
+	err := r.DB.Model(&models.ProductAccessGrant{}).
+		Where("product_id = ? AND user_id = ?", productID, userID).
+		Count(&count).Error
+	if err != nil {
+		return false, err
+	}
+	return count > 0, nil
+}
+
+func (r *ProductRepo) GetProductAccessGrants(productID string) ([]models.ProductAccessGrant, error) {
+	var grants []models.ProductAccessGrant
+	if err := r.DB.Where("product_id = ?", productID).Order("created_at ASC").Find(&grants).Error; err != nil {
+		return nil, err
+	}
+	return grants, nil
+}
+
+func (r *ProductRepo) CreateCoupon(coupon *models.Coupon) error {
+	return r.DB.Create(coupon).Error
+}
+
+// GetCouponByCode finds a coupon of the event, the code must already be in upper case
+func (r *ProductRepo) GetCouponByCode(eventID, code string) (*models.Coupon, error) {
+	var coupon models.Coupon
+	if err := r.DB.Where("event_id = ? AND code = ?", eventID, code).First(&coupon).Error; err != nil {
+		return nil, err
+	}
+	return &coupon, nil
+}
+
+func (r *ProductRepo) GetEventCoupons(eventID string) ([]models.Coupon, error) {
+	var coupons []models.Coupon
+	if err := r.DB.Where("event_id = ?", eventID).Order("created_at DESC").Find(&coupons).Error; err != nil {
+		return nil, err
+	}
+	return coupons, nil
+}
+
+func (r *ProductRepo) DeleteCoupon(eventID, couponID string) error {
+	result := r.DB.Where("id = ? AND event_id = ?", couponID, eventID).Delete(&models.Coupon{})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return errors.New("coupon not found")
+	}
+	return nil
+}
+
+// redeemCoupon counts an order paid with the coupon, the condition keeps concurrent orders from going over its uses
+func redeemCoupon(tx *gorm.DB, couponID string) error {
+	result := tx.Model(&models.Coupon{}).
+		Where("id = ? AND (max_uses = 0 OR uses < max_uses)", couponID).
+		Update("uses", gorm.Expr("uses + 1"))
+	if result.Error != nil {
+		return errors.New("failed to redeem coupon: " + result.Error.Error())
+	}
+	if result.RowsAffected == 0 {
+		return errors.New("coupon has reached its usage limit")
+	}
+	return nil
+}
+
+// CreateProductAccessGrants allowlists the users, already granted users are left as they are
+func (r *ProductRepo) CreateProductAccessGrants(grants []models.ProductAccessGrant) error {
+	if len(grants) == 0 {
+		return nil
+	}
+	return r.DB.Clauses(clause.OnConflict{DoNothing: true}).Create(&grants).Error
+}
+
+func (r *ProductRepo) DeleteProductAccessGrant(productID, userID string) error {
+	result := r.DB.Where("product_id = ? AND user_id = ?", productID, userID).Delete(&models.ProductAccessGrant{})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return errors.New("access grant not found")
+	}
+	return nil
+}
+
+// SetEventProductsBlocked flips the blocked flag of every product of the event in a single
+// update and records it in the audit log, returning how many products changed
+func (r *ProductRepo) SetEventProductsBlocked(eventID string, blocked bool, audit *models.AuditLog) (int64, error) {
+	var affected int64
+	err := r.DB.Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(&models.Product{}).
+			Where("event_id = ? AND is_blocked = ?", eventID, !blocked).
+			Update("is_blocked", blocked)
+		if result.Error != nil {
+			return result.Error
+		}
+		affected = result.RowsAffected
+
+		audit.Details = fmt.Sprintf(`{"affected":%d}`, affected)
+		return tx.Create(audit).Error
+	})
+	return affected, err
+}
+
+// GetExpiringProducts returns the event products still purchasable now that stop being so by the given time
+func (r *ProductRepo) GetExpiringProducts(eventID string, now, until time.Time) ([]models.Product, error) {
+	var products []models.Product
+	err := r.DB.Where("event_id = ? AND expires_at > ? AND expires_at <= ?", eventID, now, until).
+		Order("expires_at ASC").
+		Find(&products).Error
+	if err != nil {
+		return nil, err
+	}
+	return products, nil
+}
+
+// UpdateProductExpiries sets the new expiry of each product, all or nothing
+func (r *ProductRepo) UpdateProductExpiries(expiries map[string]time.Time) error {
+	return r.DB.Transaction(func(tx *gorm.DB) error {
+		for productID, expiresAt := range expiries {
+			if err := tx.Model(&models.Product{}).Where("id = ?", productID).Update("expires_at", expiresAt).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// GetGiftingStats counts the event gift purchases and recipients, leaving TopGifters and RedemptionRate to the caller
+func (r *ProductRepo) GetGiftingStats(eventID string) (*models.GiftingStats, error) {
+	var stats models.GiftingStats
+	err := r.DB.Table("purchases").
+		Select("COUNT(*) AS gifted_purchases, COALESCE(SUM(purchases.quantity - purchases.refunded_quantity), 0) AS gifted_units").
+		Joins("JOIN products ON products.id = purchases.product_id").
+		Where("products.event_id = ? AND purchases.is_gift = ? AND purchases.deleted_at IS NULL AND purchases.refunded_at IS NULL", eventID, true).
+		Scan(&stats).Error
+	if err != nil {
+		return nil, err
+	}
+
+	var recipients struct {
+		Recipients           int64
+		RegisteredRecipients int64
+		ActiveRecipients     int64
+	}
+	err = r.DB.Table("user_products").
+		Select(`COUNT(DISTINCT user_products.user_id) AS recipients,
+			COUNT(DISTINCT user_products.user_id) FILTER (WHERE EXISTS (
+				SELECT 1 FROM event_registrations
+				WHERE event_registrations.user_id = user_products.user_id AND event_registrations.event_id = ?
+			)) AS registered_recipients,
+			COUNT(DISTINCT user_products.user_id) FILTER (WHERE EXISTS (
+				SELECT 1 FROM activity_registrations
+				JOIN activities ON activities.id = activity_registrations.activity_id
+				WHERE activity_registrations.user_id = user_products.user_id AND activities.event_id = ?
+				AND activity_registrations.attended_at IS NOT NULL AND activity_registrations.deleted_at IS NULL
+			) OR EXISTS (
+				SELECT 1 FROM user_tokens
+				WHERE user_tokens.user_product_id = user_products.id AND user_tokens.is_used AND user_tokens.deleted_at IS NULL
+			)) AS active_recipients`, eventID, eventID).
+		Joins("JOIN products ON products.id = user_products.product_id").
+		Joins("JOIN purchases ON purchases.id = user_products.purchase_id").
+		Where("products.event_id = ? AND user_products.received_as_gift = ? AND user_products.deleted_at IS NULL AND purchases.refunded_at IS NULL", eventID, true).
+		Scan(&recipients).Error
+	if err != nil {
+		return nil, err
+	}
+
+	stats.Recipients = recipients.Recipients
+	stats.RegisteredRecipients = recipients.RegisteredRecipients
+	stats.ActiveRecipients = recipients.ActiveRecipients
+	return &stats, nil
+}
+
+// GetTopGifters returns the users that gifted the most units of the event products
+func (r *ProductRepo) GetTopGifters(eventID string, limit int) ([]models.TopGifter, error) {
+	var gifters []models.TopGifter
+	err := r.DB.Table("purchases").
+		Select(`purchases.user_id, TRIM(CONCAT(users.name, ' ', users.last_name)) AS name, users.email,
+			COUNT(*) AS purchases, SUM(purchases.quantity - purchases.refunded_quantity) AS units,
+			COUNT(DISTINCT LOWER(purchases.gifted_to_email)) AS recipients`).
+		Joins("JOIN products ON products.id = purchases.product_id").
+		Joins("JOIN users ON users.id = purchases.user_id").
+		Where("products.event_id = ? AND purchases.is_gift = ? AND purchases.deleted_at IS NULL AND purchases.refunded_at IS NULL", eventID, true).
+		Group("purchases.user_id, users.name, users.last_name, users.email").
+		Order("units DESC, purchases DESC").
+		Limit(limit).
+		Scan(&gifters).Error
+	return gifters, err
+}
+
+// GetUserSpendByEvent sums the purchases the user paid for, gifts included, grouped by event, at the unit
+// prices they were bought for. A purchase marked refunded counts as fully refunded, otherwise the amounts
+// of its partial refunds are used
+func (r *ProductRepo) GetUserSpendByEvent(userID string) ([]models.EventSpend, error) {
+	refunds := r.DB.Model(&models.PurchaseRefund{}).
+		Select("purchase_id, SUM(amount_int) AS total").
+		Group("purchase_id")
+
+	var spends []models.EventSpend
+	err := r.DB.Table("purchases").
+		Select(`events.id AS event_id, events.slug AS event_slug, events.name AS event_name, COUNT(*) AS purchases,
+			SUM(purchases.quantity * purchases.unit_price_int) AS paid_int,
+			SUM(CASE WHEN purchases.refunded_at IS NOT NULL THEN purchases.quantity * purchases.unit_price_int
+				ELSE COALESCE(refunds.total, 0) END) AS refunded_int`).
+		Joins("JOIN products ON products.id = purchases.product_id").
+		Joins("JOIN events ON events.id = products.event_id").
+		Joins("LEFT JOIN (?) AS refunds ON refunds.purchase_id = purchases.id", refunds).
+		Where("purchases.user_id = ? AND purchases.deleted_at IS NULL", userID).
+		Group("events.id, events.slug, events.name").
+		Order("paid_int DESC").
+		Scan(&spends).Error
+	return spends, err
 }
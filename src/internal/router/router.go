@@ -16,12 +16,16 @@ import (
 	"gorm.io/gorm"
 )
 
-func InitializeMux(database *gorm.DB, cfg *config.Config) http.Handler {
-	logsDir := "logs"
-	if err := os.MkdirAll(logsDir, 0755); err != nil {
-		log.Fatalf("Error creating logs directory: %v\n", err)
-	}
+// Services holds the services shared by the router and the background sweepers started in main
+type Services struct {
+	Auth     *services.AuthService
+	Event    *services.EventService
+	Activity *services.ActivityService
+	Product  *services.ProductService
+	User     *services.UserService
+}
 
+func InitializeServices(database *gorm.DB, cfg *config.Config) *Services {
 	authRepo := repos.NewAuthRepo(database)
 	eventRepo := repos.NewEventRepo(database)
 	activityRepo := repos.NewActivityRepo(database)
@@ -32,20 +36,37 @@ func InitializeMux(database *gorm.DB, cfg *config.Config) http.Handler {
 	// fatals located in DB func
 	authRepo.CreateSuperUser()
 
-	authService := services.NewAuthService(authRepo, cfg.JWT_SECRET)
-	eventService := services.NewEventService(eventRepo)
-	activityService := services.NewActivityService(activityRepo)
-	productService := services.NewProductService(productRepo)
-	userService := services.NewUserService(userRepo)
+	return &Services{
+		Auth:     services.NewAuthService(authRepo, cfg.JWT_SECRET),
+		Event:    services.NewEventService(eventRepo),
+		Activity: services.NewActivityService(activityRepo),
+		Product:  services.NewProductService(productRepo),
+		User:     services.NewUserService(userRepo),
+	}
+}
+
+func InitializeMux(svc *Services, cfg *config.Config) http.Handler {
+	logsDir := "logs"
+	if err := os.MkdirAll(logsDir, 0755); err != nil {
+		log.Fatalf("Error creating logs directory: %v\n", err)
+	}
+
+	authService := svc.Auth
+	eventService := svc.Event
+	activityService := svc.Activity
+	productService := svc.Product
+	userService := svc.User
 
 	authHandler := handlers.NewAuthHandler(authService)
 	eventHandler := handlers.NewEventHandler(eventService)
 	activityHandler := handlers.NewActivityHandler(activityService)
 	productHandler := handlers.NewProductHandler(productService)
 	userHandler := handlers.NewUsersHandler(userService)
+	reportHandler := handlers.NewReportHandler(eventService, productService)
 
 	authMiddleware := mw.AuthMiddleware(authService)
 	verifiedOnly := mw.Chain(authMiddleware, mw.IsVerifiedMiddleware())
+	purchaseLimited := mw.Chain(authMiddleware, mw.IsVerifiedMiddleware(), mw.PurchaseCooldownMiddleware(config.GetPurchaseCooldown()))
 
 	mux := http.NewServeMux()
 
@@ -54,6 +75,7 @@ func InitializeMux(database *gorm.DB, cfg *config.Config) http.Handler {
 
 	// Users routes
 	mux.Handle("POST /users/create-event-creator", verifiedOnly(http.HandlerFunc(userHandler.CreateEventCreator)))
+	mux.Handle("POST /users/import", verifiedOnly(http.HandlerFunc(authHandler.ImportUsers)))
 	mux.HandleFunc("GET /users/{id}", userHandler.GetUserInfoFromID)
 	mux.HandleFunc("POST /users/batch", userHandler.GetUserInfoBatched)
 
@@ -69,6 +91,12 @@ func InitializeMux(database *gorm.DB, cfg *config.Config) http.Handler {
 	mux.Handle("POST /revoke-refresh-token", authMiddleware(http.HandlerFunc(authHandler.RevokeRefreshToken)))
 	mux.Handle("POST /secure-verify-tokens", authMiddleware(http.HandlerFunc(authHandler.VerifyJWT)))
 	mux.Handle("POST /verify-account", authMiddleware(http.HandlerFunc(authHandler.VerifyAccount)))
+	mux.Handle("POST /refresh-claims", authMiddleware(http.HandlerFunc(authHandler.RefreshClaims)))
+	mux.Handle("POST /admin/rotate-super-password", verifiedOnly(http.HandlerFunc(authHandler.RotateSuperPassword)))
+	mux.Handle("GET /admin/unverified-users", verifiedOnly(http.HandlerFunc(authHandler.GetUnverifiedUsers)))
+	mux.Handle("POST /admin/unverified-users/resend-verification", verifiedOnly(http.HandlerFunc(authHandler.ResendVerificationToUnverified)))
+	mux.Handle("GET /admin/event-creators", verifiedOnly(http.HandlerFunc(authHandler.GetEventCreators)))
+	mux.Handle("POST /admin/event-creators/grant", verifiedOnly(http.HandlerFunc(authHandler.GrantEventCreatorStatus)))
 	mux.Handle("POST /switch-event-creator-status", verifiedOnly(http.HandlerFunc(authHandler.SwitchEventCreatorStatus)))
 	mux.Handle("POST /resend-verification-code", authMiddleware(http.HandlerFunc(authHandler.ResendVerificationCode)))
 
@@ -76,8 +104,40 @@ func InitializeMux(database *gorm.DB, cfg *config.Config) http.Handler {
 	mux.HandleFunc("GET /events/{slug}", eventHandler.GetEvent)
 	mux.HandleFunc("GET /events", eventHandler.GetAllEvents)
 	mux.HandleFunc("GET /events/public", eventHandler.GetAllPublicEvents)
+	mux.HandleFunc("GET /events/{slug}/ticket-availability", eventHandler.GetTicketAvailability)
 	mux.Handle("GET /user-events", verifiedOnly(http.HandlerFunc(eventHandler.GetUserEvents)))
+	mux.Handle("GET /user-events/upcoming", verifiedOnly(http.HandlerFunc(eventHandler.GetUserUpcomingEvents)))
+	mux.Handle("GET /user-events/past", verifiedOnly(http.HandlerFunc(eventHandler.GetUserPastEvents)))
+	mux.Handle("GET /user-unregistered-access", verifiedOnly(http.HandlerFunc(eventHandler.GetUserUnregisteredAccessEvents)))
 	mux.Handle("GET /events/created", verifiedOnly(http.HandlerFunc(eventHandler.GetEventsCreatedByUser)))
+	mux.Handle("GET /admin/events", verifiedOnly(http.HandlerFunc(eventHandler.GetAdminEvents)))
+	mux.Handle("GET /venues/{venue}/conflicts", verifiedOnly(http.HandlerFunc(eventHandler.GetVenueConflicts)))
+	mux.Handle("GET /user-manageable-events", verifiedOnly(http.HandlerFunc(eventHandler.GetManageableEvents)))
+	mux.Handle("GET /events/{slug}/attendees", verifiedOnly(http.HandlerFunc(eventHandler.GetEventAttendees)))
+	mux.Handle("GET /events/{slug}/unpaid-registrants", verifiedOnly(http.HandlerFunc(eventHandler.GetUnpaidRegistrants)))
+	mux.Handle("GET /events/{slug}/registration-email/preview", verifiedOnly(http.HandlerFunc(eventHandler.PreviewRegistrationEmail)))
+	mux.Handle("GET /events/{slug}/badge", verifiedOnly(http.HandlerFunc(eventHandler.GetUserBadge)))
+	mux.Handle("GET /events/{slug}/badge/{user_id}", verifiedOnly(http.HandlerFunc(eventHandler.GetRegistrantBadge)))
+	mux.Handle("GET /events/{slug}/attendance/manifest", verifiedOnly(http.HandlerFunc(eventHandler.GetAttendanceManifest)))
+	mux.Handle("GET /events/{slug}/attendances.csv", verifiedOnly(http.HandlerFunc(eventHandler.ExportAttendances)))
+	mux.Handle("GET /events/{slug}/validate", verifiedOnly(http.HandlerFunc(eventHandler.ValidateEvent)))
+	mux.Handle("GET /events/{slug}/occupancy", verifiedOnly(http.HandlerFunc(eventHandler.GetEventOccupancy)))
+	mux.Handle("GET /events/{slug}/no-show-rates", verifiedOnly(http.HandlerFunc(eventHandler.GetNoShowRates)))
+	mux.Handle("GET /events/{slug}/report-bundle", verifiedOnly(http.HandlerFunc(reportHandler.GetReportBundle)))
+	mux.Handle("GET /events/{slug}/funnel", verifiedOnly(http.HandlerFunc(eventHandler.GetEventFunnel)))
+	mux.Handle("GET /events/{slug}/cancellation-reasons", verifiedOnly(http.HandlerFunc(eventHandler.GetCancellationReasons)))
+	mux.Handle("GET /events/{slug}/registration-status", verifiedOnly(http.HandlerFunc(eventHandler.GetRegistrationStatus)))
+	mux.Handle("POST /events/{slug}/scan", verifiedOnly(http.HandlerFunc(eventHandler.ScanAttendee)))
+	mux.Handle("GET /events/{slug}/registration-details", verifiedOnly(http.HandlerFunc(eventHandler.GetRegistrationDetails)))
+	mux.Handle("PATCH /events/{slug}/registration-details", verifiedOnly(http.HandlerFunc(eventHandler.UpdateRegistrationDetails)))
+	mux.Handle("GET /events/{slug}/registration-details/aggregate", verifiedOnly(http.HandlerFunc(eventHandler.GetRegistrationDetailsAggregate)))
+	mux.Handle("GET /events/{slug}/announcements", verifiedOnly(http.HandlerFunc(eventHandler.GetAnnouncements)))
+	mux.Handle("POST /events/{slug}/announcements", verifiedOnly(http.HandlerFunc(eventHandler.CreateAnnouncement)))
+	mux.Handle("DELETE /events/{slug}/announcements/{id}", verifiedOnly(http.HandlerFunc(eventHandler.DeleteAnnouncement)))
+	mux.Handle("GET /events/{slug}/my-summary", verifiedOnly(http.HandlerFunc(eventHandler.GetParticipationSummary)))
+	mux.Handle("GET /events/{slug}/my-timeline", verifiedOnly(http.HandlerFunc(eventHandler.GetUserTimeline)))
+	mux.Handle("POST /events/{slug}/certificate", verifiedOnly(http.HandlerFunc(eventHandler.IssueCertificate)))
+	mux.HandleFunc("GET /certificates/verify/{code}", eventHandler.VerifyCertificate)
 	mux.Handle("GET /user-accesses", verifiedOnly(http.HandlerFunc(activityHandler.GetUserAccesses)))
 	mux.Handle("GET /events/{slug}/accesses", verifiedOnly(http.HandlerFunc(activityHandler.GetUserAccessesFromEvent)))
 	mux.Handle("POST /events", verifiedOnly(http.HandlerFunc(eventHandler.CreateEvent)))
@@ -90,34 +150,99 @@ func InitializeMux(database *gorm.DB, cfg *config.Config) http.Handler {
 
 	// Event Activity routes accessed by event slug
 	mux.HandleFunc("GET /events/{slug}/activities", activityHandler.GetAllActivitiesFromEvent)
+	mux.HandleFunc("GET /events/{slug}/activity-types", activityHandler.GetActivityTypeCounts)
 	mux.Handle("GET /user-activities", verifiedOnly(http.HandlerFunc(activityHandler.GetUserActivities)))
+	mux.Handle("GET /user-waitlists", verifiedOnly(http.HandlerFunc(activityHandler.GetUserWaitlists)))
 	mux.Handle("GET /user-attended-activities", verifiedOnly(http.HandlerFunc(activityHandler.GetUserAttendedActivities)))
 	mux.Handle("GET /events/{slug}/user-activities", verifiedOnly(http.HandlerFunc(activityHandler.GetUserActivitiesFromEvent)))
 	mux.Handle("POST /events/{slug}/activity", verifiedOnly(http.HandlerFunc(activityHandler.CreateEventActivity)))
 	mux.Handle("PATCH /events/{slug}/activity", verifiedOnly(http.HandlerFunc(activityHandler.UpdateEventActivity)))
 	mux.Handle("DELETE /events/{slug}/activity", verifiedOnly(http.HandlerFunc(activityHandler.DeleteEventActivity)))
+	mux.Handle("DELETE /events/{slug}/activities/hidden", verifiedOnly(http.HandlerFunc(activityHandler.DeleteHiddenActivities)))
+	mux.Handle("GET /events/{slug}/activities/capacity", verifiedOnly(http.HandlerFunc(activityHandler.GetActivitiesCapacity)))
+	mux.Handle("GET /events/{slug}/coffee/live", verifiedOnly(http.HandlerFunc(activityHandler.GetCoffeeBreaksLive)))
+	mux.Handle("GET /events/{slug}/activities/fee-required", verifiedOnly(http.HandlerFunc(activityHandler.GetFeeActivities)))
+	mux.Handle("GET /events/{slug}/activities/eligible", verifiedOnly(http.HandlerFunc(activityHandler.GetEligibleActivities)))
+	mux.Handle("GET /events/{slug}/token-redeemable-activities", verifiedOnly(http.HandlerFunc(activityHandler.GetTokenRedeemableActivities)))
+	mux.Handle("GET /events/{slug}/activity-revenue", verifiedOnly(http.HandlerFunc(activityHandler.GetActivityRevenue)))
+	mux.Handle("POST /events/{slug}/activities/reorder", verifiedOnly(http.HandlerFunc(activityHandler.ReorderEventActivities)))
+	mux.Handle("POST /events/{slug}/activities/check-slot", verifiedOnly(http.HandlerFunc(activityHandler.CheckActivitySlot)))
 	mux.Handle("POST /events/{slug}/activity/register", verifiedOnly(http.HandlerFunc(activityHandler.RegisterUserToActivity)))
+	mux.Handle("POST /events/{slug}/activities/register-batch", verifiedOnly(http.HandlerFunc(activityHandler.RegisterUserToActivities)))
 	mux.Handle("POST /events/{slug}/activity/unregister", verifiedOnly(http.HandlerFunc(activityHandler.UnregisterUserFromActivity)))
+	mux.Handle("POST /events/{slug}/activity/waitlist", verifiedOnly(http.HandlerFunc(activityHandler.JoinActivityWaitlist)))
+	mux.Handle("POST /events/{slug}/activity/waitlist/leave", verifiedOnly(http.HandlerFunc(activityHandler.LeaveActivityWaitlist)))
+	mux.Handle("POST /events/{slug}/activity/confirm-waitlist/{id}", verifiedOnly(http.HandlerFunc(activityHandler.ConfirmWaitlistPromotion)))
+	// {view} only accepts "conflicts": a literal segment after {id} would overlap the GET /activity/<name>/{id} routes and make the mux panic
+	mux.Handle("GET /events/{slug}/activity/{id}/{view}", verifiedOnly(http.HandlerFunc(activityHandler.GetActivityConflicts)))
+	mux.Handle("GET /events/{slug}/speaker-conflicts", verifiedOnly(http.HandlerFunc(activityHandler.GetSpeakerConflicts)))
+	mux.Handle("GET /events/{slug}/room-conflicts", verifiedOnly(http.HandlerFunc(activityHandler.GetRoomConflicts)))
+	mux.Handle("POST /events/{slug}/suggest-rooms", verifiedOnly(http.HandlerFunc(activityHandler.SuggestRooms)))
 	mux.Handle("GET /events/{slug}/activity/registrations/{id}", verifiedOnly(http.HandlerFunc(activityHandler.GetActivityRegistrations)))
 	mux.Handle("POST /events/{slug}/activity/attend", verifiedOnly(http.HandlerFunc(activityHandler.AttendActivity)))     // Only for admins to mark attendance
 	mux.Handle("POST /events/{slug}/activity/unattend", verifiedOnly(http.HandlerFunc(activityHandler.UnattendActivity))) // Only for master admins and above to mark unattendance
+	mux.Handle("POST /events/{slug}/activity/attend-qr", verifiedOnly(http.HandlerFunc(activityHandler.AttendActivityQR)))
+	mux.Handle("POST /events/{slug}/activity/attend-batch", verifiedOnly(http.HandlerFunc(activityHandler.AttendActivityBatch)))
+	mux.Handle("POST /events/{slug}/activity/attend-current", verifiedOnly(http.HandlerFunc(activityHandler.AttendCurrentActivity)))
+	mux.Handle("POST /events/{slug}/activity/self-attend/{id}", verifiedOnly(http.HandlerFunc(activityHandler.SelfAttendActivity)))
+	mux.Handle("POST /events/{slug}/activity/share-contact", verifiedOnly(http.HandlerFunc(activityHandler.SetContactSharing)))
+	mux.Handle("GET /events/{slug}/activity/speaker-roster/{id}", verifiedOnly(http.HandlerFunc(activityHandler.GetSpeakerRoster)))
+	mux.Handle("GET /events/{slug}/activity/certificate/{id}", verifiedOnly(http.HandlerFunc(activityHandler.GetActivityCertificate)))
 	mux.Handle("GET /events/{slug}/activity/attendants/{id}", verifiedOnly(http.HandlerFunc(activityHandler.GetActivityAttendants)))
+	mux.Handle("GET /events/{slug}/activity/demand/{id}", verifiedOnly(http.HandlerFunc(activityHandler.GetActivityDemand)))
+	mux.Handle("GET /events/{slug}/activity/checkin-trend/{id}", verifiedOnly(http.HandlerFunc(activityHandler.GetCheckinTrend)))
+	mux.Handle("GET /events/{slug}/activity/capacity-history/{id}", verifiedOnly(http.HandlerFunc(activityHandler.GetCapacityHistory)))
+	mux.Handle("POST /events/{slug}/activity/finalize-attendance/{id}", verifiedOnly(http.HandlerFunc(activityHandler.FinalizeActivityAttendance)))
+	mux.Handle("POST /events/{slug}/activity/backfill-mandatory/{id}", verifiedOnly(http.HandlerFunc(activityHandler.BackfillMandatoryActivity)))
 
 	// Event Product routes accessed by event slug
 	mux.Handle("POST /events/{slug}/product", verifiedOnly(http.HandlerFunc(productHandler.CreateEventProduct)))
 	mux.Handle("PATCH /events/{slug}/product", verifiedOnly(http.HandlerFunc(productHandler.UpdateEventProduct)))
 	mux.Handle("DELETE /events/{slug}/product", verifiedOnly(http.HandlerFunc(productHandler.DeleteEventProduct)))
 	mux.Handle("GET /events/{slug}/products", authMiddleware(http.HandlerFunc(productHandler.GetAllProductsFromEvent)))
-	mux.Handle("POST /events/{slug}/purchase", verifiedOnly(http.HandlerFunc(productHandler.PurchaseProducts)))
+	mux.Handle("GET /events/{slug}/products/expiring", verifiedOnly(http.HandlerFunc(productHandler.GetExpiringProducts)))
+	mux.Handle("GET /events/{slug}/gifting-stats", verifiedOnly(http.HandlerFunc(productHandler.GetGiftingStats)))
+	mux.Handle("POST /events/{slug}/products/extend-expiry", verifiedOnly(http.HandlerFunc(productHandler.ExtendProductsExpiry)))
+	mux.Handle("POST /events/{slug}/products/block-all", verifiedOnly(http.HandlerFunc(productHandler.BlockAllProducts)))
+	mux.Handle("POST /events/{slug}/products/unblock-all", verifiedOnly(http.HandlerFunc(productHandler.UnblockAllProducts)))
+	mux.Handle("GET /events/{slug}/products/access-targets/orphans", verifiedOnly(http.HandlerFunc(productHandler.GetOrphanedAccessTargets)))
+	mux.Handle("DELETE /events/{slug}/products/access-targets/orphans", verifiedOnly(http.HandlerFunc(productHandler.CleanupOrphanedAccessTargets)))
+	mux.Handle("GET /events/{slug}/products/{id}/price", authMiddleware(http.HandlerFunc(productHandler.GetProductPrice)))
+	mux.Handle("GET /events/{slug}/products/{id}/auto-registrations", verifiedOnly(http.HandlerFunc(productHandler.GetProductAutoRegistrations)))
+	mux.Handle("GET /events/{slug}/products/{id}/delete-impact", verifiedOnly(http.HandlerFunc(productHandler.GetProductDeleteImpact)))
+	mux.Handle("POST /events/{slug}/products/{id}/grants", verifiedOnly(http.HandlerFunc(productHandler.GrantProductAccess)))
+	mux.Handle("GET /events/{slug}/products/{id}/grants", verifiedOnly(http.HandlerFunc(productHandler.GetProductAccessGrants)))
+	mux.Handle("DELETE /events/{slug}/products/{id}/grants/{user_id}", verifiedOnly(http.HandlerFunc(productHandler.RevokeProductAccess)))
+	mux.Handle("POST /events/{slug}/coupons", verifiedOnly(http.HandlerFunc(productHandler.CreateCoupon)))
+	mux.Handle("GET /events/{slug}/coupons", verifiedOnly(http.HandlerFunc(productHandler.GetEventCoupons)))
+	mux.Handle("DELETE /events/{slug}/coupons/{id}", verifiedOnly(http.HandlerFunc(productHandler.DeleteCoupon)))
+	mux.Handle("POST /events/{slug}/purchase", purchaseLimited(http.HandlerFunc(productHandler.PurchaseProducts)))
+	mux.Handle("POST /events/{slug}/purchase-cart", purchaseLimited(http.HandlerFunc(productHandler.PurchaseCart)))
+	mux.Handle("POST /events/{slug}/validate-purchase", verifiedOnly(http.HandlerFunc(productHandler.ValidatePurchase)))
 	mux.Handle("GET /user-products-relation", verifiedOnly(http.HandlerFunc(productHandler.GetUserProductsRelation)))
 	mux.HandleFunc("GET /all-user-products-relation", productHandler.GetAllUserProductsRelation)
 	mux.Handle("GET /user-products", verifiedOnly(http.HandlerFunc(productHandler.GetUserProducts)))
 	mux.Handle("GET /user-tokens", verifiedOnly(http.HandlerFunc(productHandler.GetUserTokens)))
 	mux.Handle("GET /user-purchases", verifiedOnly(http.HandlerFunc(productHandler.GetUserPurchases)))
+	mux.Handle("GET /me/spend", verifiedOnly(http.HandlerFunc(productHandler.GetUserSpend)))
+	mux.Handle("GET /me/pending-access", verifiedOnly(http.HandlerFunc(productHandler.GetUserPendingAccess)))
 	mux.Handle("POST /can-gift", verifiedOnly(http.HandlerFunc(productHandler.CanGift)))
+	mux.Handle("POST /transfer-product", verifiedOnly(http.HandlerFunc(productHandler.TransferProduct)))
+	mux.Handle("POST /user-gifts/{id}/resend-notification", verifiedOnly(http.HandlerFunc(productHandler.ResendGiftNotification)))
+	mux.Handle("POST /events/{slug}/refund", verifiedOnly(http.HandlerFunc(productHandler.RefundPurchase)))
+	mux.Handle("GET /events/{slug}/purchases/export", verifiedOnly(http.HandlerFunc(productHandler.ExportEventPurchases)))
+	mux.Handle("POST /events/{slug}/cancel-and-refund", verifiedOnly(http.HandlerFunc(productHandler.CancelAndRefundEvent)))
+	mux.Handle("GET /events/{slug}/cancellation", verifiedOnly(http.HandlerFunc(productHandler.GetEventCancellation)))
+	mux.Handle("POST /events/{slug}/deliveries/batch", verifiedOnly(http.HandlerFunc(productHandler.MarkDeliveredBatch)))
+	mux.Handle("POST /events/{slug}/deliveries/{id}", verifiedOnly(http.HandlerFunc(productHandler.MarkDelivered)))
+	mux.Handle("GET /events/{slug}/pending-deliveries", verifiedOnly(http.HandlerFunc(productHandler.GetPendingDeliveries)))
 
 	// Payment Only Route
-	mux.Handle("POST /events/{slug}/forced-pix", verifiedOnly(http.HandlerFunc(productHandler.ForcedPix)))
+	mux.Handle("POST /events/{slug}/forced-pix", purchaseLimited(http.HandlerFunc(productHandler.ForcedPix)))
+	mux.Handle("GET /events/{slug}/pix-purchase/{id}/status", verifiedOnly(http.HandlerFunc(productHandler.GetPixPurchaseStatus)))
+	mux.Handle("DELETE /pix-purchases/{id}", verifiedOnly(http.HandlerFunc(productHandler.CancelPixPurchase)))
+	mux.Handle("GET /events/{slug}/tokens", verifiedOnly(http.HandlerFunc(productHandler.GetEventTokens)))
+	mux.Handle("POST /admin/reconcile-payments", verifiedOnly(http.HandlerFunc(productHandler.ReconcilePayments)))
 
 	// Webhook routes
 	mux.HandleFunc("POST /webhook/mp", productHandler.MPWebhook)
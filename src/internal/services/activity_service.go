@@ -1,12 +1,27 @@
 package services
 
 import (
+	"bytes"
+	"context"
+	"encoding/json"
 	"errors"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"os"
+	"path/filepath"
+	"scti/config"
 	"scti/internal/models"
 	repos "scti/internal/repositories"
+	"scti/internal/utilities"
+	"sort"
+	"strings"
+	"text/template"
 	"time"
 
 	"github.com/google/uuid"
+	"gopkg.in/mail.v2"
 	"gorm.io/gorm"
 )
 
@@ -20,29 +35,35 @@ func NewActivityService(activityRepo *repos.ActivityRepo) *ActivityService {
 	}
 }
 
-func (s *ActivityService) CreateEventActivity(user models.User, eventSlug string, req models.CreateActivityRequest) (*models.Activity, error) {
+// CreateEventActivity creates the activity and returns the speaker double-bookings it causes,
+// which only fail the creation when req.RejectSpeakerConflicts is set
+func (s *ActivityService) CreateEventActivity(user models.User, eventSlug string, req models.CreateActivityRequest) (*models.Activity, []models.SpeakerConflict, error) {
 	event, err := s.ActivityRepo.GetEventBySlug(eventSlug)
 	if err != nil {
-		return nil, errors.New("event not found: " + err.Error())
+		return nil, nil, errors.New("event not found: " + err.Error())
 	}
 
 	if event.CreatedBy != user.ID && !user.IsSuperUser {
 		isMasterAdmin, err := s.ActivityRepo.GetUserAdminStatusBySlug(user.ID, eventSlug)
 		if err != nil || isMasterAdmin.AdminType != models.AdminTypeMaster {
-			return nil, errors.New("unauthorized to create activities for this event")
+			return nil, nil, errors.New("unauthorized to create activities for this event")
 		}
 	}
 
 	if req.EndTime.Before(req.StartTime) {
-		return nil, errors.New("activity end time cannot be before start time")
+		return nil, nil, errors.New("activity end time cannot be before start time")
 	}
 
 	if req.StartTime.Before(event.StartDate) || req.EndTime.After(event.EndDate) {
-		return nil, errors.New("activity must be scheduled within event timeframe")
+		return nil, nil, errors.New("activity must be scheduled within event timeframe")
 	}
 
 	if req.Level != models.ActivityNone && req.Level != models.ActivityEasy && req.Level != models.ActivityMedium && req.Level != models.ActivityHard {
-		return nil, errors.New("activity must have valid level (\"none\", \"easy\", \"medium\", \"hard\")")
+		return nil, nil, errors.New("activity must have valid level (\"none\", \"easy\", \"medium\", \"hard\")")
+	}
+
+	if req.CheckInMethod != "" && !validCheckInMethod(req.CheckInMethod) {
+		return nil, nil, errors.New("activity must have valid check-in method (\"admin_qr\", \"manual\", \"self_service\")")
 	}
 
 	activity := models.Activity{
@@ -63,22 +84,44 @@ func (s *ActivityService) CreateEventActivity(user models.User, eventSlug string
 		IsBlocked:            req.IsBlocked,
 		Level:                req.Level,
 		Requirements:         req.Requirements,
+		RequirementItems:     req.RequirementItems,
+		CheckInMethod:        models.CheckInAdminQR,
+	}
+	if req.CheckInMethod != "" {
+		activity.CheckInMethod = req.CheckInMethod
+	}
+	if req.SpeakerUserID != nil && *req.SpeakerUserID != "" {
+		if _, err := s.ActivityRepo.GetUserByID(*req.SpeakerUserID); err != nil {
+			return nil, nil, errors.New("speaker user not found: " + err.Error())
+		}
+		activity.SpeakerUserID = req.SpeakerUserID
+	}
+
+	conflicts, err := s.checkSpeakerConflicts(activity, req.RejectSpeakerConflicts)
+	if err != nil {
+		return nil, nil, err
 	}
 
 	if err := s.ActivityRepo.CreateActivity(&activity); err != nil {
-		return nil, errors.New("failed to create activity: " + err.Error())
+		return nil, nil, errors.New("failed to create activity: " + err.Error())
 	}
 
-	return &activity, nil
+	return &activity, conflicts, nil
 }
 
-func (s *ActivityService) GetAllActivitiesFromEvent(eventSlug string) ([]models.ActivityWithSlotsDTO, error) {
+// GetAllActivitiesFromEvent returns the visible activities of the event with their slots, an empty filter returns all of them
+func (s *ActivityService) GetAllActivitiesFromEvent(eventSlug string, filter models.ActivityFilter) ([]models.ActivityWithSlotsDTO, error) {
 	event, err := s.ActivityRepo.GetEventBySlug(eventSlug)
 	if err != nil {
 		return nil, errors.New("event not found: " + err.Error())
 	}
 
-	activities, err := s.ActivityRepo.GetAllActivitiesFromEvent(event.ID)
+	var activities []models.Activity
+	if filter.IsEmpty() {
+		activities, err = s.ActivityRepo.GetAllActivitiesFromEvent(event.ID)
+	} else {
+		activities, err = s.ActivityRepo.GetActivitiesFiltered(event.ID, filter)
+	}
 	if err != nil {
 		return nil, errors.New("failed to get activities: " + err.Error())
 	}
@@ -134,38 +177,50 @@ func (s *ActivityService) AddSlotsInfoToActivities(activities []models.Activity)
 	return activitiesWithSlots, nil
 }
 
-func (s *ActivityService) UpdateEventActivity(user models.User, eventSlug string, activityID string, req models.ActivityUpdateRequest) (*models.Activity, error) {
+// UpdateEventActivity works like CreateEventActivity regarding speaker double-bookings
+func (s *ActivityService) UpdateEventActivity(user models.User, eventSlug string, activityID string, req models.ActivityUpdateRequest) (*models.Activity, []models.SpeakerConflict, int, error) {
 	event, err := s.ActivityRepo.GetEventBySlug(eventSlug)
 	if err != nil {
-		return nil, errors.New("event not found: " + err.Error())
+		return nil, nil, 0, errors.New("event not found: " + err.Error())
 	}
 
 	activity, err := s.ActivityRepo.GetActivityByID(activityID)
 	if err != nil {
-		return nil, errors.New("activity not found: " + err.Error())
+		return nil, nil, 0, errors.New("activity not found: " + err.Error())
 	}
 
 	if activity.EventID != event.ID {
-		return nil, errors.New("activity does not belong to this event")
+		return nil, nil, 0, errors.New("activity does not belong to this event")
 	}
 
 	if event.CreatedBy != user.ID && !user.IsSuperUser {
 		isMasterAdmin, err := s.ActivityRepo.GetUserAdminStatusBySlug(user.ID, eventSlug)
 		if err != nil || isMasterAdmin.AdminType != models.AdminTypeMaster {
-			return nil, errors.New("unauthorized to update activities for this event")
+			return nil, nil, 0, errors.New("unauthorized to update activities for this event")
 		}
 	}
 
 	if req.EndTime.Before(req.StartTime) {
-		return nil, errors.New("activity end time cannot be before start time")
+		return nil, nil, 0, errors.New("activity end time cannot be before start time")
 	}
 
 	if req.StartTime.Before(event.StartDate) || req.EndTime.After(event.EndDate) {
-		return nil, errors.New("activity must be scheduled within event timeframe")
+		return nil, nil, 0, errors.New("activity must be scheduled within event timeframe")
 	}
 
 	if req.Level != models.ActivityNone && req.Level != models.ActivityEasy && req.Level != models.ActivityMedium && req.Level != models.ActivityHard {
-		return nil, errors.New("activity must have valid level (\"none\", \"easy\", \"medium\", \"hard\")")
+		return nil, nil, 0, errors.New("activity must have valid level (\"none\", \"easy\", \"medium\", \"hard\")")
+	}
+
+	if req.CheckInMethod != "" && !validCheckInMethod(req.CheckInMethod) {
+		return nil, nil, 0, errors.New("activity must have valid check-in method (\"admin_qr\", \"manual\", \"self_service\")")
+	}
+
+	capacityChange := models.CapacityChangeDetails{
+		OldMaxCapacity: activity.MaxCapacity,
+		NewMaxCapacity: req.MaxCapacity,
+		OldUnlimited:   activity.HasUnlimitedCapacity,
+		NewUnlimited:   req.HasUnlimitedCapacity,
 	}
 
 	activity.Name = req.Name
@@ -183,12 +238,117 @@ func (s *ActivityService) UpdateEventActivity(user models.User, eventSlug string
 	activity.IsBlocked = req.IsBlocked
 	activity.Level = req.Level
 	activity.Requirements = req.Requirements
+	activity.RequirementItems = req.RequirementItems
+	if req.CheckInMethod != "" {
+		activity.CheckInMethod = req.CheckInMethod
+	}
+	if req.SpeakerUserID != nil {
+		if *req.SpeakerUserID == "" {
+			activity.SpeakerUserID = nil
+		} else {
+			if _, err := s.ActivityRepo.GetUserByID(*req.SpeakerUserID); err != nil {
+				return nil, nil, 0, errors.New("speaker user not found: " + err.Error())
+			}
+			activity.SpeakerUserID = req.SpeakerUserID
+		}
+	}
 
-	if err := s.ActivityRepo.UpdateActivity(activity); err != nil {
-		return nil, errors.New("failed to update activity: " + err.Error())
+	conflicts, err := s.checkSpeakerConflicts(*activity, req.RejectSpeakerConflicts)
+	if err != nil {
+		return nil, nil, 0, err
 	}
 
-	return activity, nil
+	if capacityChange.OldMaxCapacity == capacityChange.NewMaxCapacity && capacityChange.OldUnlimited == capacityChange.NewUnlimited {
+		if err := s.ActivityRepo.UpdateActivity(activity); err != nil {
+			return nil, nil, 0, errors.New("failed to update activity: " + err.Error())
+		}
+		return activity, conflicts, 0, nil
+	}
+
+	audit, err := s.capacityChangeAudit(user, activity, capacityChange)
+	if err != nil {
+		return nil, nil, 0, err
+	}
+	if err := s.ActivityRepo.UpdateActivityWithAudit(activity, audit); err != nil {
+		return nil, nil, 0, errors.New("failed to update activity: " + err.Error())
+	}
+
+	// New seats go to the users already waiting before anyone else can take them
+	promoted := 0
+	if capacityChange.NewUnlimited && !capacityChange.OldUnlimited ||
+		!capacityChange.NewUnlimited && !capacityChange.OldUnlimited && capacityChange.NewMaxCapacity > capacityChange.OldMaxCapacity {
+		promoted = s.promoteFromWaitlist(activity)
+	}
+
+	return activity, conflicts, promoted, nil
+}
+
+// capacityChangeAudit builds the audit entry of a capacity edit with the registrations at that moment
+func (s *ActivityService) capacityChangeAudit(user models.User, activity *models.Activity, change models.CapacityChangeDetails) (*models.AuditLog, error) {
+	registered, _, err := s.ActivityRepo.GetActivityCapacity(activity.ID)
+	if err != nil {
+		return nil, errors.New("failed to count activity registrations: " + err.Error())
+	}
+	change.Registered = registered
+
+	details, err := json.Marshal(change)
+	if err != nil {
+		return nil, errors.New("failed to encode capacity change: " + err.Error())
+	}
+
+	return &models.AuditLog{
+		ID:       uuid.New().String(),
+		EventID:  &activity.EventID,
+		ActorID:  user.ID,
+		Action:   models.AuditActivityCapacityChanged,
+		TargetID: &activity.ID,
+		Details:  string(details),
+	}, nil
+}
+
+// GetCapacityHistory lists the capacity edits of an activity, oldest first
+func (s *ActivityService) GetCapacityHistory(admin models.User, eventSlug, activityID string) ([]models.CapacityChange, error) {
+	event, err := s.ActivityRepo.GetEventBySlug(eventSlug)
+	if err != nil {
+		return nil, errors.New("event not found: " + err.Error())
+	}
+
+	if !admin.IsSuperUser && event.CreatedBy != admin.ID {
+		adminStatus, err := s.ActivityRepo.GetUserAdminStatusBySlug(admin.ID, eventSlug)
+		if err != nil || (adminStatus.AdminType != models.AdminTypeMaster && adminStatus.AdminType != models.AdminTypeNormal) {
+			return nil, errors.New("unauthorized: only admins can see the capacity history")
+		}
+	}
+
+	activity, err := s.ActivityRepo.GetActivityByID(activityID)
+	if err != nil {
+		return nil, errors.New("activity not found: " + err.Error())
+	}
+	if activity.EventID != event.ID {
+		return nil, errors.New("activity does not belong to this event")
+	}
+
+	entries, err := s.ActivityRepo.GetActivityAuditEntries(activity.ID, models.AuditActivityCapacityChanged)
+	if err != nil {
+		return nil, errors.New("failed to get capacity history: " + err.Error())
+	}
+
+	history := make([]models.CapacityChange, 0, len(entries))
+	for _, entry := range entries {
+		change := models.CapacityChange{
+			ID:         entry.ID,
+			ActorID:    entry.ActorID,
+			ActorName:  entry.ActorName,
+			ActorEmail: entry.ActorEmail,
+			ChangedAt:  entry.CreatedAt,
+		}
+		if err := json.Unmarshal([]byte(entry.Details), &change.CapacityChangeDetails); err != nil {
+			return nil, errors.New("failed to decode capacity change " + entry.ID + ": " + err.Error())
+		}
+		history = append(history, change)
+	}
+
+	return history, nil
 }
 
 func (s *ActivityService) DeleteEventActivity(user models.User, eventSlug string, activityID string) error {
@@ -233,210 +393,202 @@ func (s *ActivityService) DeleteEventActivity(user models.User, eventSlug string
 	return nil
 }
 
-func (s *ActivityService) RegisterUserToActivity(user models.User, eventSlug string, activityID string) error {
+// DeleteHiddenActivities purges the hidden activities organizers left behind while drafting the agenda,
+// keeping the rule that activities with registrations are never deleted
+func (s *ActivityService) DeleteHiddenActivities(user models.User, eventSlug string) (models.HiddenActivitiesPurgeResult, error) {
 	event, err := s.ActivityRepo.GetEventBySlug(eventSlug)
 	if err != nil {
-		return errors.New("event not found: " + err.Error())
-	}
-
-	activity, err := s.ActivityRepo.GetActivityByID(activityID)
-	if err != nil {
-		return errors.New("activity not found: " + err.Error())
+		return models.HiddenActivitiesPurgeResult{}, errors.New("event not found: " + err.Error())
 	}
 
-	if activity.IsBlocked {
-		return errors.New("activity is currently blocked")
+	if event.CreatedBy != user.ID && !user.IsSuperUser {
+		isMasterAdmin, err := s.ActivityRepo.GetUserAdminStatusBySlug(user.ID, eventSlug)
+		if err != nil || isMasterAdmin.AdminType != models.AdminTypeMaster {
+			return models.HiddenActivitiesPurgeResult{}, errors.New("unauthorized to delete activities for this event")
+		}
 	}
 
-	if activity.EventID != event.ID {
-		return errors.New("activity does not belong to this event")
+	result, err := s.ActivityRepo.DeleteHiddenActivities(event.ID)
+	if err != nil {
+		return models.HiddenActivitiesPurgeResult{}, errors.New("failed to delete hidden activities: " + err.Error())
 	}
 
-	now := time.Now()
-	if activity.EndTime.Before(now) {
-		return errors.New("activity has already ended")
-	}
+	return result, nil
+}
 
-	isRegistered, err := s.ActivityRepo.IsUserRegisteredToEvent(user.ID, event.Slug)
+func (s *ActivityService) GetActivityTypeCounts(eventSlug string) ([]models.ActivityTypeCount, error) {
+	event, err := s.ActivityRepo.GetEventBySlug(eventSlug)
 	if err != nil {
-		return errors.New("error checking event registration: " + err.Error())
+		return nil, errors.New("event not found: " + err.Error())
 	}
 
-	if !isRegistered {
-		return errors.New("user must be registered to the event first")
+	counts, err := s.ActivityRepo.GetActivityTypeCounts(event.ID)
+	if err != nil {
+		return nil, errors.New("failed to get activity types: " + err.Error())
 	}
 
-	if !activity.HasUnlimitedCapacity {
-		currentRegistrations, maxCapacity, err := s.ActivityRepo.GetActivityCapacity(activityID)
-		if err != nil {
-			return errors.New("error checking activity capacity: " + err.Error())
-		}
-
-		if currentRegistrations >= maxCapacity {
-			return errors.New("activity has reached maximum capacity")
-		}
+	if counts == nil {
+		counts = []models.ActivityTypeCount{}
 	}
+	return counts, nil
+}
 
-	userActivities, err := s.GetUserActivities(user)
+func (s *ActivityService) GetActivitiesCapacity(admin models.User, eventSlug string) ([]models.ActivityCapacitySnapshot, error) {
+	event, err := s.ActivityRepo.GetEventBySlug(eventSlug)
 	if err != nil {
-		return errors.New("couldn't get user activities")
+		return nil, errors.New("event not found: " + err.Error())
 	}
-	for _, uAct := range userActivities {
-		if !(uAct.EndTime.Before(activity.StartTime) || uAct.StartTime.After(activity.EndTime)) && uAct.Type != models.ActivityPalestra {
-			return errors.New("user has another activity registered at the same time that is not palestra")
+
+	if !admin.IsSuperUser && event.CreatedBy != admin.ID {
+		adminStatus, err := s.ActivityRepo.GetUserAdminStatusBySlug(admin.ID, eventSlug)
+		if err != nil || (adminStatus.AdminType != models.AdminTypeMaster && adminStatus.AdminType != models.AdminTypeNormal) {
+			return nil, errors.New("unauthorized: only admins can see activities capacity")
 		}
 	}
 
-	userAccesses, err := s.ActivityRepo.GetUserAccesses(user.ID)
+	snapshots, err := s.ActivityRepo.GetActivitiesCapacitySnapshot(event.ID)
 	if err != nil {
-		return errors.New("error checking user accesses: " + err.Error())
+		return nil, errors.New("failed to get activities capacity: " + err.Error())
 	}
 
-	var hasAccess bool
-	for _, access := range userAccesses {
-		if access.TargetID == activityID {
-			hasAccess = true
-			break
+	for i := range snapshots {
+		if snapshots[i].HasUnlimitedCapacity {
+			snapshots[i].Max = 0
+			snapshots[i].Available = -1
+			continue
 		}
+		snapshots[i].Available = max(snapshots[i].Max-snapshots[i].Registered, 0)
 	}
 
-	if !hasAccess && activity.HasFee {
-		userTokens, err := s.ActivityRepo.GetUserTokens(user.ID)
-		if err != nil {
-			return errors.New("error checking user tokens: " + err.Error())
-		}
-
-		if len(userTokens) == 0 {
-			return errors.New("this activity requires a token or payment")
-		}
-
-		var useToken models.UserToken
-		var foundToken bool
-		for _, token := range userTokens {
-			if !token.IsUsed && token.EventID == event.ID {
-				useToken = token
-				foundToken = true
-				break
-			}
-		}
+	return snapshots, nil
+}
 
-		if !foundToken {
-			return errors.New("user does not have any available tokens")
-		}
+func (s *ActivityService) GetCoffeeBreaksLive(admin models.User, eventSlug string) ([]models.CoffeeBreakLive, error) {
+	event, err := s.ActivityRepo.GetEventBySlug(eventSlug)
+	if err != nil {
+		return nil, errors.New("event not found: " + err.Error())
+	}
 
-		useToken.IsUsed = true
-		now := time.Now()
-		useToken.UsedAt = &now
-		useToken.UsedForID = &activityID
-		if err := s.ActivityRepo.UpdateUserToken(useToken); err != nil {
-			return errors.New("error updating user token: " + err.Error())
+	if !admin.IsSuperUser && event.CreatedBy != admin.ID {
+		adminStatus, err := s.ActivityRepo.GetUserAdminStatusBySlug(admin.ID, eventSlug)
+		if err != nil || (adminStatus.AdminType != models.AdminTypeMaster && adminStatus.AdminType != models.AdminTypeNormal) {
+			return nil, errors.New("unauthorized: only admins can see the coffee breaks board")
 		}
 	}
 
-	registration := &models.ActivityRegistration{
-		ActivityID:   activityID,
-		UserID:       user.ID,
-		AccessMethod: string(models.AccessMethodEvent), // Registered through event registration
+	coffeeBreaks, err := s.ActivityRepo.GetCoffeeBreaksLive(event.ID)
+	if err != nil {
+		return nil, errors.New("failed to get coffee breaks: " + err.Error())
 	}
 
-	if err := s.ActivityRepo.RegisterUserToActivity(registration); err != nil {
-		return errors.New("failed to register to activity: " + err.Error())
+	now := time.Now()
+	for i := range coffeeBreaks {
+		if coffeeBreaks[i].HasUnlimitedCapacity {
+			coffeeBreaks[i].Max = 0
+		}
+		coffeeBreaks[i].IsActive = !now.Before(coffeeBreaks[i].StartTime) && !now.After(coffeeBreaks[i].EndTime)
 	}
 
-	return nil
+	return coffeeBreaks, nil
 }
 
-func (s *ActivityService) UnregisterUserFromActivity(user models.User, eventSlug string, activityID string) error {
+// GetFeeActivities lists the fee activities of the event and what unlocks them,
+// flagging the ones nobody can currently pay for
+func (s *ActivityService) GetFeeActivities(admin models.User, eventSlug string) ([]models.FeeActivityAccess, error) {
 	event, err := s.ActivityRepo.GetEventBySlug(eventSlug)
 	if err != nil {
-		return errors.New("event not found: " + err.Error())
-	}
-
-	activity, err := s.ActivityRepo.GetActivityByID(activityID)
-	if err != nil {
-		return errors.New("activity not found: " + err.Error())
-	}
-
-	if activity.IsBlocked {
-		return errors.New("activity is currently blocked")
+		return nil, errors.New("event not found: " + err.Error())
 	}
 
-	if activity.EventID != event.ID {
-		return errors.New("activity does not belong to this event")
+	if !admin.IsSuperUser && event.CreatedBy != admin.ID {
+		adminStatus, err := s.ActivityRepo.GetUserAdminStatusBySlug(admin.ID, eventSlug)
+		if err != nil || (adminStatus.AdminType != models.AdminTypeMaster && adminStatus.AdminType != models.AdminTypeNormal) {
+			return nil, errors.New("unauthorized: only admins can see fee activities")
+		}
 	}
 
-	isRegistered, registration, err := s.ActivityRepo.IsUserRegisteredToActivity(activityID, user.ID)
+	activities, err := s.ActivityRepo.GetFeeActivitiesFromEvent(event.ID)
 	if err != nil {
-		return errors.New("error checking activity registration: " + err.Error())
+		return nil, errors.New("failed to get fee activities: " + err.Error())
 	}
 
-	if !isRegistered {
-		return errors.New("user is not registered to this activity")
+	result := make([]models.FeeActivityAccess, 0, len(activities))
+	if len(activities) == 0 {
+		return result, nil
 	}
 
-	if registration.AttendedAt != nil {
-		return errors.New("user has already attended this activity")
+	activityIDs := make([]string, len(activities))
+	for i, activity := range activities {
+		activityIDs[i] = activity.ID
 	}
 
-	userAccesses, err := s.ActivityRepo.GetUserAccesses(user.ID)
+	targets, err := s.ActivityRepo.GetPurchasableAccessTargets(activityIDs)
 	if err != nil {
-		return errors.New("error checking user accesses: " + err.Error())
+		return nil, errors.New("failed to get access targets: " + err.Error())
 	}
 
-	var hasAccess bool
-	for _, access := range userAccesses {
-		if access.TargetID == activityID {
-			hasAccess = true
-			break
-		}
+	productsByActivity := make(map[string][]string)
+	for _, target := range targets {
+		productsByActivity[target.TargetID] = append(productsByActivity[target.TargetID], target.ProductID)
 	}
 
-	if hasAccess {
-		return errors.New("user has direct paid access to this activity")
+	tokenPurchasable, err := s.ActivityRepo.HasPurchasableActivityTokens(event.ID)
+	if err != nil {
+		return nil, errors.New("failed to check activity tokens: " + err.Error())
 	}
 
-	if activity.HasFee {
-		userTokens, err := s.ActivityRepo.GetUserTokens(user.ID)
-		if err != nil {
-			return errors.New("error checking user tokens: " + err.Error())
+	for _, activity := range activities {
+		productIDs := productsByActivity[activity.ID]
+		if productIDs == nil {
+			productIDs = []string{}
 		}
+		result = append(result, models.FeeActivityAccess{
+			ActivityID:       activity.ID,
+			Name:             activity.Name,
+			StartTime:        activity.StartTime,
+			IsHidden:         activity.IsHidden,
+			ProductIDs:       productIDs,
+			TokenPurchasable: tokenPurchasable,
+			IsOrphaned:       len(productIDs) == 0 && !tokenPurchasable,
+		})
+	}
+
+	return result, nil
+}
 
-		if len(userTokens) == 0 {
-			return errors.New("this activity requires a token or payment")
-		}
+func (s *ActivityService) ReorderEventActivities(user models.User, eventSlug string, req models.ActivityReorderRequest) error {
+	event, err := s.ActivityRepo.GetEventBySlug(eventSlug)
+	if err != nil {
+		return errors.New("event not found: " + err.Error())
+	}
 
-		var cleanToken models.UserToken
-		var foundToken bool
-		for _, token := range userTokens {
-			if token.IsUsed {
-				if *token.UsedForID == activityID {
-					cleanToken = token
-					foundToken = true
-					break
-				}
-			}
+	if event.CreatedBy != user.ID && !user.IsSuperUser {
+		isMasterAdmin, err := s.ActivityRepo.GetUserAdminStatusBySlug(user.ID, eventSlug)
+		if err != nil || isMasterAdmin.AdminType != models.AdminTypeMaster {
+			return errors.New("unauthorized to reorder activities for this event")
 		}
+	}
 
-		if !foundToken {
-			return errors.New("user does not have any available tokens")
-		}
+	if len(req.ActivityIDs) == 0 {
+		return errors.New("activity IDs are required")
+	}
 
-		cleanToken.IsUsed = false
-		cleanToken.UsedAt = nil
-		cleanToken.UsedForID = nil
-		if err := s.ActivityRepo.UpdateUserToken(cleanToken); err != nil {
-			return errors.New("error updating user token: " + err.Error())
+	seen := make(map[string]bool)
+	for _, activityID := range req.ActivityIDs {
+		if seen[activityID] {
+			return errors.New("activity " + activityID + " is repeated")
 		}
+		seen[activityID] = true
 	}
 
-	if err := s.ActivityRepo.UnregisterUserFromActivity(activityID, user.ID); err != nil {
-		return errors.New("failed to unregister from activity: " + err.Error())
+	if err := s.ActivityRepo.ReorderActivities(event.ID, req.ActivityIDs); err != nil {
+		return errors.New("failed to reorder activities: " + err.Error())
 	}
 
 	return nil
 }
 
-func (s *ActivityService) AttendActivity(admin models.User, eventSlug string, activityID string, userID string) error {
+func (s *ActivityService) RegisterUserToActivity(user models.User, eventSlug string, activityID string, acknowledgedRequirements bool) error {
 	event, err := s.ActivityRepo.GetEventBySlug(eventSlug)
 	if err != nil {
 		return errors.New("event not found: " + err.Error())
@@ -447,38 +599,1478 @@ func (s *ActivityService) AttendActivity(admin models.User, eventSlug string, ac
 		return errors.New("activity not found: " + err.Error())
 	}
 
+	if activity.IsBlocked {
+		return errors.New("activity is currently blocked")
+	}
+
 	if activity.EventID != event.ID {
 		return errors.New("activity does not belong to this event")
 	}
 
-	if !admin.IsSuperUser && event.CreatedBy != admin.ID {
-		adminStatus, err := s.ActivityRepo.GetUserAdminStatusBySlug(admin.ID, eventSlug)
-		if err != nil || (adminStatus.AdminType != models.AdminTypeMaster && adminStatus.AdminType != models.AdminTypeNormal) {
-			return errors.New("unauthorized: only admins can mark attendance")
-		}
+	now := time.Now()
+	if activity.EndTime.Before(now) {
+		return errors.New("activity has already ended")
 	}
 
-	isRegistered, registration, err := s.ActivityRepo.IsUserRegisteredToActivity(activityID, userID)
+	if len(activity.RequirementItems) > 0 && !acknowledgedRequirements {
+		return errors.New("the activity requirements must be acknowledged before registering")
+	}
+
+	isRegistered, err := s.ActivityRepo.IsUserRegisteredToEvent(user.ID, event.Slug)
 	if err != nil {
-		return errors.New("error checking activity registration: " + err.Error())
+		return errors.New("error checking event registration: " + err.Error())
 	}
 
 	if !isRegistered {
-		return errors.New("user is not registered to this activity")
+		return errors.New("user must be registered to the event first")
 	}
 
-	if registration.AttendedAt != nil {
-		return errors.New("user has already attended this activity")
+	if !activity.HasUnlimitedCapacity {
+		currentRegistrations, maxCapacity, err := s.ActivityRepo.GetActivityCapacity(activityID)
+		if err != nil {
+			return errors.New("error checking activity capacity: " + err.Error())
+		}
+
+		if currentRegistrations >= maxCapacity {
+			return errors.New("activity has reached maximum capacity")
+		}
+	}
+
+	conflicts, err := s.conflictingActivities(user, activity)
+	if err != nil {
+		return errors.New("couldn't get user activities")
+	}
+	if len(conflicts) > 0 {
+		return errors.New("user has another activity registered at the same time that is not palestra")
+	}
+
+	if err := s.useActivityToken(user, event, activity); err != nil {
+		return err
+	}
+
+	registration := &models.ActivityRegistration{
+		ActivityID:   activityID,
+		UserID:       user.ID,
+		AccessMethod: string(models.AccessMethodEvent), // Registered through event registration
+	}
+
+	if err := s.ActivityRepo.RegisterUserToActivityWithCapacity(registration); err != nil {
+		if tokenErr := s.ActivityRepo.ReleaseActivityToken(user.ID, activityID); tokenErr != nil {
+			log.Printf("Failed to release token of user %s for activity %s: %v", user.ID, activityID, tokenErr)
+		}
+		return errors.New("failed to register to activity: " + err.Error())
+	}
+
+	return nil
+}
+
+const maxBatchActivityRegistrations = 20
+
+// RegisterUserToActivities registers the user to several activities of the event at once. Each activity goes
+// through the same checks as a single registration and also against the activities accepted earlier in the
+// batch, so a failing activity is reported and skipped while the others still go through. A token is spent for
+// each fee activity. Accepted registrations and tokens are saved in one transaction, if saving fails nothing is kept
+func (s *ActivityService) RegisterUserToActivities(user models.User, eventSlug string, activityIDs []string, acknowledgedRequirements bool) ([]models.BatchActivityRegistrationResult, error) {
+	if len(activityIDs) == 0 {
+		return nil, errors.New("activity_ids can't be empty")
+	}
+	if len(activityIDs) > maxBatchActivityRegistrations {
+		return nil, fmt.Errorf("at most %d activities can be registered at once", maxBatchActivityRegistrations)
+	}
+
+	event, err := s.ActivityRepo.GetEventBySlug(eventSlug)
+	if err != nil {
+		return nil, errors.New("event not found: " + err.Error())
+	}
+
+	isRegistered, err := s.ActivityRepo.IsUserRegisteredToEvent(user.ID, event.Slug)
+	if err != nil {
+		return nil, errors.New("error checking event registration: " + err.Error())
+	}
+	if !isRegistered {
+		return nil, errors.New("user must be registered to the event first")
+	}
+
+	held, err := s.GetUserActivities(user)
+	if err != nil {
+		return nil, errors.New("couldn't get user activities: " + err.Error())
+	}
+
+	accesses, err := s.ActivityRepo.GetUserAccesses(user.ID)
+	if err != nil {
+		return nil, errors.New("error checking user accesses: " + err.Error())
+	}
+
+	tokens, err := s.ActivityRepo.GetUserTokens(user.ID)
+	if err != nil {
+		return nil, errors.New("error checking user tokens: " + err.Error())
+	}
+
+	now := time.Now()
+	seen := make(map[string]bool, len(activityIDs))
+	results := make([]models.BatchActivityRegistrationResult, 0, len(activityIDs))
+	var registrations []models.ActivityRegistration
+	var spentTokens []models.UserToken
+	for _, activityID := range activityIDs {
+		result := models.BatchActivityRegistrationResult{ActivityID: activityID}
+		if seen[activityID] {
+			result.Error = "activity is repeated in the batch"
+			results = append(results, result)
+			continue
+		}
+		seen[activityID] = true
+
+		activity, err := s.batchRegistrationCheck(event, held, activityID, acknowledgedRequirements, now)
+		if err != nil {
+			result.Error = err.Error()
+			results = append(results, result)
+			continue
+		}
+
+		// Tokens already picked for earlier activities of the batch are marked as used in the local copy
+		method, token, err := resolveActivityAccess(accesses, tokens, event.ID, activity)
+		if err != nil {
+			result.Error = err.Error()
+			results = append(results, result)
+			continue
+		}
+
+		registration := models.ActivityRegistration{
+			ActivityID:   activity.ID,
+			UserID:       user.ID,
+			AccessMethod: string(method),
+		}
+		if token != nil {
+			token.IsUsed = true
+			token.UsedAt = &now
+			token.UsedForID = &activity.ID
+			registration.TokenID = &token.ID
+			spentTokens = append(spentTokens, *token)
+		}
+
+		registrations = append(registrations, registration)
+		held = append(held, *activity)
+		result.Registered = true
+		result.AccessMethod = method
+		results = append(results, result)
+	}
+
+	if len(registrations) > 0 {
+		if err := s.ActivityRepo.RegisterUserToActivitiesBatch(registrations, spentTokens); err != nil {
+			return nil, errors.New("failed to register to activities, nothing was saved: " + err.Error())
+		}
+	}
+
+	return results, nil
+}
+
+// batchRegistrationCheck runs the single registration checks that don't spend anything,
+// held has the user's activities plus the ones accepted earlier in the batch
+func (s *ActivityService) batchRegistrationCheck(event *models.Event, held []models.Activity, activityID string, acknowledgedRequirements bool, now time.Time) (*models.Activity, error) {
+	activity, err := s.ActivityRepo.GetActivityByID(activityID)
+	if err != nil {
+		return nil, errors.New("activity not found")
+	}
+	if activity.EventID != event.ID {
+		return nil, errors.New("activity does not belong to this event")
+	}
+	if activity.IsBlocked {
+		return nil, errors.New("activity is currently blocked")
+	}
+	if activity.EndTime.Before(now) {
+		return nil, errors.New("activity has already ended")
+	}
+	if len(activity.RequirementItems) > 0 && !acknowledgedRequirements {
+		return nil, errors.New("the activity requirements must be acknowledged before registering")
+	}
+
+	for _, heldActivity := range held {
+		if heldActivity.ID == activity.ID {
+			return nil, errors.New("user already registered to this activity")
+		}
+	}
+
+	if !activity.HasUnlimitedCapacity {
+		currentRegistrations, maxCapacity, err := s.ActivityRepo.GetActivityCapacity(activity.ID)
+		if err != nil {
+			return nil, errors.New("error checking activity capacity: " + err.Error())
+		}
+		if currentRegistrations >= maxCapacity {
+			return nil, errors.New("activity has reached maximum capacity")
+		}
+	}
+
+	if conflicts := timeConflicts(held, activity); len(conflicts) > 0 {
+		return nil, errors.New("conflicts with " + conflicts[0].Name + ", registered at the same time")
+	}
+
+	return activity, nil
+}
+
+// resolveActivityAccess tells how the user gets into the activity: free activities and paid
+// access need nothing else, fee activities otherwise take one of the user's unused event tokens
+func resolveActivityAccess(accesses []models.AccessTarget, tokens []models.UserToken, eventID string, activity *models.Activity) (models.AccessMethod, *models.UserToken, error) {
+	for _, access := range accesses {
+		if access.TargetID == activity.ID {
+			return models.AccessMethodProduct, nil, nil
+		}
+	}
+
+	if !activity.HasFee {
+		return models.AccessMethodEvent, nil, nil
+	}
+
+	if len(tokens) == 0 {
+		return "", nil, errors.New("this activity requires a token or payment")
+	}
+
+	for i := range tokens {
+		if !tokens[i].IsUsed && tokens[i].EventID == eventID {
+			return models.AccessMethodToken, &tokens[i], nil
+		}
+	}
+
+	return "", nil, errors.New("user does not have any available tokens")
+}
+
+// useActivityToken spends one of the user's event tokens on a fee activity,
+// unless the user already has direct paid access to it
+func (s *ActivityService) useActivityToken(user models.User, event *models.Event, activity *models.Activity) error {
+	userAccesses, err := s.ActivityRepo.GetUserAccesses(user.ID)
+	if err != nil {
+		return errors.New("error checking user accesses: " + err.Error())
+	}
+
+	var userTokens []models.UserToken
+	if activity.HasFee {
+		userTokens, err = s.ActivityRepo.GetUserTokens(user.ID)
+		if err != nil {
+			return errors.New("error checking user tokens: " + err.Error())
+		}
+	}
+
+	method, useToken, err := resolveActivityAccess(userAccesses, userTokens, event.ID, activity)
+	if err != nil {
+		return err
+	}
+
+	if method == models.AccessMethodToken {
+		useToken.IsUsed = true
+		now := time.Now()
+		useToken.UsedAt = &now
+		useToken.UsedForID = &activity.ID
+		if err := s.ActivityRepo.UpdateUserToken(*useToken); err != nil {
+			return errors.New("error updating user token: " + err.Error())
+		}
+	}
+
+	return nil
+}
+
+// GetEligibleActivities lists the activities the user could register to right now without paying
+// anything else, with the access that would be used. Nothing is spent while resolving it
+func (s *ActivityService) GetEligibleActivities(user models.User, eventSlug string) ([]models.EligibleActivity, error) {
+	event, err := s.ActivityRepo.GetEventBySlug(eventSlug)
+	if err != nil {
+		return nil, errors.New("event not found: " + err.Error())
+	}
+
+	isRegistered, err := s.ActivityRepo.IsUserRegisteredToEvent(user.ID, event.Slug)
+	if err != nil {
+		return nil, errors.New("error checking event registration: " + err.Error())
+	}
+	if !isRegistered {
+		return nil, errors.New("user must be registered to the event first")
+	}
+
+	activities, err := s.ActivityRepo.GetAllActivitiesFromEvent(event.ID)
+	if err != nil {
+		return nil, errors.New("failed to get event activities: " + err.Error())
+	}
+
+	snapshots, err := s.ActivityRepo.GetActivitiesCapacitySnapshot(event.ID)
+	if err != nil {
+		return nil, errors.New("error checking activity capacity: " + err.Error())
+	}
+	full := make(map[string]bool, len(snapshots))
+	for _, snapshot := range snapshots {
+		full[snapshot.ActivityID] = !snapshot.HasUnlimitedCapacity && snapshot.Registered >= snapshot.Max
+	}
+
+	registeredActivities, err := s.ActivityRepo.GetUserActivities(user.ID)
+	if err != nil {
+		return nil, errors.New("error checking user activities: " + err.Error())
+	}
+	registered := make(map[string]bool, len(registeredActivities))
+	for _, activity := range registeredActivities {
+		registered[activity.ID] = true
+	}
+
+	userAccesses, err := s.ActivityRepo.GetUserAccesses(user.ID)
+	if err != nil {
+		return nil, errors.New("error checking user accesses: " + err.Error())
+	}
+
+	userTokens, err := s.ActivityRepo.GetUserTokens(user.ID)
+	if err != nil {
+		return nil, errors.New("error checking user tokens: " + err.Error())
+	}
+
+	now := time.Now()
+	eligible := []models.EligibleActivity{}
+	for i := range activities {
+		activity := &activities[i]
+		if activity.IsBlocked || activity.EndTime.Before(now) || registered[activity.ID] || full[activity.ID] {
+			continue
+		}
+
+		method, _, err := resolveActivityAccess(userAccesses, userTokens, event.ID, activity)
+		if err != nil {
+			continue
+		}
+
+		eligible = append(eligible, models.EligibleActivity{Activity: *activity, AccessMethod: method})
+	}
+
+	return eligible, nil
+}
+
+// GetActivityRevenue estimates the revenue of each fee activity from the tokens redeemed on it.
+// Activities can't be paid for directly, so tokens are the only source for now
+func (s *ActivityService) GetActivityRevenue(admin models.User, eventSlug string) ([]models.ActivityRevenue, error) {
+	event, err := s.ActivityRepo.GetEventBySlug(eventSlug)
+	if err != nil {
+		return nil, errors.New("event not found: " + err.Error())
+	}
+
+	if !admin.IsSuperUser && event.CreatedBy != admin.ID {
+		adminStatus, err := s.ActivityRepo.GetUserAdminStatusBySlug(admin.ID, eventSlug)
+		if err != nil || (adminStatus.AdminType != models.AdminTypeMaster && adminStatus.AdminType != models.AdminTypeNormal) {
+			return nil, errors.New("unauthorized: only admins can see activity revenue")
+		}
+	}
+
+	revenues, err := s.ActivityRepo.GetActivityTokenRevenue(event.ID)
+	if err != nil {
+		return nil, errors.New("failed to get activity revenue: " + err.Error())
+	}
+	if revenues == nil {
+		return []models.ActivityRevenue{}, nil
+	}
+
+	return revenues, nil
+}
+
+// GetTokenRedeemableActivities lists the open fee activities the user could register to by spending
+// a token, along with how many unused event tokens they have left. Activities the user is already
+// registered to, which covers the ones a token was spent on or that were attended, are left out
+func (s *ActivityService) GetTokenRedeemableActivities(user models.User, eventSlug string) (*models.TokenRedeemableActivities, error) {
+	event, err := s.ActivityRepo.GetEventBySlug(eventSlug)
+	if err != nil {
+		return nil, errors.New("event not found: " + err.Error())
+	}
+
+	isRegistered, err := s.ActivityRepo.IsUserRegisteredToEvent(user.ID, event.Slug)
+	if err != nil {
+		return nil, errors.New("error checking event registration: " + err.Error())
+	}
+	if !isRegistered {
+		return nil, errors.New("user must be registered to the event first")
+	}
+
+	userTokens, err := s.ActivityRepo.GetUserTokens(user.ID)
+	if err != nil {
+		return nil, errors.New("error checking user tokens: " + err.Error())
+	}
+
+	result := &models.TokenRedeemableActivities{Activities: []models.Activity{}}
+	usedFor := make(map[string]bool)
+	for _, token := range userTokens {
+		if token.EventID != event.ID {
+			continue
+		}
+		if !token.IsUsed {
+			result.UnusedTokens++
+		} else if token.UsedForID != nil {
+			usedFor[*token.UsedForID] = true
+		}
+	}
+	if result.UnusedTokens == 0 {
+		return result, nil
+	}
+
+	activities, err := s.ActivityRepo.GetAllActivitiesFromEvent(event.ID)
+	if err != nil {
+		return nil, errors.New("failed to get event activities: " + err.Error())
+	}
+
+	snapshots, err := s.ActivityRepo.GetActivitiesCapacitySnapshot(event.ID)
+	if err != nil {
+		return nil, errors.New("error checking activity capacity: " + err.Error())
+	}
+	full := make(map[string]bool, len(snapshots))
+	for _, snapshot := range snapshots {
+		full[snapshot.ActivityID] = !snapshot.HasUnlimitedCapacity && snapshot.Registered >= snapshot.Max
+	}
+
+	registeredActivities, err := s.ActivityRepo.GetUserActivities(user.ID)
+	if err != nil {
+		return nil, errors.New("error checking user activities: " + err.Error())
+	}
+	registered := make(map[string]bool, len(registeredActivities))
+	for _, activity := range registeredActivities {
+		registered[activity.ID] = true
+	}
+
+	userAccesses, err := s.ActivityRepo.GetUserAccesses(user.ID)
+	if err != nil {
+		return nil, errors.New("error checking user accesses: " + err.Error())
+	}
+
+	now := time.Now()
+	for i := range activities {
+		activity := &activities[i]
+		if !activity.HasFee || activity.IsBlocked || activity.EndTime.Before(now) ||
+			registered[activity.ID] || usedFor[activity.ID] || full[activity.ID] {
+			continue
+		}
+
+		method, _, err := resolveActivityAccess(userAccesses, userTokens, event.ID, activity)
+		if err != nil || method != models.AccessMethodToken {
+			continue
+		}
+
+		result.Activities = append(result.Activities, *activity)
+	}
+
+	return result, nil
+}
+
+func (s *ActivityService) UnregisterUserFromActivity(user models.User, eventSlug string, activityID string) error {
+	event, err := s.ActivityRepo.GetEventBySlug(eventSlug)
+	if err != nil {
+		return errors.New("event not found: " + err.Error())
+	}
+
+	activity, err := s.ActivityRepo.GetActivityByID(activityID)
+	if err != nil {
+		return errors.New("activity not found: " + err.Error())
+	}
+
+	if activity.IsBlocked {
+		return errors.New("activity is currently blocked")
+	}
+
+	if activity.EventID != event.ID {
+		return errors.New("activity does not belong to this event")
+	}
+
+	isRegistered, registration, err := s.ActivityRepo.IsUserRegisteredToActivity(activityID, user.ID)
+	if err != nil {
+		return errors.New("error checking activity registration: " + err.Error())
+	}
+
+	if !isRegistered {
+		return errors.New("user is not registered to this activity")
+	}
+
+	if registration.AttendedAt != nil {
+		return errors.New("user has already attended this activity")
+	}
+
+	userAccesses, err := s.ActivityRepo.GetUserAccesses(user.ID)
+	if err != nil {
+		return errors.New("error checking user accesses: " + err.Error())
+	}
+
+	var hasAccess bool
+	for _, access := range userAccesses {
+		if access.TargetID == activityID {
+			hasAccess = true
+			break
+		}
+	}
+
+	if hasAccess {
+		return errors.New("user has direct paid access to this activity")
+	}
+
+	if activity.HasFee {
+		userTokens, err := s.ActivityRepo.GetUserTokens(user.ID)
+		if err != nil {
+			return errors.New("error checking user tokens: " + err.Error())
+		}
+
+		if len(userTokens) == 0 {
+			return errors.New("this activity requires a token or payment")
+		}
+
+		var cleanToken models.UserToken
+		var foundToken bool
+		for _, token := range userTokens {
+			if token.IsUsed {
+				if *token.UsedForID == activityID {
+					cleanToken = token
+					foundToken = true
+					break
+				}
+			}
+		}
+
+		if !foundToken {
+			return errors.New("user does not have any available tokens")
+		}
+
+		cleanToken.IsUsed = false
+		cleanToken.UsedAt = nil
+		cleanToken.UsedForID = nil
+		if err := s.ActivityRepo.UpdateUserToken(cleanToken); err != nil {
+			return errors.New("error updating user token: " + err.Error())
+		}
+	}
+
+	if err := s.ActivityRepo.UnregisterUserFromActivity(activityID, user.ID); err != nil {
+		return errors.New("failed to unregister from activity: " + err.Error())
+	}
+
+	// A user unregistering from a pending promotion also leaves the waitlist
+	if err := s.ActivityRepo.DeleteWaitlistEntry(activityID, user.ID); err != nil {
+		log.Printf("Failed to remove waitlist entry of user %s for activity %s: %v", user.ID, activityID, err)
+	}
+	s.promoteFromWaitlist(activity)
+
+	return nil
+}
+
+// authorizeAttendance loads the activity of the event, checking the admin may take its attendance
+func (s *ActivityService) authorizeAttendance(admin models.User, eventSlug string, activityID string) (*models.Activity, error) {
+	event, err := s.ActivityRepo.GetEventBySlug(eventSlug)
+	if err != nil {
+		return nil, errors.New("event not found: " + err.Error())
+	}
+
+	activity, err := s.ActivityRepo.GetActivityByID(activityID)
+	if err != nil {
+		return nil, errors.New("activity not found: " + err.Error())
+	}
+
+	if activity.EventID != event.ID {
+		return nil, errors.New("activity does not belong to this event")
+	}
+
+	if !admin.IsSuperUser && event.CreatedBy != admin.ID {
+		adminStatus, err := s.ActivityRepo.GetUserAdminStatusBySlug(admin.ID, eventSlug)
+		if err != nil || (adminStatus.AdminType != models.AdminTypeMaster && adminStatus.AdminType != models.AdminTypeNormal) {
+			return nil, errors.New("unauthorized: only admins can mark attendance")
+		}
+	}
+
+	return activity, nil
+}
+
+func (s *ActivityService) AttendActivity(admin models.User, eventSlug string, activityID string, userID string) error {
+	activity, err := s.authorizeAttendance(admin, eventSlug, activityID)
+	if err != nil {
+		return err
+	}
+
+	isRegistered, registration, err := s.ActivityRepo.IsUserRegisteredToActivity(activityID, userID)
+	if err != nil {
+		return errors.New("error checking activity registration: " + err.Error())
+	}
+
+	if !isRegistered {
+		return errors.New("user is not registered to this activity")
+	}
+
+	if registration.AttendedAt != nil {
+		return errors.New("user has already attended this activity")
+	}
+
+	if activity.AttendanceFinalizedAt != nil {
+		return errors.New("attendance was already finalized for this activity")
+	}
+
+	if err := s.ActivityRepo.SetUserAttendance(activityID, userID, true); err != nil {
+		return errors.New("failed to mark attendance: " + err.Error())
+	}
+
+	return nil
+}
+
+// AttendActivityQR marks the attendance of the user scanned at the activity door and tells who they are, so the
+// scanner can show whether they may come in. A user not registered for the activity is reported, not an error
+func (s *ActivityService) AttendActivityQR(admin models.User, eventSlug string, activityID string, userID string) (*models.AttendQRResponse, error) {
+	activity, err := s.authorizeAttendance(admin, eventSlug, activityID)
+	if err != nil {
+		return nil, err
+	}
+
+	user, err := s.ActivityRepo.GetUserByID(userID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, errors.New("user not found: the scanned code doesn't match any account")
+		}
+		return nil, errors.New("error getting user: " + err.Error())
+	}
+
+	response := &models.AttendQRResponse{
+		UserID:   user.ID,
+		Name:     user.Name,
+		LastName: user.LastName,
+	}
+
+	isRegistered, registration, err := s.ActivityRepo.IsUserRegisteredToActivity(activityID, userID)
+	if err != nil {
+		return nil, errors.New("error checking activity registration: " + err.Error())
+	}
+	if !isRegistered {
+		return response, nil
+	}
+	response.Registered = true
+
+	if registration.AttendedAt != nil {
+		response.AlreadyAttended = true
+		return response, nil
+	}
+
+	if activity.AttendanceFinalizedAt != nil {
+		return nil, errors.New("attendance was already finalized for this activity")
+	}
+
+	if err := s.ActivityRepo.SetUserAttendance(activityID, userID, true); err != nil {
+		return nil, errors.New("failed to mark attendance: " + err.Error())
+	}
+
+	return response, nil
+}
+
+const maxAttendBatchSize = 200
+
+// AttendActivityBatch marks several users as present in the activity at once, with the same permission
+// checks as AttendActivity. Users that already attended or aren't registered are reported instead of
+// failing the call, the others are marked in a single transaction
+func (s *ActivityService) AttendActivityBatch(admin models.User, eventSlug string, activityID string, userIDs []string) ([]models.AttendBatchResult, error) {
+	if len(userIDs) == 0 {
+		return nil, errors.New("user_ids can't be empty")
+	}
+	if len(userIDs) > maxAttendBatchSize {
+		return nil, fmt.Errorf("at most %d users can be marked at once", maxAttendBatchSize)
+	}
+
+	activity, err := s.authorizeAttendance(admin, eventSlug, activityID)
+	if err != nil {
+		return nil, err
+	}
+
+	if activity.AttendanceFinalizedAt != nil {
+		return nil, errors.New("attendance was already finalized for this activity")
+	}
+
+	// Scanning the same QR code twice shouldn't show up as an error
+	seen := make(map[string]bool, len(userIDs))
+	unique := make([]string, 0, len(userIDs))
+	for _, userID := range userIDs {
+		userID = strings.TrimSpace(userID)
+		if userID == "" || seen[userID] {
+			continue
+		}
+		seen[userID] = true
+		unique = append(unique, userID)
+	}
+	if len(unique) == 0 {
+		return nil, errors.New("user_ids can't be empty")
+	}
+
+	statuses, err := s.ActivityRepo.SetUsersAttendance(activityID, unique, time.Now())
+	if err != nil {
+		return nil, errors.New("failed to mark attendance: " + err.Error())
+	}
+
+	results := make([]models.AttendBatchResult, 0, len(unique))
+	for _, userID := range unique {
+		status, ok := statuses[userID]
+		if !ok {
+			status = models.AttendBatchNotRegistered
+		}
+		results = append(results, models.AttendBatchResult{UserID: userID, Status: status})
+	}
+
+	return results, nil
+}
+
+func validCheckInMethod(method models.CheckInMethod) bool {
+	return method == models.CheckInAdminQR || method == models.CheckInManual || method == models.CheckInSelfService
+}
+
+// SelfAttendActivity lets a registered user mark their own attendance in a self service activity while it is happening
+func (s *ActivityService) SelfAttendActivity(user models.User, eventSlug string, activityID string) error {
+	event, err := s.ActivityRepo.GetEventBySlug(eventSlug)
+	if err != nil {
+		return errors.New("event not found: " + err.Error())
+	}
+
+	activity, err := s.ActivityRepo.GetActivityByID(activityID)
+	if err != nil {
+		return errors.New("activity not found: " + err.Error())
+	}
+
+	if activity.EventID != event.ID {
+		return errors.New("activity does not belong to this event")
+	}
+
+	if activity.CheckInMethod != models.CheckInSelfService {
+		return errors.New("activity does not allow self check-in, attendance is taken by the staff")
+	}
+
+	now := time.Now()
+	if now.Before(activity.StartTime) || now.After(activity.EndTime) {
+		return errors.New("self check-in is only available while the activity is happening")
+	}
+
+	isRegistered, registration, err := s.ActivityRepo.IsUserRegisteredToActivity(activityID, user.ID)
+	if err != nil {
+		return errors.New("error checking activity registration: " + err.Error())
+	}
+
+	if !isRegistered {
+		return errors.New("user is not registered to this activity")
+	}
+
+	if registration.AttendedAt != nil {
+		return errors.New("user has already attended this activity")
+	}
+
+	if activity.AttendanceFinalizedAt != nil {
+		return errors.New("attendance was already finalized for this activity")
+	}
+
+	if err := s.ActivityRepo.SetUserAttendance(activityID, user.ID, true); err != nil {
+		return errors.New("failed to mark attendance: " + err.Error())
+	}
+
+	return nil
+}
+
+// A4 landscape, in points
+const (
+	certificateWidth  = 842
+	certificateHeight = 595
+)
+
+// GenerateCertificate renders the PDF certificate of an activity the user attended
+func (s *ActivityService) GenerateCertificate(user models.User, eventSlug string, activityID string) ([]byte, *models.Activity, error) {
+	event, err := s.ActivityRepo.GetEventBySlug(eventSlug)
+	if err != nil {
+		return nil, nil, errors.New("event not found: " + err.Error())
+	}
+
+	activity, err := s.ActivityRepo.GetActivityByID(activityID)
+	if err != nil {
+		return nil, nil, errors.New("activity not found: " + err.Error())
+	}
+
+	if activity.EventID != event.ID {
+		return nil, nil, errors.New("activity does not belong to this event")
+	}
+
+	isRegistered, registration, err := s.ActivityRepo.IsUserRegisteredToActivity(activityID, user.ID)
+	if err != nil {
+		return nil, nil, errors.New("error checking activity registration: " + err.Error())
+	}
+
+	if !isRegistered || registration.AttendedAt == nil {
+		return nil, nil, errors.New("unauthorized: certificates are only issued to users who attended the activity")
+	}
+
+	content, err := os.ReadFile(filepath.Join("templates", "activity_certificate.tmpl"))
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to read certificate template: %v", err)
+	}
+
+	tmpl, err := template.New("certificateTemplate").Funcs(template.FuncMap{"pdf": utilities.PDFText}).Parse(string(content))
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to parse certificate template: %v", err)
+	}
+
+	data := struct {
+		HolderName string
+		Activity   *models.Activity
+		Event      *models.Event
+		IssuedAt   time.Time
+	}{
+		HolderName: strings.TrimSpace(user.Name + " " + user.LastName),
+		Activity:   activity,
+		Event:      event,
+		IssuedAt:   time.Now(),
+	}
+
+	var page bytes.Buffer
+	if err := tmpl.Execute(&page, data); err != nil {
+		return nil, nil, fmt.Errorf("failed to execute certificate template: %v", err)
+	}
+
+	return utilities.BuildPDF(page.Bytes(), certificateWidth, certificateHeight), activity, nil
+}
+
+// AttendCurrentActivity marks the user as present in the activity happening right now,
+// when several of the user's activities overlap they are returned for the staff to pick one
+func (s *ActivityService) AttendCurrentActivity(admin models.User, eventSlug string, userID string) (*models.AttendCurrentResponse, error) {
+	event, err := s.ActivityRepo.GetEventBySlug(eventSlug)
+	if err != nil {
+		return nil, errors.New("event not found: " + err.Error())
+	}
+
+	if !admin.IsSuperUser && event.CreatedBy != admin.ID {
+		adminStatus, err := s.ActivityRepo.GetUserAdminStatusBySlug(admin.ID, eventSlug)
+		if err != nil || (adminStatus.AdminType != models.AdminTypeMaster && adminStatus.AdminType != models.AdminTypeNormal) {
+			return nil, errors.New("unauthorized: only admins can mark attendance")
+		}
+	}
+
+	activities, err := s.ActivityRepo.GetUserInProgressActivities(userID, event.ID, time.Now())
+	if err != nil {
+		return nil, errors.New("error getting activities in progress: " + err.Error())
+	}
+
+	switch len(activities) {
+	case 0:
+		return nil, errors.New("no activity in progress found for this user")
+	case 1:
+		if err := s.AttendActivity(admin, eventSlug, activities[0].ID, userID); err != nil {
+			return nil, err
+		}
+		return &models.AttendCurrentResponse{Attended: &activities[0]}, nil
+	default:
+		return &models.AttendCurrentResponse{Candidates: activities}, nil
+	}
+}
+
+func (s *ActivityService) UnattendActivity(admin models.User, eventSlug string, activityID string, userID string) error {
+	event, err := s.ActivityRepo.GetEventBySlug(eventSlug)
+	if err != nil {
+		return errors.New("event not found: " + err.Error())
+	}
+
+	activity, err := s.ActivityRepo.GetActivityByID(activityID)
+	if err != nil {
+		return errors.New("activity not found: " + err.Error())
+	}
+
+	if activity.EventID != event.ID {
+		return errors.New("activity does not belong to this event")
+	}
+
+	if !admin.IsSuperUser && event.CreatedBy != admin.ID {
+		adminStatus, err := s.ActivityRepo.GetUserAdminStatusBySlug(admin.ID, eventSlug)
+		if err != nil || adminStatus.AdminType != models.AdminTypeMaster {
+			return errors.New("unauthorized: only master admins, event creators, or super users can remove attendance")
+		}
+	}
+
+	isRegistered, registration, err := s.ActivityRepo.IsUserRegisteredToActivity(activityID, userID)
+	if err != nil {
+		return errors.New("error checking activity registration: " + err.Error())
+	}
+
+	if !isRegistered {
+		return errors.New("user is not registered to this activity")
+	}
+
+	if registration.AttendedAt == nil {
+		return errors.New("user has not attended this activity")
+	}
+
+	if activity.AttendanceFinalizedAt != nil {
+		return errors.New("attendance was already finalized for this activity")
+	}
+
+	if err := s.ActivityRepo.SetUserAttendance(activityID, userID, false); err != nil {
+		return errors.New("failed to remove attendance: " + err.Error())
+	}
+
+	return nil
+}
+
+func (s *ActivityService) GetActivityDemand(admin models.User, eventSlug string, activityID string) (*models.ActivityDemand, error) {
+	event, err := s.ActivityRepo.GetEventBySlug(eventSlug)
+	if err != nil {
+		return nil, errors.New("event not found: " + err.Error())
+	}
+
+	activity, err := s.ActivityRepo.GetActivityByID(activityID)
+	if err != nil {
+		return nil, errors.New("activity not found: " + err.Error())
+	}
+
+	if activity.EventID != event.ID {
+		return nil, errors.New("activity does not belong to this event")
+	}
+
+	if !admin.IsSuperUser && event.CreatedBy != admin.ID {
+		adminStatus, err := s.ActivityRepo.GetUserAdminStatusBySlug(admin.ID, eventSlug)
+		if err != nil || (adminStatus.AdminType != models.AdminTypeMaster && adminStatus.AdminType != models.AdminTypeNormal) {
+			return nil, errors.New("unauthorized: only admins can see activity demand")
+		}
+	}
+
+	registered, waitlisted, err := s.ActivityRepo.GetActivityDemandCounts(activity.ID)
+	if err != nil {
+		return nil, errors.New("failed to get activity demand: " + err.Error())
+	}
+
+	demand := &models.ActivityDemand{
+		ActivityID:           activity.ID,
+		Name:                 activity.Name,
+		HasUnlimitedCapacity: activity.HasUnlimitedCapacity,
+		Registered:           registered,
+		Waitlisted:           waitlisted,
+	}
+
+	// An unlimited room never runs out of seats, so there is no ratio to report
+	if activity.HasUnlimitedCapacity || activity.MaxCapacity <= 0 {
+		return demand, nil
+	}
+
+	demand.Capacity = activity.MaxCapacity
+	ratio := math.Round(float64(registered+waitlisted)/float64(activity.MaxCapacity)*100) / 100
+	demand.DemandRatio = &ratio
+
+	return demand, nil
+}
+
+// GetCheckinTrend returns the check-ins of the activity over time in buckets of the given size,
+// filling the gaps between the first and last check-in with empty buckets
+func (s *ActivityService) GetCheckinTrend(admin models.User, eventSlug string, activityID string, bucket time.Duration) (*models.CheckinTrend, error) {
+	if bucket != time.Minute && bucket != 5*time.Minute {
+		return nil, errors.New("interval must be 1m or 5m")
+	}
+
+	event, err := s.ActivityRepo.GetEventBySlug(eventSlug)
+	if err != nil {
+		return nil, errors.New("event not found: " + err.Error())
+	}
+
+	activity, err := s.ActivityRepo.GetActivityByID(activityID)
+	if err != nil {
+		return nil, errors.New("activity not found: " + err.Error())
+	}
+
+	if activity.EventID != event.ID {
+		return nil, errors.New("activity does not belong to this event")
+	}
+
+	if !admin.IsSuperUser && event.CreatedBy != admin.ID {
+		adminStatus, err := s.ActivityRepo.GetUserAdminStatusBySlug(admin.ID, eventSlug)
+		if err != nil || (adminStatus.AdminType != models.AdminTypeMaster && adminStatus.AdminType != models.AdminTypeNormal) {
+			return nil, errors.New("unauthorized: only admins can see the check-in trend")
+		}
+	}
+
+	counted, err := s.ActivityRepo.GetCheckinBuckets(activity.ID, bucket)
+	if err != nil {
+		return nil, errors.New("failed to get check-ins: " + err.Error())
+	}
+
+	trend := &models.CheckinTrend{
+		ActivityID: activity.ID,
+		Interval:   strings.TrimSuffix(bucket.String(), "0s"),
+		Buckets:    []models.CheckinBucket{},
+	}
+
+	for _, b := range counted {
+		// Fill the minutes nobody arrived in, so the series can be plotted as is
+		if len(trend.Buckets) > 0 {
+			last := trend.Buckets[len(trend.Buckets)-1].Start
+			for next := last.Add(bucket); next.Before(b.Start); next = next.Add(bucket) {
+				trend.Buckets = append(trend.Buckets, models.CheckinBucket{Start: next})
+			}
+		}
+		trend.Buckets = append(trend.Buckets, b)
+		trend.Total += b.Count
+	}
+
+	return trend, nil
+}
+
+const mandatoryBackfillBatchSize = 500
+
+// BackfillMandatoryActivity registers the current event registrants to a mandatory activity, which
+// otherwise only happens when they register to the event. Running it again only picks up the missing ones
+func (s *ActivityService) BackfillMandatoryActivity(admin models.User, eventSlug string, activityID string) (*models.BackfillMandatoryResult, error) {
+	event, err := s.ActivityRepo.GetEventBySlug(eventSlug)
+	if err != nil {
+		return nil, errors.New("event not found: " + err.Error())
+	}
+
+	activity, err := s.ActivityRepo.GetActivityByID(activityID)
+	if err != nil {
+		return nil, errors.New("activity not found: " + err.Error())
+	}
+
+	if activity.EventID != event.ID {
+		return nil, errors.New("activity does not belong to this event")
+	}
+
+	if !admin.IsSuperUser && event.CreatedBy != admin.ID {
+		adminStatus, err := s.ActivityRepo.GetUserAdminStatusBySlug(admin.ID, eventSlug)
+		if err != nil || adminStatus.AdminType != models.AdminTypeMaster {
+			return nil, errors.New("unauthorized: only master admins can backfill mandatory activities")
+		}
+	}
+
+	if !activity.IsMandatory {
+		return nil, errors.New("activity is not mandatory")
+	}
+
+	registrants, err := s.ActivityRepo.CountEventRegistrations(event.ID)
+	if err != nil {
+		return nil, errors.New("failed to count event registrations: " + err.Error())
+	}
+
+	registered, err := s.ActivityRepo.BackfillActivityRegistrations(activity.ID, event.ID, mandatoryBackfillBatchSize)
+	if err != nil {
+		return nil, fmt.Errorf("failed to register users after %d registrations: %w", registered, err)
+	}
+
+	return &models.BackfillMandatoryResult{
+		ActivityID:  activity.ID,
+		Registrants: registrants,
+		Registered:  registered,
+		Skipped:     registrants - registered,
+	}, nil
+}
+
+// FinalizeActivityAttendance marks the registrants of an ended activity that weren't checked in
+// as no-shows, after that the activity attendance can't be changed
+func (s *ActivityService) FinalizeActivityAttendance(admin models.User, eventSlug string, activityID string) (*models.FinalizeAttendanceResult, error) {
+	event, err := s.ActivityRepo.GetEventBySlug(eventSlug)
+	if err != nil {
+		return nil, errors.New("event not found: " + err.Error())
+	}
+
+	activity, err := s.ActivityRepo.GetActivityByID(activityID)
+	if err != nil {
+		return nil, errors.New("activity not found: " + err.Error())
+	}
+
+	if activity.EventID != event.ID {
+		return nil, errors.New("activity does not belong to this event")
+	}
+
+	if !admin.IsSuperUser && event.CreatedBy != admin.ID {
+		adminStatus, err := s.ActivityRepo.GetUserAdminStatusBySlug(admin.ID, eventSlug)
+		if err != nil || (adminStatus.AdminType != models.AdminTypeMaster && adminStatus.AdminType != models.AdminTypeNormal) {
+			return nil, errors.New("unauthorized: only admins can finalize attendance")
+		}
+	}
+
+	now := time.Now()
+	if activity.EndTime.After(now) {
+		return nil, errors.New("activity has not ended yet")
+	}
+
+	if activity.AttendanceFinalizedAt != nil {
+		return nil, errors.New("attendance was already finalized for this activity")
+	}
+
+	noShows, err := s.ActivityRepo.FinalizeActivityAttendance(activity.ID, now)
+	if err != nil {
+		return nil, errors.New("failed to finalize attendance: " + err.Error())
+	}
+
+	return &models.FinalizeAttendanceResult{
+		ActivityID:  activity.ID,
+		NoShows:     noShows,
+		FinalizedAt: now,
+	}, nil
+}
+
+func (s *ActivityService) GetActivityRegistrations(admin models.User, eventSlug string, activityID string) ([]models.ActivityRegistration, error) {
+	event, err := s.ActivityRepo.GetEventBySlug(eventSlug)
+	if err != nil {
+		return nil, errors.New("event not found: " + err.Error())
+	}
+
+	activity, err := s.ActivityRepo.GetActivityByID(activityID)
+	if err != nil {
+		return nil, errors.New("activity not found: " + err.Error())
+	}
+
+	if activity.EventID != event.ID {
+		return nil, errors.New("activity does not belong to this event")
+	}
+
+	if !admin.IsSuperUser && event.CreatedBy != admin.ID {
+		adminStatus, err := s.ActivityRepo.GetUserAdminStatusBySlug(admin.ID, eventSlug)
+		if err != nil || (adminStatus.AdminType != models.AdminTypeMaster && adminStatus.AdminType != models.AdminTypeNormal) {
+			return nil, errors.New("unauthorized: only admins can get activity attendees")
+		}
+	}
+
+	var registrations []models.ActivityRegistration
+	if registrations, err = s.ActivityRepo.GetActivityRegistrations(activityID); err != nil {
+		return nil, errors.New("failed to retrieve activity registrations: " + err.Error())
+	}
+
+	return registrations, nil
+}
+
+func (s *ActivityService) GetUserAccesses(userID string) ([]models.AccessTarget, error) {
+	return s.ActivityRepo.GetUserAccesses(userID)
+}
+
+func (s *ActivityService) GetUserAccessesFromEvent(userID string, eventSlug string) ([]models.AccessTarget, error) {
+	event, err := s.ActivityRepo.GetEventBySlug(eventSlug)
+	if err != nil {
+		return nil, errors.New("event not found: " + err.Error())
+	}
+
+	return s.ActivityRepo.GetUserAccessesFromEvent(userID, *event)
+}
+
+func (s *ActivityService) GetUserActivities(user models.User) ([]models.Activity, error) {
+	userActivities, err := s.ActivityRepo.GetUserActivities(user.ID)
+	if err != nil {
+		return nil, errors.New("error checking user activities: " + err.Error())
+	}
+
+	return userActivities, nil
+}
+
+func (s *ActivityService) GetUserActivitiesFromEvent(user models.User, eventSlug string) ([]models.Activity, error) {
+	event, err := s.ActivityRepo.GetEventBySlug(eventSlug)
+	if err != nil {
+		return nil, errors.New("event not found: " + err.Error())
+	}
+
+	userActivities, err := s.ActivityRepo.GetUserActivities(user.ID)
+	if err != nil {
+		return nil, errors.New("error checking user activities: " + err.Error())
+	}
+
+	var activities []models.Activity
+	for _, activity := range userActivities {
+		if activity.EventID == event.ID {
+			activities = append(activities, activity)
+		}
+	}
+
+	return activities, nil
+}
+
+// SetContactSharing records whether the user agrees to show their email to the speaker of an activity they registered to
+func (s *ActivityService) SetContactSharing(user models.User, eventSlug string, req models.ShareContactRequest) error {
+	event, err := s.ActivityRepo.GetEventBySlug(eventSlug)
+	if err != nil {
+		return errors.New("event not found: " + err.Error())
+	}
+
+	activity, err := s.ActivityRepo.GetActivityByID(req.ActivityID)
+	if err != nil {
+		return errors.New("activity not found: " + err.Error())
+	}
+
+	if activity.EventID != event.ID {
+		return errors.New("activity does not belong to this event")
+	}
+
+	if err := s.ActivityRepo.SetContactSharing(activity.ID, user.ID, req.ShareContact); err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return errors.New("registration not found: user is not registered to this activity")
+		}
+		return errors.New("failed to update contact sharing: " + err.Error())
+	}
+
+	return nil
+}
+
+// GetSpeakerRoster lists the registrants of the activity for its linked speaker or the event admins,
+// only the users that opted in to contact sharing have their email shown
+func (s *ActivityService) GetSpeakerRoster(user models.User, eventSlug string, activityID string) ([]models.SpeakerRosterEntry, error) {
+	event, err := s.ActivityRepo.GetEventBySlug(eventSlug)
+	if err != nil {
+		return nil, errors.New("event not found: " + err.Error())
+	}
+
+	activity, err := s.ActivityRepo.GetActivityByID(activityID)
+	if err != nil {
+		return nil, errors.New("activity not found: " + err.Error())
+	}
+
+	if activity.EventID != event.ID {
+		return nil, errors.New("activity does not belong to this event")
+	}
+
+	isSpeaker := activity.SpeakerUserID != nil && *activity.SpeakerUserID == user.ID
+	if !isSpeaker && !user.IsSuperUser && event.CreatedBy != user.ID {
+		adminStatus, err := s.ActivityRepo.GetUserAdminStatusBySlug(user.ID, eventSlug)
+		if err != nil || (adminStatus.AdminType != models.AdminTypeMaster && adminStatus.AdminType != models.AdminTypeNormal) {
+			return nil, errors.New("unauthorized: only the activity speaker and admins can see the roster")
+		}
+	}
+
+	roster, err := s.ActivityRepo.GetSpeakerRoster(activity.ID)
+	if err != nil {
+		return nil, errors.New("failed to get roster: " + err.Error())
+	}
+
+	return roster, nil
+}
+
+func (s *ActivityService) GetActivityAttendants(admin models.User, eventSlug string, activityID string) ([]models.ActivityRegistration, error) {
+	event, err := s.ActivityRepo.GetEventBySlug(eventSlug)
+	if err != nil {
+		return nil, errors.New("event not found: " + err.Error())
+	}
+
+	activity, err := s.ActivityRepo.GetActivityByID(activityID)
+	if err != nil {
+		return nil, errors.New("activity not found: " + err.Error())
+	}
+
+	if activity.EventID != event.ID {
+		return nil, errors.New("activity does not belong to this event")
+	}
+
+	if !admin.IsSuperUser && event.CreatedBy != admin.ID {
+		adminStatus, err := s.ActivityRepo.GetUserAdminStatusBySlug(admin.ID, eventSlug)
+		if err != nil || (adminStatus.AdminType != models.AdminTypeMaster && adminStatus.AdminType != models.AdminTypeNormal) {
+			return nil, errors.New("unauthorized: only admins can get activity attendants")
+		}
+	}
+
+	registrations, err := s.ActivityRepo.GetActivityRegistrations(activityID)
+	if err != nil {
+		return nil, errors.New("failed to retrieve activity attendants: " + err.Error())
+	}
+
+	var attendants []models.ActivityRegistration
+	for _, registration := range registrations {
+		if registration.AttendedAt != nil {
+			attendants = append(attendants, registration)
+		}
+	}
+
+	return attendants, nil
+}
+
+func (s *ActivityService) GetUserAttendedActivities(user models.User) ([]models.Activity, error) {
+	userActivities, err := s.ActivityRepo.GetUserAttendedActivities(user.ID)
+	if err != nil {
+		return nil, errors.New("error getting user attended activities: " + err.Error())
+	}
+
+	return userActivities, nil
+}
+
+func (s *ActivityService) GetAllAttendances(admin models.User, eventSlug string) ([]models.ActivityRegistration, error) {
+	event, err := s.ActivityRepo.GetEventBySlug(eventSlug)
+	if err != nil {
+		return nil, errors.New("event not found: " + err.Error())
+	}
+
+	// Check admin permissions
+	if !admin.IsSuperUser && event.CreatedBy != admin.ID {
+		adminStatus, err := s.ActivityRepo.GetUserAdminStatusBySlug(admin.ID, eventSlug)
+		if err != nil || (adminStatus.AdminType != models.AdminTypeMaster && adminStatus.AdminType != models.AdminTypeNormal) {
+			return nil, errors.New("unauthorized: only admins can get all attendances")
+		}
+	}
+
+	attendances, err := s.ActivityRepo.GetAllAttendancesFromEvent(event.ID)
+	if err != nil {
+		return nil, errors.New("failed to retrieve all attendances: " + err.Error())
+	}
+
+	return attendances, nil
+}
+
+func (s *ActivityService) JoinWaitlist(user models.User, eventSlug string, activityID string) (*models.ActivityWaitlist, error) {
+	event, err := s.ActivityRepo.GetEventBySlug(eventSlug)
+	if err != nil {
+		return nil, errors.New("event not found: " + err.Error())
+	}
+
+	activity, err := s.ActivityRepo.GetActivityByID(activityID)
+	if err != nil {
+		return nil, errors.New("activity not found: " + err.Error())
+	}
+
+	if activity.IsBlocked {
+		return nil, errors.New("activity is currently blocked")
+	}
+
+	if activity.EventID != event.ID {
+		return nil, errors.New("activity does not belong to this event")
+	}
+
+	if activity.EndTime.Before(time.Now()) {
+		return nil, errors.New("activity has already ended")
+	}
+
+	isRegistered, err := s.ActivityRepo.IsUserRegisteredToEvent(user.ID, event.Slug)
+	if err != nil {
+		return nil, errors.New("error checking event registration: " + err.Error())
+	}
+
+	if !isRegistered {
+		return nil, errors.New("user must be registered to the event first")
+	}
+
+	if activity.HasUnlimitedCapacity {
+		return nil, errors.New("activity has available slots, register instead")
+	}
+
+	currentRegistrations, maxCapacity, err := s.ActivityRepo.GetActivityCapacity(activityID)
+	if err != nil {
+		return nil, errors.New("error checking activity capacity: " + err.Error())
+	}
+
+	if currentRegistrations < maxCapacity {
+		return nil, errors.New("activity has available slots, register instead")
+	}
+
+	if isRegistered, _, _ := s.ActivityRepo.IsUserRegisteredToActivity(activityID, user.ID); isRegistered {
+		return nil, errors.New("user already registered to this activity")
+	}
+
+	if _, err := s.ActivityRepo.GetWaitlistEntry(activityID, user.ID); err == nil {
+		return nil, errors.New("user already in the waitlist for this activity")
+	}
+
+	entry := &models.ActivityWaitlist{
+		ID:         uuid.New().String(),
+		ActivityID: activityID,
+		UserID:     user.ID,
+		Status:     models.WaitlistWaiting,
+	}
+
+	if err := s.ActivityRepo.CreateWaitlistEntry(entry); err != nil {
+		return nil, errors.New("failed to join waitlist: " + err.Error())
+	}
+
+	return entry, nil
+}
+
+// GetUserWaitlists returns every waitlist the user is in, with activity and event context
+func (s *ActivityService) GetUserWaitlists(user models.User) ([]models.UserWaitlistEntry, error) {
+	entries, err := s.ActivityRepo.GetUserWaitlistEntries(user.ID)
+	if err != nil {
+		return nil, errors.New("failed to get waitlist entries: " + err.Error())
+	}
+
+	result := []models.UserWaitlistEntry{}
+	if len(entries) == 0 {
+		return result, nil
+	}
+
+	var activityIDs []string
+	for _, entry := range entries {
+		activityIDs = append(activityIDs, entry.ActivityID)
+	}
+
+	activities, err := s.ActivityRepo.GetActivitiesByIDs(activityIDs)
+	if err != nil {
+		return nil, errors.New("failed to get activities: " + err.Error())
+	}
+
+	activityByID := make(map[string]models.Activity)
+	var eventIDs []string
+	for _, activity := range activities {
+		activityByID[activity.ID] = activity
+		eventIDs = append(eventIDs, activity.EventID)
+	}
+
+	events, err := s.ActivityRepo.GetEventsByIDs(eventIDs)
+	if err != nil {
+		return nil, errors.New("failed to get events: " + err.Error())
+	}
+
+	eventByID := make(map[string]models.Event)
+	for _, event := range events {
+		eventByID[event.ID] = event
+	}
+
+	ahead, err := s.ActivityRepo.GetUserWaitlistPositions(user.ID, activityIDs)
+	if err != nil {
+		return nil, errors.New("failed to get waitlist positions: " + err.Error())
+	}
+
+	registrations, err := s.ActivityRepo.GetUserRegistrationsForActivities(user.ID, activityIDs)
+	if err != nil {
+		return nil, errors.New("failed to get registrations: " + err.Error())
+	}
+
+	confirmBy := make(map[string]*time.Time)
+	for _, registration := range registrations {
+		confirmBy[registration.ActivityID] = registration.ConfirmBy
+	}
+
+	for _, entry := range entries {
+		activity := activityByID[entry.ActivityID]
+		event := eventByID[activity.EventID]
+
+		item := models.UserWaitlistEntry{
+			ID:                entry.ID,
+			ActivityID:        entry.ActivityID,
+			ActivityName:      activity.Name,
+			ActivityStartTime: activity.StartTime,
+			EventID:           event.ID,
+			EventSlug:         event.Slug,
+			EventName:         event.Name,
+			Status:            entry.Status,
+			JoinedAt:          entry.CreatedAt,
+		}
+		if entry.Status == models.WaitlistWaiting {
+			item.Position = ahead[entry.ActivityID] + 1
+		} else {
+			item.ConfirmBy = confirmBy[entry.ActivityID]
+		}
+
+		result = append(result, item)
+	}
+
+	return result, nil
+}
+
+func (s *ActivityService) LeaveWaitlist(user models.User, eventSlug string, activityID string) error {
+	event, err := s.ActivityRepo.GetEventBySlug(eventSlug)
+	if err != nil {
+		return errors.New("event not found: " + err.Error())
+	}
+
+	activity, err := s.ActivityRepo.GetActivityByID(activityID)
+	if err != nil {
+		return errors.New("activity not found: " + err.Error())
+	}
+
+	if activity.EventID != event.ID {
+		return errors.New("activity does not belong to this event")
+	}
+
+	entry, err := s.ActivityRepo.GetWaitlistEntry(activityID, user.ID)
+	if err != nil {
+		return errors.New("user is not in the waitlist for this activity")
+	}
+
+	// Leaving while holding an offer gives the seat to the next in line
+	if entry.Status == models.WaitlistOffered {
+		if err := s.ActivityRepo.ReleaseWaitlistPromotion(activityID, user.ID, false); err != nil {
+			return errors.New("failed to leave waitlist: " + err.Error())
+		}
+		s.promoteFromWaitlist(activity)
+		return nil
 	}
 
-	if err := s.ActivityRepo.SetUserAttendance(activityID, userID, true); err != nil {
-		return errors.New("failed to mark attendance: " + err.Error())
+	if err := s.ActivityRepo.DeleteWaitlistEntry(activityID, user.ID); err != nil {
+		return errors.New("failed to leave waitlist: " + err.Error())
 	}
 
 	return nil
 }
 
-func (s *ActivityService) UnattendActivity(admin models.User, eventSlug string, activityID string, userID string) error {
+func (s *ActivityService) ConfirmWaitlistPromotion(user models.User, eventSlug string, activityID string) error {
 	event, err := s.ActivityRepo.GetEventBySlug(eventSlug)
 	if err != nil {
 		return errors.New("event not found: " + err.Error())
@@ -493,107 +2085,521 @@ func (s *ActivityService) UnattendActivity(admin models.User, eventSlug string,
 		return errors.New("activity does not belong to this event")
 	}
 
-	if !admin.IsSuperUser && event.CreatedBy != admin.ID {
-		adminStatus, err := s.ActivityRepo.GetUserAdminStatusBySlug(admin.ID, eventSlug)
-		if err != nil || adminStatus.AdminType != models.AdminTypeMaster {
-			return errors.New("unauthorized: only master admins, event creators, or super users can remove attendance")
+	isRegistered, registration, _ := s.ActivityRepo.IsUserRegisteredToActivity(activityID, user.ID)
+	if !isRegistered || registration.ConfirmBy == nil {
+		return errors.New("no pending waitlist promotion for this activity")
+	}
+
+	if registration.ConfirmBy.Before(time.Now()) {
+		return errors.New("waitlist promotion has expired")
+	}
+
+	if err := s.ActivityRepo.ConfirmWaitlistPromotion(activityID, user.ID); err != nil {
+		return errors.New("failed to confirm registration: " + err.Error())
+	}
+
+	return nil
+}
+
+// promoteFromWaitlist hands free seats of an activity to the users waiting for it, in order.
+// With a confirmation window configured the seat is only held until ConfirmBy. Users that
+// can't take the seat are expired so they don't hold the line, and the reason is logged.
+// It returns how many users got a seat
+func (s *ActivityService) promoteFromWaitlist(activity *models.Activity) int {
+	if activity.EndTime.Before(time.Now()) {
+		return 0
+	}
+
+	event, err := s.ActivityRepo.GetEventByActivityID(activity.ID)
+	if err != nil {
+		log.Printf("Failed to get event for activity %s: %v", activity.ID, err)
+		return 0
+	}
+
+	entries, err := s.ActivityRepo.GetWaitingEntries(activity.ID)
+	if err != nil {
+		log.Printf("Failed to get waitlist for activity %s: %v", activity.ID, err)
+		return 0
+	}
+
+	promoted := 0
+	window := config.GetWaitlistConfirmWindow()
+	for _, entry := range entries {
+		// Don't judge anyone in line unless there is a seat to give
+		if !activity.HasUnlimitedCapacity {
+			currentRegistrations, maxCapacity, err := s.ActivityRepo.GetActivityCapacity(activity.ID)
+			if err != nil || currentRegistrations >= maxCapacity {
+				return promoted
+			}
+		}
+
+		user, err := s.ActivityRepo.GetUserByID(entry.UserID)
+		if err != nil {
+			s.skipWaitlistEntry(entry, "user not found: "+err.Error())
+			continue
+		}
+
+		if s.hasConflictingActivity(user, activity) {
+			s.skipWaitlistEntry(entry, "user has another activity registered at the same time")
+			continue
+		}
+
+		if err := s.useActivityToken(user, event, activity); err != nil {
+			s.skipWaitlistEntry(entry, err.Error())
+			continue
+		}
+
+		registration := &models.ActivityRegistration{
+			ActivityID:   activity.ID,
+			UserID:       user.ID,
+			AccessMethod: string(models.AccessMethodEvent),
+		}
+		if window > 0 {
+			confirmBy := time.Now().Add(window)
+			registration.ConfirmBy = &confirmBy
+		}
+
+		if err := s.ActivityRepo.PromoteWaitlistEntry(registration); err != nil {
+			if tokenErr := s.ActivityRepo.ReleaseActivityToken(user.ID, activity.ID); tokenErr != nil {
+				log.Printf("Failed to release token of user %s for activity %s: %v", user.ID, activity.ID, tokenErr)
+			}
+			if strings.Contains(err.Error(), "capacity") {
+				return promoted
+			}
+			s.skipWaitlistEntry(entry, "failed to register: "+err.Error())
+			continue
 		}
+
+		promoted++
+
+		go func(user models.User, confirmBy *time.Time) {
+			if err := s.SendWaitlistPromotionEmail(&user, event, activity, confirmBy); err != nil {
+				log.Printf("Failed to send waitlist promotion email to %s: %v", user.Email, err)
+			}
+		}(user, registration.ConfirmBy)
 	}
 
-	isRegistered, registration, err := s.ActivityRepo.IsUserRegisteredToActivity(activityID, userID)
+	return promoted
+}
+
+func (s *ActivityService) skipWaitlistEntry(entry models.ActivityWaitlist, reason string) {
+	log.Printf("Skipping waitlist entry of user %s for activity %s: %s", entry.UserID, entry.ActivityID, reason)
+	if err := s.ActivityRepo.SetWaitlistStatus(entry.ActivityID, entry.UserID, models.WaitlistExpired); err != nil {
+		log.Printf("Failed to expire waitlist entry of user %s for activity %s: %v", entry.UserID, entry.ActivityID, err)
+	}
+}
+
+func (s *ActivityService) hasConflictingActivity(user models.User, activity *models.Activity) bool {
+	conflicts, err := s.conflictingActivities(user, activity)
+	return err != nil || len(conflicts) > 0
+}
+
+// conflictingActivities returns the user's registered activities overlapping the given one,
+// palestras excepted since users may leave them for another activity
+func (s *ActivityService) conflictingActivities(user models.User, activity *models.Activity) ([]models.Activity, error) {
+	userActivities, err := s.GetUserActivities(user)
 	if err != nil {
-		return errors.New("error checking activity registration: " + err.Error())
+		return nil, err
 	}
 
-	if !isRegistered {
-		return errors.New("user is not registered to this activity")
+	return timeConflicts(userActivities, activity), nil
+}
+
+// timeConflicts returns the activities among held overlapping the given one, palestras excepted
+func timeConflicts(held []models.Activity, activity *models.Activity) []models.Activity {
+	conflicts := []models.Activity{}
+	for _, uAct := range held {
+		if uAct.ID == activity.ID {
+			continue
+		}
+		if !(uAct.EndTime.Before(activity.StartTime) || uAct.StartTime.After(activity.EndTime)) && uAct.Type != models.ActivityPalestra {
+			conflicts = append(conflicts, uAct)
+		}
 	}
+	return conflicts
+}
 
-	if registration.AttendedAt == nil {
-		return errors.New("user has not attended this activity")
+// normalizeName normalizes speaker and location names so "John Doe" and " john  doe" are the same
+func normalizeName(name string) string {
+	return strings.ToLower(strings.Join(strings.Fields(name), " "))
+}
+
+// overlapWindow returns the intersection of two time windows, back to back windows don't overlap
+func overlapWindow(aStart, aEnd, bStart, bEnd time.Time) (time.Time, time.Time, bool) {
+	if !aStart.Before(bEnd) || !bStart.Before(aEnd) {
+		return time.Time{}, time.Time{}, false
 	}
 
-	if err := s.ActivityRepo.SetUserAttendance(activityID, userID, false); err != nil {
-		return errors.New("failed to remove attendance: " + err.Error())
+	start, end := aStart, aEnd
+	if bStart.After(start) {
+		start = bStart
+	}
+	if bEnd.Before(end) {
+		end = bEnd
 	}
+	return start, end, true
+}
 
-	return nil
+// speakerConflicts returns the activities among others given by the speaker of activity whose time
+// windows overlap with it. Back to back activities don't overlap
+func speakerConflicts(activity models.Activity, others []models.Activity) []models.SpeakerConflict {
+	key := normalizeName(activity.Speaker)
+	if key == "" {
+		return nil
+	}
+
+	var conflicts []models.SpeakerConflict
+	for _, other := range others {
+		if other.ID == activity.ID || normalizeName(other.Speaker) != key {
+			continue
+		}
+		overlapStart, overlapEnd, ok := overlapWindow(activity.StartTime, activity.EndTime, other.StartTime, other.EndTime)
+		if !ok {
+			continue
+		}
+
+		conflicts = append(conflicts, models.SpeakerConflict{
+			Speaker:                 strings.TrimSpace(activity.Speaker),
+			ActivityID:              activity.ID,
+			ActivityName:            activity.Name,
+			ConflictingActivityID:   other.ID,
+			ConflictingActivityName: other.Name,
+			OverlapStart:            overlapStart,
+			OverlapEnd:              overlapEnd,
+		})
+	}
+
+	return conflicts
 }
 
-func (s *ActivityService) GetActivityRegistrations(admin models.User, eventSlug string, activityID string) ([]models.ActivityRegistration, error) {
+// checkSpeakerConflicts looks for double-bookings of the activity speaker in its event, failing when reject is set
+func (s *ActivityService) checkSpeakerConflicts(activity models.Activity, reject bool) ([]models.SpeakerConflict, error) {
+	if normalizeName(activity.Speaker) == "" {
+		return nil, nil
+	}
+
+	activities, err := s.ActivityRepo.GetEventActivitiesWithSpeaker(activity.EventID)
+	if err != nil {
+		return nil, errors.New("failed to check speaker conflicts: " + err.Error())
+	}
+
+	conflicts := speakerConflicts(activity, activities)
+	if reject && len(conflicts) > 0 {
+		return nil, fmt.Errorf("speaker conflict: %s is already at %s at the same time", conflicts[0].Speaker, conflicts[0].ConflictingActivityName)
+	}
+
+	return conflicts, nil
+}
+
+// GetSpeakerLoads groups the event activities by speaker with their total hours and overlapping
+// activities, speakers with conflicts first
+func (s *ActivityService) GetSpeakerLoads(admin models.User, eventSlug string) ([]models.SpeakerLoad, error) {
 	event, err := s.ActivityRepo.GetEventBySlug(eventSlug)
 	if err != nil {
 		return nil, errors.New("event not found: " + err.Error())
 	}
 
-	activity, err := s.ActivityRepo.GetActivityByID(activityID)
+	if !admin.IsSuperUser && event.CreatedBy != admin.ID {
+		adminStatus, err := s.ActivityRepo.GetUserAdminStatusBySlug(admin.ID, eventSlug)
+		if err != nil || (adminStatus.AdminType != models.AdminTypeMaster && adminStatus.AdminType != models.AdminTypeNormal) {
+			return nil, errors.New("unauthorized: only admins can see speaker conflicts")
+		}
+	}
+
+	activities, err := s.ActivityRepo.GetEventActivitiesWithSpeaker(event.ID)
 	if err != nil {
-		return nil, errors.New("activity not found: " + err.Error())
+		return nil, errors.New("failed to get activities: " + err.Error())
 	}
 
-	if activity.EventID != event.ID {
-		return nil, errors.New("activity does not belong to this event")
+	var keys []string
+	bySpeaker := make(map[string][]models.Activity)
+	for _, activity := range activities {
+		key := normalizeName(activity.Speaker)
+		if _, ok := bySpeaker[key]; !ok {
+			keys = append(keys, key)
+		}
+		bySpeaker[key] = append(bySpeaker[key], activity)
+	}
+
+	loads := make([]models.SpeakerLoad, 0, len(keys))
+	for _, key := range keys {
+		speakerActivities := bySpeaker[key]
+		load := models.SpeakerLoad{
+			Speaker:    strings.TrimSpace(speakerActivities[0].Speaker),
+			Activities: len(speakerActivities),
+			Conflicts:  []models.SpeakerConflict{},
+		}
+
+		var hours float64
+		for i, activity := range speakerActivities {
+			hours += activity.EndTime.Sub(activity.StartTime).Hours()
+			// Only compare with the later activities so each pair shows up once
+			load.Conflicts = append(load.Conflicts, speakerConflicts(activity, speakerActivities[i+1:])...)
+		}
+		load.TotalHours = math.Round(hours*100) / 100
+
+		loads = append(loads, load)
+	}
+
+	sort.SliceStable(loads, func(i, j int) bool {
+		return len(loads[i].Conflicts) > len(loads[j].Conflicts)
+	})
+
+	return loads, nil
+}
+
+// roomConflicts sweeps the activities of a single location, sorted by start time, keeping the ones
+// still running so each activity is only compared with the ones it can overlap
+func roomConflicts(activities []models.Activity) []models.RoomConflict {
+	var conflicts []models.RoomConflict
+	var running []models.Activity
+	for _, activity := range activities {
+		kept := running[:0]
+		for _, other := range running {
+			if other.EndTime.After(activity.StartTime) {
+				kept = append(kept, other)
+			}
+		}
+		running = kept
+
+		for _, other := range running {
+			overlapStart, overlapEnd, ok := overlapWindow(other.StartTime, other.EndTime, activity.StartTime, activity.EndTime)
+			if !ok {
+				continue
+			}
+			conflicts = append(conflicts, models.RoomConflict{
+				Location:                strings.TrimSpace(other.Location),
+				ActivityID:              other.ID,
+				ActivityName:            other.Name,
+				ConflictingActivityID:   activity.ID,
+				ConflictingActivityName: activity.Name,
+				OverlapStart:            overlapStart,
+				OverlapEnd:              overlapEnd,
+			})
+		}
+		running = append(running, activity)
+	}
+	return conflicts
+}
+
+// GetRoomConflicts lists every pair of event activities sharing a location, matched ignoring case,
+// whose time windows overlap
+func (s *ActivityService) GetRoomConflicts(admin models.User, eventSlug string) ([]models.RoomConflict, error) {
+	event, err := s.ActivityRepo.GetEventBySlug(eventSlug)
+	if err != nil {
+		return nil, errors.New("event not found: " + err.Error())
 	}
 
 	if !admin.IsSuperUser && event.CreatedBy != admin.ID {
 		adminStatus, err := s.ActivityRepo.GetUserAdminStatusBySlug(admin.ID, eventSlug)
 		if err != nil || (adminStatus.AdminType != models.AdminTypeMaster && adminStatus.AdminType != models.AdminTypeNormal) {
-			return nil, errors.New("unauthorized: only admins can get activity attendees")
+			return nil, errors.New("unauthorized: only admins can see room conflicts")
 		}
 	}
 
-	var registrations []models.ActivityRegistration
-	if registrations, err = s.ActivityRepo.GetActivityRegistrations(activityID); err != nil {
-		return nil, errors.New("failed to retrieve activity registrations: " + err.Error())
+	activities, err := s.ActivityRepo.GetEventActivitiesWithLocation(event.ID)
+	if err != nil {
+		return nil, errors.New("failed to get activities: " + err.Error())
 	}
 
-	return registrations, nil
-}
+	// Activities come sorted by start time, so each location keeps that order
+	var keys []string
+	byLocation := make(map[string][]models.Activity)
+	for _, activity := range activities {
+		key := normalizeName(activity.Location)
+		if _, ok := byLocation[key]; !ok {
+			keys = append(keys, key)
+		}
+		byLocation[key] = append(byLocation[key], activity)
+	}
 
-func (s *ActivityService) GetUserAccesses(userID string) ([]models.AccessTarget, error) {
-	return s.ActivityRepo.GetUserAccesses(userID)
+	conflicts := []models.RoomConflict{}
+	for _, key := range keys {
+		conflicts = append(conflicts, roomConflicts(byLocation[key])...)
+	}
+
+	return conflicts, nil
 }
 
-func (s *ActivityService) GetUserAccessesFromEvent(userID string, eventSlug string) ([]models.AccessTarget, error) {
+// SuggestRooms proposes a room for every event activity, hidden ones included. Activities are placed
+// greedily from the highest demand down, each in the smallest room that fits it and is free at that time
+func (s *ActivityService) SuggestRooms(admin models.User, eventSlug string, req models.SuggestRoomsRequest) (*models.RoomSuggestion, error) {
 	event, err := s.ActivityRepo.GetEventBySlug(eventSlug)
 	if err != nil {
 		return nil, errors.New("event not found: " + err.Error())
 	}
 
-	return s.ActivityRepo.GetUserAccessesFromEvent(userID, *event)
-}
+	if !admin.IsSuperUser && event.CreatedBy != admin.ID {
+		adminStatus, err := s.ActivityRepo.GetUserAdminStatusBySlug(admin.ID, eventSlug)
+		if err != nil || (adminStatus.AdminType != models.AdminTypeMaster && adminStatus.AdminType != models.AdminTypeNormal) {
+			return nil, errors.New("unauthorized: only admins can get room suggestions")
+		}
+	}
 
-func (s *ActivityService) GetUserActivities(user models.User) ([]models.Activity, error) {
-	userActivities, err := s.ActivityRepo.GetUserActivities(user.ID)
+	if len(req.Rooms) == 0 {
+		return nil, errors.New("at least one room is required")
+	}
+
+	seen := make(map[string]bool)
+	rooms := make([]models.RoomInput, 0, len(req.Rooms))
+	for _, room := range req.Rooms {
+		room.Name = strings.TrimSpace(room.Name)
+		if room.Name == "" {
+			return nil, errors.New("room name is required")
+		}
+		if room.Capacity <= 0 {
+			return nil, errors.New("room " + room.Name + " must have a positive capacity")
+		}
+		key := normalizeName(room.Name)
+		if seen[key] {
+			return nil, errors.New("room " + room.Name + " is repeated")
+		}
+		seen[key] = true
+		rooms = append(rooms, room)
+	}
+	sort.SliceStable(rooms, func(i, j int) bool { return rooms[i].Capacity < rooms[j].Capacity })
+
+	activities, err := s.ActivityRepo.GetEventActivities(event.ID)
 	if err != nil {
-		return nil, errors.New("error checking user activities: " + err.Error())
+		return nil, errors.New("failed to get activities: " + err.Error())
 	}
 
-	return userActivities, nil
+	snapshots, err := s.ActivityRepo.GetActivitiesCapacitySnapshot(event.ID)
+	if err != nil {
+		return nil, errors.New("failed to get registration counts: " + err.Error())
+	}
+	demand := make(map[string]int, len(snapshots))
+	for _, snapshot := range snapshots {
+		demand[snapshot.ActivityID] = snapshot.Registered + snapshot.Waitlisted
+	}
+
+	// Activities come sorted by start time, a stable sort keeps that order among equal demands
+	sort.SliceStable(activities, func(i, j int) bool { return demand[activities[i].ID] > demand[activities[j].ID] })
+
+	suggestion := &models.RoomSuggestion{
+		Assignments: []models.RoomAssignment{},
+		Unassigned:  []models.RoomAssignment{},
+	}
+	booked := make(map[string][]models.Activity, len(rooms))
+	for _, activity := range activities {
+		assignment := models.RoomAssignment{
+			ActivityID:      activity.ID,
+			Name:            activity.Name,
+			StartTime:       activity.StartTime,
+			EndTime:         activity.EndTime,
+			Demand:          demand[activity.ID],
+			CurrentLocation: activity.Location,
+		}
+
+		fitsAny := false
+		for _, room := range rooms {
+			if room.Capacity < assignment.Demand {
+				continue
+			}
+			fitsAny = true
+
+			free := true
+			for _, other := range booked[room.Name] {
+				if _, _, ok := overlapWindow(other.StartTime, other.EndTime, activity.StartTime, activity.EndTime); ok {
+					free = false
+					break
+				}
+			}
+			if !free {
+				continue
+			}
+
+			booked[room.Name] = append(booked[room.Name], activity)
+			assignment.Room = room.Name
+			assignment.RoomCapacity = room.Capacity
+			break
+		}
+
+		if assignment.Room != "" {
+			suggestion.Assignments = append(suggestion.Assignments, assignment)
+			continue
+		}
+
+		if fitsAny {
+			assignment.Reason = "every room large enough is taken at that time"
+		} else {
+			assignment.Reason = fmt.Sprintf("no room fits %d people", assignment.Demand)
+		}
+		suggestion.Unassigned = append(suggestion.Unassigned, assignment)
+	}
+
+	sort.SliceStable(suggestion.Assignments, func(i, j int) bool {
+		return suggestion.Assignments[i].StartTime.Before(suggestion.Assignments[j].StartTime)
+	})
+
+	return suggestion, nil
 }
 
-func (s *ActivityService) GetUserActivitiesFromEvent(user models.User, eventSlug string) ([]models.Activity, error) {
+// CheckActivitySlot lists the event activities running during a proposed time window, flagging the
+// ones in the same location. Locations are compared ignoring case and extra spaces
+func (s *ActivityService) CheckActivitySlot(admin models.User, eventSlug string, req models.CheckSlotRequest) (*models.SlotCheckResult, error) {
 	event, err := s.ActivityRepo.GetEventBySlug(eventSlug)
 	if err != nil {
 		return nil, errors.New("event not found: " + err.Error())
 	}
 
-	userActivities, err := s.ActivityRepo.GetUserActivities(user.ID)
+	if !admin.IsSuperUser && event.CreatedBy != admin.ID {
+		adminStatus, err := s.ActivityRepo.GetUserAdminStatusBySlug(admin.ID, eventSlug)
+		if err != nil || (adminStatus.AdminType != models.AdminTypeMaster && adminStatus.AdminType != models.AdminTypeNormal) {
+			return nil, errors.New("unauthorized: only admins can check activity slots")
+		}
+	}
+
+	if req.StartTime.IsZero() || req.EndTime.IsZero() {
+		return nil, errors.New("start_time and end_time are required")
+	}
+	if !req.StartTime.Before(req.EndTime) {
+		return nil, errors.New("start_time must be before end_time")
+	}
+
+	activities, err := s.ActivityRepo.GetEventActivitiesOverlapping(event.ID, req.StartTime, req.EndTime)
 	if err != nil {
-		return nil, errors.New("error checking user activities: " + err.Error())
+		return nil, errors.New("failed to get activities: " + err.Error())
 	}
 
-	var activities []models.Activity
-	for _, activity := range userActivities {
-		if activity.EventID == event.ID {
-			activities = append(activities, activity)
+	location := normalizeName(req.Location)
+	result := &models.SlotCheckResult{
+		Overlapping:     []models.SlotConflict{},
+		LocationClashes: []models.SlotConflict{},
+	}
+	for _, activity := range activities {
+		if activity.ID == req.ExcludeActivityID {
+			continue
+		}
+		overlapStart, overlapEnd, ok := overlapWindow(req.StartTime, req.EndTime, activity.StartTime, activity.EndTime)
+		if !ok {
+			continue
+		}
+
+		conflict := models.SlotConflict{
+			ActivityID:   activity.ID,
+			Name:         activity.Name,
+			Type:         activity.Type,
+			Speaker:      activity.Speaker,
+			Location:     activity.Location,
+			StartTime:    activity.StartTime,
+			EndTime:      activity.EndTime,
+			OverlapStart: overlapStart,
+			OverlapEnd:   overlapEnd,
+			SameLocation: location != "" && normalizeName(activity.Location) == location,
+		}
+		result.Overlapping = append(result.Overlapping, conflict)
+		if conflict.SameLocation {
+			result.LocationClashes = append(result.LocationClashes, conflict)
 		}
 	}
 
-	return activities, nil
+	return result, nil
 }
 
-func (s *ActivityService) GetActivityAttendants(admin models.User, eventSlug string, activityID string) ([]models.ActivityRegistration, error) {
+// GetConflictingActivities returns the user's registered activities overlapping the target one, with the same
+// palestra exemption as registration, and an empty list when there is no conflict
+func (s *ActivityService) GetConflictingActivities(user models.User, eventSlug string, activityID string) ([]models.Activity, error) {
 	event, err := s.ActivityRepo.GetEventBySlug(eventSlug)
 	if err != nil {
 		return nil, errors.New("event not found: " + err.Error())
@@ -608,55 +2614,118 @@ func (s *ActivityService) GetActivityAttendants(admin models.User, eventSlug str
 		return nil, errors.New("activity does not belong to this event")
 	}
 
-	if !admin.IsSuperUser && event.CreatedBy != admin.ID {
-		adminStatus, err := s.ActivityRepo.GetUserAdminStatusBySlug(admin.ID, eventSlug)
-		if err != nil || (adminStatus.AdminType != models.AdminTypeMaster && adminStatus.AdminType != models.AdminTypeNormal) {
-			return nil, errors.New("unauthorized: only admins can get activity attendants")
-		}
+	conflicts, err := s.conflictingActivities(user, activity)
+	if err != nil {
+		return nil, errors.New("couldn't get user activities: " + err.Error())
 	}
 
-	registrations, err := s.ActivityRepo.GetActivityRegistrations(activityID)
+	return conflicts, nil
+}
+
+// ExpireWaitlistPromotions releases unconfirmed promotions past their deadline
+// and offers those seats to the next users in line
+func (s *ActivityService) ExpireWaitlistPromotions() {
+	registrations, err := s.ActivityRepo.GetExpiredTentativeRegistrations(time.Now())
 	if err != nil {
-		return nil, errors.New("failed to retrieve activity attendants: " + err.Error())
+		log.Printf("Failed to get expired waitlist promotions: %v", err)
+		return
 	}
 
-	var attendants []models.ActivityRegistration
+	freedActivities := make(map[string]bool)
 	for _, registration := range registrations {
-		if registration.AttendedAt != nil {
-			attendants = append(attendants, registration)
+		if err := s.ActivityRepo.ReleaseWaitlistPromotion(registration.ActivityID, registration.UserID, true); err != nil {
+			log.Printf("Failed to expire waitlist promotion of user %s for activity %s: %v", registration.UserID, registration.ActivityID, err)
+			continue
 		}
+		freedActivities[registration.ActivityID] = true
 	}
 
-	return attendants, nil
+	for activityID := range freedActivities {
+		activity, err := s.ActivityRepo.GetActivityByID(activityID)
+		if err != nil {
+			log.Printf("Failed to get activity %s: %v", activityID, err)
+			continue
+		}
+		s.promoteFromWaitlist(activity)
+	}
 }
 
-func (s *ActivityService) GetUserAttendedActivities(user models.User) ([]models.Activity, error) {
-	userActivities, err := s.ActivityRepo.GetUserAttendedActivities(user.ID)
-	if err != nil {
-		return nil, errors.New("error getting user attended activities: " + err.Error())
+// StartWaitlistSweeper expires stale waitlist promotions every interval until ctx is done
+func (s *ActivityService) StartWaitlistSweeper(ctx context.Context, interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				s.ExpireWaitlistPromotions()
+			}
+		}
+	}()
+}
+
+// SendWaitlistPromotionEmail tells a user they got a seat from the waitlist. When the seat must
+// be confirmed, the email links to the frontend page {SITE_URL}/events/{slug}/activities?confirm={activity_id},
+// which is expected to call POST /events/{slug}/activity/confirm-waitlist/{id}
+func (s *ActivityService) SendWaitlistPromotionEmail(user *models.User, event *models.Event, activity *models.Activity, confirmBy *time.Time) error {
+	if os.Getenv("TEST_MODE") == "true" {
+		return nil
 	}
 
-	return userActivities, nil
-}
+	from := config.GetSystemEmail()
+	password := config.GetSystemEmailPass()
 
-func (s *ActivityService) GetAllAttendances(admin models.User, eventSlug string) ([]models.ActivityRegistration, error) {
-	event, err := s.ActivityRepo.GetEventBySlug(eventSlug)
+	templatePath := filepath.Join("templates", "waitlist_promotion_email.html")
+	file, err := os.Open(templatePath)
 	if err != nil {
-		return nil, errors.New("event not found: " + err.Error())
+		return fmt.Errorf("failed to open email template: %v", err)
 	}
+	defer file.Close()
 
-	// Check admin permissions
-	if !admin.IsSuperUser && event.CreatedBy != admin.ID {
-		adminStatus, err := s.ActivityRepo.GetUserAdminStatusBySlug(admin.ID, eventSlug)
-		if err != nil || (adminStatus.AdminType != models.AdminTypeMaster && adminStatus.AdminType != models.AdminTypeNormal) {
-			return nil, errors.New("unauthorized: only admins can get all attendances")
-		}
+	content, err := io.ReadAll(file)
+	if err != nil {
+		return fmt.Errorf("failed to read email template: %v", err)
 	}
 
-	attendances, err := s.ActivityRepo.GetAllAttendancesFromEvent(event.ID)
+	tmpl, err := template.New("emailTemplate").Parse(string(content))
 	if err != nil {
-		return nil, errors.New("failed to retrieve all attendances: " + err.Error())
+		return fmt.Errorf("failed to parse template: %v", err)
 	}
 
-	return attendances, nil
+	data := struct {
+		User       models.User
+		Event      models.Event
+		Activity   models.Activity
+		ConfirmBy  *time.Time
+		ConfirmURL string
+	}{
+		User:       *user,
+		Event:      *event,
+		Activity:   *activity,
+		ConfirmBy:  confirmBy,
+		ConfirmURL: fmt.Sprintf("%s/events/%s/activities?confirm=%s", config.GetSiteURL(), event.Slug, activity.ID),
+	}
+
+	var body strings.Builder
+	if err := tmpl.Execute(&body, data); err != nil {
+		return fmt.Errorf("failed to execute template: %v", err)
+	}
+
+	m := mail.NewMessage()
+	m.SetHeader("From", from)
+	m.SetHeader("To", user.Email)
+	m.SetHeader("Subject", "Vaga liberada em "+activity.Name)
+	m.SetBody("text/html", body.String())
+
+	d := mail.NewDialer("smtp.gmail.com", 587, from, password)
+	d.StartTLSPolicy = mail.MandatoryStartTLS
+
+	if err := d.DialAndSend(m); err != nil {
+		return fmt.Errorf("failed to send email: %v", err)
+	}
+
+	return nil
 }
@@ -1,6 +1,8 @@
 package services
 
 import (
+	"crypto/rand"
+	"encoding/base64"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -16,6 +18,7 @@ import (
 	"scti/internal/utilities"
 	"strconv"
 	"strings"
+	"sync"
 	"text/template"
 	"time"
 
@@ -28,15 +31,79 @@ import (
 type AuthService struct {
 	AuthRepo  *repos.AuthRepo
 	JWTSecret string
+
+	emailLimiter *emailRateLimiter
 }
 
 func NewAuthService(repo *repos.AuthRepo, secret string) *AuthService {
 	return &AuthService{
-		AuthRepo:  repo,
-		JWTSecret: secret,
+		AuthRepo:     repo,
+		JWTSecret:    secret,
+		emailLimiter: newEmailRateLimiter(config.GetEmailRateLimit(), config.GetEmailRateWindow()),
 	}
 }
 
+// EmailRateLimitError is returned when an address asked for too many password resets or verification codes
+type EmailRateLimitError struct {
+	RetryAfter time.Duration
+}
+
+func (e *EmailRateLimitError) Error() string {
+	return fmt.Sprintf("too many email requests for this address, try again in %d seconds", int(e.RetryAfter.Seconds())+1)
+}
+
+// emailRateLimiter lets each address ask for at most limit emails per window. Requests are tracked
+// in memory, which is enough for the single instance the API runs as
+type emailRateLimiter struct {
+	mutex    sync.Mutex
+	limit    int
+	window   time.Duration
+	requests map[string][]time.Time
+}
+
+func newEmailRateLimiter(limit int, window time.Duration) *emailRateLimiter {
+	return &emailRateLimiter{
+		limit:    limit,
+		window:   window,
+		requests: make(map[string][]time.Time),
+	}
+}
+
+// allow records a request for the address, or returns an EmailRateLimitError when it is over the limit
+func (l *emailRateLimiter) allow(email string) error {
+	if l == nil || l.limit <= 0 {
+		return nil
+	}
+
+	key := strings.ToLower(strings.TrimSpace(email))
+	now := time.Now()
+
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	// Forget requests that fell out of the window, for every address so the map doesn't keep growing
+	for address, times := range l.requests {
+		kept := times[:0]
+		for _, requestedAt := range times {
+			if now.Sub(requestedAt) < l.window {
+				kept = append(kept, requestedAt)
+			}
+		}
+		if len(kept) == 0 {
+			delete(l.requests, address)
+		} else {
+			l.requests[address] = kept
+		}
+	}
+
+	times := l.requests[key]
+	if len(times) >= l.limit {
+		return &EmailRateLimitError{RetryAfter: l.window - now.Sub(times[0])}
+	}
+	l.requests[key] = append(times, now)
+	return nil
+}
+
 func (s *AuthService) Register(email, password, name, last_name string, isUenf bool, uenfSemester int) error {
 	if email == "" || password == "" || name == "" || last_name == "" {
 		return errors.New("all fields are required")
@@ -317,6 +384,25 @@ func (s *AuthService) GenerateTokenPair(user models.User, r *http.Request) (stri
 	return accessToken, refreshToken, nil
 }
 
+// RefreshClaims issues a new token pair built from the user's current flags and admin statuses
+// and revokes the refresh token it replaces
+func (s *AuthService) RefreshClaims(user models.User, refreshTokenString string, r *http.Request) (string, string, error) {
+	if _, err := s.AuthRepo.FindRefreshToken(user.ID, refreshTokenString); err != nil {
+		return "", "", errors.New("refresh token not found")
+	}
+
+	accessToken, refreshToken, err := s.GenerateTokenPair(user, r)
+	if err != nil {
+		return "", "", err
+	}
+
+	if err := s.Logout(user.ID, refreshTokenString); err != nil {
+		return "", "", err
+	}
+
+	return accessToken, refreshToken, nil
+}
+
 func (s *AuthService) GenerateAcessToken(user models.User) (string, error) {
 	adminMap, err := s.MakeJSONAdminMap(user.ID)
 	if err != nil && err.Error() != "user has no admin status" {
@@ -378,9 +464,14 @@ func (s *AuthService) FindRefreshToken(userID, tokenStr string) (*models.Refresh
 }
 
 func (s *AuthService) GeneratePasswordResetToken(userID string) (string, error) {
+	return s.generatePasswordToken(userID, 15*time.Minute)
+}
+
+// generatePasswordToken signs a token accepted by the change-password endpoint
+func (s *AuthService) generatePasswordToken(userID string, ttl time.Duration) (string, error) {
 	claims := &models.PasswordResetClaims{
 		RegisteredClaims: jwt.RegisteredClaims{
-			ExpiresAt: jwt.NewNumericDate(time.Now().Add(15 * time.Minute)),
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(ttl)),
 			IssuedAt:  jwt.NewNumericDate(time.Now()),
 		},
 		UserID:          userID,
@@ -442,6 +533,11 @@ func (s *AuthService) SendPasswordResetEmail(user *models.User, resetToken strin
 }
 
 func (s *AuthService) InitiatePasswordReset(email string) error {
+	// Counted before the lookup, unknown addresses are limited the same way as existing ones
+	if err := s.emailLimiter.allow(email); err != nil {
+		return err
+	}
+
 	user, err := s.AuthRepo.FindUserByEmail(email)
 	if err != nil {
 		return errors.New("user not found")
@@ -461,6 +557,170 @@ func (s *AuthService) InitiatePasswordReset(email string) error {
 	return nil
 }
 
+const (
+	maxUserImportRows = 500
+	inviteTokenTTL    = 7 * 24 * time.Hour
+)
+
+// ImportUsers pre-creates unverified accounts with a random password, every created user
+// gets an invite to set their own password. Existing emails are skipped, never updated
+func (s *AuthService) ImportUsers(requester models.User, rows []models.UserImportRow) ([]models.UserImportResult, error) {
+	if !requester.IsSuperUser {
+		return nil, errors.New("unauthorized: only super users can import users")
+	}
+
+	if len(rows) == 0 {
+		return nil, errors.New("no users to import")
+	}
+
+	if len(rows) > maxUserImportRows {
+		return nil, fmt.Errorf("too many users, at most %d can be imported at once", maxUserImportRows)
+	}
+
+	emails := make([]string, len(rows))
+	for i, row := range rows {
+		emails[i] = strings.TrimSpace(strings.ToLower(row.Email))
+	}
+
+	existing, err := s.AuthRepo.GetExistingEmails(emails)
+	if err != nil {
+		return nil, errors.New("failed to check existing users: " + err.Error())
+	}
+
+	results := make([]models.UserImportResult, len(rows))
+	seen := make(map[string]bool, len(rows))
+	var users []*models.User
+	for i, row := range rows {
+		email := emails[i]
+		results[i].Email = email
+
+		switch {
+		case email == "" || strings.TrimSpace(row.Name) == "" || strings.TrimSpace(row.LastName) == "":
+			results[i].Message = "email, name and last name are required"
+			continue
+		case !utilities.IsValidEmail(email):
+			results[i].Message = "invalid email format"
+			continue
+		case existing[email]:
+			results[i].Message = "user already exists"
+			continue
+		case seen[email]:
+			results[i].Message = "duplicated email in import"
+			continue
+		}
+		seen[email] = true
+
+		password, err := randomPassword()
+		if err != nil {
+			return nil, errors.New("failed to generate password: " + err.Error())
+		}
+
+		hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+		if err != nil {
+			return nil, err
+		}
+
+		userID := uuid.New().String()
+		users = append(users, &models.User{
+			ID:         userID,
+			Name:       strings.TrimSpace(row.Name),
+			LastName:   strings.TrimSpace(row.LastName),
+			Email:      email,
+			IsVerified: false,
+			UserPass: models.UserPass{
+				ID:       userID,
+				Password: string(hashedPassword),
+			},
+		})
+		results[i].UserID = userID
+		results[i].Created = true
+	}
+
+	if len(users) == 0 {
+		return results, nil
+	}
+
+	if err := s.AuthRepo.CreateUsers(users); err != nil {
+		return nil, err
+	}
+
+	go func() {
+		for _, user := range users {
+			if err := s.SendAccountInviteEmail(user); err != nil {
+				log.Printf("Failed to send account invite email to %s: %v", user.Email, err)
+			}
+		}
+	}()
+
+	return results, nil
+}
+
+func randomPassword() (string, error) {
+	buf := make([]byte, 24)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(buf), nil
+}
+
+func (s *AuthService) SendAccountInviteEmail(user *models.User) error {
+	// Skip email sending in test mode
+	if os.Getenv("TEST_MODE") == "true" {
+		return nil
+	}
+
+	from := config.GetSystemEmail()
+	password := config.GetSystemEmailPass()
+
+	smtpHost := "smtp.gmail.com"
+	smtpPort := "587"
+
+	inviteToken, err := s.generatePasswordToken(user.ID, inviteTokenTTL)
+	if err != nil {
+		return fmt.Errorf("failed to generate invite token: %v", err)
+	}
+
+	templatePath := filepath.Join("templates", "account_invite_email.html")
+	file, err := os.Open(templatePath)
+	if err != nil {
+		return fmt.Errorf("failed to open email template: %v", err)
+	}
+	defer file.Close()
+
+	content, err := io.ReadAll(file)
+	if err != nil {
+		return fmt.Errorf("failed to read email template: %v", err)
+	}
+
+	tmpl, err := template.New("inviteTemplate").Parse(string(content))
+	if err != nil {
+		return fmt.Errorf("failed to parse template: %v", err)
+	}
+
+	data := struct {
+		UserName     string
+		SetLink      string
+		SupportEmail string
+	}{
+		UserName:     user.Name + " " + user.LastName,
+		SetLink:      fmt.Sprintf("%s/change-password?token=%s", config.GetSiteURL(), inviteToken),
+		SupportEmail: config.GetSystemEmail(),
+	}
+
+	var body strings.Builder
+	if err := tmpl.Execute(&body, data); err != nil {
+		return fmt.Errorf("failed to execute template: %v", err)
+	}
+
+	subject := "Sua conta SCTI foi criada"
+	message := []byte(fmt.Sprintf(
+		"Subject: %s\r\nMIME-version: 1.0;\r\nContent-Type: text/html; charset=\"UTF-8\";\r\n\r\n%s",
+		subject, body.String()))
+
+	auth := smtp.PlainAuth("", from, password, smtpHost)
+	return smtp.SendMail(smtpHost+":"+smtpPort, auth, from, []string{user.Email}, message)
+}
+
 func (s *AuthService) ChangePassword(userID string, newPassword string) error {
 	if newPassword == "" {
 		return errors.New("new password cannot be empty")
@@ -474,6 +734,54 @@ func (s *AuthService) ChangePassword(userID string, newPassword string) error {
 	return s.AuthRepo.UpdateUserPassword(userID, string(hashedPassword))
 }
 
+// RotateSuperPassword changes the super user's password and logs it out everywhere
+func (s *AuthService) RotateSuperPassword(requester models.User, currentPassword, newPassword string) error {
+	if !requester.IsSuperUser {
+		return errors.New("unauthorized: only super users can rotate the super user password")
+	}
+
+	superUser, err := s.AuthRepo.FindUserByEmail(config.GetSystemEmail())
+	if err != nil {
+		return errors.New("super user not found: " + err.Error())
+	}
+
+	if err := bcrypt.CompareHashAndPassword([]byte(superUser.UserPass.Password), []byte(currentPassword)); err != nil {
+		return errors.New("invalid current password")
+	}
+
+	if currentPassword == newPassword {
+		return errors.New("new password must be different from the current one")
+	}
+
+	if err := utilities.ValidatePasswordPolicy(newPassword); err != nil {
+		return err
+	}
+
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(newPassword), bcrypt.DefaultCost)
+	if err != nil {
+		return err
+	}
+
+	if err := s.AuthRepo.RotatePassword(superUser.ID, string(hashedPassword)); err != nil {
+		return errors.New("failed to rotate password: " + err.Error())
+	}
+
+	return nil
+}
+
+func eventCreatorAudit(requester models.User, target models.User, isEventCreator bool) models.AuditLog {
+	action := models.AuditEventCreatorRevoked
+	if isEventCreator {
+		action = models.AuditEventCreatorGranted
+	}
+	return models.AuditLog{
+		ID:       uuid.New().String(),
+		ActorID:  requester.ID,
+		Action:   action,
+		TargetID: &target.ID,
+	}
+}
+
 // SwitchEventCreatorStatus toggles the event creator status for a user
 // Only superusers can use this functionality
 func (s *AuthService) SwitchEventCreatorStatus(requester models.User, targetUserEmail string) error {
@@ -486,9 +794,10 @@ func (s *AuthService) SwitchEventCreatorStatus(requester models.User, targetUser
 		return errors.New("target user not found: " + err.Error())
 	}
 
-	targetUser.IsEventCreator = !targetUser.IsEventCreator
+	isEventCreator := !targetUser.IsEventCreator
+	audit := eventCreatorAudit(requester, targetUser, isEventCreator)
 
-	err = s.AuthRepo.UpdateUser(&targetUser)
+	err = s.AuthRepo.SetEventCreatorStatus([]string{targetUser.ID}, isEventCreator, []models.AuditLog{audit})
 	if err != nil {
 		return errors.New("failed to update user: " + err.Error())
 	}
@@ -496,6 +805,92 @@ func (s *AuthService) SwitchEventCreatorStatus(requester models.User, targetUser
 	return nil
 }
 
+func (s *AuthService) GetEventCreators(requester models.User) ([]models.EventCreator, error) {
+	if !requester.IsSuperUser {
+		return nil, errors.New("unauthorized: only super users can list event creators")
+	}
+
+	creators, err := s.AuthRepo.GetEventCreators()
+	if err != nil {
+		return nil, errors.New("failed to get event creators: " + err.Error())
+	}
+	if creators == nil {
+		return []models.EventCreator{}, nil
+	}
+	return creators, nil
+}
+
+const maxEventCreatorGrants = 100
+
+// GrantEventCreatorStatus lets every user of the list create events, reporting each email.
+// Users that already are event creators are reported as such and not audited again
+func (s *AuthService) GrantEventCreatorStatus(requester models.User, emails []string) ([]models.EventCreatorGrantResult, error) {
+	if !requester.IsSuperUser {
+		return nil, errors.New("unauthorized: only super users can grant event creator status")
+	}
+
+	if len(emails) == 0 {
+		return nil, errors.New("no emails to grant")
+	}
+
+	if len(emails) > maxEventCreatorGrants {
+		return nil, fmt.Errorf("too many emails, at most %d can be granted at once", maxEventCreatorGrants)
+	}
+
+	for i, email := range emails {
+		emails[i] = strings.TrimSpace(strings.ToLower(email))
+	}
+
+	users, err := s.AuthRepo.GetUsersByEmails(emails)
+	if err != nil {
+		return nil, errors.New("failed to find users: " + err.Error())
+	}
+
+	usersByEmail := make(map[string]models.User, len(users))
+	for _, user := range users {
+		usersByEmail[strings.ToLower(user.Email)] = user
+	}
+
+	results := make([]models.EventCreatorGrantResult, len(emails))
+	seen := make(map[string]bool, len(emails))
+	var userIDs []string
+	var audits []models.AuditLog
+	for i, email := range emails {
+		results[i].Email = email
+
+		user, ok := usersByEmail[email]
+		switch {
+		case !ok:
+			results[i].Message = "user not found"
+			continue
+		case seen[email]:
+			results[i].Message = "duplicated email"
+			continue
+		}
+		seen[email] = true
+		results[i].UserID = user.ID
+		results[i].Success = true
+
+		if user.IsEventCreator {
+			results[i].Message = "already an event creator"
+			continue
+		}
+
+		userIDs = append(userIDs, user.ID)
+		audits = append(audits, eventCreatorAudit(requester, user, true))
+	}
+
+	if len(userIDs) == 0 {
+		return results, nil
+	}
+
+	if err := s.AuthRepo.SetEventCreatorStatus(userIDs, true, audits); err != nil {
+		return nil, errors.New("failed to grant event creator status: " + err.Error())
+	}
+
+	return results, nil
+}
+
 func (s *AuthService) ChangeUserName(user models.User, name, lastName string) error {
 	if name == "" {
 		return errors.New("name can't be empty")
@@ -511,6 +906,10 @@ func (s *AuthService) ChangeUserName(user models.User, name, lastName string) er
 }
 
 func (s *AuthService) ResendVerificationCode(user *models.User) error {
+	if err := s.emailLimiter.allow(user.Email); err != nil {
+		return err
+	}
+
 	verificationNumber := utilities.GenerateVerificationCode()
 	if err := s.AuthRepo.UpdateUserVerification(user.ID, verificationNumber); err != nil {
 		return err
@@ -524,3 +923,84 @@ func (s *AuthService) ResendVerificationCode(user *models.User) error {
 
 	return nil
 }
+
+const (
+	maxVerificationResendBatch = 200
+	verificationResendCooldown = time.Hour
+	verificationResendInterval = 500 * time.Millisecond
+)
+
+func (s *AuthService) GetUnverifiedUsers(requester models.User, olderThan time.Duration, page, pageSize int) (*models.UnverifiedUserList, error) {
+	if !requester.IsSuperUser {
+		return nil, errors.New("unauthorized: only super users can list unverified users")
+	}
+	if olderThan < 0 {
+		return nil, errors.New("older_than can't be negative")
+	}
+
+	users, total, err := s.AuthRepo.GetUnverifiedUsers(time.Now().Add(-olderThan), (page-1)*pageSize, pageSize)
+	if err != nil {
+		return nil, errors.New("failed to get unverified users: " + err.Error())
+	}
+	if users == nil {
+		users = []models.UnverifiedUser{}
+	}
+
+	return &models.UnverifiedUserList{
+		Users:    users,
+		Page:     page,
+		PageSize: pageSize,
+		Total:    total,
+	}, nil
+}
+
+// ResendVerificationToUnverified sends a new code to the unverified users older than olderThan.
+// Users that got a code in the last hour are skipped and each call handles at most
+// maxVerificationResendBatch users, the emails go out one at a time to spare the SMTP server
+func (s *AuthService) ResendVerificationToUnverified(requester models.User, olderThan time.Duration) (*models.BulkResendVerificationResult, error) {
+	if !requester.IsSuperUser {
+		return nil, errors.New("unauthorized: only super users can resend verification codes in bulk")
+	}
+	if olderThan < 0 {
+		return nil, errors.New("older_than can't be negative")
+	}
+
+	now := time.Now()
+	createdBefore := now.Add(-olderThan)
+	sentBefore := now.Add(-verificationResendCooldown)
+
+	cooldown, err := s.AuthRepo.CountUnverifiedUsersInCooldown(createdBefore, sentBefore)
+	if err != nil {
+		return nil, errors.New("failed to count recently notified users: " + err.Error())
+	}
+
+	users, eligible, err := s.AuthRepo.GetUnverifiedUsersToNotify(createdBefore, sentBefore, maxVerificationResendBatch)
+	if err != nil {
+		return nil, errors.New("failed to get unverified users: " + err.Error())
+	}
+
+	codes := make([]int, len(users))
+	for i := range users {
+		codes[i] = utilities.GenerateVerificationCode()
+		if err := s.AuthRepo.UpdateUserVerification(users[i].ID, codes[i]); err != nil {
+			return nil, errors.New("failed to store verification code for " + users[i].Email + ": " + err.Error())
+		}
+	}
+
+	go func() {
+		for i := range users {
+			if i > 0 {
+				time.Sleep(verificationResendInterval)
+			}
+			if err := s.SendVerificationEmail(&users[i], codes[i]); err != nil {
+				log.Printf("Failed to resend verification email to %s: %v", users[i].Email, err)
+			}
+		}
+	}()
+
+	return &models.BulkResendVerificationResult{
+		Queued:    len(users),
+		Remaining: eligible - int64(len(users)),
+		Cooldown:  cooldown,
+	}, nil
+}
@@ -1,15 +1,25 @@
 package services
 
 import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
+	"math"
 	"os"
 	"path/filepath"
 	"scti/config"
 	"scti/internal/models"
 	repos "scti/internal/repositories"
+	"sort"
 	"strings"
+	"sync"
 	"text/template"
 	"time"
 
@@ -30,9 +40,9 @@ func NewEventService(repo *repos.EventRepo) *EventService {
 	}
 }
 
-func (s *EventService) CreateEvent(user models.User, body models.CreateEventRequest) (*models.Event, error) {
+func (s *EventService) CreateEvent(user models.User, body models.CreateEventRequest) (*models.Event, []models.VenueConflict, error) {
 	if !user.IsEventCreator && !user.IsSuperUser {
-		return nil, errors.New("only super users or event creators can create events")
+		return nil, nil, errors.New("only super users or event creators can create events")
 	}
 
 	var event models.Event
@@ -40,17 +50,18 @@ func (s *EventService) CreateEvent(user models.User, body models.CreateEventRequ
 	event.CreatedBy = user.ID
 
 	if body.Slug == "" {
-		return nil, errors.New("event slug can't be empty")
+		return nil, nil, errors.New("event slug can't be empty")
 	}
 
 	if body.EndDate.Before(body.StartDate) {
-		return nil, errors.New("event end can't be before event start")
+		return nil, nil, errors.New("event end can't be before event start")
 	}
 
 	event.Name = body.Name
 	event.Slug = strings.ToLower(body.Slug)
 	event.Description = body.Description
 	event.Location = body.Location
+	event.Venue = strings.TrimSpace(body.Venue)
 	event.StartDate = body.StartDate
 	event.EndDate = body.EndDate
 	event.IsPublic = true
@@ -58,50 +69,117 @@ func (s *EventService) CreateEvent(user models.User, body models.CreateEventRequ
 	event.IsBlocked = body.IsBlocked
 	event.MaxTokensPerUser = body.MaxTokensPerUser
 
-	err := s.EventRepo.CreateEvent(&event)
-	return &event, err
+	if err := s.EventRepo.CreateEvent(&event); err != nil {
+		return nil, nil, err
+	}
+
+	return &event, s.venueConflicts(event), nil
 }
 
 func (s *EventService) GetEvent(slug string) (*models.Event, error) {
 	return s.EventRepo.GetEventBySlug(slug)
 }
 
-func (s *EventService) GetAllEvents() ([]models.Event, error) {
-	return s.EventRepo.GetAllEvents()
+// GetAllEvents lists the visible events in the filter range, a page of 0 returns all of them at once
+func (s *EventService) GetAllEvents(filter models.EventFilter, page, pageSize int) (*models.EventList, error) {
+	if filter.From != nil && filter.To != nil && filter.To.Before(*filter.From) {
+		return nil, errors.New("to_date must not be before from_date")
+	}
+
+	offset, limit := 0, 0
+	if page > 0 {
+		offset, limit = (page-1)*pageSize, pageSize
+	}
+
+	events, total, err := s.EventRepo.GetAllEvents(filter, offset, limit)
+	if err != nil {
+		return nil, err
+	}
+
+	return &models.EventList{
+		Items:      events,
+		Page:       page,
+		PageSize:   pageSize,
+		TotalCount: total,
+	}, nil
 }
 
-func (s *EventService) UpdateEvent(user models.User, slug string, newData *models.UpdateEventRequest) (*models.Event, error) {
+func (s *EventService) UpdateEvent(user models.User, slug string, newData *models.UpdateEventRequest) (*models.Event, []models.VenueConflict, error) {
 	event, err := s.EventRepo.GetEventBySlug(slug)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 
 	if !user.IsSuperUser {
 		if event.CreatedBy != user.ID {
-			return nil, errors.New("event can only be edited by its creator")
+			return nil, nil, errors.New("event can only be edited by its creator")
 		}
 	}
 
 	if newData.Slug == "" {
-		return nil, errors.New("event slug can't be empty")
+		return nil, nil, errors.New("event slug can't be empty")
 	}
 
 	if newData.EndDate.Before(newData.StartDate) {
-		return nil, errors.New("event end can't be before event start")
+		return nil, nil, errors.New("event end can't be before event start")
 	}
 
 	event.Name = newData.Name
 	event.Slug = strings.ToLower(newData.Slug)
 	event.Description = newData.Description
 	event.Location = newData.Location
+	event.Venue = strings.TrimSpace(newData.Venue)
 	event.StartDate = newData.StartDate
 	event.EndDate = newData.EndDate
 	event.IsHidden = newData.IsHidden
 	event.IsBlocked = newData.IsBlocked
 	event.MaxTokensPerUser = newData.MaxTokensPerUser
 
-	err = s.EventRepo.UpdateEvent(event)
-	return event, err
+	if err := s.EventRepo.UpdateEvent(event); err != nil {
+		return nil, nil, err
+	}
+
+	return event, s.venueConflicts(*event), nil
+}
+
+// venueConflicts looks for other events booked at the same venue, the check is only a warning
+// so a failed lookup is logged instead of failing the save
+func (s *EventService) venueConflicts(event models.Event) []models.VenueConflict {
+	if event.Venue == "" {
+		return nil
+	}
+
+	conflicts, err := s.EventRepo.GetVenueEventsOverlapping(event.Venue, event.StartDate, event.EndDate, event.ID)
+	if err != nil {
+		fmt.Printf("Failed to check venue conflicts of event %s: %v\n", event.Slug, err)
+		return nil
+	}
+	return conflicts
+}
+
+// GetVenueConflicts lists the events held at the venue during the period, for event creators planning a new event
+func (s *EventService) GetVenueConflicts(user models.User, venue string, from, to time.Time) ([]models.VenueConflict, error) {
+	if !user.IsEventCreator && !user.IsSuperUser {
+		return nil, errors.New("unauthorized: only super users or event creators can check venue conflicts")
+	}
+
+	venue = strings.TrimSpace(venue)
+	if venue == "" {
+		return nil, errors.New("venue can't be empty")
+	}
+	if !from.Before(to) {
+		return nil, errors.New("from must be before to")
+	}
+
+	conflicts, err := s.EventRepo.GetVenueEventsOverlapping(venue, from, to, "")
+	if err != nil {
+		return nil, errors.New("failed to get venue events: " + err.Error())
+	}
+	if conflicts == nil {
+		conflicts = []models.VenueConflict{}
+	}
+
+	return conflicts, nil
 }
 
 func (s *EventService) DeleteEvent(user models.User, slug string) error {
@@ -161,12 +239,6 @@ func (s *EventService) RegisterUserToEvent(user models.User, slug string) error
 		RegisteredAt: time.Now(),
 	}
 
-	go func() {
-		if err := s.SendRegistrationEmail(&user, event); err != nil {
-			fmt.Printf("Failed to send registration email: %v\n", err)
-		}
-	}()
-
 	event.ParticipantCount++
 	s.EventRepo.UpdateEvent(event)
 
@@ -194,7 +266,22 @@ func (s *EventService) RegisterUserToEvent(user models.User, slug string) error
 		}
 	}()
 
-	return s.EventRepo.CreateEventRegistration(&registration)
+	if err := s.EventRepo.CreateEventRegistration(&registration); err != nil {
+		return err
+	}
+
+	// The email only goes out once the registration exists, so its outcome can be recorded on it
+	go func() {
+		sendErr := s.SendRegistrationEmail(&user, event)
+		if sendErr != nil {
+			fmt.Printf("Failed to send registration email: %v\n", sendErr)
+		}
+		if err := s.EventRepo.SetRegistrationEmailOutcome(event.ID, user.ID, sendErr); err != nil {
+			fmt.Printf("Failed to record registration email outcome: %v\n", err)
+		}
+	}()
+
+	return nil
 }
 
 func (s *EventService) SendRegistrationEmail(user *models.User, event *models.Event) error {
@@ -214,22 +301,52 @@ func (s *EventService) SendRegistrationEmail(user *models.User, event *models.Ev
 	timestamp := time.Now().Unix()
 	filename := fmt.Sprintf("%s_%s_%d", safeFirstName, safeLastName, timestamp)
 
+	body, err := renderRegistrationEmail(user, event, filename)
+	if err != nil {
+		return err
+	}
+
+	// Create email using gomail
+	m := mail.NewMessage()
+	m.SetHeader("From", from)
+	m.SetHeader("To", user.Email)
+	m.SetHeader("Subject", "Registration to "+event.Name)
+	m.SetBody("text/html", body)
+
+	// Embed the QR code image
+	m.EmbedReader(filename, strings.NewReader(string(png)))
+
+	// Create dialer
+	d := mail.NewDialer("smtp.gmail.com", 587, from, password)
+	d.StartTLSPolicy = mail.MandatoryStartTLS
+
+	// Send email
+	if err := d.DialAndSend(m); err != nil {
+		return fmt.Errorf("failed to send email: %v", err)
+	}
+
+	return nil
+}
+
+// renderRegistrationEmail executes the registration email template, the QR code
+// is referenced through the cid of the given filename
+func renderRegistrationEmail(user *models.User, event *models.Event, filename string) (string, error) {
 	// Read the template
 	templatePath := filepath.Join("templates", "registration_email.html")
 	file, err := os.Open(templatePath)
 	if err != nil {
-		return fmt.Errorf("failed to open email template: %v", err)
+		return "", fmt.Errorf("failed to open email template: %v", err)
 	}
 	defer file.Close()
 
 	content, err := io.ReadAll(file)
 	if err != nil {
-		return fmt.Errorf("failed to read email template: %v", err)
+		return "", fmt.Errorf("failed to read email template: %v", err)
 	}
 
 	tmpl, err := template.New("emailTemplate").Parse(string(content))
 	if err != nil {
-		return fmt.Errorf("failed to parse template: %v", err)
+		return "", fmt.Errorf("failed to parse template: %v", err)
 	}
 
 	// Prepare template data with filename for QR code
@@ -245,32 +362,44 @@ func (s *EventService) SendRegistrationEmail(user *models.User, event *models.Ev
 
 	var body strings.Builder
 	if err := tmpl.Execute(&body, data); err != nil {
-		return fmt.Errorf("failed to execute template: %v", err)
+		return "", fmt.Errorf("failed to execute template: %v", err)
 	}
 
-	// Create email using gomail
-	m := mail.NewMessage()
-	m.SetHeader("From", from)
-	m.SetHeader("To", user.Email)
-	m.SetHeader("Subject", "Registration to "+event.Name)
-	m.SetBody("text/html", body.String())
+	return body.String(), nil
+}
 
-	// Embed the QR code image
-	m.EmbedReader(filename, strings.NewReader(string(png)))
+// PreviewRegistrationEmail renders the registration email with the admin's own data
+// and an inline sample QR code, nothing is sent
+func (s *EventService) PreviewRegistrationEmail(admin models.User, eventSlug string) (string, error) {
+	event, err := s.EventRepo.GetEventBySlug(eventSlug)
+	if err != nil {
+		return "", errors.New("event not found: " + err.Error())
+	}
 
-	// Create dialer
-	d := mail.NewDialer("smtp.gmail.com", 587, from, password)
-	d.StartTLSPolicy = mail.MandatoryStartTLS
+	if !admin.IsSuperUser && event.CreatedBy != admin.ID {
+		adminStatus, err := s.EventRepo.GetUserAdminStatusBySlug(admin.ID, eventSlug)
+		if err != nil || (adminStatus.AdminType != models.AdminTypeMaster && adminStatus.AdminType != models.AdminTypeNormal) {
+			return "", errors.New("unauthorized: only admins can preview the registration email")
+		}
+	}
 
-	// Send email
-	if err := d.DialAndSend(m); err != nil {
-		return fmt.Errorf("failed to send email: %v", err)
+	png, err := qrcode.Encode(admin.ID, qrcode.Medium, 256)
+	if err != nil {
+		return "", fmt.Errorf("failed to generate QR code: %v", err)
 	}
 
-	return nil
+	filename := "preview_qrcode"
+	body, err := renderRegistrationEmail(&admin, event, filename)
+	if err != nil {
+		return "", err
+	}
+
+	// Browsers can't resolve cid references, inline the QR code instead
+	dataURI := "data:image/png;base64," + base64.StdEncoding.EncodeToString(png)
+	return strings.ReplaceAll(body, "cid:"+filename, dataURI), nil
 }
 
-func (s *EventService) UnregisterUserFromEvent(user models.User, slug string) error {
+func (s *EventService) UnregisterUserFromEvent(user models.User, slug string, reason string) error {
 	event, err := s.EventRepo.GetEventBySlug(slug)
 	if err != nil {
 		return err
@@ -304,12 +433,56 @@ func (s *EventService) UnregisterUserFromEvent(user models.User, slug string) er
 		return errors.New("cannot unregister from event where you attended activities")
 	}
 
+	reason = strings.TrimSpace(reason)
+	if len([]rune(reason)) > maxCancellationReasonLength {
+		return fmt.Errorf("reason can't be longer than %d characters", maxCancellationReasonLength)
+	}
+
 	if event.ParticipantCount > 0 {
 		event.ParticipantCount--
 		s.EventRepo.UpdateEvent(event)
 	}
 
-	return s.EventRepo.DeleteEventRegistration(user.ID, event.ID)
+	return s.EventRepo.CancelEventRegistration(&models.RegistrationCancellation{
+		ID:      uuid.New().String(),
+		EventID: event.ID,
+		UserID:  user.ID,
+		Reason:  reason,
+	})
+}
+
+const maxCancellationReasonLength = 500
+
+// GetCancellationReasons sums up why users left the event
+func (s *EventService) GetCancellationReasons(admin models.User, eventSlug string) (*models.CancellationReasons, error) {
+	event, err := s.EventRepo.GetEventBySlug(eventSlug)
+	if err != nil {
+		return nil, errors.New("event not found: " + err.Error())
+	}
+
+	if !admin.IsSuperUser && event.CreatedBy != admin.ID {
+		adminStatus, err := s.EventRepo.GetUserAdminStatusBySlug(admin.ID, eventSlug)
+		if err != nil || (adminStatus.AdminType != models.AdminTypeMaster && adminStatus.AdminType != models.AdminTypeNormal) {
+			return nil, errors.New("unauthorized: only admins can see cancellation reasons")
+		}
+	}
+
+	counts, err := s.EventRepo.GetCancellationReasonCounts(event.ID)
+	if err != nil {
+		return nil, errors.New("failed to get cancellation reasons: " + err.Error())
+	}
+
+	result := &models.CancellationReasons{Reasons: []models.CancellationReasonCount{}}
+	for _, count := range counts {
+		result.Total += count.Count
+		if count.Reason == "" {
+			result.WithoutReason = count.Count
+			continue
+		}
+		result.Reasons = append(result.Reasons, count)
+	}
+
+	return result, nil
 }
 
 func (s *EventService) IsUserRegisteredToEvent(user models.User, slug string) (bool, error) {
@@ -455,11 +628,61 @@ func (s *EventService) GetEventsCreatedByUser(user models.User) ([]models.Event,
 	return s.EventRepo.GetEventsCreatedByUser(user.ID)
 }
 
+// GetManageableEvents returns the events the user may create products and activities for
+func (s *EventService) GetManageableEvents(user models.User) ([]models.Event, error) {
+	if user.IsSuperUser {
+		events, _, err := s.EventRepo.GetAllEvents(models.EventFilter{}, 0, 0)
+		return events, err
+	}
+	return s.EventRepo.GetManageableEvents(user.ID)
+}
+
 func (s *EventService) GetUserEvents(user models.User) ([]models.Event, error) {
 	return s.EventRepo.GetUserEvents(user.ID)
 }
 
-func (s *EventService) GetAllAttendances(admin models.User, eventSlug string) ([]models.ActivityRegistration, error) {
+func (s *EventService) GetUserUpcomingEvents(user models.User) ([]models.Event, error) {
+	return s.EventRepo.GetUserEventsByEndDate(user.ID, time.Now(), false)
+}
+
+func (s *EventService) GetUserPastEvents(user models.User) ([]models.Event, error) {
+	return s.EventRepo.GetUserEventsByEndDate(user.ID, time.Now(), true)
+}
+
+// GetUserUnregisteredAccessEvents returns the events the user has products or tokens for but never
+// registered to, access they can't use until they do
+func (s *EventService) GetUserUnregisteredAccessEvents(user models.User) ([]models.Event, error) {
+	accessEventIDs, err := s.EventRepo.GetUserAccessEventIDs(user.ID)
+	if err != nil {
+		return nil, errors.New("failed to get user access: " + err.Error())
+	}
+
+	registeredEvents, err := s.EventRepo.GetUserEvents(user.ID)
+	if err != nil {
+		return nil, errors.New("failed to get user events: " + err.Error())
+	}
+
+	registered := make(map[string]bool, len(registeredEvents))
+	for _, event := range registeredEvents {
+		registered[event.ID] = true
+	}
+
+	var unregistered []string
+	for _, eventID := range accessEventIDs {
+		if !registered[eventID] {
+			unregistered = append(unregistered, eventID)
+		}
+	}
+
+	if len(unregistered) == 0 {
+		return []models.Event{}, nil
+	}
+
+	return s.EventRepo.GetEventsByIDs(unregistered)
+}
+
+// attendancesEvent loads the event checking the admin may read all of its attendances
+func (s *EventService) attendancesEvent(admin models.User, eventSlug string) (*models.Event, error) {
 	event, err := s.EventRepo.GetEventBySlug(eventSlug)
 	if err != nil {
 		return nil, errors.New("event not found: " + err.Error())
@@ -473,6 +696,15 @@ func (s *EventService) GetAllAttendances(admin models.User, eventSlug string) ([
 		}
 	}
 
+	return event, nil
+}
+
+func (s *EventService) GetAllAttendances(admin models.User, eventSlug string) ([]models.ActivityRegistration, error) {
+	event, err := s.attendancesEvent(admin, eventSlug)
+	if err != nil {
+		return nil, err
+	}
+
 	attendances, err := s.EventRepo.GetAllAttendancesFromEvent(event.ID)
 	if err != nil {
 		return nil, errors.New("failed to retrieve all attendances: " + err.Error())
@@ -480,3 +712,1309 @@ func (s *EventService) GetAllAttendances(admin models.User, eventSlug string) ([
 
 	return attendances, nil
 }
+
+// ExportAttendances streams the attendances of the event to fn (admins only)
+func (s *EventService) ExportAttendances(admin models.User, eventSlug string, fn func(models.AttendanceExportRow) error) error {
+	event, err := s.attendancesEvent(admin, eventSlug)
+	if err != nil {
+		return err
+	}
+
+	return s.EventRepo.StreamEventAttendances(event.ID, fn)
+}
+
+// signAttendanceManifest signs the payload like the Mercado Pago webhooks, the header is
+// "ts=<unix>,v1=<hex hmac-sha256>" over "ts:<unix>;sha256:<hex sha256 of the payload>;"
+func signAttendanceManifest(payload []byte, ts int64) string {
+	digest := sha256.Sum256(payload)
+	mac := hmac.New(sha256.New, []byte(config.GetManifestSigningSecret()))
+	fmt.Fprintf(mac, "ts:%d;sha256:%s;", ts, hex.EncodeToString(digest[:]))
+	return fmt.Sprintf("ts=%d,v1=%s", ts, hex.EncodeToString(mac.Sum(nil)))
+}
+
+// GetAttendanceManifest returns the event attendance as a JSON manifest and its signature
+func (s *EventService) GetAttendanceManifest(admin models.User, eventSlug string) ([]byte, string, error) {
+	if config.GetManifestSigningSecret() == "" {
+		return nil, "", errors.New("manifest signing secret is not configured")
+	}
+
+	event, err := s.EventRepo.GetEventBySlug(eventSlug)
+	if err != nil {
+		return nil, "", errors.New("event not found: " + err.Error())
+	}
+
+	if !admin.IsSuperUser && event.CreatedBy != admin.ID {
+		adminStatus, err := s.EventRepo.GetUserAdminStatusBySlug(admin.ID, eventSlug)
+		if err != nil || (adminStatus.AdminType != models.AdminTypeMaster && adminStatus.AdminType != models.AdminTypeNormal) {
+			return nil, "", errors.New("unauthorized: only admins can export the attendance manifest")
+		}
+	}
+
+	records, err := s.EventRepo.GetAttendanceRecords(event.ID)
+	if err != nil {
+		return nil, "", errors.New("failed to retrieve attendance records: " + err.Error())
+	}
+	if records == nil {
+		records = []models.AttendanceRecord{}
+	}
+
+	generatedAt := time.Now()
+	payload, err := json.Marshal(models.AttendanceManifest{
+		Event: models.AttendanceManifestEvent{
+			ID:        event.ID,
+			Slug:      event.Slug,
+			Name:      event.Name,
+			StartDate: event.StartDate,
+			EndDate:   event.EndDate,
+		},
+		GeneratedAt: generatedAt,
+		Records:     records,
+	})
+	if err != nil {
+		return nil, "", errors.New("failed to encode attendance manifest: " + err.Error())
+	}
+
+	return payload, signAttendanceManifest(payload, generatedAt.Unix()), nil
+}
+
+// GetReportBundleData gathers the attendees, the activity attendance and the stats of the end of event report
+func (s *EventService) GetReportBundleData(admin models.User, eventSlug string) (*models.EventReportData, error) {
+	event, err := s.EventRepo.GetEventBySlug(eventSlug)
+	if err != nil {
+		return nil, errors.New("event not found: " + err.Error())
+	}
+
+	if !admin.IsSuperUser && event.CreatedBy != admin.ID {
+		adminStatus, err := s.EventRepo.GetUserAdminStatusBySlug(admin.ID, eventSlug)
+		if err != nil || adminStatus.AdminType != models.AdminTypeMaster {
+			return nil, errors.New("unauthorized: only master admins can download the report bundle")
+		}
+	}
+
+	attendees, err := s.EventRepo.GetEventAttendeeRows(event.ID)
+	if err != nil {
+		return nil, errors.New("failed to retrieve attendees: " + err.Error())
+	}
+
+	records, err := s.EventRepo.GetAttendanceRecords(event.ID)
+	if err != nil {
+		return nil, errors.New("failed to retrieve attendance records: " + err.Error())
+	}
+
+	funnel, err := s.GetEventFunnel(admin, eventSlug)
+	if err != nil {
+		return nil, err
+	}
+
+	rates, err := s.GetNoShowRates(admin, eventSlug)
+	if err != nil {
+		return nil, err
+	}
+	if rates == nil {
+		rates = []models.ActivityNoShowRate{}
+	}
+
+	return &models.EventReportData{
+		Attendees:  attendees,
+		Attendance: records,
+		Summary: models.EventReportSummary{
+			Event: models.AttendanceManifestEvent{
+				ID:        event.ID,
+				Slug:      event.Slug,
+				Name:      event.Name,
+				StartDate: event.StartDate,
+				EndDate:   event.EndDate,
+			},
+			GeneratedAt: time.Now(),
+			Registrants: len(attendees),
+			CheckIns:    len(records),
+			Funnel:      *funnel,
+			NoShowRates: rates,
+		},
+	}, nil
+}
+
+// ValidateEvent runs the preflight checks organizers go through before publishing an event, gathering
+// the rules the creation paths enforce one at a time into a single report. Errors come first
+func (s *EventService) ValidateEvent(admin models.User, eventSlug string) (*models.EventValidationReport, error) {
+	event, err := s.EventRepo.GetEventBySlug(eventSlug)
+	if err != nil {
+		return nil, errors.New("event not found: " + err.Error())
+	}
+
+	if !admin.IsSuperUser && event.CreatedBy != admin.ID {
+		adminStatus, err := s.EventRepo.GetUserAdminStatusBySlug(admin.ID, eventSlug)
+		if err != nil || (adminStatus.AdminType != models.AdminTypeMaster && adminStatus.AdminType != models.AdminTypeNormal) {
+			return nil, errors.New("unauthorized: only admins can validate the event")
+		}
+	}
+
+	activities, err := s.EventRepo.GetEventActivitiesByStart(event.ID)
+	if err != nil {
+		return nil, errors.New("failed to get activities: " + err.Error())
+	}
+
+	products, err := s.EventRepo.GetEventProductsWithTargets(event.ID)
+	if err != nil {
+		return nil, errors.New("failed to get products: " + err.Error())
+	}
+
+	issues := []models.ValidationIssue{}
+	issues = append(issues, activityWindowIssues(event, activities)...)
+	issues = append(issues, mandatoryOverlapIssues(activities)...)
+	issues = append(issues, feeActivityIssues(activities, products, time.Now())...)
+	issues = append(issues, productIssues(event, products)...)
+	issues = append(issues, roomConflictIssues(activities)...)
+
+	sort.SliceStable(issues, func(i, j int) bool {
+		return issues[i].Severity == models.ValidationError && issues[j].Severity != models.ValidationError
+	})
+
+	report := &models.EventValidationReport{Issues: issues}
+	for _, issue := range issues {
+		if issue.Severity == models.ValidationError {
+			report.Errors++
+		} else {
+			report.Warnings++
+		}
+	}
+	report.Valid = report.Errors == 0
+
+	return report, nil
+}
+
+func activityWindowIssues(event *models.Event, activities []models.Activity) []models.ValidationIssue {
+	var issues []models.ValidationIssue
+	for _, activity := range activities {
+		if activity.StartTime.Before(event.StartDate) || activity.EndTime.After(event.EndDate) {
+			issues = append(issues, models.ValidationIssue{
+				Severity:   models.ValidationError,
+				Code:       "activity_outside_event",
+				Message:    fmt.Sprintf("%s is scheduled outside the event dates", activity.Name),
+				ActivityID: activity.ID,
+			})
+		}
+	}
+	return issues
+}
+
+// mandatoryOverlapIssues flags mandatory activities running at the same time, every registrant is
+// signed up to both and can only attend one
+func mandatoryOverlapIssues(activities []models.Activity) []models.ValidationIssue {
+	var mandatory []models.Activity
+	for _, activity := range activities {
+		if activity.IsMandatory {
+			mandatory = append(mandatory, activity)
+		}
+	}
+
+	var issues []models.ValidationIssue
+	for i, activity := range mandatory {
+		for _, other := range mandatory[i+1:] {
+			if _, _, ok := overlapWindow(activity.StartTime, activity.EndTime, other.StartTime, other.EndTime); !ok {
+				continue
+			}
+			issues = append(issues, models.ValidationIssue{
+				Severity:   models.ValidationError,
+				Code:       "mandatory_overlap",
+				Message:    fmt.Sprintf("mandatory activities %s and %s overlap", activity.Name, other.Name),
+				ActivityID: activity.ID,
+			})
+		}
+	}
+	return issues
+}
+
+// feeActivityIssues flags fee activities no one can get into: registering takes a product targeting
+// the activity or an event token, and none of them is on sale
+func feeActivityIssues(activities []models.Activity, products []models.Product, now time.Time) []models.ValidationIssue {
+	sellsTokens := false
+	targeted := make(map[string]bool)
+	for _, product := range products {
+		if product.IsBlocked || (!product.ExpiresAt.IsZero() && product.ExpiresAt.Before(now)) {
+			continue
+		}
+		if product.IsActivityToken && product.TokenQuantity > 0 {
+			sellsTokens = true
+		}
+		for _, target := range product.AccessTargets {
+			if !target.IsEvent {
+				targeted[target.TargetID] = true
+			}
+		}
+	}
+
+	var issues []models.ValidationIssue
+	for _, activity := range activities {
+		if !activity.HasFee && !activity.NeedsToken {
+			continue
+		}
+		if sellsTokens || targeted[activity.ID] {
+			continue
+		}
+		issues = append(issues, models.ValidationIssue{
+			Severity:   models.ValidationError,
+			Code:       "fee_activity_unreachable",
+			Message:    fmt.Sprintf("%s requires a fee but no product on sale gives access to it or sells tokens", activity.Name),
+			ActivityID: activity.ID,
+		})
+	}
+	return issues
+}
+
+func productIssues(event *models.Event, products []models.Product) []models.ValidationIssue {
+	var issues []models.ValidationIssue
+	hasTicket := false
+	for _, product := range products {
+		if product.IsEventAccess && !product.IsBlocked {
+			hasTicket = true
+		}
+		if product.ExpiresAt.After(event.EndDate) {
+			issues = append(issues, models.ValidationIssue{
+				Severity:  models.ValidationWarning,
+				Code:      "product_expires_after_event",
+				Message:   fmt.Sprintf("%s can still be bought after the event ends", product.Name),
+				ProductID: product.ID,
+			})
+		}
+	}
+
+	if !hasTicket {
+		issues = append(issues, models.ValidationIssue{
+			Severity: models.ValidationWarning,
+			Code:     "missing_ticket_product",
+			Message:  "the event has no ticket on sale, it can only be joined for free",
+		})
+	}
+	return issues
+}
+
+func roomConflictIssues(activities []models.Activity) []models.ValidationIssue {
+	var keys []string
+	byLocation := make(map[string][]models.Activity)
+	for _, activity := range activities {
+		key := normalizeName(activity.Location)
+		if key == "" {
+			continue
+		}
+		if _, ok := byLocation[key]; !ok {
+			keys = append(keys, key)
+		}
+		byLocation[key] = append(byLocation[key], activity)
+	}
+
+	var issues []models.ValidationIssue
+	for _, key := range keys {
+		for _, conflict := range roomConflicts(byLocation[key]) {
+			issues = append(issues, models.ValidationIssue{
+				Severity:   models.ValidationWarning,
+				Code:       "room_conflict",
+				Message:    fmt.Sprintf("%s and %s are booked in %s at the same time", conflict.ActivityName, conflict.ConflictingActivityName, conflict.Location),
+				ActivityID: conflict.ActivityID,
+			})
+		}
+	}
+	return issues
+}
+
+// GetEventAttendees lists the users registered to the event (admins only), paidOnly keeps the ones owning a ticket
+func (s *EventService) GetEventAttendees(admin models.User, eventSlug string, paidOnly bool) ([]models.EventAttendee, error) {
+	event, err := s.EventRepo.GetEventBySlug(eventSlug)
+	if err != nil {
+		return nil, errors.New("event not found: " + err.Error())
+	}
+
+	if !admin.IsSuperUser && event.CreatedBy != admin.ID {
+		adminStatus, err := s.EventRepo.GetUserAdminStatusBySlug(admin.ID, eventSlug)
+		if err != nil || (adminStatus.AdminType != models.AdminTypeMaster && adminStatus.AdminType != models.AdminTypeNormal) {
+			return nil, errors.New("unauthorized: only admins can see the event attendees")
+		}
+	}
+
+	var users []models.User
+	if paidOnly {
+		tickets, err := s.EventRepo.GetEventTicketProducts(event.ID)
+		if err != nil {
+			return nil, errors.New("failed to get event tickets: " + err.Error())
+		}
+		if len(tickets) == 0 {
+			return []models.EventAttendee{}, nil
+		}
+
+		ticketIDs := make([]string, 0, len(tickets))
+		for _, ticket := range tickets {
+			ticketIDs = append(ticketIDs, ticket.ID)
+		}
+
+		users, err = s.EventRepo.GetEventTicketHolders(event.ID, ticketIDs)
+		if err != nil {
+			return nil, errors.New("failed to get event attendees: " + err.Error())
+		}
+	} else {
+		attendees, err := s.EventRepo.GetEventAttendeesBySlug(eventSlug)
+		if err != nil {
+			return nil, errors.New("failed to get event attendees: " + err.Error())
+		}
+		users = *attendees
+	}
+
+	result := make([]models.EventAttendee, 0, len(users))
+	for _, user := range users {
+		result = append(result, models.EventAttendee{
+			ID:           user.ID,
+			Name:         user.Name,
+			LastName:     user.LastName,
+			Email:        user.Email,
+			IsUenf:       user.IsUenf,
+			UenfSemester: user.UenfSemester,
+		})
+	}
+
+	return result, nil
+}
+
+// GetUnpaidRegistrants lists users registered to the event that don't own any of its ticket products
+func (s *EventService) GetUnpaidRegistrants(admin models.User, eventSlug string) ([]models.UnpaidRegistrant, error) {
+	event, err := s.EventRepo.GetEventBySlug(eventSlug)
+	if err != nil {
+		return nil, errors.New("event not found: " + err.Error())
+	}
+
+	if !admin.IsSuperUser && event.CreatedBy != admin.ID {
+		adminStatus, err := s.EventRepo.GetUserAdminStatusBySlug(admin.ID, eventSlug)
+		if err != nil || (adminStatus.AdminType != models.AdminTypeMaster && adminStatus.AdminType != models.AdminTypeNormal) {
+			return nil, errors.New("unauthorized: only admins can see unpaid registrants")
+		}
+	}
+
+	tickets, err := s.EventRepo.GetEventTicketProducts(event.ID)
+	if err != nil {
+		return nil, errors.New("failed to get event tickets: " + err.Error())
+	}
+
+	var ticketIDs []string
+	for _, ticket := range tickets {
+		ticketIDs = append(ticketIDs, ticket.ID)
+	}
+
+	registrants, err := s.EventRepo.GetUnpaidRegistrants(event.ID, ticketIDs)
+	if err != nil {
+		return nil, errors.New("failed to get unpaid registrants: " + err.Error())
+	}
+
+	return registrants, nil
+}
+
+// GetTicketAvailability reports the stock of the tickets anyone can buy, invite-only,
+// hidden, blocked and expired tickets are left out
+func (s *EventService) GetTicketAvailability(eventSlug string) (*models.TicketAvailability, error) {
+	event, err := s.EventRepo.GetEventBySlug(eventSlug)
+	if err != nil {
+		return nil, errors.New("event not found: " + err.Error())
+	}
+
+	products, err := s.EventRepo.GetEventTicketProducts(event.ID)
+	if err != nil {
+		return nil, errors.New("failed to get event tickets: " + err.Error())
+	}
+
+	now := time.Now()
+	var tickets []models.Product
+	var ticketIDs []string
+	for _, product := range products {
+		if !product.IsPublic || product.IsHidden || product.IsBlocked || product.ExpiresAt.Before(now) {
+			continue
+		}
+		tickets = append(tickets, product)
+		ticketIDs = append(ticketIDs, product.ID)
+	}
+
+	availability := &models.TicketAvailability{Tickets: []models.TicketStock{}}
+	if len(tickets) == 0 {
+		return availability, nil
+	}
+
+	sold, err := s.EventRepo.GetProductsSoldCounts(ticketIDs)
+	if err != nil {
+		return nil, errors.New("failed to count sold tickets: " + err.Error())
+	}
+
+	availability.HasTickets = true
+	for _, ticket := range tickets {
+		stock := models.TicketStock{
+			ProductID: ticket.ID,
+			Name:      ticket.Name,
+			Unlimited: ticket.HasUnlimitedQuantity,
+			Remaining: ticket.Quantity,
+			Sold:      sold[ticket.ID],
+		}
+		if stock.Unlimited {
+			stock.Remaining = -1
+			availability.Unlimited = true
+		} else {
+			availability.Remaining += stock.Remaining
+		}
+		availability.Sold += stock.Sold
+		availability.Tickets = append(availability.Tickets, stock)
+	}
+	if availability.Unlimited {
+		availability.Remaining = -1
+	}
+
+	return availability, nil
+}
+
+// GetEventOccupancy computes how many distinct registered users are in sessions over time.
+// A user registered to overlapping activities is only counted once
+func (s *EventService) GetEventOccupancy(admin models.User, eventSlug string) (*models.EventOccupancy, error) {
+	event, err := s.EventRepo.GetEventBySlug(eventSlug)
+	if err != nil {
+		return nil, errors.New("event not found: " + err.Error())
+	}
+
+	if !admin.IsSuperUser && event.CreatedBy != admin.ID {
+		adminStatus, err := s.EventRepo.GetUserAdminStatusBySlug(admin.ID, eventSlug)
+		if err != nil || (adminStatus.AdminType != models.AdminTypeMaster && adminStatus.AdminType != models.AdminTypeNormal) {
+			return nil, errors.New("unauthorized: only admins can see event occupancy")
+		}
+	}
+
+	intervals, err := s.EventRepo.GetRegistrationIntervals(event.ID)
+	if err != nil {
+		return nil, errors.New("failed to get registrations: " + err.Error())
+	}
+
+	type boundary struct {
+		at     time.Time
+		userID string
+		delta  int
+	}
+
+	boundaries := make([]boundary, 0, len(intervals)*2)
+	for _, interval := range intervals {
+		if !interval.EndTime.After(interval.StartTime) {
+			continue
+		}
+		boundaries = append(boundaries,
+			boundary{at: interval.StartTime, userID: interval.UserID, delta: 1},
+			boundary{at: interval.EndTime, userID: interval.UserID, delta: -1},
+		)
+	}
+
+	// Sessions are half-open, so someone leaving at 10:00 doesn't overlap someone arriving at 10:00
+	sort.Slice(boundaries, func(i, j int) bool {
+		if !boundaries[i].at.Equal(boundaries[j].at) {
+			return boundaries[i].at.Before(boundaries[j].at)
+		}
+		return boundaries[i].delta < boundaries[j].delta
+	})
+
+	occupancy := &models.EventOccupancy{Timeline: []models.OccupancyPoint{}}
+	sessionsByUser := make(map[string]int)
+	current := 0
+	for i, b := range boundaries {
+		sessionsByUser[b.userID] += b.delta
+		if b.delta > 0 && sessionsByUser[b.userID] == 1 {
+			current++
+		} else if b.delta < 0 && sessionsByUser[b.userID] == 0 {
+			current--
+		}
+
+		// Only record the final count of each instant
+		if i+1 < len(boundaries) && boundaries[i+1].at.Equal(b.at) {
+			continue
+		}
+
+		last := len(occupancy.Timeline) - 1
+		if last >= 0 && occupancy.Timeline[last].Count == current {
+			continue
+		}
+		occupancy.Timeline = append(occupancy.Timeline, models.OccupancyPoint{Time: b.at, Count: current})
+
+		if current > occupancy.Peak {
+			peakAt := b.at
+			occupancy.Peak = current
+			occupancy.PeakAt = &peakAt
+		}
+	}
+
+	return occupancy, nil
+}
+
+func (s *EventService) GetEventFunnel(admin models.User, eventSlug string) (*models.EventFunnel, error) {
+	event, err := s.EventRepo.GetEventBySlug(eventSlug)
+	if err != nil {
+		return nil, errors.New("event not found: " + err.Error())
+	}
+
+	if !admin.IsSuperUser && event.CreatedBy != admin.ID {
+		adminStatus, err := s.EventRepo.GetUserAdminStatusBySlug(admin.ID, eventSlug)
+		if err != nil || (adminStatus.AdminType != models.AdminTypeMaster && adminStatus.AdminType != models.AdminTypeNormal) {
+			return nil, errors.New("unauthorized: only admins can see the event funnel")
+		}
+	}
+
+	funnel, err := s.EventRepo.GetEventFunnel(event.ID)
+	if err != nil {
+		return nil, errors.New("failed to get event funnel: " + err.Error())
+	}
+
+	if funnel.Registered > 0 {
+		funnel.PaidRate = math.Round(float64(funnel.Paid)/float64(funnel.Registered)*10000) / 100
+		funnel.AttendedRate = math.Round(float64(funnel.Attended)/float64(funnel.Registered)*10000) / 100
+	}
+
+	return funnel, nil
+}
+
+// GetNoShowRates returns the no-show rate of each ended activity with registrations, worst first
+func (s *EventService) GetNoShowRates(admin models.User, eventSlug string) ([]models.ActivityNoShowRate, error) {
+	event, err := s.EventRepo.GetEventBySlug(eventSlug)
+	if err != nil {
+		return nil, errors.New("event not found: " + err.Error())
+	}
+
+	if !admin.IsSuperUser && event.CreatedBy != admin.ID {
+		adminStatus, err := s.EventRepo.GetUserAdminStatusBySlug(admin.ID, eventSlug)
+		if err != nil || (adminStatus.AdminType != models.AdminTypeMaster && adminStatus.AdminType != models.AdminTypeNormal) {
+			return nil, errors.New("unauthorized: only admins can see no-show rates")
+		}
+	}
+
+	rates, err := s.EventRepo.GetActivitiesAttendanceCounts(event.ID, time.Now())
+	if err != nil {
+		return nil, errors.New("failed to get attendance counts: " + err.Error())
+	}
+
+	for i := range rates {
+		// Until the attendance is finalized everyone not checked in counts as a no-show
+		if !rates[i].Finalized {
+			rates[i].NoShows = rates[i].Registered - rates[i].Attended
+		}
+		rates[i].NoShowRate = math.Round(float64(rates[i].NoShows)/float64(rates[i].Registered)*10000) / 100
+	}
+
+	sort.SliceStable(rates, func(i, j int) bool {
+		if rates[i].NoShowRate != rates[j].NoShowRate {
+			return rates[i].NoShowRate > rates[j].NoShowRate
+		}
+		return rates[i].NoShows > rates[j].NoShows
+	})
+
+	return rates, nil
+}
+
+func (s *EventService) GetRegistrationStatus(user models.User, eventSlug string) (*models.RegistrationStatus, error) {
+	event, err := s.EventRepo.GetEventBySlug(eventSlug)
+	if err != nil {
+		return nil, errors.New("event not found: " + err.Error())
+	}
+
+	registration, err := s.EventRepo.GetEventRegistration(event.ID, user.ID)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return &models.RegistrationStatus{}, nil
+	}
+	if err != nil {
+		return nil, errors.New("failed to get registration: " + err.Error())
+	}
+
+	status := &models.RegistrationStatus{
+		Registered:   true,
+		RegisteredAt: &registration.RegisteredAt,
+		EmailSent:    registration.EmailSentAt != nil,
+		EmailSentAt:  registration.EmailSentAt,
+		CheckedIn:    registration.CheckedInAt != nil,
+		CheckedInAt:  registration.CheckedInAt,
+	}
+	if registration.EmailError != nil {
+		status.EmailError = *registration.EmailError
+	}
+
+	return status, nil
+}
+
+// ScanAttendee gathers the registration, tickets, check-in and activities of the day of a scanned user
+func (s *EventService) ScanAttendee(admin models.User, eventSlug, userID string) (*models.DoorScanResult, error) {
+	event, err := s.EventRepo.GetEventBySlug(eventSlug)
+	if err != nil {
+		return nil, errors.New("event not found: " + err.Error())
+	}
+
+	if !admin.IsSuperUser && event.CreatedBy != admin.ID {
+		adminStatus, err := s.EventRepo.GetUserAdminStatusBySlug(admin.ID, eventSlug)
+		if err != nil || (adminStatus.AdminType != models.AdminTypeMaster && adminStatus.AdminType != models.AdminTypeNormal) {
+			return nil, errors.New("unauthorized: only admins can scan attendees")
+		}
+	}
+
+	userID = strings.TrimSpace(userID)
+	if userID == "" {
+		return nil, errors.New("user_id is required")
+	}
+
+	user, err := s.EventRepo.GetUserByID(userID)
+	if err != nil {
+		return nil, errors.New("user not found: " + err.Error())
+	}
+
+	result := &models.DoorScanResult{
+		UserID:          user.ID,
+		Name:            user.Name,
+		LastName:        user.LastName,
+		Email:           user.Email,
+		Products:        []models.OwnedEventProduct{},
+		TodayActivities: []models.ActivityParticipation{},
+	}
+
+	registration, err := s.EventRepo.GetEventRegistration(event.ID, user.ID)
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, errors.New("failed to get registration: " + err.Error())
+	}
+	if err == nil {
+		result.Registered = true
+		result.RegisteredAt = &registration.RegisteredAt
+		result.CheckedIn = registration.CheckedInAt != nil
+		result.CheckedInAt = registration.CheckedInAt
+	}
+
+	products, err := s.EventRepo.GetUserOwnedEventProducts(user.ID, event.ID)
+	if err != nil {
+		return nil, errors.New("failed to get user products: " + err.Error())
+	}
+	if products != nil {
+		result.Products = products
+	}
+	for _, product := range products {
+		if product.IsTicketType {
+			result.HasTicket = true
+			break
+		}
+	}
+
+	participations, err := s.EventRepo.GetUserActivityParticipations(user.ID, event.ID)
+	if err != nil {
+		return nil, errors.New("failed to get user activities: " + err.Error())
+	}
+	now := time.Now()
+	startOfDay := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+	endOfDay := startOfDay.AddDate(0, 0, 1)
+	for _, participation := range participations {
+		if !participation.StartTime.Before(startOfDay) && participation.StartTime.Before(endOfDay) {
+			result.TodayActivities = append(result.TodayActivities, participation)
+		}
+	}
+
+	return result, nil
+}
+
+const maxRegistrationNoteLength = 500
+
+// UpdateRegistrationDetails saves the dietary and accessibility notes of a registered user
+func (s *EventService) UpdateRegistrationDetails(user models.User, eventSlug string, req models.RegistrationDetailsRequest) (*models.EventRegistrationDetails, error) {
+	event, err := s.EventRepo.GetEventBySlug(eventSlug)
+	if err != nil {
+		return nil, errors.New("event not found: " + err.Error())
+	}
+
+	if _, err := s.EventRepo.GetEventRegistration(event.ID, user.ID); err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, errors.New("user is not registered to this event")
+		}
+		return nil, errors.New("failed to get registration: " + err.Error())
+	}
+
+	details, err := s.EventRepo.GetRegistrationDetails(event.ID, user.ID)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		details = &models.EventRegistrationDetails{EventID: event.ID, UserID: user.ID}
+	} else if err != nil {
+		return nil, errors.New("failed to get registration details: " + err.Error())
+	}
+
+	if req.DietaryRestrictions != nil {
+		details.DietaryRestrictions = strings.TrimSpace(*req.DietaryRestrictions)
+	}
+	if req.AccessibilityNeeds != nil {
+		details.AccessibilityNeeds = strings.TrimSpace(*req.AccessibilityNeeds)
+	}
+
+	if len(details.DietaryRestrictions) > maxRegistrationNoteLength || len(details.AccessibilityNeeds) > maxRegistrationNoteLength {
+		return nil, fmt.Errorf("registration notes can't be longer than %d characters", maxRegistrationNoteLength)
+	}
+
+	if err := s.EventRepo.SaveRegistrationDetails(details); err != nil {
+		return nil, errors.New("failed to save registration details: " + err.Error())
+	}
+
+	return details, nil
+}
+
+// GetRegistrationDetails returns the user's own notes for the event, empty when none were given
+func (s *EventService) GetRegistrationDetails(user models.User, eventSlug string) (*models.EventRegistrationDetails, error) {
+	event, err := s.EventRepo.GetEventBySlug(eventSlug)
+	if err != nil {
+		return nil, errors.New("event not found: " + err.Error())
+	}
+
+	details, err := s.EventRepo.GetRegistrationDetails(event.ID, user.ID)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return &models.EventRegistrationDetails{EventID: event.ID, UserID: user.ID}, nil
+	}
+	if err != nil {
+		return nil, errors.New("failed to get registration details: " + err.Error())
+	}
+
+	return details, nil
+}
+
+func (s *EventService) GetRegistrationDetailsAggregate(admin models.User, eventSlug string) (*models.RegistrationDetailsAggregate, error) {
+	event, err := s.EventRepo.GetEventBySlug(eventSlug)
+	if err != nil {
+		return nil, errors.New("event not found: " + err.Error())
+	}
+
+	if !admin.IsSuperUser && event.CreatedBy != admin.ID {
+		adminStatus, err := s.EventRepo.GetUserAdminStatusBySlug(admin.ID, eventSlug)
+		if err != nil || (adminStatus.AdminType != models.AdminTypeMaster && adminStatus.AdminType != models.AdminTypeNormal) {
+			return nil, errors.New("unauthorized: only admins can see registration details")
+		}
+	}
+
+	registrants, err := s.EventRepo.CountEventRegistrations(event.ID)
+	if err != nil {
+		return nil, errors.New("failed to count registrations: " + err.Error())
+	}
+
+	notes, err := s.EventRepo.GetRegistrantsNotes(event.ID)
+	if err != nil {
+		return nil, errors.New("failed to get registration details: " + err.Error())
+	}
+
+	dietary, accessibility := make([]string, 0, len(notes)), make([]string, 0, len(notes))
+	for _, note := range notes {
+		dietary = append(dietary, note.DietaryRestrictions)
+		accessibility = append(accessibility, note.AccessibilityNeeds)
+	}
+
+	return &models.RegistrationDetailsAggregate{
+		Registrants:   registrants,
+		Responses:     len(notes),
+		Dietary:       countRegistrationNotes(dietary),
+		Accessibility: countRegistrationNotes(accessibility),
+		Notes:         notes,
+	}, nil
+}
+
+// countRegistrationNotes groups equal notes ignoring case, most frequent first
+func countRegistrationNotes(notes []string) []models.RegistrationNoteCount {
+	counts := []models.RegistrationNoteCount{}
+	index := make(map[string]int)
+	for _, note := range notes {
+		if note == "" {
+			continue
+		}
+		key := strings.ToLower(note)
+		if i, ok := index[key]; ok {
+			counts[i].Count++
+			continue
+		}
+		index[key] = len(counts)
+		counts = append(counts, models.RegistrationNoteCount{Note: note, Count: 1})
+	}
+
+	sort.SliceStable(counts, func(i, j int) bool {
+		return counts[i].Count > counts[j].Count
+	})
+	return counts
+}
+
+// GetParticipationSummary assembles the user's whole participation in the event,
+// the independent lookups run concurrently
+func (s *EventService) GetParticipationSummary(user models.User, eventSlug string) (*models.EventParticipationSummary, error) {
+	event, err := s.EventRepo.GetEventBySlug(eventSlug)
+	if err != nil {
+		return nil, errors.New("event not found: " + err.Error())
+	}
+
+	summary := &models.EventParticipationSummary{
+		EventID:    event.ID,
+		EventSlug:  event.Slug,
+		EventName:  event.Name,
+		Activities: []models.ActivityParticipation{},
+		Products:   []models.OwnedEventProduct{},
+	}
+
+	var (
+		wg           sync.WaitGroup
+		registration *models.EventRegistration
+		activities   []models.ActivityParticipation
+		tokens       []models.UserToken
+		products     []models.OwnedEventProduct
+		errs         = make([]error, 4)
+	)
+
+	wg.Add(4)
+	go func() {
+		defer wg.Done()
+		registration, errs[0] = s.EventRepo.GetEventRegistration(event.ID, user.ID)
+		if errors.Is(errs[0], gorm.ErrRecordNotFound) {
+			errs[0] = nil
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		activities, errs[1] = s.EventRepo.GetUserActivityParticipations(user.ID, event.ID)
+	}()
+	go func() {
+		defer wg.Done()
+		tokens, errs[2] = s.EventRepo.GetUserTokensFromEvent(user.ID, event.ID)
+	}()
+	go func() {
+		defer wg.Done()
+		products, errs[3] = s.EventRepo.GetUserOwnedEventProducts(user.ID, event.ID)
+	}()
+	wg.Wait()
+
+	if err := errors.Join(errs...); err != nil {
+		return nil, errors.New("failed to get participation summary: " + err.Error())
+	}
+
+	if registration != nil {
+		summary.IsRegistered = true
+		summary.RegisteredAt = &registration.RegisteredAt
+	}
+
+	if activities != nil {
+		summary.Activities = activities
+	}
+	for _, activity := range activities {
+		if activity.AttendedAt != nil {
+			summary.AttendedCount++
+		}
+	}
+
+	for _, token := range tokens {
+		if token.IsUsed {
+			summary.TokensUsed++
+		} else {
+			summary.TokensAvailable++
+		}
+	}
+
+	if products != nil {
+		summary.Products = products
+	}
+	for _, product := range products {
+		if product.IsTicketType {
+			summary.HasTicket = true
+		}
+	}
+
+	return summary, nil
+}
+
+// GetUserTimeline lists when the user registered to the event, checked in and attended each activity, oldest first
+func (s *EventService) GetUserTimeline(user models.User, eventSlug string) ([]models.TimelineEntry, error) {
+	event, err := s.EventRepo.GetEventBySlug(eventSlug)
+	if err != nil {
+		return nil, errors.New("event not found: " + err.Error())
+	}
+
+	registration, err := s.EventRepo.GetEventRegistration(event.ID, user.ID)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, errors.New("user is not registered to this event")
+	}
+	if err != nil {
+		return nil, errors.New("failed to get registration: " + err.Error())
+	}
+
+	activities, err := s.EventRepo.GetUserActivityParticipations(user.ID, event.ID)
+	if err != nil {
+		return nil, errors.New("failed to get activities: " + err.Error())
+	}
+
+	timeline := []models.TimelineEntry{{Kind: models.TimelineRegistered, At: registration.RegisteredAt}}
+	if registration.CheckedInAt != nil {
+		timeline = append(timeline, models.TimelineEntry{Kind: models.TimelineCheckedIn, At: *registration.CheckedInAt})
+	}
+	for _, activity := range activities {
+		if activity.AttendedAt == nil {
+			continue
+		}
+		timeline = append(timeline, models.TimelineEntry{
+			Kind:         models.TimelineActivityAttended,
+			At:           *activity.AttendedAt,
+			ActivityID:   activity.ActivityID,
+			ActivityName: activity.Name,
+		})
+	}
+
+	// The check-in is stamped by the first attendance, so it must stay ahead of it on ties
+	sort.SliceStable(timeline, func(i, j int) bool {
+		return timeline[i].At.Before(timeline[j].At)
+	})
+
+	return timeline, nil
+}
+
+// certificateCodeAlphabet leaves out characters that are easily misread when typed from paper
+const certificateCodeAlphabet = "ABCDEFGHJKLMNPQRSTUVWXYZ23456789"
+
+func generateCertificateCode() (string, error) {
+	buf := make([]byte, 12)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	code := make([]byte, len(buf))
+	for i, b := range buf {
+		code[i] = certificateCodeAlphabet[int(b)%len(certificateCodeAlphabet)]
+	}
+	return string(code), nil
+}
+
+// certificateHash seals the printed content of a certificate, it's keyed with the
+// server secret so a row edited straight in the database no longer verifies
+func certificateHash(certificate *models.Certificate) string {
+	mac := hmac.New(sha256.New, []byte(config.GetJWTSecret()))
+	fmt.Fprintf(mac, "%s|%s|%s|%s|%s|%.2f|%d",
+		certificate.Code, certificate.UserID, certificate.EventID,
+		certificate.HolderName, certificate.EventName, certificate.Hours, certificate.IssuedAt.Unix())
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func certificateVerificationURL(code string) string {
+	return fmt.Sprintf("%s/certificates/verify/%s", config.GetSiteURL(), code)
+}
+
+// IssueCertificate issues the user's participation certificate for the event, the hours
+// are the sum of the attended activities. Issuing again returns the same certificate
+func (s *EventService) IssueCertificate(user models.User, eventSlug string) (*models.Certificate, error) {
+	event, err := s.EventRepo.GetEventBySlug(eventSlug)
+	if err != nil {
+		return nil, errors.New("event not found: " + err.Error())
+	}
+
+	certificate, err := s.EventRepo.GetUserEventCertificate(user.ID, event.ID)
+	if err == nil {
+		certificate.VerificationURL = certificateVerificationURL(certificate.Code)
+		return certificate, nil
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, errors.New("failed to get certificate: " + err.Error())
+	}
+
+	participations, err := s.EventRepo.GetUserActivityParticipations(user.ID, event.ID)
+	if err != nil {
+		return nil, errors.New("failed to get user activities: " + err.Error())
+	}
+
+	var hours float64
+	for _, participation := range participations {
+		if participation.AttendedAt != nil {
+			hours += participation.EndTime.Sub(participation.StartTime).Hours()
+		}
+	}
+	if hours == 0 {
+		return nil, errors.New("unauthorized: user didn't attend any activity of this event")
+	}
+
+	code, err := generateCertificateCode()
+	if err != nil {
+		return nil, errors.New("failed to generate certificate code: " + err.Error())
+	}
+
+	certificate = &models.Certificate{
+		ID:         uuid.New().String(),
+		Code:       code,
+		UserID:     user.ID,
+		EventID:    event.ID,
+		HolderName: strings.TrimSpace(user.Name + " " + user.LastName),
+		EventName:  event.Name,
+		Hours:      math.Round(hours*100) / 100,
+		IssuedAt:   time.Now().UTC().Truncate(time.Second),
+	}
+	certificate.Hash = certificateHash(certificate)
+
+	if err := s.EventRepo.CreateCertificate(certificate); err != nil {
+		return nil, errors.New("failed to create certificate: " + err.Error())
+	}
+
+	certificate.VerificationURL = certificateVerificationURL(certificate.Code)
+	return certificate, nil
+}
+
+// VerifyCertificate checks a printed certificate code, certificates whose content
+// doesn't match the seal are reported as invalid
+func (s *EventService) VerifyCertificate(code string) (*models.CertificateVerification, error) {
+	certificate, err := s.EventRepo.GetCertificateByCode(strings.ToUpper(strings.TrimSpace(code)))
+	if err != nil {
+		return nil, errors.New("certificate not found")
+	}
+
+	if !hmac.Equal([]byte(certificate.Hash), []byte(certificateHash(certificate))) {
+		return nil, errors.New("certificate not found: content doesn't match its seal")
+	}
+
+	event, err := s.EventRepo.GetEventByID(certificate.EventID)
+	if err != nil {
+		return nil, errors.New("certificate event not found: " + err.Error())
+	}
+
+	return &models.CertificateVerification{
+		Code:       certificate.Code,
+		HolderName: certificate.HolderName,
+		EventName:  certificate.EventName,
+		EventSlug:  event.Slug,
+		Hours:      certificate.Hours,
+		IssuedAt:   certificate.IssuedAt,
+	}, nil
+}
+
+func (s *EventService) GetAdminEvents(admin models.User, status string, page, pageSize int) (*models.AdminEventList, error) {
+	if !admin.IsSuperUser {
+		return nil, errors.New("unauthorized: only super users can list all events")
+	}
+
+	eventStatus := models.AdminEventStatus(strings.ToLower(status))
+	switch eventStatus {
+	case "", models.AdminEventActive, models.AdminEventHidden, models.AdminEventBlocked, models.AdminEventDeleted:
+	default:
+		return nil, errors.New("invalid status, must be one of active, hidden, blocked or deleted")
+	}
+
+	events, total, err := s.EventRepo.GetAdminEventSummaries(eventStatus, (page-1)*pageSize, pageSize)
+	if err != nil {
+		return nil, errors.New("failed to get events: " + err.Error())
+	}
+	if events == nil {
+		events = []models.AdminEventSummary{}
+	}
+
+	return &models.AdminEventList{
+		Events:   events,
+		Page:     page,
+		PageSize: pageSize,
+		Total:    total,
+	}, nil
+}
+
+// Badge sizes in millimeters, portrait A7, A6 and A5
+var badgeSizes = map[string][2]float64{
+	"small":  {74, 105},
+	"medium": {105, 148},
+	"large":  {148, 210},
+}
+
+// GetUserBadge renders the printable badge of the user for an event they are registered to
+func (s *EventService) GetUserBadge(user models.User, slug, size string) ([]byte, error) {
+	event, err := s.EventRepo.GetEventBySlug(slug)
+	if err != nil {
+		return nil, errors.New("event not found: " + err.Error())
+	}
+
+	return s.renderRegistrantBadge(user, event, size)
+}
+
+// GetRegistrantBadge renders the badge of any registrant of the event, for admins reprinting badges at the desk
+func (s *EventService) GetRegistrantBadge(admin models.User, slug, userID, size string) ([]byte, error) {
+	event, err := s.EventRepo.GetEventBySlug(slug)
+	if err != nil {
+		return nil, errors.New("event not found: " + err.Error())
+	}
+
+	if !admin.IsSuperUser && event.CreatedBy != admin.ID {
+		adminStatus, err := s.EventRepo.GetUserAdminStatusBySlug(admin.ID, slug)
+		if err != nil || (adminStatus.AdminType != models.AdminTypeMaster && adminStatus.AdminType != models.AdminTypeNormal) {
+			return nil, errors.New("unauthorized: only admins can print badges for other users")
+		}
+	}
+
+	user, err := s.EventRepo.GetUserByID(userID)
+	if err != nil {
+		return nil, errors.New("user not found: " + err.Error())
+	}
+
+	return s.renderRegistrantBadge(user, event, size)
+}
+
+func (s *EventService) renderRegistrantBadge(user models.User, event *models.Event, size string) ([]byte, error) {
+	if size == "" {
+		size = "medium"
+	}
+	dimensions, ok := badgeSizes[size]
+	if !ok {
+		return nil, errors.New("invalid size, must be one of small, medium or large")
+	}
+
+	isRegistered, err := s.EventRepo.IsUserRegisteredToEvent(user.ID, event.Slug)
+	if err != nil {
+		return nil, err
+	}
+	if !isRegistered {
+		return nil, errors.New("user is not registered to this event")
+	}
+
+	// Same payload as the registration email QR, so the badge works at check-in
+	png, err := qrcode.Encode(user.ID, qrcode.Medium, 512)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate QR code: %v", err)
+	}
+
+	return renderBadge(user, *event, dimensions[0], dimensions[1], base64.StdEncoding.EncodeToString(png))
+}
+
+// renderBadge executes the SVG badge template, every position is derived from the badge width
+// so the layout scales with the requested size
+func renderBadge(user models.User, event models.Event, width, height float64, qrCode string) ([]byte, error) {
+	content, err := os.ReadFile(filepath.Join("templates", "badge.svg"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read badge template: %v", err)
+	}
+
+	tmpl, err := template.New("badgeTemplate").Parse(string(content))
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse badge template: %v", err)
+	}
+
+	unit := width / 105
+	qrSize := width * 0.6
+	data := struct {
+		User             models.User
+		Event            models.Event
+		QRCode           string
+		Width            float64
+		Height           float64
+		InnerWidth       float64
+		InnerHeight      float64
+		CenterX          float64
+		EventY           float64
+		EventFontSize    float64
+		NameY            float64
+		NameFontSize     float64
+		LastNameY        float64
+		LastNameFontSize float64
+		QRX              float64
+		QRY              float64
+		QRSize           float64
+	}{
+		User:             user,
+		Event:            event,
+		QRCode:           qrCode,
+		Width:            width,
+		Height:           height,
+		InnerWidth:       width - 1,
+		InnerHeight:      height - 1,
+		CenterX:          width / 2,
+		EventY:           14 * unit,
+		EventFontSize:    6 * unit,
+		NameY:            32 * unit,
+		NameFontSize:     12 * unit,
+		LastNameY:        44 * unit,
+		LastNameFontSize: 8 * unit,
+		QRX:              (width - qrSize) / 2,
+		QRY:              height - qrSize - 10*unit,
+		QRSize:           qrSize,
+	}
+
+	var body bytes.Buffer
+	if err := tmpl.Execute(&body, data); err != nil {
+		return nil, fmt.Errorf("failed to execute badge template: %v", err)
+	}
+
+	return body.Bytes(), nil
+}
+
+const maxAnnouncementTitleLength = 150
+
+// requireMasterAdmin fails unless the user is a super user, the event creator or one of its master admins
+func (s *EventService) requireMasterAdmin(user models.User, event *models.Event, action string) error {
+	if user.IsSuperUser || event.CreatedBy == user.ID {
+		return nil
+	}
+	adminStatus, err := s.EventRepo.GetUserAdminStatusBySlug(user.ID, event.Slug)
+	if err != nil || adminStatus.AdminType != models.AdminTypeMaster {
+		return errors.New("unauthorized: only master admins can " + action)
+	}
+	return nil
+}
+
+func (s *EventService) CreateAnnouncement(admin models.User, eventSlug string, req models.CreateAnnouncementRequest) (*models.EventAnnouncement, error) {
+	event, err := s.EventRepo.GetEventBySlug(eventSlug)
+	if err != nil {
+		return nil, errors.New("event not found: " + err.Error())
+	}
+
+	if err := s.requireMasterAdmin(admin, event, "post announcements"); err != nil {
+		return nil, err
+	}
+
+	title := strings.TrimSpace(req.Title)
+	if title == "" {
+		return nil, errors.New("announcement title can't be empty")
+	}
+	if len([]rune(title)) > maxAnnouncementTitleLength {
+		return nil, fmt.Errorf("announcement title can't be longer than %d characters", maxAnnouncementTitleLength)
+	}
+
+	announcement := &models.EventAnnouncement{
+		ID:        uuid.New().String(),
+		EventID:   event.ID,
+		Title:     title,
+		Body:      strings.TrimSpace(req.Body),
+		Pinned:    req.Pinned,
+		CreatedBy: admin.ID,
+	}
+	if err := s.EventRepo.CreateAnnouncement(announcement); err != nil {
+		return nil, errors.New("failed to create announcement: " + err.Error())
+	}
+
+	return announcement, nil
+}
+
+func (s *EventService) DeleteAnnouncement(admin models.User, eventSlug, announcementID string) error {
+	event, err := s.EventRepo.GetEventBySlug(eventSlug)
+	if err != nil {
+		return errors.New("event not found: " + err.Error())
+	}
+
+	if err := s.requireMasterAdmin(admin, event, "delete announcements"); err != nil {
+		return err
+	}
+
+	return s.EventRepo.DeleteAnnouncement(event.ID, announcementID)
+}
+
+// GetAnnouncements lists the event announcements for its registrants and admins, pinned ones first
+func (s *EventService) GetAnnouncements(user models.User, eventSlug string, page, pageSize int) (*models.EventAnnouncementList, error) {
+	event, err := s.EventRepo.GetEventBySlug(eventSlug)
+	if err != nil {
+		return nil, errors.New("event not found: " + err.Error())
+	}
+
+	if !user.IsSuperUser && event.CreatedBy != user.ID {
+		isRegistered, err := s.EventRepo.IsUserRegisteredToEvent(user.ID, eventSlug)
+		if err != nil {
+			return nil, errors.New("error checking event registration: " + err.Error())
+		}
+		if !isRegistered {
+			adminStatus, err := s.EventRepo.GetUserAdminStatusBySlug(user.ID, eventSlug)
+			if err != nil || (adminStatus.AdminType != models.AdminTypeMaster && adminStatus.AdminType != models.AdminTypeNormal) {
+				return nil, errors.New("unauthorized: only registrants can read the event announcements")
+			}
+		}
+	}
+
+	announcements, total, err := s.EventRepo.GetAnnouncements(event.ID, (page-1)*pageSize, pageSize)
+	if err != nil {
+		return nil, errors.New("failed to get announcements: " + err.Error())
+	}
+	if announcements == nil {
+		announcements = []models.EventAnnouncement{}
+	}
+
+	return &models.EventAnnouncementList{
+		Announcements: announcements,
+		Page:          page,
+		PageSize:      pageSize,
+		Total:         total,
+	}, nil
+}
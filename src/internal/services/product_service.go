@@ -4,16 +4,25 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"io"
 	"log"
+	"math"
 	"net/http"
+	"os"
+	"path/filepath"
 	"scti/config"
 	"scti/internal/models"
 	repos "scti/internal/repositories"
 	"slices"
+	"strconv"
+	"strings"
+	"text/template"
 	"time"
 
 	"github.com/google/uuid"
+	"github.com/mercadopago/sdk-go/pkg/order"
 	"github.com/mercadopago/sdk-go/pkg/payment"
+	"gopkg.in/mail.v2"
 )
 
 type ProductService struct {
@@ -50,6 +59,10 @@ func (s *ProductService) CreateEventProduct(user models.User, eventSlug string,
 		return nil, errors.New("token quantity must be greater than 0")
 	}
 
+	if req.UenfDiscountPercent < 0 || req.UenfDiscountPercent > 100 {
+		return nil, errors.New("uenf discount percent must be between 0 and 100")
+	}
+
 	if req.IsEventAccess || req.IsActivityAccess {
 		req.IsTicketType = true
 	} else {
@@ -94,6 +107,11 @@ func (s *ProductService) CreateEventProduct(user models.User, eventSlug string,
 		}
 	}
 
+	bundles, err := s.buildProductBundles(event.ID, productID, req.BundledProducts)
+	if err != nil {
+		return nil, err
+	}
+
 	if req.ExpiresAt.IsZero() {
 		req.ExpiresAt = event.EndDate
 	}
@@ -109,6 +127,7 @@ func (s *ProductService) CreateEventProduct(user models.User, eventSlug string,
 		Name:                 req.Name,
 		Description:          req.Description,
 		PriceInt:             req.PriceInt,
+		UenfDiscountPercent:  req.UenfDiscountPercent,
 		MaxOwnableQuantity:   req.MaxOwnableQuantity,
 		IsEventAccess:        req.IsEventAccess,
 		IsActivityAccess:     req.IsActivityAccess,
@@ -123,6 +142,7 @@ func (s *ProductService) CreateEventProduct(user models.User, eventSlug string,
 		Quantity:             req.Quantity,
 		ExpiresAt:            req.ExpiresAt,
 		AccessTargets:        accessTargets,
+		BundledProducts:      bundles,
 	}
 
 	err = s.ProductRepo.CreateProduct(&product)
@@ -133,6 +153,49 @@ func (s *ProductService) CreateEventProduct(user models.User, eventSlug string,
 	return &product, nil
 }
 
+// buildProductBundles validates the products bundled in a new product: they must belong to the
+// same event and can't bundle products themselves, bundles aren't nested
+func (s *ProductService) buildProductBundles(eventID, productID string, items []models.BundledProductRequest) ([]models.ProductBundle, error) {
+	bundles := make([]models.ProductBundle, 0, len(items))
+	seen := make(map[string]bool)
+	for _, item := range items {
+		if item.Quantity == 0 {
+			item.Quantity = 1
+		}
+		if item.Quantity < 0 {
+			return nil, errors.New("invalid bundled product: quantity must be at least 1")
+		}
+		if seen[item.ProductID] {
+			return nil, errors.New("invalid bundled product: product " + item.ProductID + " is repeated")
+		}
+		seen[item.ProductID] = true
+
+		child, err := s.ProductRepo.GetProductByID(item.ProductID)
+		if err != nil {
+			return nil, errors.New("invalid bundled product, couldn't find product " + item.ProductID)
+		}
+		if child.EventID != eventID {
+			return nil, errors.New("invalid bundled product: " + child.Name + " belongs to another event")
+		}
+
+		isBundle, err := s.ProductRepo.IsProductBundle(child.ID)
+		if err != nil {
+			return nil, errors.New("failed to check bundled product: " + err.Error())
+		}
+		if isBundle {
+			return nil, errors.New("invalid bundled product: " + child.Name + " is a bundle itself")
+		}
+
+		bundles = append(bundles, models.ProductBundle{
+			ID:              uuid.New().String(),
+			ParentProductID: productID,
+			ChildProductID:  child.ID,
+			Quantity:        item.Quantity,
+		})
+	}
+	return bundles, nil
+}
+
 func (s *ProductService) UpdateEventProduct(user models.User, eventSlug string, productID string, req models.ProductRequest) (*models.Product, error) {
 	event, err := s.ProductRepo.GetEventBySlug(eventSlug)
 	if err != nil {
@@ -169,9 +232,14 @@ func (s *ProductService) UpdateEventProduct(user models.User, eventSlug string,
 		return nil, errors.New("product can't expire after event end date")
 	}
 
+	if req.UenfDiscountPercent < 0 || req.UenfDiscountPercent > 100 {
+		return nil, errors.New("uenf discount percent must be between 0 and 100")
+	}
+
 	product.Name = req.Name
 	product.Description = req.Description
 	product.PriceInt = req.PriceInt
+	product.UenfDiscountPercent = req.UenfDiscountPercent
 	product.MaxOwnableQuantity = req.MaxOwnableQuantity
 	product.IsEventAccess = req.IsEventAccess
 	product.IsActivityAccess = req.IsActivityAccess
@@ -265,15 +333,13 @@ func (s *ProductService) DeleteEventProduct(user models.User, eventSlug string,
 		}
 	}
 
-	relation, err := s.ProductRepo.GetUserProducts()
+	impact, err := s.ProductRepo.GetProductDeleteImpact(productID)
 	if err != nil {
 		return errors.New("failed to retrive bought products info for deletion safety")
 	}
 
-	for _, product := range relation {
-		if product.ProductID == productID {
-			return errors.New("cannot delete a product that has been purchased by someone")
-		}
+	if reasons := productDeleteBlockers(impact); len(reasons) > 0 {
+		return errors.New("cannot delete a product that has been purchased by someone: " + strings.Join(reasons, ", "))
 	}
 
 	err = s.ProductRepo.DeleteProduct(productID)
@@ -284,6 +350,59 @@ func (s *ProductService) DeleteEventProduct(user models.User, eventSlug string,
 	return nil
 }
 
+// productDeleteBlockers lists why a product can't be deleted, deletion is only safe when nothing references it
+func productDeleteBlockers(impact *models.ProductDeleteImpact) []string {
+	reasons := []string{}
+	if impact.Purchases > 0 {
+		reasons = append(reasons, fmt.Sprintf("%d purchases", impact.Purchases))
+	}
+	if impact.AffectedUsers > 0 {
+		reasons = append(reasons, fmt.Sprintf("owned by %d users", impact.AffectedUsers))
+	}
+	if impact.TokensIssued > 0 {
+		reasons = append(reasons, fmt.Sprintf("%d tokens issued", impact.TokensIssued))
+	}
+	return reasons
+}
+
+// GetProductDeleteImpact previews what deleting the product would affect, running the same checks as the deletion
+func (s *ProductService) GetProductDeleteImpact(admin models.User, eventSlug string, productID string) (*models.ProductDeleteImpact, error) {
+	event, err := s.ProductRepo.GetEventBySlug(eventSlug)
+	if err != nil {
+		return nil, errors.New("event not found: " + err.Error())
+	}
+
+	if !admin.IsSuperUser && event.CreatedBy != admin.ID {
+		adminStatus, err := s.ProductRepo.GetAdminStatusForEvent(admin.ID, event.ID)
+		if err != nil || (adminStatus.AdminType != models.AdminTypeMaster && adminStatus.AdminType != models.AdminTypeNormal) {
+			return nil, errors.New("unauthorized: only admins can preview product deletion")
+		}
+	}
+
+	product, err := s.ProductRepo.GetProductByID(productID)
+	if err != nil {
+		return nil, errors.New("product not found: " + err.Error())
+	}
+
+	if product.EventID != event.ID {
+		return nil, errors.New("product not found in this event")
+	}
+
+	impact, err := s.ProductRepo.GetProductDeleteImpact(product.ID)
+	if err != nil {
+		return nil, errors.New("failed to get product delete impact: " + err.Error())
+	}
+
+	impact.AccessTargets = product.AccessTargets
+	if impact.AccessTargets == nil {
+		impact.AccessTargets = []models.AccessTarget{}
+	}
+	impact.Reasons = productDeleteBlockers(impact)
+	impact.CanDelete = len(impact.Reasons) == 0
+
+	return impact, nil
+}
+
 func (s *ProductService) GetAllProductsFromEvent(eventSlug string) ([]models.Product, error) {
 	event, err := s.ProductRepo.GetEventBySlug(eventSlug)
 	if err != nil {
@@ -345,164 +464,491 @@ func (s *ProductService) GetUserPurchases(user models.User) ([]models.Purchase,
 	return s.ProductRepo.GetUserPurchases(user.ID)
 }
 
-func (s *ProductService) PurchaseProducts(user models.User, eventSlug string, req models.PurchaseRequest, w http.ResponseWriter) (*models.PurchaseResponse, error) {
-	if req.IsGift {
-		if req.GiftedToEmail == nil {
-			return nil, errors.New("gifted_to_email is required when gifting")
-		}
-		if *req.GiftedToEmail == user.Email {
-			return nil, errors.New("invalid operation: cannot gift to yourself")
-		}
+// GetUserPendingAccess lists the events and activities the user's gifted products give access to that
+// they didn't register to yet, each with the request that registers them
+func (s *ProductService) GetUserPendingAccess(user models.User) ([]models.PendingAccess, error) {
+	gifted, err := s.ProductRepo.GetUserGiftedProducts(user.ID)
+	if err != nil {
+		return nil, errors.New("failed to get gifted products: " + err.Error())
 	}
 
-	if req.PaymentMethodID == "" {
-		return nil, errors.New("payment method ID is required")
-	}
-	if req.PaymentMethodID == "pix" {
-		return nil, errors.New("use the create-pix-purchase endpoint")
-	}
-	if req.PaymentMethodToken == "" {
-		return nil, errors.New("payment method token is required")
+	pending := []models.PendingAccess{}
+	if len(gifted) == 0 {
+		return pending, nil
 	}
-	if req.PaymentMethodInstallments < 1 {
-		return nil, errors.New("installments must be at least 1")
+
+	productIDs := make([]string, 0, len(gifted))
+	for _, userProduct := range gifted {
+		productIDs = append(productIDs, userProduct.ProductID)
 	}
 
-	event, err := s.ProductRepo.GetEventBySlug(eventSlug)
+	products, err := s.ProductRepo.GetProductsByIDs(productIDs)
 	if err != nil {
-		return nil, errors.New("event not found: " + err.Error())
+		return nil, errors.New("failed to get products: " + err.Error())
 	}
 
-	isUserRegistered, err := s.ProductRepo.IsUserRegisteredToEvent(user.ID, event.ID)
-	if err != nil {
-		return nil, errors.New("error checking user registration: " + err.Error())
+	// An empty activity ID means the access is to the event itself
+	type access struct{ eventID, activityID string }
+	productsByID := make(map[string]models.Product, len(products))
+	accesses := make(map[string][]access, len(products))
+	var eventIDs, activityIDs []string
+	for _, product := range products {
+		productsByID[product.ID] = product
+		if product.IsEventAccess {
+			accesses[product.ID] = append(accesses[product.ID], access{eventID: product.EventID})
+			eventIDs = append(eventIDs, product.EventID)
+		}
+		for _, target := range product.AccessTargets {
+			if target.IsEvent {
+				accesses[product.ID] = append(accesses[product.ID], access{eventID: target.TargetID})
+				eventIDs = append(eventIDs, target.TargetID)
+			} else {
+				accesses[product.ID] = append(accesses[product.ID], access{activityID: target.TargetID})
+				activityIDs = append(activityIDs, target.TargetID)
+			}
+		}
 	}
 
-	if !isUserRegistered {
-		return nil, errors.New("user is not registered to this event")
+	activitiesByID := make(map[string]models.Activity)
+	if len(activityIDs) > 0 {
+		activities, err := s.ProductRepo.GetActivitiesByIDs(activityIDs)
+		if err != nil {
+			return nil, errors.New("failed to get activities: " + err.Error())
+		}
+		for _, activity := range activities {
+			activitiesByID[activity.ID] = activity
+			eventIDs = append(eventIDs, activity.EventID)
+		}
 	}
 
-	product, err := s.ProductRepo.GetProductByID(req.ProductID)
-	if err != nil {
-		return nil, errors.New("product not found: " + err.Error())
+	eventsByID := make(map[string]models.Event)
+	if len(eventIDs) > 0 {
+		events, err := s.ProductRepo.GetEventsByIDs(eventIDs)
+		if err != nil {
+			return nil, errors.New("failed to get events: " + err.Error())
+		}
+		for _, event := range events {
+			eventsByID[event.ID] = event
+		}
 	}
 
-	if product.IsBlocked {
-		return nil, errors.New("product is blocked from purchases")
+	registeredEventIDs, err := s.ProductRepo.GetUserRegisteredEventIDs(user.ID)
+	if err != nil {
+		return nil, errors.New("failed to get user events: " + err.Error())
+	}
+	registeredEvents := make(map[string]bool, len(registeredEventIDs))
+	for _, id := range registeredEventIDs {
+		registeredEvents[id] = true
 	}
 
-	if product.ExpiresAt.Before(time.Now()) {
-		return nil, errors.New("product has expired")
+	registeredActivityIDs, err := s.ProductRepo.GetUserRegisteredActivityIDs(user.ID)
+	if err != nil {
+		return nil, errors.New("failed to get user activities: " + err.Error())
+	}
+	registeredActivities := make(map[string]bool, len(registeredActivityIDs))
+	for _, id := range registeredActivityIDs {
+		registeredActivities[id] = true
 	}
 
-	if product.EventID != event.ID {
-		return nil, errors.New("product does not belong to this event")
+	gifterNames := make(map[string]string)
+	for _, userProduct := range gifted {
+		product, ok := productsByID[userProduct.ProductID]
+		if !ok {
+			continue
+		}
+
+		seen := make(map[access]bool)
+		for _, target := range accesses[product.ID] {
+			if seen[target] {
+				continue
+			}
+			seen[target] = true
+
+			eventID := target.eventID
+			activity, isActivity := activitiesByID[target.activityID]
+			if target.activityID != "" {
+				if !isActivity || registeredActivities[activity.ID] {
+					continue
+				}
+				eventID = activity.EventID
+			} else if registeredEvents[eventID] {
+				continue
+			}
+
+			event, ok := eventsByID[eventID]
+			if !ok {
+				continue
+			}
+
+			entry := models.PendingAccess{
+				UserProductID: userProduct.ID,
+				ProductID:     product.ID,
+				ProductName:   product.Name,
+				GiftedFromID:  userProduct.GiftedFromID,
+				EventID:       event.ID,
+				EventSlug:     event.Slug,
+				EventName:     event.Name,
+				Register:      models.RegisterAction{Method: http.MethodPost, Path: "/events/" + event.Slug + "/register"},
+			}
+
+			if isActivity {
+				entry.ActivityID = activity.ID
+				entry.ActivityName = activity.Name
+				// Activities only take registrations from users registered to their event
+				if registeredEvents[event.ID] {
+					entry.Register = models.RegisterAction{
+						Method: http.MethodPost,
+						Path:   "/events/" + event.Slug + "/activity/register",
+						Body:   map[string]string{"activity_id": activity.ID},
+					}
+				}
+			}
+
+			if userProduct.GiftedFromID != nil {
+				gifterID := *userProduct.GiftedFromID
+				if _, ok := gifterNames[gifterID]; !ok {
+					if gifter, err := s.ProductRepo.GetUserByID(gifterID); err == nil {
+						gifterNames[gifterID] = strings.TrimSpace(gifter.Name + " " + gifter.LastName)
+					}
+				}
+				entry.GiftedFromName = gifterNames[gifterID]
+			}
+
+			pending = append(pending, entry)
+		}
 	}
 
-	if req.Quantity < 1 {
-		return nil, errors.New("quantity must be at least 1")
+	return pending, nil
+}
+
+// GetEventTokens lists the tokens issued for the event so organizers can reconcile sales and redemptions
+func (s *ProductService) GetEventTokens(admin models.User, eventSlug string, used *bool, page, pageSize int) (*models.EventTokenList, error) {
+	event, err := s.ProductRepo.GetEventBySlug(eventSlug)
+	if err != nil {
+		return nil, errors.New("event not found: " + err.Error())
 	}
 
-	if !product.HasUnlimitedQuantity {
-		if product.Quantity < req.Quantity {
-			return nil, fmt.Errorf("not enough quantity available, want %v have %v", req.Quantity, product.Quantity)
+	if !admin.IsSuperUser && event.CreatedBy != admin.ID {
+		adminStatus, err := s.ProductRepo.GetAdminStatusForEvent(admin.ID, event.ID)
+		if err != nil || adminStatus.AdminType != models.AdminTypeMaster {
+			return nil, errors.New("unauthorized: only master admins can list event tokens")
 		}
 	}
 
-	if req.Quantity > product.MaxOwnableQuantity {
-		return nil, fmt.Errorf("requested quantity exceeds max ownable quantity by: %d", req.Quantity-product.MaxOwnableQuantity)
+	tokens, total, err := s.ProductRepo.GetEventTokens(event.ID, used, (page-1)*pageSize, pageSize)
+	if err != nil {
+		return nil, errors.New("failed to get event tokens: " + err.Error())
+	}
+	if tokens == nil {
+		tokens = []models.EventToken{}
 	}
 
-	ownedUserProducts, err := s.ProductRepo.GetUserProductByUserIDAndProductID(user.ID, product.ID)
+	return &models.EventTokenList{
+		Tokens:   tokens,
+		Page:     page,
+		PageSize: pageSize,
+		Total:    total,
+	}, nil
+}
+
+// GetUserSpend sums what the user paid, per event and overall, net of refunds
+func (s *ProductService) GetUserSpend(user models.User) (*models.UserSpend, error) {
+	events, err := s.ProductRepo.GetUserSpendByEvent(user.ID)
 	if err != nil {
-		return nil, errors.New("failed to get user product: " + err.Error())
+		return nil, errors.New("failed to get user spend: " + err.Error())
 	}
 
-	var ownedQuantity int
-	if len(ownedUserProducts) > 0 {
-		for _, userProduct := range ownedUserProducts {
-			ownedQuantity += userProduct.Quantity
-		}
+	spend := &models.UserSpend{Events: []models.EventSpend{}}
+	for _, event := range events {
+		event.SpentInt = event.PaidInt - event.RefundedInt
+		spend.PaidInt += event.PaidInt
+		spend.RefundedInt += event.RefundedInt
+		spend.SpentInt += event.SpentInt
+		spend.Events = append(spend.Events, event)
+	}
+
+	return spend, nil
+}
+
+// ValidatePurchase runs the checks of PurchaseProducts without charging anything, so the cart can show why
+// a purchase would be rejected before the user fills in payment details. Rejections are reported in the
+// result, only a missing event or a failed lookup is returned as an error
+func (s *ProductService) ValidatePurchase(user models.User, eventSlug string, req models.PurchaseRequest) (*models.PurchaseValidation, error) {
+	if _, err := s.ProductRepo.GetEventBySlug(eventSlug); err != nil {
+		return nil, errors.New("event not found: " + err.Error())
 	}
 
-	if ownedQuantity+req.Quantity > product.MaxOwnableQuantity {
-		text := fmt.Sprintf("user with %d of this product is trying to buy %d, max ownable quantity is %d, this exceeds it by %d", ownedQuantity, req.Quantity, product.MaxOwnableQuantity, ownedQuantity+req.Quantity-product.MaxOwnableQuantity)
-		return nil, errors.New(text)
+	_, _, price, err := s.checkPurchase(user, eventSlug, req)
+	if err != nil {
+		var lookupErr *lookupError
+		if errors.As(err, &lookupErr) {
+			return nil, err
+		}
+		return &models.PurchaseValidation{Valid: false, Reason: err.Error()}, nil
 	}
 
-	return s.ProductRepo.PurchaseProduct(user, event, product, req, w)
+	return &models.PurchaseValidation{Valid: true, Price: price}, nil
 }
 
-func (s *ProductService) ForcedPix(user models.User, eventSlug string, req models.PurchaseRequest) (*payment.Response, error) {
+// lookupError is a purchase check that failed because data couldn't be read rather than because the
+// purchase is invalid, ValidatePurchase returns it instead of reporting it as the rejection reason
+type lookupError struct {
+	err error
+}
+
+func (e *lookupError) Error() string {
+	return e.err.Error()
+}
+
+func (e *lookupError) Unwrap() error {
+	return e.err
+}
+
+func lookupFailed(msg string, err error) error {
+	return &lookupError{err: errors.New(msg + err.Error())}
+}
+
+// checkPurchase runs every check a purchase goes through before payment and prices it. Failed
+// lookups are returned as a *lookupError, any other error rejects the purchase itself
+func (s *ProductService) checkPurchase(user models.User, eventSlug string, req models.PurchaseRequest) (*models.Event, *models.Product, *models.PriceBreakdown, error) {
 	if req.IsGift {
 		if req.GiftedToEmail == nil {
-			return nil, errors.New("gifted_to_email is required when gifting")
+			return nil, nil, nil, errors.New("gifted_to_email is required when gifting")
 		}
 		if *req.GiftedToEmail == user.Email {
-			return nil, errors.New("invalid operation: cannot gift to yourself")
+			return nil, nil, nil, errors.New("invalid operation: cannot gift to yourself")
 		}
 	}
 
 	event, err := s.ProductRepo.GetEventBySlug(eventSlug)
 	if err != nil {
-		return nil, errors.New("event not found: " + err.Error())
+		return nil, nil, nil, errors.New("event not found: " + err.Error())
+	}
+
+	if event.IsBlocked {
+		return nil, nil, nil, errors.New("event is blocked from purchases")
 	}
 
 	isUserRegistered, err := s.ProductRepo.IsUserRegisteredToEvent(user.ID, event.ID)
 	if err != nil {
-		return nil, errors.New("error checking user registration: " + err.Error())
+		return nil, nil, nil, lookupFailed("error checking user registration: ", err)
 	}
 
 	if !isUserRegistered {
-		return nil, errors.New("user is not registered to this event")
+		return nil, nil, nil, errors.New("user is not registered to this event")
 	}
 
 	product, err := s.ProductRepo.GetProductByID(req.ProductID)
 	if err != nil {
-		return nil, errors.New("product not found: " + err.Error())
+		return nil, nil, nil, errors.New("product not found: " + err.Error())
 	}
 
 	if product.IsBlocked {
-		return nil, errors.New("product is blocked from purchases")
+		return nil, nil, nil, errors.New("product is blocked from purchases")
 	}
 
 	if product.ExpiresAt.Before(time.Now()) {
-		return nil, errors.New("product has expired")
+		return nil, nil, nil, errors.New("product has expired")
 	}
 
 	if product.EventID != event.ID {
-		return nil, errors.New("product does not belong to this event")
+		return nil, nil, nil, errors.New("product does not belong to this event")
 	}
 
 	if req.Quantity < 1 {
-		return nil, errors.New("quantity must be at least 1")
+		return nil, nil, nil, errors.New("quantity must be at least 1")
 	}
 
 	if !product.HasUnlimitedQuantity {
 		if product.Quantity < req.Quantity {
-			return nil, fmt.Errorf("not enough quantity available, want %v have %v", req.Quantity, product.Quantity)
+			return nil, nil, nil, fmt.Errorf("not enough quantity available, want %v have %v", req.Quantity, product.Quantity)
 		}
 	}
 
 	if req.Quantity > product.MaxOwnableQuantity {
-		return nil, fmt.Errorf("requested quantity exceeds max ownable quantity by: %d", req.Quantity-product.MaxOwnableQuantity)
+		return nil, nil, nil, fmt.Errorf("requested quantity exceeds max ownable quantity by: %d", req.Quantity-product.MaxOwnableQuantity)
+	}
+
+	if req.IsGift {
+		// What the gifter owns doesn't matter, the recipient is the one that ends up with the product
+		reason, err := s.giftRejection(user, product, *req.GiftedToEmail, req.Quantity)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		if reason != "" {
+			return nil, nil, nil, errors.New("invalid gift: " + reason)
+		}
+	} else {
+		ownedUserProducts, err := s.ProductRepo.GetUserProductByUserIDAndProductID(user.ID, product.ID)
+		if err != nil {
+			return nil, nil, nil, lookupFailed("failed to get user product: ", err)
+		}
+
+		var ownedQuantity int
+		if len(ownedUserProducts) > 0 {
+			for _, userProduct := range ownedUserProducts {
+				ownedQuantity += userProduct.Quantity
+			}
+		}
+
+		if ownedQuantity+req.Quantity > product.MaxOwnableQuantity {
+			text := fmt.Sprintf("user with %d of this product is trying to buy %d, max ownable quantity is %d, this exceeds it by %d", ownedQuantity, req.Quantity, product.MaxOwnableQuantity, ownedQuantity+req.Quantity-product.MaxOwnableQuantity)
+			return nil, nil, nil, errors.New(text)
+		}
+	}
+
+	if err := s.checkProductAccessGrant(user, product, req); err != nil {
+		return nil, nil, nil, err
+	}
+
+	if product.IsTicketType {
+		if err := s.checkTicketOwnership(user, product, req); err != nil {
+			return nil, nil, nil, err
+		}
 	}
 
-	ownedUserProducts, err := s.ProductRepo.GetUserProductByUserIDAndProductID(user.ID, product.ID)
+	price, err := s.ComputePrice(user, product, req.Quantity, req.Coupon)
 	if err != nil {
-		return nil, errors.New("failed to get user product: " + err.Error())
+		return nil, nil, nil, err
 	}
 
-	var ownedQuantity int
-	if len(ownedUserProducts) > 0 {
-		for _, userProduct := range ownedUserProducts {
-			ownedQuantity += userProduct.Quantity
+	return event, product, price, nil
+}
+
+func (s *ProductService) PurchaseProducts(user models.User, eventSlug string, req models.PurchaseRequest, w http.ResponseWriter) (*models.PurchaseResponse, error) {
+	event, product, price, err := s.checkPurchase(user, eventSlug, req)
+	if err != nil {
+		return nil, err
+	}
+
+	// Free products never reach the payment gateway, so no payment info is needed
+	if price.TotalInt > 0 {
+		if err := checkPaymentInfo(req); err != nil {
+			return nil, err
+		}
+	}
+
+	response, err := s.ProductRepo.PurchaseProduct(user, event, product, req, price, w)
+	if err != nil {
+		return nil, err
+	}
+
+	if req.IsGift {
+		go s.NotifyGiftRecipient(user, *req.GiftedToEmail, product, req.Quantity)
+	}
+
+	return response, nil
+}
+
+const maxCartItems = 20
+
+// PurchaseCart buys every item of the cart with a single payment for the sum of their prices. Each item
+// goes through the checks of PurchaseProducts and one failing item rejects the whole cart
+func (s *ProductService) PurchaseCart(user models.User, eventSlug string, req models.PurchaseCartRequest) (*models.PurchaseCartResponse, error) {
+	if len(req.Items) == 0 {
+		return nil, errors.New("cart is empty")
+	}
+	if len(req.Items) > maxCartItems {
+		return nil, fmt.Errorf("a cart can hold at most %d items", maxCartItems)
+	}
+
+	// A coupon of a single product only discounts that item, the others are priced without it
+	couponProductID := ""
+	if code := normalizeCouponCode(req.Coupon); code != "" {
+		couponEvent, err := s.ProductRepo.GetEventBySlug(eventSlug)
+		if err != nil {
+			return nil, errors.New("event not found: " + err.Error())
+		}
+		coupon, err := s.ProductRepo.GetCouponByCode(couponEvent.ID, code)
+		if err != nil {
+			return nil, errors.New("invalid coupon code")
+		}
+		if coupon.ProductID != nil {
+			couponProductID = *coupon.ProductID
+			if !slices.ContainsFunc(req.Items, func(item models.CartItem) bool { return item.ProductID == couponProductID }) {
+				return nil, errors.New("coupon does not apply to any product in the cart")
+			}
 		}
 	}
 
-	if ownedQuantity+req.Quantity > product.MaxOwnableQuantity {
-		text := fmt.Sprintf("user with %d of this product is trying to buy %d, max ownable quantity is %d, this exceeds it by %d", ownedQuantity, req.Quantity, product.MaxOwnableQuantity, ownedQuantity+req.Quantity-product.MaxOwnableQuantity)
-		return nil, errors.New(text)
+	var event *models.Event
+	products := make([]*models.Product, len(req.Items))
+	prices := make([]*models.PriceBreakdown, len(req.Items))
+	seen := make(map[string]bool)
+	tickets, totalInt := 0, 0
+	for i, item := range req.Items {
+		if seen[item.ProductID] {
+			return nil, errors.New("product " + item.ProductID + " appears more than once in the cart")
+		}
+		seen[item.ProductID] = true
+
+		itemReq := req.ItemRequest(i)
+		if couponProductID != "" && item.ProductID != couponProductID {
+			itemReq.Coupon = ""
+		}
+
+		itemEvent, product, price, err := s.checkPurchase(user, eventSlug, itemReq)
+		if err != nil {
+			return nil, fmt.Errorf("cart item %d: %w", i+1, err)
+		}
+
+		// Ticket ownership is checked per product, two different tickets in a cart would slip through
+		if product.IsTicketType {
+			tickets++
+			if tickets > 1 {
+				return nil, errors.New("a cart can hold only one ticket")
+			}
+		}
+
+		event, products[i], prices[i] = itemEvent, product, price
+		totalInt += price.TotalInt
+	}
+
+	if totalInt > 0 {
+		if err := checkPaymentInfo(req.ItemRequest(0)); err != nil {
+			return nil, err
+		}
+	}
+
+	response, err := s.ProductRepo.PurchaseCart(user, event, products, req, prices)
+	if err != nil {
+		return nil, err
+	}
+
+	if req.IsGift {
+		for i, product := range products {
+			go s.NotifyGiftRecipient(user, *req.GiftedToEmail, product, req.Items[i].Quantity)
+		}
+	}
+
+	return response, nil
+}
+
+// checkPaymentInfo makes sure a paid purchase carries what Mercado Pago needs to charge the card
+func checkPaymentInfo(req models.PurchaseRequest) error {
+	if req.PaymentMethodID == "" {
+		return errors.New("payment method ID is required")
+	}
+	if req.PaymentMethodID == "pix" {
+		return errors.New("use the create-pix-purchase endpoint")
+	}
+	if req.PaymentMethodToken == "" {
+		return errors.New("payment method token is required")
+	}
+	if req.PaymentMethodInstallments < 1 {
+		return errors.New("installments must be at least 1")
+	}
+	return nil
+}
+
+func (s *ProductService) ForcedPix(user models.User, eventSlug string, req models.PurchaseRequest) (*payment.Response, error) {
+	_, product, price, err := s.checkPurchase(user, eventSlug, req)
+	if err != nil {
+		return nil, err
+	}
+
+	if price.TotalInt == 0 {
+		return nil, errors.New("free products don't need a pix payment, use the purchase endpoint")
 	}
 
 	// ----------------------------------------------------- //
@@ -512,7 +958,7 @@ func (s *ProductService) ForcedPix(user models.User, eventSlug string, req model
 	mercadoPagoConfig := config.GetMercadoPagoConfig()
 	paymentClient := payment.NewClient(mercadoPagoConfig)
 	request := payment.Request{
-		TransactionAmount: (float64(product.PriceInt) / 100) * float64(req.Quantity),
+		TransactionAmount: float64(price.TotalInt) / 100,
 		PaymentMethodID:   "pix",
 		Payer: &payment.PayerRequest{
 			Email: user.Email,
@@ -529,7 +975,7 @@ func (s *ProductService) ForcedPix(user models.User, eventSlug string, req model
 	// ---------------- FIM DO PAGAMENTO ---------------- //
 	// -------------------------------------------------- //
 
-	err = s.ProductRepo.CreatePixPurchase(user, product, resource.ID, req)
+	err = s.ProductRepo.CreatePixPurchase(user, product, resource.ID, req, price)
 	if err != nil {
 		return nil, errors.New("could not create a pix statement")
 	}
@@ -537,61 +983,1777 @@ func (s *ProductService) ForcedPix(user models.User, eventSlug string, req model
 	return resource, nil
 }
 
-func (s *ProductService) CanGift(reqUser models.User, req models.CanGiftRequest) (bool, error) {
-	user, err := s.ProductRepo.GetUserByEmail(req.Email)
-	if err != nil {
-		return false, errors.New("could not find user to gift")
+// FinalizePixPayment records an approved pix payment as a purchase and lets a gift recipient know.
+// It returns repos.ErrPixPurchaseFinalized when the payment was already finalized
+func (s *ProductService) FinalizePixPayment(pixPurchase models.PixPurchase) error {
+	if err := s.ProductRepo.FinalizePixPurchase(pixPurchase); err != nil {
+		return err
 	}
 
-	if user.ID == reqUser.ID {
-		return false, errors.New("cannot gift yourself")
+	if pixPurchase.IsGift && pixPurchase.GiftedToEmail != nil {
+		gifter, err := s.ProductRepo.GetUserByID(pixPurchase.UserID)
+		product, productErr := s.ProductRepo.GetProductByID(pixPurchase.ProductID)
+		if err == nil && productErr == nil {
+			go s.NotifyGiftRecipient(gifter, *pixPurchase.GiftedToEmail, product, pixPurchase.Quantity)
+		}
 	}
 
-	product, err := s.ProductRepo.GetProductByID(req.ProductID)
-	if err != nil {
-		return false, errors.New("could not retrieve product for gifiting")
-	}
+	return nil
+}
 
-	event, err := s.ProductRepo.GetEventByID(product.EventID)
+// CancelPixPurchase abandons a pending pix payment of the user. The payment is cancelled at Mercado Pago
+// before the pending purchase goes away, so it can't be paid with nothing left to deliver
+func (s *ProductService) CancelPixPurchase(user models.User, purchaseID int) error {
+	pending, err := s.ProductRepo.GetPixPurchase(purchaseID)
 	if err != nil {
-		return false, errors.New("coudl not retrieve event of product for gifting")
+		return errors.New("pix purchase not found")
 	}
 
-	state, err := s.ProductRepo.IsUserRegisteredToEvent(user.ID, event.ID)
-	if err != nil {
-		return false, errors.New("could not check if the user is registered to the event of the product")
+	if pending.UserID != user.ID {
+		return errors.New("unauthorized: only the buyer can cancel this pix purchase")
 	}
 
-	if !state {
-		return false, errors.New("user is not registered to the event of the product")
+	if err := cancelPixPayment(purchaseID); err != nil {
+		return err
 	}
 
-	if !product.HasUnlimitedQuantity {
-		if product.Quantity < req.Quantity {
-			return false, fmt.Errorf("not enough quantity available, want %v have %v", req.Quantity, product.Quantity)
-		}
+	if err := s.ProductRepo.DeletePixPurchase(purchaseID); err != nil {
+		return errors.New("failed to delete pix purchase: " + err.Error())
 	}
+	return nil
+}
 
-	if req.Quantity > product.MaxOwnableQuantity {
-		return false, fmt.Errorf("requested quantity exceeds max ownable quantity by: %d", req.Quantity-product.MaxOwnableQuantity)
+// ExpirePixPurchases cancels the pending pix purchases older than the configured TTL. Payments Mercado Pago
+// refuses to cancel, usually because they were just paid, are kept for the webhook to finalize
+func (s *ProductService) ExpirePixPurchases() {
+	purchases, err := s.ProductRepo.GetStalePixPurchases(time.Now().Add(-config.GetPixPurchaseTTL()))
+	if err != nil {
+		log.Printf("Failed to get stale pix purchases: %v", err)
+		return
 	}
 
-	ownedUserProducts, err := s.ProductRepo.GetUserProductByUserIDAndProductID(user.ID, product.ID)
-	if err != nil {
-		return false, errors.New("failed to get user product: " + err.Error())
+	for _, purchase := range purchases {
+		if err := cancelPixPayment(purchase.PurchaseID); err != nil {
+			log.Printf("Failed to cancel stale pix purchase %d: %v", purchase.PurchaseID, err)
+			continue
+		}
+		if err := s.ProductRepo.DeletePixPurchase(purchase.PurchaseID); err != nil {
+			log.Printf("Failed to delete stale pix purchase %d: %v", purchase.PurchaseID, err)
+		}
 	}
+}
 
-	var ownedQuantity int
-	if len(ownedUserProducts) > 0 {
-		for _, userProduct := range ownedUserProducts {
-			ownedQuantity += userProduct.Quantity
+// StartPixPurchaseSweeper expires stale pix purchases every interval until ctx is done
+func (s *ProductService) StartPixPurchaseSweeper(ctx context.Context, interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				s.ExpirePixPurchases()
+			}
+		}
+	}()
+}
+
+// cancelPixPayment cancels the payment at Mercado Pago, payments it already cancelled or rejected,
+// like expired pix codes, count as cancelled
+func cancelPixPayment(paymentID int) error {
+	paymentClient := payment.NewClient(config.GetMercadoPagoConfig())
+	if _, err := paymentClient.Cancel(context.Background(), paymentID); err != nil {
+		resource, getErr := paymentClient.Get(context.Background(), paymentID)
+		if getErr == nil && (resource.Status == "cancelled" || resource.Status == "rejected") {
+			return nil
 		}
+		log.Println(err)
+		return errors.New("pix payment can't be cancelled, it may have been paid already")
+	}
+	return nil
+}
+
+// GetPixPurchaseStatus asks Mercado Pago for the status of a pix payment and finalizes it when it was
+// approved but the webhook didn't arrive yet. Only the buyer and the event admins can check it
+func (s *ProductService) GetPixPurchaseStatus(user models.User, eventSlug string, paymentID int) (*models.PixPurchaseStatus, error) {
+	event, err := s.ProductRepo.GetEventBySlug(eventSlug)
+	if err != nil {
+		return nil, errors.New("event not found: " + err.Error())
+	}
+
+	// Finalized payments no longer have a pending row, their purchase keeps the payment ID
+	status := &models.PixPurchaseStatus{PaymentID: paymentID}
+	pending, err := s.ProductRepo.GetPixPurchase(paymentID)
+	var buyerID, productID string
+	if err == nil {
+		buyerID, productID = pending.UserID, pending.ProductID
+	} else {
+		purchase, err := s.ProductRepo.GetPurchaseByPaymentID(strconv.Itoa(paymentID))
+		if err != nil {
+			return nil, errors.New("pix purchase not found")
+		}
+		buyerID, productID = purchase.UserID, purchase.ProductID
+		status.Finalized = true
+	}
+
+	product, err := s.ProductRepo.GetProductByID(productID)
+	if err != nil || product.EventID != event.ID {
+		return nil, errors.New("pix purchase not found in this event")
+	}
+
+	if buyerID != user.ID && !user.IsSuperUser && event.CreatedBy != user.ID {
+		adminStatus, err := s.ProductRepo.GetAdminStatusForEvent(user.ID, event.ID)
+		if err != nil || (adminStatus.AdminType != models.AdminTypeMaster && adminStatus.AdminType != models.AdminTypeNormal) {
+			return nil, errors.New("unauthorized: only the buyer and admins can check this pix purchase")
+		}
+	}
+
+	paymentClient := payment.NewClient(config.GetMercadoPagoConfig())
+	resource, err := paymentClient.Get(context.Background(), paymentID)
+	if err != nil {
+		log.Println(err)
+		return nil, errors.New("failed to get mercado pago payment")
+	}
+	status.Status = resource.Status
+
+	if status.Status == "approved" && !status.Finalized {
+		err := s.FinalizePixPayment(*pending)
+		if err != nil && !errors.Is(err, repos.ErrPixPurchaseFinalized) {
+			return nil, errors.New("failed to finalize pix purchase: " + err.Error())
+		}
+		status.Finalized = true
+	}
+
+	return status, nil
+}
+
+const (
+	maxReconcileRange    = 31 * 24 * time.Hour
+	reconcilePageSize    = 100
+	maxReconcilePayments = 5000
+)
+
+// ReconcilePayments cross-checks the Mercado Pago payments created in the window against the local
+// purchases, reporting approved payments nobody recorded and paid purchases Mercado Pago doesn't back
+func (s *ProductService) ReconcilePayments(admin models.User, req models.PaymentReconcileRequest) (*models.PaymentReconciliation, error) {
+	if !admin.IsSuperUser {
+		return nil, errors.New("unauthorized: only super users can reconcile payments")
+	}
+
+	if req.From.IsZero() || req.To.IsZero() || !req.From.Before(req.To) {
+		return nil, errors.New("from must be before to")
+	}
+	if req.To.Sub(req.From) > maxReconcileRange {
+		return nil, errors.New("the range can't be longer than 31 days")
+	}
+
+	ctx := context.Background()
+	paymentClient := payment.NewClient(config.GetMercadoPagoConfig())
+
+	result := &models.PaymentReconciliation{
+		From:     req.From,
+		To:       req.To,
+		Orphaned: []models.OrphanedPayment{},
+		Phantom:  []models.PhantomPurchase{},
+	}
+
+	var approved []payment.Response
+	paymentStatus := make(map[string]string)
+	for offset := 0; ; offset += reconcilePageSize {
+		if offset >= maxReconcilePayments {
+			result.Truncated = true
+			break
+		}
+
+		page, err := paymentClient.Search(ctx, payment.SearchRequest{
+			Limit:  reconcilePageSize,
+			Offset: offset,
+			Filters: map[string]string{
+				"range":      "date_created",
+				"begin_date": req.From.Format("2006-01-02T15:04:05.000Z07:00"),
+				"end_date":   req.To.Format("2006-01-02T15:04:05.000Z07:00"),
+				"sort":       "date_created",
+				"criteria":   "asc",
+			},
+		})
+		if err != nil {
+			log.Println(err)
+			return nil, errors.New("failed to search mercado pago payments")
+		}
+
+		for _, resource := range page.Results {
+			paymentStatus[strconv.Itoa(resource.ID)] = resource.Status
+			if resource.Status == "approved" {
+				approved = append(approved, resource)
+			}
+		}
+		result.PaymentsChecked += len(page.Results)
+
+		if len(page.Results) < reconcilePageSize || offset+reconcilePageSize >= page.Paging.Total {
+			break
+		}
+	}
+
+	if len(approved) > 0 {
+		paymentIDs := make([]string, 0, len(approved))
+		pixIDs := make([]int, 0, len(approved))
+		for _, resource := range approved {
+			paymentIDs = append(paymentIDs, strconv.Itoa(resource.ID))
+			pixIDs = append(pixIDs, resource.ID)
+		}
+
+		purchased, err := s.ProductRepo.GetPurchasedPaymentIDs(paymentIDs)
+		if err != nil {
+			return nil, errors.New("failed to get purchases: " + err.Error())
+		}
+		pending, err := s.ProductRepo.GetPendingPixPurchaseIDs(pixIDs)
+		if err != nil {
+			return nil, errors.New("failed to get pix purchases: " + err.Error())
+		}
+
+		for _, resource := range approved {
+			if purchased[strconv.Itoa(resource.ID)] {
+				continue
+			}
+
+			reason := "no local purchase for this payment"
+			if pending[resource.ID] {
+				reason = "pix purchase is still pending, the webhook never finalized it"
+			}
+
+			result.Orphaned = append(result.Orphaned, models.OrphanedPayment{
+				PaymentID:         strconv.Itoa(resource.ID),
+				AmountInt:         int(math.Round(resource.TransactionAmount * 100)),
+				PaymentMethod:     resource.PaymentMethodID,
+				PayerEmail:        resource.Payer.Email,
+				ExternalReference: resource.ExternalReference,
+				CreatedAt:         resource.DateCreated,
+				Reason:            reason,
+			})
+		}
+	}
+
+	purchases, err := s.ProductRepo.GetPaidPurchasesBetween(req.From, req.To)
+	if err != nil {
+		return nil, errors.New("failed to get purchases: " + err.Error())
+	}
+	result.PurchasesChecked = len(purchases)
+
+	orderClient := order.NewClient(config.GetMercadoPagoConfig())
+	for _, purchase := range purchases {
+		paymentID := *purchase.PaymentID
+		reason := ""
+
+		if status, ok := paymentStatus[paymentID]; ok {
+			if status != "approved" && status != "refunded" {
+				reason = "mercado pago payment is " + status
+			}
+		} else if id, err := strconv.Atoi(paymentID); err == nil {
+			// Paid slightly outside the window or missing, ask for it directly
+			resource, err := paymentClient.Get(ctx, id)
+			if err != nil {
+				reason = "payment not found at mercado pago"
+			} else if resource.Status != "approved" && resource.Status != "refunded" {
+				reason = "mercado pago payment is " + resource.Status
+			}
+		} else {
+			// Card purchases keep the ID of the Mercado Pago order they were paid with
+			resource, err := orderClient.Get(ctx, paymentID)
+			if err != nil {
+				reason = "order not found at mercado pago"
+			} else if resource.Status != "processed" && resource.Status != "refunded" {
+				reason = "mercado pago order is " + resource.Status
+			}
+		}
+
+		if reason == "" {
+			continue
+		}
+
+		result.Phantom = append(result.Phantom, models.PhantomPurchase{
+			PurchaseID:    purchase.ID,
+			UserID:        purchase.UserID,
+			ProductID:     purchase.ProductID,
+			PaymentID:     paymentID,
+			PaymentMethod: purchase.PaymentMethod,
+			PurchasedAt:   purchase.PurchasedAt,
+			Reason:        reason,
+		})
+	}
+
+	return result, nil
+}
+
+// ComputePrice is the single source of truth for what a user pays for a product,
+// both the purchase flows and the price preview go through it. Adjustments are worked out
+// per unit, in order: the UENF student discount, the coupon and the purchase tax over the
+// discounted price. Without modifiers the total is the base price
+func (s *ProductService) ComputePrice(user models.User, product *models.Product, quantity int, coupon string) (*models.PriceBreakdown, error) {
+	if quantity < 1 {
+		return nil, errors.New("quantity must be at least 1")
+	}
+
+	breakdown := &models.PriceBreakdown{
+		ProductID:    product.ID,
+		Quantity:     quantity,
+		UnitPriceInt: product.PriceInt,
+		SubtotalInt:  product.PriceInt * quantity,
+		Adjustments:  []models.PriceAdjustment{},
+	}
+
+	unitPrice := product.PriceInt
+	adjust := func(kind, description string, amount int) {
+		if amount == 0 {
+			return
+		}
+		unitPrice += amount
+		breakdown.Adjustments = append(breakdown.Adjustments, models.PriceAdjustment{
+			Kind:        kind,
+			Description: description,
+			AmountInt:   amount * quantity,
+		})
+	}
+
+	if user.IsUenf && product.UenfDiscountPercent > 0 {
+		description := fmt.Sprintf("UENF student discount (%d%%)", product.UenfDiscountPercent)
+		adjust("discount", description, -percentOf(unitPrice, product.UenfDiscountPercent))
+	}
+
+	if code := normalizeCouponCode(coupon); code != "" {
+		applied, err := s.usableCoupon(product, code)
+		if err != nil {
+			return nil, err
+		}
+
+		discount := applied.DiscountInt
+		if applied.DiscountPercent > 0 {
+			discount = percentOf(unitPrice, applied.DiscountPercent)
+		}
+		adjust("discount", "Coupon "+applied.Code, -min(discount, unitPrice))
+		breakdown.Coupon, breakdown.CouponID = applied.Code, applied.ID
+	}
+
+	if tax := config.GetPurchaseTaxPercent(); tax > 0 {
+		adjust("tax", fmt.Sprintf("Tax (%d%%)", tax), percentOf(unitPrice, tax))
+	}
+
+	breakdown.TotalInt = unitPrice * quantity
+	return breakdown, nil
+}
+
+// percentOf rounds percent% of a value in cents to the nearest cent
+func percentOf(value, percent int) int {
+	return (value*percent + 50) / 100
+}
+
+func normalizeCouponCode(code string) string {
+	return strings.ToUpper(strings.TrimSpace(code))
+}
+
+// usableCoupon returns the coupon with the code when it can still discount the product
+func (s *ProductService) usableCoupon(product *models.Product, code string) (*models.Coupon, error) {
+	coupon, err := s.ProductRepo.GetCouponByCode(product.EventID, code)
+	if err != nil {
+		return nil, errors.New("invalid coupon code")
+	}
+
+	if coupon.ProductID != nil && *coupon.ProductID != product.ID {
+		return nil, errors.New("coupon does not apply to this product")
+	}
+
+	if coupon.ExpiresAt != nil && coupon.ExpiresAt.Before(time.Now()) {
+		return nil, errors.New("coupon has expired")
+	}
+
+	if coupon.MaxUses > 0 && coupon.Uses >= coupon.MaxUses {
+		return nil, errors.New("coupon has reached its usage limit")
+	}
+
+	return coupon, nil
+}
+
+func (s *ProductService) GetProductPrice(user models.User, eventSlug string, productID string, quantity int, coupon string) (*models.PriceBreakdown, error) {
+	event, err := s.ProductRepo.GetEventBySlug(eventSlug)
+	if err != nil {
+		return nil, errors.New("event not found: " + err.Error())
+	}
+
+	product, err := s.ProductRepo.GetProductByID(productID)
+	if err != nil {
+		return nil, errors.New("product not found: " + err.Error())
+	}
+
+	if product.EventID != event.ID {
+		return nil, errors.New("product does not belong to this event")
+	}
+
+	return s.ComputePrice(user, product, quantity, coupon)
+}
+
+// checkProductAccessGrant keeps invite-only products to allowlisted users,
+// when gifting it's the recipient that must be allowlisted
+func (s *ProductService) checkProductAccessGrant(buyer models.User, product *models.Product, req models.PurchaseRequest) error {
+	if product.IsPublic {
+		return nil
+	}
+
+	ownerID := buyer.ID
+	if req.IsGift && req.GiftedToEmail != nil {
+		recipient, err := s.ProductRepo.GetUserByEmail(*req.GiftedToEmail)
+		if err != nil {
+			return errors.New("forbidden: this product is invite-only and the gift recipient was not invited")
+		}
+		ownerID = recipient.ID
+	}
+
+	granted, err := s.ProductRepo.HasProductAccessGrant(product.ID, ownerID)
+	if err != nil {
+		return lookupFailed("failed to check product access: ", err)
+	}
+	if !granted {
+		return errors.New("forbidden: this product is invite-only")
+	}
+
+	return nil
+}
+
+// checkTicketOwnership makes sure whoever receives a ticket ends up owning only one
+func (s *ProductService) checkTicketOwnership(buyer models.User, product *models.Product, req models.PurchaseRequest) error {
+	if req.Quantity > 1 {
+		return errors.New("a ticket can only be bought one at a time")
+	}
+
+	if req.IsGift && req.GiftedToEmail != nil {
+		recipient, err := s.ProductRepo.GetUserByEmail(*req.GiftedToEmail)
+		if err != nil {
+			return nil
+		}
+		owns, err := s.ownsProduct(recipient.ID, product.ID)
+		if err != nil {
+			return err
+		}
+		if owns {
+			return errors.New("gift recipient already owns this ticket")
+		}
+		return nil
+	}
+
+	owns, err := s.ownsProduct(buyer.ID, product.ID)
+	if err != nil {
+		return err
+	}
+	if owns {
+		return errors.New("you already own this ticket")
+	}
+
+	return nil
+}
+
+func (s *ProductService) ownsProduct(userID string, productID string) (bool, error) {
+	userProducts, err := s.ProductRepo.GetUserProductByUserIDAndProductID(userID, productID)
+	if err != nil {
+		return false, lookupFailed("failed to get user product: ", err)
+	}
+
+	for _, userProduct := range userProducts {
+		if userProduct.Quantity > 0 {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+// TransferUserProduct hands an owned product over to another user registered to its event, along with its
+// tokens and the products bundled with it. Products already enjoyed, through a used token or an attended
+// activity, can't change hands
+func (s *ProductService) TransferUserProduct(fromUser models.User, userProductID string, toEmail string) (*models.UserProduct, error) {
+	userProduct, err := s.ProductRepo.GetUserProductByID(userProductID)
+	if err != nil {
+		return nil, errors.New("owned product not found: " + err.Error())
+	}
+
+	if userProduct.UserID != fromUser.ID {
+		return nil, errors.New("unauthorized: you don't own this product")
+	}
+
+	purchase, err := s.ProductRepo.GetPurchaseByID(userProduct.PurchaseID)
+	if err != nil {
+		return nil, errors.New("purchase not found: " + err.Error())
+	}
+
+	if purchase.ProductID != userProduct.ProductID {
+		return nil, errors.New("product can't be transferred: it came in a bundle, transfer the bundle instead")
+	}
+
+	product, err := s.ProductRepo.GetProductByID(userProduct.ProductID)
+	if err != nil {
+		return nil, errors.New("product not found: " + err.Error())
+	}
+
+	recipient, err := s.ProductRepo.GetUserByEmail(toEmail)
+	if err != nil {
+		return nil, errors.New("recipient not found")
+	}
+
+	if recipient.ID == fromUser.ID {
+		return nil, errors.New("invalid operation: cannot transfer to yourself")
+	}
+
+	registered, err := s.ProductRepo.IsUserRegisteredToEvent(recipient.ID, product.EventID)
+	if err != nil {
+		return nil, errors.New("error checking recipient registration: " + err.Error())
+	}
+	if !registered {
+		return nil, errors.New("recipient is not registered to the event of the product")
+	}
+
+	if !product.IsPublic {
+		granted, err := s.ProductRepo.HasProductAccessGrant(product.ID, recipient.ID)
+		if err != nil {
+			return nil, errors.New("failed to check product access: " + err.Error())
+		}
+		if !granted {
+			return nil, errors.New("forbidden: this product is invite-only and the recipient was not invited")
+		}
+	}
+
+	if product.IsTicketType {
+		owns, err := s.ownsProduct(recipient.ID, product.ID)
+		if err != nil {
+			return nil, err
+		}
+		if owns {
+			return nil, errors.New("recipient already owns this ticket")
+		}
+	}
+
+	ownedUserProducts, err := s.ProductRepo.GetUserProductByUserIDAndProductID(recipient.ID, product.ID)
+	if err != nil {
+		return nil, errors.New("failed to get user product: " + err.Error())
+	}
+
+	var ownedQuantity int
+	for _, owned := range ownedUserProducts {
+		ownedQuantity += owned.Quantity
+	}
+	if ownedQuantity+userProduct.Quantity > product.MaxOwnableQuantity {
+		return nil, fmt.Errorf("recipient with %d of this product can't receive %d more, max ownable quantity is %d", ownedQuantity, userProduct.Quantity, product.MaxOwnableQuantity)
+	}
+
+	// The products bundled in the purchase go along with it
+	purchaseUserProducts, err := s.ProductRepo.GetUserProductsByPurchaseID(purchase.ID)
+	if err != nil {
+		return nil, errors.New("failed to get purchase products: " + err.Error())
+	}
+
+	var transferred []models.UserProduct
+	for _, owned := range purchaseUserProducts {
+		if owned.UserID != fromUser.ID {
+			continue
+		}
+
+		usedTokens, attended, err := s.ProductRepo.GetUserProductConsumption(&owned)
+		if err != nil {
+			return nil, errors.New("error checking product usage: " + err.Error())
+		}
+		if usedTokens > 0 {
+			return nil, fmt.Errorf("product can't be transferred: %d of its tokens were already used", usedTokens)
+		}
+		if attended > 0 {
+			return nil, errors.New("product can't be transferred: you already attended an activity it granted")
+		}
+
+		transferred = append(transferred, owned)
+	}
+
+	if err := s.ProductRepo.TransferUserProducts(transferred, fromUser.ID, recipient.ID); err != nil {
+		if strings.Contains(err.Error(), "already transferred") {
+			return nil, errors.New("product can't be transferred: " + err.Error())
+		}
+		return nil, errors.New("failed to transfer product: " + err.Error())
+	}
+
+	go func() {
+		if err := s.SendGiftReceivedEmail(fromUser, recipient, product, userProduct.Quantity); err != nil {
+			log.Printf("Failed to send gift received email to %s: %v", recipient.Email, err)
+		}
+	}()
+
+	return s.ProductRepo.GetUserProductByID(userProduct.ID)
+}
+
+// CanGift pre-validates a gift, a gift that would be rejected comes back with CanGift false
+// and the reason, errors are only returned when the checks themselves fail
+func (s *ProductService) CanGift(reqUser models.User, req models.CanGiftRequest) (*models.CanGiftResponse, error) {
+	product, err := s.ProductRepo.GetProductByID(req.ProductID)
+	if err != nil {
+		return nil, errors.New("product not found: " + err.Error())
+	}
+
+	if req.Quantity < 1 {
+		req.Quantity = 1
+	}
+
+	reason, err := s.giftRejection(reqUser, product, req.Email, req.Quantity)
+	if err != nil {
+		return nil, err
+	}
+	if reason != "" {
+		return &models.CanGiftResponse{CanGift: false, Reason: reason}, nil
+	}
+
+	return &models.CanGiftResponse{CanGift: true}, nil
+}
+
+// giftRejection tells why the gift of the product to the recipient would be rejected, or an empty reason
+// when it can go through: the recipient must have an account, be registered to the event of the product,
+// be invited to invite-only products and stay within what they can own. Purchases run it before charging,
+// so a gift never fails after it was paid
+func (s *ProductService) giftRejection(gifter models.User, product *models.Product, recipientEmail string, quantity int) (string, error) {
+	recipient, err := s.ProductRepo.GetUserByEmail(recipientEmail)
+	if err != nil {
+		return "recipient not found", nil
+	}
+
+	if recipient.ID == gifter.ID {
+		return "cannot gift yourself", nil
+	}
+
+	registered, err := s.ProductRepo.IsUserRegisteredToEvent(recipient.ID, product.EventID)
+	if err != nil {
+		return "", lookupFailed("could not check if the user is registered to the event of the product: ", err)
+	}
+	if !registered {
+		return "recipient is not registered to the event of the product", nil
+	}
+
+	if !product.IsPublic {
+		granted, err := s.ProductRepo.HasProductAccessGrant(product.ID, recipient.ID)
+		if err != nil {
+			return "", lookupFailed("failed to check product access: ", err)
+		}
+		if !granted {
+			return "this product is invite-only and the recipient was not invited", nil
+		}
+	}
+
+	if !product.HasUnlimitedQuantity && product.Quantity < quantity {
+		return fmt.Sprintf("not enough quantity available, want %v have %v", quantity, product.Quantity), nil
+	}
+
+	if product.IsTicketType {
+		if quantity > 1 {
+			return "a ticket can only be bought one at a time", nil
+		}
+		owns, err := s.ownsProduct(recipient.ID, product.ID)
+		if err != nil {
+			return "", err
+		}
+		if owns {
+			return "gift recipient already owns this ticket", nil
+		}
+	}
+
+	ownedUserProducts, err := s.ProductRepo.GetUserProductByUserIDAndProductID(recipient.ID, product.ID)
+	if err != nil {
+		return "", lookupFailed("failed to get user product: ", err)
+	}
+
+	var ownedQuantity int
+	for _, userProduct := range ownedUserProducts {
+		ownedQuantity += userProduct.Quantity
+	}
+
+	if ownedQuantity+quantity > product.MaxOwnableQuantity {
+		return fmt.Sprintf("recipient would own %d of this product, max ownable quantity is %d", ownedQuantity+quantity, product.MaxOwnableQuantity), nil
+	}
+
+	return "", nil
+}
+
+func (s *ProductService) GetOrphanedAccessTargets(admin models.User, eventSlug string) ([]models.OrphanedAccessTarget, error) {
+	event, err := s.ProductRepo.GetEventBySlug(eventSlug)
+	if err != nil {
+		return nil, errors.New("event not found: " + err.Error())
+	}
+
+	if !admin.IsSuperUser && event.CreatedBy != admin.ID {
+		adminStatus, err := s.ProductRepo.GetAdminStatusForEvent(admin.ID, event.ID)
+		if err != nil || (adminStatus.AdminType != models.AdminTypeMaster && adminStatus.AdminType != models.AdminTypeNormal) {
+			return nil, errors.New("unauthorized: only admins can see orphaned access targets")
+		}
+	}
+
+	orphans, err := s.ProductRepo.GetOrphanedAccessTargets(event.ID)
+	if err != nil {
+		return nil, errors.New("failed to get orphaned access targets: " + err.Error())
+	}
+
+	return orphans, nil
+}
+
+// SetEventProductsBlocked is the emergency switch that stops (or resumes) the sales of every product
+// of the event at once, the reason is kept in the audit log (master admins only)
+func (s *ProductService) SetEventProductsBlocked(admin models.User, eventSlug string, blocked bool, reason string) (*models.BulkBlockProductsResult, error) {
+	reason = strings.TrimSpace(reason)
+	if reason == "" {
+		return nil, errors.New("a reason is required")
+	}
+	if len(reason) > 500 {
+		return nil, errors.New("reason can't be longer than 500 characters")
+	}
+
+	event, err := s.ProductRepo.GetEventBySlug(eventSlug)
+	if err != nil {
+		return nil, errors.New("event not found: " + err.Error())
+	}
+
+	if !admin.IsSuperUser && event.CreatedBy != admin.ID {
+		adminStatus, err := s.ProductRepo.GetAdminStatusForEvent(admin.ID, event.ID)
+		if err != nil || adminStatus.AdminType != models.AdminTypeMaster {
+			return nil, errors.New("unauthorized: only master admins can block all products")
+		}
+	}
+
+	action := models.AuditProductsUnblocked
+	if blocked {
+		action = models.AuditProductsBlocked
+	}
+	audit := &models.AuditLog{
+		ID:      uuid.New().String(),
+		EventID: &event.ID,
+		ActorID: admin.ID,
+		Action:  action,
+		Reason:  reason,
+	}
+
+	affected, err := s.ProductRepo.SetEventProductsBlocked(event.ID, blocked, audit)
+	if err != nil {
+		return nil, errors.New("failed to update products: " + err.Error())
+	}
+
+	return &models.BulkBlockProductsResult{Blocked: blocked, Affected: affected}, nil
+}
+
+// GetProductAutoRegistrations previews the activities a buyer of the product would be registered to
+func (s *ProductService) GetProductAutoRegistrations(admin models.User, eventSlug string, productID string) ([]models.ProductAutoRegistration, error) {
+	event, err := s.ProductRepo.GetEventBySlug(eventSlug)
+	if err != nil {
+		return nil, errors.New("event not found: " + err.Error())
+	}
+
+	if !admin.IsSuperUser && event.CreatedBy != admin.ID {
+		adminStatus, err := s.ProductRepo.GetAdminStatusForEvent(admin.ID, event.ID)
+		if err != nil || (adminStatus.AdminType != models.AdminTypeMaster && adminStatus.AdminType != models.AdminTypeNormal) {
+			return nil, errors.New("unauthorized: only admins can preview product registrations")
+		}
+	}
+
+	product, err := s.ProductRepo.GetProductByID(productID)
+	if err != nil {
+		return nil, errors.New("product not found: " + err.Error())
+	}
+
+	if product.EventID != event.ID {
+		return nil, errors.New("product not found in this event")
+	}
+
+	autoRegistrations, err := s.ProductRepo.GetProductAutoRegistrations(product)
+	if err != nil {
+		return nil, errors.New("failed to get product registrations: " + err.Error())
+	}
+
+	if autoRegistrations == nil {
+		return []models.ProductAutoRegistration{}, nil
+	}
+	return autoRegistrations, nil
+}
+
+func (s *ProductService) GetExpiringProducts(admin models.User, eventSlug string, within time.Duration) ([]models.Product, error) {
+	if within <= 0 {
+		return nil, errors.New("within must be a positive duration")
+	}
+
+	event, err := s.ProductRepo.GetEventBySlug(eventSlug)
+	if err != nil {
+		return nil, errors.New("event not found: " + err.Error())
+	}
+
+	if !admin.IsSuperUser && event.CreatedBy != admin.ID {
+		adminStatus, err := s.ProductRepo.GetAdminStatusForEvent(admin.ID, event.ID)
+		if err != nil || (adminStatus.AdminType != models.AdminTypeMaster && adminStatus.AdminType != models.AdminTypeNormal) {
+			return nil, errors.New("unauthorized: only admins can see expiring products")
+		}
+	}
+
+	now := time.Now()
+	products, err := s.ProductRepo.GetExpiringProducts(event.ID, now, now.Add(within))
+	if err != nil {
+		return nil, errors.New("failed to get expiring products: " + err.Error())
+	}
+
+	return products, nil
+}
+
+// ExtendProductsExpiry moves the expiry of all the event products at once, like on
+// product creation no product may expire after the event ends, so those are capped
+func (s *ProductService) ExtendProductsExpiry(admin models.User, eventSlug string, req models.ExtendProductExpiryRequest) (*models.ExtendProductExpiryResult, error) {
+	if (req.ExpiresAt == nil) == (req.Delta == "") {
+		return nil, errors.New("either expires_at or delta must be given")
+	}
+
+	var delta time.Duration
+	if req.Delta != "" {
+		var err error
+		delta, err = time.ParseDuration(req.Delta)
+		if err != nil {
+			return nil, errors.New("delta must be a duration like 72h")
+		}
+		if delta <= 0 {
+			return nil, errors.New("delta must be positive")
+		}
+	}
+
+	event, err := s.ProductRepo.GetEventBySlug(eventSlug)
+	if err != nil {
+		return nil, errors.New("event not found: " + err.Error())
+	}
+
+	if !admin.IsSuperUser && event.CreatedBy != admin.ID {
+		adminStatus, err := s.ProductRepo.GetAdminStatusForEvent(admin.ID, event.ID)
+		if err != nil || adminStatus.AdminType != models.AdminTypeMaster {
+			return nil, errors.New("unauthorized: only master admins can extend product expiries")
+		}
+	}
+
+	if req.ExpiresAt != nil {
+		if req.ExpiresAt.After(event.EndDate) {
+			return nil, errors.New("product needs to expire before the event end date")
+		}
+		if req.ExpiresAt.Before(time.Now()) {
+			return nil, errors.New("expires_at must be in the future")
+		}
+	}
+
+	products, err := s.ProductRepo.GetProductsByEventID(event.ID)
+	if err != nil {
+		return nil, errors.New("failed to get event products: " + err.Error())
+	}
+
+	result := &models.ExtendProductExpiryResult{}
+	expiries := make(map[string]time.Time)
+	for _, product := range products {
+		expiresAt := product.ExpiresAt.Add(delta)
+		if req.ExpiresAt != nil {
+			expiresAt = *req.ExpiresAt
+		}
+		if expiresAt.After(event.EndDate) {
+			expiresAt = event.EndDate
+			result.Capped++
+		}
+		if expiresAt.Equal(product.ExpiresAt) {
+			continue
+		}
+		expiries[product.ID] = expiresAt
+	}
+
+	if err := s.ProductRepo.UpdateProductExpiries(expiries); err != nil {
+		return nil, errors.New("failed to update product expiries: " + err.Error())
+	}
+
+	result.Updated = len(expiries)
+	return result, nil
+}
+
+func (s *ProductService) CleanupOrphanedAccessTargets(admin models.User, eventSlug string) (int64, error) {
+	event, err := s.ProductRepo.GetEventBySlug(eventSlug)
+	if err != nil {
+		return 0, errors.New("event not found: " + err.Error())
+	}
+
+	if !admin.IsSuperUser && event.CreatedBy != admin.ID {
+		adminStatus, err := s.ProductRepo.GetAdminStatusForEvent(admin.ID, event.ID)
+		if err != nil || adminStatus.AdminType != models.AdminTypeMaster {
+			return 0, errors.New("unauthorized: only master admins can clean up access targets")
+		}
+	}
+
+	removed, err := s.ProductRepo.DeleteOrphanedAccessTargets(event.ID)
+	if err != nil {
+		return 0, errors.New("failed to remove orphaned access targets: " + err.Error())
+	}
+
+	return removed, nil
+}
+
+func (s *ProductService) MarkDeliveredBatch(admin models.User, eventSlug string, req models.DeliveryBatchRequest) ([]models.DeliveryResult, error) {
+	event, err := s.ProductRepo.GetEventBySlug(eventSlug)
+	if err != nil {
+		return nil, errors.New("event not found: " + err.Error())
+	}
+
+	if !admin.IsSuperUser && event.CreatedBy != admin.ID {
+		adminStatus, err := s.ProductRepo.GetAdminStatusForEvent(admin.ID, event.ID)
+		if err != nil || (adminStatus.AdminType != models.AdminTypeMaster && adminStatus.AdminType != models.AdminTypeNormal) {
+			return nil, errors.New("unauthorized: only admins can mark deliveries")
+		}
+	}
+
+	var results []models.DeliveryResult
+	for _, purchaseID := range req.PurchaseIDs {
+		results = append(results, models.DeliveryResult{PurchaseID: purchaseID})
+	}
+
+	if len(req.UserIDs) > 0 {
+		if req.ProductID == "" {
+			return nil, errors.New("product ID is required when delivering by user IDs")
+		}
+
+		userProducts, err := s.ProductRepo.GetUserProductsFromUsers(req.ProductID, req.UserIDs)
+		if err != nil {
+			return nil, errors.New("failed to get user products: " + err.Error())
+		}
+
+		owned := make(map[string][]string)
+		for _, userProduct := range userProducts {
+			owned[userProduct.UserID] = append(owned[userProduct.UserID], userProduct.PurchaseID)
+		}
+
+		// Results stay keyed on the requested user, since a gifted item points
+		// to the purchase made by whoever gifted it
+		for _, userID := range req.UserIDs {
+			purchaseIDs, ok := owned[userID]
+			if !ok {
+				results = append(results, models.DeliveryResult{
+					UserID:  userID,
+					Message: "user does not own this product",
+				})
+				continue
+			}
+			for _, purchaseID := range purchaseIDs {
+				results = append(results, models.DeliveryResult{PurchaseID: purchaseID, UserID: userID})
+			}
+		}
+	}
+
+	if err := s.ProductRepo.DeliverPurchases(event.ID, results); err != nil {
+		for i := range results {
+			if results[i].Success || results[i].Message == "" {
+				results[i].Success = false
+				results[i].Message = "failed to mark delivery: " + err.Error()
+			}
+		}
+	}
+
+	return results, nil
+}
+
+// MarkDelivered marks a single physical item purchase as delivered. Marking an already delivered purchase
+// changes nothing and comes back unsuccessful with a message saying so
+func (s *ProductService) MarkDelivered(admin models.User, eventSlug string, purchaseID string) (*models.DeliveryResult, error) {
+	results, err := s.MarkDeliveredBatch(admin, eventSlug, models.DeliveryBatchRequest{PurchaseIDs: []string{purchaseID}})
+	if err != nil {
+		return nil, err
+	}
+
+	result := results[0]
+	switch result.Message {
+	case "purchase not found", "product not found", "purchase does not belong to this event":
+		return nil, errors.New(result.Message)
+	case "product is not a physical item":
+		return nil, errors.New("invalid delivery: " + result.Message)
+	}
+	if !result.Success && strings.HasPrefix(result.Message, "failed to") {
+		return nil, errors.New(result.Message)
+	}
+
+	return &result, nil
+}
+
+// GetPendingDeliveries lists the physical items of the event still waiting for pickup (admins only)
+func (s *ProductService) GetPendingDeliveries(admin models.User, eventSlug string) ([]models.PendingDelivery, error) {
+	event, err := s.ProductRepo.GetEventBySlug(eventSlug)
+	if err != nil {
+		return nil, errors.New("event not found: " + err.Error())
+	}
+
+	if !admin.IsSuperUser && event.CreatedBy != admin.ID {
+		adminStatus, err := s.ProductRepo.GetAdminStatusForEvent(admin.ID, event.ID)
+		if err != nil || (adminStatus.AdminType != models.AdminTypeMaster && adminStatus.AdminType != models.AdminTypeNormal) {
+			return nil, errors.New("unauthorized: only admins can list pending deliveries")
+		}
+	}
+
+	pending, err := s.ProductRepo.GetPendingDeliveries(event.ID)
+	if err != nil {
+		return nil, errors.New("failed to get pending deliveries: " + err.Error())
+	}
+	if pending == nil {
+		pending = []models.PendingDelivery{}
+	}
+
+	return pending, nil
+}
+
+// NotifyGiftRecipient sends the gift email and only logs failures, the gift itself already went through
+func (s *ProductService) NotifyGiftRecipient(gifter models.User, recipientEmail string, product *models.Product, quantity int) {
+	if err := s.SendGiftNotificationEmail(gifter, recipientEmail, product, quantity); err != nil {
+		log.Printf("Failed to send gift notification email to %s: %v", recipientEmail, err)
+	}
+}
+
+// ResendGiftNotification sends the gift email of one of the user's gift purchases again
+func (s *ProductService) ResendGiftNotification(user models.User, purchaseID string) error {
+	purchase, err := s.ProductRepo.GetPurchaseByID(purchaseID)
+	if err != nil {
+		return errors.New("purchase not found: " + err.Error())
+	}
+
+	if purchase.UserID != user.ID {
+		return errors.New("unauthorized: only the gifter can resend the notification")
+	}
+
+	if !purchase.IsGift || purchase.GiftedToEmail == nil {
+		return errors.New("purchase is not a gift")
+	}
+
+	product, err := s.ProductRepo.GetProductByID(purchase.ProductID)
+	if err != nil {
+		return errors.New("product not found: " + err.Error())
+	}
+
+	if err := s.SendGiftNotificationEmail(user, *purchase.GiftedToEmail, product, purchase.Quantity); err != nil {
+		return errors.New("failed to send gift notification: " + err.Error())
+	}
+
+	return nil
+}
+
+func (s *ProductService) SendGiftNotificationEmail(gifter models.User, recipientEmail string, product *models.Product, quantity int) error {
+	if os.Getenv("TEST_MODE") == "true" {
+		return nil
+	}
+
+	event, err := s.ProductRepo.GetEventByID(product.EventID)
+	if err != nil {
+		return fmt.Errorf("failed to get event: %v", err)
+	}
+
+	// Recipients without an account get instructions to sign up with this email
+	recipient, err := s.ProductRepo.GetUserByEmail(recipientEmail)
+	hasAccount := err == nil
+
+	from := config.GetSystemEmail()
+	password := config.GetSystemEmailPass()
+
+	templatePath := filepath.Join("templates", "gift_received.html")
+	file, err := os.Open(templatePath)
+	if err != nil {
+		return fmt.Errorf("failed to open email template: %v", err)
+	}
+	defer file.Close()
+
+	content, err := io.ReadAll(file)
+	if err != nil {
+		return fmt.Errorf("failed to read email template: %v", err)
+	}
+
+	tmpl, err := template.New("emailTemplate").Parse(string(content))
+	if err != nil {
+		return fmt.Errorf("failed to parse template: %v", err)
+	}
+
+	data := struct {
+		Gifter      models.User
+		Recipient   models.User
+		HasAccount  bool
+		Event       models.Event
+		Product     models.Product
+		Quantity    int
+		SiteURL     string
+		RegisterURL string
+	}{
+		Gifter:      gifter,
+		Recipient:   recipient,
+		HasAccount:  hasAccount,
+		Event:       *event,
+		Product:     *product,
+		Quantity:    quantity,
+		SiteURL:     config.GetSiteURL(),
+		RegisterURL: config.GetSiteURL() + "/register",
+	}
+
+	var body strings.Builder
+	if err := tmpl.Execute(&body, data); err != nil {
+		return fmt.Errorf("failed to execute template: %v", err)
+	}
+
+	m := mail.NewMessage()
+	m.SetHeader("From", from)
+	m.SetHeader("To", recipientEmail)
+	m.SetHeader("Subject", "Você recebeu um presente em "+event.Name)
+	m.SetBody("text/html", body.String())
+
+	d := mail.NewDialer("smtp.gmail.com", 587, from, password)
+	d.StartTLSPolicy = mail.MandatoryStartTLS
+
+	if err := d.DialAndSend(m); err != nil {
+		return fmt.Errorf("failed to send email: %v", err)
+	}
+
+	return nil
+}
+
+// SendGiftReceivedEmail tells the recipient of a transferred product who sent it, recipients of transfers always have an account
+func (s *ProductService) SendGiftReceivedEmail(sender, recipient models.User, product *models.Product, quantity int) error {
+	if os.Getenv("TEST_MODE") == "true" {
+		return nil
+	}
+
+	event, err := s.ProductRepo.GetEventByID(product.EventID)
+	if err != nil {
+		return fmt.Errorf("failed to get event: %v", err)
+	}
+
+	from := config.GetSystemEmail()
+	password := config.GetSystemEmailPass()
+
+	templatePath := filepath.Join("templates", "gift_received_email.html")
+	file, err := os.Open(templatePath)
+	if err != nil {
+		return fmt.Errorf("failed to open email template: %v", err)
+	}
+	defer file.Close()
+
+	content, err := io.ReadAll(file)
+	if err != nil {
+		return fmt.Errorf("failed to read email template: %v", err)
+	}
+
+	tmpl, err := template.New("emailTemplate").Parse(string(content))
+	if err != nil {
+		return fmt.Errorf("failed to parse template: %v", err)
+	}
+
+	data := struct {
+		Sender    models.User
+		Recipient models.User
+		Event     models.Event
+		Product   models.Product
+		Quantity  int
+		SiteURL   string
+	}{
+		Sender:    sender,
+		Recipient: recipient,
+		Event:     *event,
+		Product:   *product,
+		Quantity:  quantity,
+		SiteURL:   config.GetSiteURL(),
+	}
+
+	var body strings.Builder
+	if err := tmpl.Execute(&body, data); err != nil {
+		return fmt.Errorf("failed to execute template: %v", err)
+	}
+
+	m := mail.NewMessage()
+	m.SetHeader("From", from)
+	m.SetHeader("To", recipient.Email)
+	m.SetHeader("Subject", "Você recebeu um produto em "+event.Name)
+	m.SetBody("text/html", body.String())
+
+	d := mail.NewDialer("smtp.gmail.com", 587, from, password)
+	d.StartTLSPolicy = mail.MandatoryStartTLS
+
+	if err := d.DialAndSend(m); err != nil {
+		return fmt.Errorf("failed to send email: %v", err)
+	}
+
+	return nil
+}
+
+// ExportEventPurchases streams the event purchases to fn (master admins only). Purchases made before the
+// payment method was recorded are reported as free or unknown depending on whether they were paid
+func (s *ProductService) ExportEventPurchases(admin models.User, eventSlug string, fn func(models.PurchaseExportRow) error) error {
+	event, err := s.ProductRepo.GetEventBySlug(eventSlug)
+	if err != nil {
+		return errors.New("event not found: " + err.Error())
+	}
+
+	if !admin.IsSuperUser && event.CreatedBy != admin.ID {
+		adminStatus, err := s.ProductRepo.GetAdminStatusForEvent(admin.ID, event.ID)
+		if err != nil || adminStatus.AdminType != models.AdminTypeMaster {
+			return errors.New("unauthorized: only master admins can export purchases")
+		}
+	}
+
+	return s.ProductRepo.StreamEventPurchaseExport(event.ID, func(row models.PurchaseExportRow) error {
+		if row.PaymentMethod == "" {
+			row.PaymentMethod = "unknown"
+			if row.PaymentID == nil {
+				row.PaymentMethod = "free"
+			}
+		}
+		return fn(row)
+	})
+}
+
+// RefundPurchase gives back some or all units of a purchase, the Mercado Pago refund is
+// proportional to the refunded units and only what those units granted is taken back
+func (s *ProductService) RefundPurchase(admin models.User, eventSlug string, purchaseID string, quantity int) (*models.PurchaseRefund, error) {
+	event, err := s.ProductRepo.GetEventBySlug(eventSlug)
+	if err != nil {
+		return nil, errors.New("event not found: " + err.Error())
+	}
+
+	if !admin.IsSuperUser && event.CreatedBy != admin.ID {
+		adminStatus, err := s.ProductRepo.GetAdminStatusForEvent(admin.ID, event.ID)
+		if err != nil || adminStatus.AdminType != models.AdminTypeMaster {
+			return nil, errors.New("unauthorized: only master admins can refund purchases")
+		}
+	}
+
+	purchase, err := s.ProductRepo.GetPurchaseByID(purchaseID)
+	if err != nil {
+		return nil, errors.New("purchase not found: " + err.Error())
+	}
+
+	product, err := s.ProductRepo.GetProductByID(purchase.ProductID)
+	if err != nil {
+		return nil, errors.New("product not found: " + err.Error())
+	}
+
+	if product.EventID != event.ID {
+		return nil, errors.New("purchase does not belong to this event")
+	}
+
+	if purchase.RefundedAt != nil {
+		return nil, errors.New("purchase was already refunded")
+	}
+
+	userProducts, err := s.ProductRepo.GetUserProductsByPurchaseID(purchase.ID)
+	if err != nil {
+		return nil, errors.New("owned product not found: " + err.Error())
+	}
+
+	var userProduct *models.UserProduct
+	for i := range userProducts {
+		if userProducts[i].ProductID == purchase.ProductID {
+			userProduct = &userProducts[i]
+		}
+	}
+	if userProduct == nil {
+		return nil, errors.New("owned product not found: purchase " + purchase.ID + " was already taken back")
+	}
+
+	// What was already enjoyed can't be given back, the products bundled in the purchase included
+	for i := range userProducts {
+		usedTokens, attended, err := s.ProductRepo.GetUserProductConsumption(&userProducts[i])
+		if err != nil {
+			return nil, errors.New("error checking purchase usage: " + err.Error())
+		}
+		if usedTokens > 0 {
+			return nil, fmt.Errorf("purchase can't be refunded: %d of its tokens were already used", usedTokens)
+		}
+		if attended > 0 {
+			return nil, errors.New("purchase can't be refunded: the owner already attended an activity it granted")
+		}
+	}
+
+	remaining := purchase.Quantity - purchase.RefundedQuantity
+	if quantity == 0 {
+		quantity = remaining
+	}
+	if quantity < 1 {
+		return nil, errors.New("quantity must be at least 1")
+	}
+	if quantity > remaining || quantity > userProduct.Quantity {
+		return nil, fmt.Errorf("can't refund %d units, only %d are still owned", quantity, min(remaining, userProduct.Quantity))
+	}
+
+	record := &models.PurchaseRefund{
+		ID:         uuid.New().String(),
+		PurchaseID: purchase.ID,
+		RefundedBy: admin.ID,
+		Quantity:   quantity,
+		AmountInt:  purchase.UnitPriceInt * quantity,
+		IsPartial:  quantity < remaining || purchase.RefundedQuantity > 0,
+	}
+
+	if record.AmountInt > 0 && purchase.PaymentID == nil {
+		return nil, errors.New("purchase has no payment ID, refund it manually")
+	}
+
+	// Reserved before the payment is refunded, a concurrent refund of the same units fails here instead of paying twice
+	if err := s.ProductRepo.ReserveRefundUnits(purchase.ID, quantity); err != nil {
+		return nil, err
+	}
+
+	if record.AmountInt > 0 {
+		// Cart purchases share their payment, refunding all of it would give back the other items too
+		shared, err := s.ProductRepo.IsPaymentShared(*purchase.PaymentID, purchase.ID)
+		if err != nil {
+			s.releaseRefundUnits(purchase.ID, quantity)
+			return nil, errors.New("error checking purchase payment: " + err.Error())
+		}
+
+		if record.IsPartial || shared {
+			err = s.ProductRepo.RefundPaymentAmount(*purchase.PaymentID, record.AmountInt)
+		} else {
+			err = s.ProductRepo.RefundPayment(*purchase.PaymentID)
+		}
+		if err != nil {
+			s.releaseRefundUnits(purchase.ID, quantity)
+			return nil, errors.New("failed to refund payment: " + err.Error())
+		}
+	}
+
+	if err := s.ProductRepo.RefundPurchaseUnits(purchase, product, userProduct, record); err != nil {
+		log.Printf("CRITICAL: %d units of purchase %s were refunded but not taken back: %v", quantity, purchase.ID, err)
+		return nil, errors.New("payment was refunded but the purchase could not be updated: " + err.Error())
+	}
+
+	return record, nil
+}
+
+func (s *ProductService) releaseRefundUnits(purchaseID string, quantity int) {
+	if err := s.ProductRepo.ReleaseRefundUnits(purchaseID, quantity); err != nil {
+		log.Printf("Failed to release %d refund units of purchase %s: %v", quantity, purchaseID, err)
+	}
+}
+
+// CancelAndRefundEvent blocks the event and refunds every purchase of its products in the background.
+// Calling it again resumes the previous run: purchases already refunded or reversed are skipped
+func (s *ProductService) CancelAndRefundEvent(admin models.User, eventSlug string) (*models.EventCancellation, error) {
+	if !admin.IsSuperUser {
+		return nil, errors.New("unauthorized: only super users can cancel an event")
+	}
+
+	event, err := s.ProductRepo.GetEventBySlug(eventSlug)
+	if err != nil {
+		return nil, errors.New("event not found: " + err.Error())
+	}
+
+	if err := s.ProductRepo.BlockEvent(event.ID); err != nil {
+		return nil, errors.New("failed to block event: " + err.Error())
+	}
+
+	cancellation, err := s.ProductRepo.StartEventCancellation(event.ID, admin.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	go s.runEventCancellation(cancellation, event)
+
+	return cancellation, nil
+}
+
+func (s *ProductService) runEventCancellation(cancellation *models.EventCancellation, event *models.Event) {
+	finish := func(status models.CancellationStatus) {
+		now := time.Now()
+		cancellation.Status = status
+		cancellation.FinishedAt = &now
+		if err := s.ProductRepo.UpdateEventCancellation(cancellation); err != nil {
+			log.Printf("Failed to save cancellation report of event %s: %v", event.ID, err)
+		}
+	}
+
+	purchases, err := s.ProductRepo.GetEventPurchases(event.ID)
+	if err != nil {
+		log.Printf("Failed to get purchases of cancelled event %s: %v", event.ID, err)
+		finish(models.CancellationFailed)
+		return
+	}
+
+	previous, err := s.ProductRepo.GetEventCancellation(event.ID)
+	if err != nil {
+		log.Printf("Failed to get previous cancellation report of event %s: %v", event.ID, err)
+		finish(models.CancellationFailed)
+		return
+	}
+
+	done := make(map[string]models.CancellationEntryStatus, len(previous.Entries))
+	for _, entry := range previous.Entries {
+		if entry.Status != models.CancellationEntryFailed {
+			done[entry.PurchaseID] = entry.Status
+		}
+	}
+
+	// Buyers to notify in this run, true when money was given back
+	notify := make(map[string]bool)
+	// Cart purchases share a payment, it is refunded whole once for all of them
+	refundedPayments := make(map[string]bool)
+	for _, purchase := range purchases {
+		if _, ok := done[purchase.ID]; ok {
+			continue
+		}
+
+		entry := models.CancellationEntry{
+			CancellationID: cancellation.ID,
+			PurchaseID:     purchase.ID,
+			UserID:         purchase.UserID,
+		}
+
+		switch {
+		case purchase.RefundedAt != nil:
+			entry.Status = models.CancellationEntryRefunded
+		case purchase.PaymentID == nil && purchase.UnitPriceInt == 0:
+			entry.Status = models.CancellationEntryFree
+		case purchase.PaymentID == nil:
+			entry.Status = models.CancellationEntryManualRequired
+			entry.Error = "purchase has no payment ID, refund it manually"
+		default:
+			if !refundedPayments[*purchase.PaymentID] {
+				if err := s.ProductRepo.RefundPayment(*purchase.PaymentID); err != nil {
+					// Access is kept until the money is back, a new run retries it
+					entry.Status = models.CancellationEntryFailed
+					entry.Error = "refund failed: " + err.Error()
+					break
+				}
+				refundedPayments[*purchase.PaymentID] = true
+			}
+			if err := s.ProductRepo.MarkPurchaseRefunded(purchase.ID); err != nil {
+				log.Printf("CRITICAL: payment %s was refunded but purchase %s was not marked: %v", *purchase.PaymentID, purchase.ID, err)
+			}
+			entry.Status = models.CancellationEntryRefunded
+		}
+
+		if entry.Status != models.CancellationEntryFailed {
+			if err := s.ProductRepo.ReverseEventPurchase(purchase.ID, event.ID); err != nil {
+				entry.Error = "access not reversed: " + err.Error()
+				entry.Status = models.CancellationEntryFailed
+			} else if entry.Status != models.CancellationEntryManualRequired {
+				notify[purchase.UserID] = notify[purchase.UserID] || entry.Status == models.CancellationEntryRefunded
+			}
+		}
+
+		if err := s.ProductRepo.SaveCancellationEntry(&entry); err != nil {
+			log.Printf("Failed to save cancellation entry of purchase %s: %v", purchase.ID, err)
+		}
+		done[purchase.ID] = entry.Status
+	}
+
+	cancellation.Refunded, cancellation.Manual, cancellation.Failed = 0, 0, 0
+	for _, status := range done {
+		switch status {
+		case models.CancellationEntryRefunded, models.CancellationEntryFree:
+			cancellation.Refunded++
+		case models.CancellationEntryManualRequired:
+			cancellation.Manual++
+		case models.CancellationEntryFailed:
+			cancellation.Failed++
+		}
+	}
+
+	if cancellation.Failed > 0 || cancellation.Manual > 0 {
+		finish(models.CancellationFailed)
+	} else {
+		finish(models.CancellationCompleted)
+	}
+
+	for userID, refunded := range notify {
+		user, err := s.ProductRepo.GetUserByID(userID)
+		if err != nil {
+			log.Printf("Failed to get user %s to notify about cancelled event %s: %v", userID, event.ID, err)
+			continue
+		}
+		if err := s.SendEventCancelledEmail(user, event, refunded); err != nil {
+			log.Printf("Failed to send event cancelled email to %s: %v", user.Email, err)
+		}
+	}
+}
+
+func (s *ProductService) GetEventCancellation(admin models.User, eventSlug string) (*models.EventCancellation, error) {
+	if !admin.IsSuperUser {
+		return nil, errors.New("unauthorized: only super users can see the cancellation report")
+	}
+
+	event, err := s.ProductRepo.GetEventBySlug(eventSlug)
+	if err != nil {
+		return nil, errors.New("event not found: " + err.Error())
+	}
+
+	cancellation, err := s.ProductRepo.GetEventCancellation(event.ID)
+	if err != nil {
+		return nil, errors.New("cancellation report not found: " + err.Error())
+	}
+
+	return cancellation, nil
+}
+
+func (s *ProductService) SendEventCancelledEmail(user models.User, event *models.Event, refunded bool) error {
+	if os.Getenv("TEST_MODE") == "true" {
+		return nil
+	}
+
+	from := config.GetSystemEmail()
+	password := config.GetSystemEmailPass()
+
+	templatePath := filepath.Join("templates", "event_cancelled_email.html")
+	file, err := os.Open(templatePath)
+	if err != nil {
+		return fmt.Errorf("failed to open email template: %v", err)
+	}
+	defer file.Close()
+
+	content, err := io.ReadAll(file)
+	if err != nil {
+		return fmt.Errorf("failed to read email template: %v", err)
+	}
+
+	tmpl, err := template.New("emailTemplate").Parse(string(content))
+	if err != nil {
+		return fmt.Errorf("failed to parse template: %v", err)
+	}
+
+	data := struct {
+		User     models.User
+		Event    models.Event
+		Refunded bool
+	}{
+		User:     user,
+		Event:    *event,
+		Refunded: refunded,
+	}
+
+	var body strings.Builder
+	if err := tmpl.Execute(&body, data); err != nil {
+		return fmt.Errorf("failed to execute template: %v", err)
+	}
+
+	m := mail.NewMessage()
+	m.SetHeader("From", from)
+	m.SetHeader("To", user.Email)
+	m.SetHeader("Subject", "Evento cancelado: "+event.Name)
+	m.SetBody("text/html", body.String())
+
+	d := mail.NewDialer("smtp.gmail.com", 587, from, password)
+	d.StartTLSPolicy = mail.MandatoryStartTLS
+
+	if err := d.DialAndSend(m); err != nil {
+		return fmt.Errorf("failed to send email: %v", err)
+	}
+
+	return nil
+}
+
+// getManagedEventProduct returns the product when the user can manage the products of the event
+func (s *ProductService) getManagedEventProduct(admin models.User, eventSlug string, productID string) (*models.Product, error) {
+	event, err := s.ProductRepo.GetEventBySlug(eventSlug)
+	if err != nil {
+		return nil, errors.New("event not found: " + err.Error())
+	}
+
+	if !admin.IsSuperUser && event.CreatedBy != admin.ID {
+		adminStatus, err := s.ProductRepo.GetAdminStatusForEvent(admin.ID, event.ID)
+		if err != nil || adminStatus.AdminType != models.AdminTypeMaster {
+			return nil, errors.New("unauthorized: only master admins can manage product access")
+		}
+	}
+
+	product, err := s.ProductRepo.GetProductByID(productID)
+	if err != nil {
+		return nil, errors.New("product not found: " + err.Error())
+	}
+
+	if product.EventID != event.ID {
+		return nil, errors.New("product does not belong to this event")
+	}
+
+	return product, nil
+}
+
+func (s *ProductService) GrantProductAccess(admin models.User, eventSlug string, productID string, req models.ProductAccessGrantRequest) ([]models.ProductAccessGrantResult, error) {
+	product, err := s.getManagedEventProduct(admin, eventSlug, productID)
+	if err != nil {
+		return nil, err
+	}
+
+	results := make([]models.ProductAccessGrantResult, len(req.Emails))
+	var grants []models.ProductAccessGrant
+	for i, email := range req.Emails {
+		email = strings.TrimSpace(strings.ToLower(email))
+		results[i].Email = email
+
+		user, err := s.ProductRepo.GetUserByEmail(email)
+		if err != nil {
+			results[i].Message = "user not found"
+			continue
+		}
+
+		grants = append(grants, models.ProductAccessGrant{
+			ProductID: product.ID,
+			UserID:    user.ID,
+			GrantedBy: admin.ID,
+		})
+		results[i].UserID = user.ID
+		results[i].Success = true
+	}
+
+	if err := s.ProductRepo.CreateProductAccessGrants(grants); err != nil {
+		return nil, errors.New("failed to grant product access: " + err.Error())
+	}
+
+	return results, nil
+}
+
+func (s *ProductService) RevokeProductAccess(admin models.User, eventSlug string, productID string, userID string) error {
+	product, err := s.getManagedEventProduct(admin, eventSlug, productID)
+	if err != nil {
+		return err
+	}
+
+	return s.ProductRepo.DeleteProductAccessGrant(product.ID, userID)
+}
+
+func (s *ProductService) GetProductAccessGrants(admin models.User, eventSlug string, productID string) ([]models.ProductAccessGrant, error) {
+	product, err := s.getManagedEventProduct(admin, eventSlug, productID)
+	if err != nil {
+		return nil, err
+	}
+
+	grants, err := s.ProductRepo.GetProductAccessGrants(product.ID)
+	if err != nil {
+		return nil, errors.New("failed to get product access grants: " + err.Error())
+	}
+
+	return grants, nil
+}
+
+// getCouponEvent returns the event when the user can manage its coupons
+func (s *ProductService) getCouponEvent(admin models.User, eventSlug string) (*models.Event, error) {
+	event, err := s.ProductRepo.GetEventBySlug(eventSlug)
+	if err != nil {
+		return nil, errors.New("event not found: " + err.Error())
+	}
+
+	if !admin.IsSuperUser && event.CreatedBy != admin.ID {
+		adminStatus, err := s.ProductRepo.GetAdminStatusForEvent(admin.ID, event.ID)
+		if err != nil || adminStatus.AdminType != models.AdminTypeMaster {
+			return nil, errors.New("unauthorized: only master admins can manage coupons")
+		}
+	}
+
+	return event, nil
+}
+
+func (s *ProductService) CreateCoupon(admin models.User, eventSlug string, req models.CouponRequest) (*models.Coupon, error) {
+	event, err := s.getCouponEvent(admin, eventSlug)
+	if err != nil {
+		return nil, err
+	}
+
+	code := normalizeCouponCode(req.Code)
+	if code == "" || len(code) > 32 {
+		return nil, errors.New("coupon code must have between 1 and 32 characters")
+	}
+
+	if (req.DiscountPercent > 0) == (req.DiscountInt > 0) {
+		return nil, errors.New("exactly one of discount_percent and discount_int must be set")
+	}
+	if req.DiscountPercent < 0 || req.DiscountPercent > 100 || req.DiscountInt < 0 {
+		return nil, errors.New("discount_percent must be between 1 and 100 and discount_int positive")
+	}
+
+	if req.MaxUses < 0 {
+		return nil, errors.New("max_uses can't be negative")
+	}
+
+	if req.ExpiresAt != nil && req.ExpiresAt.Before(time.Now()) {
+		return nil, errors.New("expires_at must be in the future")
+	}
+
+	if req.ProductID != nil {
+		product, err := s.ProductRepo.GetProductByID(*req.ProductID)
+		if err != nil {
+			return nil, errors.New("product not found: " + err.Error())
+		}
+		if product.EventID != event.ID {
+			return nil, errors.New("product does not belong to this event")
+		}
+	}
+
+	if _, err := s.ProductRepo.GetCouponByCode(event.ID, code); err == nil {
+		return nil, errors.New("a coupon with this code already exists")
+	}
+
+	coupon := &models.Coupon{
+		ID:              uuid.New().String(),
+		EventID:         event.ID,
+		Code:            code,
+		ProductID:       req.ProductID,
+		DiscountPercent: req.DiscountPercent,
+		DiscountInt:     req.DiscountInt,
+		MaxUses:         req.MaxUses,
+		ExpiresAt:       req.ExpiresAt,
+		CreatedBy:       admin.ID,
+	}
+
+	if err := s.ProductRepo.CreateCoupon(coupon); err != nil {
+		return nil, errors.New("failed to create coupon: " + err.Error())
+	}
+
+	return coupon, nil
+}
+
+func (s *ProductService) GetEventCoupons(admin models.User, eventSlug string) ([]models.Coupon, error) {
+	event, err := s.getCouponEvent(admin, eventSlug)
+	if err != nil {
+		return nil, err
+	}
+
+	coupons, err := s.ProductRepo.GetEventCoupons(event.ID)
+	if err != nil {
+		return nil, errors.New("failed to get coupons: " + err.Error())
+	}
+
+	return coupons, nil
+}
+
+// DeleteCoupon stops a coupon from being used, purchases already made keep their price
+func (s *ProductService) DeleteCoupon(admin models.User, eventSlug string, couponID string) error {
+	event, err := s.getCouponEvent(admin, eventSlug)
+	if err != nil {
+		return err
+	}
+
+	return s.ProductRepo.DeleteCoupon(event.ID, couponID)
+}
+
+const topGiftersLimit = 10
+
+func (s *ProductService) GetGiftingStats(admin models.User, eventSlug string) (*models.GiftingStats, error) {
+	event, err := s.ProductRepo.GetEventBySlug(eventSlug)
+	if err != nil {
+		return nil, errors.New("event not found: " + err.Error())
+	}
+
+	if !admin.IsSuperUser && event.CreatedBy != admin.ID {
+		adminStatus, err := s.ProductRepo.GetAdminStatusForEvent(admin.ID, event.ID)
+		if err != nil || (adminStatus.AdminType != models.AdminTypeMaster && adminStatus.AdminType != models.AdminTypeNormal) {
+			return nil, errors.New("unauthorized: only admins can see gifting stats")
+		}
+	}
+
+	stats, err := s.ProductRepo.GetGiftingStats(event.ID)
+	if err != nil {
+		return nil, errors.New("failed to get gifting stats: " + err.Error())
+	}
+
+	stats.TopGifters, err = s.ProductRepo.GetTopGifters(event.ID, topGiftersLimit)
+	if err != nil {
+		return nil, errors.New("failed to get top gifters: " + err.Error())
+	}
+	if stats.TopGifters == nil {
+		stats.TopGifters = []models.TopGifter{}
 	}
 
-	if ownedQuantity+req.Quantity > product.MaxOwnableQuantity {
-		text := fmt.Sprintf("user with %d of this product is trying to buy %d, max ownable quantity is %d, this exceeds it by %d", ownedQuantity, req.Quantity, product.MaxOwnableQuantity, ownedQuantity+req.Quantity-product.MaxOwnableQuantity)
-		return false, errors.New(text)
+	if stats.Recipients > 0 {
+		stats.RedemptionRate = math.Round(float64(stats.ActiveRecipients)/float64(stats.Recipients)*10000) / 10000
 	}
 
-	return true, nil
+	return stats, nil
 }
@@ -16,18 +16,22 @@ import (
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/suite"
+	"gorm.io/gorm"
 )
 
 type APISuite struct {
 	suite.Suite
 	router http.Handler
+	db     *gorm.DB
 }
 
 func (s *APISuite) SetupSuite() {
 	os.Setenv("TEST_MODE", "true")
+	os.Setenv("WAITLIST_CONFIRM_WINDOW", "60")
 	cfg := config.LoadConfig("../../.env")
 	database := db.Connect(*cfg)
-	s.router = router.InitializeMux(database, cfg)
+	s.db = database
+	s.router = router.InitializeMux(router.InitializeServices(database, cfg), cfg)
 }
 
 func TestAPISuite(t *testing.T) {
@@ -47,7 +51,65 @@ func (s *APISuite) TestUserFlow() {
 	})
 }
 
+func (s *APISuite) TestActivityWaitlistFlow() {
+	s.Run("1_UnregisterPromotesAndConfirm", func() {
+		s.WaitlistPromoteAndConfirm()
+	})
+	s.Run("2_ExpiredPromotionGoesToNextUser", func() {
+		s.WaitlistExpireAndPromoteNext()
+	})
+}
+
+func (s *APISuite) TestActivityRequirements() {
+	s.Run("RegisterRequiresAcknowledgement", func() {
+		s.RegisterRequiresAcknowledgement()
+	})
+}
+
+func (s *APISuite) TestTicketSingleOwnership() {
+	s.Run("BuyTicketTwice", func() {
+		s.BuyTicketTwice()
+	})
+}
+
+func (s *APISuite) TestFreeProductPurchase() {
+	s.Run("GrantsAccessWithoutPayment", func() {
+		s.BuyFreeProduct()
+	})
+}
+
+func (s *APISuite) TestProductPrice() {
+	s.Run("UenfDiscountAndCoupon", func() {
+		s.PriceWithDiscounts()
+	})
+}
+
+func (s *APISuite) TestProductDeletion() {
+	s.Run("NeverBoughtIsDeleted", func() {
+		s.DeleteNeverBoughtProduct()
+	})
+	s.Run("BoughtIsKept", func() {
+		s.DeleteBoughtProduct()
+	})
+}
+
+func (s *APISuite) TestCanGift() {
+	s.Run("RejectionReasons", func() {
+		s.CanGiftRejectionReasons()
+	})
+}
+
+func (s *APISuite) TestSuperPasswordRotation() {
+	s.Run("RotatedPasswordSurvivesRestart", func() {
+		s.RotateSuperPasswordAndRestart()
+	})
+}
+
 func (s *APISuite) request(method, path string, body any) (int, utilities.Response) {
+	return s.authRequest(method, path, "", "", body)
+}
+
+func (s *APISuite) authRequest(method, path, accessToken, refreshToken string, body any) (int, utilities.Response) {
 	var buf io.Reader
 	if body != nil {
 		b, _ := json.Marshal(body)
@@ -56,6 +118,10 @@ func (s *APISuite) request(method, path string, body any) (int, utilities.Respon
 
 	req := httptest.NewRequest(method, path, buf)
 	req.Header.Set("Content-Type", "application/json")
+	if accessToken != "" {
+		req.Header.Set("Authorization", "Bearer "+accessToken)
+		req.Header.Set("Refresh", "Bearer "+refreshToken)
+	}
 
 	w := httptest.NewRecorder()
 	s.router.ServeHTTP(w, req)
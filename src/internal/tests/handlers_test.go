@@ -5,11 +5,16 @@ import (
 	"fmt"
 	"net/http"
 	"net/http/httptest"
+	"scti/config"
 	"scti/internal/models"
+	repos "scti/internal/repositories"
+	"scti/internal/services"
 	"scti/internal/utilities"
+	"time"
 
 	"github.com/google/uuid"
 	"github.com/stretchr/testify/assert"
+	"golang.org/x/crypto/bcrypt"
 )
 
 func (s *APISuite) RegisterAndLogin() (string, string) {
@@ -89,3 +94,507 @@ func (s *APISuite) Logout(userAccessToken, userRefreshToken string) {
 		s.assertSuccess(w.Code, resp)
 	})
 }
+
+type testUser struct {
+	ID           string
+	Email        string
+	AccessToken  string
+	RefreshToken string
+}
+
+// RegisterVerifiedUser registers a user, marks it as verified and logs in
+// so the returned tokens pass the verified-only routes
+func (s *APISuite) RegisterVerifiedUser() testUser {
+	uid := uuid.NewString()[:8]
+	email := fmt.Sprintf("verified_%s@example.com", uid)
+	password := "testpassword123"
+
+	code, _ := s.request(http.MethodPost, "/register", models.UserRegister{
+		Email:    email,
+		Password: password,
+		Name:     fmt.Sprintf("TestName_%s", uid),
+		LastName: "TestLast",
+	})
+	s.Require().Equal(http.StatusCreated, code)
+
+	var user models.User
+	s.Require().NoError(s.db.Where("email = ?", email).First(&user).Error)
+	s.Require().NoError(s.db.Model(&user).Update("is_verified", true).Error)
+
+	code, resp := s.request(http.MethodPost, "/login", models.UserLogin{Email: email, Password: password})
+	s.assertSuccess(code, resp)
+
+	data := resp.Data.(map[string]interface{})
+	return testUser{
+		ID:           user.ID,
+		Email:        email,
+		AccessToken:  data["access_token"].(string),
+		RefreshToken: data["refresh_token"].(string),
+	}
+}
+
+// SeedEvent creates an ongoing event and registers the users to it
+func (s *APISuite) SeedEvent(users ...testUser) models.Event {
+	uid := uuid.NewString()[:8]
+	now := time.Now()
+
+	event := models.Event{
+		ID:        uuid.NewString(),
+		Slug:      "test-event-" + uid,
+		Name:      "Test event " + uid,
+		StartDate: now,
+		EndDate:   now.Add(72 * time.Hour),
+	}
+	s.Require().NoError(s.db.Create(&event).Error)
+
+	for _, user := range users {
+		s.Require().NoError(s.db.Create(&models.EventRegistration{EventID: event.ID, UserID: user.ID}).Error)
+	}
+
+	return event
+}
+
+// SeedWaitlistActivity creates an event with a single seat activity and registers the users to the event
+func (s *APISuite) SeedWaitlistActivity(users ...testUser) (models.Event, models.Activity) {
+	event := s.SeedEvent(users...)
+	now := time.Now()
+
+	activity := models.Activity{
+		ID:          uuid.NewString(),
+		EventID:     event.ID,
+		Name:        "Waitlist activity " + event.Slug,
+		Level:       models.ActivityNone,
+		Type:        models.ActivityMiniCurso,
+		MaxCapacity: 1,
+		StartTime:   now.Add(24 * time.Hour),
+		EndTime:     now.Add(26 * time.Hour),
+	}
+	s.Require().NoError(s.db.Create(&activity).Error)
+
+	return event, activity
+}
+
+func (s *APISuite) RegisterRequiresAcknowledgement() {
+	user := s.RegisterVerifiedUser()
+	event, activity := s.SeedWaitlistActivity(user)
+	activity.RequirementItems = []string{"Notebook", "Python 3.12"}
+	s.Require().NoError(s.db.Save(&activity).Error)
+
+	body := models.ActivityRegistrationRequest{ActivityID: activity.ID}
+	code, resp := s.authRequest(http.MethodPost, "/events/"+event.Slug+"/activity/register", user.AccessToken, user.RefreshToken, body)
+	assert.Equal(s.T(), http.StatusBadRequest, code)
+	assert.False(s.T(), resp.Success)
+	assert.Nil(s.T(), s.tentativeRegistration(activity.ID, user.ID))
+
+	body.AcknowledgedRequirements = true
+	code, resp = s.authRequest(http.MethodPost, "/events/"+event.Slug+"/activity/register", user.AccessToken, user.RefreshToken, body)
+	s.assertSuccess(code, resp)
+	assert.NotNil(s.T(), s.tentativeRegistration(activity.ID, user.ID))
+}
+
+func (s *APISuite) tentativeRegistration(activityID, userID string) *models.ActivityRegistration {
+	var registration models.ActivityRegistration
+	if err := s.db.Where("activity_id = ? AND user_id = ?", activityID, userID).First(&registration).Error; err != nil {
+		return nil
+	}
+	return &registration
+}
+
+func (s *APISuite) WaitlistPromoteAndConfirm() {
+	first, second := s.RegisterVerifiedUser(), s.RegisterVerifiedUser()
+	event, activity := s.SeedWaitlistActivity(first, second)
+	body := models.ActivityRegistrationRequest{ActivityID: activity.ID}
+
+	code, resp := s.authRequest(http.MethodPost, "/events/"+event.Slug+"/activity/register", first.AccessToken, first.RefreshToken, body)
+	s.assertSuccess(code, resp)
+
+	code, _ = s.authRequest(http.MethodPost, "/events/"+event.Slug+"/activity/register", second.AccessToken, second.RefreshToken, body)
+	assert.Equal(s.T(), http.StatusConflict, code)
+
+	code, resp = s.authRequest(http.MethodPost, "/events/"+event.Slug+"/activity/waitlist", second.AccessToken, second.RefreshToken, body)
+	s.assertSuccess(code, resp)
+
+	code, resp = s.authRequest(http.MethodPost, "/events/"+event.Slug+"/activity/unregister", first.AccessToken, first.RefreshToken, body)
+	s.assertSuccess(code, resp)
+
+	registration := s.tentativeRegistration(activity.ID, second.ID)
+	s.Require().NotNil(registration)
+	assert.NotNil(s.T(), registration.ConfirmBy)
+
+	// The freed seat is held for the waitlist, so the first user can't take it back
+	code, _ = s.authRequest(http.MethodPost, "/events/"+event.Slug+"/activity/register", first.AccessToken, first.RefreshToken, body)
+	assert.Equal(s.T(), http.StatusConflict, code)
+
+	code, resp = s.authRequest(http.MethodPost, "/events/"+event.Slug+"/activity/confirm-waitlist/"+activity.ID, second.AccessToken, second.RefreshToken, nil)
+	s.assertSuccess(code, resp)
+
+	registration = s.tentativeRegistration(activity.ID, second.ID)
+	s.Require().NotNil(registration)
+	assert.Nil(s.T(), registration.ConfirmBy)
+
+	var entries int64
+	s.db.Model(&models.ActivityWaitlist{}).Where("activity_id = ?", activity.ID).Count(&entries)
+	assert.Zero(s.T(), entries)
+}
+
+func (s *APISuite) WaitlistExpireAndPromoteNext() {
+	first, second, third := s.RegisterVerifiedUser(), s.RegisterVerifiedUser(), s.RegisterVerifiedUser()
+	event, activity := s.SeedWaitlistActivity(first, second, third)
+	body := models.ActivityRegistrationRequest{ActivityID: activity.ID}
+
+	code, resp := s.authRequest(http.MethodPost, "/events/"+event.Slug+"/activity/register", first.AccessToken, first.RefreshToken, body)
+	s.assertSuccess(code, resp)
+
+	for _, user := range []testUser{second, third} {
+		code, resp = s.authRequest(http.MethodPost, "/events/"+event.Slug+"/activity/waitlist", user.AccessToken, user.RefreshToken, body)
+		s.assertSuccess(code, resp)
+	}
+
+	code, resp = s.authRequest(http.MethodPost, "/events/"+event.Slug+"/activity/unregister", first.AccessToken, first.RefreshToken, body)
+	s.assertSuccess(code, resp)
+	s.Require().NotNil(s.tentativeRegistration(activity.ID, second.ID))
+	assert.Nil(s.T(), s.tentativeRegistration(activity.ID, third.ID))
+
+	// Let the second user's promotion lapse and run the sweeper once
+	s.Require().NoError(s.db.Model(&models.ActivityRegistration{}).
+		Where("activity_id = ? AND user_id = ?", activity.ID, second.ID).
+		Update("confirm_by", time.Now().Add(-time.Minute)).Error)
+	services.NewActivityService(repos.NewActivityRepo(s.db)).ExpireWaitlistPromotions()
+
+	assert.Nil(s.T(), s.tentativeRegistration(activity.ID, second.ID))
+
+	var expired models.ActivityWaitlist
+	s.Require().NoError(s.db.Where("activity_id = ? AND user_id = ?", activity.ID, second.ID).First(&expired).Error)
+	assert.Equal(s.T(), models.WaitlistExpired, expired.Status)
+
+	registration := s.tentativeRegistration(activity.ID, third.ID)
+	s.Require().NotNil(registration)
+	assert.NotNil(s.T(), registration.ConfirmBy)
+
+	code, _ = s.authRequest(http.MethodPost, "/events/"+event.Slug+"/activity/confirm-waitlist/"+activity.ID, second.AccessToken, second.RefreshToken, nil)
+	assert.Equal(s.T(), http.StatusBadRequest, code)
+}
+
+func (s *APISuite) BuyTicketTwice() {
+	user := s.RegisterVerifiedUser()
+	event := s.SeedEvent(user)
+
+	ticket := models.Product{
+		ID:                   uuid.NewString(),
+		EventID:              event.ID,
+		Name:                 "Ticket " + event.Slug,
+		PriceInt:             1000,
+		MaxOwnableQuantity:   1,
+		IsEventAccess:        true,
+		IsTicketType:         true,
+		IsPublic:             true,
+		HasUnlimitedQuantity: true,
+		ExpiresAt:            time.Now().Add(24 * time.Hour),
+	}
+	s.Require().NoError(s.db.Create(&ticket).Error)
+
+	// The first purchase went through, so the user owns the ticket
+	purchase := models.Purchase{ID: uuid.NewString(), UserID: user.ID, ProductID: ticket.ID, Quantity: 1}
+	s.Require().NoError(s.db.Create(&purchase).Error)
+	s.Require().NoError(s.db.Create(&models.UserProduct{
+		ID:         uuid.NewString(),
+		UserID:     user.ID,
+		ProductID:  ticket.ID,
+		PurchaseID: purchase.ID,
+		Quantity:   1,
+	}).Error)
+
+	// Raise the limit so only the single ownership rule can reject the second purchase
+	s.Require().NoError(s.db.Model(&ticket).Update("max_ownable_quantity", 2).Error)
+
+	code, resp := s.authRequest(http.MethodPost, "/events/"+event.Slug+"/purchase", user.AccessToken, user.RefreshToken, models.PurchaseRequest{
+		ProductID:                 ticket.ID,
+		Quantity:                  1,
+		PaymentMethodID:           "master",
+		PaymentMethodType:         "credit_card",
+		PaymentMethodToken:        "test-token",
+		PaymentMethodInstallments: 1,
+	})
+	assert.Equal(s.T(), http.StatusConflict, code)
+	assert.False(s.T(), resp.Success)
+	assert.Contains(s.T(), fmt.Sprint(resp.Errors), "you already own this ticket")
+}
+
+func (s *APISuite) BuyFreeProduct() {
+	user := s.RegisterVerifiedUser()
+	event, activity := s.SeedWaitlistActivity(user)
+
+	product := models.Product{
+		ID:                   uuid.NewString(),
+		EventID:              event.ID,
+		Name:                 "Free pass " + event.Slug,
+		PriceInt:             0,
+		MaxOwnableQuantity:   1,
+		IsPublic:             true,
+		HasUnlimitedQuantity: true,
+		ExpiresAt:            time.Now().Add(24 * time.Hour),
+	}
+	s.Require().NoError(s.db.Create(&product).Error)
+	s.Require().NoError(s.db.Create(&models.AccessTarget{
+		ID:        uuid.NewString(),
+		ProductID: product.ID,
+		TargetID:  activity.ID,
+		EventID:   &event.ID,
+	}).Error)
+
+	// No payment info at all, any call to Mercado Pago would fail the purchase
+	code, resp := s.authRequest(http.MethodPost, "/events/"+event.Slug+"/purchase", user.AccessToken, user.RefreshToken, models.PurchaseRequest{
+		ProductID: product.ID,
+		Quantity:  1,
+	})
+	s.assertSuccess(code, resp)
+
+	data := resp.Data.(map[string]interface{})
+	assert.Nil(s.T(), data["purchase_resource"])
+
+	var owned int64
+	s.db.Model(&models.UserProduct{}).Where("user_id = ? AND product_id = ?", user.ID, product.ID).Count(&owned)
+	assert.Equal(s.T(), int64(1), owned)
+
+	assert.NotNil(s.T(), s.tentativeRegistration(activity.ID, user.ID))
+}
+
+func (s *APISuite) PriceWithDiscounts() {
+	user := s.RegisterVerifiedUser()
+	event := s.SeedEvent(user)
+	s.Require().NoError(s.db.Model(&models.User{}).Where("id = ?", user.ID).Update("is_uenf", true).Error)
+
+	product := models.Product{
+		ID:                   uuid.NewString(),
+		EventID:              event.ID,
+		Name:                 "Shirt " + event.Slug,
+		PriceInt:             1000,
+		UenfDiscountPercent:  50,
+		MaxOwnableQuantity:   5,
+		IsPublic:             true,
+		HasUnlimitedQuantity: true,
+		ExpiresAt:            time.Now().Add(24 * time.Hour),
+	}
+	s.Require().NoError(s.db.Create(&product).Error)
+	s.Require().NoError(s.db.Create(&models.Coupon{
+		ID:              uuid.NewString(),
+		EventID:         event.ID,
+		Code:            "SCTI10",
+		DiscountPercent: 10,
+	}).Error)
+
+	path := "/events/" + event.Slug + "/products/" + product.ID + "/price?quantity=2"
+	code, resp := s.authRequest(http.MethodGet, path, user.AccessToken, user.RefreshToken, nil)
+	s.assertSuccess(code, resp)
+	data := resp.Data.(map[string]interface{})
+	assert.Equal(s.T(), float64(2000), data["subtotal_int"])
+	assert.Equal(s.T(), float64(1000), data["total_int"])
+
+	// The coupon applies over the UENF price, 10% of 500 per unit
+	code, resp = s.authRequest(http.MethodGet, path+"&coupon=scti10", user.AccessToken, user.RefreshToken, nil)
+	s.assertSuccess(code, resp)
+	data = resp.Data.(map[string]interface{})
+	assert.Equal(s.T(), float64(900), data["total_int"])
+	assert.Equal(s.T(), "SCTI10", data["coupon"])
+	assert.Len(s.T(), data["adjustments"], 2)
+
+	code, resp = s.authRequest(http.MethodGet, path+"&coupon=UNKNOWN", user.AccessToken, user.RefreshToken, nil)
+	assert.Equal(s.T(), http.StatusBadRequest, code)
+	assert.Contains(s.T(), fmt.Sprint(resp.Errors), "invalid coupon code")
+}
+
+// SeedOwnedEventProduct creates an event owned by the user with a single product
+func (s *APISuite) SeedOwnedEventProduct(owner testUser) (models.Event, models.Product) {
+	event := s.SeedEvent(owner)
+	s.Require().NoError(s.db.Model(&event).Update("created_by", owner.ID).Error)
+
+	product := models.Product{
+		ID:                   uuid.NewString(),
+		EventID:              event.ID,
+		Name:                 "Merch " + event.Slug,
+		PriceInt:             1000,
+		MaxOwnableQuantity:   1,
+		IsPublic:             true,
+		HasUnlimitedQuantity: true,
+		ExpiresAt:            time.Now().Add(24 * time.Hour),
+	}
+	s.Require().NoError(s.db.Create(&product).Error)
+
+	return event, product
+}
+
+func (s *APISuite) DeleteNeverBoughtProduct() {
+	owner := s.RegisterVerifiedUser()
+	event, product := s.SeedOwnedEventProduct(owner)
+
+	code, resp := s.authRequest(http.MethodDelete, "/events/"+event.Slug+"/product", owner.AccessToken, owner.RefreshToken, models.ProductDeleteRequest{
+		ProductID: product.ID,
+	})
+	s.assertSuccess(code, resp)
+
+	var remaining int64
+	s.db.Model(&models.Product{}).Where("id = ?", product.ID).Count(&remaining)
+	assert.Zero(s.T(), remaining)
+}
+
+func (s *APISuite) DeleteBoughtProduct() {
+	owner, buyer := s.RegisterVerifiedUser(), s.RegisterVerifiedUser()
+	event, product := s.SeedOwnedEventProduct(owner)
+
+	purchase := models.Purchase{ID: uuid.NewString(), UserID: buyer.ID, ProductID: product.ID, Quantity: 1}
+	s.Require().NoError(s.db.Create(&purchase).Error)
+	s.Require().NoError(s.db.Create(&models.UserProduct{
+		ID:         uuid.NewString(),
+		UserID:     buyer.ID,
+		ProductID:  product.ID,
+		PurchaseID: purchase.ID,
+		Quantity:   1,
+	}).Error)
+
+	code, resp := s.authRequest(http.MethodDelete, "/events/"+event.Slug+"/product", owner.AccessToken, owner.RefreshToken, models.ProductDeleteRequest{
+		ProductID: product.ID,
+	})
+	assert.Equal(s.T(), http.StatusConflict, code)
+	assert.False(s.T(), resp.Success)
+	assert.Contains(s.T(), fmt.Sprint(resp.Errors), "has been purchased")
+
+	var remaining int64
+	s.db.Model(&models.Product{}).Where("id = ?", product.ID).Count(&remaining)
+	assert.Equal(s.T(), int64(1), remaining)
+}
+
+func (s *APISuite) CanGiftRejectionReasons() {
+	gifter, registered, outsider, ticketOwner := s.RegisterVerifiedUser(), s.RegisterVerifiedUser(), s.RegisterVerifiedUser(), s.RegisterVerifiedUser()
+	event := s.SeedEvent(gifter, registered, ticketOwner)
+
+	ticket := models.Product{
+		ID:                   uuid.NewString(),
+		EventID:              event.ID,
+		Name:                 "Ticket " + event.Slug,
+		PriceInt:             1000,
+		MaxOwnableQuantity:   1,
+		IsEventAccess:        true,
+		IsTicketType:         true,
+		IsPublic:             true,
+		HasUnlimitedQuantity: true,
+		ExpiresAt:            time.Now().Add(24 * time.Hour),
+	}
+	s.Require().NoError(s.db.Create(&ticket).Error)
+
+	merch := models.Product{
+		ID:                   uuid.NewString(),
+		EventID:              event.ID,
+		Name:                 "Merch " + event.Slug,
+		PriceInt:             1000,
+		MaxOwnableQuantity:   2,
+		IsPublic:             true,
+		HasUnlimitedQuantity: true,
+		ExpiresAt:            time.Now().Add(24 * time.Hour),
+	}
+	s.Require().NoError(s.db.Create(&merch).Error)
+
+	// The ticket owner already has the ticket and one unit of the merch
+	for _, product := range []models.Product{ticket, merch} {
+		purchase := models.Purchase{ID: uuid.NewString(), UserID: ticketOwner.ID, ProductID: product.ID, Quantity: 1}
+		s.Require().NoError(s.db.Create(&purchase).Error)
+		s.Require().NoError(s.db.Create(&models.UserProduct{
+			ID:         uuid.NewString(),
+			UserID:     ticketOwner.ID,
+			ProductID:  product.ID,
+			PurchaseID: purchase.ID,
+			Quantity:   1,
+		}).Error)
+	}
+
+	canGift := func(email, productID string, quantity int) map[string]interface{} {
+		code, resp := s.authRequest(http.MethodPost, "/can-gift", gifter.AccessToken, gifter.RefreshToken, models.CanGiftRequest{
+			Email:     email,
+			ProductID: productID,
+			Quantity:  quantity,
+		})
+		s.assertSuccess(code, resp)
+		return resp.Data.(map[string]interface{})
+	}
+
+	data := canGift("nobody_"+uuid.NewString()[:8]+"@example.com", ticket.ID, 1)
+	assert.False(s.T(), data["can_gift"].(bool))
+	assert.Equal(s.T(), "recipient not found", data["reason"])
+
+	data = canGift(gifter.Email, ticket.ID, 1)
+	assert.False(s.T(), data["can_gift"].(bool))
+	assert.Equal(s.T(), "cannot gift yourself", data["reason"])
+
+	data = canGift(outsider.Email, ticket.ID, 1)
+	assert.False(s.T(), data["can_gift"].(bool))
+	assert.Equal(s.T(), "recipient is not registered to the event of the product", data["reason"])
+
+	data = canGift(ticketOwner.Email, ticket.ID, 1)
+	assert.False(s.T(), data["can_gift"].(bool))
+	assert.Equal(s.T(), "gift recipient already owns this ticket", data["reason"])
+
+	data = canGift(ticketOwner.Email, merch.ID, 2)
+	assert.False(s.T(), data["can_gift"].(bool))
+	assert.Equal(s.T(), "recipient would own 3 of this product, max ownable quantity is 2", data["reason"])
+
+	data = canGift(registered.Email, ticket.ID, 1)
+	assert.True(s.T(), data["can_gift"].(bool))
+	assert.Nil(s.T(), data["reason"])
+
+	// Buying the gift goes through the same checks, rejected before any payment is attempted
+	code, resp := s.authRequest(http.MethodPost, "/events/"+event.Slug+"/purchase", gifter.AccessToken, gifter.RefreshToken, models.PurchaseRequest{
+		ProductID:                 ticket.ID,
+		Quantity:                  1,
+		IsGift:                    true,
+		GiftedToEmail:             &ticketOwner.Email,
+		PaymentMethodID:           "master",
+		PaymentMethodType:         "credit_card",
+		PaymentMethodToken:        "test-token",
+		PaymentMethodInstallments: 1,
+	})
+	assert.Equal(s.T(), http.StatusConflict, code)
+	assert.False(s.T(), resp.Success)
+	assert.Contains(s.T(), fmt.Sprint(resp.Errors), "invalid gift: gift recipient already owns this ticket")
+}
+
+func (s *APISuite) RotateSuperPasswordAndRestart() {
+	email, oldPassword := config.GetSystemEmail(), config.GetMasterUserPass()
+	newPassword := "Rotated#Pass1" + uuid.NewString()[:8]
+
+	var superUser models.User
+	s.Require().NoError(s.db.Where("email = ?", email).First(&superUser).Error)
+	s.T().Cleanup(func() {
+		hash, err := bcrypt.GenerateFromPassword([]byte(oldPassword), bcrypt.DefaultCost)
+		s.Require().NoError(err)
+		s.Require().NoError(repos.NewAuthRepo(s.db).UpdateUserPassword(superUser.ID, string(hash)))
+	})
+
+	code, resp := s.request(http.MethodPost, "/login", models.UserLogin{Email: email, Password: oldPassword})
+	s.assertSuccess(code, resp)
+	data := resp.Data.(map[string]interface{})
+	access, refresh := data["access_token"].(string), data["refresh_token"].(string)
+
+	code, _ = s.authRequest(http.MethodPost, "/admin/rotate-super-password", access, refresh, map[string]string{
+		"current_password": oldPassword,
+		"new_password":     "weak",
+	})
+	assert.Equal(s.T(), http.StatusBadRequest, code)
+
+	code, resp = s.authRequest(http.MethodPost, "/admin/rotate-super-password", access, refresh, map[string]string{
+		"current_password": oldPassword,
+		"new_password":     newPassword,
+	})
+	s.assertSuccess(code, resp)
+
+	// Every session was revoked by the rotation
+	code, _ = s.authRequest(http.MethodGet, "/refresh-tokens", access, refresh, nil)
+	assert.Equal(s.T(), http.StatusUnauthorized, code)
+
+	// Booting again must not put the configured password back
+	repos.NewAuthRepo(s.db).CreateSuperUser()
+
+	code, _ = s.request(http.MethodPost, "/login", models.UserLogin{Email: email, Password: oldPassword})
+	assert.NotEqual(s.T(), http.StatusOK, code)
+
+	code, resp = s.request(http.MethodPost, "/login", models.UserLogin{Email: email, Password: newPassword})
+	s.assertSuccess(code, resp)
+}
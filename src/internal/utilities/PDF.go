@@ -0,0 +1,62 @@
+package utilities
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
+
+// BuildPDF wraps a page content stream in a single page PDF document. The content may use
+// /F1 (Helvetica) and /F2 (Helvetica-Bold), its text is expected in UTF-8 and is written in
+// WinAnsi, the encoding of the standard fonts, characters outside of it become '?'
+func BuildPDF(content []byte, width, height float64) []byte {
+	stream := toWinAnsi(content)
+
+	objects := []string{
+		"<< /Type /Catalog /Pages 2 0 R >>",
+		"<< /Type /Pages /Kids [3 0 R] /Count 1 >>",
+		fmt.Sprintf("<< /Type /Page /Parent 2 0 R /MediaBox [0 0 %.2f %.2f] /Resources << /Font << /F1 4 0 R /F2 5 0 R >> >> /Contents 6 0 R >>", width, height),
+		"<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica /Encoding /WinAnsiEncoding >>",
+		"<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica-Bold /Encoding /WinAnsiEncoding >>",
+		fmt.Sprintf("<< /Length %d >>\nstream\n%s\nendstream", len(stream), stream),
+	}
+
+	var pdf bytes.Buffer
+	pdf.WriteString("%PDF-1.4\n")
+	offsets := make([]int, len(objects))
+	for i, object := range objects {
+		offsets[i] = pdf.Len()
+		fmt.Fprintf(&pdf, "%d 0 obj\n%s\nendobj\n", i+1, object)
+	}
+
+	xref := pdf.Len()
+	fmt.Fprintf(&pdf, "xref\n0 %d\n0000000000 65535 f \n", len(objects)+1)
+	for _, offset := range offsets {
+		fmt.Fprintf(&pdf, "%010d 00000 n \n", offset)
+	}
+	fmt.Fprintf(&pdf, "trailer\n<< /Size %d /Root 1 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(objects)+1, xref)
+
+	return pdf.Bytes()
+}
+
+// PDFText escapes a value to be placed inside a PDF string literal
+func PDFText(value string) string {
+	value = strings.Join(strings.Fields(value), " ")
+	return strings.NewReplacer(`\`, `\\`, "(", `\(`, ")", `\)`).Replace(value)
+}
+
+// toWinAnsi converts UTF-8 text to WinAnsi, which matches Latin-1 for the accented letters used in Portuguese
+func toWinAnsi(content []byte) []byte {
+	out := make([]byte, 0, len(content))
+	for len(content) > 0 {
+		r, size := utf8.DecodeRune(content)
+		content = content[size:]
+		if r < 0x80 || (r >= 0xA0 && r <= 0xFF) {
+			out = append(out, byte(r))
+		} else {
+			out = append(out, '?')
+		}
+	}
+	return out
+}
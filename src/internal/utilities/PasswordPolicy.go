@@ -0,0 +1,35 @@
+package utilities
+
+import (
+	"errors"
+	"unicode"
+)
+
+const MinPasswordLength = 12
+
+// ValidatePasswordPolicy checks the rules for privileged account passwords
+func ValidatePasswordPolicy(password string) error {
+	if len(password) < MinPasswordLength {
+		return errors.New("password must be at least 12 characters long")
+	}
+
+	var hasUpper, hasLower, hasDigit, hasSymbol bool
+	for _, c := range password {
+		switch {
+		case unicode.IsUpper(c):
+			hasUpper = true
+		case unicode.IsLower(c):
+			hasLower = true
+		case unicode.IsDigit(c):
+			hasDigit = true
+		case unicode.IsPunct(c) || unicode.IsSymbol(c):
+			hasSymbol = true
+		}
+	}
+
+	if !hasUpper || !hasLower || !hasDigit || !hasSymbol {
+		return errors.New("password must contain upper and lower case letters, a digit and a symbol")
+	}
+
+	return nil
+}
@@ -1,11 +1,16 @@
 package main
 
 import (
+	"context"
 	"log"
 	"net/http"
+	"os"
+	"os/signal"
 	"scti/config"
 	"scti/internal/db"
 	"scti/internal/router"
+	"syscall"
+	"time"
 
 	_ "scti/docs"
 )
@@ -24,8 +29,39 @@ func main() {
 		cfg.PORT = "8080"
 	}
 
-	mux := router.InitializeMux(database, cfg)
+	svc := router.InitializeServices(database, cfg)
+	mux := router.InitializeMux(svc, cfg)
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	// Unconfirmed waitlist promotions only expire when a confirmation window is set
+	if config.GetWaitlistConfirmWindow() > 0 {
+		svc.Activity.StartWaitlistSweeper(ctx, time.Minute)
+	}
+
+	// Unpaid pix purchases are only cancelled when a TTL is set
+	if config.GetPixPurchaseTTL() > 0 {
+		svc.Product.StartPixPurchaseSweeper(ctx, time.Minute)
+	}
+
+	server := &http.Server{Addr: ":" + cfg.PORT, Handler: mux}
+	shutdownDone := make(chan struct{})
+	go func() {
+		defer close(shutdownDone)
+		<-ctx.Done()
+		log.Println("Shutting down server")
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		if err := server.Shutdown(shutdownCtx); err != nil {
+			log.Printf("Failed to shut down server gracefully: %v", err)
+		}
+	}()
 
 	log.Println("Started server on port: " + cfg.PORT)
-	log.Fatal(http.ListenAndServe(":"+cfg.PORT, mux))
+	if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+		log.Fatal(err)
+	}
+	// ListenAndServe returns as soon as Shutdown starts, wait for in-flight requests to finish
+	<-shutdownDone
 }